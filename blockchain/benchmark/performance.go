@@ -40,6 +40,7 @@ func testTPS() {
 		// Add transactions to pool
 		for i := 0; i < txCount; i++ {
 			tx := txpool.NewTransaction(
+				txpool.DefaultChainID,
 				fmt.Sprintf("sender-%d", i),
 				fmt.Sprintf("receiver-%d", i),
 				float64(rand.Intn(1000))+1.0,
@@ -83,6 +84,7 @@ func testBlockCreationTime() {
 		// Add transactions to pool
 		for i := 0; i < txCount; i++ {
 			tx := txpool.NewTransaction(
+				txpool.DefaultChainID,
 				fmt.Sprintf("sender-%d", i),
 				fmt.Sprintf("receiver-%d", i),
 				float64(rand.Intn(1000))+1.0,
@@ -95,7 +97,7 @@ func testBlockCreationTime() {
 		// Simulate block creation (similar to consensus switcher)
 		transactions := txPool.GetTransactions(txCount)
 		if len(transactions) > 0 {
-			prevBlock := chain.Blocks[len(chain.Blocks)-1]
+			prevBlock := chain.GetLatestBlock()
 			block := &blockchain.Block{
 				Index:        prevBlock.Index + 1,
 				Timestamp:    time.Now().Unix(),
@@ -110,7 +112,7 @@ func testBlockCreationTime() {
 			block.Signature = signatureBytes
 			
 			// Add block to chain
-			chain.Blocks = append(chain.Blocks, block)
+			chain.AddBlock(block)
 			
 			// Remove transactions from pool
 			for _, tx := range transactions {
@@ -145,6 +147,7 @@ func testConcurrentTransactions() {
 			
 			for i := 0; i < transactionsPerWorker; i++ {
 				tx := txpool.NewTransaction(
+					txpool.DefaultChainID,
 					fmt.Sprintf("worker-%d-sender-%d", workerID, i),
 					fmt.Sprintf("worker-%d-receiver-%d", workerID, i),
 					float64(rand.Intn(1000))+1.0,
@@ -181,6 +184,7 @@ func demonstrateMemoryEfficiency() {
 	transactionCount := 10000
 	for i := 0; i < transactionCount; i++ {
 		tx := txpool.NewTransaction(
+			txpool.DefaultChainID,
 			fmt.Sprintf("sender-%d", i),
 			fmt.Sprintf("receiver-%d", i),
 			float64(i)+1.0,
@@ -7,6 +7,7 @@
 // Реализованные компоненты:
 // - @blockchain/consensus/bft/tendermint.go — BFT-консенсус (Tendermint)
 // - @blockchain/consensus/bft/tcp.go — TCP-сервер для межвалидаторной связи
+// - @blockchain/consensus/hotstuff/hotstuff.go — конвейерный HotStuff (для сравнения с Tendermint)
 // - @blockchain/scalability/sharding/shard.go — адаптивное шардирование
 // - @blockchain/network/gossip/gossip.go — Gossip-протокол для рассылки сообщений
 // - @blockchain/storage/blockchain/chain.go — блокчейн хранилище
@@ -20,21 +21,25 @@ package main
 
 import (
 	"crypto/tls"
-	"encoding/json"
 	"fmt"
 	"math/rand"
 	"net"
+	"os"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"blockchain/codec"
 	"blockchain/consensus/bft"
+	"blockchain/consensus/consensustest"
+	"blockchain/consensus/hotstuff"
 	"blockchain/consensus/pos"
 	"blockchain/crypto/signature"
 	"blockchain/network/gossip"
 	"blockchain/network/p2p"
 	"blockchain/storage/blockchain"
+	"blockchain/storage/state"
 	"blockchain/storage/txpool"
 )
 
@@ -55,6 +60,9 @@ type CBDCConfig struct {
 	B2BPercent       float64 // Доля B2B-операций (%)
 	SmartContractPct float64 // Доля самоисполняемых сделок (%)
 	TestDuration     time.Duration // Длительность теста
+	// Движок консенсуса: bft.EngineName или hotstuff.EngineName; пустой —
+	// из BLOCKCHAIN_CBDC_CONSENSUS, по умолчанию BFT
+	Consensus string
 }
 
 // CBDCResults - результаты моделирования сценария ПлЦР
@@ -213,24 +221,29 @@ func calculateCBDCFee(txType string, amount float64) float64 {
 func createCBDCtx(txType string, counter int64, signer signature.Signer, pubKeyFor string) *txpool.Transaction {
 	var from, to string
 	var amount float64
+	var nonce uint64 // отправители перебираются по кругу, номер круга — nonce
 
 	switch txType {
 	case "C2C":
 		from = fmt.Sprintf("citizen-%d", counter%1000)
 		to = fmt.Sprintf("citizen-%d", (counter+1)%1000)
 		amount = 1000 + float64(counter%10000)
+		nonce = uint64(counter / 1000)
 	case "C2B":
 		from = fmt.Sprintf("citizen-%d", counter%1000)
 		to = fmt.Sprintf("merchant-%d", counter%100)
 		amount = 500 + float64(counter%50000)
+		nonce = uint64(counter / 1000)
 	case "B2B":
 		from = fmt.Sprintf("company-%d", counter%50)
 		to = fmt.Sprintf("company-%d", (counter+1)%50)
 		amount = 10000 + float64(counter%1000000)
+		nonce = uint64(counter / 50)
 	case "SMART_CONTRACT":
 		from = fmt.Sprintf("contract-%d", counter%20)
 		to = fmt.Sprintf("party-%d", counter%20)
 		amount = float64(counter % 100000)
+		nonce = uint64(counter / 20)
 	}
 
 	fee := calculateCBDCFee(txType, amount)
@@ -241,8 +254,11 @@ func createCBDCtx(txType string, counter int64, signer signature.Signer, pubKeyF
 		To:        to,
 		Amount:    amount,
 		Fee:       fee,
+		Nonce:     nonce,
+		ChainID:   txpool.DefaultChainID,
 		Timestamp: time.Now().UnixNano(),
 	}
+	tx.ID = tx.ComputeID()
 
 	// Подписываем транзакцию криптографически
 	if signer != nil {
@@ -297,6 +313,10 @@ func initializeValidatorNetwork(numValidators, numShards int, t *testing.T) ([]*
 		// Создаём блокчейн и пул транзакций для каждого валидатора
 		chain := blockchain.NewBlockchain()
 		txPool := txpool.NewTransactionPool()
+		stateMachine, err := state.NewStateMachine(chain, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create state for validator %d: %w", i, err)
+		}
 
 		// Создаём BFT-ноду с реальной конфигурацией
 		bftNode := bft.NewBFTNode(
@@ -304,7 +324,7 @@ func initializeValidatorNetwork(numValidators, numShards int, t *testing.T) ([]*
 			validator,
 			pos.ValidatorPool{validator},
 			txPool,
-			chain,
+			stateMachine,
 			signer,
 			peerAddresses[i],
 			peerAddresses, // Все пиры для full-mesh связи
@@ -395,9 +415,12 @@ func handleIncomingMessage(node *ValidatorNode, conn net.Conn) {
 	}
 
 	// Читаем сообщение консенсуса
-	decoder := json.NewDecoder(tlsConn)
-	var msg gossip.SignedConsensusMessage
-	if err := decoder.Decode(&msg); err != nil {
+	frame, err := codec.ReadFrame(tlsConn)
+	if err != nil {
+		return
+	}
+	msg, err := gossip.DecodeSignedMessage(frame)
+	if err != nil {
 		return
 	}
 
@@ -596,13 +619,7 @@ func runBFTConsensusRound(shardNodes []*ValidatorNode, blockSize int) (time.Dura
 		for _, node := range shardNodes {
 			blockMu.Lock()
 			// Проверяем, нет ли уже такого блока
-			hasBlock := false
-			for _, b := range node.Chain.Blocks {
-				if b.Hash == proposedBlock.Hash {
-					hasBlock = true
-					break
-				}
-			}
+			hasBlock := node.Chain.HasBlock(proposedBlock.Hash)
 
 			if !hasBlock {
 				node.Chain.AddBlock(proposedBlock)
@@ -622,6 +639,273 @@ func runBFTConsensusRound(shardNodes []*ValidatorNode, blockSize int) (time.Dura
 	return elapsedTime, blocksCommitted, int64(len(prevotes) + len(precommits))
 }
 
+// ============================================================================
+// КОНСЕНСУС ШАРДА НА АВТОМАТАХ consensus/bft И consensus/hotstuff
+// ============================================================================
+
+// cbdcShard - консенсус шарда на конечных автоматах выбранного движка:
+// bft.ConsensusState (Tendermint) или hotstuff.HotStuff. Автоматы валидаторов
+// шарда обмениваются сообщениями через consensustest.Network, а таймауты
+// идут по bft.SimClock, который каждый тик сценария догоняет системное время.
+// Сеть доставляет сообщения мгновенно, поэтому разница движков — в числе
+// сообщений и в паузах между блоками, которые задают их таймауты.
+type cbdcShard struct {
+	engine     string
+	nodes      map[string]*ValidatorNode // узлы шарда по адресу валидатора
+	validators pos.ValidatorPool
+	pool       *txpool.TransactionPool // транзакции шарда приходят на первую ноду
+	blockSize  int
+	clock      *bft.SimClock
+
+	bftNet *consensustest.Network[*bft.ConsensusState]
+	hsNet  *consensustest.Network[*hotstuff.HotStuff]
+
+	tip          *blockchain.Block // последний зафиксированный блок
+	blocks       int64
+	committedTxs int64
+	finality     time.Duration // суммарное время от создания транзакций до фиксации
+}
+
+// newCBDCShard запускает автоматы движка engine для валидаторов шарда
+func newCBDCShard(engine string, shardNodes []*ValidatorNode, blockSize int) (*cbdcShard, error) {
+	s := &cbdcShard{
+		engine:    engine,
+		nodes:     make(map[string]*ValidatorNode),
+		pool:      shardNodes[0].TxPool,
+		blockSize: blockSize,
+		clock:     bft.NewSimClock(time.Now()),
+		tip:       shardNodes[0].Chain.GetLatestBlock(),
+	}
+	for _, node := range shardNodes {
+		pubKey, err := signature.ParsePublicKey(node.Signer.PublicKey())
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key of %s: %w", node.ID, err)
+		}
+		signature.RegisterPublicKey(node.Validator.Address, pubKey)
+		s.nodes[node.Validator.Address] = node
+		s.validators = append(s.validators, node.Validator)
+	}
+
+	switch engine {
+	case bft.EngineName:
+		s.bftNet = consensustest.NewNetwork[*bft.ConsensusState]()
+		for _, v := range s.validators {
+			backend := &cbdcBFTBackend{shard: s, address: v.Address}
+			s.bftNet.Nodes[v.Address] = bft.NewConsensusState(v.Address, s.nodes[v.Address].Signer, backend, s.clock, nil)
+		}
+		s.bftNet.Hold(func() {
+			for _, addr := range s.bftNet.Addresses() {
+				s.bftNet.Nodes[addr].Start(s.tip.Index + 1)
+			}
+		})
+	case hotstuff.EngineName:
+		s.hsNet = consensustest.NewNetwork[*hotstuff.HotStuff]()
+		for _, v := range s.validators {
+			backend := &cbdcHotStuffBackend{shard: s, address: v.Address}
+			s.hsNet.Nodes[v.Address] = hotstuff.NewHotStuff(v.Address, s.nodes[v.Address].Signer, backend, s.clock, nil)
+		}
+		s.hsNet.Hold(func() {
+			for _, addr := range s.hsNet.Addresses() {
+				s.hsNet.Nodes[addr].Start(s.tip)
+			}
+		})
+	default:
+		return nil, fmt.Errorf("unknown consensus engine %q", engine)
+	}
+	return s, nil
+}
+
+// advance переводит часы шарда на текущее время: автоматы обрабатывают
+// наступившие таймауты и всё, что из них следует. Возвращает время обработки
+// и число зафиксированных за это время блоков.
+func (s *cbdcShard) advance() (time.Duration, int64) {
+	startTime := time.Now()
+	blocks := s.blocks
+	s.clock.Advance(time.Since(s.clock.Now()))
+	return time.Since(startTime), s.blocks - blocks
+}
+
+// stop останавливает автоматы шарда
+func (s *cbdcShard) stop() {
+	if s.bftNet != nil {
+		for _, cs := range s.bftNet.Nodes {
+			cs.Stop()
+		}
+	}
+	if s.hsNet != nil {
+		for _, hs := range s.hsNet.Nodes {
+			hs.Stop()
+		}
+	}
+}
+
+// sent учитывает у отправителя сообщение, принятое сетью к доставке
+func (s *cbdcShard) sent(from string, delivered bool) {
+	if delivered {
+		atomic.AddInt64(&s.nodes[from].MessagesSent, 1)
+	}
+}
+
+// proposeBlock собирает блок поверх parent из транзакций пула, ещё не
+// вошедших в незафиксированную ветку branch
+func (s *cbdcShard) proposeBlock(address string, parent *blockchain.Block, branch []*blockchain.Block) *blockchain.Block {
+	included := make(map[string]bool)
+	for _, block := range branch {
+		for _, tx := range block.Transactions {
+			included[tx.ID] = true
+		}
+	}
+	var txs []*txpool.Transaction
+	for _, tx := range s.pool.GetTransactions(s.blockSize + len(included)) {
+		if !included[tx.ID] && len(txs) < s.blockSize {
+			txs = append(txs, tx)
+		}
+	}
+	atomic.AddInt64(&s.nodes[address].BlocksProposed, 1)
+	return blockchain.NewBlock(parent.Index+1, parent.Hash, txs, address)
+}
+
+// commitBlock фиксирует блок у валидатора address; транзакции убираются из
+// пула и учитываются один раз — у первого зафиксировавшего блок валидатора
+func (s *cbdcShard) commitBlock(address string, block *blockchain.Block) error {
+	node := s.nodes[address]
+	if err := node.Chain.AddBlock(block); err != nil {
+		return err
+	}
+	atomic.AddInt64(&node.BlocksCommitted, 1)
+	if block.Index <= s.tip.Index {
+		return nil
+	}
+	s.tip = block
+	s.blocks++
+	now := s.clock.Now()
+	for _, tx := range block.Transactions {
+		s.pool.RemoveTransaction(tx.ID)
+		s.finality += now.Sub(time.Unix(0, tx.Timestamp))
+		s.committedTxs++
+	}
+	return nil
+}
+
+// cbdcBFTBackend - окружение автомата Tendermint валидатора шарда;
+// пропосеры сменяются по кругу
+type cbdcBFTBackend struct {
+	shard   *cbdcShard
+	address string
+}
+
+func (b *cbdcBFTBackend) Validators(height int64) pos.ValidatorPool { return b.shard.validators }
+func (b *cbdcBFTBackend) HasPendingTxs() bool                       { return b.shard.pool.Size() > 0 }
+func (b *cbdcBFTBackend) ReportEvidence(e *blockchain.Evidence)     {}
+
+func (b *cbdcBFTBackend) Proposer(height, round int64) string {
+	validators := b.shard.validators
+	return validators[(height+round)%int64(len(validators))].Address
+}
+
+func (b *cbdcBFTBackend) ProposeBlock(height int64) (*blockchain.Block, error) {
+	return b.shard.proposeBlock(b.address, b.shard.tip, nil), nil
+}
+
+func (b *cbdcBFTBackend) ValidateBlock(block *blockchain.Block) error {
+	if block.PrevHash != b.shard.tip.Hash {
+		return fmt.Errorf("block %d does not extend %s", block.Index, b.shard.tip.Hash)
+	}
+	return nil
+}
+
+func (b *cbdcBFTBackend) BroadcastProposal(p *bft.Proposal) {
+	net := b.shard.bftNet
+	for _, addr := range net.Addresses() {
+		if addr != b.address {
+			b.shard.sent(b.address, net.Send(b.address, addr, func(cs *bft.ConsensusState) { cs.HandleProposal(p) }))
+		}
+	}
+}
+
+func (b *cbdcBFTBackend) BroadcastVote(v *bft.Vote) {
+	net := b.shard.bftNet
+	for _, addr := range net.Addresses() {
+		if addr != b.address {
+			b.shard.sent(b.address, net.Send(b.address, addr, func(cs *bft.ConsensusState) { cs.HandleVote(v) }))
+		}
+	}
+}
+
+func (b *cbdcBFTBackend) CommitBlock(block *blockchain.Block, commit *blockchain.Commit) error {
+	block.Commit = commit
+	return b.shard.commitBlock(b.address, block)
+}
+
+// cbdcHotStuffBackend - окружение автомата HotStuff валидатора шарда;
+// лидеры видов сменяются по кругу
+type cbdcHotStuffBackend struct {
+	shard   *cbdcShard
+	address string
+}
+
+func (b *cbdcHotStuffBackend) Validators(branch []*blockchain.Block) pos.ValidatorPool {
+	return b.shard.validators
+}
+
+func (b *cbdcHotStuffBackend) HasPendingTxs() bool { return b.shard.pool.Size() > 0 }
+
+func (b *cbdcHotStuffBackend) VerifyQC(branch []*blockchain.Block, qc *blockchain.Commit) error {
+	return bft.VerifyCommit(b.shard.validators, qc)
+}
+
+func (b *cbdcHotStuffBackend) Leader(view int64) string {
+	validators := b.shard.validators
+	return validators[view%int64(len(validators))].Address
+}
+
+func (b *cbdcHotStuffBackend) ProposeBlock(branch []*blockchain.Block, justify *blockchain.Commit) (*blockchain.Block, error) {
+	parent := b.shard.tip
+	if len(branch) > 0 {
+		parent = branch[len(branch)-1]
+	}
+	block := b.shard.proposeBlock(b.address, parent, branch)
+	block.LastCommit = justify
+	block.Hash = block.CalculateHash()
+	return block, nil
+}
+
+func (b *cbdcHotStuffBackend) ValidateBlock(branch []*blockchain.Block, block *blockchain.Block) error {
+	return nil
+}
+
+func (b *cbdcHotStuffBackend) BroadcastProposal(p *bft.Proposal) {
+	net := b.shard.hsNet
+	for _, addr := range net.Addresses() {
+		if addr != b.address {
+			b.shard.sent(b.address, net.Send(b.address, addr, func(hs *hotstuff.HotStuff) { hs.HandleProposal(p) }))
+		}
+	}
+}
+
+func (b *cbdcHotStuffBackend) SendVote(to string, v *bft.Vote) {
+	b.shard.sent(b.address, b.shard.hsNet.Send(b.address, to, func(hs *hotstuff.HotStuff) { hs.HandleVote(v) }))
+}
+
+func (b *cbdcHotStuffBackend) SendNewView(to string, nv *hotstuff.NewView) {
+	b.shard.sent(b.address, b.shard.hsNet.Send(b.address, to, func(hs *hotstuff.HotStuff) { hs.HandleNewView(nv) }))
+}
+
+func (b *cbdcHotStuffBackend) CommitBlock(block *blockchain.Block) error {
+	return b.shard.commitBlock(b.address, block)
+}
+
+// cbdcConsensus возвращает движок консенсуса сценария
+func cbdcConsensus(config CBDCConfig) string {
+	if config.Consensus != "" {
+		return config.Consensus
+	}
+	if engine := os.Getenv("BLOCKCHAIN_CBDC_CONSENSUS"); engine != "" {
+		return engine
+	}
+	return bft.EngineName
+}
+
 // sendConsensusMessage - отправляет сообщение консенсуса через TCP
 func sendConsensusMessage(node *ValidatorNode, msg *gossip.SignedConsensusMessage) error {
 	if !node.IsActive {
@@ -640,8 +924,8 @@ func sendConsensusMessage(node *ValidatorNode, msg *gossip.SignedConsensusMessag
 	conn.SetWriteDeadline(time.Now().Add(500 * time.Millisecond))
 
 	// Отправляем сообщение
-	encoder := json.NewEncoder(conn)
-	return encoder.Encode(msg)
+	encoded, _ := msg.Encode()
+	return codec.WriteFrame(conn, encoded)
 }
 
 // ============================================================================
@@ -652,9 +936,10 @@ func sendConsensusMessage(node *ValidatorNode, msg *gossip.SignedConsensusMessag
 func runCBDCScenario(config CBDCConfig, t *testing.T) CBDCResults {
 	var results CBDCResults
 
+	engine := cbdcConsensus(config)
 	fmt.Printf("\n🚀 Запуск сценария: %s\n", config.ScenarioName)
-	fmt.Printf("   Валидаторы: %d | Шарды: %d | Целевой TPS: %d\n",
-		config.Validators, config.Shards, config.TargetTPS)
+	fmt.Printf("   Валидаторы: %d | Шарды: %d | Целевой TPS: %d | Консенсус: %s\n",
+		config.Validators, config.Shards, config.TargetTPS, engine)
 
 	// Инициализация сети валидаторов с TCP-серверами
 	nodes, shardMap, err := initializeValidatorNetwork(config.Validators, config.Shards, t)
@@ -756,11 +1041,22 @@ func runCBDCScenario(config CBDCConfig, t *testing.T) CBDCResults {
 		}(shardID, shardNodes)
 	}
 
-	// Запускаем циклы консенсуса для каждого шарда
+	// Запускаем автоматы консенсуса для каждого шарда
+	shards := make(map[int]*cbdcShard)
 	for shardID, shardNodes := range shardMap {
+		shard, err := newCBDCShard(engine, shardNodes, config.BlockSize)
+		if err != nil {
+			close(stopChan)
+			wg.Wait()
+			t.Fatalf("Failed to start consensus for shard %d: %v", shardID, err)
+		}
+		shards[shardID] = shard
+	}
+	for _, shard := range shards {
 		wg.Add(1)
-		go func(sid int, nodes []*ValidatorNode) {
+		go func(s *cbdcShard) {
 			defer wg.Done()
+			defer s.stop()
 
 			consensusTicker := time.NewTicker(time.Duration(config.BlockTime) * time.Second)
 			defer consensusTicker.Stop()
@@ -770,16 +1066,17 @@ func runCBDCScenario(config CBDCConfig, t *testing.T) CBDCResults {
 				case <-stopChan:
 					return
 				case <-consensusTicker.C:
-					// Выполняем раунд BFT-консенсуса
-					roundTime, blocks, messages := runBFTConsensusRound(nodes, config.BlockSize)
+					// Автоматы обрабатывают таймауты, наступившие с прошлого тика
+					roundTime, blocks := s.advance()
 
 					atomic.AddInt64(&consensusRounds, 1)
 					atomic.AddInt64(&blocksCreated, blocks)
-					atomic.AddInt64(&networkMessages, messages)
+					mu.Lock()
 					totalBlockTime += roundTime
+					mu.Unlock()
 				}
 			}
-		}(shardID, shardNodes)
+		}(shard)
 	}
 
 	// Запускаем тест на заданную длительность
@@ -799,11 +1096,18 @@ func runCBDCScenario(config CBDCConfig, t *testing.T) CBDCResults {
 		networkMessages += atomic.LoadInt64(&node.MessagesRecv)
 	}
 
-	// Рассчитываем результаты
+	// Время финализации — среднее время от создания транзакции до фиксации
+	// её блока
+	var finality time.Duration
+	var committedTxs int64
+	for _, shard := range shards {
+		finality += shard.finality
+		committedTxs += shard.committedTxs
+	}
 	totalTxs := atomic.LoadInt64(&txGenerated)
 	results = CBDCResults{
 		ActualTPS:         float64(totalTxs) / elapsedTime.Seconds(),
-		FinalizationTime:  totalBlockTime.Seconds() / float64(max(1, atomic.LoadInt64(&consensusRounds))),
+		FinalizationTime:  finality.Seconds() / float64(max(1, committedTxs)),
 		TxCount:           totalTxs,
 		ElapsedTime:       elapsedTime,
 		C2CTxCount:        c2cCount,
@@ -889,6 +1193,47 @@ func TestCBDC_PerspectiveScenario(t *testing.T) {
 	fmt.Printf("=============================================================\n\n")
 }
 
+// TestCBDC_ConsensusComparison - пилотный сценарий ПлЦР на Tendermint и HotStuff
+func TestCBDC_ConsensusComparison(t *testing.T) {
+	engines := []string{bft.EngineName, hotstuff.EngineName}
+	results := make(map[string]CBDCResults)
+	for _, engine := range engines {
+		config := cbdcScenarios["пилотный"]
+		config.Consensus = engine
+		results[engine] = runCBDCScenario(config, t)
+	}
+
+	fmt.Printf("\n+-----------------------+-------------+-------------+\n")
+	fmt.Printf("| Параметр              | %-11s | %-11s |\n", engines[0], engines[1])
+	fmt.Printf("+-----------------------+-------------+-------------+\n")
+	fmt.Printf("| TPS (факт)            |%12.0f |%12.0f |\n",
+		results[engines[0]].ActualTPS, results[engines[1]].ActualTPS)
+	fmt.Printf("| Время финализации (с) |%12.3f |%12.3f |\n",
+		results[engines[0]].FinalizationTime, results[engines[1]].FinalizationTime)
+	fmt.Printf("| Обработка тика        |%12s |%12s |\n",
+		results[engines[0]].AvgBlockTime.Round(time.Millisecond), results[engines[1]].AvgBlockTime.Round(time.Millisecond))
+	fmt.Printf("| Блоков создано        |%12d |%12d |\n",
+		results[engines[0]].BlocksCreated, results[engines[1]].BlocksCreated)
+	fmt.Printf("| Сетевых сообщений     |%12d |%12d |\n",
+		results[engines[0]].NetworkMessages, results[engines[1]].NetworkMessages)
+	fmt.Printf("+-----------------------+-------------+-------------+\n\n")
+
+	// Голоса HotStuff идут одному лидеру, а не всем валидаторам, поэтому на
+	// зафиксированный блок приходится меньше сообщений, даже с учётом пустых
+	// блоков, проталкивающих конвейер
+	perBlock := make(map[string]float64)
+	for _, engine := range engines {
+		if results[engine].BlocksCreated == 0 {
+			t.Fatalf("%s committed no blocks", engine)
+		}
+		perBlock[engine] = float64(results[engine].NetworkMessages) / float64(results[engine].BlocksCreated)
+	}
+	if perBlock[engines[1]] >= perBlock[engines[0]] {
+		t.Errorf("Expected HotStuff to send fewer messages per block than Tendermint: %.1f vs %.1f",
+			perBlock[engines[1]], perBlock[engines[0]])
+	}
+}
+
 // ============================================================================
 // КОМПЛЕКСНЫЙ ТЕСТ ВСЕХ СЦЕНАРИЕВ
 // ============================================================================
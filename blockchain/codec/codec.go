@@ -0,0 +1,271 @@
+// Package codec — каноническое бинарное кодирование структур узла.
+//
+// Каждая запись начинается с заголовка [версия u8][тип u8], за которым
+// следуют поля в фиксированном порядке:
+//   - целые числа — 8 байт big-endian (int64 в дополнительном коде);
+//   - float64 — 8 байт big-endian битов IEEE-754;
+//   - bool — 1 байт (0 или 1);
+//   - строки и байты — длина u32 big-endian и содержимое;
+//   - списки — количество элементов u32 и элементы подряд.
+//
+// Одно и то же значение всегда кодируется одинаково, поэтому результат
+// используется для хэширования, подписи, хранения и передачи по сети.
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Version — текущая версия формата. Изменение раскладки полей существующего
+// типа записи требует новой версии (или нового типа): записи прежней версии
+// отклоняются с ErrUnsupportedVersion, а не читаются по новой раскладке.
+// Раскладка версии 1 менялась без смены версии, поэтому её записи не
+// читаются вовсе; эталоны всех её раскладок — в testdata/golden_v1.json.
+const Version byte = 2
+
+// Kind — тип закодированной записи
+type Kind byte
+
+const (
+	KindTransaction     Kind = 0x01 // транзакция целиком
+	KindTxSigning       Kind = 0x02 // подписываемые поля транзакции
+	KindBlock           Kind = 0x03 // блок целиком
+	KindBlockHeader     Kind = 0x04 // заголовок блока (хэшируется и подписывается)
+	KindVote            Kind = 0x05 // подписываемые данные голоса консенсуса
+	KindGossip          Kind = 0x06 // конверт GossipMessage
+	KindConsensus       Kind = 0x07 // конверт ConsensusMessage
+	KindSignedConsensus Kind = 0x08 // конверт SignedConsensusMessage
+	KindWALRecord       Kind = 0x09 // запись журнала упреждающей записи узла
+	KindProposal        Kind = 0x0a // предложение блока в раунде BFT
+	KindCommit          Kind = 0x0b // сертификат финальности блока (+2/3 precommit)
+	KindProposalSigning Kind = 0x0c // подписываемые данные предложения блока
+	KindEvidence        Kind = 0x0d // доказательство нарушения валидатора
+	KindStakingData     Kind = 0x0e // параметры стейкинговой транзакции
+	KindStakingState    Kind = 0x0f // состояние стейкинга (входит в корень состояния)
+	KindValidatorSet    Kind = 0x10 // набор валидаторов эпохи (хэш входит в заголовок блока)
+	KindSyncStatus      Kind = 0x11 // состояние цепочки пира при синхронизации блоков
+	KindBlockRequest    Kind = 0x12 // запрос диапазона блоков
+	KindBlockBatch      Kind = 0x13 // ответ на запрос диапазона блоков
+	KindNewView         Kind = 0x14 // сообщение смены вида HotStuff
+	KindPacket          Kind = 0x15 // пакет мультиплексированного соединения p2p
+	KindGossipEnvelope  Kind = 0x16 // конверт эпидемической рассылки
+	KindDiscovery       Kind = 0x17 // сообщение обнаружения узлов
+	KindHandshakeAuth   Kind = 0x18 // подписываемые данные рукопожатия p2p
+	KindEvidenceState   Kind = 0x19 // наборы валидаторов недавних эпох и включённые доказательства (входят в корень состояния)
+	KindHandshake       Kind = 0x1a // первое сообщение рукопожатия p2p
+	KindHandshakeReply  Kind = 0x1b // второе сообщение рукопожатия p2p (подпись)
+)
+
+// MaxFieldSize ограничивает длину одного поля при декодировании
+const MaxFieldSize = 64 << 20
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported codec version")
+	ErrUnexpectedKind     = errors.New("unexpected record kind")
+	ErrTruncated          = errors.New("truncated record")
+	ErrTrailingBytes      = errors.New("trailing bytes after record")
+	ErrFieldTooLarge      = errors.New("field too large")
+)
+
+// Writer собирает запись в каноническом формате
+type Writer struct {
+	buf []byte
+}
+
+// NewWriter начинает запись указанного типа
+func NewWriter(kind Kind) *Writer {
+	return &Writer{buf: []byte{Version, byte(kind)}}
+}
+
+func (w *Writer) Uint64(v uint64) {
+	w.buf = binary.BigEndian.AppendUint64(w.buf, v)
+}
+
+func (w *Writer) Int64(v int64) {
+	w.Uint64(uint64(v))
+}
+
+func (w *Writer) Float64(v float64) {
+	w.Uint64(math.Float64bits(v))
+}
+
+func (w *Writer) Bool(v bool) {
+	if v {
+		w.buf = append(w.buf, 1)
+	} else {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+func (w *Writer) Bytes(v []byte) {
+	w.Len(len(v))
+	w.buf = append(w.buf, v...)
+}
+
+func (w *Writer) String(v string) {
+	w.Len(len(v))
+	w.buf = append(w.buf, v...)
+}
+
+// Len записывает длину поля или количество элементов списка
+func (w *Writer) Len(n int) {
+	w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(n))
+}
+
+// Result возвращает закодированную запись
+func (w *Writer) Result() []byte {
+	return w.buf
+}
+
+// Reader читает запись в каноническом формате. Ошибка запоминается:
+// после первой ошибки все чтения возвращают нулевые значения, а сама
+// ошибка возвращается из Finish.
+type Reader struct {
+	data []byte
+	err  error
+}
+
+// NewReader проверяет заголовок записи и возвращает читателя полей
+func NewReader(data []byte, kind Kind) (*Reader, error) {
+	if len(data) < 2 {
+		return nil, ErrTruncated
+	}
+	if data[0] != Version {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, data[0])
+	}
+	if Kind(data[1]) != kind {
+		return nil, fmt.Errorf("%w: expected 0x%02x, got 0x%02x", ErrUnexpectedKind, byte(kind), data[1])
+	}
+	return &Reader{data: data[2:]}, nil
+}
+
+func (r *Reader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data) {
+		r.err = ErrTruncated
+		return nil
+	}
+	out := r.data[:n]
+	r.data = r.data[n:]
+	return out
+}
+
+func (r *Reader) Uint64() uint64 {
+	b := r.take(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *Reader) Int64() int64 {
+	return int64(r.Uint64())
+}
+
+func (r *Reader) Float64() float64 {
+	return math.Float64frombits(r.Uint64())
+}
+
+func (r *Reader) Bool() bool {
+	b := r.take(1)
+	if b == nil {
+		return false
+	}
+	if b[0] > 1 {
+		r.err = fmt.Errorf("invalid bool value %d", b[0])
+		return false
+	}
+	return b[0] == 1
+}
+
+// Bytes читает поле байтов; пустое поле декодируется как nil
+func (r *Reader) Bytes() []byte {
+	n := r.Len()
+	b := r.take(n)
+	if len(b) == 0 {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+func (r *Reader) String() string {
+	return string(r.take(r.Len()))
+}
+
+// Len читает длину поля или количество элементов списка
+func (r *Reader) Len() int {
+	b := r.take(4)
+	if b == nil {
+		return 0
+	}
+	n := binary.BigEndian.Uint32(b)
+	if n > MaxFieldSize {
+		r.err = fmt.Errorf("%w: %d bytes", ErrFieldTooLarge, n)
+		return 0
+	}
+	return int(n)
+}
+
+// Count читает количество элементов списка, каждый из которых занимает в
+// записи не меньше minSize байт. Количество, которое не помещается в
+// оставшиеся байты, — ErrTruncated: по нему нельзя выделять память заранее.
+func (r *Reader) Count(minSize int) int {
+	n := r.Len()
+	if r.err == nil && n > len(r.data)/minSize {
+		r.err = fmt.Errorf("%w: %d elements of at least %d bytes", ErrTruncated, n, minSize)
+		return 0
+	}
+	return n
+}
+
+// Err возвращает первую ошибку чтения
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Finish проверяет, что запись прочитана целиком и без ошибок
+func (r *Reader) Finish() error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.data) != 0 {
+		return fmt.Errorf("%w: %d bytes", ErrTrailingBytes, len(r.data))
+	}
+	return nil
+}
+
+// WriteFrame записывает запись в поток с префиксом длины u32
+func WriteFrame(w io.Writer, record []byte) error {
+	frame := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(record)), uint32(len(record)))
+	_, err := w.Write(append(frame, record...))
+	return err
+}
+
+// ReadFrame читает из потока запись, записанную WriteFrame
+func ReadFrame(r io.Reader) ([]byte, error) {
+	return ReadFrameLimit(r, MaxFieldSize)
+}
+
+// ReadFrameLimit читает запись не длиннее max байт; более длинная
+// отклоняется по заголовку, до выделения памяти под неё
+func ReadFrameLimit(r io.Reader, max int) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(header[:])
+	if uint64(n) > uint64(max) {
+		return nil, fmt.Errorf("%w: frame of %d bytes", ErrFieldTooLarge, n)
+	}
+	record := make([]byte, n)
+	if _, err := io.ReadFull(r, record); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
@@ -0,0 +1,98 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestWriterReader_RoundTrip - все типы полей читаются в том же порядке, в каком записаны
+func TestWriterReader_RoundTrip(t *testing.T) {
+	w := NewWriter(KindVote)
+	w.Uint64(42)
+	w.Int64(-7)
+	w.Float64(1.5)
+	w.Bool(true)
+	w.Bytes([]byte{1, 2, 3})
+	w.String("prevote")
+	w.Bytes(nil)
+
+	r, err := NewReader(w.Result(), KindVote)
+	if err != nil {
+		t.Fatalf("Failed to create reader: %v", err)
+	}
+	if got := r.Uint64(); got != 42 {
+		t.Errorf("Expected 42, got %d", got)
+	}
+	if got := r.Int64(); got != -7 {
+		t.Errorf("Expected -7, got %d", got)
+	}
+	if got := r.Float64(); got != 1.5 {
+		t.Errorf("Expected 1.5, got %f", got)
+	}
+	if !r.Bool() {
+		t.Errorf("Expected true")
+	}
+	if got := r.Bytes(); !bytes.Equal(got, []byte{1, 2, 3}) {
+		t.Errorf("Unexpected bytes %x", got)
+	}
+	if got := r.String(); got != "prevote" {
+		t.Errorf("Expected prevote, got %q", got)
+	}
+	if got := r.Bytes(); got != nil {
+		t.Errorf("Expected nil for empty field, got %x", got)
+	}
+	if err := r.Finish(); err != nil {
+		t.Errorf("Expected clean finish, got %v", err)
+	}
+}
+
+// TestReader_Rejects - чужая версия, чужой тип, обрыв и лишние байты
+func TestReader_Rejects(t *testing.T) {
+	w := NewWriter(KindGossip)
+	w.String("block")
+	record := w.Result()
+
+	if _, err := NewReader(append([]byte{Version + 1}, record[1:]...), KindGossip); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+	if _, err := NewReader(record, KindBlock); !errors.Is(err, ErrUnexpectedKind) {
+		t.Errorf("Expected ErrUnexpectedKind, got %v", err)
+	}
+
+	r, _ := NewReader(record[:len(record)-1], KindGossip)
+	_ = r.String()
+	if err := r.Finish(); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Expected ErrTruncated, got %v", err)
+	}
+
+	r, _ = NewReader(append(record, 0), KindGossip)
+	_ = r.String()
+	if err := r.Finish(); !errors.Is(err, ErrTrailingBytes) {
+		t.Errorf("Expected ErrTrailingBytes, got %v", err)
+	}
+
+	// Количество элементов, не помещающееся в запись, не читается
+	w = NewWriter(KindBlock)
+	w.Len(MaxFieldSize)
+	w.Bytes([]byte{1})
+	r, _ = NewReader(w.Result(), KindBlock)
+	if n := r.Count(4); n != 0 || !errors.Is(r.Finish(), ErrTruncated) {
+		t.Errorf("Expected ErrTruncated for an oversized count, got %d, %v", n, r.Err())
+	}
+}
+
+// TestFrame_RoundTrip - записи в потоке разделяются префиксом длины
+func TestFrame_RoundTrip(t *testing.T) {
+	var stream bytes.Buffer
+	first, second := NewWriter(KindGossip).Result(), NewWriter(KindVote).Result()
+	WriteFrame(&stream, first)
+	WriteFrame(&stream, second)
+
+	for _, want := range [][]byte{first, second} {
+		got, err := ReadFrame(&stream)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Fatalf("Expected frame %x, got %x (%v)", want, got, err)
+		}
+	}
+}
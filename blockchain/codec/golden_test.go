@@ -0,0 +1,337 @@
+package codec_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"blockchain/codec"
+	"blockchain/consensus/bft"
+	"blockchain/consensus/hotstuff"
+	"blockchain/network/blocksync"
+	"blockchain/network/gossip"
+	"blockchain/storage/blockchain"
+	"blockchain/storage/snapshot"
+	"blockchain/storage/txpool"
+)
+
+// Эталонные кодировки текущей версии формата лежат в testdata/golden.json
+// (поле version — версия, которой они записаны); клиент
+// (client-send-transaction) проверяет по ним свою реализацию. Эталоны
+// прежних версий лежат в testdata/golden_v<N>.json и должны отклоняться.
+//
+// Новые эталоны добавляются командой go test ./codec -update. Изменить
+// кодировку уже записанного эталона можно только вместе с codec.Version,
+// перенеся прежний golden.json в golden_v<N>.json.
+var update = flag.Bool("update", false, "rewrite golden vectors")
+
+var goldenPath = filepath.Join("testdata", "golden.json")
+
+// previousGoldenPath возвращает путь к эталонам версии формата version
+func previousGoldenPath(version byte) string {
+	return filepath.Join("testdata", fmt.Sprintf("golden_v%d.json", version))
+}
+
+func goldenTransaction() *txpool.Transaction {
+	tx := &txpool.Transaction{
+		From:      "alice",
+		To:        "bob",
+		Amount:    12.5,
+		Fee:       0.001,
+		Tip:       0.0005,
+		Nonce:     3,
+		ChainID:   "cbdc-test",
+		Timestamp: 1700000000,
+		Signature: "3045022100ab",
+		IsPrivate: true,
+		Encrypted: []byte{0xde, 0xad},
+		PublicKey: []byte{0x04, 0x01},
+		Type:      txpool.TxRedelegate,
+		Data:      goldenStakingData().Encode(),
+	}
+	tx.ID = tx.ComputeID()
+	return tx
+}
+
+func goldenStakingData() *txpool.StakingData {
+	return &txpool.StakingData{CommissionRate: 0.125, DstValidator: "carol"}
+}
+
+func goldenCommit(height int64, blockHash string) *blockchain.Commit {
+	return &blockchain.Commit{
+		Height:    height,
+		Round:     1,
+		BlockHash: blockHash,
+		Signatures: []blockchain.CommitSig{
+			{ValidatorIndex: 0, Validator: "validator1", Timestamp: 1700000003, Signature: []byte{0x30, 0x03}},
+			{ValidatorIndex: 2, Validator: "validator3", Timestamp: 1700000004, Signature: []byte{0x30, 0x04}},
+		},
+	}
+}
+
+func goldenEvidence() *blockchain.Evidence {
+	return blockchain.NewEvidence(blockchain.DuplicateVote, 6, 0, "validator2",
+		blockchain.SignedData{Data: gossip.VoteSignBytes(gossip.StatePrecommit, 6, 0, "aa", 1, 1700000005), Signature: []byte{0x30, 0x05}},
+		blockchain.SignedData{Data: gossip.VoteSignBytes(gossip.StatePrecommit, 6, 0, "bb", 1, 1700000006), Signature: []byte{0x30, 0x06}})
+}
+
+func goldenBlock() *blockchain.Block {
+	block := &blockchain.Block{
+		Index:        7,
+		Timestamp:    1700000001,
+		PrevHash:     "00ff",
+		Transactions: []*txpool.Transaction{goldenTransaction()},
+		Validator:    "validator1",
+		Nonce:        "n",
+		StateRoot:    "abcd",
+		BaseFee:      0.00025,
+		LastCommit:   goldenCommit(6, "00ff"),
+		Evidence:     []*blockchain.Evidence{goldenEvidence()},
+		Signature:    []byte{0x30, 0x01},
+	}
+	block.Hash = block.CalculateHash()
+	block.Commit = goldenCommit(7, block.Hash)
+	return block
+}
+
+func goldenNewView() *hotstuff.NewView {
+	return &hotstuff.NewView{
+		Vote: &bft.Vote{
+			Type: gossip.StateNewView, Height: 6, Round: 3, BlockHash: "00ff",
+			ValidatorIndex: 1, Validator: "validator2", Timestamp: 1700000007, Signature: []byte{0x30, 0x07},
+		},
+		HighQC: goldenCommit(6, "00ff"),
+	}
+}
+
+// goldenVectors возвращает эталонные значения и их кодировку
+func goldenVectors() map[string][]byte {
+	tx := goldenTransaction()
+	txID, _ := hex.DecodeString(tx.ID)
+	block := goldenBlock()
+	gossipMsg, _ := (&gossip.GossipMessage{Type: gossip.MsgTx, From: "node1", Data: []byte("payload")}).Encode()
+	consensusMsg, _ := (&gossip.ConsensusMessage{Type: gossip.MsgBlock, Height: 7, Round: 1, Block: block, From: "node1"}).Encode()
+	signedMsg, _ := (&gossip.SignedConsensusMessage{
+		Type: gossip.StatePrevote, Height: 7, Round: 1, From: "validator1",
+		Data: gossip.VoteSignBytes(gossip.StatePrevote, 7, 1, block.Hash, 2, 1700000002), Signature: []byte{0x30, 0x02},
+	}).Encode()
+
+	return map[string][]byte{
+		"transaction":      tx.Encode(),
+		"tx_signing":       tx.Serialize(),
+		"tx_id":            txID,
+		"staking_data":     goldenStakingData().Encode(),
+		"block":            block.Serialize(),
+		"block_header":     block.SerializeWithoutSignature(),
+		"commit":           goldenCommit(6, "00ff").Encode(),
+		"evidence":         goldenEvidence().Encode(),
+		"proposal_signing": gossip.ProposalSignBytes(7, 1, -1, "validator1", block.Hash),
+		"vote":             gossip.VoteSignBytes(gossip.StatePrevote, 7, 1, block.Hash, 2, 1700000002),
+		"wal_record":       (&snapshot.Record{Seq: 42, Component: "kyc", Key: "alice", Value: []byte(`{"Status":1}`)}).Encode(),
+		"gossip":           gossipMsg,
+		"consensus":        consensusMsg,
+		"signed_consensus": signedMsg,
+		"sync_status":      (&blocksync.Status{Height: 7, Head: block.Hash}).Encode(),
+		"block_request":    (&blocksync.BlockRequest{From: 3, To: 22}).Encode(),
+		"new_view":         goldenNewView().Encode(),
+	}
+}
+
+// TestGoldenVectors - кодировки совпадают с эталоном и декодируются обратно
+func TestGoldenVectors(t *testing.T) {
+	vectors := goldenVectors()
+
+	if *update {
+		writeGolden(t, vectors)
+	}
+
+	golden := readGolden(t)
+	if golden["version"] != hex.EncodeToString([]byte{codec.Version}) {
+		t.Fatalf("Golden vectors were written by codec version %s, current is %d", golden["version"], codec.Version)
+	}
+
+	for name, got := range vectors {
+		want, err := hex.DecodeString(golden[name])
+		if err != nil || len(want) == 0 {
+			t.Errorf("%s: missing golden vector", name)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: encoding drifted\n got  %x\n want %x", name, got, want)
+		}
+	}
+
+	// Декодирование эталона восстанавливает исходные значения
+	tx, err := txpool.DecodeTransaction(vectors["transaction"])
+	if err != nil || !reflect.DeepEqual(tx, goldenTransaction()) {
+		t.Errorf("Transaction round trip failed: %+v (%v)", tx, err)
+	}
+	stakingData, err := txpool.DecodeStakingData(vectors["staking_data"])
+	if err != nil || !reflect.DeepEqual(stakingData, goldenStakingData()) {
+		t.Errorf("Staking data round trip failed: %+v (%v)", stakingData, err)
+	}
+	block := &blockchain.Block{}
+	if err := block.Deserialize(vectors["block"]); err != nil || !reflect.DeepEqual(block, goldenBlock()) {
+		t.Errorf("Block round trip failed: %+v (%v)", block, err)
+	}
+	commit, err := blockchain.DecodeCommit(vectors["commit"])
+	if err != nil || !reflect.DeepEqual(commit, goldenCommit(6, "00ff")) {
+		t.Errorf("Commit round trip failed: %+v (%v)", commit, err)
+	}
+	evidence, err := blockchain.DecodeEvidence(vectors["evidence"])
+	if err != nil || !reflect.DeepEqual(evidence, goldenEvidence()) {
+		t.Errorf("Evidence round trip failed: %+v (%v)", evidence, err)
+	}
+	msg, err := gossip.DecodeConsensusMessage(vectors["consensus"])
+	if err != nil || msg.Block == nil || msg.Block.Hash != goldenBlock().Hash {
+		t.Errorf("Consensus message round trip failed: %+v (%v)", msg, err)
+	}
+	signed, err := gossip.DecodeSignedMessage(vectors["signed_consensus"])
+	if err != nil || !bytes.Equal(signed.Data, vectors["vote"]) {
+		t.Errorf("Signed message round trip failed: %+v (%v)", signed, err)
+	}
+	newView, err := hotstuff.NewViewFromMessage(goldenNewView().Message())
+	if err != nil || !reflect.DeepEqual(newView, goldenNewView()) {
+		t.Errorf("New-view round trip failed: %+v (%v)", newView, err)
+	}
+}
+
+func readGolden(t *testing.T) map[string]string {
+	t.Helper()
+	data, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("Failed to read golden vectors: %v", err)
+	}
+	var golden map[string]string
+	if err := json.Unmarshal(data, &golden); err != nil {
+		t.Fatalf("Failed to parse golden vectors: %v", err)
+	}
+	return golden
+}
+
+// writeGolden записывает эталоны текущей версии. Эталон, уже записанный
+// этой версией, менять нельзя: изменение раскладки требует новой версии,
+// а эталоны прежней должны остаться в golden_v<N>.json.
+func writeGolden(t *testing.T, vectors map[string][]byte) {
+	t.Helper()
+	version := hex.EncodeToString([]byte{codec.Version})
+	previous := readGolden(t)
+	if previous["version"] == version {
+		for name, data := range vectors {
+			if old, ok := previous[name]; ok && old != hex.EncodeToString(data) {
+				t.Fatalf("%s: encoding changed within codec version %d; bump codec.Version and keep the old vectors in %s", name, codec.Version, previousGoldenPath(codec.Version))
+			}
+		}
+	} else if old, err := hex.DecodeString(previous["version"]); err != nil || len(old) != 1 {
+		t.Fatalf("Golden vectors have invalid version %q", previous["version"])
+	} else if _, err := os.Stat(previousGoldenPath(old[0])); err != nil {
+		t.Fatalf("Keep the vectors of codec version %d in %s before rewriting them", old[0], previousGoldenPath(old[0]))
+	}
+
+	encoded := make(map[string]string, len(vectors)+1)
+	for name, data := range vectors {
+		encoded[name] = hex.EncodeToString(data)
+	}
+	encoded["version"] = version
+	data, _ := json.MarshalIndent(encoded, "", "  ")
+	if err := os.WriteFile(goldenPath, append(data, '\n'), 0o644); err != nil {
+		t.Fatalf("Failed to write golden vectors: %v", err)
+	}
+}
+
+// previousDecoders — декодеры записей, эталоны которых проверяются в
+// TestGoldenVectors_PreviousVersions. tx_id, tx_signing и block_header
+// только хэшируются и не декодируются.
+var previousDecoders = map[string]func([]byte) error{
+	"transaction": func(data []byte) error {
+		_, err := txpool.DecodeTransaction(data)
+		return err
+	},
+	"staking_data": func(data []byte) error {
+		_, err := txpool.DecodeStakingData(data)
+		return err
+	},
+	"block": func(data []byte) error {
+		return (&blockchain.Block{}).Deserialize(data)
+	},
+	"commit": func(data []byte) error {
+		_, err := blockchain.DecodeCommit(data)
+		return err
+	},
+	"evidence": func(data []byte) error {
+		_, err := blockchain.DecodeEvidence(data)
+		return err
+	},
+	"proposal_signing": func(data []byte) error {
+		_, err := gossip.DecodeProposalSignBytes(data)
+		return err
+	},
+	"vote": func(data []byte) error {
+		_, err := gossip.DecodeVoteSignBytes(data)
+		return err
+	},
+	"wal_record": func(data []byte) error {
+		_, err := snapshot.DecodeRecord(data)
+		return err
+	},
+	"gossip": func(data []byte) error {
+		_, err := gossip.DecodeMessage(data)
+		return err
+	},
+	"consensus": func(data []byte) error {
+		_, err := gossip.DecodeConsensusMessage(data)
+		return err
+	},
+	"signed_consensus": func(data []byte) error {
+		_, err := gossip.DecodeSignedMessage(data)
+		return err
+	},
+	"sync_status": func(data []byte) error {
+		_, err := blocksync.DecodeStatus(data)
+		return err
+	},
+	"block_request": func(data []byte) error {
+		_, err := blocksync.DecodeBlockRequest(data)
+		return err
+	},
+	"new_view": func(data []byte) error {
+		_, err := hotstuff.NewViewFromMessage(&gossip.SignedConsensusMessage{Type: gossip.StateNewView, Data: data})
+		return err
+	},
+}
+
+// TestGoldenVectors_PreviousVersions - записи прежних версий формата
+// отклоняются, а не читаются по текущей раскладке полей
+func TestGoldenVectors_PreviousVersions(t *testing.T) {
+	for version := byte(1); version < codec.Version; version++ {
+		data, err := os.ReadFile(previousGoldenPath(version))
+		if err != nil {
+			t.Fatalf("Missing golden vectors of codec version %d: %v", version, err)
+		}
+		var golden map[string][]string
+		if err := json.Unmarshal(data, &golden); err != nil {
+			t.Fatalf("Failed to parse golden vectors of version %d: %v", version, err)
+		}
+		for name, decode := range previousDecoders {
+			if len(golden[name]) == 0 {
+				continue
+			}
+			for i, vector := range golden[name] {
+				record, err := hex.DecodeString(vector)
+				if err != nil {
+					t.Fatalf("%s #%d of version %d: %v", name, i, version, err)
+				}
+				if err := decode(record); !errors.Is(err, codec.ErrUnsupportedVersion) {
+					t.Errorf("%s #%d of version %d: expected ErrUnsupportedVersion, got %v", name, i, version, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package bft
+
+// часы консенсуса: системные и детерминированные для тестов
+
+import (
+	"sync"
+	"time"
+)
+
+// Timer — запланированный вызов, который можно отменить
+type Timer interface {
+	Stop() bool
+}
+
+// Clock — источник времени и таймаутов конечного автомата консенсуса
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// SystemClock — часы на основе пакета time
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time { return time.Now() }
+
+func (SystemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// SimClock — управляемые вручную часы. Время идёт только в Advance, таймеры
+// срабатывают синхронно в порядке времени (при равенстве — в порядке создания).
+type SimClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	seq    uint64
+	timers []*simTimer
+}
+
+type simTimer struct {
+	clock *SimClock
+	at    time.Time
+	seq   uint64
+	fn    func()
+}
+
+// NewSimClock создаёт часы, показывающие start
+func NewSimClock(start time.Time) *SimClock {
+	return &SimClock{now: start}
+}
+
+func (c *SimClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *SimClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seq++
+	t := &simTimer{clock: c, at: c.now.Add(d), seq: c.seq, fn: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance переводит часы на d вперёд, вызывая все наступившие таймеры,
+// в том числе запланированные самими обработчиками
+func (c *SimClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	target := c.now.Add(d)
+	c.mu.Unlock()
+
+	for {
+		c.mu.Lock()
+		next := -1
+		for i, t := range c.timers {
+			if t.at.After(target) {
+				continue
+			}
+			if next < 0 || t.at.Before(c.timers[next].at) ||
+				(t.at.Equal(c.timers[next].at) && t.seq < c.timers[next].seq) {
+				next = i
+			}
+		}
+		if next < 0 {
+			c.now = target
+			c.mu.Unlock()
+			return
+		}
+		t := c.timers[next]
+		c.timers = append(c.timers[:next], c.timers[next+1:]...)
+		c.now = t.at
+		c.mu.Unlock()
+
+		t.fn()
+	}
+}
+
+// Pending возвращает число ещё не сработавших таймеров
+func (c *SimClock) Pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+func (t *simTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, pending := range c.timers {
+		if pending == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package bft
+
+// сертификаты финальности блоков
+
+import (
+	"errors"
+	"fmt"
+
+	"blockchain/consensus/pos"
+	"blockchain/network/gossip"
+	"blockchain/storage/blockchain"
+)
+
+var ErrInvalidCommit = errors.New("invalid commit")
+
+// MakeCommit собирает сертификат из precommit набора за блок blockHash.
+// Возвращает nil, если блок не набрал больше 2/3 мощности.
+func MakeCommit(precommits *VoteSet, blockHash string) *blockchain.Commit {
+	if precommits.Type != gossip.StatePrecommit || blockHash == "" || !precommits.HasTwoThirdsFor(blockHash) {
+		return nil
+	}
+	commit := &blockchain.Commit{
+		Height:    precommits.Height,
+		Round:     precommits.Round,
+		BlockHash: blockHash,
+	}
+	for _, v := range precommits.Votes() {
+		if v.BlockHash != blockHash {
+			continue
+		}
+		commit.Signatures = append(commit.Signatures, blockchain.CommitSig{
+			ValidatorIndex: v.ValidatorIndex,
+			Validator:      v.Validator,
+			Timestamp:      v.Timestamp,
+			Signature:      v.Signature,
+		})
+	}
+	return commit
+}
+
+// CommitVote восстанавливает precommit валидатора из подписи сертификата
+func CommitVote(commit *blockchain.Commit, sig blockchain.CommitSig) *Vote {
+	return &Vote{
+		Type:           gossip.StatePrecommit,
+		Height:         commit.Height,
+		Round:          commit.Round,
+		BlockHash:      commit.BlockHash,
+		ValidatorIndex: sig.ValidatorIndex,
+		Validator:      sig.Validator,
+		Timestamp:      sig.Timestamp,
+		Signature:      sig.Signature,
+	}
+}
+
+// VerifyCommit проверяет, что сертификат подписан валидаторами набора
+// validators высоты commit.Height и их precommit за блок набрали больше 2/3
+// мощности набора. Повтор подписи одного валидатора мощность не добавляет.
+func VerifyCommit(validators pos.ValidatorPool, commit *blockchain.Commit) error {
+	if commit == nil {
+		return fmt.Errorf("%w: missing", ErrInvalidCommit)
+	}
+	if commit.BlockHash == "" {
+		return fmt.Errorf("%w: commit for nil block at %d/%d", ErrInvalidCommit, commit.Height, commit.Round)
+	}
+	precommits := NewVoteSet(commit.Height, commit.Round, gossip.StatePrecommit, validators)
+	for _, sig := range commit.Signatures {
+		if err := precommits.AddVote(CommitVote(commit, sig)); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidCommit, err)
+		}
+	}
+	if !precommits.HasTwoThirdsFor(commit.BlockHash) {
+		return fmt.Errorf("%w: block %s at %d/%d has %d of %d voting power",
+			ErrInvalidCommit, commit.BlockHash, commit.Height, commit.Round,
+			precommits.Power(commit.BlockHash), precommits.totalPower)
+	}
+	return nil
+}
+
+// verifyLastCommit проверяет сертификат предыдущего блока в заголовке block.
+// Сертификат обязателен, если у предыдущего блока он есть.
+func verifyLastCommit(validators pos.ValidatorPool, prev, block *blockchain.Block) error {
+	if block.LastCommit == nil {
+		if prev != nil && prev.Commit != nil {
+			return fmt.Errorf("%w: block %d has no last commit", ErrInvalidCommit, block.Index)
+		}
+		return nil
+	}
+	if block.LastCommit.Height != block.Index-1 || block.LastCommit.BlockHash != block.PrevHash {
+		return fmt.Errorf("%w: last commit for %s at %d does not match parent %s",
+			ErrInvalidCommit, block.LastCommit.BlockHash, block.LastCommit.Height, block.PrevHash)
+	}
+	return VerifyCommit(validators, block.LastCommit)
+}
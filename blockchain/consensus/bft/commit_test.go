@@ -0,0 +1,78 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+
+	"blockchain/consensus/consensustest"
+	"blockchain/storage/blockchain"
+)
+
+// TestVerifyCommit - сертификат решённого блока проверяется по набору
+// валидаторов, а подделанный или неполный — отклоняется
+func TestVerifyCommit(t *testing.T) {
+	_, _, backends := newSimNetwork(4)
+	validators := backends["v0"].validators
+	block, commit := backends["v0"].committed[0], backends["v0"].commits[0]
+	if commit == nil || commit.BlockHash != block.Hash || commit.Height != block.Index {
+		t.Fatalf("Expected commit for block %s, got %+v", block.Hash, commit)
+	}
+	if err := VerifyCommit(validators, commit); err != nil {
+		t.Fatalf("Valid commit rejected: %v", err)
+	}
+
+	// Сертификат переживает кодирование
+	decoded, err := blockchain.DecodeCommit(commit.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyCommit(validators, decoded); err != nil {
+		t.Errorf("Decoded commit rejected: %v", err)
+	}
+
+	// Две подписи из четырёх — не кворум, даже если одну повторить
+	partial := *commit
+	partial.Signatures = []blockchain.CommitSig{commit.Signatures[0], commit.Signatures[1], commit.Signatures[1]}
+	if err := VerifyCommit(validators, &partial); !errors.Is(err, ErrInvalidCommit) {
+		t.Errorf("Expected partial commit to be rejected, got %v", err)
+	}
+
+	// Подписи не покрывают другой блок
+	other := *commit
+	other.BlockHash = "other"
+	if err := VerifyCommit(validators, &other); !errors.Is(err, ErrInvalidCommit) {
+		t.Errorf("Expected commit for another block to be rejected, got %v", err)
+	}
+
+	// Тот же сертификат не подтверждает блок перед набором с другой мощностью
+	heavier := consensustest.Validators(5)
+	heavier[4].Balance = 10000
+	if err := VerifyCommit(heavier, commit); !errors.Is(err, ErrInvalidCommit) {
+		t.Errorf("Expected commit to be rejected by another validator set, got %v", err)
+	}
+}
+
+// TestVerifyLastCommit - блок после сертифицированного родителя обязан нести
+// его сертификат в заголовке
+func TestVerifyLastCommit(t *testing.T) {
+	_, _, backends := newSimNetwork(4)
+	validators := backends["v0"].validators
+	parent := backends["v0"].committed[0]
+	parent.Commit = backends["v0"].commits[0]
+
+	child := testBlock(parent.Index+1, "v2", "child")
+	child.PrevHash = parent.Hash
+	if err := verifyLastCommit(validators, parent, child); !errors.Is(err, ErrInvalidCommit) {
+		t.Errorf("Expected block without last commit to be rejected, got %v", err)
+	}
+
+	child.LastCommit = parent.Commit
+	if err := verifyLastCommit(validators, parent, child); err != nil {
+		t.Errorf("Expected last commit to verify, got %v", err)
+	}
+
+	child.PrevHash = "fork"
+	if err := verifyLastCommit(validators, parent, child); !errors.Is(err, ErrInvalidCommit) {
+		t.Errorf("Expected last commit for another parent to be rejected, got %v", err)
+	}
+}
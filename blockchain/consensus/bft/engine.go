@@ -0,0 +1,79 @@
+package bft
+
+// движок консенсуса BFT
+
+import (
+	"fmt"
+
+	"blockchain/consensus"
+	"blockchain/storage/blockchain"
+)
+
+// EngineName — имя движка BFT в реестре consensus
+const EngineName = "BFT"
+
+func init() {
+	consensus.Register(EngineName, NewEngine)
+}
+
+// Engine — движок Tendermint: по узлу BFT на каждого валидатора окружения;
+// i-й узел слушает i-й адрес из Env.Peers
+type Engine struct {
+	consensus.Events
+	nodes []*BFTNode
+}
+
+// NewEngine создаёт узлы BFT для валидаторов окружения
+func NewEngine(env *consensus.Env) (consensus.Engine, error) {
+	if len(env.Validators) == 0 {
+		return nil, fmt.Errorf("bft engine needs at least one validator")
+	}
+	if len(env.Peers) < len(env.Validators) {
+		return nil, fmt.Errorf("bft engine needs an address for each of %d validators, got %d", len(env.Validators), len(env.Peers))
+	}
+	e := &Engine{}
+	for i, v := range env.Validators {
+		node := NewBFTNode(v.ID, v, env.ValidatorPool, env.TxPool, env.State, env.Signer, env.Peers[i], env.Peers)
+		node.OnFinalized(e.Finalize)
+		e.nodes = append(e.nodes, node)
+	}
+	return e, nil
+}
+
+func (e *Engine) Name() string {
+	return EngineName
+}
+
+// Start запускает узлы; каждый сначала догоняет пиров, поэтому консенсус
+// начинается с высоты height или со следующей после синхронизации
+func (e *Engine) Start(height int64) error {
+	if next := e.nodes[0].Chain.Height() + 1; height != next {
+		return fmt.Errorf("chain expects height %d, not %d", next, height)
+	}
+	for _, node := range e.nodes {
+		go func() {
+			node.Start()
+			fmt.Printf("✅ BFT Node %s started\n", node.Address)
+		}()
+	}
+	return nil
+}
+
+func (e *Engine) Stop() {
+	for _, node := range e.nodes {
+		node.Stop()
+	}
+}
+
+func (e *Engine) ProposeBlock(height int64) (*blockchain.Block, error) {
+	return e.nodes[0].ProposeBlock(height)
+}
+
+func (e *Engine) ValidateBlock(block *blockchain.Block) error {
+	return e.nodes[0].ValidateBlock(block)
+}
+
+// Nodes возвращает узлы движка
+func (e *Engine) Nodes() []*BFTNode {
+	return e.nodes
+}
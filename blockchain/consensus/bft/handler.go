@@ -1,10 +1,12 @@
 package bft
 
 import (
+	"errors"
+	"fmt"
+
 	"blockchain/crypto/signature"
 	"blockchain/network/gossip"
 	"blockchain/storage/blockchain"
-	"fmt"
 )
 
 type BFTMessageHandler struct {
@@ -19,48 +21,77 @@ func (h *BFTMessageHandler) ProcessMessage(msg *gossip.SignedConsensusMessage) {
 	switch msg.Type {
 	case gossip.StatePropose:
 		h.HandlePropose(msg)
-	case gossip.StatePrevote:
-		h.HandlePrevote(msg)
-	case gossip.StatePrecommit:
-		h.HandlePrecommit(msg)
+	case gossip.StatePrevote, gossip.StatePrecommit:
+		h.HandleVote(msg)
+	case gossip.MsgEvidence:
+		h.HandleEvidence(msg)
 	default:
 		h.HandleUnknown(msg)
 	}
 }
 
+// HandlePropose проверяет подпись пропосера и передаёт предложение автомату;
+// подпись самого блока проверяется в BFTNode.ValidateBlock
 func (h *BFTMessageHandler) HandlePropose(msg *gossip.SignedConsensusMessage) {
-
-	block := &blockchain.Block{}
-	if err := block.Deserialize(msg.Data); err != nil {
+	proposal, err := DecodeProposal(msg.Data)
+	if err != nil {
+		fmt.Printf("❌ [HandlePropose] %v\n", err)
 		return
 	}
-	fmt.Printf("📬 Received proposal from %s, block hash: %x\n", msg.From, block.Hash)
 
-	// Получаем публичный ключ
-	pubKey, err := signature.GetPublicKey(block.Validator)
+	pubKey, err := signature.GetPublicKey(msg.From)
 	if err != nil {
+		fmt.Printf("❌ [HandlePropose] %v\n", err)
 		return
 	}
-
-	// Проверяем подпись без поля Signature
-	if !signature.Verify(pubKey, block.SerializeWithoutSignature(), block.Signature) {
-		fmt.Println("❌ [HandlePropose] Invalid block signature")
+	if proposal.Proposer != msg.From || !signature.Verify(pubKey, proposal.SignBytes(), msg.Signature) {
+		fmt.Println("❌ [HandlePropose] Invalid proposal signature")
 		return
 	}
-
-	// Сохраняем блок
-	h.Node.CurrentRound.ProposedBlock = msg.Data
-
+	proposal.Signature = msg.Signature
+	if proposal.Height != msg.Height || proposal.Round != msg.Round {
+		fmt.Printf("❌ [HandlePropose] Proposal %d/%d does not match envelope %d/%d\n",
+			proposal.Height, proposal.Round, msg.Height, msg.Round)
+		return
+	}
+	h.report(msg, h.Node.Consensus.HandleProposal(proposal))
 }
 
-func (h *BFTMessageHandler) HandlePrevote(msg *gossip.SignedConsensusMessage) {
-	h.Node.CurrentRound.Prevotes[msg.From] = msg.Data
+func (h *BFTMessageHandler) HandleVote(msg *gossip.SignedConsensusMessage) {
+	vote, err := VoteFromMessage(msg)
+	if err != nil {
+		fmt.Printf("❌ [HandleVote] %v\n", err)
+		return
+	}
+	h.report(msg, h.Node.Consensus.HandleVote(vote))
 }
 
-func (h *BFTMessageHandler) HandlePrecommit(msg *gossip.SignedConsensusMessage) {
-	h.Node.CurrentRound.Precommits[msg.From] = msg.Data
+// HandleEvidence принимает доказательство двойной подписи; новое
+// доказательство рассылается дальше. Доказательство проверяется само по
+// себе, поэтому подпись отправителя не важна.
+func (h *BFTMessageHandler) HandleEvidence(msg *gossip.SignedConsensusMessage) {
+	e, err := blockchain.DecodeEvidence(msg.Data)
+	if err != nil {
+		fmt.Printf("❌ [HandleEvidence] %v\n", err)
+		return
+	}
+	h.Node.ReportEvidence(e)
 }
 
 func (h *BFTMessageHandler) HandleUnknown(msg *gossip.SignedConsensusMessage) {
 	// fmt.Printf("Unknown message type: %s\n", msg.Type)
 }
+
+// report печатает ошибку обработки; запоздавшие сообщения и сообщения
+// слишком далёких раундов — обычное дело.
+// Сообщение следующих высот означает, что узел отстал: он догоняет пиров.
+func (h *BFTMessageHandler) report(msg *gossip.SignedConsensusMessage, err error) {
+	if err == nil || errors.Is(err, ErrStaleMessage) || errors.Is(err, ErrFutureRound) {
+		return
+	}
+	if errors.Is(err, ErrFutureHeight) {
+		go h.Node.CatchUp()
+		return
+	}
+	fmt.Printf("❌ Rejected %s from %s: %v\n", msg.Type, msg.From, err)
+}
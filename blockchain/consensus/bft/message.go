@@ -1,14 +1,64 @@
 package bft
 
-import "blockchain/network/gossip"
+import (
+	"fmt"
+
+	"blockchain/codec"
+	"blockchain/network/gossip"
+	"blockchain/storage/blockchain"
+)
 
 // типы сообщений BFT
 
-type Message struct {
-	Type      gossip.MessageType
+// Proposal — предложение блока пропосером раунда. POLRound — раунд, в котором
+// блок набрал +2/3 prevote (proof-of-lock), или -1, если такого раунда нет.
+// Новый блок (POLRound = -1) создаёт сам пропосер; блок с proof-of-lock
+// может быть создан пропосером более раннего раунда. Пропосер подписывает
+// SignBytes; подпись передаётся в конверте сообщения.
+type Proposal struct {
 	Height    int64
 	Round     int64
+	POLRound  int64
 	Proposer  string
-	Data      []byte
+	Block     *blockchain.Block
 	Signature []byte
 }
+
+// SignBytes возвращает канонические подписываемые данные предложения
+func (p *Proposal) SignBytes() []byte {
+	return gossip.ProposalSignBytes(p.Height, p.Round, p.POLRound, p.Proposer, p.Block.Hash)
+}
+
+// Encode кодирует предложение в каноническом формате
+func (p *Proposal) Encode() []byte {
+	w := codec.NewWriter(codec.KindProposal)
+	w.Int64(p.Height)
+	w.Int64(p.Round)
+	w.Int64(p.POLRound)
+	w.String(p.Proposer)
+	w.Bytes(p.Block.Serialize())
+	return w.Result()
+}
+
+// DecodeProposal восстанавливает предложение, закодированное Encode
+func DecodeProposal(data []byte) (*Proposal, error) {
+	r, err := codec.NewReader(data, codec.KindProposal)
+	if err != nil {
+		return nil, err
+	}
+	p := &Proposal{
+		Height:   r.Int64(),
+		Round:    r.Int64(),
+		POLRound: r.Int64(),
+		Proposer: r.String(),
+	}
+	blockData := r.Bytes()
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode proposal: %w", err)
+	}
+	p.Block = &blockchain.Block{}
+	if err := p.Block.Deserialize(blockData); err != nil {
+		return nil, fmt.Errorf("failed to decode proposed block: %w", err)
+	}
+	return p, nil
+}
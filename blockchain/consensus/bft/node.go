@@ -8,112 +8,63 @@ import (
 	"blockchain/network/peer"
 	"blockchain/storage/blockchain"
 	"blockchain/storage/txpool"
-	"crypto/tls"
 	"fmt"
-	"log"
 	"time"
 )
 
 type Node struct {
-	ID      string
-	Addr    string
-	PeerMgr *peer.PeerManager
-	TxPool  *txpool.TransactionPool // Добавляем пул транзакций
-	Chain   *blockchain.Blockchain  // Добавлено
-
+	ID        string
+	Addr      string
+	PeerMgr   *peer.PeerManager
+	TxPool    *txpool.TransactionPool // Добавляем пул транзакций
+	Chain     *blockchain.Blockchain  // Добавлено
+	ChainID   string                  // идентификатор сети из генезиса
+	Transport *p2p.Transport          // постоянные соединения с пирами
 }
 
-func (n *Node) PerformHandshake(conn *tls.Conn) error {
-	hs := p2p.NewHandshake(n.ID)
-	data, _ := hs.Serialize()
-	_, err := conn.Write(data)
-	if err != nil {
-		return err
-	}
-
-	// Read response
-	buf := make([]byte, 1024)
-	bytesRead, err := conn.Read(buf)
-	remoteHS, err := p2p.DeserializeHandshake(buf[:bytesRead])
-	if err != nil {
-		return err
-	}
-	fmt.Printf("Handshake with %s successful\n", remoteHS.NodeID)
-	return nil
-}
-
-func NewNode(id, addr string, txPool *txpool.TransactionPool, chain *blockchain.Blockchain) *Node {
+func NewNode(id, addr, chainID string, txPool *txpool.TransactionPool, chain *blockchain.Blockchain) *Node {
 	return &Node{
-		ID:      id,
-		Addr:    addr,
-		PeerMgr: peer.NewPeerManager(),
-		TxPool:  txPool,
-		Chain:   chain,
+		ID:        id,
+		Addr:      addr,
+		PeerMgr:   peer.NewPeerManager(),
+		TxPool:    txPool,
+		Chain:     chain,
+		ChainID:   chainID,
+		Transport: p2p.Shared(addr, nil),
 	}
 }
 
+// Start начинает принимать сообщения пиров; рукопожатие, кадры и ping
+// соединений выполняет транспорт
 func (n *Node) Start() {
 	fmt.Printf("Node %s started at %s\n", n.ID, n.Addr)
-	go n.listenTLS()
-}
-func (n *Node) listenTLS() {
-	config := p2p.GenerateTLSConfig()
-	listener, err := tls.Listen("tcp", n.Addr, config)
-	if err != nil {
-		log.Fatalf("Failed to start TLS listener: %v", err)
-	}
-	for {
-		rawConn, err := listener.Accept()
-		if err != nil {
-			log.Printf("Failed to accept connection: %v", err)
-			continue
-		}
-
-		// Приводим net.Conn к *tls.Conn
-		tlsConn, ok := rawConn.(*tls.Conn)
-		if !ok {
-			log.Println("Connection is not a TLS connection")
-			rawConn.Close()
-			continue
-		}
-
-		go n.handleSecureConnection(tlsConn)
+	n.Transport.OnReceive(p2p.ChannelConsensus, n.handleMessage)
+	n.Transport.OnReceive(p2p.ChannelBlocks, n.handleMessage)
+	if err := n.Transport.Listen(); err != nil {
+		fmt.Printf("Failed to start listener: %v\n", err)
 	}
 }
 
-func (n *Node) handleSecureConnection(conn *tls.Conn) {
-	defer conn.Close()
-
-	if err := n.PerformHandshake(conn); err != nil {
-		fmt.Printf("Handshake failed: %v\n", err)
+func (n *Node) handleMessage(from string, data []byte) {
+	msg, err := gossip.DecodeConsensusMessage(data)
+	if err != nil {
+		fmt.Printf("Failed to decode message from %s: %v\n", from, err)
 		return
 	}
 
-	for {
-		buf := make([]byte, 4096)
-		nBytes, err := conn.Read(buf)
-		if err != nil {
-			fmt.Printf("Connection closed: %v\n", err)
-			return
-		}
-
-		msg, err := gossip.DecodeConsensusMessage(buf[:nBytes])
-		if err != nil {
-			// Обработка сообщений консенсуса
-			go n.handleConsensusMessage(msg)
-			return
-		}
-
-		switch msg.Type {
-		case gossip.MsgPing:
-			n.handlePing(conn, msg)
-		case gossip.MsgPong:
-			fmt.Printf("Received pong from %s\n", msg.From)
-		default:
-			fmt.Printf("Received message from %s: %s\n", msg.From, msg.Type)
-		}
+	switch msg.Type {
+	case gossip.MsgPing:
+		n.handlePing(from, msg)
+	case gossip.MsgPong:
+		fmt.Printf("Received pong from %s\n", msg.From)
+	case gossip.StatePropose, gossip.MsgVote:
+		// Обработка сообщений консенсуса
+		go n.handleConsensusMessage(msg)
+	default:
+		fmt.Printf("Received message from %s: %s\n", msg.From, msg.Type)
 	}
 }
+
 func (n *Node) handleConsensusMessage(msg *gossip.ConsensusMessage) {
 	switch msg.Type {
 	case gossip.StatePropose:
@@ -128,7 +79,7 @@ func (n *Node) handleConsensusMessage(msg *gossip.ConsensusMessage) {
 	}
 }
 
-func (n *Node) handlePing(conn *tls.Conn, msg *gossip.ConsensusMessage) {
+func (n *Node) handlePing(from string, msg *gossip.ConsensusMessage) {
 	fmt.Printf("Received ping from %s\n", msg.From)
 
 	// Отправляем pong
@@ -140,8 +91,7 @@ func (n *Node) handlePing(conn *tls.Conn, msg *gossip.ConsensusMessage) {
 	}
 	data, _ := pong.Encode()
 
-	_, err := conn.Write(data)
-	if err != nil {
+	if err := n.Transport.Send(from, gossip.Channel(pong.Type), data); err != nil {
 		fmt.Printf("Failed to send pong: %v\n", err)
 	}
 }
@@ -155,18 +105,9 @@ func (n *Node) BroadcastBlock(block *blockchain.Block) {
 		Block:  block,
 	}
 
-	data, err := msg.Encode()
-	if err != nil {
-		fmt.Printf("Failed to encode block message: %v\n", err)
-		return
-	}
-
 	// Отправляем блок всем пеерам
-	for _, peer := range n.PeerMgr.GetPeers() {
-		_, err := peer.Connection.Write(data)
-		if err != nil {
-			fmt.Printf("Failed to send block to %s: %v\n", peer.ID, err)
-		}
+	if err := gossip.BroadcastConsensusMessage(n.Transport, n.PeerMgr.GetPeers(), msg); err != nil {
+		fmt.Printf("Failed to encode block message: %v\n", err)
 	}
 }
 
@@ -177,7 +118,7 @@ func (n *Node) CreateBlockFromPool() *blockchain.Block {
 
 	// 2. Проверяем каждую транзакцию
 	for _, tx := range txs {
-		if !tx.Verify() {
+		if !tx.Verify(n.ChainID) {
 			fmt.Printf("Invalid transaction: %s\n", tx.ID)
 			continue
 		}
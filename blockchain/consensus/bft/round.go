@@ -1,27 +1,63 @@
 package bft
 
-import "blockchain/network/gossip"
+import (
+	"sort"
+
+	"blockchain/consensus/pos"
+	"blockchain/network/gossip"
+)
 
 // раунд консенсуса
 
-// Round — структура раунда консенсуса
+// Round — предложение и голоса одного раунда высоты
 type Round struct {
-	Height        int64
-	Round         int64
-	Step          gossip.MessageType
-	Proposer      string
-	ProposedBlock []byte
-	Prevotes      map[string][]byte
-	Precommits    map[string][]byte
+	Height   int64
+	Round    int64
+	Proposal *Proposal
+	// Результат проверки предложенного блока (nil — блок валиден)
+	ProposalErr error
+	Prevotes    *VoteSet
+	Precommits  *VoteSet
+
+	prevoteWait   bool // запущен таймаут prevote (+2/3 любых prevote)
+	precommitWait bool // запущен таймаут precommit (+2/3 любых precommit)
+	polSeen       bool // предложение набрало +2/3 prevote (правило блокировки сработало)
 }
 
-func NewRound(height, round int64, proposer string) *Round {
+func NewRound(height, round int64, validators pos.ValidatorPool) *Round {
 	return &Round{
 		Height:     height,
 		Round:      round,
-		Step:       gossip.StatePropose,
-		Proposer:   proposer,
-		Prevotes:   make(map[string][]byte),
-		Precommits: make(map[string][]byte),
+		Prevotes:   NewVoteSet(height, round, gossip.StatePrevote, validators),
+		Precommits: NewVoteSet(height, round, gossip.StatePrecommit, validators),
+	}
+}
+
+// votes возвращает голоса нужного типа
+func (r *Round) votes(voteType gossip.MessageType) *VoteSet {
+	if voteType == gossip.StatePrecommit {
+		return r.Precommits
+	}
+	return r.Prevotes
+}
+
+// votedPower возвращает мощность валидаторов, приславших хотя бы один голос в раунде
+func (r *Round) votedPower() int64 {
+	var power int64
+	for i, p := range r.Prevotes.powers {
+		if r.Prevotes.votes[i] != nil || r.Precommits.votes[i] != nil {
+			power += p
+		}
+	}
+	return power
+}
+
+// sortedRounds возвращает номера раундов по возрастанию
+func sortedRounds(rounds map[int64]*Round) []int64 {
+	keys := make([]int64, 0, len(rounds))
+	for r := range rounds {
+		keys = append(keys, r)
 	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
 }
@@ -3,6 +3,8 @@ package bft
 // запуск узла
 
 import (
+	"fmt"
+
 	"blockchain/network/gossip"
 	"blockchain/network/peer"
 	"blockchain/storage/blockchain"
@@ -14,17 +16,21 @@ func StartNetwork(txPool *txpool.TransactionPool) {
 	chain := blockchain.NewBlockchain()
 
 	// Создаём узел с передачей всех необходимых аргументов
-	node := NewNode("node1", ":3000", txPool, chain)
-
-	// Добавляем пир
-	node.PeerMgr.AddPeer(peer.NewPeer("peer1", ":3001", nil))
+	node := NewNode("node1", ":3000", txpool.DefaultChainID, txPool, chain)
 
 	// Запуск узла
 	node.Start()
 
-	// Запуск сетевых горутин
-	go peer.BroadcastPresence(node.Addr)
-	go peer.ListenForPeers()
+	// Пиры находятся обнаружением: идентификатор узла — хэш его ключа,
+	// а в PeerManager попадают только узлы, подписавшие ответы своим ключом
+	key, err := peer.GenerateNodeKey()
+	if err != nil {
+		panic(err)
+	}
+	self := peer.Node{Addr: ":30000", PeerAddr: node.Addr}
+	if err := peer.NewDiscovery(key, self, node.PeerMgr, nil).Start(); err != nil {
+		fmt.Printf("⚠️ Peer discovery unavailable: %v\n", err)
+	}
 
 	// Отправка тестового блока
 	msg := &gossip.GossipMessage{
@@ -32,5 +38,5 @@ func StartNetwork(txPool *txpool.TransactionPool) {
 		From: node.ID,
 		Data: []byte("block-123"),
 	}
-	gossip.Broadcast(node.PeerMgr.GetPeers(), msg)
+	gossip.Broadcast(node.Transport, node.PeerMgr.GetPeers(), msg)
 }
@@ -0,0 +1,642 @@
+package bft
+
+// конечный автомат Tendermint
+//
+// Шаги propose → prevote → precommit переключаются входящими сообщениями и
+// таймаутами, а не таймером. Правила переходов следуют алгоритму из статьи
+// «The latest gossip on BFT consensus» (Buchman, Kwon, Milosevic):
+//   - пропосер раунда предлагает блок, остальные ждут его не дольше TimeoutPropose;
+//   - валидатор голосует prevote за валидный блок, если не заблокирован на
+//     другом блоке или блок подкреплён proof-of-lock (+2/3 prevote в раунде
+//     не раньше блокировки), иначе голосует nil;
+//   - +2/3 prevote за блок блокируют валидатора на нём (precommit за блок),
+//     +2/3 prevote nil — precommit nil;
+//   - +2/3 precommit за блок — решение высоты, без решения по таймауту
+//     precommit начинается следующий раунд;
+//   - голоса +1/3 валидаторов из более позднего раунда переводят в этот раунд.
+//
+// Два разных голоса или предложения одного валидатора в раунде передаются
+// в Backend.ReportEvidence как доказательство двойной подписи.
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"blockchain/consensus/evidence"
+	"blockchain/consensus/pos"
+	"blockchain/crypto/signature"
+	"blockchain/network/gossip"
+	"blockchain/storage/blockchain"
+)
+
+var (
+	ErrStaleMessage       = errors.New("consensus message for a past height")
+	ErrFutureHeight       = errors.New("consensus message for a future height")
+	ErrFutureRound        = errors.New("consensus message for a round too far ahead")
+	ErrUnknownValidator   = errors.New("unknown validator")
+	ErrUnexpectedProposer = errors.New("proposal from unexpected proposer")
+	ErrInvalidProposal    = errors.New("invalid proposal")
+	ErrInvalidVote        = errors.New("invalid vote")
+	ErrConflictingVote    = errors.New("conflicting vote")
+)
+
+// MaxRoundsAhead — на сколько раундов вперёд текущего принимаются сообщения.
+// Раунд заводится на каждое принятое сообщение, поэтому без ограничения
+// валидатор мог бы занять память голосами за сколь угодно далёкие раунды.
+// Отставший по раундам узел догоняет сеть по таймаутам, пока её раунд не
+// окажется в окне, и переходит в него по голосам +1/3 валидаторов.
+const MaxRoundsAhead = 4
+
+// RoundStep — шаг раунда консенсуса
+type RoundStep uint8
+
+const (
+	StepNewHeight RoundStep = iota // ожидание начала высоты
+	StepPropose                    // ожидание предложения
+	StepPrevote                    // prevote отправлен, ожидание +2/3 prevote
+	StepPrecommit                  // precommit отправлен, ожидание +2/3 precommit
+	StepCommit                     // блок высоты принят
+)
+
+func (s RoundStep) String() string {
+	switch s {
+	case StepNewHeight:
+		return "new-height"
+	case StepPropose:
+		return "propose"
+	case StepPrevote:
+		return "prevote"
+	case StepPrecommit:
+		return "precommit"
+	case StepCommit:
+		return "commit"
+	}
+	return fmt.Sprintf("step(%d)", uint8(s))
+}
+
+// Config — таймауты шагов консенсуса. В раунде r таймаут шага равен базовому
+// значению плюс r приращений Delta: при сбоях раунды удлиняются, пока сеть
+// не успеет доставить сообщения.
+type Config struct {
+	TimeoutPropose        time.Duration
+	TimeoutProposeDelta   time.Duration
+	TimeoutPrevote        time.Duration
+	TimeoutPrevoteDelta   time.Duration
+	TimeoutPrecommit      time.Duration
+	TimeoutPrecommitDelta time.Duration
+	// Пауза между решением высоты и началом следующей; с тем же интервалом
+	// проверяется пул, пока в нём нет транзакций
+	TimeoutCommit time.Duration
+}
+
+// DefaultConfig возвращает таймауты по умолчанию
+func DefaultConfig() *Config {
+	return &Config{
+		TimeoutPropose:        3 * time.Second,
+		TimeoutProposeDelta:   500 * time.Millisecond,
+		TimeoutPrevote:        1 * time.Second,
+		TimeoutPrevoteDelta:   500 * time.Millisecond,
+		TimeoutPrecommit:      1 * time.Second,
+		TimeoutPrecommitDelta: 500 * time.Millisecond,
+		TimeoutCommit:         1 * time.Second,
+	}
+}
+
+// Propose возвращает таймаут ожидания предложения в раунде round
+func (c *Config) Propose(round int64) time.Duration {
+	return c.TimeoutPropose + time.Duration(round)*c.TimeoutProposeDelta
+}
+
+// Prevote возвращает таймаут ожидания prevote в раунде round
+func (c *Config) Prevote(round int64) time.Duration {
+	return c.TimeoutPrevote + time.Duration(round)*c.TimeoutPrevoteDelta
+}
+
+// Precommit возвращает таймаут ожидания precommit в раунде round
+func (c *Config) Precommit(round int64) time.Duration {
+	return c.TimeoutPrecommit + time.Duration(round)*c.TimeoutPrecommitDelta
+}
+
+// Backend — окружение конечного автомата: набор валидаторов, сборка,
+// проверка и фиксация блоков, рассылка сообщений
+type Backend interface {
+	// Validators возвращает валидаторов высоты height
+	Validators(height int64) pos.ValidatorPool
+	// Proposer возвращает адрес пропосера раунда; функция должна давать
+	// одинаковый результат на всех узлах
+	Proposer(height, round int64) string
+	// HasPendingTxs сообщает, есть ли транзакции для нового блока
+	HasPendingTxs() bool
+	// ProposeBlock собирает и подписывает блок высоты height
+	ProposeBlock(height int64) (*blockchain.Block, error)
+	// ValidateBlock проверяет предложенный блок поверх текущей вершины цепочки
+	ValidateBlock(block *blockchain.Block) error
+	// BroadcastProposal и BroadcastVote рассылают сообщения остальным валидаторам
+	BroadcastProposal(p *Proposal)
+	BroadcastVote(v *Vote)
+	// ReportEvidence сообщает о двойной подписи валидатора
+	ReportEvidence(e *blockchain.Evidence)
+	// CommitBlock фиксирует блок, за который проголосовали +2/3 валидаторов,
+	// вместе с сертификатом из их precommit
+	CommitBlock(block *blockchain.Block, commit *blockchain.Commit) error
+}
+
+// ConsensusState — конечный автомат Tendermint одного валидатора.
+// Методы потокобезопасны; сообщения рассылаются после снятия блокировки,
+// поэтому Backend может доставлять их другим автоматам синхронно.
+type ConsensusState struct {
+	mu      sync.Mutex
+	address string
+	signer  signature.Signer
+	config  *Config
+	clock   Clock
+	backend Backend
+
+	height     int64
+	round      int64
+	step       RoundStep
+	validators pos.ValidatorPool
+	totalPower int64
+	rounds     map[int64]*Round
+
+	lockedRound int64
+	lockedBlock *blockchain.Block
+	validRound  int64
+	validBlock  *blockchain.Block
+
+	stopped atomic.Bool
+	outbox  []func()
+}
+
+// NewConsensusState создаёт автомат валидатора address, подписывающего голоса signer.
+// clock == nil — системные часы, config == nil — таймауты по умолчанию.
+func NewConsensusState(address string, signer signature.Signer, backend Backend, clock Clock, config *Config) *ConsensusState {
+	if clock == nil {
+		clock = SystemClock{}
+	}
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return &ConsensusState{
+		address:     address,
+		signer:      signer,
+		config:      config,
+		clock:       clock,
+		backend:     backend,
+		rounds:      make(map[int64]*Round),
+		lockedRound: -1,
+		validRound:  -1,
+	}
+}
+
+// Start начинает консенсус с высоты height
+func (cs *ConsensusState) Start(height int64) {
+	cs.mu.Lock()
+	cs.stopped.Store(false)
+	cs.enterNewHeight(height)
+	cs.tryStartHeight()
+	cs.advance()
+	cs.unlockAndFlush()
+}
+
+// Stop останавливает автомат: таймауты и сообщения больше не обрабатываются,
+// а после фиксации текущего блока автомат не переходит к следующей высоте.
+// Не требует блокировки, поэтому может вызываться из Backend.CommitBlock.
+func (cs *ConsensusState) Stop() {
+	cs.stopped.Store(true)
+}
+
+// State возвращает текущие высоту, раунд и шаг
+func (cs *ConsensusState) State() (int64, int64, RoundStep) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.height, cs.round, cs.step
+}
+
+// Locked возвращает раунд и блок, на которых заблокирован валидатор (-1, nil — блокировки нет)
+func (cs *ConsensusState) Locked() (int64, *blockchain.Block) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.lockedRound, cs.lockedBlock
+}
+
+// HandleProposal принимает предложение блока
+func (cs *ConsensusState) HandleProposal(p *Proposal) error {
+	cs.mu.Lock()
+	if cs.stopped.Load() {
+		cs.mu.Unlock()
+		return nil
+	}
+	err := cs.addProposal(p)
+	if err == nil {
+		cs.advance()
+	}
+	cs.unlockAndFlush()
+	return err
+}
+
+// HandleVote принимает голос prevote или precommit
+func (cs *ConsensusState) HandleVote(v *Vote) error {
+	cs.mu.Lock()
+	if cs.stopped.Load() {
+		cs.mu.Unlock()
+		return nil
+	}
+	err := cs.addVote(v)
+	if err == nil {
+		cs.advance()
+	}
+	cs.unlockAndFlush()
+	return err
+}
+
+func (cs *ConsensusState) checkHeight(height int64) error {
+	if height < cs.height || (height == cs.height && cs.step == StepCommit) {
+		return fmt.Errorf("%w: %d, current %d", ErrStaleMessage, height, cs.height)
+	}
+	if height > cs.height {
+		return fmt.Errorf("%w: %d, current %d", ErrFutureHeight, height, cs.height)
+	}
+	return nil
+}
+
+// checkRound отклоняет сообщения раундов дальше MaxRoundsAhead от текущего
+func (cs *ConsensusState) checkRound(round int64) error {
+	if round > cs.round+MaxRoundsAhead {
+		return fmt.Errorf("%w: %d, current %d", ErrFutureRound, round, cs.round)
+	}
+	return nil
+}
+
+func (cs *ConsensusState) addProposal(p *Proposal) error {
+	if p == nil || p.Block == nil {
+		return fmt.Errorf("%w: empty proposal", ErrInvalidProposal)
+	}
+	if err := cs.checkHeight(p.Height); err != nil {
+		return err
+	}
+	if p.Round < 0 || p.POLRound < -1 || p.POLRound >= p.Round || p.Block.Index != p.Height {
+		return fmt.Errorf("%w: height %d, round %d, POL round %d, block %d",
+			ErrInvalidProposal, p.Height, p.Round, p.POLRound, p.Block.Index)
+	}
+	if err := cs.checkRound(p.Round); err != nil {
+		return err
+	}
+	if proposer := cs.backend.Proposer(p.Height, p.Round); p.Proposer != proposer {
+		return fmt.Errorf("%w: %s, expected %s", ErrUnexpectedProposer, p.Proposer, proposer)
+	}
+	if p.POLRound < 0 && p.Block.Validator != p.Proposer {
+		return fmt.Errorf("%w: new block by %s proposed by %s", ErrInvalidProposal, p.Block.Validator, p.Proposer)
+	}
+
+	rs := cs.roundState(p.Round)
+	if rs.Proposal != nil {
+		if rs.Proposal.Block.Hash != p.Block.Hash {
+			cs.reportConflictingProposal(rs.Proposal, p)
+		}
+		return nil
+	}
+	rs.Proposal = p
+	rs.ProposalErr = cs.backend.ValidateBlock(p.Block)
+	if rs.ProposalErr != nil {
+		fmt.Printf("❌ Invalid proposal %s for height %d round %d: %v\n", p.Block.Hash, p.Height, p.Round, rs.ProposalErr)
+	} else {
+		fmt.Printf("📬 Received proposal %s for height %d round %d\n", p.Block.Hash, p.Height, p.Round)
+	}
+	return nil
+}
+
+func (cs *ConsensusState) addVote(v *Vote) error {
+	if v == nil || (v.Type != gossip.StatePrevote && v.Type != gossip.StatePrecommit) || v.Round < 0 {
+		return ErrInvalidVote
+	}
+	if err := cs.checkHeight(v.Height); err != nil {
+		return err
+	}
+	if err := cs.checkRound(v.Round); err != nil {
+		return err
+	}
+	// Подпись проверяется до создания раунда: чужие голоса не занимают память
+	if err := v.Verify(cs.validators); err != nil {
+		return err
+	}
+	votes := cs.roundState(v.Round).votes(v.Type)
+	err := votes.add(v)
+	if errors.Is(err, ErrConflictingVote) {
+		cs.reportDuplicateVote(votes.Get(v.ValidatorIndex), v)
+	}
+	return err
+}
+
+// reportDuplicateVote сообщает о двух разных голосах валидатора в одном шаге
+func (cs *ConsensusState) reportDuplicateVote(a, b *Vote) {
+	e, err := evidence.NewDuplicateVote(b.Validator,
+		blockchain.SignedData{Data: a.SignBytes(), Signature: a.Signature},
+		blockchain.SignedData{Data: b.SignBytes(), Signature: b.Signature})
+	if err != nil {
+		return
+	}
+	cs.send(func() { cs.backend.ReportEvidence(e) })
+}
+
+// reportConflictingProposal сообщает о двух разных подписанных предложениях
+// пропосера в одном раунде
+func (cs *ConsensusState) reportConflictingProposal(a, b *Proposal) {
+	if len(a.Signature) == 0 || len(b.Signature) == 0 {
+		return
+	}
+	e, err := evidence.NewConflictingProposal(
+		blockchain.SignedData{Data: a.SignBytes(), Signature: a.Signature},
+		blockchain.SignedData{Data: b.SignBytes(), Signature: b.Signature})
+	if err != nil {
+		return
+	}
+	cs.send(func() { cs.backend.ReportEvidence(e) })
+}
+
+// advance применяет правила переходов, пока они меняют состояние
+func (cs *ConsensusState) advance() {
+	for cs.applyRules() {
+	}
+}
+
+// applyRules применяет первое сработавшее правило и сообщает, изменилось ли состояние
+func (cs *ConsensusState) applyRules() bool {
+	if cs.step == StepCommit {
+		return false
+	}
+	rounds := sortedRounds(cs.rounds)
+
+	// Решение высоты: предложение любого раунда и +2/3 precommit за него
+	for _, r := range rounds {
+		rs := cs.rounds[r]
+		if p := rs.Proposal; p != nil && rs.ProposalErr == nil && rs.Precommits.HasTwoThirdsFor(p.Block.Hash) {
+			cs.decide(rs)
+			return true
+		}
+	}
+
+	// Голоса +1/3 валидаторов из более позднего раунда: догоняем его
+	for i := len(rounds) - 1; i >= 0; i-- {
+		if r := rounds[i]; r > cs.round && hasOneThird(cs.rounds[r].votedPower(), cs.totalPower) {
+			cs.startRound(r)
+			return true
+		}
+	}
+
+	rs := cs.roundState(cs.round)
+	p := rs.Proposal
+
+	switch cs.step {
+	case StepNewHeight:
+		// Пул пуст, но другие валидаторы уже начали высоту
+		if p != nil || hasOneThird(rs.votedPower(), cs.totalPower) {
+			cs.startRound(cs.round)
+			return true
+		}
+		return false
+
+	case StepPropose:
+		if p != nil && cs.prevoteProposal(rs) {
+			return true
+		}
+
+	default:
+		if p != nil && rs.ProposalErr == nil && !rs.polSeen && rs.Prevotes.HasTwoThirdsFor(p.Block.Hash) {
+			rs.polSeen = true
+			if cs.step == StepPrevote {
+				cs.lockedRound, cs.lockedBlock = cs.round, p.Block
+				fmt.Printf("🔒 Locked on block %s at height %d round %d\n", p.Block.Hash, cs.height, cs.round)
+				cs.castVote(gossip.StatePrecommit, p.Block.Hash)
+			}
+			cs.validRound, cs.validBlock = cs.round, p.Block
+			return true
+		}
+		if cs.step == StepPrevote {
+			if rs.Prevotes.HasTwoThirdsFor("") {
+				cs.castVote(gossip.StatePrecommit, "")
+				return true
+			}
+			if !rs.prevoteWait && rs.Prevotes.HasTwoThirdsAny() {
+				rs.prevoteWait = true
+				cs.schedule(cs.config.Prevote(cs.round), StepPrevote)
+			}
+		}
+	}
+
+	if !rs.precommitWait && rs.Precommits.HasTwoThirdsAny() {
+		rs.precommitWait = true
+		cs.schedule(cs.config.Precommit(cs.round), StepPrecommit)
+	}
+	return false
+}
+
+// prevoteProposal голосует prevote на шаге propose, когда есть предложение
+// и (для повторного предложения) proof-of-lock к нему
+func (cs *ConsensusState) prevoteProposal(rs *Round) bool {
+	p := rs.Proposal
+	hash := p.Block.Hash
+	var acceptable bool
+	if p.POLRound < 0 {
+		acceptable = cs.lockedRound < 0 || cs.lockedBlock.Hash == hash
+	} else {
+		// Блок с proof-of-lock снимает блокировку, полученную не позже POLRound
+		pol := cs.rounds[p.POLRound]
+		if pol == nil || !pol.Prevotes.HasTwoThirdsFor(hash) {
+			return false
+		}
+		acceptable = cs.lockedRound <= p.POLRound || cs.lockedBlock.Hash == hash
+	}
+	if rs.ProposalErr == nil && acceptable {
+		cs.castVote(gossip.StatePrevote, hash)
+	} else {
+		cs.castVote(gossip.StatePrevote, "")
+	}
+	return true
+}
+
+func (cs *ConsensusState) enterNewHeight(height int64) {
+	cs.height = height
+	cs.round = 0
+	cs.step = StepNewHeight
+	cs.rounds = make(map[int64]*Round)
+	cs.lockedRound, cs.lockedBlock = -1, nil
+	cs.validRound, cs.validBlock = -1, nil
+	cs.validators = cs.backend.Validators(height)
+	cs.totalPower = 0
+	for _, v := range cs.validators {
+		cs.totalPower += v.VotingPower()
+	}
+}
+
+// tryStartHeight начинает раунд 0, если есть что предлагать, иначе
+// откладывает проверку на TimeoutCommit
+func (cs *ConsensusState) tryStartHeight() {
+	if cs.backend.HasPendingTxs() {
+		cs.startRound(0)
+		return
+	}
+	cs.schedule(cs.config.TimeoutCommit, StepNewHeight)
+}
+
+func (cs *ConsensusState) startRound(round int64) {
+	cs.round = round
+	cs.step = StepPropose
+	rs := cs.roundState(round)
+
+	proposer := cs.backend.Proposer(cs.height, round)
+	fmt.Printf("🚀 Starting round %d for height %d. Proposer: %s\n", round, cs.height, proposer)
+
+	if proposer == cs.address && rs.Proposal == nil {
+		// Блок, уже набравший +2/3 prevote, предлагается повторно
+		block := cs.validBlock
+		if block == nil {
+			var err error
+			if block, err = cs.backend.ProposeBlock(cs.height); err != nil {
+				fmt.Printf("❌ Failed to propose block: %v\n", err)
+			}
+		}
+		if block != nil {
+			p := &Proposal{Height: cs.height, Round: round, POLRound: cs.validRound, Proposer: cs.address, Block: block}
+			if sig, err := cs.signer.Sign(p.SignBytes()); err != nil {
+				fmt.Printf("❌ Failed to sign proposal: %v\n", err)
+			} else {
+				p.Signature = sig
+				rs.Proposal = p
+				cs.send(func() { cs.backend.BroadcastProposal(p) })
+				fmt.Printf("✅ Proposed block %s with %d transactions\n", block.Hash, len(block.Transactions))
+			}
+		}
+	}
+	cs.schedule(cs.config.Propose(round), StepPropose)
+}
+
+// castVote переходит на шаг голосования и рассылает голос, если узел — валидатор высоты
+func (cs *ConsensusState) castVote(voteType gossip.MessageType, blockHash string) {
+	if voteType == gossip.StatePrevote {
+		cs.step = StepPrevote
+	} else {
+		cs.step = StepPrecommit
+	}
+	index := cs.validatorIndex(cs.address)
+	if index < 0 {
+		return
+	}
+
+	vote := &Vote{
+		Type:           voteType,
+		Height:         cs.height,
+		Round:          cs.round,
+		BlockHash:      blockHash,
+		ValidatorIndex: index,
+		Validator:      cs.address,
+		Timestamp:      cs.clock.Now().Unix(),
+	}
+	sig, err := cs.signer.Sign(vote.SignBytes())
+	if err != nil {
+		fmt.Printf("❌ Failed to sign %s: %v\n", voteType, err)
+		return
+	}
+	vote.Signature = sig
+	if err := cs.roundState(cs.round).votes(voteType).AddVote(vote); err != nil {
+		fmt.Printf("❌ Own %s rejected: %v\n", voteType, err)
+		return
+	}
+	cs.send(func() { cs.backend.BroadcastVote(vote) })
+
+	target := blockHash
+	if target == "" {
+		target = "nil"
+	}
+	fmt.Printf("🗳 %s for %s from %s at height %d round %d\n", voteType, target, cs.address, cs.height, cs.round)
+}
+
+func (cs *ConsensusState) decide(rs *Round) {
+	block := rs.Proposal.Block
+	cs.step = StepCommit
+	if err := cs.backend.CommitBlock(block, MakeCommit(rs.Precommits, block.Hash)); err != nil {
+		// Без блока высоты продолжать нельзя: узел ждёт синхронизации
+		fmt.Printf("❌ Failed to commit block %s at height %d: %v\n", block.Hash, cs.height, err)
+		return
+	}
+	fmt.Printf("✅ Height %d decided in round %d: %s\n", cs.height, rs.Round, block.Hash)
+	if cs.stopped.Load() {
+		return
+	}
+
+	cs.enterNewHeight(cs.height + 1)
+	cs.schedule(cs.config.TimeoutCommit, StepNewHeight)
+}
+
+// schedule запускает таймаут шага step текущих высоты и раунда
+func (cs *ConsensusState) schedule(d time.Duration, step RoundStep) {
+	height, round := cs.height, cs.round
+	cs.clock.AfterFunc(d, func() { cs.handleTimeout(height, round, step) })
+}
+
+func (cs *ConsensusState) handleTimeout(height, round int64, step RoundStep) {
+	cs.mu.Lock()
+	if cs.stopped.Load() || height != cs.height || round != cs.round {
+		cs.mu.Unlock()
+		return
+	}
+
+	switch step {
+	case StepNewHeight:
+		if cs.step == StepNewHeight {
+			cs.tryStartHeight()
+		}
+	case StepPropose:
+		if cs.step == StepPropose {
+			fmt.Printf("⏰ Propose timeout at height %d round %d\n", height, round)
+			cs.castVote(gossip.StatePrevote, "")
+		}
+	case StepPrevote:
+		if cs.step == StepPrevote {
+			cs.castVote(gossip.StatePrecommit, "")
+		}
+	case StepPrecommit:
+		if cs.step != StepCommit {
+			fmt.Printf("⏰ Precommit timeout at height %d round %d\n", height, round)
+			cs.startRound(round + 1)
+		}
+	}
+	cs.advance()
+	cs.unlockAndFlush()
+}
+
+func (cs *ConsensusState) roundState(round int64) *Round {
+	rs, ok := cs.rounds[round]
+	if !ok {
+		rs = NewRound(cs.height, round, cs.validators)
+		cs.rounds[round] = rs
+	}
+	return rs
+}
+
+// validatorIndex возвращает индекс валидатора в наборе высоты или -1
+func (cs *ConsensusState) validatorIndex(address string) int {
+	for i, v := range cs.validators {
+		if v.Address == address {
+			return i
+		}
+	}
+	return -1
+}
+
+// send откладывает рассылку до снятия блокировки
+func (cs *ConsensusState) send(f func()) {
+	cs.outbox = append(cs.outbox, f)
+}
+
+func (cs *ConsensusState) unlockAndFlush() {
+	outbox := cs.outbox
+	cs.outbox = nil
+	cs.mu.Unlock()
+	for _, f := range outbox {
+		f()
+	}
+}
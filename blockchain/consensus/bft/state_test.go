@@ -0,0 +1,337 @@
+package bft
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"blockchain/consensus/consensustest"
+	"blockchain/consensus/evidence"
+	"blockchain/consensus/pos"
+	"blockchain/network/gossip"
+	"blockchain/storage/blockchain"
+)
+
+var simStart = time.Unix(1700000000, 0)
+
+// signedVote возвращает голос валидатора "vN" с индексом N, подписанный его ключом
+func signedVote(voteType gossip.MessageType, height, round int64, blockHash, address string) *Vote {
+	var index int
+	fmt.Sscanf(address, "v%d", &index)
+	v := &Vote{
+		Type:           voteType,
+		Height:         height,
+		Round:          round,
+		BlockHash:      blockHash,
+		ValidatorIndex: index,
+		Validator:      address,
+		Timestamp:      simStart.Unix(),
+	}
+	v.Signature, _ = consensustest.Signer(address).Sign(v.SignBytes())
+	return v
+}
+
+// simNetwork доставляет сообщения между автоматами синхронно и по порядку
+type simNetwork = consensustest.Network[*ConsensusState]
+
+// testBackend — окружение автомата без цепочки: блоки всегда валидны,
+// пропосеры выбираются по кругу
+type testBackend struct {
+	address    string
+	validators pos.ValidatorPool
+	clock      *SimClock
+	net        *simNetwork
+	votes      []*Vote
+	committed  []*blockchain.Block
+	commits    []*blockchain.Commit
+	evidence   []*blockchain.Evidence
+	commitTime []time.Time
+}
+
+func (b *testBackend) Validators(height int64) pos.ValidatorPool { return b.validators }
+func (b *testBackend) HasPendingTxs() bool                       { return true }
+func (b *testBackend) ValidateBlock(block *blockchain.Block) error {
+	return nil
+}
+
+func (b *testBackend) Proposer(height, round int64) string {
+	return b.validators[(height+round)%int64(len(b.validators))].Address
+}
+
+func (b *testBackend) ProposeBlock(height int64) (*blockchain.Block, error) {
+	return testBlock(height, b.address, "proposed"), nil
+}
+
+func (b *testBackend) BroadcastProposal(p *Proposal) {
+	if b.net != nil {
+		b.net.Broadcast(b.address, func(cs *ConsensusState) { cs.HandleProposal(p) })
+	}
+}
+
+func (b *testBackend) BroadcastVote(v *Vote) {
+	b.votes = append(b.votes, v)
+	if b.net != nil {
+		b.net.Broadcast(b.address, func(cs *ConsensusState) { cs.HandleVote(v) })
+	}
+}
+
+func (b *testBackend) ReportEvidence(e *blockchain.Evidence) {
+	b.evidence = append(b.evidence, e)
+}
+
+func (b *testBackend) CommitBlock(block *blockchain.Block, commit *blockchain.Commit) error {
+	b.committed = append(b.committed, block)
+	b.commits = append(b.commits, commit)
+	b.commitTime = append(b.commitTime, b.clock.Now())
+	return nil
+}
+
+// lastVote возвращает последний отправленный голос
+func (b *testBackend) lastVote() *Vote {
+	if len(b.votes) == 0 {
+		return nil
+	}
+	return b.votes[len(b.votes)-1]
+}
+
+func testBlock(height int64, proposer, tag string) *blockchain.Block {
+	block := &blockchain.Block{Index: height, Timestamp: height, PrevHash: tag, Validator: proposer}
+	block.Hash = block.CalculateHash()
+	return block
+}
+
+// newSimNetwork запускает n автоматов на высоте 1; валидаторы из down не
+// отправляют и не получают сообщений
+func newSimNetwork(n int, down ...string) (*simNetwork, *SimClock, map[string]*testBackend) {
+	clock := NewSimClock(simStart)
+	validators := consensustest.Validators(n)
+	net := consensustest.NewNetwork[*ConsensusState](down...)
+
+	backends := make(map[string]*testBackend)
+	for _, v := range validators {
+		backend := &testBackend{address: v.Address, validators: validators, clock: clock, net: net}
+		backends[v.Address] = backend
+		net.Nodes[v.Address] = NewConsensusState(v.Address, consensustest.Signer(v.Address), backend, clock, nil)
+	}
+
+	// Сообщения доставляются после того, как все автоматы начали высоту
+	net.Hold(func() {
+		for _, v := range validators {
+			net.Nodes[v.Address].Start(1)
+		}
+	})
+	return net, clock, backends
+}
+
+// TestConsensus_CommitInFirstRound - без сбоев блок принимается в раунде 0 без ожидания таймаутов
+func TestConsensus_CommitInFirstRound(t *testing.T) {
+	net, clock, backends := newSimNetwork(4)
+
+	var hash string
+	for addr, b := range backends {
+		if len(b.committed) != 1 {
+			t.Fatalf("%s committed %d blocks, expected 1", addr, len(b.committed))
+		}
+		if hash == "" {
+			hash = b.committed[0].Hash
+		}
+		if b.committed[0].Hash != hash || b.committed[0].Validator != "v1" {
+			t.Fatalf("%s committed %s by %s", addr, b.committed[0].Hash, b.committed[0].Validator)
+		}
+		if !b.commitTime[0].Equal(simStart) {
+			t.Errorf("%s committed at %v, expected no timeouts", addr, b.commitTime[0].Sub(simStart))
+		}
+	}
+
+	// Следующая высота начинается после TimeoutCommit
+	clock.Advance(DefaultConfig().TimeoutCommit)
+	for addr, b := range backends {
+		if len(b.committed) != 2 || b.committed[1].Validator != "v2" {
+			t.Fatalf("%s: expected height 2 proposed by v2, got %d blocks", addr, len(b.committed))
+		}
+		if height, round, step := net.Nodes[addr].State(); height != 3 || round != 0 || step != StepNewHeight {
+			t.Errorf("%s: unexpected state %d/%d/%s", addr, height, round, step)
+		}
+	}
+}
+
+// TestConsensus_RoundChangeOnFaultyProposers - при недоступных пропосерах
+// раунды сменяются по таймаутам, которые растут с номером раунда
+func TestConsensus_RoundChangeOnFaultyProposers(t *testing.T) {
+	// 7 валидаторов выдерживают два сбоя; v1 и v2 — пропосеры раундов 0 и 1
+	_, clock, backends := newSimNetwork(7, "v1", "v2")
+	cfg := DefaultConfig()
+
+	for i := 0; i < 200 && len(backends["v0"].committed) == 0; i++ {
+		clock.Advance(100 * time.Millisecond)
+	}
+
+	// Раунд 0: propose 3s + precommit 1s; раунд 1: 3.5s + 1.5s
+	expected := simStart.Add(cfg.Propose(0) + cfg.Precommit(0) + cfg.Propose(1) + cfg.Precommit(1))
+	for _, addr := range []string{"v0", "v3", "v4", "v5", "v6"} {
+		b := backends[addr]
+		if len(b.committed) != 1 {
+			t.Fatalf("%s committed %d blocks, expected 1", addr, len(b.committed))
+		}
+		if b.committed[0].Validator != "v3" {
+			t.Errorf("%s: expected block from round 2 proposer v3, got %s", addr, b.committed[0].Validator)
+		}
+		if !b.commitTime[0].Equal(expected) {
+			t.Errorf("%s committed after %v, expected %v", addr, b.commitTime[0].Sub(simStart), expected.Sub(simStart))
+		}
+	}
+	if len(backends["v1"].committed) != 0 {
+		t.Errorf("Isolated validator must not commit")
+	}
+}
+
+// TestConsensus_LockAndUnlockWithPOL - заблокированный валидатор голосует nil
+// за другой блок, пока не увидит proof-of-lock более позднего раунда
+func TestConsensus_LockAndUnlockWithPOL(t *testing.T) {
+	clock := NewSimClock(simStart)
+	backend := &testBackend{address: "v0", validators: consensustest.Validators(4), clock: clock}
+	cs := NewConsensusState("v0", consensustest.Signer("v0"), backend, clock, nil)
+	cs.Start(1)
+
+	vote := func(voteType gossip.MessageType, round int64, hash string, from ...string) {
+		for _, addr := range from {
+			if err := cs.HandleVote(signedVote(voteType, 1, round, hash, addr)); err != nil {
+				t.Fatalf("HandleVote failed: %v", err)
+			}
+		}
+	}
+	expectVote := func(voteType gossip.MessageType, round int64, hash string) {
+		t.Helper()
+		v := backend.lastVote()
+		if v == nil || v.Type != voteType || v.Round != round || v.BlockHash != hash {
+			t.Fatalf("Expected %s for %q in round %d, got %+v", voteType, hash, round, v)
+		}
+	}
+
+	// Раунд 0: +2/3 prevote за X — блокировка на X
+	x := testBlock(1, "v1", "x")
+	if err := cs.HandleProposal(&Proposal{Height: 1, Round: 0, POLRound: -1, Proposer: "v1", Block: x}); err != nil {
+		t.Fatal(err)
+	}
+	expectVote(gossip.StatePrevote, 0, x.Hash)
+	vote(gossip.StatePrevote, 0, x.Hash, "v1", "v2")
+	expectVote(gossip.StatePrecommit, 0, x.Hash)
+	if round, block := cs.Locked(); round != 0 || block.Hash != x.Hash {
+		t.Fatalf("Expected lock on X in round 0, got round %d", round)
+	}
+
+	// Precommit остальных — nil: по таймауту precommit начинается раунд 1
+	vote(gossip.StatePrecommit, 0, "", "v1", "v2")
+	clock.Advance(DefaultConfig().Precommit(0))
+	if _, round, step := cs.State(); round != 1 || step != StepPropose {
+		t.Fatalf("Expected round 1 propose, got round %d %s", round, step)
+	}
+
+	// Раунд 1: Y без proof-of-lock — заблокированный валидатор голосует nil
+	y := testBlock(1, "v2", "y")
+	cs.HandleProposal(&Proposal{Height: 1, Round: 1, POLRound: -1, Proposer: "v2", Block: y})
+	expectVote(gossip.StatePrevote, 1, "")
+
+	// Голоса +1/3 валидаторов раунда 2 переводят в раунд 2, где v3 снова
+	// предлагает Y со ссылкой на раунд 1, голосов которого узел ещё не видел
+	if err := cs.HandleProposal(&Proposal{Height: 1, Round: 2, POLRound: 1, Proposer: "v2", Block: y}); err == nil {
+		t.Fatal("Expected proposal from a non-proposer to be rejected")
+	}
+	cs.HandleProposal(&Proposal{Height: 1, Round: 2, POLRound: 1, Proposer: "v3", Block: y})
+	vote(gossip.StatePrevote, 2, y.Hash, "v1", "v2")
+	if _, round, step := cs.State(); round != 2 || step != StepPropose {
+		t.Fatalf("Expected to wait for POL in round 2, got round %d %s", round, step)
+	}
+	expectVote(gossip.StatePrevote, 1, "")
+
+	// Proof-of-lock раунда 1 снимает блокировку раунда 0
+	vote(gossip.StatePrevote, 1, y.Hash, "v1", "v2", "v3")
+	expectVote(gossip.StatePrecommit, 2, y.Hash)
+	if round, block := cs.Locked(); round != 2 || block.Hash != y.Hash {
+		t.Fatalf("Expected lock on Y in round 2, got round %d", round)
+	}
+
+	vote(gossip.StatePrecommit, 2, y.Hash, "v1", "v2")
+	if len(backend.committed) != 1 || backend.committed[0].Hash != y.Hash {
+		t.Fatalf("Expected Y to be committed, got %d blocks", len(backend.committed))
+	}
+	if height, _, _ := cs.State(); height != 2 {
+		t.Errorf("Expected height 2 after commit, got %d", height)
+	}
+}
+
+// TestConsensus_RejectsInvalidMessages - голоса чужих, поддельные и двойные голоса отклоняются
+func TestConsensus_RejectsInvalidMessages(t *testing.T) {
+	clock := NewSimClock(simStart)
+	backend := &testBackend{address: "v0", validators: consensustest.Validators(4), clock: clock}
+	cs := NewConsensusState("v0", consensustest.Signer("v0"), backend, clock, nil)
+	cs.Start(1)
+
+	if err := cs.HandleVote(signedVote(gossip.StatePrevote, 1, 0, "a", "v9")); !errors.Is(err, ErrUnknownValidator) {
+		t.Errorf("Expected vote from unknown validator to be rejected, got %v", err)
+	}
+	if err := cs.HandleVote(signedVote(gossip.StatePrevote, 1, 0, "a", "v1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := cs.HandleVote(signedVote(gossip.StatePrevote, 1, 0, "b", "v1")); !errors.Is(err, ErrConflictingVote) {
+		t.Errorf("Expected conflicting vote to be rejected, got %v", err)
+	}
+	if err := cs.HandleVote(signedVote(gossip.StatePrevote, 5, 0, "a", "v1")); !errors.Is(err, ErrFutureHeight) {
+		t.Errorf("Expected vote for a future height to be rejected, got %v", err)
+	}
+	// Раунды дальше окна не заводятся
+	if err := cs.HandleVote(signedVote(gossip.StatePrevote, 1, MaxRoundsAhead+1, "a", "v1")); !errors.Is(err, ErrFutureRound) {
+		t.Errorf("Expected vote for a far round to be rejected, got %v", err)
+	}
+	if err := cs.HandleProposal(signedProposal(1, 1000, "v1", "far")); !errors.Is(err, ErrFutureRound) {
+		t.Errorf("Expected proposal for a far round to be rejected, got %v", err)
+	}
+	if err := cs.HandleVote(signedVote(gossip.StatePrevote, 1, MaxRoundsAhead, "a", "v2")); err != nil {
+		t.Errorf("Expected vote within the round window to be accepted, got %v", err)
+	}
+	if len(cs.rounds) != 2 {
+		t.Errorf("Expected only rounds within the window to be tracked, got %d", len(cs.rounds))
+	}
+}
+
+// signedProposal возвращает предложение нового блока, подписанное пропосером
+func signedProposal(height, round int64, proposer, tag string) *Proposal {
+	p := &Proposal{Height: height, Round: round, POLRound: -1, Proposer: proposer, Block: testBlock(height, proposer, tag)}
+	p.Signature, _ = consensustest.Signer(proposer).Sign(p.SignBytes())
+	return p
+}
+
+// TestConsensus_ReportsDoubleSigning - два разных голоса или предложения
+// валидатора в раунде превращаются в проверяемые доказательства
+func TestConsensus_ReportsDoubleSigning(t *testing.T) {
+	clock := NewSimClock(simStart)
+	validators := consensustest.Validators(4)
+	backend := &testBackend{address: "v0", validators: validators, clock: clock}
+	cs := NewConsensusState("v0", consensustest.Signer("v0"), backend, clock, nil)
+	cs.Start(1)
+
+	cs.HandleVote(signedVote(gossip.StatePrecommit, 1, 0, "a", "v2"))
+	cs.HandleVote(signedVote(gossip.StatePrecommit, 1, 0, "a", "v2"))
+	cs.HandleVote(signedVote(gossip.StatePrecommit, 1, 0, "b", "v2"))
+
+	// Пропосер раунда 0 высоты 1 — v1
+	cs.HandleProposal(signedProposal(1, 0, "v1", "a"))
+	cs.HandleProposal(signedProposal(1, 0, "v1", "b"))
+
+	if len(backend.evidence) != 2 {
+		t.Fatalf("Expected 2 evidence items, got %d", len(backend.evidence))
+	}
+	for i, want := range []struct {
+		evType    blockchain.EvidenceType
+		validator string
+	}{{blockchain.DuplicateVote, "v2"}, {blockchain.ConflictingProposal, "v1"}} {
+		e := backend.evidence[i]
+		if e.Type != want.evType || e.Validator != want.validator || e.Height != 1 || e.Round != 0 {
+			t.Errorf("Unexpected evidence %s against %s at %d/%d", e.Type, e.Validator, e.Height, e.Round)
+		}
+		if err := evidence.Verify(validators, e); err != nil {
+			t.Errorf("Reported %s evidence failed verification: %v", e.Type, err)
+		}
+	}
+}
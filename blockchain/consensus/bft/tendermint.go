@@ -2,277 +2,370 @@ package bft
 
 import (
 	"fmt"
-	"time"
+	"sync"
+	"sync/atomic"
 
+	"blockchain/consensus"
+	"blockchain/consensus/evidence"
 	"blockchain/consensus/pos"
 	"blockchain/crypto/signature"
-	"blockchain/governance/reputation"
+	"blockchain/network/blocksync"
 	"blockchain/network/gossip"
+	"blockchain/network/p2p"
 	"blockchain/network/peer"
 	"blockchain/storage/blockchain"
+	"blockchain/storage/state"
 	"blockchain/storage/txpool"
 )
 
-// BFTNode — узел, участвующий в консенсусе Tendermint
+// BFTNode — узел, участвующий в консенсусе Tendermint. Узел реализует
+// Backend для конечного автомата Consensus: собирает блоки из пула,
+// проверяет и фиксирует их через StateMachine, рассылает сообщения пирам.
+// О зафиксированных блоках узел сообщает обработчикам OnFinalized.
 type BFTNode struct {
+	consensus.Events
+
 	ID            string
 	Address       string
 	Validator     *pos.Validator
-	ValidatorPool pos.ValidatorPool
+	ValidatorPool pos.ValidatorPool // набор по умолчанию, пока в состоянии нет валидаторов
 	Peers         []string
-	Height        int64
-	Round         int64
-	State         gossip.MessageType
 	TxPool        *txpool.TransactionPool
 	Chain         *blockchain.Blockchain
+	StateMachine  *state.StateMachine
 	Signer        signature.Signer
-	CurrentRound  *Round
+	Consensus     *ConsensusState
+	Evidence      *evidence.Pool
+	Sync          *blocksync.Reactor
+	Transport     *p2p.Transport
+
+	sets    map[int64]pos.ValidatorPool // наборы валидаторов по высотам
+	setsMu  sync.Mutex
+	syncing atomic.Bool
+	stopped atomic.Bool
 }
 
-// NewBFTNode создаёт новый экземпляр BFTNode
+// NewBFTNode создаёт новый экземпляр BFTNode.
+// config — таймауты консенсуса (по умолчанию DefaultConfig).
 func NewBFTNode(
 	id string,
 	validator *pos.Validator,
 	validatorPool pos.ValidatorPool,
 	txPool *txpool.TransactionPool,
-	chain *blockchain.Blockchain,
+	stateMachine *state.StateMachine,
 	signer signature.Signer,
 	address string,
 	peers []string,
+	config ...*Config,
 ) *BFTNode {
-	return &BFTNode{
+	n := &BFTNode{
 		ID:            id,
 		Address:       address,
 		Validator:     validator,
 		ValidatorPool: validatorPool,
 		Peers:         peers,
-		Height:        0,
-		Round:         0,
-		State:         gossip.StatePropose,
 		TxPool:        txPool,
-		Chain:         chain,
+		Chain:         stateMachine.Chain,
+		StateMachine:  stateMachine,
 		Signer:        signer,
-		CurrentRound:  NewRound(0, 0, ""),
+		Transport:     p2p.Shared(address, nil),
+		sets:          make(map[int64]pos.ValidatorPool),
+	}
+	var cfg *Config
+	if len(config) > 0 {
+		cfg = config[0]
 	}
+	// Новый набор эпохи запоминается сразу после фиксации блока, завершившего её
+	stateMachine.OnValidatorSetChange(n.setValidators)
+	stateMachine.SetCommitVerifier(VerifyCommit)
+	n.Consensus = NewConsensusState(address, signer, n, nil, cfg)
+	evidenceConfig := evidence.DefaultConfig()
+	evidenceConfig.MaxAge = stateMachine.StakingConfig().EvidenceMaxAge
+	n.Evidence = evidence.NewPool(n.Validators, evidenceConfig)
+	n.Sync = blocksync.NewReactor(n, nil)
+	// Доказательства, уже включённые в недавние блоки, повторно не принимаются
+	height := n.Chain.Height()
+	for h := max(1, height-n.Evidence.Config().MaxAge); h <= height; h++ {
+		if block := n.Chain.GetBlockByHeight(h); block != nil {
+			n.Evidence.Update(block)
+		}
+	}
+	return n
 }
 
-// Start запускает цикл консенсуса
+// Start запускает приём сообщений, догоняет пиров и начинает консенсус
+// со следующей высоты цепочки. Остановленный узел можно запустить снова.
 func (n *BFTNode) Start() {
-	go StartTCPServer(n)
-
-	ticker := time.NewTicker(10 * time.Second)
-	for range ticker.C {
-		n.RunConsensusRound()
-		n.Height++
+	if err := StartTCPServer(n); err != nil {
+		fmt.Printf("❌ Failed to start TCP server on %s: %v\n", n.Address, err)
 	}
+	n.stopped.Store(false)
+	n.syncing.Store(true)
+	n.syncBlocks()
+	n.syncing.Store(false)
+	n.Consensus.Start(n.Chain.Height() + 1)
 }
 
-// RunConsensusRound реализует полный раунд Tendermint-подобного консенсуса
-func (n *BFTNode) RunConsensusRound() {
-	// 1. Выбор пропосера
-	proposer := n.ValidatorPool.Select()
-	if proposer == nil {
-		fmt.Println("❌ No proposer selected")
+// Stop останавливает консенсус; синхронизация блоков его больше не
+// возобновляет, а сервер продолжает отвечать на запросы пиров
+func (n *BFTNode) Stop() {
+	n.stopped.Store(true)
+	n.Consensus.Stop()
+}
+
+// CatchUp догоняет пиров, если узел отстал (например, пропустил раунды):
+// консенсус на устаревшей высоте останавливается и продолжается со
+// следующей после новой вершины высоты. Остановленный узел и повторный
+// вызов во время синхронизации ничего не делают.
+func (n *BFTNode) CatchUp() {
+	if n.stopped.Load() || !n.syncing.CompareAndSwap(false, true) {
 		return
 	}
-
-	repModule := reputation.NewReputationSystem()
-
-	// Обновляем репутацию перед выбором
-	for _, v := range n.ValidatorPool {
-		repModule.UpdateReputation(v.Address, 1.0)
+	defer n.syncing.Store(false)
+	before := n.Chain.Height()
+	if height := n.syncBlocks(); height > before && !n.stopped.Load() {
+		n.Consensus.Start(height + 1)
 	}
+}
 
-	repScore := repModule.CalculateScore(proposer.Address, true)
-	if repScore < 50 {
-		fmt.Println("⚠️ Validator has low reputation, skipping")
-		return
+// syncBlocks синхронизирует блоки с пирами и возвращает высоту вершины
+func (n *BFTNode) syncBlocks() int64 {
+	timeout := n.Sync.Config().RequestTimeout
+	var peers []blocksync.Peer
+	for _, addr := range n.Peers {
+		if addr != n.Address {
+			peers = append(peers, blocksync.NewTCPPeer(n.Transport, addr, timeout))
+		}
 	}
+	height, err := n.Sync.Sync(peers)
+	if err != nil {
+		fmt.Printf("⚠️ Block sync stopped at height %d: %v\n", height, err)
+	}
+	return height
+}
 
-	// Инициализируем раунд
-	round := NewRound(n.Height, n.Round, proposer.Address)
-	n.CurrentRound = round
-
-	fmt.Printf("🚀 Starting round %d for height %d. Proposer: %s\n", n.Round, n.Height, proposer.Address)
+// Status возвращает вершину цепочки узла для синхронизации блоков
+func (n *BFTNode) Status() *blocksync.Status {
+	return blocksync.ChainStatus(n.Chain)
+}
 
-	// 2. Propose (только если мы — пропосер)
-	if proposer.Address == n.Address {
-		if err := n.proposeBlock(round); err != nil {
-			fmt.Printf("❌ Failed to propose block: %v\n", err)
-			repModule.UpdateReputation(n.Address, -10) // Снижаем репутацию
-			return
-		}
-		repModule.UpdateReputation(n.Address, 10) // Повышаем за успешное предложение
-	} else {
-		fmt.Printf("📬 Node is not proposer, waiting for proposal from %s\n", proposer.Address)
+// SyncBlock проверяет блок, полученный при синхронизации: сертификат
+// финальности набора валидаторов его высоты, заголовок, переход состояния —
+// и фиксирует блок. Консенсус на пройденной высоте останавливается до
+// конца синхронизации.
+func (n *BFTNode) SyncBlock(block *blockchain.Block) error {
+	if block.Commit != nil && (block.Commit.Height != block.Index || block.Commit.BlockHash != block.Hash) {
+		return fmt.Errorf("%w: commit for %s at %d does not match block %s at %d",
+			ErrInvalidCommit, block.Commit.BlockHash, block.Commit.Height, block.Hash, block.Index)
+	}
+	if err := VerifyCommit(n.Validators(block.Index), block.Commit); err != nil {
+		return err
 	}
+	if err := n.ValidateBlock(block); err != nil {
+		return err
+	}
+	if err := n.CommitBlock(block, block.Commit); err != nil {
+		return err
+	}
+	n.Consensus.Stop()
+	return nil
+}
 
-	// Уменьшаем задержки для улучшения времени подтверждения транзакций
-	time.Sleep(500 * time.Millisecond) // Сокращено с 1 секунды
+// Validators возвращает валидаторов высоты. Набор эпохи берётся из
+// состояния стейкинга после предыдущего блока и запоминается, пока
+// доказательства нарушений на этой высоте принимаются. Для высот, набор
+// которых не запомнен (например, до перезапуска узла), используется
+// текущий набор. Пока в состоянии нет валидаторов, используется ValidatorPool.
+func (n *BFTNode) Validators(height int64) pos.ValidatorPool {
+	n.setsMu.Lock()
+	defer n.setsMu.Unlock()
+	if set, ok := n.sets[height]; ok {
+		return set
+	}
+	set := n.StateMachine.Validators()
+	if len(set) == 0 {
+		set = n.ValidatorPool
+	}
+	if height == n.Chain.Height()+1 {
+		n.sets[height] = set
+	}
+	return set
+}
 
-	// 3. Prevote
-	if err := n.signAndBroadcast(round, gossip.StatePrevote); err != nil {
-		fmt.Printf("❌ Failed to sign prevote: %v\n", err)
-		repModule.UpdateReputation(n.Address, -5)
+// setValidators запоминает набор, действующий с высоты height
+func (n *BFTNode) setValidators(height int64, validators pos.ValidatorPool) {
+	if len(validators) == 0 {
 		return
 	}
+	n.setsMu.Lock()
+	defer n.setsMu.Unlock()
+	n.sets[height] = validators
+}
 
-	// Уменьшаем задержки для улучшения времени подтверждения транзакций
-	time.Sleep(1 * time.Second) // Сокращено с 3 секунд
+// pruneValidators забывает наборы высот, доказательства которых устарели
+func (n *BFTNode) pruneValidators(height int64) {
+	n.setsMu.Lock()
+	defer n.setsMu.Unlock()
+	for h := range n.sets {
+		if h+n.Evidence.Config().MaxAge < height {
+			delete(n.sets, h)
+		}
+	}
+}
 
-	// 4. Precommit
-	if err := n.signAndBroadcast(round, gossip.StatePrecommit); err != nil {
-		fmt.Printf("❌ Failed to sign precommit: %v\n", err)
-		repModule.UpdateReputation(n.Address, -5)
-		return
+// Proposer выбирает пропосера взвешенной по стейку выборкой, которая
+// зависит только от набора валидаторов, хэша предыдущего блока, высоты и
+// раунда (см. pos.ProposerIndex): все узлы получают одного и того же
+// пропосера, а исключённые за нарушения валидаторы блоки не предлагают
+func (n *BFTNode) Proposer(height, round int64) string {
+	prev := n.Chain.GetBlockByHeight(height - 1)
+	if prev == nil {
+		return ""
 	}
+	if v := n.Validators(height).Proposer(prev.Hash, height, round); v != nil {
+		return v.Address
+	}
+	return ""
+}
 
-	// Уменьшаем задержки для улучшения времени подтверждения транзакций
-	time.Sleep(500 * time.Millisecond) // Сокращено с 1 секунды
+// HasPendingTxs сообщает, есть ли в пуле исполнимые транзакции
+func (n *BFTNode) HasPendingTxs() bool {
+	return len(n.TxPool.Pending()) > 0
+}
 
-	// 5. Commit
-	if HasQuorum(round.Precommits, len(n.ValidatorPool)) {
-		if round.ProposedBlock != nil {
-			if err := n.processCommittedBlock(round.ProposedBlock); err != nil {
-				fmt.Printf("❌ Failed to process committed block: %v\n", err)
-				repModule.UpdateReputation(n.Address, -10)
-				return
-			}
-			repModule.UpdateReputation(n.Address, 10) // Повышение за успешный коммит
-		} else {
-			fmt.Println("❌ ProposedBlock is nil — cannot commit")
-		}
-	} else {
-		fmt.Println("❌ Not enough precommits to commit")
+// ProposeBlock собирает блок из пула и подписывает его
+func (n *BFTNode) ProposeBlock(height int64) (*blockchain.Block, error) {
+	if next := n.Chain.Height() + 1; height != next {
+		return nil, fmt.Errorf("chain expects height %d, not %d", next, height)
 	}
-}
 
-func (n *BFTNode) proposeBlock(round *Round) error {
-	transactions := n.TxPool.GetTransactions(100)
+	transactions := n.TxPool.GetTransactions(n.Chain.Fees().MaxTxsPerBlock)
 	if len(transactions) == 0 {
-		return fmt.Errorf("no transactions to propose")
+		return nil, fmt.Errorf("no transactions to propose")
 	}
 
 	var validTxs []*txpool.Transaction
 	for _, tx := range transactions {
-		if tx.Verify() {
+		if tx.Verify(n.StateMachine.ChainID()) {
 			validTxs = append(validTxs, tx)
 		} else {
 			fmt.Printf("❌ Invalid transaction: %s\n", tx.ID)
 		}
 	}
 
-	if len(validTxs) == 0 {
-		return fmt.Errorf("no valid transactions to propose")
+	// Оставляем только транзакции, проходящие проверку баланса и nonce
+	block, rejected := n.StateMachine.BuildBlock(validTxs, n.Address, n.Evidence.Pending()...)
+	for _, tx := range rejected {
+		n.TxPool.RemoveTransaction(tx.ID)
+	}
+	if block == nil {
+		return nil, fmt.Errorf("no valid transactions to propose")
 	}
-
-	prevBlock := n.Chain.GetLatestBlock()
-	block := blockchain.NewBlock(
-		prevBlock.Index+1,
-		prevBlock.Hash,
-		validTxs,
-		n.Address,
-	)
 
 	signatureBytes, err := n.Signer.Sign(block.SerializeWithoutSignature())
 	if err != nil {
-		return fmt.Errorf("failed to sign block: %w", err)
+		return nil, fmt.Errorf("failed to sign block: %w", err)
 	}
 	block.Signature = signatureBytes
-
-	round.ProposedBlock = block.Serialize()
-	round.Step = gossip.StatePropose
-
-	n.BroadcastSignedMessage(gossip.StatePropose, block.Serialize(), block.Signature)
-	fmt.Printf("✅ Proposed block %s with %d transactions\n", block.Hash, len(validTxs))
-
-	return nil
+	return block, nil
 }
 
-func (n *BFTNode) signAndBroadcast(round *Round, msgType gossip.MessageType) error {
-	data := []byte(fmt.Sprintf("%s:%d:%d", msgType, n.Height, n.Round))
-	sig, err := n.Signer.Sign(data)
-	if err != nil {
+// ValidateBlock проверяет заголовок, подпись пропосера, переход состояния
+// (вместе с доказательствами нарушений, см. state.ApplyBlock) и сертификат
+// финальности предыдущего блока
+func (n *BFTNode) ValidateBlock(block *blockchain.Block) error {
+	if err := n.StateMachine.VerifyBlock(block); err != nil {
 		return err
 	}
+	return verifyLastCommit(n.Validators(block.Index-1), n.Chain.GetLatestBlock(), block)
+}
 
-	switch msgType {
-	case gossip.StatePrevote:
-		round.Prevotes[n.Address] = sig
-	case gossip.StatePrecommit:
-		round.Precommits[n.Address] = sig
-	}
-
-	n.BroadcastSignedMessage(msgType, data, sig)
-	fmt.Printf("🗳 %s from %s\n", msgType, n.Address)
+// BroadcastProposal рассылает предложение, подписанное конечным автоматом
+func (n *BFTNode) BroadcastProposal(p *Proposal) {
+	n.BroadcastSignedMessage(gossip.StatePropose, p.Height, p.Round, p.Encode(), p.Signature)
+}
 
-	return nil
+// BroadcastVote рассылает голос, подписанный конечным автоматом
+func (n *BFTNode) BroadcastVote(v *Vote) {
+	n.BroadcastSignedMessage(v.Type, v.Height, v.Round, v.SignBytes(), v.Signature)
 }
 
-func (n *BFTNode) processCommittedBlock(blockData []byte) error {
-	block := &blockchain.Block{}
-	if err := block.Deserialize(blockData); err != nil {
-		return fmt.Errorf("failed to deserialize block: %w", err)
+// ReportEvidence добавляет доказательство в пул и рассылает его пирам
+func (n *BFTNode) ReportEvidence(e *blockchain.Evidence) {
+	added, err := n.Evidence.Add(e)
+	if err != nil {
+		fmt.Printf("❌ Rejected evidence against %s: %v\n", e.Validator, err)
+		return
 	}
-
-	pubKey, err := signature.GetPublicKey(block.Validator)
+	if !added {
+		return
+	}
+	data := e.Encode()
+	sig, err := n.Signer.Sign(data)
 	if err != nil {
-		return fmt.Errorf("validator %s has no public key: %w", block.Validator, err)
+		fmt.Printf("❌ Failed to sign evidence: %v\n", err)
+		return
 	}
+	n.BroadcastSignedMessage(gossip.MsgEvidence, e.Height, e.Round, data, sig)
+}
 
-	if !signature.Verify(pubKey, block.SerializeWithoutSignature(), block.Signature) {
-		return fmt.Errorf("invalid block signature")
+// CommitBlock сохраняет решённый блок вместе с сертификатом и очищает пул.
+// Надбавки валидатору и наказания нарушителей применяются в состоянии.
+func (n *BFTNode) CommitBlock(block *blockchain.Block, commit *blockchain.Commit) error {
+	block.Commit = commit
+	status, err := n.StateMachine.ImportBlock(block)
+	if err != nil {
+		return fmt.Errorf("failed to apply block: %w", err)
 	}
 
-	n.Chain.AddBlock(block)
-	fmt.Printf("✅ Block added to chain: %s\n", block.Hash)
-
-	// Рассчитываем общую комиссию за транзакции
-	var totalFee float64
-	for _, tx := range block.Transactions {
-		totalFee += tx.Fee
-
-		// Удаляем транзакцию из пула
-		n.TxPool.RemoveTransaction(tx.ID)
-		fmt.Printf("🗑️ Removed transaction: %s\n", tx.ID)
+	txIDs := make([]string, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		txIDs[i] = tx.ID
 	}
-
-	// Добавляем комиссию валидатору, создавшему блок
-	for _, v := range n.ValidatorPool {
-		if v.Address == block.Validator {
-			// Блок создан успешно, увеличиваем баланс валидатора на сумму комиссий
-			v.Balance += int64(totalFee)
-			v.CommissionEarned += int64(totalFee)
-			fmt.Printf("💸 Validator %s earned %.2f fees\n", v.Address, totalFee)
-			break
+	n.TxPool.RemoveTransactions(txIDs)
+	n.Evidence.Update(block)
+	n.pruneValidators(block.Index)
+
+	// Несколько узлов одного процесса разделяют StateMachine: блок уже
+	// импортирован другим узлом
+	if status != state.ImportCanonical {
+		return nil
+	}
+	fmt.Printf("✅ Block added to chain: %s\n", block.Hash)
+	defer n.Finalize(block)
+
+	for _, e := range block.Evidence {
+		fmt.Printf("⚔️ Validator %s slashed and jailed for %s at height %d\n", e.Validator, e.Type, e.Height)
+		// Набор по умолчанию не выводится из состояния — исключаем нарушителя в нём
+		for _, v := range n.ValidatorPool {
+			if v.Address == e.Validator {
+				v.Jail()
+			}
 		}
 	}
-
-	commitSig, err := n.Signer.Sign(block.SerializeWithoutSignature())
-	if err != nil {
-		return fmt.Errorf("failed to sign commit: %w", err)
+	if tips := block.TotalTips(); tips > 0 {
+		fmt.Printf("💸 Validator %s earned %.2f fees\n", block.Validator, tips)
 	}
-
-	n.BroadcastSignedMessage(gossip.StateCommit, block.SerializeWithoutSignature(), commitSig)
-	fmt.Printf("✅ Block committed: %s\n", block.Hash)
-
 	return nil
 }
 
-func (n *BFTNode) BroadcastSignedMessage(msgType gossip.MessageType, data, signature []byte) {
+func (n *BFTNode) BroadcastSignedMessage(msgType gossip.MessageType, height, round int64, data, signature []byte) {
 	// Конвертируем []string в []*peer.Peer
-	peers := make([]*peer.Peer, len(n.Peers))
-	for i, addr := range n.Peers {
-		peers[i] = &peer.Peer{
+	peers := make([]*peer.Peer, 0, len(n.Peers))
+	for _, addr := range n.Peers {
+		if addr == n.Address {
+			continue
+		}
+		peers = append(peers, &peer.Peer{
 			Addr: addr,
 			ID:   addr,
-		}
+		})
 	}
 
-	gossip.BroadcastSignedConsensusMessage(peers, &gossip.SignedConsensusMessage{
+	gossip.BroadcastSignedConsensusMessage(n.Transport, peers, &gossip.SignedConsensusMessage{
 		Type:      msgType,
-		Height:    n.Height,
-		Round:     n.Round,
+		Height:    height,
+		Round:     round,
 		From:      n.Address,
 		Data:      data,
 		Signature: signature,
@@ -0,0 +1,117 @@
+package bft
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"blockchain/consensus/consensustest"
+	"blockchain/network/blocksync"
+	"blockchain/network/gossip"
+	"blockchain/storage/blockchain"
+	"blockchain/storage/state"
+	"blockchain/storage/txpool"
+)
+
+func syncGenesis() *state.Genesis {
+	genesis := &state.Genesis{Alloc: map[string]float64{"alice": 100}}
+	for _, v := range consensustest.Validators(4) {
+		genesis.Validators = append(genesis.Validators, state.GenesisValidator{Address: v.Address, SelfBond: 1000})
+	}
+	return genesis
+}
+
+// commitTestBlock собирает блок высоты height с переводом alice и фиксирует
+// его с сертификатом из precommit v0..v2
+func commitTestBlock(t *testing.T, machine *state.StateMachine, height int64) {
+	t.Helper()
+	tx := &txpool.Transaction{From: "alice", To: "bob", Amount: 1, Fee: 0.01, Nonce: uint64(height - 1), ChainID: txpool.DefaultChainID}
+	tx.ID = tx.ComputeID()
+	sig, _ := consensustest.Signer("alice").Sign(tx.Serialize())
+	tx.Signature = hex.EncodeToString(sig)
+	block, _ := machine.BuildBlock([]*txpool.Transaction{tx}, "v0")
+	if block == nil {
+		t.Fatalf("Failed to build block %d", height)
+	}
+	block.Signature, _ = consensustest.Signer("v0").Sign(block.SerializeWithoutSignature())
+	block.Commit = &blockchain.Commit{Height: height, BlockHash: block.Hash}
+	for _, addr := range []string{"v0", "v1", "v2"} {
+		v := signedVote(gossip.StatePrecommit, height, 0, block.Hash, addr)
+		block.Commit.Signatures = append(block.Commit.Signatures, blockchain.CommitSig{
+			ValidatorIndex: v.ValidatorIndex, Validator: v.Validator, Timestamp: v.Timestamp, Signature: v.Signature,
+		})
+	}
+	if err := machine.CommitBlock(block); err != nil {
+		t.Fatalf("Failed to commit block %d: %v", height, err)
+	}
+}
+
+// chainPeer отвечает на запросы синхронизации из цепочки узла так же, как
+// TCP-сервер BFT; weakFrom > 0 — в блоках с этой высоты сертификат
+// урезан до подписей без кворума
+type chainPeer struct {
+	id       string
+	chain    *blockchain.Blockchain
+	weakFrom int64
+}
+
+func (p *chainPeer) ID() string { return p.id }
+
+func (p *chainPeer) Status() (*blocksync.Status, error) {
+	data, err := blocksync.Respond(p.chain, &gossip.SignedConsensusMessage{Type: gossip.MsgStatus})
+	if err != nil {
+		return nil, err
+	}
+	return blocksync.DecodeStatus(data)
+}
+
+func (p *chainPeer) Blocks(from, to int64) ([]*blockchain.Block, error) {
+	request := (&blocksync.BlockRequest{From: from, To: to}).Encode()
+	data, err := blocksync.Respond(p.chain, &gossip.SignedConsensusMessage{Type: gossip.MsgRequest, Data: request})
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := blocksync.DecodeBlocks(data)
+	for _, b := range blocks {
+		if p.weakFrom > 0 && b.Index >= p.weakFrom {
+			b.Commit.Signatures = b.Commit.Signatures[:2]
+		}
+	}
+	return blocks, err
+}
+
+// TestBFTNode_SyncBlocks - новый узел догоняет цепочку по блокам с
+// сертификатами; блоки с сертификатом без кворума отклоняются
+func TestBFTNode_SyncBlocks(t *testing.T) {
+	source, err := state.NewStateMachine(blockchain.NewBlockchain(), syncGenesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source.SetCommitVerifier(VerifyCommit)
+	for h := int64(1); h <= 5; h++ {
+		commitTestBlock(t, source, h)
+	}
+
+	machine, err := state.NewStateMachine(blockchain.NewBlockchain(), syncGenesis())
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := NewBFTNode("late", nil, nil, txpool.NewTransactionPool(), machine, consensustest.Signer("late"), "late", nil)
+
+	weak, _ := (&chainPeer{chain: source.Chain, weakFrom: 1}).Blocks(1, 1)
+	if err := node.SyncBlock(weak[0]); !errors.Is(err, ErrInvalidCommit) {
+		t.Fatalf("Expected ErrInvalidCommit for a block without quorum, got %v", err)
+	}
+
+	peers := []blocksync.Peer{
+		&chainPeer{id: "forger", chain: source.Chain, weakFrom: 3},
+		&chainPeer{id: "honest", chain: source.Chain},
+	}
+	height, err := node.Sync.Sync(peers)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if height != 5 || machine.Root() != source.Root() || node.Status().Head != source.Chain.GetLatestBlock().Hash {
+		t.Errorf("Expected node to catch up to height 5 with the same state, got height %d", height)
+	}
+}
@@ -1,6 +1,12 @@
 package bft
 
-func HasQuorum(votes map[string][]byte, totalValidators int) bool {
-	required := totalValidators*2/3 + 1
-	return len(votes) >= required
+// HasQuorum проверяет, что power составляет больше 2/3 мощности totalPower
+func HasQuorum(power, totalPower int64) bool {
+	return power*3 > totalPower*2
+}
+
+// hasOneThird проверяет, что power составляет больше 1/3 мощности: среди
+// проголосовавших есть хотя бы один честный валидатор
+func hasOneThird(power, totalPower int64) bool {
+	return power*3 > totalPower
 }
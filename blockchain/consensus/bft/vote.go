@@ -0,0 +1,182 @@
+package bft
+
+// голоса консенсуса и их подсчёт по мощности валидаторов
+
+import (
+	"errors"
+	"fmt"
+
+	"blockchain/consensus/pos"
+	"blockchain/crypto/signature"
+	"blockchain/network/gossip"
+)
+
+var ErrInvalidVoteSignature = errors.New("invalid vote signature")
+
+// Vote — голос prevote или precommit за блок BlockHash ("" — голос nil).
+// Подписываются тип, высота, раунд, хэш блока, индекс валидатора в наборе
+// высоты и время голоса; адрес валидатора определяется по индексу.
+type Vote struct {
+	Type           gossip.MessageType
+	Height         int64
+	Round          int64
+	BlockHash      string
+	ValidatorIndex int
+	Validator      string
+	Timestamp      int64
+	Signature      []byte
+}
+
+// SignBytes возвращает канонические подписываемые данные голоса
+func (v *Vote) SignBytes() []byte {
+	return gossip.VoteSignBytes(v.Type, v.Height, v.Round, v.BlockHash, v.ValidatorIndex, v.Timestamp)
+}
+
+// Verify проверяет, что голос подписан валидатором с индексом ValidatorIndex
+// из набора validators
+func (v *Vote) Verify(validators pos.ValidatorPool) error {
+	if v.ValidatorIndex < 0 || v.ValidatorIndex >= len(validators) {
+		return fmt.Errorf("%w: index %d of %d", ErrUnknownValidator, v.ValidatorIndex, len(validators))
+	}
+	if addr := validators[v.ValidatorIndex].Address; addr != v.Validator {
+		return fmt.Errorf("%w: index %d belongs to %s, not %s", ErrUnknownValidator, v.ValidatorIndex, addr, v.Validator)
+	}
+	pubKey, err := signature.GetPublicKey(v.Validator)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidVoteSignature, err)
+	}
+	if len(v.Signature) == 0 || !signature.Verify(pubKey, v.SignBytes(), v.Signature) {
+		return fmt.Errorf("%w: %s %s at %d/%d", ErrInvalidVoteSignature, v.Validator, v.Type, v.Height, v.Round)
+	}
+	return nil
+}
+
+// VoteFromMessage восстанавливает голос из подписанного сообщения
+func VoteFromMessage(msg *gossip.SignedConsensusMessage) (*Vote, error) {
+	data, err := gossip.DecodeVoteSignBytes(msg.Data)
+	if err != nil {
+		return nil, err
+	}
+	v := &Vote{
+		Type:           data.Type,
+		Height:         data.Height,
+		Round:          data.Round,
+		BlockHash:      data.BlockHash,
+		ValidatorIndex: data.ValidatorIndex,
+		Timestamp:      data.Timestamp,
+		Validator:      msg.From,
+		Signature:      msg.Signature,
+	}
+	if v.Type != msg.Type || v.Height != msg.Height || v.Round != msg.Round {
+		return nil, fmt.Errorf("vote %s %d/%d does not match envelope %s %d/%d",
+			v.Type, v.Height, v.Round, msg.Type, msg.Height, msg.Round)
+	}
+	return v, nil
+}
+
+// VoteSet — голоса одного типа за раунд высоты. Голоса учитываются по
+// мощности валидаторов (VotingPower), зафиксированной при создании набора.
+type VoteSet struct {
+	Height int64
+	Round  int64
+	Type   gossip.MessageType
+
+	validators pos.ValidatorPool
+	powers     []int64
+	votes      []*Vote
+	totalPower int64
+	votedPower int64
+	blockPower map[string]int64
+}
+
+// NewVoteSet создаёт пустой набор голосов
+func NewVoteSet(height, round int64, voteType gossip.MessageType, validators pos.ValidatorPool) *VoteSet {
+	powers := make([]int64, len(validators))
+	var total int64
+	for i, v := range validators {
+		powers[i] = v.VotingPower()
+		total += powers[i]
+	}
+	return &VoteSet{
+		Height:     height,
+		Round:      round,
+		Type:       voteType,
+		validators: validators,
+		powers:     powers,
+		votes:      make([]*Vote, len(validators)),
+		totalPower: total,
+		blockPower: make(map[string]int64),
+	}
+}
+
+// AddVote проверяет подпись голоса и добавляет его. Повтор того же голоса
+// не меняет набор, другой голос того же валидатора — ErrConflictingVote.
+func (vs *VoteSet) AddVote(v *Vote) error {
+	if v == nil || v.Type != vs.Type || v.Height != vs.Height || v.Round != vs.Round {
+		return fmt.Errorf("%w: expected %s at %d/%d", ErrInvalidVote, vs.Type, vs.Height, vs.Round)
+	}
+	if err := v.Verify(vs.validators); err != nil {
+		return err
+	}
+	return vs.add(v)
+}
+
+// add добавляет голос с уже проверенной подписью
+func (vs *VoteSet) add(v *Vote) error {
+	if existing := vs.votes[v.ValidatorIndex]; existing != nil {
+		if existing.BlockHash != v.BlockHash {
+			return fmt.Errorf("%w: %s %s at %d/%d", ErrConflictingVote, v.Validator, v.Type, v.Height, v.Round)
+		}
+		return nil
+	}
+
+	power := vs.powers[v.ValidatorIndex]
+	vs.votes[v.ValidatorIndex] = v
+	vs.votedPower += power
+	vs.blockPower[v.BlockHash] += power
+	return nil
+}
+
+// HasTwoThirdsFor сообщает, набрал ли блок blockHash ("" — nil) больше 2/3 мощности
+func (vs *VoteSet) HasTwoThirdsFor(blockHash string) bool {
+	return HasQuorum(vs.blockPower[blockHash], vs.totalPower)
+}
+
+// HasTwoThirdsAny сообщает, проголосовали ли (за что угодно) больше 2/3 мощности
+func (vs *VoteSet) HasTwoThirdsAny() bool {
+	return HasQuorum(vs.votedPower, vs.totalPower)
+}
+
+// TwoThirdsMajority возвращает блок, набравший больше 2/3 мощности
+func (vs *VoteSet) TwoThirdsMajority() (string, bool) {
+	for hash, power := range vs.blockPower {
+		if HasQuorum(power, vs.totalPower) {
+			return hash, true
+		}
+	}
+	return "", false
+}
+
+// Power возвращает мощность, поданную за блок blockHash
+func (vs *VoteSet) Power(blockHash string) int64 {
+	return vs.blockPower[blockHash]
+}
+
+// Get возвращает голос валидатора с индексом index
+func (vs *VoteSet) Get(index int) *Vote {
+	if index < 0 || index >= len(vs.votes) {
+		return nil
+	}
+	return vs.votes[index]
+}
+
+// Votes возвращает полученные голоса в порядке индексов валидаторов
+func (vs *VoteSet) Votes() []*Vote {
+	var votes []*Vote
+	for _, v := range vs.votes {
+		if v != nil {
+			votes = append(votes, v)
+		}
+	}
+	return votes
+}
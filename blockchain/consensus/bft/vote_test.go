@@ -0,0 +1,102 @@
+package bft
+
+import (
+	"errors"
+	"testing"
+
+	"blockchain/consensus/consensustest"
+	"blockchain/consensus/pos"
+	"blockchain/network/gossip"
+)
+
+// TestVoteSet_WeightedByPower - кворум считается по мощности, а не по числу валидаторов
+func TestVoteSet_WeightedByPower(t *testing.T) {
+	validators := consensustest.Validators(4)
+	for i, power := range []int64{50, 20, 20, 10} {
+		validators[i].Balance = power
+	}
+
+	// Три валидатора из четырёх, но только половина мощности
+	minority := NewVoteSet(1, 0, gossip.StatePrevote, validators)
+	for _, addr := range []string{"v1", "v2", "v3"} {
+		if err := minority.AddVote(signedVote(gossip.StatePrevote, 1, 0, "block", addr)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if minority.HasTwoThirdsFor("block") || minority.HasTwoThirdsAny() {
+		t.Errorf("50 of 100 must not be a quorum, got power %d", minority.Power("block"))
+	}
+
+	// Два валидатора, но 70% мощности
+	majority := NewVoteSet(1, 0, gossip.StatePrevote, validators)
+	for _, addr := range []string{"v0", "v1"} {
+		majority.AddVote(signedVote(gossip.StatePrevote, 1, 0, "block", addr))
+	}
+	if hash, ok := majority.TwoThirdsMajority(); !ok || hash != "block" {
+		t.Errorf("Expected 70 of 100 to be a quorum for block, got %q %v", hash, ok)
+	}
+	if votes := majority.Votes(); len(votes) != 2 || votes[0].Validator != "v0" {
+		t.Errorf("Expected votes in validator order, got %d", len(votes))
+	}
+}
+
+// TestVoteSet_RejectsForgedVotes - голос принимается только с подписью
+// валидатора, которому принадлежит индекс
+func TestVoteSet_RejectsForgedVotes(t *testing.T) {
+	validators := consensustest.Validators(4)
+	vs := NewVoteSet(1, 0, gossip.StatePrecommit, validators)
+
+	// v1 подписывает голос от имени v2
+	forged := signedVote(gossip.StatePrecommit, 1, 0, "block", "v1")
+	forged.ValidatorIndex, forged.Validator = 2, "v2"
+	forged.Signature, _ = consensustest.Signer("v1").Sign(forged.SignBytes())
+	if err := vs.AddVote(forged); !errors.Is(err, ErrInvalidVoteSignature) {
+		t.Errorf("Expected forged signature to be rejected, got %v", err)
+	}
+
+	// Индекс не соответствует адресу
+	mismatched := signedVote(gossip.StatePrecommit, 1, 0, "block", "v1")
+	mismatched.Validator = "v3"
+	if err := vs.AddVote(mismatched); !errors.Is(err, ErrUnknownValidator) {
+		t.Errorf("Expected index/address mismatch to be rejected, got %v", err)
+	}
+
+	// Подпись не покрывает изменённый хэш блока
+	tampered := signedVote(gossip.StatePrecommit, 1, 0, "block", "v1")
+	tampered.BlockHash = "other"
+	if err := vs.AddVote(tampered); !errors.Is(err, ErrInvalidVoteSignature) {
+		t.Errorf("Expected tampered vote to be rejected, got %v", err)
+	}
+
+	if err := vs.AddVote(signedVote(gossip.StatePrevote, 1, 0, "block", "v1")); !errors.Is(err, ErrInvalidVote) {
+		t.Errorf("Expected prevote to be rejected by precommit set, got %v", err)
+	}
+	if len(vs.Votes()) != 0 {
+		t.Errorf("Expected no votes, got %d", len(vs.Votes()))
+	}
+}
+
+// TestVote_WireRoundTrip - голос восстанавливается из сообщения и проходит проверку
+func TestVote_WireRoundTrip(t *testing.T) {
+	validators := pos.ValidatorPool(consensustest.Validators(4))
+	vote := signedVote(gossip.StatePrecommit, 3, 1, "block", "v2")
+	msg := &gossip.SignedConsensusMessage{
+		Type: vote.Type, Height: vote.Height, Round: vote.Round, From: vote.Validator,
+		Data: vote.SignBytes(), Signature: vote.Signature,
+	}
+	encoded, _ := msg.Encode()
+	decodedMsg, err := gossip.DecodeSignedMessage(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := VoteFromMessage(decodedMsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.ValidatorIndex != 2 || decoded.Timestamp != vote.Timestamp || decoded.BlockHash != "block" {
+		t.Errorf("Unexpected decoded vote %+v", decoded)
+	}
+	if err := decoded.Verify(validators); err != nil {
+		t.Errorf("Decoded vote failed verification: %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+// Package consensustest — общие заготовки для тестов консенсуса: ключи
+// валидаторов и модель сети, доставляющая сообщения между автоматами.
+package consensustest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"blockchain/consensus/pos"
+	"blockchain/crypto/signature"
+)
+
+var (
+	signersMu sync.Mutex
+	signers   = make(map[string]signature.Signer)
+)
+
+// Signer возвращает ключ валидатора address, при первом обращении создавая
+// его и регистрируя публичный ключ
+func Signer(address string) signature.Signer {
+	signersMu.Lock()
+	defer signersMu.Unlock()
+	if signer, ok := signers[address]; ok {
+		return signer
+	}
+	signer, err := signature.NewECDSASigner()
+	if err != nil {
+		panic(err)
+	}
+	pubKey, err := signature.ParsePublicKey(signer.PublicKey())
+	if err != nil {
+		panic(err)
+	}
+	signature.RegisterPublicKey(address, pubKey)
+	signers[address] = signer
+	return signer
+}
+
+// Validators возвращает n валидаторов "v0".."vN-1" с равной ставкой и
+// зарегистрированными ключами
+func Validators(n int) pos.ValidatorPool {
+	pool := make(pos.ValidatorPool, n)
+	for i := range pool {
+		pool[i] = pos.NewValidatorWithAddress(fmt.Sprintf("id-%d", i), fmt.Sprintf("v%d", i), 1000)
+		Signer(pool[i].Address)
+	}
+	return pool
+}
+
+// Network доставляет сообщения между автоматами N синхронно и по порядку
+// отправки; узлы из Down не отправляют и не получают сообщений
+type Network[N any] struct {
+	Nodes map[string]N
+	Down  map[string]bool
+
+	queue      []func()
+	delivering bool
+}
+
+// NewNetwork создаёт пустую сеть с отключёнными узлами down
+func NewNetwork[N any](down ...string) *Network[N] {
+	net := &Network[N]{Nodes: make(map[string]N), Down: make(map[string]bool)}
+	for _, addr := range down {
+		net.Down[addr] = true
+	}
+	return net
+}
+
+// Addresses возвращает адреса узлов по возрастанию
+func (net *Network[N]) Addresses() []string {
+	addrs := make([]string, 0, len(net.Nodes))
+	for addr := range net.Nodes {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// Send ставит доставку узлу to в очередь; false, если отправитель или
+// получатель отключён
+func (net *Network[N]) Send(from, to string, deliver func(N)) bool {
+	if net.Down[from] || net.Down[to] {
+		return false
+	}
+	node := net.Nodes[to]
+	net.queue = append(net.queue, func() { deliver(node) })
+	net.run()
+	return true
+}
+
+// Broadcast доставляет сообщение всем узлам, кроме отправителя
+func (net *Network[N]) Broadcast(from string, deliver func(N)) {
+	for _, addr := range net.Addresses() {
+		if addr != from {
+			net.Send(from, addr, deliver)
+		}
+	}
+}
+
+// Hold откладывает доставку, пока выполняется start, например пока все
+// автоматы не запущены, и затем доставляет накопленные сообщения
+func (net *Network[N]) Hold(start func()) {
+	net.delivering = true
+	start()
+	net.delivering = false
+	net.run()
+}
+
+func (net *Network[N]) run() {
+	if net.delivering {
+		return
+	}
+	net.delivering = true
+	for len(net.queue) > 0 {
+		deliver := net.queue[0]
+		net.queue = net.queue[1:]
+		deliver()
+	}
+	net.delivering = false
+}
@@ -0,0 +1,151 @@
+// Package consensus — общий интерфейс движков консенсуса и их реестр.
+package consensus
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"blockchain/consensus/pos"
+	"blockchain/crypto/signature"
+	"blockchain/storage/blockchain"
+	"blockchain/storage/state"
+	"blockchain/storage/txpool"
+)
+
+var ErrUnknownEngine = errors.New("unknown consensus engine")
+
+// Engine — движок консенсуса одной цепочки
+type Engine interface {
+	// Name возвращает имя движка в реестре
+	Name() string
+	// Start начинает консенсус с высоты height (следующей после вершины цепочки)
+	Start(height int64) error
+	// Stop останавливает движок: после возврата он больше не фиксирует
+	// блоки. Может вызываться из обработчика OnFinalized.
+	Stop()
+	// ProposeBlock собирает и подписывает блок высоты height
+	ProposeBlock(height int64) (*blockchain.Block, error)
+	// ValidateBlock проверяет блок поверх текущей вершины цепочки
+	ValidateBlock(block *blockchain.Block) error
+	// OnFinalized регистрирует обработчик блоков, финализированных движком
+	OnFinalized(handler func(block *blockchain.Block))
+}
+
+// Env — окружение движка: цепочка с состоянием, пул транзакций и
+// валидаторы, которых ведёт узел
+type Env struct {
+	State         *state.StateMachine
+	TxPool        *txpool.TransactionPool
+	Validators    []*pos.Validator  // валидаторы узла
+	ValidatorPool pos.ValidatorPool // набор по умолчанию, пока в состоянии нет валидаторов
+	Signer        signature.Signer
+	Peers         []string // адреса узлов; i-й — адрес i-го валидатора узла
+}
+
+// Factory создаёт движок в окружении env
+type Factory func(env *Env) (Engine, error)
+
+// Registry — реестр движков консенсуса по имени. Движки регистрируются в
+// общем реестре (см. Register); отдельный реестр нужен, например, тестам.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]Factory
+}
+
+// NewRegistry создаёт пустой реестр
+func NewRegistry() *Registry {
+	return &Registry{factories: make(map[string]Factory)}
+}
+
+var defaultRegistry = NewRegistry()
+
+// DefaultRegistry возвращает общий реестр, в котором регистрируются движки пакетов
+func DefaultRegistry() *Registry {
+	return defaultRegistry
+}
+
+// Register добавляет движок в реестр; повторная регистрация имени — ошибка программы
+func (r *Registry) Register(name string, factory Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.factories[name]; exists {
+		panic("consensus engine registered twice: " + name)
+	}
+	r.factories[name] = factory
+}
+
+// Registered сообщает, есть ли движок name в реестре
+func (r *Registry) Registered(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.factories[name]
+	return ok
+}
+
+// Names возвращает имена зарегистрированных движков по алфавиту
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New создаёт движок name из реестра
+func (r *Registry) New(name string, env *Env) (Engine, error) {
+	r.mu.RLock()
+	factory, ok := r.factories[name]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q (registered: %v)", ErrUnknownEngine, name, r.Names())
+	}
+	return factory(env)
+}
+
+// Register добавляет движок в общий реестр; обычно вызывается из init пакета движка
+func Register(name string, factory Factory) {
+	defaultRegistry.Register(name, factory)
+}
+
+// Registered сообщает, есть ли движок name в общем реестре
+func Registered(name string) bool {
+	return defaultRegistry.Registered(name)
+}
+
+// Names возвращает имена движков общего реестра по алфавиту
+func Names() []string {
+	return defaultRegistry.Names()
+}
+
+// New создаёт движок name из общего реестра
+func New(name string, env *Env) (Engine, error) {
+	return defaultRegistry.New(name, env)
+}
+
+// Events — обработчики финализированных блоков; встраивается в движки
+type Events struct {
+	mu       sync.Mutex
+	handlers []func(block *blockchain.Block)
+}
+
+// OnFinalized регистрирует обработчик финализированных блоков
+func (e *Events) OnFinalized(handler func(block *blockchain.Block)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.handlers = append(e.handlers, handler)
+}
+
+// Finalize сообщает обработчикам о финализированном блоке
+func (e *Events) Finalize(block *blockchain.Block) {
+	e.mu.Lock()
+	handlers := append([]func(*blockchain.Block){}, e.handlers...)
+	e.mu.Unlock()
+	for _, handler := range handlers {
+		handler(block)
+	}
+}
@@ -0,0 +1,48 @@
+package consensus
+
+import (
+	"errors"
+	"testing"
+
+	"blockchain/storage/blockchain"
+)
+
+type nopEngine struct {
+	Events
+}
+
+func (e *nopEngine) Name() string                                  { return "nop" }
+func (e *nopEngine) Start(height int64) error                      { return nil }
+func (e *nopEngine) Stop()                                         {}
+func (e *nopEngine) ProposeBlock(int64) (*blockchain.Block, error) { return nil, nil }
+func (e *nopEngine) ValidateBlock(block *blockchain.Block) error   { return nil }
+
+// TestRegistry - движки создаются по имени из реестра, события доходят до подписчиков
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("nop", func(env *Env) (Engine, error) { return &nopEngine{}, nil })
+	if !registry.Registered("nop") || Registered("nop") {
+		t.Fatalf("Expected nop engine only in the test registry, got %v", registry.Names())
+	}
+	if _, err := registry.New("missing", &Env{}); !errors.Is(err, ErrUnknownEngine) {
+		t.Errorf("Expected ErrUnknownEngine, got %v", err)
+	}
+
+	engine, err := registry.New("nop", &Env{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var finalized []int64
+	engine.OnFinalized(func(block *blockchain.Block) { finalized = append(finalized, block.Index) })
+	engine.(*nopEngine).Finalize(&blockchain.Block{Index: 7})
+	if len(finalized) != 1 || finalized[0] != 7 {
+		t.Errorf("Expected finalized block 7, got %v", finalized)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected duplicate registration to panic")
+		}
+	}()
+	registry.Register("nop", nil)
+}
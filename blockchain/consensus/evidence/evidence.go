@@ -0,0 +1,126 @@
+// Package evidence — обнаружение, проверка и наказание двойной подписи
+// валидаторов: два разных голоса или два разных предложения блока на одной
+// высоте и в одном раунде.
+package evidence
+
+import (
+	"errors"
+	"fmt"
+
+	"blockchain/consensus/pos"
+	"blockchain/crypto/signature"
+	"blockchain/network/gossip"
+	"blockchain/storage/blockchain"
+)
+
+var (
+	ErrInvalidEvidence   = errors.New("invalid evidence")
+	ErrExpiredEvidence   = errors.New("evidence expired")
+	ErrCommittedEvidence = errors.New("evidence already committed")
+)
+
+// NewDuplicateVote создаёт доказательство по двум голосам валидатора.
+// Данные — канонические VoteSignBytes с подписями.
+func NewDuplicateVote(validator string, a, b blockchain.SignedData) (*blockchain.Evidence, error) {
+	voteA, err := gossip.DecodeVoteSignBytes(a.Data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+	}
+	return blockchain.NewEvidence(blockchain.DuplicateVote, voteA.Height, voteA.Round, validator, a, b), nil
+}
+
+// NewConflictingProposal создаёт доказательство по двум предложениям
+// пропосера. Данные — канонические ProposalSignBytes с подписями.
+func NewConflictingProposal(a, b blockchain.SignedData) (*blockchain.Evidence, error) {
+	proposalA, err := gossip.DecodeProposalSignBytes(a.Data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+	}
+	return blockchain.NewEvidence(blockchain.ConflictingProposal, proposalA.Height, proposalA.Round, proposalA.Proposer, a, b), nil
+}
+
+// Verify проверяет, что валидатор из набора validators подписал оба
+// сообщения доказательства и они противоречат друг другу
+func Verify(validators pos.ValidatorPool, e *blockchain.Evidence) error {
+	if e == nil {
+		return fmt.Errorf("%w: empty", ErrInvalidEvidence)
+	}
+	switch e.Type {
+	case blockchain.DuplicateVote:
+		if err := verifyDuplicateVote(validators, e); err != nil {
+			return err
+		}
+	case blockchain.ConflictingProposal:
+		if err := verifyConflictingProposal(validators, e); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidEvidence, e.Type)
+	}
+
+	pubKey, err := signature.GetPublicKey(e.Validator)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+	}
+	for _, msg := range []blockchain.SignedData{e.A, e.B} {
+		if len(msg.Signature) == 0 || !signature.Verify(pubKey, msg.Data, msg.Signature) {
+			return fmt.Errorf("%w: bad signature of %s", ErrInvalidEvidence, e.Validator)
+		}
+	}
+	return nil
+}
+
+func verifyDuplicateVote(validators pos.ValidatorPool, e *blockchain.Evidence) error {
+	a, err := gossip.DecodeVoteSignBytes(e.A.Data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+	}
+	b, err := gossip.DecodeVoteSignBytes(e.B.Data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+	}
+	if a.Type != b.Type || a.Height != b.Height || a.Round != b.Round || a.ValidatorIndex != b.ValidatorIndex {
+		return fmt.Errorf("%w: votes %s %d/%d and %s %d/%d are not from the same step",
+			ErrInvalidEvidence, a.Type, a.Height, a.Round, b.Type, b.Height, b.Round)
+	}
+	if a.Type != gossip.StatePrevote && a.Type != gossip.StatePrecommit {
+		return fmt.Errorf("%w: unexpected vote type %s", ErrInvalidEvidence, a.Type)
+	}
+	if a.BlockHash == b.BlockHash {
+		return fmt.Errorf("%w: both votes are for %q", ErrInvalidEvidence, a.BlockHash)
+	}
+	if a.Height != e.Height || a.Round != e.Round {
+		return fmt.Errorf("%w: votes at %d/%d, evidence at %d/%d", ErrInvalidEvidence, a.Height, a.Round, e.Height, e.Round)
+	}
+	if a.ValidatorIndex < 0 || a.ValidatorIndex >= len(validators) || validators[a.ValidatorIndex].Address != e.Validator {
+		return fmt.Errorf("%w: validator index %d is not %s", ErrInvalidEvidence, a.ValidatorIndex, e.Validator)
+	}
+	return nil
+}
+
+func verifyConflictingProposal(validators pos.ValidatorPool, e *blockchain.Evidence) error {
+	a, err := gossip.DecodeProposalSignBytes(e.A.Data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+	}
+	b, err := gossip.DecodeProposalSignBytes(e.B.Data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEvidence, err)
+	}
+	if a.Height != b.Height || a.Round != b.Round || a.Proposer != b.Proposer || a.Proposer != e.Validator {
+		return fmt.Errorf("%w: proposals by %s %d/%d and %s %d/%d are not from the same round",
+			ErrInvalidEvidence, a.Proposer, a.Height, a.Round, b.Proposer, b.Height, b.Round)
+	}
+	if a.BlockHash == b.BlockHash {
+		return fmt.Errorf("%w: both proposals are for %s", ErrInvalidEvidence, a.BlockHash)
+	}
+	if a.Height != e.Height || a.Round != e.Round {
+		return fmt.Errorf("%w: proposals at %d/%d, evidence at %d/%d", ErrInvalidEvidence, a.Height, a.Round, e.Height, e.Round)
+	}
+	for _, v := range validators {
+		if v.Address == e.Validator {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not a validator", ErrInvalidEvidence, e.Validator)
+}
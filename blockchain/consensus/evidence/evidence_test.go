@@ -0,0 +1,123 @@
+package evidence
+
+import (
+	"errors"
+	"testing"
+
+	"blockchain/consensus/consensustest"
+	"blockchain/consensus/pos"
+	"blockchain/network/gossip"
+	"blockchain/security/audit"
+	"blockchain/storage/blockchain"
+)
+
+// signed подписывает данные ключом валидатора address
+func signed(address string, data []byte) blockchain.SignedData {
+	sig, _ := consensustest.Signer(address).Sign(data)
+	return blockchain.SignedData{Data: data, Signature: sig}
+}
+
+func precommit(height int64, blockHash string, index int) []byte {
+	return gossip.VoteSignBytes(gossip.StatePrecommit, height, 0, blockHash, index, 1700000000)
+}
+
+func duplicateVote(t *testing.T, height int64, address string, index int) *blockchain.Evidence {
+	t.Helper()
+	e, err := NewDuplicateVote(address,
+		signed(address, precommit(height, "a", index)),
+		signed(address, precommit(height, "b", index)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// TestVerify - доказательство принимается, только если оба сообщения
+// подписаны нарушителем и противоречат друг другу
+func TestVerify(t *testing.T) {
+	validators := consensustest.Validators(4)
+
+	if err := Verify(validators, duplicateVote(t, 5, "v1", 1)); err != nil {
+		t.Errorf("Valid duplicate vote rejected: %v", err)
+	}
+
+	proposal, err := NewConflictingProposal(
+		signed("v2", gossip.ProposalSignBytes(5, 1, -1, "v2", "a")),
+		signed("v2", gossip.ProposalSignBytes(5, 1, -1, "v2", "b")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(validators, proposal); err != nil {
+		t.Errorf("Valid conflicting proposal rejected: %v", err)
+	}
+
+	cases := map[string]*blockchain.Evidence{
+		"same block": blockchain.NewEvidence(blockchain.DuplicateVote, 5, 0, "v1",
+			signed("v1", precommit(5, "a", 1)), signed("v1", precommit(5, "a", 1))),
+		"different heights": blockchain.NewEvidence(blockchain.DuplicateVote, 5, 0, "v1",
+			signed("v1", precommit(5, "a", 1)), signed("v1", precommit(6, "b", 1))),
+		"signed by another validator": blockchain.NewEvidence(blockchain.DuplicateVote, 5, 0, "v1",
+			signed("v1", precommit(5, "a", 1)), signed("v2", precommit(5, "b", 1))),
+		"index of another validator": blockchain.NewEvidence(blockchain.DuplicateVote, 5, 0, "v1",
+			signed("v1", precommit(5, "a", 2)), signed("v1", precommit(5, "b", 2))),
+		"proposals of different rounds": blockchain.NewEvidence(blockchain.ConflictingProposal, 5, 1, "v2",
+			signed("v2", gossip.ProposalSignBytes(5, 1, -1, "v2", "a")),
+			signed("v2", gossip.ProposalSignBytes(5, 2, -1, "v2", "b"))),
+	}
+	for name, e := range cases {
+		if err := Verify(validators, e); !errors.Is(err, ErrInvalidEvidence) {
+			t.Errorf("%s: expected ErrInvalidEvidence, got %v", name, err)
+		}
+	}
+
+	// Доказательство переживает кодирование
+	decoded, err := blockchain.DecodeEvidence(proposal.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(validators, decoded); err != nil || decoded.Key() != proposal.Key() {
+		t.Errorf("Decoded evidence %s rejected: %v", decoded.Key(), err)
+	}
+}
+
+// TestPool_Lifecycle - доказательство попадает в журнал аудита один раз,
+// после включения в блок не принимается повторно и устаревает после MaxAge
+func TestPool_Lifecycle(t *testing.T) {
+	validators := consensustest.Validators(4)
+	auditor := audit.NewSecurityAuditor()
+	SetAuditor(auditor)
+	defer SetAuditor(nil)
+
+	pool := NewPool(func(int64) pos.ValidatorPool { return validators }, &Config{MaxAge: 10, MaxPerBlock: 1})
+	first, second := duplicateVote(t, 3, "v1", 1), duplicateVote(t, 2, "v3", 3)
+	for _, e := range []*blockchain.Evidence{first, first, second} {
+		if _, err := pool.Add(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events := auditor.GetEvents()
+	if len(events) != 2 || events[0].Severity != "CRITICAL" || events[0].NodeID != "v1" {
+		t.Fatalf("Expected one CRITICAL event per evidence, got %+v", events)
+	}
+
+	// В блок попадает самое старое доказательство, не больше MaxPerBlock
+	pending := pool.Pending()
+	if len(pending) != 1 || pending[0].Key() != second.Key() {
+		t.Fatalf("Expected oldest evidence first, got %d items", len(pending))
+	}
+
+	block := &blockchain.Block{Index: 4, Evidence: pending}
+	pool.Update(block)
+	if err := pool.Check(second); !errors.Is(err, ErrCommittedEvidence) {
+		t.Errorf("Expected committed evidence to be rejected, got %v", err)
+	}
+
+	// Доказательство старше MaxAge устаревает
+	pool.Update(&blockchain.Block{Index: 20})
+	if len(pool.Pending()) != 0 {
+		t.Errorf("Expected expired evidence to be pruned")
+	}
+	if _, err := pool.Add(duplicateVote(t, 5, "v2", 2)); !errors.Is(err, ErrExpiredEvidence) {
+		t.Errorf("Expected expired evidence to be rejected, got %v", err)
+	}
+}
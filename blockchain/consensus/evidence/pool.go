@@ -0,0 +1,169 @@
+package evidence
+
+// пул доказательств: ожидающие включения в блок и уже включённые
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"blockchain/consensus/pos"
+	"blockchain/security/audit"
+	"blockchain/storage/blockchain"
+)
+
+// Config — параметры обработки доказательств
+type Config struct {
+	MaxAge      int64 // сколько высот доказательство остаётся действительным
+	MaxPerBlock int   // сколько доказательств включается в один блок
+}
+
+// DefaultConfig возвращает параметры по умолчанию. MaxAge должен совпадать
+// с EvidenceMaxAge параметров стейкинга сети: по нему доказательства блока
+// проверяет и состояние.
+func DefaultConfig() *Config {
+	return &Config{
+		MaxAge:      pos.DefaultStakingConfig().EvidenceMaxAge,
+		MaxPerBlock: 10,
+	}
+}
+
+var auditor *audit.SecurityAuditor
+
+// SetAuditor подключает запись доказательств в журнал аудита
+func SetAuditor(a *audit.SecurityAuditor) {
+	auditor = a
+}
+
+// Pool хранит проверенные доказательства до включения в блок и помнит
+// включённые, чтобы одно нарушение не наказывалось дважды
+type Pool struct {
+	mu         sync.Mutex
+	config     *Config
+	validators func(height int64) pos.ValidatorPool
+	height     int64
+	pending    map[string]*blockchain.Evidence
+	committed  map[string]int64 // ключ -> высота нарушения
+}
+
+// NewPool создаёт пул; validators возвращает набор валидаторов высоты.
+// config == nil — параметры по умолчанию.
+func NewPool(validators func(height int64) pos.ValidatorPool, config *Config) *Pool {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return &Pool{
+		config:     config,
+		validators: validators,
+		pending:    make(map[string]*blockchain.Evidence),
+		committed:  make(map[string]int64),
+	}
+}
+
+// Config возвращает параметры пула
+func (p *Pool) Config() *Config {
+	return p.config
+}
+
+// Add проверяет доказательство и добавляет его в пул. Возвращает true, если
+// доказательство новое: его нужно разослать пирам.
+func (p *Pool) Add(e *blockchain.Evidence) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.check(e); err != nil {
+		return false, err
+	}
+	key := e.Key()
+	if _, ok := p.pending[key]; ok {
+		return false, nil
+	}
+	p.pending[key] = e
+	fmt.Printf("🚨 Evidence of %s by %s at height %d round %d\n", e.Type, e.Validator, e.Height, e.Round)
+	recordEvent(e)
+	return true, nil
+}
+
+// Check проверяет доказательство из предложенного блока
+func (p *Pool) Check(e *blockchain.Evidence) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.check(e)
+}
+
+func (p *Pool) check(e *blockchain.Evidence) error {
+	if e == nil {
+		return fmt.Errorf("%w: empty", ErrInvalidEvidence)
+	}
+	if _, ok := p.committed[e.Key()]; ok {
+		return fmt.Errorf("%w: %s", ErrCommittedEvidence, e.Key())
+	}
+	if p.height > 0 && e.Height+p.config.MaxAge < p.height {
+		return fmt.Errorf("%w: height %d, current %d", ErrExpiredEvidence, e.Height, p.height)
+	}
+	return Verify(p.validators(e.Height), e)
+}
+
+// Pending возвращает доказательства для следующего блока: сначала старые
+func (p *Pool) Pending() []*blockchain.Evidence {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	evidence := make([]*blockchain.Evidence, 0, len(p.pending))
+	for _, e := range p.pending {
+		evidence = append(evidence, e)
+	}
+	sort.Slice(evidence, func(i, j int) bool {
+		if evidence[i].Height != evidence[j].Height {
+			return evidence[i].Height < evidence[j].Height
+		}
+		return evidence[i].Key() < evidence[j].Key()
+	})
+	if len(evidence) > p.config.MaxPerBlock {
+		evidence = evidence[:p.config.MaxPerBlock]
+	}
+	return evidence
+}
+
+// Update учитывает добавленный в цепочку блок: его доказательства
+// становятся включёнными, устаревшие удаляются из пула
+func (p *Pool) Update(block *blockchain.Block) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if block.Index > p.height {
+		p.height = block.Index
+	}
+	for _, e := range block.Evidence {
+		key := e.Key()
+		p.committed[key] = e.Height
+		delete(p.pending, key)
+	}
+	for key, e := range p.pending {
+		if e.Height+p.config.MaxAge < p.height {
+			delete(p.pending, key)
+		}
+	}
+	// Включённые доказательства старше MaxAge отклоняются и без этой записи
+	for key, height := range p.committed {
+		if height+p.config.MaxAge < p.height {
+			delete(p.committed, key)
+		}
+	}
+}
+
+// recordEvent записывает доказательство в журнал аудита
+func recordEvent(e *blockchain.Evidence) {
+	if auditor == nil {
+		return
+	}
+	eventType := "DuplicateVote"
+	if e.Type == blockchain.ConflictingProposal {
+		eventType = "ConflictingProposal"
+	}
+	auditor.RecordEvent(audit.SecurityEvent{
+		Timestamp: time.Now(),
+		Type:      eventType,
+		Message:   fmt.Sprintf("Validator %s signed conflicting messages at height %d round %d", e.Validator, e.Height, e.Round),
+		NodeID:    e.Validator,
+		Severity:  "CRITICAL",
+	})
+}
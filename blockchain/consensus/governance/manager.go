@@ -2,13 +2,21 @@
 package governance
 
 import (
+	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 	"blockchain/consensus/pos"
 )
 
 type GovernanceManager struct {
 	Proposals map[string]*Proposal
+
+	validatorPool *pos.ValidatorPool // пул для предложений, восстановленных из снимка
+	setValidator  func(validator string, jailed bool) error
+	setConsensus  func(engine string, height int64) error
+	journal       func(key string, value any)
+	mu            sync.Mutex
 }
 
 func NewGovernanceManager() *GovernanceManager {
@@ -18,17 +26,25 @@ func NewGovernanceManager() *GovernanceManager {
 }
 
 func (g *GovernanceManager) SubmitProposal(p *Proposal) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	g.Proposals[p.ID] = p
+	g.record(p)
 	fmt.Printf("Proposal submitted: %s\n", p.ID)
 }
 
 func (g *GovernanceManager) VoteOnProposal(proposalID, voter, choice string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	if p, exists := g.Proposals[proposalID]; exists {
 		p.Votes[voter] = choice
+		g.record(p)
 	}
 }
 
 func (g *GovernanceManager) TallyVotes(proposalID string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	p := g.Proposals[proposalID]
 	
 	yes := 0
@@ -72,6 +88,7 @@ func (g *GovernanceManager) TallyVotes(proposalID string) bool {
 	// Проверяем, прошло ли предложение порог голосования
 	passed := float64(yes)/float64(total) >= p.Threshold
 	p.Approved = passed
+	g.record(p)
 	
 	if passed {
 		fmt.Printf("Proposal %s passed with %.2f%% votes\n", proposalID, (float64(yes)/float64(total))*100)
@@ -103,6 +120,8 @@ func NewProposal(id, title, description, author string, proposalType ProposalTyp
 
 // ExecuteProposal выполняняет одобренное предложение
 func (g *GovernanceManager) ExecuteProposal(proposalID string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	p := g.Proposals[proposalID]
 	
 	if !p.Approved {
@@ -143,8 +162,132 @@ func (g *GovernanceManager) ExecuteProposal(proposalID string) error {
 		}
 		fmt.Printf("Funding request approved: %f tokens to %s\n", amount, recipient)
 		// Здесь будет реальная логика финансирования
+
+	case ValidatorSetChange:
+		// Решение исполняется транзакцией в цепочке и вступает в силу в конце эпохи
+		validator, ok := p.Parameters["validator"].(string)
+		if !ok {
+			return fmt.Errorf("invalid validator parameter")
+		}
+		jailed, ok := p.Parameters["jailed"].(bool)
+		if !ok {
+			return fmt.Errorf("invalid jailed parameter")
+		}
+		if g.setValidator == nil {
+			return fmt.Errorf("validator set changes are not configured")
+		}
+		if err := g.setValidator(validator, jailed); err != nil {
+			return fmt.Errorf("failed to change validator %s: %w", validator, err)
+		}
+		fmt.Printf("Validator %s jailed=%v from the next epoch\n", validator, jailed)
+
+	case ConsensusSwitch:
+		// Высота перехода входит в предложение, поэтому все узлы меняют движок на одном блоке
+		engine, ok := p.Parameters["engine"].(string)
+		if !ok {
+			return fmt.Errorf("invalid engine parameter")
+		}
+		height, ok := p.Parameters["height"].(float64)
+		if !ok || height != float64(int64(height)) {
+			return fmt.Errorf("invalid height parameter")
+		}
+		if g.setConsensus == nil {
+			return fmt.Errorf("consensus switching is not configured")
+		}
+		if err := g.setConsensus(engine, int64(height)); err != nil {
+			return fmt.Errorf("failed to schedule consensus switch to %s: %w", engine, err)
+		}
+		fmt.Printf("Consensus engine %s from height %d\n", engine, int64(height))
 	}
 	
 	p.Executed = true
+	g.record(p)
+	return nil
+}
+
+// SetValidatorPool задаёт пул валидаторов для подсчёта голосов по
+// предложениям, восстановленным из снимка
+func (g *GovernanceManager) SetValidatorPool(pool *pos.ValidatorPool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.validatorPool = pool
+	for _, p := range g.Proposals {
+		if p.ValidatorPool == nil {
+			p.ValidatorPool = pool
+		}
+	}
+}
+
+// SetValidatorExecutor задаёт исполнение предложений ValidatorSetChange:
+// исключение (jailed) или возврат валидатора в набор
+func (g *GovernanceManager) SetValidatorExecutor(execute func(validator string, jailed bool) error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.setValidator = execute
+}
+
+// SetConsensusExecutor задаёт исполнение предложений ConsensusSwitch:
+// переход на движок engine с высоты height
+func (g *GovernanceManager) SetConsensusExecutor(execute func(engine string, height int64) error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.setConsensus = execute
+}
+
+// SetJournal подключает запись изменений предложений в WAL узла
+func (g *GovernanceManager) SetJournal(journal func(key string, value any)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.journal = journal
+}
+
+// record сохраняет предложение в журнал; вызывается под блокировкой
+func (g *GovernanceManager) record(p *Proposal) {
+	if g.journal != nil {
+		g.journal(p.ID, p)
+	}
+}
+
+// Name — имя говернанса в снимках узла
+func (g *GovernanceManager) Name() string {
+	return "governance"
+}
+
+// Export возвращает предложения в JSON
+func (g *GovernanceManager) Export() ([]byte, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return json.Marshal(g.Proposals)
+}
+
+// Import заменяет предложения данными снимка
+func (g *GovernanceManager) Import(data []byte) error {
+	proposals := make(map[string]*Proposal)
+	if err := json.Unmarshal(data, &proposals); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, p := range proposals {
+		p.ValidatorPool = g.validatorPool
+	}
+	g.Proposals = proposals
+	return nil
+}
+
+// ApplyRecord применяет изменение предложения из WAL
+func (g *GovernanceManager) ApplyRecord(id string, value []byte) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if value == nil {
+		delete(g.Proposals, id)
+		return nil
+	}
+	var p Proposal
+	if err := json.Unmarshal(value, &p); err != nil {
+		return err
+	}
+	p.ValidatorPool = g.validatorPool
+	g.Proposals[id] = &p
 	return nil
 }
@@ -10,9 +10,11 @@ import (
 type ProposalType string
 
 const (
-	ParameterChange ProposalType = "parameter_change"
-	ProtocolUpgrade ProposalType = "protocol_upgrade"
-	FundingRequest  ProposalType = "funding_request"
+	ParameterChange    ProposalType = "parameter_change"
+	ProtocolUpgrade    ProposalType = "protocol_upgrade"
+	FundingRequest     ProposalType = "funding_request"
+	ValidatorSetChange ProposalType = "validator_set_change" // параметры "validator" (string) и "jailed" (bool)
+	ConsensusSwitch    ProposalType = "consensus_switch"     // параметры "engine" (string) и "height" (число)
 )
 
 // Proposal представляет собой предложение для голосования
@@ -29,5 +31,5 @@ type Proposal struct {
 	EndTime     time.Time
 	Approved    bool
 	Executed    bool
-	ValidatorPool *pos.ValidatorPool   // Добавляем пул валидаторов
+	ValidatorPool *pos.ValidatorPool `json:"-"` // Добавляем пул валидаторов
 }
\ No newline at end of file
@@ -0,0 +1,85 @@
+package hotstuff
+
+// движок консенсуса HotStuff
+
+import (
+	"fmt"
+
+	"blockchain/consensus"
+	"blockchain/storage/blockchain"
+)
+
+// EngineName — имя движка HotStuff в реестре consensus
+const EngineName = "HotStuff"
+
+func init() {
+	consensus.Register(EngineName, NewEngine)
+}
+
+// Engine — движок chained HotStuff: по узлу на каждого валидатора
+// окружения; i-й узел слушает i-й адрес из Env.Peers
+type Engine struct {
+	consensus.Events
+	nodes []*Node
+}
+
+// NewEngine создаёт узлы HotStuff для валидаторов окружения
+func NewEngine(env *consensus.Env) (consensus.Engine, error) {
+	if len(env.Validators) == 0 {
+		return nil, fmt.Errorf("hotstuff engine needs at least one validator")
+	}
+	if len(env.Peers) < len(env.Validators) {
+		return nil, fmt.Errorf("hotstuff engine needs an address for each of %d validators, got %d", len(env.Validators), len(env.Peers))
+	}
+	e := &Engine{}
+	for i, v := range env.Validators {
+		node := NewNode(v.ID, v, env.ValidatorPool, env.TxPool, env.State, env.Signer, env.Peers[i], env.Peers)
+		node.OnFinalized(e.Finalize)
+		e.nodes = append(e.nodes, node)
+	}
+	return e, nil
+}
+
+func (e *Engine) Name() string {
+	return EngineName
+}
+
+// Start запускает узлы; каждый сначала догоняет пиров, поэтому консенсус
+// продолжается над вершиной цепочки после синхронизации
+func (e *Engine) Start(height int64) error {
+	if next := e.nodes[0].Chain.Height() + 1; height != next {
+		return fmt.Errorf("chain expects height %d, not %d", next, height)
+	}
+	for _, node := range e.nodes {
+		go func() {
+			node.Start()
+			fmt.Printf("✅ HotStuff Node %s started\n", node.Address)
+		}()
+	}
+	return nil
+}
+
+func (e *Engine) Stop() {
+	for _, node := range e.nodes {
+		node.Stop()
+	}
+}
+
+// ProposeBlock собирает блок высоты height поверх вершины цепочки
+func (e *Engine) ProposeBlock(height int64) (*blockchain.Block, error) {
+	node := e.nodes[0]
+	tip := node.Chain.GetLatestBlock()
+	if tip == nil || tip.Index+1 != height {
+		return nil, fmt.Errorf("chain expects height %d, not %d", node.Chain.Height()+1, height)
+	}
+	return node.ProposeBlock(nil, tip.Commit)
+}
+
+func (e *Engine) ValidateBlock(block *blockchain.Block) error {
+	return e.nodes[0].ValidateBlock(nil, block)
+}
+
+// Nodes возвращает узлы движка
+func (e *Engine) Nodes() []*Node {
+	return e.nodes
+}
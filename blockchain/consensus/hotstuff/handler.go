@@ -0,0 +1,113 @@
+package hotstuff
+
+import (
+	"errors"
+	"fmt"
+
+	"blockchain/consensus/bft"
+	"blockchain/crypto/signature"
+	"blockchain/network/blocksync"
+	"blockchain/network/gossip"
+)
+
+type MessageHandler struct {
+	Node *Node
+}
+
+func NewMessageHandler(node *Node) *MessageHandler {
+	return &MessageHandler{Node: node}
+}
+
+func (h *MessageHandler) ProcessMessage(msg *gossip.SignedConsensusMessage) {
+	switch msg.Type {
+	case gossip.StatePropose:
+		h.HandlePropose(msg)
+	case gossip.StatePrecommit:
+		h.HandleVote(msg)
+	case gossip.StateNewView:
+		h.HandleNewView(msg)
+	}
+}
+
+// HandlePropose проверяет подпись лидера и передаёт предложение автомату;
+// подпись самого блока проверяется в Node.ValidateBlock
+func (h *MessageHandler) HandlePropose(msg *gossip.SignedConsensusMessage) {
+	proposal, err := bft.DecodeProposal(msg.Data)
+	if err != nil {
+		fmt.Printf("❌ [HandlePropose] %v\n", err)
+		return
+	}
+
+	pubKey, err := signature.GetPublicKey(msg.From)
+	if err != nil {
+		fmt.Printf("❌ [HandlePropose] %v\n", err)
+		return
+	}
+	if proposal.Proposer != msg.From || !signature.Verify(pubKey, proposal.SignBytes(), msg.Signature) {
+		fmt.Println("❌ [HandlePropose] Invalid proposal signature")
+		return
+	}
+	proposal.Signature = msg.Signature
+	if proposal.Height != msg.Height || proposal.Round != msg.Round {
+		fmt.Printf("❌ [HandlePropose] Proposal %d/%d does not match envelope %d/%d\n",
+			proposal.Height, proposal.Round, msg.Height, msg.Round)
+		return
+	}
+
+	err = h.Node.HotStuff.HandleProposal(proposal)
+	if errors.Is(err, ErrMissingParent) {
+		// Узел пропустил предыдущие предложения: недостающую ветку отдаёт лидер
+		go h.fetchBranch(msg.From, proposal)
+		return
+	}
+	h.report(msg, err)
+}
+
+// fetchBranch запрашивает у лидера незафиксированных предков предложения
+// и повторяет его обработку. Если предки продолжают неизвестный блок, узел
+// сначала догоняет пиров синхронизацией блоков.
+func (h *MessageHandler) fetchBranch(from string, proposal *bft.Proposal) {
+	node := h.Node
+	peer := blocksync.NewTCPPeer(node.Transport, from, node.Sync.Config().RequestTimeout)
+	data, err := peer.Request(gossip.MsgBlock, []byte(proposal.Block.PrevHash))
+	if err != nil {
+		fmt.Printf("❌ Failed to fetch branch of %s from %s: %v\n", proposal.Block.Hash, from, err)
+		return
+	}
+	ancestors, err := blocksync.DecodeBlocks(data)
+	if err != nil {
+		fmt.Printf("❌ Failed to decode branch from %s: %v\n", from, err)
+		return
+	}
+	if len(ancestors) == 0 || !node.HotStuff.Knows(ancestors[0].PrevHash) {
+		node.CatchUp()
+	}
+	msg := &gossip.SignedConsensusMessage{Type: gossip.StatePropose, From: from}
+	h.report(msg, node.HotStuff.HandleProposal(proposal, ancestors...))
+}
+
+func (h *MessageHandler) HandleVote(msg *gossip.SignedConsensusMessage) {
+	vote, err := bft.VoteFromMessage(msg)
+	if err != nil {
+		fmt.Printf("❌ [HandleVote] %v\n", err)
+		return
+	}
+	h.report(msg, h.Node.HotStuff.HandleVote(vote))
+}
+
+func (h *MessageHandler) HandleNewView(msg *gossip.SignedConsensusMessage) {
+	nv, err := NewViewFromMessage(msg)
+	if err != nil {
+		fmt.Printf("❌ [HandleNewView] %v\n", err)
+		return
+	}
+	h.report(msg, h.Node.HotStuff.HandleNewView(nv))
+}
+
+// report печатает ошибку обработки; запоздавшие сообщения — обычное дело
+func (h *MessageHandler) report(msg *gossip.SignedConsensusMessage, err error) {
+	if err == nil || errors.Is(err, ErrStaleMessage) {
+		return
+	}
+	fmt.Printf("❌ Rejected %s from %s: %v\n", msg.Type, msg.From, err)
+}
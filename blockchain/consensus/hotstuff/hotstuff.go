@@ -0,0 +1,769 @@
+// Package hotstuff — конвейерный (chained) HotStuff: альтернатива
+// Tendermint с линейной сложностью обмена сообщениями.
+//
+// Правила следуют статье «HotStuff: BFT Consensus in the Lens of
+// Blockchain» (Yin, Malkhi, Reiter, Gueta, Abraham) в варианте с
+// последовательными видами (как в LibraBFT):
+//   - лидер вида v предлагает блок поверх блока своего highQC, заголовок
+//     блока (LastCommit) — этот сертификат кворума (QC);
+//   - валидатор голосует за блок один раз в виде, если QC блока не ниже его
+//     блокировки, и отправляет голос только лидеру вида v+1;
+//   - лидер v+1 собирает из +2/3 голосов QC и предлагает с ним следующий
+//     блок, поэтому фазы prepare/pre-commit/commit разных блоков идут
+//     одновременно: QC блока b2 блокирует валидатора на его родителе b1,
+//     а цепочка b0 ← b1 ← b2 последовательных видов фиксирует b0;
+//   - пейсмейкер: по таймауту вида валидатор переходит в следующий вид и
+//     отправляет его лидеру new-view со своим highQC; лидер предлагает блок,
+//     получив new-view от +2/3 мощности.
+//
+// Голос за блок — precommit вида (bft.Vote), а QC — blockchain.Commit,
+// поэтому сертификат проверяется bft.VerifyCommit и хранится с блоком так
+// же, как сертификат Tendermint.
+package hotstuff
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"blockchain/consensus/bft"
+	"blockchain/consensus/pos"
+	"blockchain/crypto/signature"
+	"blockchain/network/gossip"
+	"blockchain/storage/blockchain"
+)
+
+var (
+	ErrStaleMessage       = errors.New("consensus message for a past view")
+	ErrNotLeader          = errors.New("node is not the leader of the view")
+	ErrUnexpectedProposer = errors.New("proposal from unexpected leader")
+	ErrInvalidProposal    = errors.New("invalid proposal")
+	ErrMissingParent      = errors.New("proposal extends an unknown block")
+	ErrInvalidQC          = errors.New("invalid quorum certificate")
+	ErrInvalidNewView     = errors.New("invalid new-view")
+)
+
+// MaxPendingVotes ограничивает число голосов, пришедших раньше предложения
+const MaxPendingVotes = 1024
+
+// Config — таймауты пейсмейкера. Таймаут вида растёт на TimeoutViewDelta
+// с каждым неудачным видом подряд и сбрасывается при новом QC.
+type Config struct {
+	TimeoutView      time.Duration
+	TimeoutViewDelta time.Duration
+	// Интервал проверки пула, пока предлагать нечего: ни транзакций, ни
+	// незафиксированных блоков с транзакциями
+	TimeoutIdle time.Duration
+}
+
+// DefaultConfig возвращает таймауты по умолчанию
+func DefaultConfig() *Config {
+	return &Config{
+		TimeoutView:      2 * time.Second,
+		TimeoutViewDelta: 1 * time.Second,
+		TimeoutIdle:      500 * time.Millisecond,
+	}
+}
+
+// View возвращает таймаут вида после failures неудачных видов подряд
+func (c *Config) View(failures int64) time.Duration {
+	return c.TimeoutView + time.Duration(failures)*c.TimeoutViewDelta
+}
+
+// Backend — окружение HotStuff. Ветка (branch) — незафиксированные блоки
+// от вершины цепочки по порядку; пустая ветка — сама вершина.
+type Backend interface {
+	// Validators возвращает набор валидаторов блока, продолжающего ветку
+	Validators(branch []*blockchain.Block) pos.ValidatorPool
+	// VerifyQC проверяет QC последнего блока ветки набором его высоты
+	VerifyQC(branch []*blockchain.Block, qc *blockchain.Commit) error
+	// Leader возвращает лидера вида; функция должна давать одинаковый
+	// результат на всех узлах
+	Leader(view int64) string
+	// HasPendingTxs сообщает, есть ли транзакции для нового блока
+	HasPendingTxs() bool
+	// ProposeBlock собирает и подписывает блок поверх ветки с заголовком
+	// justify (QC её последнего блока); блок может быть пустым
+	ProposeBlock(branch []*blockchain.Block, justify *blockchain.Commit) (*blockchain.Block, error)
+	// ValidateBlock проверяет предложенный блок поверх ветки
+	ValidateBlock(branch []*blockchain.Block, block *blockchain.Block) error
+	// BroadcastProposal рассылает предложение остальным валидаторам
+	BroadcastProposal(p *bft.Proposal)
+	// SendVote и SendNewView отправляют сообщение лидеру следующего вида
+	SendVote(to string, v *bft.Vote)
+	SendNewView(to string, nv *NewView)
+	// CommitBlock фиксирует блок; block.Commit — его QC
+	CommitBlock(block *blockchain.Block) error
+}
+
+// treeNode — незафиксированный блок и вид, в котором он предложен
+type treeNode struct {
+	block *blockchain.Block
+	view  int64
+}
+
+// newViewSet — new-view одного вида, учтённые по мощности отправителей
+type newViewSet struct {
+	voted map[int]bool
+	power int64
+}
+
+// HotStuff — конечный автомат chained HotStuff одного валидатора.
+// Методы потокобезопасны; сообщения отправляются после снятия блокировки,
+// поэтому Backend может доставлять их другим автоматам синхронно.
+type HotStuff struct {
+	mu      sync.Mutex
+	address string
+	signer  signature.Signer
+	config  *Config
+	clock   bft.Clock
+	backend Backend
+
+	root       *blockchain.Block    // последний зафиксированный блок
+	blocks     map[string]*treeNode // незафиксированные блоки по хэшу
+	view       int64
+	highQC     *blockchain.Commit // QC с наибольшим видом (nil — у вершины нет QC)
+	lockedView int64              // вид блока, на котором заблокирован валидатор
+	lastVoted  int64              // последний вид, в котором валидатор голосовал
+	proposed   int64              // последний вид, в котором узел предложил блок
+	failures   int64              // неудачных видов подряд
+	idle       bool               // предлагать нечего, таймаут вида не идёт
+
+	votes        map[int64]*bft.VoteSet // голоса за блоки вида (узел — лидер следующего)
+	newViews     map[int64]*newViewSet
+	pendingVotes []*bft.Vote // голоса за ещё не полученные блоки
+
+	stopped atomic.Bool
+	outbox  []func()
+}
+
+// NewHotStuff создаёт автомат валидатора address, подписывающего сообщения signer.
+// clock == nil — системные часы, config == nil — таймауты по умолчанию.
+func NewHotStuff(address string, signer signature.Signer, backend Backend, clock bft.Clock, config *Config) *HotStuff {
+	if clock == nil {
+		clock = bft.SystemClock{}
+	}
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return &HotStuff{
+		address:    address,
+		signer:     signer,
+		config:     config,
+		clock:      clock,
+		backend:    backend,
+		lockedView: -1,
+		lastVoted:  -1,
+		proposed:   -1,
+	}
+}
+
+// qcView возвращает вид блока, сертифицированного qc (-1 — QC нет)
+func qcView(qc *blockchain.Commit) int64 {
+	if qc == nil {
+		return -1
+	}
+	return qc.Round
+}
+
+// Start начинает консенсус над зафиксированным блоком root. Виды
+// продолжаются с вида QC вершины; вид, блокировка и последний голос
+// после перезапуска не уменьшаются.
+func (hs *HotStuff) Start(root *blockchain.Block) {
+	hs.mu.Lock()
+	hs.stopped.Store(false)
+	hs.root = root
+	hs.blocks = make(map[string]*treeNode)
+	hs.votes = make(map[int64]*bft.VoteSet)
+	hs.newViews = make(map[int64]*newViewSet)
+	hs.pendingVotes = nil
+	hs.highQC = root.Commit
+	hs.failures = 0
+	view := max(hs.view, qcView(root.Commit)+1)
+	hs.lockedView = max(hs.lockedView, qcView(root.Commit))
+	hs.view = view - 1
+	hs.enterView(view)
+	hs.unlockAndFlush()
+}
+
+// Stop останавливает автомат: таймауты и сообщения больше не обрабатываются.
+// Не требует блокировки, поэтому может вызываться из Backend.CommitBlock.
+func (hs *HotStuff) Stop() {
+	hs.stopped.Store(true)
+}
+
+// State возвращает текущий вид, вид highQC и вид блокировки
+func (hs *HotStuff) State() (view, highQC, locked int64) {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	return hs.view, qcView(hs.highQC), hs.lockedView
+}
+
+// Knows сообщает, известен ли блок: зафиксированная вершина или блок дерева
+func (hs *HotStuff) Knows(hash string) bool {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	_, ok := hs.branch(hash)
+	return ok
+}
+
+// Branch возвращает незафиксированные блоки от вершины до блока hash
+// включительно (nil — блок неизвестен или уже зафиксирован). Ветку
+// запрашивает отставший узел, получивший предложение неизвестного блока.
+func (hs *HotStuff) Branch(hash string) []*blockchain.Block {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if hs.root == nil {
+		return nil
+	}
+	branch, _ := hs.branch(hash)
+	return branch
+}
+
+// HandleProposal принимает предложение лидера. ancestors — недостающие
+// незафиксированные предки блока по порядку (например, полученные от
+// лидера после ErrMissingParent); за них узел не голосует.
+func (hs *HotStuff) HandleProposal(p *bft.Proposal, ancestors ...*blockchain.Block) error {
+	hs.mu.Lock()
+	if hs.stopped.Load() {
+		hs.mu.Unlock()
+		return nil
+	}
+	err := hs.addAncestors(ancestors, p)
+	if err == nil {
+		err = hs.addProposal(p)
+	}
+	hs.unlockAndFlush()
+	return err
+}
+
+// HandleVote принимает голос за блок; голоса собирает лидер следующего вида
+func (hs *HotStuff) HandleVote(v *bft.Vote) error {
+	hs.mu.Lock()
+	if hs.stopped.Load() {
+		hs.mu.Unlock()
+		return nil
+	}
+	err := hs.addVote(v)
+	hs.unlockAndFlush()
+	return err
+}
+
+// HandleNewView принимает new-view валидатора, перешедшего в вид по таймауту
+func (hs *HotStuff) HandleNewView(nv *NewView) error {
+	hs.mu.Lock()
+	if hs.stopped.Load() {
+		hs.mu.Unlock()
+		return nil
+	}
+	err := hs.addNewView(nv)
+	hs.unlockAndFlush()
+	return err
+}
+
+// branch возвращает незафиксированные блоки от вершины до блока hash
+// включительно; false — блок не продолжает вершину
+func (hs *HotStuff) branch(hash string) ([]*blockchain.Block, bool) {
+	var reversed []*blockchain.Block
+	for hash != hs.root.Hash {
+		n := hs.blocks[hash]
+		if n == nil {
+			return nil, false
+		}
+		reversed = append(reversed, n.block)
+		hash = n.block.PrevHash
+	}
+	branch := make([]*blockchain.Block, len(reversed))
+	for i, b := range reversed {
+		branch[len(reversed)-1-i] = b
+	}
+	return branch, true
+}
+
+// checkBlock проверяет блок, продолжающий известный блок: заголовок
+// justify должен быть QC родителя, а сам блок — валиден поверх ветки.
+// Возвращает ветку до родителя.
+func (hs *HotStuff) checkBlock(block *blockchain.Block) ([]*blockchain.Block, error) {
+	parentBranch, ok := hs.branch(block.PrevHash)
+	if !ok {
+		return nil, fmt.Errorf("%w: block %d extends %s", ErrMissingParent, block.Index, block.PrevHash)
+	}
+	parent, parentView := hs.root, qcView(hs.root.Commit)
+	if len(parentBranch) > 0 {
+		n := hs.blocks[block.PrevHash]
+		parent, parentView = n.block, n.view
+	}
+
+	justify := block.LastCommit
+	switch {
+	case justify == nil:
+		if parent != hs.root || hs.root.Commit != nil {
+			return nil, fmt.Errorf("%w: block %d has no QC for its parent", ErrInvalidQC, block.Index)
+		}
+	case justify.Height != parent.Index || justify.BlockHash != parent.Hash || justify.Round != parentView:
+		return nil, fmt.Errorf("%w: QC for %s at %d/%d does not match parent %s at %d/%d", ErrInvalidQC,
+			justify.BlockHash, justify.Height, justify.Round, parent.Hash, parent.Index, parentView)
+	default:
+		if err := hs.backend.VerifyQC(parentBranch, justify); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidQC, err)
+		}
+	}
+	if err := hs.backend.ValidateBlock(parentBranch, block); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProposal, err)
+	}
+	return parentBranch, nil
+}
+
+// addAncestors добавляет в дерево недостающих предков предложения p; вид
+// предка — вид QC в заголовке следующего блока. Предки не выше вершины
+// (узел мог зафиксировать их, пока ждал ответа) пропускаются.
+func (hs *HotStuff) addAncestors(ancestors []*blockchain.Block, p *bft.Proposal) error {
+	for i, block := range ancestors {
+		if _, known := hs.blocks[block.Hash]; known || block.Index <= hs.root.Index {
+			continue
+		}
+		child := p.Block
+		if i+1 < len(ancestors) {
+			child = ancestors[i+1]
+		}
+		if child.LastCommit == nil || child.LastCommit.BlockHash != block.Hash {
+			return fmt.Errorf("%w: ancestor %d is not certified by its child", ErrInvalidProposal, block.Index)
+		}
+		if _, err := hs.checkBlock(block); err != nil {
+			return err
+		}
+		hs.blocks[block.Hash] = &treeNode{block: block, view: child.LastCommit.Round}
+	}
+	return nil
+}
+
+func (hs *HotStuff) addProposal(p *bft.Proposal) error {
+	if p == nil || p.Block == nil || p.Block.Index != p.Height || p.POLRound != -1 {
+		return fmt.Errorf("%w: malformed proposal", ErrInvalidProposal)
+	}
+	if p.Round < hs.view {
+		return fmt.Errorf("%w: %d, current %d", ErrStaleMessage, p.Round, hs.view)
+	}
+	if leader := hs.backend.Leader(p.Round); p.Proposer != leader || p.Block.Validator != leader {
+		return fmt.Errorf("%w: %s in view %d, expected %s", ErrUnexpectedProposer, p.Proposer, p.Round, leader)
+	}
+	if _, known := hs.blocks[p.Block.Hash]; known {
+		return nil
+	}
+	if qcView(p.Block.LastCommit) >= p.Round {
+		return fmt.Errorf("%w: QC of view %d in view %d", ErrInvalidProposal, qcView(p.Block.LastCommit), p.Round)
+	}
+	if _, err := hs.checkBlock(p.Block); err != nil {
+		fmt.Printf("❌ Invalid proposal %s for view %d: %v\n", p.Block.Hash, p.Round, err)
+		return err
+	}
+
+	n := &treeNode{block: p.Block, view: p.Round}
+	hs.blocks[p.Block.Hash] = n
+	fmt.Printf("📬 Received proposal %s (height %d) for view %d\n", p.Block.Hash, p.Height, p.Round)
+
+	// Предложение лидера переводит в его вид
+	hs.enterView(p.Round)
+	hs.processQC(p.Block.LastCommit)
+	if n.view > hs.lastVoted && qcView(p.Block.LastCommit) >= hs.lockedView {
+		hs.vote(n)
+	}
+	hs.replayVotes(p.Block.Hash)
+	return nil
+}
+
+// processQC обновляет highQC, блокировку и фиксирует блок, завершивший
+// цепочку из трёх последовательных видов
+func (hs *HotStuff) processQC(qc *blockchain.Commit) {
+	if qc == nil || hs.stopped.Load() {
+		return
+	}
+	if qc.Round > qcView(hs.highQC) {
+		hs.highQC = qc
+		hs.failures = 0
+	}
+	hs.enterView(qc.Round + 1)
+
+	// b2 сертифицирован qc, b1 — заголовком b2, b0 — заголовком b1
+	b2 := hs.blocks[qc.BlockHash]
+	if b2 == nil {
+		return
+	}
+	b1 := hs.blocks[b2.block.PrevHash]
+	if b1 == nil {
+		return
+	}
+	if b1.view > hs.lockedView {
+		hs.lockedView = b1.view
+	}
+	b0 := hs.blocks[b1.block.PrevHash]
+	if b0 != nil && b2.view == b1.view+1 && b1.view == b0.view+1 {
+		hs.commit(b0, b1)
+	}
+}
+
+// commit фиксирует блок b0 и его незафиксированных предков. QC каждого
+// блока — заголовок следующего за ним блока ветки, для b0 — заголовок b1.
+func (hs *HotStuff) commit(b0, b1 *treeNode) {
+	branch, _ := hs.branch(b0.block.Hash)
+	for i, block := range branch {
+		next := b1.block
+		if i+1 < len(branch) {
+			next = branch[i+1]
+		}
+		block.Commit = next.LastCommit
+		if err := hs.backend.CommitBlock(block); err != nil {
+			// Без блока продолжать нельзя: узел ждёт синхронизации
+			fmt.Printf("❌ Failed to commit block %s at height %d: %v\n", block.Hash, block.Index, err)
+			return
+		}
+		fmt.Printf("✅ Height %d decided in view %d: %s\n", block.Index, hs.blocks[block.Hash].view, block.Hash)
+		hs.root = block
+		delete(hs.blocks, block.Hash)
+	}
+
+	// Ветки, не продолжающие новую вершину, больше не понадобятся
+	for h := range hs.blocks {
+		if _, ok := hs.branch(h); !ok {
+			delete(hs.blocks, h)
+		}
+	}
+	for view := range hs.votes {
+		if view < qcView(hs.highQC) {
+			delete(hs.votes, view)
+		}
+	}
+}
+
+// vote голосует за блок и отправляет голос лидеру следующего вида
+func (hs *HotStuff) vote(n *treeNode) {
+	hs.lastVoted = n.view
+	parentBranch, _ := hs.branch(n.block.PrevHash)
+	validators := hs.backend.Validators(parentBranch)
+	index := validatorIndex(validators, hs.address)
+	if index < 0 {
+		return
+	}
+	vote := &bft.Vote{
+		Type:           gossip.StatePrecommit,
+		Height:         n.block.Index,
+		Round:          n.view,
+		BlockHash:      n.block.Hash,
+		ValidatorIndex: index,
+		Validator:      hs.address,
+		Timestamp:      hs.clock.Now().Unix(),
+	}
+	sig, err := hs.signer.Sign(vote.SignBytes())
+	if err != nil {
+		fmt.Printf("❌ Failed to sign vote: %v\n", err)
+		return
+	}
+	vote.Signature = sig
+
+	leader := hs.backend.Leader(n.view + 1)
+	fmt.Printf("🗳 Vote for %s from %s in view %d → %s\n", n.block.Hash, hs.address, n.view, leader)
+	if leader == hs.address {
+		if err := hs.addVote(vote); err != nil {
+			fmt.Printf("❌ Own vote rejected: %v\n", err)
+		}
+		return
+	}
+	hs.send(func() { hs.backend.SendVote(leader, vote) })
+}
+
+func (hs *HotStuff) addVote(v *bft.Vote) error {
+	if v == nil || v.Type != gossip.StatePrecommit || v.Round < 0 {
+		return bft.ErrInvalidVote
+	}
+	if v.Round < qcView(hs.highQC) || v.Round+1 < hs.view {
+		return fmt.Errorf("%w: vote of view %d, current %d", ErrStaleMessage, v.Round, hs.view)
+	}
+	if leader := hs.backend.Leader(v.Round + 1); leader != hs.address {
+		return fmt.Errorf("%w: %d, leader %s", ErrNotLeader, v.Round+1, leader)
+	}
+	n := hs.blocks[v.BlockHash]
+	if n == nil {
+		// Голос обогнал предложение: учтём его, когда блок придёт
+		if len(hs.pendingVotes) < MaxPendingVotes {
+			hs.pendingVotes = append(hs.pendingVotes, v)
+		}
+		return nil
+	}
+	if n.view != v.Round || n.block.Index != v.Height {
+		return fmt.Errorf("%w: vote for %s at %d/%d, block is at %d/%d",
+			bft.ErrInvalidVote, v.BlockHash, v.Height, v.Round, n.block.Index, n.view)
+	}
+
+	votes := hs.votes[v.Round]
+	if votes == nil {
+		parentBranch, _ := hs.branch(n.block.PrevHash)
+		votes = bft.NewVoteSet(n.block.Index, n.view, gossip.StatePrecommit, hs.backend.Validators(parentBranch))
+		hs.votes[v.Round] = votes
+	}
+	if err := votes.AddVote(v); err != nil {
+		return err
+	}
+	if qc := bft.MakeCommit(votes, v.BlockHash); qc != nil && qc.Round > qcView(hs.highQC) {
+		fmt.Printf("📜 QC for %s formed in view %d\n", v.BlockHash, qc.Round)
+		hs.processQC(qc)
+		hs.propose()
+	}
+	return nil
+}
+
+// replayVotes учитывает голоса, пришедшие раньше блока hash
+func (hs *HotStuff) replayVotes(hash string) {
+	var rest []*bft.Vote
+	var ready []*bft.Vote
+	for _, v := range hs.pendingVotes {
+		if v.BlockHash == hash {
+			ready = append(ready, v)
+		} else if v.Round >= qcView(hs.highQC) {
+			rest = append(rest, v)
+		}
+	}
+	hs.pendingVotes = rest
+	for _, v := range ready {
+		if err := hs.addVote(v); err != nil {
+			fmt.Printf("❌ Rejected vote from %s: %v\n", v.Validator, err)
+		}
+	}
+}
+
+func (hs *HotStuff) addNewView(nv *NewView) error {
+	if nv == nil || nv.Vote == nil || nv.Vote.Type != gossip.StateNewView {
+		return fmt.Errorf("%w: malformed", ErrInvalidNewView)
+	}
+	v := nv.Vote
+	if v.Round < hs.view {
+		return fmt.Errorf("%w: new-view for %d, current %d", ErrStaleMessage, v.Round, hs.view)
+	}
+	if leader := hs.backend.Leader(v.Round); leader != hs.address {
+		return fmt.Errorf("%w: %d, leader %s", ErrNotLeader, v.Round, leader)
+	}
+	validators := hs.backend.Validators(nil)
+	if err := v.Verify(validators); err != nil {
+		return err
+	}
+	if qc := nv.HighQC; qc != nil {
+		if qc.Height != v.Height || qc.BlockHash != v.BlockHash || qc.Round >= v.Round {
+			return fmt.Errorf("%w: QC for %s at %d does not match signed %s at %d", ErrInvalidNewView, qc.BlockHash, qc.Height, v.BlockHash, v.Height)
+		}
+		// QC неизвестного блока не проверить: new-view учитывается без него
+		if branch, ok := hs.branch(qc.BlockHash); ok && qc.Round > qcView(hs.highQC) {
+			if err := hs.backend.VerifyQC(branch, qc); err != nil {
+				return fmt.Errorf("%w: %v", ErrInvalidQC, err)
+			}
+			hs.processQC(qc)
+		}
+	}
+
+	set := hs.newViews[v.Round]
+	if set == nil {
+		set = &newViewSet{voted: make(map[int]bool)}
+		hs.newViews[v.Round] = set
+	}
+	if set.voted[v.ValidatorIndex] {
+		return nil
+	}
+	set.voted[v.ValidatorIndex] = true
+	set.power += validators[v.ValidatorIndex].VotingPower()
+	if bft.HasQuorum(set.power, totalPower(validators)) {
+		hs.enterView(v.Round)
+		hs.propose()
+	}
+	return nil
+}
+
+// enterView переходит в вид view, если он больше текущего, и запускает его таймаут
+func (hs *HotStuff) enterView(view int64) {
+	if view <= hs.view {
+		return
+	}
+	hs.view = view
+	hs.idle = false
+	for v := range hs.newViews {
+		if v < view {
+			delete(hs.newViews, v)
+		}
+	}
+	fmt.Printf("🚀 Entering view %d. Leader: %s\n", view, hs.backend.Leader(view))
+	hs.schedule(hs.config.View(hs.failures))
+	hs.propose()
+}
+
+// propose предлагает блок, если узел — лидер текущего вида и у него есть
+// QC предыдущего вида или new-view от +2/3 мощности
+func (hs *HotStuff) propose() {
+	if hs.proposed >= hs.view || hs.backend.Leader(hs.view) != hs.address || hs.stopped.Load() {
+		return
+	}
+	ready := qcView(hs.highQC) == hs.view-1
+	if set := hs.newViews[hs.view]; set != nil && bft.HasQuorum(set.power, totalPower(hs.backend.Validators(nil))) {
+		ready = true
+	}
+	if !ready {
+		return
+	}
+	hash := hs.root.Hash
+	if hs.highQC != nil {
+		hash = hs.highQC.BlockHash
+	}
+	branch, ok := hs.branch(hash)
+	if !ok {
+		return
+	}
+	// Пустые блоки предлагаются, только пока в конвейере есть
+	// незафиксированные транзакции
+	if !hs.backend.HasPendingTxs() && !hasTransactions(branch) {
+		return
+	}
+
+	block, err := hs.backend.ProposeBlock(branch, hs.highQC)
+	if err != nil {
+		fmt.Printf("❌ Failed to propose block: %v\n", err)
+		return
+	}
+	p := &bft.Proposal{Height: block.Index, Round: hs.view, POLRound: -1, Proposer: hs.address, Block: block}
+	sig, err := hs.signer.Sign(p.SignBytes())
+	if err != nil {
+		fmt.Printf("❌ Failed to sign proposal: %v\n", err)
+		return
+	}
+	p.Signature = sig
+	hs.proposed = hs.view
+	fmt.Printf("✅ Proposed block %s with %d transactions in view %d\n", block.Hash, len(block.Transactions), hs.view)
+	hs.send(func() { hs.backend.BroadcastProposal(p) })
+	if err := hs.addProposal(p); err != nil {
+		fmt.Printf("❌ Own proposal rejected: %v\n", err)
+	}
+}
+
+// schedule запускает таймаут текущего вида
+func (hs *HotStuff) schedule(d time.Duration) {
+	view := hs.view
+	hs.clock.AfterFunc(d, func() { hs.handleTimeout(view) })
+}
+
+// handleTimeout завершает вид по таймауту. Пока предлагать нечего, вид
+// не меняется: узел проверяет пул каждые TimeoutIdle.
+func (hs *HotStuff) handleTimeout(view int64) {
+	hs.mu.Lock()
+	if hs.stopped.Load() || view != hs.view {
+		hs.mu.Unlock()
+		return
+	}
+
+	if !hs.backend.HasPendingTxs() && !hs.pipelineBusy() {
+		hs.idle = true
+		hs.schedule(hs.config.TimeoutIdle)
+		hs.unlockAndFlush()
+		return
+	}
+	if hs.idle {
+		// Транзакции появились: лидеру даётся полный таймаут вида
+		hs.idle = false
+		hs.propose()
+		hs.schedule(hs.config.View(hs.failures))
+		hs.unlockAndFlush()
+		return
+	}
+
+	fmt.Printf("⏰ View %d timed out\n", view)
+	hs.failures++
+	next := view + 1
+	nv := hs.newView(next)
+	hs.enterView(next)
+	if nv != nil {
+		if leader := hs.backend.Leader(next); leader == hs.address {
+			if err := hs.addNewView(nv); err != nil {
+				fmt.Printf("❌ Own new-view rejected: %v\n", err)
+			}
+		} else {
+			hs.send(func() { hs.backend.SendNewView(leader, nv) })
+		}
+	}
+	hs.unlockAndFlush()
+}
+
+// pipelineBusy сообщает, есть ли незафиксированные блоки с транзакциями
+func (hs *HotStuff) pipelineBusy() bool {
+	for _, n := range hs.blocks {
+		if len(n.block.Transactions) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// newView подписывает new-view вида view с highQC узла; nil — узел не валидатор
+func (hs *HotStuff) newView(view int64) *NewView {
+	validators := hs.backend.Validators(nil)
+	index := validatorIndex(validators, hs.address)
+	if index < 0 {
+		return nil
+	}
+	height, hash := hs.root.Index, hs.root.Hash
+	if hs.highQC != nil {
+		height, hash = hs.highQC.Height, hs.highQC.BlockHash
+	}
+	vote := &bft.Vote{
+		Type:           gossip.StateNewView,
+		Height:         height,
+		Round:          view,
+		BlockHash:      hash,
+		ValidatorIndex: index,
+		Validator:      hs.address,
+		Timestamp:      hs.clock.Now().Unix(),
+	}
+	sig, err := hs.signer.Sign(vote.SignBytes())
+	if err != nil {
+		fmt.Printf("❌ Failed to sign new-view: %v\n", err)
+		return nil
+	}
+	vote.Signature = sig
+	return &NewView{Vote: vote, HighQC: hs.highQC}
+}
+
+func hasTransactions(branch []*blockchain.Block) bool {
+	for _, b := range branch {
+		if len(b.Transactions) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// validatorIndex возвращает индекс валидатора в наборе или -1
+func validatorIndex(validators pos.ValidatorPool, address string) int {
+	for i, v := range validators {
+		if v.Address == address {
+			return i
+		}
+	}
+	return -1
+}
+
+func totalPower(validators pos.ValidatorPool) int64 {
+	var total int64
+	for _, v := range validators {
+		total += v.VotingPower()
+	}
+	return total
+}
+
+// send откладывает отправку до снятия блокировки
+func (hs *HotStuff) send(f func()) {
+	hs.outbox = append(hs.outbox, f)
+}
+
+func (hs *HotStuff) unlockAndFlush() {
+	outbox := hs.outbox
+	hs.outbox = nil
+	hs.mu.Unlock()
+	for _, f := range outbox {
+		f()
+	}
+}
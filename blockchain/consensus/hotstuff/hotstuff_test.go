@@ -0,0 +1,286 @@
+package hotstuff
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"blockchain/consensus/bft"
+	"blockchain/consensus/consensustest"
+	"blockchain/consensus/evidence"
+	"blockchain/consensus/pos"
+	"blockchain/network/gossip"
+	"blockchain/storage/blockchain"
+	"blockchain/storage/state"
+	"blockchain/storage/txpool"
+)
+
+var simStart = time.Unix(1700000000, 0)
+
+// simNetwork доставляет сообщения между автоматами синхронно и по порядку
+// и считает отправленные сообщения по видам
+type simNetwork struct {
+	*consensustest.Network[*HotStuff]
+	sent map[int64]int
+}
+
+func (net *simNetwork) deliver(from, to string, view int64, f func(hs *HotStuff)) {
+	if net.Send(from, to, f) {
+		net.sent[view]++
+	}
+}
+
+// testBackend — окружение автомата без состояния: блоки с транзакциями
+// предлагаются, пока не кончится общий запас txs, лидеры выбираются по кругу
+type testBackend struct {
+	address    string
+	validators pos.ValidatorPool
+	net        *simNetwork
+	txs        *int
+	committed  []*blockchain.Block
+}
+
+func (b *testBackend) Validators(branch []*blockchain.Block) pos.ValidatorPool { return b.validators }
+func (b *testBackend) HasPendingTxs() bool                                     { return *b.txs > 0 }
+
+func (b *testBackend) VerifyQC(branch []*blockchain.Block, qc *blockchain.Commit) error {
+	return bft.VerifyCommit(b.validators, qc)
+}
+
+func (b *testBackend) Leader(view int64) string {
+	return b.validators[view%int64(len(b.validators))].Address
+}
+
+func (b *testBackend) ValidateBlock(branch []*blockchain.Block, block *blockchain.Block) error {
+	return nil
+}
+
+func (b *testBackend) ProposeBlock(branch []*blockchain.Block, justify *blockchain.Commit) (*blockchain.Block, error) {
+	parent := testRoot()
+	if len(branch) > 0 {
+		parent = branch[len(branch)-1]
+	}
+	block := &blockchain.Block{Index: parent.Index + 1, Timestamp: parent.Timestamp, PrevHash: parent.Hash, Validator: b.address, LastCommit: justify}
+	if *b.txs > 0 {
+		*b.txs--
+		block.Transactions = []*txpool.Transaction{{ID: fmt.Sprintf("tx-%d", *b.txs), From: "alice", To: "bob", Amount: 1}}
+	}
+	block.Hash = block.CalculateHash()
+	return block, nil
+}
+
+func (b *testBackend) BroadcastProposal(p *bft.Proposal) {
+	for _, addr := range b.net.Addresses() {
+		if addr != b.address {
+			b.net.deliver(b.address, addr, p.Round, func(hs *HotStuff) { hs.HandleProposal(p) })
+		}
+	}
+}
+
+func (b *testBackend) SendVote(to string, v *bft.Vote) {
+	b.net.deliver(b.address, to, v.Round, func(hs *HotStuff) { hs.HandleVote(v) })
+}
+
+func (b *testBackend) SendNewView(to string, nv *NewView) {
+	b.net.deliver(b.address, to, nv.Vote.Round, func(hs *HotStuff) { hs.HandleNewView(nv) })
+}
+
+func (b *testBackend) CommitBlock(block *blockchain.Block) error {
+	b.committed = append(b.committed, block)
+	return nil
+}
+
+func testRoot() *blockchain.Block {
+	root := &blockchain.Block{Index: 0, Timestamp: simStart.Unix(), PrevHash: "genesis"}
+	root.Hash = root.CalculateHash()
+	return root
+}
+
+// newSimNetwork запускает n автоматов над корнем testRoot с запасом из txs
+// блоков с транзакциями; валидаторы из down не отправляют и не получают сообщений
+func newSimNetwork(n, txs int, down ...string) (*simNetwork, *bft.SimClock, map[string]*testBackend) {
+	clock := bft.NewSimClock(simStart)
+	validators := consensustest.Validators(n)
+	net := &simNetwork{Network: consensustest.NewNetwork[*HotStuff](down...), sent: make(map[int64]int)}
+
+	backends := make(map[string]*testBackend)
+	for _, v := range validators {
+		backend := &testBackend{address: v.Address, validators: validators, net: net, txs: &txs}
+		backends[v.Address] = backend
+		net.Nodes[v.Address] = NewHotStuff(v.Address, consensustest.Signer(v.Address), backend, clock, nil)
+	}
+
+	// Сообщения доставляются после того, как все автоматы запущены
+	net.Hold(func() {
+		for _, addr := range net.Addresses() {
+			if !net.Down[addr] {
+				net.Nodes[addr].Start(testRoot())
+			}
+		}
+	})
+	return net, clock, backends
+}
+
+// checkCommitted проверяет, что узлы зафиксировали одинаковые блоки по
+// порядку и у каждого блока есть QC кворума
+func checkCommitted(t *testing.T, backends map[string]*testBackend, down map[string]bool, minTxBlocks int) {
+	t.Helper()
+	var reference []*blockchain.Block
+	for addr, b := range backends {
+		if down[addr] {
+			continue
+		}
+		txBlocks := 0
+		for i, block := range b.committed {
+			if block.Index != int64(i+1) {
+				t.Fatalf("%s committed block %d at position %d", addr, block.Index, i)
+			}
+			if err := bft.VerifyCommit(b.validators, block.Commit); err != nil || block.Commit.BlockHash != block.Hash {
+				t.Fatalf("%s committed block %d without a valid QC: %v", addr, block.Index, err)
+			}
+			if len(block.Transactions) > 0 {
+				txBlocks++
+			}
+		}
+		if txBlocks < minTxBlocks {
+			t.Fatalf("%s committed %d blocks with transactions, expected %d", addr, txBlocks, minTxBlocks)
+		}
+		if reference == nil {
+			reference = b.committed
+		}
+		for i := 0; i < min(len(reference), len(b.committed)); i++ {
+			if reference[i].Hash != b.committed[i].Hash {
+				t.Fatalf("Nodes diverged at height %d", i+1)
+			}
+		}
+	}
+}
+
+// TestHotStuff_PipelinedCommit - без сбоев каждый вид даёт новый QC, блок
+// фиксируется через два вида, а на вид приходится O(n) сообщений
+func TestHotStuff_PipelinedCommit(t *testing.T) {
+	const n = 4
+	net, clock, backends := newSimNetwork(n, 5)
+
+	checkCommitted(t, backends, nil, 5)
+	for view, sent := range net.sent {
+		// Предложение лидера n-1 валидаторам и голоса n-1 валидаторов лидеру
+		if sent > 2*(n-1) {
+			t.Errorf("Expected at most %d messages in view %d, got %d", 2*(n-1), view, sent)
+		}
+	}
+	if clock.Now() != simStart {
+		t.Errorf("Expected no timeouts without failures, clock advanced to %v", clock.Now())
+	}
+
+	// Блок с транзакциями фиксируется, когда QC получает второй его потомок
+	view, highQC, locked := net.Nodes["v1"].State()
+	if highQC != view-1 || locked != highQC-1 {
+		t.Errorf("Expected QC of the previous view and lock one view behind, got view %d, QC %d, lock %d", view, highQC, locked)
+	}
+	// Пустые блоки лишь проталкивают блоки с транзакциями: после фиксации
+	// последнего из них лидер, собравший QC, фиксирует не больше одного пустого
+	for addr, b := range backends {
+		if len(b.committed) > 6 {
+			t.Errorf("Expected the pipeline to stop after transactions are committed, %s committed %d blocks", addr, len(b.committed))
+		}
+	}
+}
+
+// TestHotStuff_ViewChangeOnFaultyLeader - вид недоступного лидера
+// завершается по таймауту, а следующий лидер продолжает по new-view.
+// Для фиксации нужны четыре исправных лидера подряд, поэтому валидаторов 7.
+func TestHotStuff_ViewChangeOnFaultyLeader(t *testing.T) {
+	down := map[string]bool{"v2": true}
+	net, clock, backends := newSimNetwork(7, 6, "v2")
+
+	for i := 0; i < 20; i++ {
+		clock.Advance(DefaultConfig().View(int64(i)))
+	}
+
+	// Голоса за блок вида 1 ушли недоступному лидеру вида 2: блок остаётся
+	// без QC, и следующий лидер строит поверх блока вида 0
+	checkCommitted(t, backends, down, 5)
+	view, _, _ := net.Nodes["v0"].State()
+	if view < 8 {
+		t.Errorf("Expected views to advance past the faulty leader, at view %d", view)
+	}
+}
+
+// TestHotStuff_NoVoteBelowLock - валидатор не голосует за блок, QC которого
+// ниже его блокировки
+func TestHotStuff_NoVoteBelowLock(t *testing.T) {
+	net, _, backends := newSimNetwork(4, 3)
+	hs := net.Nodes["v1"]
+	_, _, locked := hs.State()
+	if locked < 1 {
+		t.Fatalf("Expected v1 to be locked, lock view %d", locked)
+	}
+
+	// Лидер вида предлагает блок поверх вершины, игнорируя блокировку на её потомке
+	view, _, _ := hs.State()
+	leader := backends["v0"].Leader(view)
+	root := hs.root
+	block := &blockchain.Block{Index: root.Index + 1, Timestamp: root.Timestamp, PrevHash: root.Hash, Validator: leader, LastCommit: root.Commit}
+	block.Hash = block.CalculateHash()
+	p := &bft.Proposal{Height: block.Index, Round: view, POLRound: -1, Proposer: leader, Block: block}
+
+	before := net.sent[view]
+	if err := hs.HandleProposal(p); err != nil {
+		t.Fatalf("Expected the fork to be accepted into the tree, got %v", err)
+	}
+	if net.sent[view] != before {
+		t.Errorf("Expected no vote for a block below the lock, %d messages sent", net.sent[view]-before)
+	}
+}
+
+// TestNode_RejectsFabricatedEvidence - блок HotStuff с поддельным
+// доказательством нарушения отклоняется и при голосовании, и при синхронизации
+func TestNode_RejectsFabricatedEvidence(t *testing.T) {
+	validators := consensustest.Validators(2)
+	genesis := &state.Genesis{}
+	for _, v := range validators {
+		genesis.Validators = append(genesis.Validators, state.GenesisValidator{Address: v.Address, SelfBond: 100})
+	}
+	machine, err := state.NewStateMachine(blockchain.NewBlockchain(), genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := NewNode("v0", validators[0], validators, txpool.NewTransactionPool(), machine, consensustest.Signer("v0"), "v0", nil)
+
+	block, _, err := machine.BuildBlockAfter(nil, nil, nil, "v0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Evidence = []*blockchain.Evidence{{Type: blockchain.DuplicateVote, Height: 0, Validator: "v1"}}
+	block.Hash = block.CalculateHash()
+	sig, err := consensustest.Signer("v0").Sign(block.SerializeWithoutSignature())
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.Signature = sig
+
+	// QC набора валидаторов высоты блока: синхронизация доходит до проверки состояния
+	precommits := bft.NewVoteSet(block.Index, 0, gossip.StatePrecommit, node.Validators(nil))
+	for i, v := range node.Validators(nil) {
+		vote := &bft.Vote{Type: gossip.StatePrecommit, Height: block.Index, BlockHash: block.Hash, ValidatorIndex: i, Validator: v.Address, Timestamp: simStart.Unix()}
+		if vote.Signature, err = consensustest.Signer(v.Address).Sign(vote.SignBytes()); err != nil {
+			t.Fatal(err)
+		}
+		if err := precommits.AddVote(vote); err != nil {
+			t.Fatal(err)
+		}
+	}
+	block.Commit = bft.MakeCommit(precommits, block.Hash)
+
+	if err := node.ValidateBlock(nil, block); !errors.Is(err, evidence.ErrInvalidEvidence) {
+		t.Errorf("Expected ErrInvalidEvidence on validation, got %v", err)
+	}
+	if err := node.SyncBlock(block); !errors.Is(err, evidence.ErrInvalidEvidence) {
+		t.Errorf("Expected ErrInvalidEvidence on sync, got %v", err)
+	}
+	if machine.Chain.Height() != 0 {
+		t.Errorf("Expected block with fabricated evidence not committed")
+	}
+}
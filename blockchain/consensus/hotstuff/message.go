@@ -0,0 +1,78 @@
+package hotstuff
+
+import (
+	"fmt"
+
+	"blockchain/codec"
+	"blockchain/consensus/bft"
+	"blockchain/network/gossip"
+	"blockchain/storage/blockchain"
+)
+
+// сообщения HotStuff: предложение — bft.Proposal, голос — bft.Vote
+// (precommit вида), смена вида — NewView
+
+// NewView — переход валидатора в вид по таймауту. Подписывается как голос
+// типа gossip.StateNewView: раунд — новый вид, высота и хэш — блок HighQC
+// (вершина цепочки, если QC у узла нет).
+type NewView struct {
+	Vote   *bft.Vote
+	HighQC *blockchain.Commit
+}
+
+// Encode кодирует new-view в каноническом формате
+func (nv *NewView) Encode() []byte {
+	w := codec.NewWriter(codec.KindNewView)
+	w.Bytes(nv.Vote.SignBytes())
+	if nv.HighQC != nil {
+		w.Bytes(nv.HighQC.Encode())
+	} else {
+		w.Bytes(nil)
+	}
+	return w.Result()
+}
+
+// Message возвращает подписанное сообщение с new-view
+func (nv *NewView) Message() *gossip.SignedConsensusMessage {
+	return &gossip.SignedConsensusMessage{
+		Type:      gossip.StateNewView,
+		Height:    nv.Vote.Height,
+		Round:     nv.Vote.Round,
+		From:      nv.Vote.Validator,
+		Data:      nv.Encode(),
+		Signature: nv.Vote.Signature,
+	}
+}
+
+// NewViewFromMessage восстанавливает new-view из подписанного сообщения;
+// подпись проверяет автомат по набору валидаторов
+func NewViewFromMessage(msg *gossip.SignedConsensusMessage) (*NewView, error) {
+	r, err := codec.NewReader(msg.Data, codec.KindNewView)
+	if err != nil {
+		return nil, err
+	}
+	voteData := r.Bytes()
+	qcData := r.Bytes()
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode new-view: %w", err)
+	}
+
+	vote, err := bft.VoteFromMessage(&gossip.SignedConsensusMessage{
+		Type:      msg.Type,
+		Height:    msg.Height,
+		Round:     msg.Round,
+		From:      msg.From,
+		Data:      voteData,
+		Signature: msg.Signature,
+	})
+	if err != nil {
+		return nil, err
+	}
+	nv := &NewView{Vote: vote}
+	if len(qcData) > 0 {
+		if nv.HighQC, err = blockchain.DecodeCommit(qcData); err != nil {
+			return nil, fmt.Errorf("failed to decode new-view QC: %w", err)
+		}
+	}
+	return nv, nil
+}
@@ -0,0 +1,323 @@
+package hotstuff
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"blockchain/consensus"
+	"blockchain/consensus/bft"
+	"blockchain/consensus/pos"
+	"blockchain/crypto/signature"
+	"blockchain/network/blocksync"
+	"blockchain/network/gossip"
+	"blockchain/network/p2p"
+	"blockchain/network/peer"
+	"blockchain/storage/blockchain"
+	"blockchain/storage/state"
+	"blockchain/storage/txpool"
+)
+
+// Node — узел, участвующий в консенсусе HotStuff. Узел реализует Backend
+// автомата HotStuff: собирает блоки поверх незафиксированной ветки,
+// проверяет и фиксирует их через StateMachine, отправляет сообщения пирам.
+// О зафиксированных блоках узел сообщает обработчикам OnFinalized.
+type Node struct {
+	consensus.Events
+
+	ID            string
+	Address       string
+	Validator     *pos.Validator
+	ValidatorPool pos.ValidatorPool // набор по умолчанию, пока в состоянии нет валидаторов
+	Peers         []string
+	TxPool        *txpool.TransactionPool
+	Chain         *blockchain.Blockchain
+	StateMachine  *state.StateMachine
+	Signer        signature.Signer
+	HotStuff      *HotStuff
+	Sync          *blocksync.Reactor
+	Transport     *p2p.Transport
+
+	sets    map[int64]pos.ValidatorPool // наборы валидаторов зафиксированных высот
+	setsMu  sync.Mutex
+	syncing atomic.Bool
+	stopped atomic.Bool
+}
+
+// NewNode создаёт узел HotStuff.
+// config — таймауты пейсмейкера (по умолчанию DefaultConfig).
+func NewNode(
+	id string,
+	validator *pos.Validator,
+	validatorPool pos.ValidatorPool,
+	txPool *txpool.TransactionPool,
+	stateMachine *state.StateMachine,
+	signer signature.Signer,
+	address string,
+	peers []string,
+	config ...*Config,
+) *Node {
+	n := &Node{
+		ID:            id,
+		Address:       address,
+		Validator:     validator,
+		ValidatorPool: validatorPool,
+		Peers:         peers,
+		TxPool:        txPool,
+		Chain:         stateMachine.Chain,
+		StateMachine:  stateMachine,
+		Signer:        signer,
+		Transport:     p2p.Shared(address, nil),
+		sets:          make(map[int64]pos.ValidatorPool),
+	}
+	var cfg *Config
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	// QC блоков — сертификаты bft, и проверяются так же
+	stateMachine.SetCommitVerifier(bft.VerifyCommit)
+	n.HotStuff = NewHotStuff(address, signer, n, nil, cfg)
+	n.Sync = blocksync.NewReactor(n, nil)
+	return n
+}
+
+// Start запускает приём сообщений, догоняет пиров и начинает консенсус
+// над вершиной цепочки. Остановленный узел можно запустить снова.
+func (n *Node) Start() {
+	if err := StartTCPServer(n); err != nil {
+		fmt.Printf("❌ Failed to start TCP server on %s: %v\n", n.Address, err)
+	}
+	n.stopped.Store(false)
+	n.syncing.Store(true)
+	n.syncBlocks()
+	n.syncing.Store(false)
+	n.HotStuff.Start(n.Chain.GetLatestBlock())
+}
+
+// Stop останавливает консенсус; сервер продолжает отвечать на запросы пиров
+func (n *Node) Stop() {
+	n.stopped.Store(true)
+	n.HotStuff.Stop()
+}
+
+// CatchUp догоняет пиров, если узел отстал: консенсус продолжается над
+// новой вершиной цепочки. Остановленный узел и повторный вызов во время
+// синхронизации ничего не делают.
+func (n *Node) CatchUp() {
+	if n.stopped.Load() || !n.syncing.CompareAndSwap(false, true) {
+		return
+	}
+	defer n.syncing.Store(false)
+	before := n.Chain.Height()
+	if height := n.syncBlocks(); height > before && !n.stopped.Load() {
+		n.HotStuff.Start(n.Chain.GetLatestBlock())
+	}
+}
+
+// syncBlocks синхронизирует блоки с пирами и возвращает высоту вершины
+func (n *Node) syncBlocks() int64 {
+	timeout := n.Sync.Config().RequestTimeout
+	var peers []blocksync.Peer
+	for _, addr := range n.Peers {
+		if addr != n.Address {
+			peers = append(peers, blocksync.NewTCPPeer(n.Transport, addr, timeout))
+		}
+	}
+	height, err := n.Sync.Sync(peers)
+	if err != nil {
+		fmt.Printf("⚠️ Block sync stopped at height %d: %v\n", height, err)
+	}
+	return height
+}
+
+// Status возвращает вершину цепочки узла для синхронизации блоков
+func (n *Node) Status() *blocksync.Status {
+	return blocksync.ChainStatus(n.Chain)
+}
+
+// SyncBlock проверяет блок, полученный при синхронизации: QC набора
+// валидаторов его высоты и сам блок вместе с доказательствами нарушений
+// (см. state.ApplyBlock) — и фиксирует его. Консенсус над
+// пройденной вершиной останавливается до конца синхронизации.
+func (n *Node) SyncBlock(block *blockchain.Block) error {
+	if block.Commit != nil && (block.Commit.Height != block.Index || block.Commit.BlockHash != block.Hash) {
+		return fmt.Errorf("%w: commit for %s at %d does not match block %s at %d",
+			bft.ErrInvalidCommit, block.Commit.BlockHash, block.Commit.Height, block.Hash, block.Index)
+	}
+	if err := bft.VerifyCommit(n.Validators(nil), block.Commit); err != nil {
+		return err
+	}
+	if err := n.StateMachine.VerifyBlock(block); err != nil {
+		return err
+	}
+	if err := n.CommitBlock(block); err != nil {
+		return err
+	}
+	n.HotStuff.Stop()
+	return nil
+}
+
+// Validators возвращает набор валидаторов блока, продолжающего ветку:
+// набор из состояния стейкинга после ветки, пока оно не пусто, иначе
+// ValidatorPool. Ветка, не продолжающая вершину цепочки, набора не имеет.
+func (n *Node) Validators(branch []*blockchain.Block) pos.ValidatorPool {
+	set, err := n.StateMachine.ValidatorsAfter(branch)
+	if err != nil {
+		return nil
+	}
+	if len(set) == 0 {
+		return n.ValidatorPool
+	}
+	return set
+}
+
+// VerifyQC проверяет QC последнего блока ветки набором его высоты. Для
+// вершины цепочки используется набор, запомненный при её фиксации, а если
+// его нет (например, после перезапуска) — текущий набор.
+func (n *Node) VerifyQC(branch []*blockchain.Block, qc *blockchain.Commit) error {
+	if len(branch) > 0 {
+		return bft.VerifyCommit(n.Validators(branch[:len(branch)-1]), qc)
+	}
+	n.setsMu.Lock()
+	set, ok := n.sets[qc.Height]
+	n.setsMu.Unlock()
+	if !ok {
+		set = n.Validators(nil)
+	}
+	return bft.VerifyCommit(set, qc)
+}
+
+// Leader выбирает лидера вида взвешенной по стейку выборкой из набора
+// следующей высоты (см. pos.ProposerIndex). Выбор зависит только от набора
+// и вида, поэтому совпадает на узлах с одной вершиной цепочки; после смены
+// набора отставшие узлы расходятся с остальными до фиксации блока эпохи,
+// и такие виды завершаются по таймауту.
+func (n *Node) Leader(view int64) string {
+	if v := n.Validators(nil).Proposer("", view, 0); v != nil {
+		return v.Address
+	}
+	return ""
+}
+
+// HasPendingTxs сообщает, есть ли в пуле исполнимые транзакции
+func (n *Node) HasPendingTxs() bool {
+	return len(n.TxPool.Pending()) > 0
+}
+
+// ProposeBlock собирает блок поверх ветки из транзакций пула, ещё не
+// включённых в ветку, и подписывает его. Блок без транзакций допустим.
+func (n *Node) ProposeBlock(branch []*blockchain.Block, justify *blockchain.Commit) (*blockchain.Block, error) {
+	included := make(map[string]bool)
+	for _, block := range branch {
+		for _, tx := range block.Transactions {
+			included[tx.ID] = true
+		}
+	}
+
+	var validTxs []*txpool.Transaction
+	for _, tx := range n.TxPool.GetTransactions(n.Chain.Fees().MaxTxsPerBlock + len(included)) {
+		if included[tx.ID] {
+			continue
+		}
+		if tx.Verify(n.StateMachine.ChainID()) {
+			validTxs = append(validTxs, tx)
+		} else {
+			fmt.Printf("❌ Invalid transaction: %s\n", tx.ID)
+		}
+	}
+
+	// Оставляем только транзакции, проходящие проверку баланса и nonce после ветки
+	block, rejected, err := n.StateMachine.BuildBlockAfter(branch, justify, validTxs, n.Address)
+	if err != nil {
+		return nil, err
+	}
+	for _, tx := range rejected {
+		n.TxPool.RemoveTransaction(tx.ID)
+	}
+
+	signatureBytes, err := n.Signer.Sign(block.SerializeWithoutSignature())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign block: %w", err)
+	}
+	block.Signature = signatureBytes
+	return block, nil
+}
+
+// ValidateBlock проверяет заголовок, подпись пропосера и переход состояния
+// поверх ветки, включая доказательства нарушений: подписи по набору высоты
+// нарушения, возраст и повторное включение (см. state.ApplyBlock). QC в
+// заголовке проверяет автомат.
+func (n *Node) ValidateBlock(branch []*blockchain.Block, block *blockchain.Block) error {
+	return n.StateMachine.VerifyBlockAfter(branch, block)
+}
+
+// BroadcastProposal рассылает предложение, подписанное автоматом
+func (n *Node) BroadcastProposal(p *bft.Proposal) {
+	n.send(n.Peers, &gossip.SignedConsensusMessage{
+		Type:      gossip.StatePropose,
+		Height:    p.Height,
+		Round:     p.Round,
+		From:      n.Address,
+		Data:      p.Encode(),
+		Signature: p.Signature,
+	})
+}
+
+// SendVote отправляет голос лидеру следующего вида
+func (n *Node) SendVote(to string, v *bft.Vote) {
+	n.send([]string{to}, &gossip.SignedConsensusMessage{
+		Type:      v.Type,
+		Height:    v.Height,
+		Round:     v.Round,
+		From:      n.Address,
+		Data:      v.SignBytes(),
+		Signature: v.Signature,
+	})
+}
+
+// SendNewView отправляет new-view лидеру вида
+func (n *Node) SendNewView(to string, nv *NewView) {
+	n.send([]string{to}, nv.Message())
+}
+
+// CommitBlock сохраняет блок вместе с QC и очищает пул
+func (n *Node) CommitBlock(block *blockchain.Block) error {
+	// Набор высоты блока понадобится для проверки QC новой вершины
+	set := n.Validators(nil)
+	status, err := n.StateMachine.ImportBlock(block)
+	if err != nil {
+		return fmt.Errorf("failed to apply block: %w", err)
+	}
+	n.setsMu.Lock()
+	n.sets[block.Index] = set
+	delete(n.sets, block.Index-1)
+	n.setsMu.Unlock()
+
+	txIDs := make([]string, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		txIDs[i] = tx.ID
+	}
+	n.TxPool.RemoveTransactions(txIDs)
+
+	// Несколько узлов одного процесса разделяют StateMachine: блок уже
+	// импортирован другим узлом
+	if status != state.ImportCanonical {
+		return nil
+	}
+	fmt.Printf("✅ Block added to chain: %s\n", block.Hash)
+	if tips := block.TotalTips(); tips > 0 {
+		fmt.Printf("💸 Validator %s earned %.2f fees\n", block.Validator, tips)
+	}
+	n.Finalize(block)
+	return nil
+}
+
+// send ставит сообщение в очереди соединений с узлами addrs, кроме себя;
+// автомат не ждёт отправки
+func (n *Node) send(addrs []string, msg *gossip.SignedConsensusMessage) {
+	peers := make([]*peer.Peer, 0, len(addrs))
+	for _, addr := range addrs {
+		peers = append(peers, &peer.Peer{Addr: addr, ID: addr})
+	}
+	gossip.BroadcastSignedConsensusMessage(n.Transport, peers, msg)
+}
@@ -0,0 +1,43 @@
+package hotstuff
+
+import (
+	"fmt"
+
+	"blockchain/network/blocksync"
+	"blockchain/network/gossip"
+	"blockchain/network/p2p"
+)
+
+// StartTCPServer — регистрирует обработчики каналов узла HotStuff в
+// транспорте и начинает приём соединений. Вызывается при каждом запуске
+// узла, чтобы каналы общего с BFT транспорта обслуживал HotStuff.
+func StartTCPServer(node *Node) error {
+	t := node.Transport
+	t.OnReceive(p2p.ChannelConsensus, func(from string, data []byte) {
+		handleMessage(node, data)
+	})
+	blocksync.Serve(t, node.Chain)
+	// Незафиксированная ветка отдаётся узлам, пропустившим предложения
+	t.OnRequest(p2p.ChannelBlocks, func(from string, data []byte) ([]byte, error) {
+		msg, err := gossip.DecodeSignedMessage(data)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Type != gossip.MsgBlock {
+			return nil, fmt.Errorf("unexpected %s request", msg.Type)
+		}
+		return blocksync.EncodeBlocks(node.HotStuff.Branch(string(msg.Data))), nil
+	})
+	return t.Listen()
+}
+
+// handleMessage — обработка входящего сообщения консенсуса
+func handleMessage(node *Node, data []byte) {
+	msg, err := gossip.DecodeSignedMessage(data)
+	if err != nil {
+		fmt.Printf("❌ Failed to decode message: %v\n", err)
+		return
+	}
+	fmt.Printf("📥 Received message from %s: %s\n", msg.From, msg.Type)
+	NewMessageHandler(node).ProcessMessage(msg)
+}
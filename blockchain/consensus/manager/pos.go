@@ -0,0 +1,219 @@
+package manager
+
+// движок консенсуса PoS
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"blockchain/consensus"
+	"blockchain/consensus/evidence"
+	"blockchain/consensus/pos"
+	"blockchain/storage/blockchain"
+)
+
+func init() {
+	consensus.Register(string(ConsensusPoS), NewPoSEngine)
+}
+
+// DefaultPoSInterval — пауза между попытками создать блок
+const DefaultPoSInterval = 10 * time.Second
+
+// PoSEngine — движок PoS: блок высоты создаёт валидатор, выбранный
+// взвешенной по стейку выборкой (pos.ValidatorPool.Proposer); узел создаёт
+// блоки за своих валидаторов. Блок финализируется сразу при фиксации.
+// Доказательства нарушений из пула Evidence включаются в создаваемые блоки.
+type PoSEngine struct {
+	consensus.Events
+	env      *consensus.Env
+	Interval time.Duration
+	Evidence *evidence.Pool
+
+	stopped  atomic.Bool
+	stop     chan struct{}
+	mu       sync.Mutex
+	commitMu sync.Mutex // фиксация блока; Stop дожидается её окончания
+}
+
+// NewPoSEngine создаёт движок PoS для валидаторов окружения
+func NewPoSEngine(env *consensus.Env) (consensus.Engine, error) {
+	e := &PoSEngine{env: env, Interval: DefaultPoSInterval}
+	e.stopped.Store(true)
+	evidenceConfig := evidence.DefaultConfig()
+	evidenceConfig.MaxAge = env.State.StakingConfig().EvidenceMaxAge
+	e.Evidence = evidence.NewPool(func(int64) pos.ValidatorPool { return e.validators() }, evidenceConfig)
+	// Доказательства, уже включённые в недавние блоки, повторно не принимаются
+	chain := env.State.Chain
+	for h := max(1, chain.Height()-evidenceConfig.MaxAge); h <= chain.Height(); h++ {
+		if block := chain.GetBlockByHeight(h); block != nil {
+			e.Evidence.Update(block)
+		}
+	}
+	return e, nil
+}
+
+func (e *PoSEngine) Name() string {
+	return string(ConsensusPoS)
+}
+
+// Start запускает создание блоков с высоты height
+func (e *PoSEngine) Start(height int64) error {
+	if next := e.env.State.Chain.Height() + 1; height != next {
+		return fmt.Errorf("chain expects height %d, not %d", next, height)
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.stopped.Load() {
+		return nil
+	}
+	e.stopped.Store(false)
+	e.stop = make(chan struct{})
+	for _, v := range e.env.Validators {
+		fmt.Printf("⛏️ PoS Validator %s started\n", v.Address)
+	}
+	go e.run(e.stop)
+	return nil
+}
+
+// Stop останавливает создание блоков, дождавшись фиксации блока, если
+// она уже идёт
+func (e *PoSEngine) Stop() {
+	e.mu.Lock()
+	if e.stopped.Swap(true) {
+		e.mu.Unlock()
+		return
+	}
+	close(e.stop)
+	e.mu.Unlock()
+
+	e.commitMu.Lock()
+	e.commitMu.Unlock()
+}
+
+func (e *PoSEngine) run(stop chan struct{}) {
+	ticker := time.NewTicker(e.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			e.produce()
+		}
+	}
+}
+
+// validators возвращает набор следующей высоты: из состояния стейкинга,
+// пока оно не пусто, иначе набор по умолчанию
+func (e *PoSEngine) validators() pos.ValidatorPool {
+	if set := e.env.State.Validators(); len(set) > 0 {
+		return set
+	}
+	return e.env.ValidatorPool
+}
+
+// proposer возвращает валидатора узла, который создаёт блок после prev, или nil
+func (e *PoSEngine) proposer(prev *blockchain.Block) *pos.Validator {
+	selected := e.validators().Proposer(prev.Hash, prev.Index+1, 0)
+	if selected == nil {
+		return nil
+	}
+	for _, v := range e.env.Validators {
+		if v.Address == selected.Address {
+			return v
+		}
+	}
+	return nil
+}
+
+// ProposeBlock собирает блок высоты height от имени выбранного валидатора узла
+func (e *PoSEngine) ProposeBlock(height int64) (*blockchain.Block, error) {
+	prev := e.env.State.Chain.GetLatestBlock()
+	if prev == nil || prev.Index+1 != height {
+		return nil, fmt.Errorf("chain expects height %d, not %d", e.env.State.Chain.Height()+1, height)
+	}
+	validator := e.proposer(prev)
+	if validator == nil {
+		return nil, fmt.Errorf("no local validator is the proposer at height %d", height)
+	}
+
+	transactions := e.env.TxPool.GetTransactions(e.env.State.Chain.Fees().MaxTxsPerBlock)
+	if len(transactions) == 0 {
+		return nil, fmt.Errorf("no transactions to propose")
+	}
+
+	// Собираем блок только из транзакций, которые проходят проверку баланса
+	// и nonce; доказательства наказывают нарушителей при применении блока
+	block, rejected := e.env.State.BuildBlock(transactions, validator.Address, e.Evidence.Pending()...)
+	for _, tx := range rejected {
+		e.env.TxPool.RemoveTransaction(tx.ID)
+	}
+	if block == nil {
+		return nil, fmt.Errorf("no valid transactions to propose")
+	}
+
+	signatureBytes, err := e.env.Signer.Sign(block.SerializeWithoutSignature())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign block: %w", err)
+	}
+	block.Signature = signatureBytes
+	return block, nil
+}
+
+// ValidateBlock проверяет, что блок создан выбранным для его высоты
+// валидатором, и проверяет сам блок и переход состояния
+func (e *PoSEngine) ValidateBlock(block *blockchain.Block) error {
+	prev := e.env.State.Chain.GetLatestBlock()
+	if prev == nil {
+		return fmt.Errorf("empty chain")
+	}
+	if selected := e.validators().Proposer(prev.Hash, prev.Index+1, 0); selected == nil || selected.Address != block.Validator {
+		return fmt.Errorf("block %d proposed by %s, not by the selected validator", block.Index, block.Validator)
+	}
+	return e.env.State.VerifyBlock(block)
+}
+
+// produce создаёт и фиксирует блок следующей высоты, если его предлагает валидатор узла
+func (e *PoSEngine) produce() {
+	prev := e.env.State.Chain.GetLatestBlock()
+	if prev == nil || e.stopped.Load() {
+		return
+	}
+	block, err := e.ProposeBlock(prev.Index + 1)
+	if err != nil {
+		return
+	}
+	e.commitMu.Lock()
+	if e.stopped.Load() {
+		e.commitMu.Unlock()
+		return
+	}
+	err = e.env.State.CommitBlock(block)
+	e.commitMu.Unlock()
+	if err != nil {
+		fmt.Printf("❌ Failed to commit block %d: %v\n", block.Index, err)
+		return
+	}
+
+	// Валидатору достаются только надбавки: базовая комиссия сжигается или уходит в казначейство
+	totalFee := block.TotalTips()
+	for _, v := range e.env.Validators {
+		if v.Address == block.Validator {
+			v.AddCommission(int64(totalFee))
+		}
+	}
+
+	// Remove processed transactions from pool
+	txIDs := make([]string, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		txIDs[i] = tx.ID
+	}
+	e.env.TxPool.RemoveTransactions(txIDs)
+	e.Evidence.Update(block)
+
+	fmt.Printf("✅ Block %d created by PoS validator %s with total fee: %.2f\n",
+		block.Index, block.Validator, totalFee)
+	e.Finalize(block)
+}
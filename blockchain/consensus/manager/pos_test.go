@@ -0,0 +1,112 @@
+package manager
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"blockchain/consensus"
+	"blockchain/consensus/consensustest"
+	"blockchain/consensus/evidence"
+	"blockchain/consensus/pos"
+	"blockchain/crypto/signature"
+	"blockchain/network/gossip"
+	"blockchain/storage/blockchain"
+	"blockchain/storage/state"
+	"blockchain/storage/txpool"
+)
+
+// TestPoSEngine_IncludesEvidence - блок PoS включает доказательства из пула
+// движка, нарушитель наказывается, а включённое доказательство уходит из пула
+func TestPoSEngine_IncludesEvidence(t *testing.T) {
+	// Оба валидатора ведёт узел одним ключом: блок создаёт любой из них
+	signer := consensustest.Signer("v1")
+	pubKey, err := signature.ParsePublicKey(signer.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature.RegisterPublicKey("v2", pubKey)
+
+	genesis := &state.Genesis{
+		Alloc: map[string]float64{"alice": 100},
+		Validators: []state.GenesisValidator{
+			{Address: "v1", SelfBond: 1000},
+			{Address: "v2", SelfBond: 500},
+		},
+	}
+	machine, err := state.NewStateMachine(blockchain.NewBlockchain(), genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &consensus.Env{
+		State:  machine,
+		TxPool: txpool.NewTransactionPool(),
+		Validators: []*pos.Validator{
+			pos.NewValidatorWithAddress("v1", "v1", 1000),
+			pos.NewValidatorWithAddress("v2", "v2", 500),
+		},
+		Signer: signer,
+	}
+	created, err := NewPoSEngine(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	engine := created.(*PoSEngine)
+	if err := engine.Start(1); err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Stop()
+
+	alice := consensustest.Signer("alice")
+	send := func(nonce uint64) {
+		t.Helper()
+		tx := &txpool.Transaction{From: "alice", To: "bob", Amount: 1, Fee: 0.01, Nonce: nonce, ChainID: txpool.DefaultChainID}
+		tx.ID = tx.ComputeID()
+		sig, err := alice.Sign(tx.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.Signature = hex.EncodeToString(sig)
+		if err := env.TxPool.AddTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+		engine.produce()
+	}
+	send(0)
+
+	// v2 подписал два разных precommit на высоте 1
+	set := machine.Validators()
+	index := -1
+	for i, v := range set {
+		if v.Address == "v2" {
+			index = i
+		}
+	}
+	vote := func(blockHash string) blockchain.SignedData {
+		data := gossip.VoteSignBytes(gossip.StatePrecommit, 1, 0, blockHash, index, 1700000000)
+		sig, err := signer.Sign(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return blockchain.SignedData{Data: data, Signature: sig}
+	}
+	e, err := evidence.NewDuplicateVote("v2", vote("a"), vote("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := engine.Evidence.Add(e); err != nil {
+		t.Fatalf("Evidence rejected by the pool: %v", err)
+	}
+	before := machine.Snapshot().Staking().Validators["v2"].Tokens
+
+	send(1)
+	block := machine.Chain.GetLatestBlock()
+	if block.Index != 2 || len(block.Evidence) != 1 || block.Evidence[0].Key() != e.Key() {
+		t.Fatalf("Expected block 2 to carry the evidence, got block %d with %d evidence", block.Index, len(block.Evidence))
+	}
+	if after := machine.Snapshot().Staking().Validators["v2"].Tokens; after >= before {
+		t.Errorf("Expected v2 to be slashed, tokens %f -> %f", before, after)
+	}
+	if pending := engine.Evidence.Pending(); len(pending) != 0 {
+		t.Errorf("Expected included evidence to leave the pool, %d pending", len(pending))
+	}
+}
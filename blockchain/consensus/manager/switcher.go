@@ -2,165 +2,188 @@
 package manager
 
 import (
+	"errors"
 	"fmt"
-	"time"
+	"sync"
 
-	"blockchain/consensus/bft"
-	"blockchain/consensus/pos"
-	"blockchain/crypto/signature"
+	"blockchain/consensus"
+	_ "blockchain/consensus/bft"      // регистрирует движок BFT
+	_ "blockchain/consensus/hotstuff" // регистрирует движок HotStuff
 	"blockchain/scalability/sharding"
 	"blockchain/storage/blockchain"
-	"blockchain/storage/txpool"
+	"blockchain/storage/state"
 )
 
 type ConsensusType string
 
 const (
-	ConsensusPoS ConsensusType = "PoS"
-	ConsensusBFT ConsensusType = "BFT"
+	ConsensusPoS      ConsensusType = "PoS"
+	ConsensusBFT      ConsensusType = "BFT"
+	ConsensusHotStuff ConsensusType = "HotStuff"
 )
 
+var ErrSwitchHeight = errors.New("consensus switch height is too low")
+
+// ConsensusSwitcher запускает движок консенсуса из реестра consensus и
+// передаёт управление другому движку на высоте, назначенной говернансом
 type ConsensusSwitcher struct {
 	Type ConsensusType
+
+	registry *consensus.Registry
+	env      *consensus.Env
+	engine   consensus.Engine
+	engines  map[ConsensusType]consensus.Engine
+	plan     *switchPlan
+	shards   []*ConsensusSwitcher
+	mu       sync.Mutex
 }
 
-func NewConsensusSwitcher(t ConsensusType) *ConsensusSwitcher {
-	return &ConsensusSwitcher{Type: t}
+// switchPlan — назначенный переход на движок To с высоты Height
+type switchPlan struct {
+	To     ConsensusType
+	Height int64
 }
 
-func (cs *ConsensusSwitcher) StartConsensus(
-	txPool *txpool.TransactionPool,
-	chain *blockchain.Blockchain,
-	validators []*pos.Validator,
-	validatorPool pos.ValidatorPool,
-	signer signature.Signer,
-	peerAddresses []string,
-) {
-	switch cs.Type {
-	case ConsensusPoS:
-		fmt.Println("🚀 Starting PoS consensus...")
-		cs.startPoS(txPool, chain, validators, validatorPool, signer, peerAddresses)
-	case ConsensusBFT:
-		fmt.Println("🚀 Starting BFT consensus...")
-		cs.startBFT(txPool, chain, validators, validatorPool, signer, peerAddresses)
-	default:
-		fmt.Println("❌ Unknown consensus type")
+// NewConsensusSwitcher создаёт переключатель с движком t.
+// registry — реестр движков (по умолчанию consensus.DefaultRegistry).
+func NewConsensusSwitcher(t ConsensusType, registry ...*consensus.Registry) *ConsensusSwitcher {
+	cs := &ConsensusSwitcher{
+		Type:     t,
+		registry: consensus.DefaultRegistry(),
+		engines:  make(map[ConsensusType]consensus.Engine),
+	}
+	if len(registry) > 0 && registry[0] != nil {
+		cs.registry = registry[0]
 	}
+	return cs
 }
 
-// ===== PoS =====
-
-func (cs *ConsensusSwitcher) startPoS(
-	txPool *txpool.TransactionPool,
-	chain *blockchain.Blockchain,
-	validators []*pos.Validator,
-	validatorPool pos.ValidatorPool,
-	signer signature.Signer,
-	peerAddresses []string,
-) {
-	for i := range validators {
-		validator := validators[i]
-		go func() {
-			fmt.Printf("⛏️ PoS Validator %s started\n", validator.Address)
-			for {
-				cs.simulatePoSBlockCreation(chain, txPool, validator, signer)
-				time.Sleep(10 * time.Second)
-			}
-		}()
+// StartConsensus запускает движок Type со следующей высоты цепочки env.State
+func (cs *ConsensusSwitcher) StartConsensus(env *consensus.Env) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.env = env
+	engine, err := cs.engineFor(cs.Type)
+	if err != nil {
+		return err
 	}
+	fmt.Printf("🚀 Starting %s consensus...\n", cs.Type)
+	cs.engine = engine
+	return engine.Start(env.State.Chain.Height() + 1)
 }
 
-// blockchain/consensus/manager/switcher.go
-func (cs *ConsensusSwitcher) simulatePoSBlockCreation(
-	chain *blockchain.Blockchain,
-	txPool *txpool.TransactionPool,
-	validator *pos.Validator,
-	signer signature.Signer,
-) {
-	// Увеличиваем количество транзакций в блоке для улучшения TPS
-	transactions := txPool.GetTransactions(200) // Увеличено с 100 до 200
-	if len(transactions) == 0 {
-		return
+// StartShardedConsensus запускает консенсус в каждом шарде. Шарды с общим
+// состоянием цепочки используют один движок.
+func (cs *ConsensusSwitcher) StartShardedConsensus(shards map[int]*sharding.Shard, env *consensus.Env) {
+	started := make(map[*state.StateMachine]bool)
+	for shardID, shard := range shards {
+		fmt.Printf("🚀 Starting consensus for shard %d\n", shardID)
+		machine := shard.State
+		if machine == nil {
+			var err error
+			machine, err = state.NewStateMachine(shard.Chain, nil)
+			if err != nil {
+				fmt.Printf("❌ Failed to build state for shard %d: %v\n", shardID, err)
+				continue
+			}
+		}
+		if started[machine] {
+			continue
+		}
+		started[machine] = true
+
+		shardEnv := *env
+		shardEnv.State = machine
+		shardEnv.TxPool = shard.TxPool
+		switcher := NewConsensusSwitcher(cs.Type, cs.registry)
+		if err := switcher.StartConsensus(&shardEnv); err != nil {
+			fmt.Printf("❌ Failed to start consensus for shard %d: %v\n", shardID, err)
+			continue
+		}
+		cs.mu.Lock()
+		cs.shards = append(cs.shards, switcher)
+		// Переход, назначенный до запуска шардов, действует и в них
+		if cs.plan != nil {
+			if err := switcher.ScheduleSwitch(cs.plan.To, cs.plan.Height); err != nil {
+				fmt.Printf("❌ Failed to schedule consensus switch for shard %d: %v\n", shardID, err)
+			}
+		}
+		cs.mu.Unlock()
 	}
+}
 
-	// Рассчитываем общую комиссию за транзакции
-	var totalFee float64
-	for _, tx := range transactions {
-		totalFee += tx.Fee
-	}
+// Engine возвращает работающий движок (nil до запуска)
+func (cs *ConsensusSwitcher) Engine() consensus.Engine {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.engine
+}
 
-	prevBlock := chain.Blocks[len(chain.Blocks)-1]
-	block := &blockchain.Block{
-		Index:        prevBlock.Index + 1,
-		Timestamp:    time.Now().Unix(),
-		PrevHash:     prevBlock.Hash,
-		Transactions: transactions,
-		Validator:    validator.Address,
+// ScheduleSwitch назначает переход на движок t с высоты height: текущий
+// движок останавливается после финализации блока height-1, и новый
+// начинает с height. Высота должна быть выше той, над которой движок уже
+// работает. В шардированном режиме переход назначается каждому шарду.
+func (cs *ConsensusSwitcher) ScheduleSwitch(t ConsensusType, height int64) error {
+	if !cs.registry.Registered(string(t)) {
+		return fmt.Errorf("%w: %q", consensus.ErrUnknownEngine, t)
 	}
-	block.Hash = block.CalculateHash()
-	signatureBytes, _ := signer.Sign(block.SerializeWithoutSignature())
-	block.Signature = signatureBytes
-	chain.Blocks = append(chain.Blocks, block)
-
-	// Добавляем комиссию валидатору
-	validator.CommissionEarned += int64(totalFee)
-
-	// Remove processed transactions from pool
-	txIDs := make([]string, len(transactions))
-	for i, tx := range transactions {
-		txIDs[i] = tx.ID
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, shard := range cs.shards {
+		if err := shard.ScheduleSwitch(t, height); err != nil {
+			return err
+		}
 	}
-	txPool.RemoveTransactions(txIDs)
-
-	fmt.Printf("✅ Block %d created by PoS validator %s with total fee: %.2f\n",
-		block.Index, validator.Address, totalFee)
+	if cs.env != nil {
+		if next := cs.env.State.Chain.Height() + 1; height <= next {
+			return fmt.Errorf("%w: %d, consensus is already at %d", ErrSwitchHeight, height, next)
+		}
+		fmt.Printf("📅 Consensus switch from %s to %s scheduled at height %d\n", cs.Type, t, height)
+	}
+	cs.plan = &switchPlan{To: t, Height: height}
+	return nil
 }
 
-// ===== BFT =====
-
-func (cs *ConsensusSwitcher) startBFT(
-	txPool *txpool.TransactionPool,
-	chain *blockchain.Blockchain,
-	validators []*pos.Validator,
-	validatorPool pos.ValidatorPool,
-	signer signature.Signer,
-	peerAddresses []string,
-) {
-	for i := range validators {
-		i := i
-		go func() {
-			bftNode := bft.NewBFTNode(
-				validators[i].ID,
-				validators[i],
-				validatorPool,
-				txPool,
-				chain,
-				signer,
-				peerAddresses[i],
-				peerAddresses,
-			)
-			bftNode.Start()
-			fmt.Printf("✅ BFT Node %s started\n", validators[i].Address)
-		}()
+// engineFor возвращает движок типа t, создавая его при первом обращении;
+// вызывается под блокировкой
+func (cs *ConsensusSwitcher) engineFor(t ConsensusType) (consensus.Engine, error) {
+	if engine, ok := cs.engines[t]; ok {
+		return engine, nil
+	}
+	engine, err := cs.registry.New(string(t), cs.env)
+	if err != nil {
+		return nil, err
 	}
+	engine.OnFinalized(cs.finalized)
+	cs.engines[t] = engine
+	return engine, nil
 }
 
-func (cs *ConsensusSwitcher) StartShardedConsensus(
-	shards map[int]*sharding.Shard,
-	validators []*pos.Validator,
-	validatorPool pos.ValidatorPool,
-	signer signature.Signer,
-	peerAddresses []string,
-) {
-	for shardID, shard := range shards {
-		go func(shardID int, shard *sharding.Shard) {
-			fmt.Printf("🚀 Starting consensus for shard %d\n", shardID)
-			switch cs.Type {
-			case ConsensusPoS:
-				cs.startPoS(shard.TxPool, shard.Chain, validators, validatorPool, signer, peerAddresses)
-			case ConsensusBFT:
-				cs.startBFT(shard.TxPool, shard.Chain, validators, validatorPool, signer, peerAddresses)
-			}
-		}(shardID, shard)
+// finalized передаёт управление новому движку, когда финализирован блок,
+// предшествующий высоте перехода. Старый движок останавливается до
+// запуска нового, поэтому блок высоты перехода создаёт только новый.
+func (cs *ConsensusSwitcher) finalized(block *blockchain.Block) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	plan := cs.plan
+	if plan == nil || block.Index+1 < plan.Height {
+		return
+	}
+	cs.plan = nil
+	if plan.To == cs.Type {
+		return
+	}
+	next, err := cs.engineFor(plan.To)
+	if err != nil {
+		fmt.Printf("❌ Consensus switch to %s failed: %v\n", plan.To, err)
+		return
+	}
+	cs.engine.Stop()
+	if err := next.Start(block.Index + 1); err != nil {
+		fmt.Printf("❌ Consensus switch to %s failed, resuming %s: %v\n", plan.To, cs.Type, err)
+		cs.engine.Start(block.Index + 1)
+		return
 	}
+	fmt.Printf("🔁 Consensus switched from %s to %s at height %d\n", cs.Type, plan.To, block.Index+1)
+	cs.Type, cs.engine = plan.To, next
 }
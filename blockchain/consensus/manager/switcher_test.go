@@ -0,0 +1,98 @@
+package manager
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"blockchain/consensus"
+	"blockchain/consensus/consensustest"
+	"blockchain/consensus/pos"
+	"blockchain/storage/blockchain"
+	"blockchain/storage/state"
+	"blockchain/storage/txpool"
+)
+
+// recordingEngine запоминает высоты, с которых его запускали
+type recordingEngine struct {
+	consensus.Events
+	started []int64
+}
+
+func (e *recordingEngine) Name() string { return "recording" }
+func (e *recordingEngine) Start(height int64) error {
+	e.started = append(e.started, height)
+	return nil
+}
+func (e *recordingEngine) Stop()                                         {}
+func (e *recordingEngine) ProposeBlock(int64) (*blockchain.Block, error) { return nil, nil }
+func (e *recordingEngine) ValidateBlock(*blockchain.Block) error         { return nil }
+
+func testEnv(t *testing.T) *consensus.Env {
+	t.Helper()
+	signer := consensustest.Signer("v1")
+
+	genesis := &state.Genesis{
+		Alloc:      map[string]float64{"alice": 100},
+		Validators: []state.GenesisValidator{{Address: "v1", SelfBond: 1000}},
+	}
+	machine, err := state.NewStateMachine(blockchain.NewBlockchain(), genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &consensus.Env{
+		State:      machine,
+		TxPool:     txpool.NewTransactionPool(),
+		Validators: []*pos.Validator{pos.NewValidatorWithAddress("v1", "v1", 1000)},
+		Signer:     signer,
+	}
+}
+
+// TestConsensusSwitcher_Handover - PoS создаёт блоки до высоты перехода,
+// после чего управление получает движок, назначенный говернансом
+func TestConsensusSwitcher_Handover(t *testing.T) {
+	env := testEnv(t)
+	recording := &recordingEngine{}
+	registry := consensus.NewRegistry()
+	registry.Register(string(ConsensusPoS), NewPoSEngine)
+	registry.Register("recording", func(env *consensus.Env) (consensus.Engine, error) { return recording, nil })
+	switcher := NewConsensusSwitcher(ConsensusPoS, registry)
+	if err := switcher.StartConsensus(env); err != nil {
+		t.Fatal(err)
+	}
+	defer switcher.Engine().Stop()
+
+	if err := switcher.ScheduleSwitch("missing", 3); !errors.Is(err, consensus.ErrUnknownEngine) {
+		t.Errorf("Expected ErrUnknownEngine, got %v", err)
+	}
+	if err := switcher.ScheduleSwitch("recording", 1); !errors.Is(err, ErrSwitchHeight) {
+		t.Errorf("Expected ErrSwitchHeight for the current height, got %v", err)
+	}
+	if err := switcher.ScheduleSwitch("recording", 3); err != nil {
+		t.Fatal(err)
+	}
+
+	engine := switcher.Engine().(*PoSEngine)
+	alice := consensustest.Signer("alice")
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		tx := &txpool.Transaction{From: "alice", To: "bob", Amount: 1, Fee: 0.01, Nonce: nonce, ChainID: txpool.DefaultChainID}
+		tx.ID = tx.ComputeID()
+		sig, err := alice.Sign(tx.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.Signature = hex.EncodeToString(sig)
+		env.TxPool.AddTransaction(tx)
+		engine.produce()
+	}
+
+	if height := env.State.Chain.Height(); height != 2 {
+		t.Errorf("Expected PoS to stop after block 2, chain is at %d", height)
+	}
+	if switcher.Type != "recording" || switcher.Engine() != recording {
+		t.Errorf("Expected recording engine to take over, got %s", switcher.Type)
+	}
+	if len(recording.started) != 1 || recording.started[0] != 3 {
+		t.Errorf("Expected recording engine to start at height 3, got %v", recording.started)
+	}
+}
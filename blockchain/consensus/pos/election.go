@@ -3,56 +3,74 @@ package pos
 // выбор валидатора
 
 import (
-	"math/rand"
-	"time"
-
-	"blockchain/governance/reputation"
+	"crypto/sha256"
+	"encoding/binary"
 )
 
 type ValidatorPool []*Validator
 
-// blockchain/consensus/pos/election.go
-func (p ValidatorPool) Select() *Validator {
-	if len(p) == 0 {
-		return nil
+// ProposerIndex выбирает пропосера раунда round высоты height среди
+// валидаторов с мощностями powers. seed — хэш предыдущего блока, поэтому
+// любой узел получает тот же результат. Валидаторы упорядочиваются
+// взвешенной по мощности выборкой без возвращения: в раунде 0 предлагает
+// первый, при смене раунда — следующий, и недоступный пропосер не
+// выбирается повторно, пока не предложат все остальные. Валидаторы с
+// нулевой мощностью не выбираются; -1 — выбрать некого.
+func ProposerIndex(powers []int64, seed string, height, round int64) int {
+	remaining := make([]int64, len(powers))
+	var total, active int64
+	for i, power := range powers {
+		if power > 0 {
+			remaining[i] = power
+			total += power
+			active++
+		}
 	}
-
-	repModule := reputation.NewReputationSystem()
-	totalWeight := 0.0
-	weights := make([]float64, len(p))
-	addresses := make([]string, len(p))
-	balances := make([]int64, len(p))
-
-	for i, v := range p {
-		repScore := repModule.CalculateScore(v.Address, true)
-		// Обновлено: добавлен учет комиссий в вес валидатора
-		weight := (float64(v.Balance) + float64(v.CommissionEarned)) * repScore
-		totalWeight += weight
-		weights[i] = totalWeight
-		addresses[i] = v.Address
-		balances[i] = v.Balance
+	if active == 0 || round < 0 {
+		return -1
 	}
 
-	if totalWeight == 0 {
-		return &Validator{
-			ID:      p[0].ID,
-			Address: p[0].Address,
-			Balance: p[0].Balance,
+	target := round % active
+	for draw := int64(0); ; draw++ {
+		x := int64(proposerDraw(seed, height, draw) % uint64(total))
+		index := 0
+		for i, power := range remaining {
+			if x < power {
+				index = i
+				break
+			}
+			x -= power
+		}
+		if draw == target {
+			return index
 		}
+		total -= remaining[index]
+		remaining[index] = 0
 	}
+}
 
-	rand.Seed(time.Now().UnixNano())
-	r := rand.Float64() * totalWeight
-	for i, w := range weights {
-		if r <= w {
-			return &Validator{
-				ID:      p[i].ID,
-				Address: addresses[i],
-				Balance: balances[i],
-			}
-		}
+// proposerDraw возвращает псевдослучайное число очередного шага выборки
+func proposerDraw(seed string, height, draw int64) uint64 {
+	data := make([]byte, 0, len(seed)+16)
+	data = append(data, seed...)
+	data = binary.BigEndian.AppendUint64(data, uint64(height))
+	data = binary.BigEndian.AppendUint64(data, uint64(draw))
+	hash := sha256.Sum256(data)
+	return binary.BigEndian.Uint64(hash[:8])
+}
+
+// Proposer возвращает пропосера раунда round высоты height по мощности
+// (VotingPower) валидаторов; seed — хэш предыдущего блока
+func (p ValidatorPool) Proposer(seed string, height, round int64) *Validator {
+	powers := make([]int64, len(p))
+	for i, v := range p {
+		powers[i] = v.VotingPower()
+	}
+	index := ProposerIndex(powers, seed, height, round)
+	if index < 0 {
+		return nil
 	}
-	return p[0]
+	return p[index]
 }
 
 func NewValidatorPool(validators []*Validator) *ValidatorPool {
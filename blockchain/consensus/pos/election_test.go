@@ -0,0 +1,67 @@
+package pos
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testPool(balances ...int64) ValidatorPool {
+	pool := make(ValidatorPool, len(balances))
+	for i, balance := range balances {
+		pool[i] = NewValidatorWithAddress(fmt.Sprintf("id-%d", i), fmt.Sprintf("v%d", i), balance)
+	}
+	return pool
+}
+
+// TestProposer_Deterministic - пропосер зависит только от набора, хэша
+// предыдущего блока, высоты и раунда; за n раундов предлагают все n валидаторов
+func TestProposer_Deterministic(t *testing.T) {
+	pool := testPool(10, 20, 30, 40)
+
+	first := pool.Proposer("prev", 5, 0)
+	for i := 0; i < 10; i++ {
+		if got := pool.Proposer("prev", 5, 0); got != first {
+			t.Fatalf("Proposer changed between calls: %s vs %s", got.Address, first.Address)
+		}
+	}
+	if copied := testPool(10, 20, 30, 40).Proposer("prev", 5, 0); copied.Address != first.Address {
+		t.Errorf("Equal pools chose %s and %s", copied.Address, first.Address)
+	}
+
+	seen := make(map[string]bool)
+	for round := int64(0); round < 4; round++ {
+		seen[pool.Proposer("prev", 5, round).Address] = true
+	}
+	if len(seen) != 4 {
+		t.Errorf("Expected 4 distinct proposers in 4 rounds, got %v", seen)
+	}
+	if pool.Proposer("prev", 5, 4) != first {
+		t.Errorf("Expected round 4 to wrap around to the round 0 proposer")
+	}
+}
+
+// TestProposer_WeightedByStake - доля высот, на которых валидатор
+// предлагает блок, пропорциональна стейку; исключённые не предлагают
+func TestProposer_WeightedByStake(t *testing.T) {
+	pool := testPool(10, 20, 30, 40)
+	pool[3].Jail()
+
+	counts := make(map[string]int)
+	const heights = 6000
+	for h := int64(1); h <= heights; h++ {
+		counts[pool.Proposer(fmt.Sprintf("block-%d", h-1), h, 0).Address]++
+	}
+	if counts["v3"] != 0 {
+		t.Errorf("Jailed validator proposed %d blocks", counts["v3"])
+	}
+	for i, want := range []float64{1.0 / 6, 2.0 / 6, 3.0 / 6} {
+		got := float64(counts[fmt.Sprintf("v%d", i)]) / heights
+		if got < want-0.03 || got > want+0.03 {
+			t.Errorf("v%d proposed %.3f of blocks, expected about %.3f", i, got, want)
+		}
+	}
+
+	if ProposerIndex([]int64{0, 0}, "prev", 1, 0) != -1 {
+		t.Errorf("Expected no proposer without voting power")
+	}
+}
@@ -0,0 +1,92 @@
+package pos
+
+// эпохи: набор валидаторов меняется только на границе эпохи
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"blockchain/codec"
+)
+
+// ActiveValidator — валидатор набора текущей эпохи и его мощность
+type ActiveValidator struct {
+	Address string `json:"address"`
+	Power   int64  `json:"power"`
+}
+
+// IsEpochEnd сообщает, завершает ли блок height эпоху: со следующей высоты
+// действует новый набор валидаторов. Генезис (высота 0) завершает нулевую эпоху.
+func (c *StakingConfig) IsEpochEnd(height int64) bool {
+	length := c.EpochLength
+	return length <= 1 || height%length == 0
+}
+
+// EndBlock завершает блок height. На границе эпохи набор валидаторов
+// пересчитывается по стейку; изменения стейкинга, исключения за нарушения
+// и решения говернанса внутри эпохи ждут её окончания.
+// Возвращает true, если набор изменился.
+func (s *StakingState) EndBlock(height int64) bool {
+	if !s.Config().IsEpochEnd(height) {
+		return false
+	}
+	before := s.ActiveSet().Hash()
+	s.Active = nil
+	for _, v := range s.ValidatorSet() {
+		s.Active = append(s.Active, ActiveValidator{Address: v.Address, Power: v.Balance})
+	}
+	return s.ActiveSet().Hash() != before
+}
+
+// ActiveSet возвращает набор валидаторов текущей эпохи
+func (s *StakingState) ActiveSet() ValidatorPool {
+	set := make(ValidatorPool, 0, len(s.Active))
+	for _, v := range s.Active {
+		set = append(set, NewValidatorWithAddress(v.Address, v.Address, v.Power))
+	}
+	return set
+}
+
+// Hash возвращает хэш набора: адреса и мощности валидаторов в порядке
+// набора; у пустого набора — пустая строка
+func (p ValidatorPool) Hash() string {
+	if len(p) == 0 {
+		return ""
+	}
+	w := codec.NewWriter(codec.KindValidatorSet)
+	w.Len(len(p))
+	for _, v := range p {
+		w.String(v.Address)
+		w.Int64(v.VotingPower())
+	}
+	hash := sha256.Sum256(w.Result())
+	return hex.EncodeToString(hash[:])
+}
+
+// Addresses возвращает адреса валидаторов набора
+func (p ValidatorPool) Addresses() []string {
+	addresses := make([]string, 0, len(p))
+	for _, v := range p {
+		addresses = append(addresses, v.Address)
+	}
+	return addresses
+}
+
+// Contains сообщает, входит ли валидатор address в набор
+func (p ValidatorPool) Contains(address string) bool {
+	for _, v := range p {
+		if v.Address == address {
+			return true
+		}
+	}
+	return false
+}
+
+// Powers возвращает мощность каждого валидатора набора по адресу
+func (p ValidatorPool) Powers() map[string]int64 {
+	powers := make(map[string]int64, len(p))
+	for _, v := range p {
+		powers[v.Address] = v.VotingPower()
+	}
+	return powers
+}
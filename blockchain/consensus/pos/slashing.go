@@ -0,0 +1,40 @@
+package pos
+
+// наказание валидаторов за доказанные нарушения
+
+// Slash списывает долю fraction стейка валидатора и его ещё не вернувшихся
+// отзывов, исключает валидатора из набора и возвращает списанную сумму.
+// Доли делегаторов сохраняются, но стоят меньше токенов.
+func (s *StakingState) Slash(address string, fraction float64) float64 {
+	v, ok := s.Validators[address]
+	if !ok {
+		return 0
+	}
+	fraction = min(max(fraction, 0), 1)
+	slashed := v.Tokens * fraction
+	v.Tokens -= slashed
+	for _, u := range s.Unbonding {
+		if u.Validator == address {
+			amount := u.Amount * fraction
+			u.Amount -= amount
+			slashed += amount
+		}
+	}
+	v.Jailed = true
+	return slashed
+}
+
+// Jail исключает валидатора из голосования: его мощность становится нулевой
+func (v *Validator) Jail() {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	v.Jailed = true
+	v.record()
+}
+
+// IsJailed сообщает, исключён ли валидатор из голосования
+func (v *Validator) IsJailed() bool {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	return v.Jailed
+}
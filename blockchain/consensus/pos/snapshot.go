@@ -0,0 +1,105 @@
+package pos
+
+// сохранение балансов и комиссий валидаторов в снимках узла
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+var (
+	journal   func(key string, value any)
+	journalMu sync.Mutex
+)
+
+// SetJournal подключает запись изменений валидаторов в WAL узла
+func SetJournal(j func(key string, value any)) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	journal = j
+}
+
+// AddCommission начисляет валидатору заработанную комиссию
+func (v *Validator) AddCommission(amount int64) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	v.CommissionEarned += amount
+	v.record()
+}
+
+// AddBalance увеличивает баланс (стейк) валидатора
+func (v *Validator) AddBalance(amount int64) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	v.Balance += amount
+	v.record()
+}
+
+// record сохраняет валидатора в журнал; вызывается под journalMu
+func (v *Validator) record() {
+	if journal != nil {
+		saved := *v
+		journal(v.Address, &saved)
+	}
+}
+
+// SetJournal подключает запись изменений валидаторов пула в WAL узла
+func (p *ValidatorPool) SetJournal(j func(key string, value any)) {
+	SetJournal(j)
+}
+
+// Name — имя пула валидаторов в снимках узла
+func (p *ValidatorPool) Name() string {
+	return "validators"
+}
+
+// Export возвращает валидаторов пула в JSON
+func (p *ValidatorPool) Export() ([]byte, error) {
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	return json.Marshal(*p)
+}
+
+// Import обновляет балансы, комиссии и исключение валидаторов по данным снимка;
+// валидаторы, которых нет в пуле, добавляются
+func (p *ValidatorPool) Import(data []byte) error {
+	var validators []*Validator
+	if err := json.Unmarshal(data, &validators); err != nil {
+		return err
+	}
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	for _, v := range validators {
+		p.upsert(v)
+	}
+	return nil
+}
+
+// ApplyRecord применяет изменение валидатора из WAL
+func (p *ValidatorPool) ApplyRecord(address string, value []byte) error {
+	if value == nil {
+		return nil
+	}
+	var v Validator
+	if err := json.Unmarshal(value, &v); err != nil {
+		return err
+	}
+	journalMu.Lock()
+	defer journalMu.Unlock()
+	p.upsert(&v)
+	return nil
+}
+
+// upsert обновляет валидатора с тем же адресом или добавляет нового.
+// Указатели существующих валидаторов сохраняются: ими пользуется консенсус.
+func (p *ValidatorPool) upsert(v *Validator) {
+	for _, existing := range *p {
+		if existing.Address == v.Address {
+			existing.Balance = v.Balance
+			existing.CommissionEarned = v.CommissionEarned
+			existing.Jailed = v.Jailed
+			return
+		}
+	}
+	*p = append(*p, v)
+}
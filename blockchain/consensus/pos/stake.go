@@ -2,11 +2,23 @@ package pos
 
 // модель ставок
 
+// Stake — делегирование: доли делегатора Address в стейке валидатора.
+// Стоимость долей в токенах меняется при наказании валидатора.
 type Stake struct {
-	Address string
-	Amount  int64
+	Address   string  `json:"address"`
+	Validator string  `json:"validator"`
+	Shares    float64 `json:"shares"`
 }
 
-func NewStake(addr string, amount int64) *Stake {
-	return &Stake{Address: addr, Amount: amount}
+func NewStake(addr, validator string, shares float64) *Stake {
+	return &Stake{Address: addr, Validator: validator, Shares: shares}
+}
+
+// Unbonding — отозванный стейк, который вернётся на счёт Address
+// на высоте CompletionHeight; до этого он может быть наказан
+type Unbonding struct {
+	Address          string  `json:"address"`
+	Validator        string  `json:"validator"`
+	Amount           float64 `json:"amount"`
+	CompletionHeight int64   `json:"completion_height"`
 }
@@ -0,0 +1,405 @@
+package pos
+
+// стейкинг: банки-валидаторы, делегирование, отзыв и распределение наград
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"blockchain/codec"
+)
+
+var (
+	ErrValidatorExists    = errors.New("validator already exists")
+	ErrUnknownValidator   = errors.New("unknown validator")
+	ErrInvalidCommission  = errors.New("invalid commission rate")
+	ErrSelfBondTooLow     = errors.New("self-bond below minimum")
+	ErrInvalidStake       = errors.New("invalid stake amount")
+	ErrInsufficientShares = errors.New("insufficient delegation")
+	ErrUnauthorized       = errors.New("sender is not the staking authority")
+)
+
+// dust — остаток долей, который считается нулевым (погрешность float64)
+const dust = 1e-9
+
+// StakingConfig — параметры стейкинга. Задаются генезисом сети и должны
+// совпадать у всех валидаторов: состояние стейкинга входит в корень состояния.
+type StakingConfig struct {
+	UnbondingPeriod   int64   `json:"unbonding_period"`    // через сколько блоков отозванный стейк возвращается на счёт
+	MinSelfBond       float64 `json:"min_self_bond"`       // минимальный собственный стейк нового валидатора
+	MaxCommissionRate float64 `json:"max_commission_rate"` // максимальная ставка комиссии валидатора
+	SlashFraction     float64 `json:"slash_fraction"`      // доля стейка, списываемая за доказанное нарушение
+	EpochLength       int64   `json:"epoch_length"`        // длина эпохи в блоках; набор валидаторов меняется только на её границе
+	EvidenceMaxAge    int64   `json:"evidence_max_age"`    // сколько высот доказательство нарушения остаётся действительным
+	Authority         string  `json:"authority,omitempty"` // адрес, исполняющий решения говернанса об исключении валидаторов; пусто — отключено
+}
+
+func DefaultStakingConfig() *StakingConfig {
+	return &StakingConfig{
+		UnbondingPeriod:   100,
+		MinSelfBond:       1,
+		MaxCommissionRate: 0.5,
+		SlashFraction:     0.05,
+		EpochLength:       10,
+		EvidenceMaxAge:    100,
+	}
+}
+
+// StakingValidator — валидатор в состоянии стейкинга. Стейк делегаторов
+// учитывается долями: при наказании уменьшаются токены, а не доли.
+type StakingValidator struct {
+	Address        string  `json:"address"` // адрес оператора; на него начисляется комиссия
+	Tokens         float64 `json:"tokens"`  // стейк валидатора вместе с делегированным
+	Shares         float64 `json:"shares"`  // сумма долей всех делегаторов
+	CommissionRate float64 `json:"commission_rate"`
+	Jailed         bool    `json:"jailed,omitempty"`
+}
+
+// sharesFor возвращает число долей, соответствующее amount токенов
+func (v *StakingValidator) sharesFor(amount float64) float64 {
+	if v.Shares == 0 {
+		return amount
+	}
+	return amount * v.Shares / v.Tokens
+}
+
+// StakingState — валидаторы, делегирования, отзывы в периоде разблокировки
+// и набор валидаторов текущей эпохи.
+// Не потокобезопасно: хранится в состоянии счетов и меняется под его блокировкой.
+type StakingState struct {
+	Validators  map[string]*StakingValidator `json:"validators,omitempty"`
+	Delegations map[string]*Stake            `json:"delegations,omitempty"` // ключ — делегатор/валидатор
+	Unbonding   []*Unbonding                 `json:"unbonding,omitempty"`
+	Active      []ActiveValidator            `json:"active,omitempty"` // набор эпохи, см. EndBlock
+
+	config *StakingConfig // параметры сети; не входят в состояние
+}
+
+// NewStakingState создаёт пустое состояние с параметрами config;
+// nil — DefaultStakingConfig
+func NewStakingState(config *StakingConfig) *StakingState {
+	return &StakingState{
+		Validators:  make(map[string]*StakingValidator),
+		Delegations: make(map[string]*Stake),
+		config:      config,
+	}
+}
+
+// Config возвращает параметры стейкинга состояния
+func (s *StakingState) Config() *StakingConfig {
+	if s.config == nil {
+		return DefaultStakingConfig()
+	}
+	return s.config
+}
+
+// SetConfig задаёт параметры стейкинга (например, после разбора из снимка)
+func (s *StakingState) SetConfig(config *StakingConfig) {
+	s.config = config
+}
+
+func delegationKey(delegator, validator string) string {
+	return delegator + "/" + validator
+}
+
+// Copy возвращает независимую копию
+func (s *StakingState) Copy() *StakingState {
+	c := NewStakingState(s.config)
+	for addr, v := range s.Validators {
+		copied := *v
+		c.Validators[addr] = &copied
+	}
+	for key, d := range s.Delegations {
+		copied := *d
+		c.Delegations[key] = &copied
+	}
+	for _, u := range s.Unbonding {
+		copied := *u
+		c.Unbonding = append(c.Unbonding, &copied)
+	}
+	c.Active = append([]ActiveValidator(nil), s.Active...)
+	return c
+}
+
+// Empty сообщает, что в состоянии нет ни валидаторов, ни отзывов
+func (s *StakingState) Empty() bool {
+	return len(s.Validators) == 0 && len(s.Delegations) == 0 && len(s.Unbonding) == 0 && len(s.Active) == 0
+}
+
+// CreateValidator регистрирует валидатора address с собственным стейком selfBond
+func (s *StakingState) CreateValidator(address string, selfBond, commissionRate float64) error {
+	if _, exists := s.Validators[address]; exists {
+		return fmt.Errorf("%w: %s", ErrValidatorExists, address)
+	}
+	if err := s.checkCommission(commissionRate); err != nil {
+		return err
+	}
+	if minSelfBond := s.Config().MinSelfBond; !(selfBond >= minSelfBond) || math.IsInf(selfBond, 0) {
+		return fmt.Errorf("%w: %f, minimum %f", ErrSelfBondTooLow, selfBond, minSelfBond)
+	}
+	v := &StakingValidator{Address: address, CommissionRate: commissionRate}
+	s.Validators[address] = v
+	s.bond(address, v, selfBond)
+	return nil
+}
+
+// EditValidator меняет ставку комиссии валидатора
+func (s *StakingState) EditValidator(address string, commissionRate float64) error {
+	v, ok := s.Validators[address]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownValidator, address)
+	}
+	if err := s.checkCommission(commissionRate); err != nil {
+		return err
+	}
+	v.CommissionRate = commissionRate
+	return nil
+}
+
+func (s *StakingState) checkCommission(rate float64) error {
+	if maxRate := s.Config().MaxCommissionRate; !(rate >= 0 && rate <= maxRate) {
+		return fmt.Errorf("%w: %f, maximum %f", ErrInvalidCommission, rate, maxRate)
+	}
+	return nil
+}
+
+// SetJailed исключает валидатора из набора или возвращает его по решению говернанса
+func (s *StakingState) SetJailed(address string, jailed bool) error {
+	v, ok := s.Validators[address]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownValidator, address)
+	}
+	v.Jailed = jailed
+	return nil
+}
+
+// Delegate добавляет amount токенов делегатора к стейку валидатора
+func (s *StakingState) Delegate(delegator, validator string, amount float64) error {
+	v, err := s.bondable(validator, amount)
+	if err != nil {
+		return err
+	}
+	s.bond(delegator, v, amount)
+	return nil
+}
+
+// Undelegate отзывает amount токенов делегатора у валидатора: они вернутся
+// на счёт делегатора на высоте height + UnbondingPeriod (см. Matured)
+func (s *StakingState) Undelegate(delegator, validator string, amount float64, height int64) error {
+	if err := s.unbond(delegator, validator, amount); err != nil {
+		return err
+	}
+	s.Unbonding = append(s.Unbonding, &Unbonding{
+		Address:          delegator,
+		Validator:        validator,
+		Amount:           amount,
+		CompletionHeight: height + s.Config().UnbondingPeriod,
+	})
+	return nil
+}
+
+// Redelegate сразу переносит amount токенов делегатора от валидатора src к dst
+func (s *StakingState) Redelegate(delegator, src, dst string, amount float64) error {
+	if src == dst {
+		return fmt.Errorf("%w: redelegation to the same validator %s", ErrInvalidStake, src)
+	}
+	to, err := s.bondable(dst, amount)
+	if err != nil {
+		return err
+	}
+	if err := s.unbond(delegator, src, amount); err != nil {
+		return err
+	}
+	s.bond(delegator, to, amount)
+	return nil
+}
+
+// bondable проверяет, что валидатору можно делегировать amount токенов
+func (s *StakingState) bondable(validator string, amount float64) (*StakingValidator, error) {
+	v, ok := s.Validators[validator]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownValidator, validator)
+	}
+	if !(amount > 0) || math.IsInf(amount, 0) {
+		return nil, fmt.Errorf("%w: %f", ErrInvalidStake, amount)
+	}
+	if v.Shares > 0 && v.Tokens <= 0 {
+		return nil, fmt.Errorf("%w: validator %s has no tokens left", ErrInvalidStake, validator)
+	}
+	return v, nil
+}
+
+// bond начисляет делегатору доли, соответствующие amount токенов
+func (s *StakingState) bond(delegator string, v *StakingValidator, amount float64) {
+	shares := v.sharesFor(amount)
+	key := delegationKey(delegator, v.Address)
+	d, ok := s.Delegations[key]
+	if !ok {
+		d = NewStake(delegator, v.Address, 0)
+		s.Delegations[key] = d
+	}
+	d.Shares += shares
+	v.Shares += shares
+	v.Tokens += amount
+}
+
+// unbond списывает доли делегатора, соответствующие amount токенов.
+// Валидатор без делегаторов удаляется.
+func (s *StakingState) unbond(delegator, validator string, amount float64) error {
+	v, ok := s.Validators[validator]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownValidator, validator)
+	}
+	if !(amount > 0) || math.IsInf(amount, 0) || v.Tokens <= 0 {
+		return fmt.Errorf("%w: %f", ErrInvalidStake, amount)
+	}
+	key := delegationKey(delegator, validator)
+	d, ok := s.Delegations[key]
+	shares := v.sharesFor(amount)
+	if !ok || d.Shares < shares-dust {
+		return fmt.Errorf("%w: %s cannot unbond %f from %s", ErrInsufficientShares, delegator, amount, validator)
+	}
+	shares = min(shares, d.Shares)
+	d.Shares -= shares
+	v.Shares -= shares
+	v.Tokens = max(v.Tokens-amount, 0)
+	if d.Shares <= dust {
+		delete(s.Delegations, key)
+	}
+	if v.Shares <= dust && !v.Jailed {
+		delete(s.Validators, validator)
+	}
+	return nil
+}
+
+// Matured удаляет и возвращает отзывы, период разблокировки которых истёк к высоте height
+func (s *StakingState) Matured(height int64) []*Unbonding {
+	var matured, pending []*Unbonding
+	for _, u := range s.Unbonding {
+		if u.CompletionHeight <= height {
+			matured = append(matured, u)
+		} else {
+			pending = append(pending, u)
+		}
+	}
+	s.Unbonding = pending
+	return matured
+}
+
+// DistributeReward делит награду валидатора: ставка комиссии достаётся
+// оператору, остальное — делегаторам (включая самого оператора)
+// пропорционально их долям. Возвращает выплаты по адресам; nil — адрес не
+// является валидатором.
+func (s *StakingState) DistributeReward(validator string, amount float64) map[string]float64 {
+	v, ok := s.Validators[validator]
+	if !ok || v.Shares <= 0 {
+		return nil
+	}
+	commission := amount * v.CommissionRate
+	rewards := map[string]float64{validator: commission}
+	rest := amount - commission
+	for _, d := range s.delegationsOf(validator) {
+		rewards[d.Address] += rest * d.Shares / v.Shares
+	}
+	return rewards
+}
+
+// delegationsOf возвращает делегирования валидатора, упорядоченные по делегатору
+func (s *StakingState) delegationsOf(validator string) []*Stake {
+	var result []*Stake
+	for _, d := range s.Delegations {
+		if d.Validator == validator {
+			result = append(result, d)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Address < result[j].Address })
+	return result
+}
+
+// Delegation возвращает стейк делегатора у валидатора в токенах
+func (s *StakingState) Delegation(delegator, validator string) float64 {
+	v, ok := s.Validators[validator]
+	d, delegated := s.Delegations[delegationKey(delegator, validator)]
+	if !ok || !delegated || v.Shares <= 0 {
+		return 0
+	}
+	return d.Shares * v.Tokens / v.Shares
+}
+
+// VotingPower возвращает мощность валидатора по текущему стейку: целая
+// часть стейка, у исключённого — 0. В набор она попадает в конце эпохи.
+func (s *StakingState) VotingPower(address string) int64 {
+	v, ok := s.Validators[address]
+	if !ok || v.Jailed {
+		return 0
+	}
+	return int64(v.Tokens)
+}
+
+// ValidatorSet возвращает набор валидаторов с ненулевой мощностью по
+// текущему стейку, упорядоченный по адресу; действующий набор — ActiveSet
+func (s *StakingState) ValidatorSet() ValidatorPool {
+	addresses := make([]string, 0, len(s.Validators))
+	for addr := range s.Validators {
+		addresses = append(addresses, addr)
+	}
+	sort.Strings(addresses)
+
+	var set ValidatorPool
+	for _, addr := range addresses {
+		if power := s.VotingPower(addr); power > 0 {
+			set = append(set, NewValidatorWithAddress(addr, addr, power))
+		}
+	}
+	return set
+}
+
+// Encode возвращает каноническое кодирование состояния для корня состояния
+func (s *StakingState) Encode() []byte {
+	w := codec.NewWriter(codec.KindStakingState)
+
+	addresses := make([]string, 0, len(s.Validators))
+	for addr := range s.Validators {
+		addresses = append(addresses, addr)
+	}
+	sort.Strings(addresses)
+	w.Len(len(addresses))
+	for _, addr := range addresses {
+		v := s.Validators[addr]
+		w.String(v.Address)
+		w.Float64(v.Tokens)
+		w.Float64(v.Shares)
+		w.Float64(v.CommissionRate)
+		w.Bool(v.Jailed)
+	}
+
+	keys := make([]string, 0, len(s.Delegations))
+	for key := range s.Delegations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	w.Len(len(keys))
+	for _, key := range keys {
+		d := s.Delegations[key]
+		w.String(d.Address)
+		w.String(d.Validator)
+		w.Float64(d.Shares)
+	}
+
+	w.Len(len(s.Unbonding))
+	for _, u := range s.Unbonding {
+		w.String(u.Address)
+		w.String(u.Validator)
+		w.Float64(u.Amount)
+		w.Int64(u.CompletionHeight)
+	}
+
+	w.Len(len(s.Active))
+	for _, v := range s.Active {
+		w.String(v.Address)
+		w.Int64(v.Power)
+	}
+	return w.Result()
+}
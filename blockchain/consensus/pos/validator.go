@@ -7,6 +7,7 @@ type Validator struct {
 	Address        string
 	Balance        int64
 	CommissionEarned int64  // Добавлено: сумма заработанных комиссий
+	Jailed         bool     // исключён из голосования за доказанное нарушение
 }
 
 func NewValidatorWithAddress(id, address string, balance int64) *Validator {
@@ -21,3 +22,11 @@ func (v *Validator) Weight() float64 {
 	// Обновлено: добавлен учет комиссий в вес валидатора
 	return float64(v.Balance + v.CommissionEarned)
 }
+
+// VotingPower — вес голоса валидатора в BFT-консенсусе; у исключённого валидатора он нулевой
+func (v *Validator) VotingPower() int64 {
+	if v.IsJailed() {
+		return 0
+	}
+	return v.Balance
+}
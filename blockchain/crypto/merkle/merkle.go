@@ -0,0 +1,137 @@
+// crypto/merkle/merkle.go
+
+package merkle
+
+// бинарное дерево Меркла с доказательствами включения
+//
+// Листья и внутренние узлы хэшируются с разными префиксами (0x00 и 0x01),
+// чтобы внутренний узел нельзя было выдать за лист. Узел без пары на
+// уровне поднимается на следующий уровень без изменений (без дублирования,
+// которое позволяет строить разные деревья с одинаковым корнем).
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+)
+
+const (
+	leafPrefix  = 0x00
+	innerPrefix = 0x01
+)
+
+var ErrIndexOutOfRange = errors.New("leaf index out of range")
+
+// ProofStep — соседний узел на пути от листа к корню
+type ProofStep struct {
+	Hash []byte `json:"hash"`
+	Left bool   `json:"left"` // сосед находится слева
+}
+
+// Proof — доказательство включения листа в дерево
+type Proof struct {
+	Index int         `json:"index"`
+	Total int         `json:"total"`
+	Path  []ProofStep `json:"path"`
+}
+
+// HashLeaf хэширует данные листа
+func HashLeaf(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{leafPrefix})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func hashInner(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{innerPrefix})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// nextLevel строит следующий уровень дерева
+func nextLevel(level [][]byte) [][]byte {
+	next := make([][]byte, 0, (len(level)+1)/2)
+	for i := 0; i < len(level); i += 2 {
+		if i+1 < len(level) {
+			next = append(next, hashInner(level[i], level[i+1]))
+		} else {
+			next = append(next, level[i])
+		}
+	}
+	return next
+}
+
+// Root вычисляет корень дерева по данным листьев.
+// Корень пустого дерева — SHA-256 от пустой строки.
+func Root(leaves [][]byte) []byte {
+	if len(leaves) == 0 {
+		empty := sha256.Sum256(nil)
+		return empty[:]
+	}
+	level := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = HashLeaf(leaf)
+	}
+	for len(level) > 1 {
+		level = nextLevel(level)
+	}
+	return level[0]
+}
+
+// BuildProof строит доказательство включения листа с индексом index
+func BuildProof(leaves [][]byte, index int) (*Proof, error) {
+	if index < 0 || index >= len(leaves) {
+		return nil, ErrIndexOutOfRange
+	}
+	level := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		level[i] = HashLeaf(leaf)
+	}
+
+	proof := &Proof{Index: index, Total: len(leaves)}
+	pos := index
+	for len(level) > 1 {
+		sibling := pos ^ 1
+		if sibling < len(level) {
+			proof.Path = append(proof.Path, ProofStep{
+				Hash: level[sibling],
+				Left: sibling < pos,
+			})
+		}
+		level = nextLevel(level)
+		pos /= 2
+	}
+	return proof, nil
+}
+
+// Verify проверяет, что leaf входит в дерево с корнем root
+func Verify(root, leaf []byte, proof *Proof) bool {
+	if proof == nil || proof.Index < 0 || proof.Index >= proof.Total {
+		return false
+	}
+
+	// Восстанавливаем форму пути по индексу и размеру дерева,
+	// чтобы нельзя было подсунуть лишние или переставленные шаги
+	current := HashLeaf(leaf)
+	pos, size, step := proof.Index, proof.Total, 0
+	for size > 1 {
+		sibling := pos ^ 1
+		if sibling < size {
+			if step >= len(proof.Path) || proof.Path[step].Left != (sibling < pos) {
+				return false
+			}
+			if proof.Path[step].Left {
+				current = hashInner(proof.Path[step].Hash, current)
+			} else {
+				current = hashInner(current, proof.Path[step].Hash)
+			}
+			step++
+		}
+		pos /= 2
+		size = (size + 1) / 2
+	}
+	return step == len(proof.Path) && bytes.Equal(current, root)
+}
@@ -0,0 +1,69 @@
+package merkle
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testLeaves(n int) [][]byte {
+	leaves := make([][]byte, n)
+	for i := range leaves {
+		leaves[i] = []byte(fmt.Sprintf("tx-%d", i))
+	}
+	return leaves
+}
+
+// TestProof_AllSizes - доказательство проходит для каждого листа деревьев разного размера
+func TestProof_AllSizes(t *testing.T) {
+	for n := 1; n <= 17; n++ {
+		leaves := testLeaves(n)
+		root := Root(leaves)
+		for i := 0; i < n; i++ {
+			proof, err := BuildProof(leaves, i)
+			if err != nil {
+				t.Fatalf("n=%d i=%d: failed to build proof: %v", n, i, err)
+			}
+			if !Verify(root, leaves[i], proof) {
+				t.Errorf("n=%d i=%d: valid proof rejected", n, i)
+			}
+		}
+	}
+}
+
+// TestProof_Tampered - подделанные доказательства отклоняются
+func TestProof_Tampered(t *testing.T) {
+	leaves := testLeaves(7)
+	root := Root(leaves)
+	proof, _ := BuildProof(leaves, 3)
+
+	if Verify(root, []byte("tx-other"), proof) {
+		t.Error("Proof accepted for a different leaf")
+	}
+
+	wrongIndex := *proof
+	wrongIndex.Index = 2
+	if Verify(root, leaves[3], &wrongIndex) {
+		t.Error("Proof accepted with a wrong index")
+	}
+
+	truncated := *proof
+	truncated.Path = proof.Path[:len(proof.Path)-1]
+	if Verify(root, leaves[3], &truncated) {
+		t.Error("Proof accepted with a truncated path")
+	}
+
+	// Внутренний узел нельзя выдать за лист
+	inner := hashInner(HashLeaf(leaves[0]), HashLeaf(leaves[1]))
+	if Verify(root, inner, &Proof{Index: 0, Total: 4, Path: proof.Path[1:]}) {
+		t.Error("Inner node accepted as a leaf")
+	}
+}
+
+// TestRoot_OrderMatters - корень зависит от порядка листьев
+func TestRoot_OrderMatters(t *testing.T) {
+	a := [][]byte{[]byte("a"), []byte("b"), []byte("c")}
+	b := [][]byte{[]byte("b"), []byte("a"), []byte("c")}
+	if string(Root(a)) == string(Root(b)) {
+		t.Error("Expected different roots for reordered leaves")
+	}
+}
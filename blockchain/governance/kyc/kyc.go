@@ -1,7 +1,9 @@
 package kyc
 
 import (
+	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"blockchain/security/audit"
@@ -54,6 +56,8 @@ type User struct {
 type KYCManager struct {
 	Users   map[string]*User
 	Auditor *audit.SecurityAuditor
+	journal func(key string, value any)
+	mu      sync.RWMutex
 }
 
 func NewKYCManager(auditor *audit.SecurityAuditor) *KYCManager {
@@ -64,6 +68,8 @@ func NewKYCManager(auditor *audit.SecurityAuditor) *KYCManager {
 }
 
 func (k *KYCManager) RegisterUser(address, fullName, idNumber, country string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
 	if _, exists := k.Users[address]; exists {
 		return
 	}
@@ -76,6 +82,7 @@ func (k *KYCManager) RegisterUser(address, fullName, idNumber, country string) {
 		RiskScore:  0.5,
 		LastUpdate: time.Now(),
 	}
+	k.record(address)
 	k.Auditor.RecordEvent(audit.SecurityEvent{
 		Timestamp: time.Now(),
 		Type:      "KYCRegistration",
@@ -86,6 +93,8 @@ func (k *KYCManager) RegisterUser(address, fullName, idNumber, country string) {
 }
 
 func (k *KYCManager) VerifyUser(address string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
 	user, exists := k.Users[address]
 	if !exists {
 		return fmt.Errorf("user not found")
@@ -93,6 +102,7 @@ func (k *KYCManager) VerifyUser(address string) error {
 	user.Status = Verified
 	user.RiskScore = 1.0
 	user.LastUpdate = time.Now()
+	k.record(address)
 	k.Auditor.RecordEvent(audit.SecurityEvent{
 		Timestamp: time.Now(),
 		Type:      "KYCVerification",
@@ -104,6 +114,8 @@ func (k *KYCManager) VerifyUser(address string) error {
 }
 
 func (k *KYCManager) RejectUser(address string) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
 	user, exists := k.Users[address]
 	if !exists {
 		return fmt.Errorf("user not found")
@@ -111,6 +123,7 @@ func (k *KYCManager) RejectUser(address string) error {
 	user.Status = Rejected
 	user.RiskScore = 0.0
 	user.LastUpdate = time.Now()
+	k.record(address)
 	k.Auditor.RecordEvent(audit.SecurityEvent{
 		Timestamp: time.Now(),
 		Type:      "KYCRejection",
@@ -122,6 +135,8 @@ func (k *KYCManager) RejectUser(address string) error {
 }
 
 func (k *KYCManager) CheckKYC(address string) (KYCStatus, float64) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	user, exists := k.Users[address]
 	if !exists {
 		return Pending, 0
@@ -142,16 +157,21 @@ func (k *KYCManager) ReportSuspiciousActivity(address, activity string, amount f
 		address, activity, amount, riskLevel)
 
 	// Обновляем статус пользователя при необходимости
+	k.mu.Lock()
+	defer k.mu.Unlock()
 	if user, exists := k.Users[address]; exists {
 		if riskLevel == "HIGH" {
 			user.Status = Suspicious
 			user.RiskScore = 0.1
+			k.record(address)
 		}
 	}
 }
 
 // GenerateComplianceReport генерирует отчет о соответствии требованиям
 func (k *KYCManager) GenerateComplianceReport() *ComplianceReport {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	report := &ComplianceReport{
 		ReportID:    fmt.Sprintf("COMPL-%d", time.Now().Unix()),
 		GeneratedAt: time.Now(),
@@ -178,6 +198,8 @@ func (k *KYCManager) GenerateComplianceReport() *ComplianceReport {
 
 // GetHighRiskUsers возвращает список пользователей с высоким риском
 func (k *KYCManager) GetHighRiskUsers() []User {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
 	var highRiskUsers []User
 	for _, user := range k.Users {
 		if user.RiskScore < 0.3 || user.Status == Suspicious {
@@ -186,3 +208,58 @@ func (k *KYCManager) GetHighRiskUsers() []User {
 	}
 	return highRiskUsers
 }
+
+// SetJournal подключает запись изменений пользователей в WAL узла
+func (k *KYCManager) SetJournal(journal func(key string, value any)) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.journal = journal
+}
+
+// record сохраняет изменение пользователя в журнал; вызывается под блокировкой
+func (k *KYCManager) record(address string) {
+	if k.journal != nil {
+		user := *k.Users[address]
+		k.journal(address, &user)
+	}
+}
+
+// Name — имя реестра KYC в снимках узла
+func (k *KYCManager) Name() string {
+	return "kyc"
+}
+
+// Export возвращает реестр пользователей в JSON
+func (k *KYCManager) Export() ([]byte, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return json.Marshal(k.Users)
+}
+
+// Import заменяет реестр пользователей данными снимка
+func (k *KYCManager) Import(data []byte) error {
+	users := make(map[string]*User)
+	if err := json.Unmarshal(data, &users); err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.Users = users
+	return nil
+}
+
+// ApplyRecord применяет изменение пользователя из WAL
+func (k *KYCManager) ApplyRecord(address string, value []byte) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if value == nil {
+		delete(k.Users, address)
+		return nil
+	}
+	var user User
+	if err := json.Unmarshal(value, &user); err != nil {
+		return err
+	}
+	k.Users[address] = &user
+	return nil
+}
@@ -1,8 +1,9 @@
 package reputation
 
 import (
-	"math/rand"
-	"time"
+	"math"
+
+	"blockchain/consensus/pos"
 )
 
 // Validator представляет валидатора
@@ -11,40 +12,34 @@ type Validator struct {
 	Stake   float64
 }
 
-// SelectValidator выбирает валидатора на основе: Stake * Reputation.Weight
-func SelectValidator(validators []Validator, repSystem *ReputationSystem) Validator {
-	rand.Seed(time.Now().UnixNano())
-
-	totalWeight := 0.0
-	weights := make([]float64, len(validators))
-	addresses := make([]string, len(validators))
-	stakes := make([]float64, len(validators))
+// SelectValidator выбирает валидатора на основе: Stake * Reputation.Weight.
+// Выбор детерминирован (см. pos.ProposerIndex): seed — хэш предыдущего
+// блока, поэтому все узлы выбирают одного валидатора для (height, round).
+// Вес округляется до целых единиц стейка; если вес всех валидаторов
+// нулевой, они выбираются с равными шансами.
+func SelectValidator(validators []Validator, repSystem *ReputationSystem, seed string, height, round int64) Validator {
+	if len(validators) == 0 {
+		return Validator{}
+	}
 
+	weights := make([]int64, len(validators))
+	var total int64
 	for i, v := range validators {
-		repScore := repSystem.CalculateScore(v.Address, true)
-		weight := v.Stake * repScore
-		totalWeight += weight
-		weights[i] = totalWeight
-		addresses[i] = v.Address
-		stakes[i] = v.Stake
+		weight := 1.0
+		if rep, ok := repSystem.NodeReputation[v.Address]; ok {
+			weight = rep.Weight
+		}
+		weights[i] = int64(math.Round(v.Stake * weight))
+		if weights[i] > 0 {
+			total += weights[i]
+		}
 	}
 
-	if totalWeight == 0 {
+	if total == 0 {
 		// Резервный случай
-		i := rand.Intn(len(validators))
-		return validators[i]
-	}
-
-	r := rand.Float64() * totalWeight
-
-	for i, w := range weights {
-		if r <= w {
-			return Validator{
-				Address: addresses[i],
-				Stake:   stakes[i],
-			}
+		for i := range weights {
+			weights[i] = 1
 		}
 	}
-
-	return validators[rand.Intn(len(validators))]
+	return validators[pos.ProposerIndex(weights, seed, height, round)]
 }
@@ -3,6 +3,7 @@ package api
 
 import (
 	"encoding/hex"
+	"errors"
 	"encoding/json"
 	"net/http"
 	"time"
@@ -13,6 +14,11 @@ import (
 
 var channelManager = offchain.NewChannelManager()
 
+// SetChannelManager задаёт менеджер платёжных каналов API
+func SetChannelManager(manager *offchain.ChannelManager) {
+	channelManager = manager
+}
+
 // handleCreateChannel — создает новый платежный канал
 func (s *APIServer) handleCreateChannel(w http.ResponseWriter, r *http.Request) {
 	type Request struct {
@@ -77,12 +83,11 @@ func (s *APIServer) handleUpdateChannel(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Invalid signature B", http.StatusBadRequest)
 		return
 	}
-	channel, exists := channelManager.GetChannel(req.ID)
-	if !exists {
-		http.Error(w, "Channel not found", http.StatusNotFound)
-		return
-	}
-	if err := channel.UpdateState(req.AmountA, req.AmountB, req.Nonce, sigA, sigB); err != nil {
+	if err := channelManager.UpdateChannel(req.ID, req.AmountA, req.AmountB, req.Nonce, sigA, sigB); err != nil {
+		if errors.Is(err, offchain.ErrChannelNotFound) {
+			http.Error(w, "Channel not found", http.StatusNotFound)
+			return
+		}
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
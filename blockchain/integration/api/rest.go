@@ -5,9 +5,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"blockchain/crypto/signature"
 	"blockchain/storage/blockchain"
+	"blockchain/storage/state"
 	"blockchain/storage/txpool"
 	"blockchain/security/audit"
 	"blockchain/governance/kyc"
@@ -26,13 +28,15 @@ func SetKYCManager(manager *kyc.KYCManager) {
 
 type APIServer struct {
 	Chain  *blockchain.Blockchain
+	State  *state.StateMachine
 	TxPool *txpool.TransactionPool
 }
 
-func NewAPIServer(chain *blockchain.Blockchain, txPool *txpool.TransactionPool, auditorInstance *audit.SecurityAuditor) *APIServer {
+func NewAPIServer(chain *blockchain.Blockchain, stateMachine *state.StateMachine, txPool *txpool.TransactionPool, auditorInstance *audit.SecurityAuditor) *APIServer {
 	auditor = auditorInstance // ✅ Сохраняем инстанс аудита
 	return &APIServer{
 		Chain:  chain,
+		State:  stateMachine,
 		TxPool: txPool,
 	}
 }
@@ -46,6 +50,11 @@ func (s *APIServer) Start(addr string) error {
 	http.HandleFunc("/audit", enableCORS(s.handleSecurityAudit))
 	http.HandleFunc("/blocks", enableCORS(s.handleBlocks))
 	http.HandleFunc("/register", s.handleRegisterPublicKey)
+	http.HandleFunc("/transactions/proof", enableCORS(s.handleTxProof))
+	http.HandleFunc("/transactions/lookup", enableCORS(s.handleTxLookup))
+	http.HandleFunc("/address/history", enableCORS(s.handleAddressHistory))
+	http.HandleFunc("/fees/estimate", enableCORS(s.handleFeeEstimate))
+	http.HandleFunc("/accounts", enableCORS(s.handleAccount))
 	http.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case "GET":
@@ -68,17 +77,169 @@ func (s *APIServer) Start(addr string) error {
 	return http.ListenAndServe(addr, nil)
 }
 
+// Ограничения размера страницы для постраничных запросов
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// handleBlocks обрабатывает GET /blocks[?from=<height>][&limit=<n>] и GET /blocks?hash=<hash>.
+// Без from возвращаются последние limit блоков; блоки идут по возрастанию высоты,
+// текущая высота цепочки передаётся в заголовке X-Chain-Height.
 func (s *APIServer) handleBlocks(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	w.Header().Set("X-Chain-Height", strconv.FormatInt(s.Chain.Height(), 10))
+
+	if hash := query.Get("hash"); hash != "" {
+		block := s.Chain.GetBlockByHash(hash)
+		if block == nil {
+			http.Error(w, "Block not found", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(block)
+		return
+	}
+
+	limit, err := intParam(query.Get("limit"), defaultPageSize)
+	if err != nil || limit <= 0 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	height := s.Chain.Height()
+	from := height - int64(limit) + 1
+	if fromParam := query.Get("from"); fromParam != "" {
+		from, err = strconv.ParseInt(fromParam, 10, 64)
+		if err != nil || from < 0 {
+			http.Error(w, "Invalid from height", http.StatusBadRequest)
+			return
+		}
+	}
+	if from < 0 {
+		from = 0
+	}
+
+	blocks := s.Chain.GetBlocks(from, from+int64(limit)-1)
+	if blocks == nil {
+		blocks = []*blockchain.Block{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(blocks)
+}
+
+// handleTxLookup обрабатывает GET /transactions/lookup?id=<txID>
+// и возвращает транзакцию из цепочки вместе с блоком и позицией в нём
+func (s *APIServer) handleTxLookup(w http.ResponseWriter, r *http.Request) {
+	txID := r.URL.Query().Get("id")
+	if txID == "" {
+		http.Error(w, "Transaction ID not provided", http.StatusBadRequest)
+		return
+	}
+	record := s.Chain.GetTransaction(txID)
+	if record == nil {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// handleAddressHistory обрабатывает GET /address/history?address=<addr>[&cursor=<n>][&limit=<n>]
+func (s *APIServer) handleAddressHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	address := query.Get("address")
+	if address == "" {
+		http.Error(w, "Address not provided", http.StatusBadRequest)
+		return
+	}
+	cursor, err := intParam(query.Get("cursor"), 0)
+	if err != nil || cursor < 0 {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(query.Get("limit"), defaultPageSize)
+	if err != nil || limit <= 0 {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	records, next := s.Chain.GetAddressHistory(address, cursor, limit)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"address":      address,
+		"transactions": records,
+		"next_cursor":  next,
+		"has_more":     len(records) == limit,
+	})
+}
+
+// handleFeeEstimate обрабатывает GET /fees/estimate и возвращает базовую
+// комиссию следующего блока и рекомендуемые Fee/Tip для разных целей подтверждения
+func (s *APIServer) handleFeeEstimate(w http.ResponseWriter, r *http.Request) {
+	latest := s.Chain.GetLatestBlock()
+	if latest == nil {
+		http.Error(w, "Chain is empty", http.StatusServiceUnavailable)
+		return
+	}
+	pending := len(s.TxPool.Pending())
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(s.Chain.Blocks)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"height":        latest.Index,
+		"next_base_fee": s.Chain.Fees().NextBaseFee(latest),
+		"pending":       pending,
+		"estimates":     blockchain.EstimateFees(s.Chain, pending),
+	})
+}
+
+// handleAccount обрабатывает GET /accounts?address=<addr> и возвращает баланс
+// и nonce счёта, а также nonce для следующей транзакции с учётом готовых
+// транзакций отправителя в пуле
+func (s *APIServer) handleAccount(w http.ResponseWriter, r *http.Request) {
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		http.Error(w, "Address not provided", http.StatusBadRequest)
+		return
+	}
+	account := s.State.GetAccount(address)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"address":    address,
+		"balance":    account.Balance,
+		"nonce":      account.Nonce,
+		"next_nonce": s.TxPool.NextNonce(address),
+	})
+}
+
+// intParam разбирает числовой параметр запроса, возвращая def для пустого значения
+func intParam(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
 }
 
 // blockchain/integration/api/rest.go
 func (s *APIServer) handleTransactions(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	// Получаем все транзакции без удаления
-	transactions := s.TxPool.GetAllTransactions()
+	// Получаем транзакции без удаления: все, готовые к включению (?status=pending)
+	// или ожидающие пропущенных nonce (?status=queued)
+	var transactions []*txpool.Transaction
+	switch r.URL.Query().Get("status") {
+	case "pending":
+		transactions = s.TxPool.Pending()
+	case "queued":
+		transactions = s.TxPool.Queued()
+	default:
+		transactions = s.TxPool.GetAllTransactions()
+	}
 
 	// Добавляем информацию о комиссиях
 	type TransactionResponse struct {
@@ -87,6 +248,8 @@ func (s *APIServer) handleTransactions(w http.ResponseWriter, r *http.Request) {
 		To        string  `json:"to"`
 		Amount    float64 `json:"amount"`
 		Fee       float64 `json:"fee"`
+		Tip       float64 `json:"tip"`
+		Nonce     uint64  `json:"nonce"`
 		Timestamp int64   `json:"timestamp"`
 	}
 
@@ -99,6 +262,8 @@ func (s *APIServer) handleTransactions(w http.ResponseWriter, r *http.Request) {
 			To:        tx.To,
 			Amount:    tx.Amount,
 			Fee:       tx.Fee,
+			Tip:       tx.Tip,
+			Nonce:     tx.Nonce,
 			Timestamp: tx.Timestamp,
 		})
 	}
@@ -113,12 +278,21 @@ func (s *APIServer) handleAddTransaction(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if !tx.Verify() {
+	// ID пересчитывается по содержимому: подменённый или устаревший ID отклоняется
+	if err := tx.CheckID(s.State.ChainID()); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !tx.Verify(s.State.ChainID()) {
 		http.Error(w, "Invalid transaction signature", http.StatusBadRequest)
 		return
 	}
 
-	s.TxPool.AddTransaction(tx)
+	if err := s.TxPool.AddTransaction(tx); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"status":      "success",
@@ -126,6 +300,41 @@ func (s *APIServer) handleAddTransaction(w http.ResponseWriter, r *http.Request)
 	})
 }
 
+// handleTxProof обрабатывает GET /transactions/proof?id=<txID>[&block=<height>]
+// и возвращает доказательство включения транзакции в блок
+func (s *APIServer) handleTxProof(w http.ResponseWriter, r *http.Request) {
+	txID := r.URL.Query().Get("id")
+	if txID == "" {
+		http.Error(w, "Transaction ID not provided", http.StatusBadRequest)
+		return
+	}
+
+	var block *blockchain.Block
+	if heightParam := r.URL.Query().Get("block"); heightParam != "" {
+		height, err := strconv.ParseInt(heightParam, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid block height", http.StatusBadRequest)
+			return
+		}
+		block = s.Chain.GetBlockByHeight(height)
+	} else if record := s.Chain.GetTransaction(txID); record != nil {
+		block = s.Chain.GetBlockByHeight(record.BlockIndex)
+	}
+	if block == nil {
+		http.Error(w, "Transaction not found", http.StatusNotFound)
+		return
+	}
+
+	proof, err := blockchain.ProofForTx(block, txID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(proof)
+}
+
 func (s *APIServer) handleSecurityAudit(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(auditor.GetEvents())
@@ -3,22 +3,33 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
 	// Консенсус
+	"blockchain/consensus"
+	"blockchain/consensus/bft"
+	"blockchain/consensus/evidence"
 	"blockchain/consensus/governance"
 	"blockchain/consensus/manager"
 	"blockchain/consensus/pos"
 	"blockchain/monitoring"
 
 	// Сеть
+	"blockchain/network/gossip"
+	"blockchain/network/mempool"
+	"blockchain/network/p2p"
 	"blockchain/network/peer"
 	// Хранилище
 	"blockchain/storage/blockchain"
+	"blockchain/storage/snapshot"
+	"blockchain/storage/state"
 	"blockchain/storage/txpool"
 
 	// Криптография
@@ -33,10 +44,15 @@ import (
 	"blockchain/integration/api"
 	// Говернанс
 	"blockchain/governance/kyc"
+	// Платёжные каналы
+	"blockchain/scalability/offchain"
 	// Шардинг
 	"blockchain/scalability/sharding"
 )
 
+// validatorAddress — адрес валидатора этого узла
+const validatorAddress = "localhost:27656"
+
 // Глобальные переменные для говернанса и адаптивного шардирования
 var (
 	kycManager           *kyc.KYCManager
@@ -44,15 +60,110 @@ var (
 )
 
 func main() {
+	// ============ Инициализация хранилища ============
+	dataDir := os.Getenv("BLOCKCHAIN_DATA_DIR")
+	if dataDir == "" {
+		dataDir = "data"
+	}
+
+	// blockchain snapshot export|import <файл>
+	if len(os.Args) > 1 && os.Args[1] == "snapshot" {
+		os.Exit(runSnapshotCommand(dataDir, os.Args[2:]))
+	}
+
 	fmt.Println("🚀 Starting Minimal Blockchain Node with Sharding...")
 
-	// ============ Инициализация хранилища ============
-	chain := blockchain.NewBlockchain()
+	// Узлы сети; первый — валидатор этого узла
+	peerAddresses := []string{
+		validatorAddress, // validator1
+	}
+
+	// Состояние счетов: генезис + переигрывание сохранённых блоков.
+	// Генезис задаёт и параметры комиссий и стейкинга сети
+	genesis, err := loadGenesis()
+	if err != nil {
+		panic("❌ Failed to load genesis: " + err.Error())
+	}
+
+	blockStore, err := blockchain.OpenFileBlockStore(filepath.Join(dataDir, "blocks"), nil)
+	if err != nil {
+		panic("❌ Failed to open block store: " + err.Error())
+	}
+	chain, err := blockchain.NewBlockchainWithStore(blockStore, genesis.FeeConfig())
+	if err != nil {
+		panic("❌ Failed to open chain: " + err.Error())
+	}
 	txPool := txpool.NewTransactionPool()
 
+	// Снимки и WAL состояния узла; состояние счетов восстанавливается
+	// от контрольной точки последнего снимка
+	snapshots, err := snapshot.Open(filepath.Join(dataDir, "snapshots"), nil)
+	if err != nil {
+		panic("❌ Failed to open snapshots: " + err.Error())
+	}
+	var checkpoint *state.Checkpoint
+	if data := snapshots.Section("state"); data != nil {
+		if checkpoint, err = state.DecodeCheckpoint(data); err != nil {
+			fmt.Printf("⚠️ %v\n", err)
+		}
+	}
+	stateMachine, err := state.NewStateMachine(chain, genesis, checkpoint)
+	if err != nil {
+		panic("❌ Failed to restore account state: " + err.Error())
+	}
+	mustRegister(snapshots, stateMachine)
+	// Сертификаты финальности блоков проверяются при импорте при любом
+	// движке: узел PoS может получить блоки BFT синхронизацией
+	stateMachine.SetCommitVerifier(bft.VerifyCommit)
+
+	// Пул отделяет готовые транзакции от ожидающих по nonce счёта
+	txPool.SetNonceSource(func(address string) uint64 {
+		return stateMachine.GetAccount(address).Nonce
+	})
+	// В блок выбираются только транзакции, покрывающие базовую комиссию следующего блока
+	txPool.SetBaseFeeSource(stateMachine.NextBaseFee)
+
+	// Долговременный ключ узла и самоподписанный TLS-сертификат этого ключа
+	// создаются в каталоге данных при первом запуске; идентификатор узла —
+	// хэш публичного ключа
+	nodeKey, err := peer.LoadNodeKey(filepath.Join(dataDir, "node.key"))
+	if err != nil {
+		panic("❌ Failed to load node key: " + err.Error())
+	}
+	if err := p2p.SetNodeKey(nodeKey, filepath.Join(dataDir, "node.crt")); err != nil {
+		panic("❌ Failed to load node certificate: " + err.Error())
+	}
+	fmt.Printf("🪪 Node identity: %s\n", nodeKey.ID())
+
+	// Рассылка транзакций соседям из BLOCKCHAIN_PEERS (адреса через запятую):
+	// транзакции, принятые пулом, анонсируются соседям, а транзакции соседей
+	// после проверки попадают в пул этого узла
+	if peers := os.Getenv("BLOCKCHAIN_PEERS"); peers != "" {
+		transport := p2p.Shared(peerAddresses[0], nil)
+		gossipEngine := gossip.NewEngine(transport, nil)
+		for _, addr := range strings.Split(peers, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				gossipEngine.AddPeer(addr)
+			}
+		}
+		// Идентификатор сети входит в подписываемые поля и ID транзакций
+		mempoolConfig := mempool.DefaultConfig()
+		mempoolConfig.ChainID = stateMachine.ChainID()
+		mempool.NewReactor(gossipEngine, txPool, mempoolConfig)
+		if err := transport.Listen(); err != nil {
+			panic("❌ Failed to start P2P transport: " + err.Error())
+		}
+		fmt.Printf("📣 Transaction gossip enabled with %d peers\n", len(gossipEngine.Peers()))
+	}
+
 	// Инициализируем KYC-менеджер
 	auditor := audit.NewSecurityAuditor()
 	kycManager = kyc.NewKYCManager(auditor)
+	mustRegister(snapshots, kycManager)
+
+	channelManager := offchain.NewChannelManager()
+	mustRegister(snapshots, channelManager)
+	api.SetChannelManager(channelManager)
 
 	// Устанавливаем KYC-менеджер для txpool и api
 	txpool.SetKYCManager(kycManager)
@@ -73,12 +184,12 @@ func main() {
 	adaptiveShardManager = sharding.NewAdaptiveShardingManager(shardConfig)
 
 	// Инициализируем начальные шарды
-	var err error
 	err = adaptiveShardManager.InitializeShards(func(id int) *sharding.Shard {
 		return &sharding.Shard{
 			ID:         id,
 			Validators: []string{"validator1"},
 			Chain:      chain,  // Use main chain (shared with API)
+			State:      stateMachine,
 			TxPool:     txPool, // Use main txPool (shared with API)
 			Active:     true,
 		}
@@ -97,16 +208,21 @@ func main() {
 	shards := adaptiveShardManager.Shards
 
 	// ============ Инициализация валидаторов ============
-	peerAddresses := []string{
-		"localhost:27656", // validator1
-	}
-
-	validators := []*pos.Validator{
-		pos.NewValidatorWithAddress("validator1", peerAddresses[0], 2000),
-	}
-
+	// Набор валидаторов следующей высоты выводится из состояния стейкинга;
+	// его стейк учитывает и правило выбора ветки
+	validators := stateMachine.Validators()
 	validatorPool := pos.NewValidatorPool(validators)
 
+	// При реорганизации возвращаем в пул транзакции покинувших цепочку блоков
+	stateMachine.OnReorg(func(event blockchain.ReorgEvent) {
+		var adopted []string
+		for _, tx := range event.AdoptedTransactions() {
+			adopted = append(adopted, tx.ID)
+		}
+		txPool.RemoveTransactions(adopted)
+		txPool.Reinject(event.OrphanedTransactions())
+	})
+
 	// ============ Инициализация signer'а ============
 	signer, err := signature.NewECDSASigner()
 	if err != nil {
@@ -126,30 +242,82 @@ func main() {
 	}
 
 	// ============ Инициализация защиты от 51% атак ============
-	validatorsMap := map[string]int64{
-		"validator1": 2000,
-	}
-
-	guard := fiftyone.NewFiftyOnePercentGuard(validatorsMap)
+	guard := fiftyone.NewFiftyOnePercentGuard(validators.Powers())
 	go guard.Monitor(30 * time.Second)
 
 	// ============ Инициализация защиты от Sybil ============
-	sybilGuard := sybil.NewSybilGuard([]string{
-		"validator1",
-	})
+	// Пиры опознаются по ключам узлов: валидаторов защита узнаёт по
+	// идентификаторам узлов из генезиса (node_id)
+	sybilGuard := sybil.NewSybilGuard(genesis.NodeIDs(validators.Addresses()))
 
 	peer.SetSybilGuard(sybilGuard)
 
+	// Обнаружение пиров на UDP-адресе BLOCKCHAIN_DISCOVERY_ADDR; узлы входа
+	// в сеть — BLOCKCHAIN_BOOTSTRAP (адреса через запятую)
+	peerManager := peer.NewPeerManager()
+	if discoveryAddr := os.Getenv("BLOCKCHAIN_DISCOVERY_ADDR"); discoveryAddr != "" {
+		discoveryConfig := peer.DefaultDiscoveryConfig()
+		for _, addr := range strings.Split(os.Getenv("BLOCKCHAIN_BOOTSTRAP"), ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				discoveryConfig.Bootstrap = append(discoveryConfig.Bootstrap, addr)
+			}
+		}
+		self := peer.Node{Addr: discoveryAddr, PeerAddr: peerAddresses[0]}
+		if err := peer.NewDiscovery(nodeKey, self, peerManager, discoveryConfig).Start(); err != nil {
+			panic("❌ Failed to start peer discovery: " + err.Error())
+		}
+	}
+
+	// На границе эпохи защиты получают новый набор валидаторов
+	stateMachine.OnValidatorSetChange(func(height int64, set pos.ValidatorPool) {
+		guard.SetValidators(set.Powers())
+		sybilGuard.SetValidators(genesis.NodeIDs(set.Addresses()))
+	})
+
 	// ========== Инициализация аудита безопасности ==========
 	auditor = audit.NewSecurityAuditor()
 
+	// ============ Выбор движка консенсуса ============
+	// Движок выбирается из реестра consensus (BLOCKCHAIN_CONSENSUS); по
+	// умолчанию PoS — у BFT в шардированном режиме конфликтуют порты
+	consensusType := manager.ConsensusPoS
+	if engine := os.Getenv("BLOCKCHAIN_CONSENSUS"); engine != "" {
+		consensusType = manager.ConsensusType(engine)
+	}
+	switcher := manager.NewConsensusSwitcher(consensusType)
+
 	// ============ Инициализация говернанса ============
 	// Создаем менеджер говернанса
 	governanceManager := governance.NewGovernanceManager()
+	governanceManager.SetValidatorPool(validatorPool)
+	// Исключение и возврат валидатора — транзакция адреса говернанса,
+	// вступающая в силу со следующей эпохи
+	// Смена движка консенсуса вступает в силу с высоты из предложения
+	governanceManager.SetConsensusExecutor(func(engine string, height int64) error {
+		return switcher.ScheduleSwitch(manager.ConsensusType(engine), height)
+	})
+	governanceManager.SetValidatorExecutor(func(validator string, jailed bool) error {
+		txType := txpool.TxUnjailValidator
+		if jailed {
+			txType = txpool.TxJailValidator
+		}
+		authority := stateMachine.StakingConfig().Authority
+		tx := txpool.NewStakingTransaction(stateMachine.ChainID(), txType, authority, validator, 0, nil)
+		tx.Nonce = txPool.NextNonce(authority)
+		tx.ID = tx.ComputeID()
+		sig, err := signer.Sign(tx.Serialize())
+		if err != nil {
+			return err
+		}
+		tx.Signature = hex.EncodeToString(sig)
+		return txPool.AddTransaction(tx)
+	})
+	mustRegister(snapshots, governanceManager)
+	snapshots.Start()
 
 	// ============ Запуск REST API ============
 	// Создаем расширенный API сервер с доступом к governance компонентам
-	apiServer := api.NewAPIServer(chain, txPool, auditor)
+	apiServer := api.NewAPIServer(chain, stateMachine, txPool, auditor)
 
 	// Добавляем маршруты для говернанса
 	// Note: В реальной реализации эти обработчики нужно добавить в API пакет
@@ -177,58 +345,57 @@ func main() {
 	double_spend.SetAuditor(auditor)
 	fiftyone.SetAuditor(auditor)
 	sybil.SetAuditor(auditor)
+	evidence.SetAuditor(auditor)
+
+	// Пример предложения создаётся один раз; после перезапуска оно восстанавливается из снимка
+	if _, restored := governanceManager.Proposals["gov-001"]; !restored {
+		// Создаем пример предложения
+		proposal := governance.NewProposal(
+			"gov-001",
+			"Update block reward",
+			"Change block reward from 5 to 3 tokens",
+			validators[0].Address,
+			governance.ParameterChange,
+			0.67, // 67% голосов
+			validatorPool,
+		)
 
-	// Создаем пример предложения
-	proposal := governance.NewProposal(
-		"gov-001",
-		"Update block reward",
-		"Change block reward from 5 to 3 tokens",
-		validators[0].Address,
-		governance.ParameterChange,
-		0.67, // 67% голосов
-		validatorPool,
-	)
-
-	// Добавляем параметры изменения
-	proposal.Parameters["block_reward"] = float64(3)
-	proposal.Parameters["transaction_fee"] = float64(0.01)
-	proposal.Parameters["max_block_size"] = int64(2048)
-
-	// Добавляем предложение в говернанс
-	governanceManager.SubmitProposal(proposal)
-
-	// Пример голосования (в реальности это будет происходить через RPC)
-	for i, validator := range validators {
-		if i == 0 {
-			// Первый валидатор голосует "за"
-			governanceManager.VoteOnProposal(proposal.ID, validator.Address, "yes")
-		} else {
-			// Остальные валидаторы голосуют "против"
-			governanceManager.VoteOnProposal(proposal.ID, validator.Address, "no")
+		// Добавляем параметры изменения
+		proposal.Parameters["block_reward"] = float64(3)
+		proposal.Parameters["transaction_fee"] = float64(0.01)
+		proposal.Parameters["max_block_size"] = int64(2048)
+
+		// Добавляем предложение в говернанс
+		governanceManager.SubmitProposal(proposal)
+
+		// Пример голосования (в реальности это будет происходить через RPC)
+		for i, validator := range validators {
+			if i == 0 {
+				// Первый валидатор голосует "за"
+				governanceManager.VoteOnProposal(proposal.ID, validator.Address, "yes")
+			} else {
+				// Остальные валидаторы голосуют "против"
+				governanceManager.VoteOnProposal(proposal.ID, validator.Address, "no")
+			}
 		}
-	}
 
-	// Подсчитываем голоса и выполняем предложение
-	if approved := governanceManager.TallyVotes(proposal.ID); approved {
-		if err := governanceManager.ExecuteProposal(proposal.ID); err != nil {
-			fmt.Printf("Failed to execute proposal: %v\n", err)
+		// Подсчитываем голоса и выполняем предложение
+		if approved := governanceManager.TallyVotes(proposal.ID); approved {
+			if err := governanceManager.ExecuteProposal(proposal.ID); err != nil {
+				fmt.Printf("Failed to execute proposal: %v\n", err)
+			}
+		} else {
+			fmt.Printf("Proposal %s was not approved\n", proposal.ID)
 		}
-	} else {
-		fmt.Printf("Proposal %s was not approved\n", proposal.ID)
 	}
 
 	// ============ Запуск консенсуса в шардах ============
-	// Using PoS consensus for simplicity (BFT has port conflicts in multi-shard setup)
-	switcher := manager.NewConsensusSwitcher(manager.ConsensusPoS)
-	go func() {
-		switcher.StartShardedConsensus(
-			shards,
-			validators,
-			*validatorPool,
-			signer,
-			peerAddresses,
-		)
-	}()
+	go switcher.StartShardedConsensus(shards, &consensus.Env{
+		Validators:    validators,
+		ValidatorPool: *validatorPool,
+		Signer:        signer,
+		Peers:         peerAddresses,
+	})
 
 	fmt.Println("✅ Node started with sharding support. Waiting for connections...")
 
@@ -302,8 +469,46 @@ func main() {
 			fmt.Printf("Error stopping monitoring server: %v\n", err)
 		}
 
+		// Сохраняем снимок состояния узла
+		if err := snapshots.Snapshot(); err != nil {
+			fmt.Printf("Error saving snapshot: %v\n", err)
+		}
+		snapshots.Close()
+
+		// Закрываем хранилище блоков
+		if err := chain.Close(); err != nil {
+			fmt.Printf("Error closing block store: %v\n", err)
+		}
+
 		os.Exit(0)
 	}()
 
 	select {}
 }
+
+// loadGenesis возвращает генезис сети из файла BLOCKCHAIN_GENESIS (если
+// задан), дополненный так же, как при запуске узла: набор валидаторов
+// выводится из состояния стейкинга, и если генезис не задаёт валидаторов,
+// узел начинает единственным валидатором-банком. Без генезиса адресом
+// говернанса, исполняющим решения о наборе валидаторов, становится
+// валидатор этого узла. Узел и команда snapshot должны строить один и тот
+// же генезис, иначе переигрывание цепочки даст другое состояние.
+func loadGenesis() (*state.Genesis, error) {
+	genesis := &state.Genesis{}
+	if genesisPath := os.Getenv("BLOCKCHAIN_GENESIS"); genesisPath != "" {
+		var err error
+		if genesis, err = state.LoadGenesis(genesisPath); err != nil {
+			return nil, err
+		}
+	}
+	if len(genesis.Validators) == 0 {
+		genesis.Validators = []state.GenesisValidator{
+			{Address: validatorAddress, SelfBond: 2000, CommissionRate: 0.1},
+		}
+	}
+	if genesis.Staking == nil {
+		genesis.Staking = pos.DefaultStakingConfig()
+		genesis.Staking.Authority = validatorAddress
+	}
+	return genesis, nil
+}
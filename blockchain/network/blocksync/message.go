@@ -0,0 +1,135 @@
+package blocksync
+
+// сообщения протокола синхронизации блоков
+
+import (
+	"fmt"
+
+	"blockchain/codec"
+	"blockchain/network/gossip"
+	"blockchain/storage/blockchain"
+)
+
+// MaxBatchSize ограничивает число блоков в одном ответе
+const MaxBatchSize = 100
+
+// Status — вершина цепочки узла: высота и хэш последнего блока
+type Status struct {
+	Height int64
+	Head   string
+}
+
+// ChainStatus возвращает состояние вершины цепочки chain
+func ChainStatus(chain *blockchain.Blockchain) *Status {
+	status := &Status{Height: chain.Height()}
+	if head := chain.GetLatestBlock(); head != nil {
+		status.Head = head.Hash
+	}
+	return status
+}
+
+func (s *Status) Encode() []byte {
+	w := codec.NewWriter(codec.KindSyncStatus)
+	w.Int64(s.Height)
+	w.String(s.Head)
+	return w.Result()
+}
+
+func DecodeStatus(data []byte) (*Status, error) {
+	r, err := codec.NewReader(data, codec.KindSyncStatus)
+	if err != nil {
+		return nil, err
+	}
+	s := &Status{
+		Height: r.Int64(),
+		Head:   r.String(),
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode sync status: %w", err)
+	}
+	return s, nil
+}
+
+// BlockRequest — запрос блоков высот [From, To]
+type BlockRequest struct {
+	From int64
+	To   int64
+}
+
+func (q *BlockRequest) Encode() []byte {
+	w := codec.NewWriter(codec.KindBlockRequest)
+	w.Int64(q.From)
+	w.Int64(q.To)
+	return w.Result()
+}
+
+func DecodeBlockRequest(data []byte) (*BlockRequest, error) {
+	r, err := codec.NewReader(data, codec.KindBlockRequest)
+	if err != nil {
+		return nil, err
+	}
+	q := &BlockRequest{
+		From: r.Int64(),
+		To:   r.Int64(),
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode block request: %w", err)
+	}
+	return q, nil
+}
+
+// EncodeBlocks кодирует ответ на запрос блоков; блоки передаются вместе
+// с сертификатами финальности
+func EncodeBlocks(blocks []*blockchain.Block) []byte {
+	w := codec.NewWriter(codec.KindBlockBatch)
+	w.Len(len(blocks))
+	for _, b := range blocks {
+		w.Bytes(b.Serialize())
+	}
+	return w.Result()
+}
+
+func DecodeBlocks(data []byte) ([]*blockchain.Block, error) {
+	r, err := codec.NewReader(data, codec.KindBlockBatch)
+	if err != nil {
+		return nil, err
+	}
+	n := r.Len()
+	if n > MaxBatchSize {
+		return nil, fmt.Errorf("block batch of %d exceeds %d", n, MaxBatchSize)
+	}
+	blocks := make([]*blockchain.Block, 0, n)
+	for i := 0; i < n; i++ {
+		b := &blockchain.Block{}
+		if err := b.Deserialize(r.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to decode block: %w", err)
+		}
+		blocks = append(blocks, b)
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode block batch: %w", err)
+	}
+	return blocks, nil
+}
+
+// Respond отвечает на запрос синхронизации (MsgStatus или MsgRequest)
+// данными цепочки chain. Диапазон блоков обрезается вершиной цепочки и
+// MaxBatchSize.
+func Respond(chain *blockchain.Blockchain, msg *gossip.SignedConsensusMessage) ([]byte, error) {
+	switch msg.Type {
+	case gossip.MsgStatus:
+		return ChainStatus(chain).Encode(), nil
+	case gossip.MsgRequest:
+		q, err := DecodeBlockRequest(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		to := min(q.To, q.From+MaxBatchSize-1, chain.Height())
+		if q.From < 0 || to < q.From {
+			return EncodeBlocks(nil), nil
+		}
+		return EncodeBlocks(chain.GetBlocks(q.From, to)), nil
+	default:
+		return nil, fmt.Errorf("unexpected sync message %s", msg.Type)
+	}
+}
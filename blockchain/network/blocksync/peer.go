@@ -0,0 +1,78 @@
+package blocksync
+
+// пир синхронизации поверх транспорта узла
+
+import (
+	"time"
+
+	"blockchain/network/gossip"
+	"blockchain/network/p2p"
+	"blockchain/storage/blockchain"
+)
+
+// Peer — источник блоков при синхронизации
+type Peer interface {
+	// ID возвращает идентификатор пира для журнала
+	ID() string
+	// Status возвращает вершину цепочки пира
+	Status() (*Status, error)
+	// Blocks возвращает блоки высот [from, to] с сертификатами; пир может
+	// вернуть меньше блоков, чем запрошено
+	Blocks(from, to int64) ([]*blockchain.Block, error)
+}
+
+// TCPPeer запрашивает блоки у узла по каналу синхронизации транспорта:
+// запрос и ответ передаются в постоянном соединении с пиром
+type TCPPeer struct {
+	Addr      string
+	Transport *p2p.Transport
+	Timeout   time.Duration
+}
+
+// NewTCPPeer создаёт пира по адресу addr; запросы отправляются через
+// транспорт запрашивающего узла
+func NewTCPPeer(t *p2p.Transport, addr string, timeout time.Duration) *TCPPeer {
+	return &TCPPeer{Addr: addr, Transport: t, Timeout: timeout}
+}
+
+func (p *TCPPeer) ID() string {
+	return p.Addr
+}
+
+func (p *TCPPeer) Status() (*Status, error) {
+	data, err := p.Request(gossip.MsgStatus, nil)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeStatus(data)
+}
+
+func (p *TCPPeer) Blocks(from, to int64) ([]*blockchain.Block, error) {
+	data, err := p.Request(gossip.MsgRequest, (&BlockRequest{From: from, To: to}).Encode())
+	if err != nil {
+		return nil, err
+	}
+	return DecodeBlocks(data)
+}
+
+// Request отправляет пиру запрос msgType с данными data по каналу
+// сообщений этого типа и возвращает ответ
+func (p *TCPPeer) Request(msgType gossip.MessageType, data []byte) ([]byte, error) {
+	msg := &gossip.SignedConsensusMessage{Type: msgType, From: p.Transport.Address(), Data: data}
+	encoded, err := msg.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return p.Transport.Request(p.Addr, gossip.Channel(msgType), encoded, p.Timeout)
+}
+
+// Serve регистрирует ответы на запросы синхронизации блоков цепочки chain
+func Serve(t *p2p.Transport, chain *blockchain.Blockchain) {
+	t.OnRequest(p2p.ChannelSync, func(from string, data []byte) ([]byte, error) {
+		msg, err := gossip.DecodeSignedMessage(data)
+		if err != nil {
+			return nil, err
+		}
+		return Respond(chain, msg)
+	})
+}
@@ -0,0 +1,291 @@
+package blocksync
+
+// синхронизация блоков отставшего узла
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"blockchain/storage/blockchain"
+)
+
+var (
+	ErrNoPeers     = errors.New("no peers to sync from")
+	ErrPeerTimeout = errors.New("peer did not respond in time")
+	ErrBadResponse = errors.New("unexpected blocks in response")
+)
+
+// Backend — цепочка, которую догоняет узел
+type Backend interface {
+	// Status возвращает вершину локальной цепочки
+	Status() *Status
+	// SyncBlock проверяет блок следующей высоты по его сертификату
+	// финальности и фиксирует блок
+	SyncBlock(block *blockchain.Block) error
+}
+
+// Config — параметры синхронизации
+type Config struct {
+	BatchSize      int64         // блоков в одном запросе
+	MaxParallel    int           // одновременных запросов к разным пирам
+	RequestTimeout time.Duration // ожидание ответа пира
+}
+
+// DefaultConfig возвращает параметры синхронизации по умолчанию
+func DefaultConfig() *Config {
+	return &Config{
+		BatchSize:      20,
+		MaxParallel:    4,
+		RequestTimeout: 5 * time.Second,
+	}
+}
+
+// Reactor догоняет пиров, ушедших вперёд: узнаёт их вершины, параллельно
+// запрашивает диапазоны блоков у разных пиров и применяет блоки по порядку.
+// Пир, который не ответил вовремя, вернул не те блоки или блок с неверным
+// сертификатом, до конца синхронизации исключается, а его диапазон
+// запрашивается у других пиров.
+type Reactor struct {
+	backend Backend
+	config  *Config
+	mu      sync.Mutex
+}
+
+// NewReactor создаёт реактор; config == nil — параметры по умолчанию
+func NewReactor(backend Backend, config *Config) *Reactor {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	return &Reactor{backend: backend, config: config}
+}
+
+// Config возвращает параметры синхронизации
+func (r *Reactor) Config() *Config {
+	return r.config
+}
+
+// span — диапазон высот [from, to]
+type span struct {
+	from, to int64
+}
+
+// peerState — пир в ходе синхронизации
+type peerState struct {
+	peer    Peer
+	height  int64
+	busy    bool
+	banned  bool // не участвует в синхронизации
+	dropped bool // исключён за ошибочный ответ
+}
+
+type response struct {
+	peer   *peerState
+	span   span
+	blocks []*blockchain.Block
+	err    error
+}
+
+// Sync догоняет вершину самого длинного из пиров и возвращает высоту
+// локальной цепочки после синхронизации. Пиры, не ответившие на запрос
+// состояния, не учитываются. ErrNoPeers — все пиры исключены или
+// оставшиеся не могут отдать недостающие блоки.
+func (r *Reactor) Sync(peers []Peer) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tip := r.backend.Status().Height
+	states := r.statuses(peers)
+	next := tip + 1
+	var retry []span
+	ready := make(map[int64]*response)
+	responses := make(chan *response, r.config.MaxParallel)
+	inflight := 0
+	synced := tip
+
+	for {
+		target := tip
+		alive, dropped := 0, 0
+		for _, p := range states {
+			if !p.banned {
+				target = max(target, p.height)
+				alive++
+			}
+			if p.dropped {
+				dropped++
+			}
+		}
+		if alive == 0 && dropped > 0 {
+			return tip, fmt.Errorf("%w: all peers dropped at height %d", ErrNoPeers, tip)
+		}
+		if tip >= target {
+			if tip > synced {
+				fmt.Printf("📦 Synced blocks %d..%d\n", synced+1, tip)
+			}
+			return tip, nil
+		}
+
+		// Назначаем запросы свободным пирам: сначала повторы, затем новые диапазоны
+		for inflight < r.config.MaxParallel {
+			repeat := len(retry) > 0
+			var s span
+			if repeat {
+				s = retry[0]
+			} else if next <= target {
+				s = span{next, min(next+r.config.BatchSize-1, target)}
+			} else {
+				break
+			}
+			p := pickPeer(states, s.from)
+			if p == nil {
+				break
+			}
+			if repeat {
+				retry = retry[1:]
+				if p.height < s.to {
+					retry = insertSpan(retry, span{p.height + 1, s.to})
+				}
+			} else {
+				next = min(s.to, p.height) + 1
+			}
+			s.to = min(s.to, p.height)
+			p.busy = true
+			inflight++
+			go r.request(p, s, responses)
+		}
+		if inflight == 0 {
+			return tip, fmt.Errorf("%w: stuck at height %d of %d", ErrNoPeers, tip, target)
+		}
+
+		res := <-responses
+		inflight--
+		res.peer.busy = false
+		if err := checkResponse(res); err != nil {
+			ban(res.peer, err)
+			retry = insertSpan(retry, res.span)
+			continue
+		}
+		if last := res.blocks[len(res.blocks)-1].Index; last < res.span.to {
+			// Пир отдал меньше, чем заявил: остаток берём у других
+			res.peer.height = last
+			retry = insertSpan(retry, span{last + 1, res.span.to})
+		}
+		ready[res.span.from] = res
+
+		// Применяем готовые диапазоны по порядку высот
+		for res, ok := ready[tip+1]; ok; res, ok = ready[tip+1] {
+			delete(ready, tip+1)
+			last := res.blocks[len(res.blocks)-1].Index
+			for _, b := range res.blocks {
+				if err := r.backend.SyncBlock(b); err != nil {
+					ban(res.peer, fmt.Errorf("block %d: %w", b.Index, err))
+					retry = insertSpan(retry, span{b.Index, last})
+					break
+				}
+				tip = b.Index
+			}
+			if tip < last {
+				break
+			}
+		}
+	}
+}
+
+// statuses параллельно запрашивает вершины пиров
+func (r *Reactor) statuses(peers []Peer) []*peerState {
+	states := make([]*peerState, len(peers))
+	var wg sync.WaitGroup
+	for i, p := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			status, err := withTimeout(r.config.RequestTimeout, p.Status)
+			if err != nil {
+				states[i] = &peerState{peer: p, banned: true}
+				return
+			}
+			states[i] = &peerState{peer: p, height: status.Height}
+		}()
+	}
+	wg.Wait()
+	return states
+}
+
+// request запрашивает у пира диапазон s и отправляет ответ в responses
+func (r *Reactor) request(p *peerState, s span, responses chan<- *response) {
+	blocks, err := withTimeout(r.config.RequestTimeout, func() ([]*blockchain.Block, error) {
+		return p.peer.Blocks(s.from, s.to)
+	})
+	responses <- &response{peer: p, span: s, blocks: blocks, err: err}
+}
+
+// pickPeer выбирает свободного пира, у которого есть блок высоты from, —
+// с самой высокой вершиной. Занятые пиры пропускаются, поэтому
+// параллельные запросы расходятся по разным пирам.
+func pickPeer(states []*peerState, from int64) *peerState {
+	var best *peerState
+	for _, p := range states {
+		if p.banned || p.busy || p.height < from {
+			continue
+		}
+		if best == nil || p.height > best.height {
+			best = p
+		}
+	}
+	return best
+}
+
+// checkResponse проверяет, что пир вернул непустую последовательность
+// блоков подряд с начала запрошенного диапазона
+func checkResponse(res *response) error {
+	if res.err != nil {
+		return res.err
+	}
+	if len(res.blocks) == 0 {
+		return fmt.Errorf("%w: no blocks for %d..%d", ErrBadResponse, res.span.from, res.span.to)
+	}
+	if int64(len(res.blocks)) > res.span.to-res.span.from+1 {
+		return fmt.Errorf("%w: %d blocks for %d..%d", ErrBadResponse, len(res.blocks), res.span.from, res.span.to)
+	}
+	for i, b := range res.blocks {
+		if b == nil || b.Index != res.span.from+int64(i) {
+			return fmt.Errorf("%w: block %d out of order", ErrBadResponse, res.span.from+int64(i))
+		}
+	}
+	return nil
+}
+
+// ban исключает пира до конца синхронизации
+func ban(p *peerState, err error) {
+	p.banned, p.dropped = true, true
+	fmt.Printf("🚫 Peer %s dropped from block sync: %v\n", p.peer.ID(), err)
+}
+
+// insertSpan добавляет диапазон к повторам, сохраняя порядок высот
+func insertSpan(spans []span, s span) []span {
+	spans = append(spans, s)
+	sort.Slice(spans, func(i, j int) bool { return spans[i].from < spans[j].from })
+	return spans
+}
+
+// withTimeout ждёт результата f не дольше timeout
+func withTimeout[T any](timeout time.Duration, f func() (T, error)) (T, error) {
+	type result struct {
+		value T
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		value, err := f()
+		done <- result{value, err}
+	}()
+	select {
+	case res := <-done:
+		return res.value, res.err
+	case <-time.After(timeout):
+		var zero T
+		return zero, ErrPeerTimeout
+	}
+}
@@ -0,0 +1,138 @@
+package blocksync
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"blockchain/storage/blockchain"
+)
+
+// testBlocks возвращает цепочку из генезиса и n блоков
+func testBlocks(n int) []*blockchain.Block {
+	blocks := []*blockchain.Block{{Index: 0, Hash: "genesis"}}
+	for i := 1; i <= n; i++ {
+		b := &blockchain.Block{Index: int64(i), Timestamp: int64(i), PrevHash: blocks[i-1].Hash}
+		b.Hash = b.CalculateHash()
+		blocks = append(blocks, b)
+	}
+	return blocks
+}
+
+// testBackend принимает только блоки эталонной цепочки по порядку — так
+// проверка сертификата отличает настоящий блок от подделки
+type testBackend struct {
+	canonical []*blockchain.Block
+	tip       int64
+}
+
+func (b *testBackend) Status() *Status {
+	return &Status{Height: b.tip, Head: b.canonical[b.tip].Hash}
+}
+
+func (b *testBackend) SyncBlock(block *blockchain.Block) error {
+	if block.Index != b.tip+1 {
+		return fmt.Errorf("expected block %d, got %d", b.tip+1, block.Index)
+	}
+	if block.Hash != b.canonical[block.Index].Hash {
+		return fmt.Errorf("invalid commit for block %d", block.Index)
+	}
+	b.tip = block.Index
+	return nil
+}
+
+// testPeer заявляет вершину height и отдаёт блоки из blocks
+type testPeer struct {
+	id     string
+	height int64
+	blocks []*blockchain.Block
+	stall  time.Duration
+
+	mu       sync.Mutex
+	requests int
+}
+
+func (p *testPeer) ID() string { return p.id }
+
+func (p *testPeer) Status() (*Status, error) {
+	return &Status{Height: p.height}, nil
+}
+
+func (p *testPeer) Blocks(from, to int64) ([]*blockchain.Block, error) {
+	p.mu.Lock()
+	p.requests++
+	p.mu.Unlock()
+	time.Sleep(p.stall)
+	var blocks []*blockchain.Block
+	for h := from; h <= to && h < int64(len(p.blocks)); h++ {
+		blocks = append(blocks, p.blocks[h])
+	}
+	return blocks, nil
+}
+
+// forged возвращает копию цепочки, в которой блоки начиная с from подменены
+func forged(blocks []*blockchain.Block, from int64) []*blockchain.Block {
+	out := append([]*blockchain.Block{}, blocks...)
+	for h := from; h < int64(len(out)); h++ {
+		fake := *out[h]
+		fake.Hash = fmt.Sprintf("fake-%d", h)
+		out[h] = &fake
+	}
+	return out
+}
+
+func testConfig() *Config {
+	return &Config{BatchSize: 5, MaxParallel: 4, RequestTimeout: 50 * time.Millisecond}
+}
+
+// TestReactor_SyncDespiteFaultyPeers - узел догоняет цепочку, хотя один пир
+// завышает высоту, другой не отвечает, третий подменяет блоки
+func TestReactor_SyncDespiteFaultyPeers(t *testing.T) {
+	canonical := testBlocks(42)
+	backend := &testBackend{canonical: canonical}
+	honest := &testPeer{id: "honest", height: 42, blocks: canonical}
+	peers := []Peer{
+		&testPeer{id: "liar", height: 1000, blocks: canonical[:11]},
+		&testPeer{id: "staller", height: 42, blocks: canonical, stall: time.Second},
+		&testPeer{id: "forger", height: 42, blocks: forged(canonical, 3)},
+		honest,
+	}
+
+	height, err := NewReactor(backend, testConfig()).Sync(peers)
+	if err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if height != 42 || backend.tip != 42 {
+		t.Errorf("Expected to sync to height 42, got %d (backend %d)", height, backend.tip)
+	}
+	if honest.requests == 0 {
+		t.Errorf("Expected blocks to be requested from the honest peer")
+	}
+}
+
+// TestReactor_NoHonestPeers - без честных пиров синхронизация
+// останавливается на последнем проверенном блоке
+func TestReactor_NoHonestPeers(t *testing.T) {
+	canonical := testBlocks(20)
+	backend := &testBackend{canonical: canonical}
+	peers := []Peer{
+		&testPeer{id: "liar", height: 20, blocks: canonical[:8]},
+		&testPeer{id: "forger", height: 20, blocks: forged(canonical, 12)},
+	}
+
+	height, err := NewReactor(backend, testConfig()).Sync(peers)
+	if !errors.Is(err, ErrNoPeers) {
+		t.Fatalf("Expected ErrNoPeers, got %v", err)
+	}
+	if height != 11 || backend.tip != 11 {
+		t.Errorf("Expected to stop at height 11, got %d", height)
+	}
+
+	// Узел, не отстающий от пиров, ничего не запрашивает
+	peer := &testPeer{id: "peer", height: 11, blocks: canonical}
+	if height, err := NewReactor(backend, testConfig()).Sync([]Peer{peer}); err != nil || height != 11 || peer.requests != 0 {
+		t.Errorf("Expected no requests at the peer's height, got height %d, %d requests, %v", height, peer.requests, err)
+	}
+}
@@ -0,0 +1,189 @@
+package gossip
+
+// каноническое кодирование сообщений
+
+import (
+	"fmt"
+
+	"blockchain/codec"
+	"blockchain/storage/blockchain"
+)
+
+func (m *GossipMessage) Encode() ([]byte, error) {
+	w := codec.NewWriter(codec.KindGossip)
+	w.String(string(m.Type))
+	w.String(m.From)
+	w.Bytes(m.Data)
+	return w.Result(), nil
+}
+
+func DecodeMessage(data []byte) (*GossipMessage, error) {
+	r, err := codec.NewReader(data, codec.KindGossip)
+	if err != nil {
+		return nil, err
+	}
+	msg := &GossipMessage{
+		Type: MessageType(r.String()),
+		From: r.String(),
+		Data: r.Bytes(),
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode gossip message: %w", err)
+	}
+	return msg, nil
+}
+
+func (m *ConsensusMessage) Encode() ([]byte, error) {
+	w := codec.NewWriter(codec.KindConsensus)
+	w.String(string(m.Type))
+	w.Int64(m.Height)
+	w.Int64(m.Round)
+	// Блок необязателен: флаг наличия и закодированный блок
+	w.Bool(m.Block != nil)
+	if m.Block != nil {
+		w.Bytes(m.Block.Serialize())
+	}
+	w.String(m.From)
+	w.Bytes(m.Data)
+	return w.Result(), nil
+}
+
+func DecodeConsensusMessage(data []byte) (*ConsensusMessage, error) {
+	r, err := codec.NewReader(data, codec.KindConsensus)
+	if err != nil {
+		return nil, err
+	}
+	msg := &ConsensusMessage{
+		Type:   MessageType(r.String()),
+		Height: r.Int64(),
+		Round:  r.Int64(),
+	}
+	if r.Bool() {
+		msg.Block = &blockchain.Block{}
+		if err := msg.Block.Deserialize(r.Bytes()); err != nil {
+			return nil, fmt.Errorf("failed to decode consensus block: %w", err)
+		}
+	}
+	msg.From = r.String()
+	msg.Data = r.Bytes()
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode consensus message: %w", err)
+	}
+	return msg, nil
+}
+
+func (m *SignedConsensusMessage) Encode() ([]byte, error) {
+	w := codec.NewWriter(codec.KindSignedConsensus)
+	w.String(string(m.Type))
+	w.Int64(m.Height)
+	w.Int64(m.Round)
+	w.String(m.From)
+	w.Bytes(m.Data)
+	w.Bytes(m.Signature)
+	return w.Result(), nil
+}
+
+// DecodeSignedMessage — декодирует байты в SignedConsensusMessage
+func DecodeSignedMessage(data []byte) (*SignedConsensusMessage, error) {
+	r, err := codec.NewReader(data, codec.KindSignedConsensus)
+	if err != nil {
+		return nil, err
+	}
+	msg := &SignedConsensusMessage{
+		Type:      MessageType(r.String()),
+		Height:    r.Int64(),
+		Round:     r.Int64(),
+		From:      r.String(),
+		Data:      r.Bytes(),
+		Signature: r.Bytes(),
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode signed message: %w", err)
+	}
+	return msg, nil
+}
+
+// VoteSignBytes возвращает подписываемые данные голоса (prevote, precommit)
+// валидатора с индексом validatorIndex за блок blockHash на высоте height
+// в раунде round; timestamp — время голоса (Unix-секунды)
+func VoteSignBytes(voteType MessageType, height, round int64, blockHash string, validatorIndex int, timestamp int64) []byte {
+	w := codec.NewWriter(codec.KindVote)
+	w.String(string(voteType))
+	w.Int64(height)
+	w.Int64(round)
+	w.String(blockHash)
+	w.Int64(int64(validatorIndex))
+	w.Int64(timestamp)
+	return w.Result()
+}
+
+// VoteSignData — поля подписываемых данных голоса
+type VoteSignData struct {
+	Type           MessageType
+	Height         int64
+	Round          int64
+	BlockHash      string
+	ValidatorIndex int
+	Timestamp      int64
+}
+
+// DecodeVoteSignBytes восстанавливает поля голоса из данных VoteSignBytes
+func DecodeVoteSignBytes(data []byte) (*VoteSignData, error) {
+	r, err := codec.NewReader(data, codec.KindVote)
+	if err != nil {
+		return nil, err
+	}
+	v := &VoteSignData{
+		Type:           MessageType(r.String()),
+		Height:         r.Int64(),
+		Round:          r.Int64(),
+		BlockHash:      r.String(),
+		ValidatorIndex: int(r.Int64()),
+		Timestamp:      r.Int64(),
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode vote: %w", err)
+	}
+	return v, nil
+}
+
+// ProposalSignBytes возвращает подписываемые данные предложения блока
+// blockHash пропосером proposer на высоте height в раунде round;
+// polRound — раунд proof-of-lock или -1
+func ProposalSignBytes(height, round, polRound int64, proposer, blockHash string) []byte {
+	w := codec.NewWriter(codec.KindProposalSigning)
+	w.Int64(height)
+	w.Int64(round)
+	w.Int64(polRound)
+	w.String(proposer)
+	w.String(blockHash)
+	return w.Result()
+}
+
+// ProposalSignData — поля подписываемых данных предложения
+type ProposalSignData struct {
+	Height    int64
+	Round     int64
+	POLRound  int64
+	Proposer  string
+	BlockHash string
+}
+
+// DecodeProposalSignBytes восстанавливает поля предложения из данных ProposalSignBytes
+func DecodeProposalSignBytes(data []byte) (*ProposalSignData, error) {
+	r, err := codec.NewReader(data, codec.KindProposalSigning)
+	if err != nil {
+		return nil, err
+	}
+	p := &ProposalSignData{
+		Height:    r.Int64(),
+		Round:     r.Int64(),
+		POLRound:  r.Int64(),
+		Proposer:  r.String(),
+		BlockHash: r.String(),
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode proposal signing data: %w", err)
+	}
+	return p, nil
+}
@@ -1,8 +1,6 @@
 package gossip
 
 import (
-	"crypto/tls"
-	"encoding/json"
 	"fmt"
 
 	"blockchain/crypto/signature"
@@ -21,18 +19,6 @@ type ConsensusMessage struct {
 	Data []byte
 }
 
-func (m *ConsensusMessage) Encode() ([]byte, error) {
-	return json.Marshal(m)
-}
-
-func DecodeConsensusMessage(data []byte) (*ConsensusMessage, error) {
-	var msg ConsensusMessage
-	if err := json.Unmarshal(data, &msg); err != nil {
-		return nil, err
-	}
-	return &msg, nil
-}
-
 func HandleSignedMessage(data []byte) (*ConsensusMessage, error) {
 	msg, err := DecodeSignedMessage(data)
 	if err != nil {
@@ -58,20 +44,11 @@ func HandleSignedMessage(data []byte) (*ConsensusMessage, error) {
 	}, nil
 }
 
-func BroadcastConsensusMessage(peers []*peer.Peer, msg *ConsensusMessage) error {
-	for _, peer := range peers {
-		conn, err := tls.Dial("tcp", peer.Addr, p2p.GenerateTLSConfig())
-		if err != nil {
-			fmt.Printf("Can't connect to peer %s: %v\n", peer.ID, err)
-			continue
-		}
-		defer conn.Close()
-
-		encoded, _ := msg.Encode()
-		_, err = conn.Write(encoded)
-		if err != nil {
-			return err
-		}
+func BroadcastConsensusMessage(t *p2p.Transport, peers []*peer.Peer, msg *ConsensusMessage) error {
+	encoded, err := msg.Encode()
+	if err != nil {
+		return err
 	}
+	send(t, peers, Channel(msg.Type), encoded)
 	return nil
 }
@@ -0,0 +1,387 @@
+package gossip
+
+// эпидемическая рассылка: сообщение пересылается соседями, пока не
+// исчерпает TTL, поэтому сеть без полной связности тоже сходится
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"blockchain/network/p2p"
+)
+
+var ErrEmptyTopic = errors.New("empty gossip topic")
+
+// Network — соединения с соседями, через которые работает движок
+// рассылки; p2p.Transport реализует его, а тесты подставляют модель сети
+type Network interface {
+	Address() string
+	Send(addr string, ch p2p.ChannelID, msg []byte) error
+	OnReceive(ch p2p.ChannelID, handler p2p.Handler)
+}
+
+var _ Network = (*p2p.Transport)(nil)
+
+// Config — параметры рассылки
+type Config struct {
+	FanOut        int           // соседей, которым узел пересылает новое сообщение
+	TTL           int64         // переходов, которые проходит сообщение от автора
+	SeenTTL       time.Duration // сколько узел помнит сообщение и хранит его тело
+	SeenCapacity  int           // предел числа запомненных сообщений
+	LazyThreshold int           // сообщения больше этого размера в байтах анонсируются идентификатором
+	PullTimeout   time.Duration // через сколько анонсированное тело запрашивается у другого соседа
+	MaxIDs        int           // предел идентификаторов в одном анонсе или запросе; остальные игнорируются
+	MaxWanted     int           // предел тел, одновременно ожидаемых по анонсам
+	Seed          int64         // зерно выбора соседей; 0 — от текущего времени
+}
+
+// DefaultConfig возвращает параметры по умолчанию
+func DefaultConfig() *Config {
+	return &Config{
+		FanOut:        6,
+		TTL:           8,
+		SeenTTL:       2 * time.Minute,
+		SeenCapacity:  100000,
+		LazyThreshold: 16 << 10,
+		PullTimeout:   time.Second,
+		MaxIDs:        512,
+		MaxWanted:     4096,
+	}
+}
+
+// Handler получает сообщение темы от соседа from
+type Handler func(from string, data []byte)
+
+// Validator проверяет сообщение темы от соседа from до доставки
+// подписчикам и пересылки. Отклонённое сообщение не пересылается и
+// забывается, поэтому его копию от другого соседа можно принять.
+type Validator func(from string, data []byte) error
+
+// Stats — счётчики движка рассылки
+type Stats struct {
+	Published  int // опубликовано узлом
+	Delivered  int // новых сообщений передано подписчикам или принято для пересылки
+	Duplicates int // отброшено повторов
+	Sent       int // отправлено конвертов с телом
+	Announced  int // отправлено анонсов
+	Pulled     int // запрошено тел по анонсам
+	Rejected   int // отклонено проверкой темы
+}
+
+// Engine — движок эпидемической рассылки. Новое сообщение узел передаёт
+// подписчикам темы и пересылает FanOut случайным соседям, кроме
+// приславшего, уменьшив TTL; повторы отбрасываются по кэшу уже виденных
+// идентификаторов. Большие сообщения (блоки) рассылаются лениво: соседям
+// уходит анонс идентификатора, а тело забирает только тот, кто его ещё не
+// видел. Узел пересылает сообщения всех тем, подписка лишь определяет,
+// какие из них он обрабатывает сам.
+type Engine struct {
+	network Network
+	config  *Config
+
+	mu     sync.Mutex
+	peers  []string
+	subs   map[MessageType][]Handler
+	valid  map[MessageType]Validator
+	lazy   map[MessageType]bool
+	seen   *seenCache
+	wanted map[MessageID]time.Time // запрошенные по анонсу тела
+	rng    *rand.Rand
+	stats  Stats
+	now    func() time.Time
+}
+
+// NewEngine создаёт движок рассылки поверх network и принимает конверты
+// из канала p2p.ChannelGossip. config — параметры (по умолчанию DefaultConfig).
+func NewEngine(network Network, config *Config) *Engine {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	e := &Engine{
+		network: network,
+		config:  config,
+		subs:    make(map[MessageType][]Handler),
+		valid:   make(map[MessageType]Validator),
+		lazy:    make(map[MessageType]bool),
+		seen:    newSeenCache(config.SeenTTL, config.SeenCapacity),
+		wanted:  make(map[MessageID]time.Time),
+		rng:     rand.New(rand.NewSource(seed)),
+		now:     time.Now,
+	}
+	network.OnReceive(p2p.ChannelGossip, e.receive)
+	return e
+}
+
+// AddPeer добавляет соседа, которому пересылаются сообщения
+func (e *Engine) AddPeer(addr string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if addr == e.network.Address() {
+		return
+	}
+	for _, p := range e.peers {
+		if p == addr {
+			return
+		}
+	}
+	e.peers = append(e.peers, addr)
+}
+
+// RemovePeer убирает соседа
+func (e *Engine) RemovePeer(addr string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for i, p := range e.peers {
+		if p == addr {
+			e.peers = append(e.peers[:i], e.peers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Peers возвращает соседей узла
+func (e *Engine) Peers() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.peers...)
+}
+
+// Subscribe регистрирует обработчик сообщений темы topic
+func (e *Engine) Subscribe(topic MessageType, handler Handler) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.subs[topic] = append(e.subs[topic], handler)
+}
+
+// Unsubscribe снимает обработчики темы; сообщения темы по-прежнему
+// пересылаются соседям
+func (e *Engine) Unsubscribe(topic MessageType) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.subs, topic)
+}
+
+// Validate задаёт проверку сообщений темы topic от соседей, заменяя прежнюю
+func (e *Engine) Validate(topic MessageType, validator Validator) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.valid[topic] = validator
+}
+
+// Lazy включает для темы topic анонсы вместо сообщений независимо от
+// размера: тело забирают только соседи, которые его ещё не видели
+func (e *Engine) Lazy(topic MessageType) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lazy[topic] = true
+}
+
+// Seen сообщает, помнит ли узел сообщение id
+func (e *Engine) Seen(id MessageID) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.seen.has(id, e.now())
+}
+
+// Stats возвращает счётчики движка
+func (e *Engine) Stats() Stats {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stats
+}
+
+// Publish рассылает сообщение темы topic. Возвращает идентификатор;
+// сообщение, которое узел уже видел, повторно не рассылается.
+func (e *Engine) Publish(topic MessageType, data []byte) (MessageID, error) {
+	if topic == "" {
+		return MessageID{}, ErrEmptyTopic
+	}
+	id := NewMessageID(topic, data)
+	msg := &Envelope{Type: envelopePush, Topic: topic, TTL: e.config.TTL, Data: data}
+
+	e.mu.Lock()
+	if !e.seen.add(id, msg, e.now()) {
+		e.mu.Unlock()
+		return id, nil
+	}
+	e.stats.Published++
+	out := e.forward(id, msg, "")
+	e.mu.Unlock()
+
+	e.send(out)
+	return id, nil
+}
+
+// outgoing — конверт к соседу
+type outgoing struct {
+	to  string
+	env *Envelope
+}
+
+// receive обрабатывает конверт соседа
+func (e *Engine) receive(from string, data []byte) {
+	env, err := DecodeEnvelope(data)
+	if err != nil {
+		fmt.Printf("❌ Bad gossip envelope from %s: %v\n", from, err)
+		return
+	}
+	switch env.Type {
+	case envelopePush:
+		e.handlePush(from, env)
+	case envelopeIHave:
+		e.handleIHave(from, env)
+	case envelopeIWant:
+		e.handleIWant(from, env)
+	}
+}
+
+// handlePush принимает сообщение: новое передаётся подписчикам и
+// пересылается дальше, повтор отбрасывается. TTL соседа не больше
+// собственного TTL узла: завышенный TTL не продлевает рассылку.
+func (e *Engine) handlePush(from string, env *Envelope) {
+	id := NewMessageID(env.Topic, env.Data)
+	// Запоминается сообщение с TTL, с которым его получат соседи, в том
+	// числе запросившие тело по анонсу
+	next := &Envelope{Type: envelopePush, Topic: env.Topic, TTL: min(env.TTL, e.config.TTL) - 1, Data: env.Data}
+	e.mu.Lock()
+	delete(e.wanted, id)
+	if !e.seen.add(id, next, e.now()) {
+		e.stats.Duplicates++
+		e.mu.Unlock()
+		return
+	}
+	validator := e.valid[env.Topic]
+	e.mu.Unlock()
+
+	// Проверка идёт вне блокировки: копии, пришедшие во время неё, уже повторы
+	if validator != nil {
+		if err := validator(from, env.Data); err != nil {
+			e.mu.Lock()
+			e.seen.remove(id)
+			e.stats.Rejected++
+			e.mu.Unlock()
+			return
+		}
+	}
+
+	e.mu.Lock()
+	e.stats.Delivered++
+	handlers := append([]Handler(nil), e.subs[env.Topic]...)
+	var out []outgoing
+	if next.TTL > 0 {
+		out = e.forward(id, next, from)
+	}
+	e.mu.Unlock()
+
+	for _, handler := range handlers {
+		handler(from, env.Data)
+	}
+	e.send(out)
+}
+
+// handleIHave запрашивает у анонсировавшего соседа тела неизвестных
+// сообщений. Тело, уже запрошенное у другого соседа, повторно
+// запрашивается только по истечении PullTimeout. Из анонса учитываются
+// первые MaxIDs идентификаторов, и ожидается не больше MaxWanted тел сразу.
+func (e *Engine) handleIHave(from string, env *Envelope) {
+	now := e.now()
+	var want []MessageID
+	e.mu.Lock()
+	for id, at := range e.wanted {
+		if now.Sub(at) >= e.config.PullTimeout {
+			delete(e.wanted, id)
+		}
+	}
+	for _, id := range capIDs(env.IDs, e.config.MaxIDs) {
+		if e.seen.has(id, now) {
+			e.stats.Duplicates++
+			continue
+		}
+		if _, ok := e.wanted[id]; ok {
+			continue
+		}
+		if len(e.wanted) >= e.config.MaxWanted {
+			break
+		}
+		e.wanted[id] = now
+		want = append(want, id)
+	}
+	e.stats.Pulled += len(want)
+	e.mu.Unlock()
+
+	if len(want) > 0 {
+		e.send([]outgoing{{to: from, env: &Envelope{Type: envelopeIWant, IDs: want}}})
+	}
+}
+
+// handleIWant отправляет соседу тела запрошенных сообщений, которые узел
+// ещё помнит; из запроса учитываются первые MaxIDs идентификаторов
+func (e *Engine) handleIWant(from string, env *Envelope) {
+	now := e.now()
+	var out []outgoing
+	e.mu.Lock()
+	for _, id := range capIDs(env.IDs, e.config.MaxIDs) {
+		if msg := e.seen.get(id, now); msg != nil {
+			out = append(out, outgoing{to: from, env: msg})
+		}
+	}
+	e.stats.Sent += len(out)
+	e.mu.Unlock()
+	e.send(out)
+}
+
+// capIDs возвращает первые limit идентификаторов
+func capIDs(ids []MessageID, limit int) []MessageID {
+	if len(ids) > limit {
+		return ids[:limit]
+	}
+	return ids
+}
+
+// forward выбирает до FanOut случайных соседей, кроме from, и готовит им
+// сообщение или его анонс; вызывается под блокировкой
+func (e *Engine) forward(id MessageID, msg *Envelope, from string) []outgoing {
+	env := msg
+	lazy := e.lazy[msg.Topic] || len(msg.Data) > e.config.LazyThreshold
+	if lazy {
+		env = &Envelope{Type: envelopeIHave, Topic: msg.Topic, IDs: []MessageID{id}}
+	}
+
+	candidates := make([]string, 0, len(e.peers))
+	for _, p := range e.peers {
+		if p != from {
+			candidates = append(candidates, p)
+		}
+	}
+	e.rng.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	if len(candidates) > e.config.FanOut {
+		candidates = candidates[:e.config.FanOut]
+	}
+
+	out := make([]outgoing, len(candidates))
+	for i, to := range candidates {
+		out[i] = outgoing{to: to, env: env}
+	}
+	if lazy {
+		e.stats.Announced += len(out)
+	} else {
+		e.stats.Sent += len(out)
+	}
+	return out
+}
+
+// send отправляет конверты вне блокировки движка
+func (e *Engine) send(out []outgoing) {
+	for _, o := range out {
+		if err := e.network.Send(o.to, p2p.ChannelGossip, o.env.Encode()); err != nil {
+			fmt.Printf("⚠️ Gossip to %s failed: %v\n", o.to, err)
+		}
+	}
+}
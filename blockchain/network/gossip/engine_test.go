@@ -0,0 +1,320 @@
+package gossip
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"blockchain/network/gossip/gossiptest"
+	"blockchain/network/p2p"
+)
+
+var _ Network = (*gossiptest.Node)(nil)
+
+// newSimGossip создаёт n движков; каждый узел соединён с соседями по
+// кольцу и с degree-2 случайными узлами, поэтому сеть связна, но далека
+// от полной
+func newSimGossip(n, degree int, config *Config) (*gossiptest.Network, []*Engine) {
+	net := gossiptest.NewNetwork()
+	rng := rand.New(rand.NewSource(1))
+	engines := make([]*Engine, n)
+	for i := range engines {
+		node := net.Node(fmt.Sprintf("node-%d", i))
+		cfg := *config
+		cfg.Seed = int64(i + 1)
+		engines[i] = NewEngine(node, &cfg)
+	}
+	link := func(a, b int) {
+		engines[a].AddPeer(engines[b].network.Address())
+		engines[b].AddPeer(engines[a].network.Address())
+	}
+	for i := range engines {
+		link(i, (i+1)%n)
+		for j := 2; j < degree; j += 2 {
+			link(i, rng.Intn(n))
+		}
+	}
+	return net, engines
+}
+
+// subscribeAll подписывает узлы на тему и возвращает счётчик доставок
+func subscribeAll(engines []*Engine, topic MessageType) []int {
+	received := make([]int, len(engines))
+	for i, e := range engines {
+		e.Subscribe(topic, func(from string, data []byte) { received[i]++ })
+	}
+	return received
+}
+
+// TestGossip_ConvergesOnSparseNetwork - сообщения доходят до всех узлов
+// сети из сотен узлов без полной связности, каждый узел обрабатывает
+// сообщение один раз, а повторы отбрасываются
+func TestGossip_ConvergesOnSparseNetwork(t *testing.T) {
+	const n = 300
+	net, engines := newSimGossip(n, 8, DefaultConfig())
+	received := subscribeAll(engines, MsgTx)
+
+	const messages = 5
+	for m := 0; m < messages; m++ {
+		if _, err := engines[m*37].Publish(MsgTx, []byte(fmt.Sprintf("tx-%d", m))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, count := range received {
+		if i%37 == 0 && i/37 < messages {
+			count++ // автор не получает своё сообщение
+		}
+		if count != messages {
+			t.Fatalf("Node %d received %d messages, expected %d", i, count, messages)
+		}
+	}
+
+	var duplicates, sent int
+	for _, e := range engines {
+		stats := e.Stats()
+		duplicates += stats.Duplicates
+		sent += stats.Sent
+	}
+	if duplicates == 0 {
+		t.Error("Expected duplicates to be suppressed by the seen-cache")
+	}
+	// Каждый узел пересылает не больше FanOut копий: рассылка линейна по
+	// числу узлов, а не квадратична
+	if limit := messages * n * DefaultConfig().FanOut; sent > limit {
+		t.Errorf("Expected at most %d envelopes, sent %d", limit, sent)
+	}
+	t.Logf("%d nodes, %d messages: %d envelopes, %d duplicates, %d bytes", n, messages, sent, duplicates, net.Bytes)
+
+	// Повторная публикация уже виденного сообщения ничего не рассылает
+	before := net.Bytes
+	engines[1].Publish(MsgTx, []byte("tx-0"))
+	if net.Bytes != before {
+		t.Error("Expected a seen message not to be published again")
+	}
+}
+
+// TestGossip_TTL - сообщение проходит не больше TTL переходов
+func TestGossip_TTL(t *testing.T) {
+	config := DefaultConfig()
+	config.TTL = 3
+	// Линия из 10 узлов: у каждого не больше двух соседей
+	net := gossiptest.NewNetwork()
+	engines := make([]*Engine, 10)
+	for i := range engines {
+		engines[i] = NewEngine(net.Node(fmt.Sprintf("node-%d", i)), config)
+		if i > 0 {
+			engines[i].AddPeer(engines[i-1].network.Address())
+			engines[i-1].AddPeer(engines[i].network.Address())
+		}
+	}
+	received := subscribeAll(engines, MsgBlock)
+
+	engines[0].Publish(MsgBlock, []byte("block"))
+	for i := 1; i < len(engines); i++ {
+		expected := 0
+		if i <= int(config.TTL) {
+			expected = 1
+		}
+		if received[i] != expected {
+			t.Errorf("Node %d at %d hops received %d messages, expected %d", i, i, received[i], expected)
+		}
+	}
+}
+
+// TestGossip_LazyPush - большое сообщение рассылается анонсами, и каждый
+// узел забирает тело один раз
+func TestGossip_LazyPush(t *testing.T) {
+	const n = 200
+	config := DefaultConfig()
+	config.LazyThreshold = 1024
+	net, engines := newSimGossip(n, 8, config)
+	var delivered int
+	payload := bytes.Repeat([]byte("b"), 64<<10)
+	for _, e := range engines {
+		e.Subscribe(MsgBlock, func(from string, data []byte) {
+			if !bytes.Equal(data, payload) {
+				t.Fatalf("Block body corrupted: %d bytes", len(data))
+			}
+			delivered++
+		})
+	}
+
+	engines[0].Publish(MsgBlock, payload)
+	if delivered != n-1 {
+		t.Fatalf("Expected %d nodes to receive the block, got %d", n-1, delivered)
+	}
+
+	var sent, pulled, announced int
+	for _, e := range engines {
+		stats := e.Stats()
+		sent += stats.Sent
+		pulled += stats.Pulled
+		announced += stats.Announced
+	}
+	if sent != n-1 || pulled != n-1 {
+		t.Errorf("Expected each node to pull the body once, sent %d bodies for %d pulls", sent, pulled)
+	}
+	if announced <= sent {
+		t.Errorf("Expected more announcements than bodies, got %d and %d", announced, sent)
+	}
+	// Тела занимают почти весь трафик, анонсы — доли процента
+	if limit := (n - 1) * (len(payload) + 1024); net.Bytes > limit {
+		t.Errorf("Expected about one body per node, %d bytes sent", net.Bytes)
+	}
+}
+
+// TestGossip_TopicSubscription - узел обрабатывает только темы подписки,
+// но пересылает все, поэтому неподписанные узлы не рвут рассылку
+func TestGossip_TopicSubscription(t *testing.T) {
+	net := gossiptest.NewNetwork()
+	engines := make([]*Engine, 3)
+	for i := range engines {
+		engines[i] = NewEngine(net.Node(fmt.Sprintf("node-%d", i)), nil)
+	}
+	engines[0].AddPeer("node-1")
+	engines[1].AddPeer("node-0")
+	engines[1].AddPeer("node-2")
+	engines[2].AddPeer("node-1")
+
+	var txs, blocks int
+	engines[2].Subscribe(MsgTx, func(from string, data []byte) {
+		if from != "node-1" {
+			t.Errorf("Expected the transaction from the relay node-1, got %s", from)
+		}
+		txs++
+	})
+	engines[1].Subscribe(MsgBlock, func(from string, data []byte) { blocks++ })
+
+	engines[0].Publish(MsgTx, []byte("tx"))
+	if txs != 1 || blocks != 0 {
+		t.Errorf("Expected the transaction to reach node-2 through unsubscribed node-1, got %d txs and %d blocks", txs, blocks)
+	}
+
+	engines[2].Unsubscribe(MsgTx)
+	engines[0].Publish(MsgTx, []byte("tx-2"))
+	if txs != 1 {
+		t.Error("Expected no delivery after unsubscribe")
+	}
+	if _, err := engines[0].Publish("", []byte("x")); err == nil {
+		t.Error("Expected an error for an empty topic")
+	}
+}
+
+// TestGossip_Validate - отклонённое проверкой сообщение не пересылается
+// и не помечается виденным: копию от другого соседа можно принять
+func TestGossip_Validate(t *testing.T) {
+	net := gossiptest.NewNetwork()
+	engines := make([]*Engine, 3)
+	for i := range engines {
+		engines[i] = NewEngine(net.Node(fmt.Sprintf("node-%d", i)), nil)
+	}
+	engines[0].AddPeer("node-1")
+	engines[1].AddPeer("node-2")
+	engines[2].AddPeer("node-1")
+
+	reject := true
+	engines[1].Validate(MsgTx, func(from string, data []byte) error {
+		if reject {
+			return errors.New("rejected")
+		}
+		return nil
+	})
+	received := subscribeAll(engines, MsgTx)
+
+	engines[0].Publish(MsgTx, []byte("tx"))
+	if received[1] != 0 || received[2] != 0 || engines[1].Stats().Rejected != 1 {
+		t.Fatalf("Expected the rejected message to stop at node-1, delivered %v", received)
+	}
+
+	reject = false
+	engines[2].Publish(MsgTx, []byte("tx"))
+	if received[1] != 1 {
+		t.Errorf("Expected a copy of the rejected message to be accepted later, delivered %d", received[1])
+	}
+}
+
+// TestGossip_PeerLimits - сосед не может продлить рассылку завышенным TTL
+// и раздуть очередь ожидаемых тел огромными анонсами
+func TestGossip_PeerLimits(t *testing.T) {
+	config := DefaultConfig()
+	config.TTL = 3
+	config.MaxIDs = 10
+	config.MaxWanted = 15
+	net := gossiptest.NewNetwork()
+	evil := net.Node("evil")
+	engines := make([]*Engine, 10)
+	for i := range engines {
+		engines[i] = NewEngine(net.Node(fmt.Sprintf("node-%d", i)), config)
+		if i > 0 {
+			engines[i].AddPeer(engines[i-1].network.Address())
+			engines[i-1].AddPeer(engines[i].network.Address())
+		}
+	}
+	received := subscribeAll(engines, MsgTx)
+
+	// Сообщение с TTL 1000 проходит от узла 0 не больше TTL-1 переходов
+	push := &Envelope{Type: envelopePush, Topic: MsgTx, TTL: 1000, Data: []byte("tx")}
+	if err := evil.Send("node-0", p2p.ChannelGossip, push.Encode()); err != nil {
+		t.Fatal(err)
+	}
+	for i, count := range received {
+		expected := 0
+		if i < int(config.TTL) {
+			expected = 1
+		}
+		if count != expected {
+			t.Errorf("Node %d received %d messages, expected %d", i, count, expected)
+		}
+	}
+
+	announce := func(from int) {
+		ids := make([]MessageID, 25)
+		for i := range ids {
+			ids[i] = NewMessageID(MsgBlock, []byte(fmt.Sprintf("block-%d-%d", from, i)))
+		}
+		ihave := &Envelope{Type: envelopeIHave, Topic: MsgBlock, IDs: ids}
+		if err := evil.Send("node-0", p2p.ChannelGossip, ihave.Encode()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	announce(0)
+	if pulled := engines[0].Stats().Pulled; pulled != config.MaxIDs {
+		t.Errorf("Expected %d ids pulled from one announcement, got %d", config.MaxIDs, pulled)
+	}
+	announce(1)
+	if pulled := engines[0].Stats().Pulled; pulled != config.MaxWanted {
+		t.Errorf("Expected at most %d bodies awaited, got %d", config.MaxWanted, pulled)
+	}
+}
+
+// TestGossip_SeenCache - кэш забывает сообщения по времени и по размеру
+func TestGossip_SeenCache(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	cache := newSeenCache(time.Minute, 2)
+	a, b, c := NewMessageID(MsgTx, []byte("a")), NewMessageID(MsgTx, []byte("b")), NewMessageID(MsgTx, []byte("c"))
+
+	if !cache.add(a, nil, start) || cache.add(a, nil, start) {
+		t.Fatal("Expected the first add to succeed and the repeat to fail")
+	}
+	cache.add(b, nil, start.Add(30*time.Second))
+	cache.add(c, nil, start.Add(30*time.Second))
+	if cache.has(a, start.Add(30*time.Second)) || cache.len() != 2 {
+		t.Error("Expected the oldest message to be evicted when the cache is full")
+	}
+	if cache.has(b, start.Add(90*time.Second)) {
+		t.Error("Expected a message older than the TTL to be forgotten")
+	}
+
+	env := &Envelope{Type: envelopeIHave, Topic: MsgBlock, TTL: 3, Data: []byte("x"), IDs: []MessageID{a, b}}
+	decoded, err := DecodeEnvelope(env.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Type != env.Type || decoded.Topic != env.Topic || decoded.TTL != env.TTL || len(decoded.IDs) != 2 || decoded.IDs[1] != b {
+		t.Errorf("Envelope round trip mismatch: %+v", decoded)
+	}
+}
@@ -0,0 +1,85 @@
+package gossip
+
+// конверт эпидемической рассылки
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"blockchain/codec"
+)
+
+// envelopeType — назначение конверта
+type envelopeType byte
+
+const (
+	envelopePush  envelopeType = 0x01 // сообщение целиком
+	envelopeIHave envelopeType = 0x02 // анонс идентификаторов сообщений
+	envelopeIWant envelopeType = 0x03 // запрос тел анонсированных сообщений
+)
+
+// MessageID — идентификатор сообщения рассылки: хэш темы и данных, поэтому
+// одно и то же сообщение от разных авторов не рассылается дважды
+type MessageID [sha256.Size]byte
+
+// NewMessageID вычисляет идентификатор сообщения темы topic
+func NewMessageID(topic MessageType, data []byte) MessageID {
+	w := codec.NewWriter(codec.KindGossipEnvelope)
+	w.String(string(topic))
+	w.Bytes(data)
+	return sha256.Sum256(w.Result())
+}
+
+func (id MessageID) String() string {
+	return hex.EncodeToString(id[:8])
+}
+
+// Envelope — единица обмена движка рассылки между соседями
+type Envelope struct {
+	Type  envelopeType
+	Topic MessageType
+	TTL   int64 // сколько ещё переходов пройдёт сообщение
+	Data  []byte
+	IDs   []MessageID // для анонса и запроса
+}
+
+// Encode кодирует конверт в каноническом формате
+func (e *Envelope) Encode() []byte {
+	w := codec.NewWriter(codec.KindGossipEnvelope)
+	w.Uint64(uint64(e.Type))
+	w.String(string(e.Topic))
+	w.Int64(e.TTL)
+	w.Bytes(e.Data)
+	w.Len(len(e.IDs))
+	for _, id := range e.IDs {
+		w.Bytes(id[:])
+	}
+	return w.Result()
+}
+
+// DecodeEnvelope восстанавливает конверт
+func DecodeEnvelope(data []byte) (*Envelope, error) {
+	r, err := codec.NewReader(data, codec.KindGossipEnvelope)
+	if err != nil {
+		return nil, err
+	}
+	e := &Envelope{
+		Type:  envelopeType(r.Uint64()),
+		Topic: MessageType(r.String()),
+		TTL:   r.Int64(),
+		Data:  r.Bytes(),
+	}
+	n := r.Len()
+	for i := 0; i < n && r.Err() == nil; i++ {
+		raw := r.Bytes()
+		if len(raw) != len(MessageID{}) {
+			return nil, fmt.Errorf("failed to decode gossip envelope: message id of %d bytes", len(raw))
+		}
+		e.IDs = append(e.IDs, MessageID(raw))
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode gossip envelope: %w", err)
+	}
+	return e, nil
+}
@@ -3,63 +3,55 @@ package gossip
 // протокол рассылки
 
 import (
-	"bytes"
-	"crypto/tls"
-	"encoding/gob"
-	"encoding/json"
 	"fmt"
-	"net"
 
 	"blockchain/network/p2p"
 	"blockchain/network/peer"
 )
 
-func (m *GossipMessage) Encode() ([]byte, error) {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	err := enc.Encode(m)
-	return buf.Bytes(), err
+// Channel возвращает канал транспорта для сообщений типа msgType:
+// транзакции и блоки не задерживают сообщения консенсуса
+func Channel(msgType MessageType) p2p.ChannelID {
+	switch msgType {
+	case MsgTx:
+		return p2p.ChannelTxs
+	case MsgBlock:
+		return p2p.ChannelBlocks
+	case MsgStatus, MsgRequest:
+		return p2p.ChannelSync
+	}
+	return p2p.ChannelConsensus
 }
 
-func DecodeMessage(data []byte) (*GossipMessage, error) {
-	buf := bytes.NewBuffer(data)
-	dec := gob.NewDecoder(buf)
-	var msg GossipMessage
-	err := dec.Decode(&msg)
-	return &msg, err
+// Broadcast рассылает сообщение пирам через постоянные соединения транспорта
+func Broadcast(t *p2p.Transport, peers []*peer.Peer, msg *GossipMessage) error {
+	encoded, err := msg.Encode()
+	if err != nil {
+		return err
+	}
+	send(t, peers, Channel(msg.Type), encoded)
+	return nil
 }
 
-func Broadcast(peers []*peer.Peer, msg *GossipMessage) error {
-	for _, peer := range peers {
-		conn, err := net.Dial("tcp", peer.Addr)
-		if err != nil {
-			fmt.Printf("Can't connect to peer %s: %v\n", peer.ID, err)
-			continue
-		}
-		defer conn.Close()
-		encoded, _ := msg.Encode()
-		_, err = conn.Write(encoded)
-		if err != nil {
-			return err
-		}
+// BroadcastSignedConsensusMessage — рассылает подписанные сообщения всем пирам
+func BroadcastSignedConsensusMessage(t *p2p.Transport, peers []*peer.Peer, msg *SignedConsensusMessage) error {
+	encoded, err := msg.Encode()
+	if err != nil {
+		return err
 	}
+	send(t, peers, Channel(msg.Type), encoded)
 	return nil
 }
 
-// BroadcastSignedConsensusMessage — рассылает подписанные сообщения всем пирам
-func BroadcastSignedConsensusMessage(peers []*peer.Peer, msg *SignedConsensusMessage) error {
+// send ставит сообщение в очереди пиров; переполненная очередь пира не
+// мешает остальным
+func send(t *p2p.Transport, peers []*peer.Peer, ch p2p.ChannelID, data []byte) {
 	for _, peer := range peers {
-		conn, err := tls.Dial("tcp", peer.Addr, p2p.GenerateTLSConfig())
-		if err != nil {
-			fmt.Printf("Can't connect to peer %s: %v\n", peer.ID, err)
+		if peer.Addr == t.Address() {
 			continue
 		}
-		defer conn.Close()
-
-		encoder := json.NewEncoder(conn)
-		if err := encoder.Encode(msg); err != nil {
-			return err
+		if err := t.Send(peer.Addr, ch, data); err != nil {
+			fmt.Printf("Can't send to peer %s: %v\n", peer.ID, err)
 		}
 	}
-	return nil
 }
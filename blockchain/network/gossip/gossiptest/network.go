@@ -0,0 +1,79 @@
+// Package gossiptest — модель сети для тестов рассылки: узлы одного
+// процесса, реализующие gossip.Network.
+package gossiptest
+
+import (
+	"fmt"
+
+	"blockchain/network/p2p"
+)
+
+// Network — сеть узлов в одном процессе: сообщения доставляются по
+// очереди в порядке отправки, без горутин и таймеров, поэтому рассылку по
+// сотням узлов можно проверять детерминированно
+type Network struct {
+	Bytes int // отправлено байт
+
+	nodes      map[string]*Node
+	queue      []func()
+	delivering bool
+}
+
+// NewNetwork создаёт пустую модель сети
+func NewNetwork() *Network {
+	return &Network{nodes: make(map[string]*Node)}
+}
+
+// Node добавляет в сеть узел с адресом address
+func (net *Network) Node(address string) *Node {
+	node := &Node{net: net, address: address}
+	net.nodes[address] = node
+	return node
+}
+
+func (net *Network) run() {
+	if net.delivering {
+		return
+	}
+	net.delivering = true
+	for len(net.queue) > 0 {
+		deliver := net.queue[0]
+		net.queue = net.queue[1:]
+		deliver()
+	}
+	net.delivering = false
+}
+
+// Node — узел модели сети
+type Node struct {
+	net      *Network
+	address  string
+	handlers map[p2p.ChannelID]p2p.Handler
+}
+
+// Address возвращает адрес узла
+func (n *Node) Address() string { return n.address }
+
+// OnReceive регистрирует обработчик сообщений канала ch
+func (n *Node) OnReceive(ch p2p.ChannelID, handler p2p.Handler) {
+	if n.handlers == nil {
+		n.handlers = make(map[p2p.ChannelID]p2p.Handler)
+	}
+	n.handlers[ch] = handler
+}
+
+// Send ставит сообщение узлу addr в очередь доставки
+func (n *Node) Send(addr string, ch p2p.ChannelID, msg []byte) error {
+	to, ok := n.net.nodes[addr]
+	if !ok {
+		return fmt.Errorf("unknown node %s", addr)
+	}
+	n.net.Bytes += len(msg)
+	n.net.queue = append(n.net.queue, func() {
+		if handler := to.handlers[ch]; handler != nil {
+			handler(n.address, msg)
+		}
+	})
+	n.net.run()
+	return nil
+}
@@ -1,9 +1,6 @@
 package gossip
 
 // типы сообщений
-import (
-	"encoding/json"
-)
 
 type MessageType string
 
@@ -22,6 +19,12 @@ const (
 	StatePrevote   MessageType = "prevote"
 	StatePrecommit MessageType = "precommit"
 	StateCommit    MessageType = "commit"
+
+	// HotStuff: переход в новый вид с сертификатом кворума узла
+	StateNewView MessageType = "new-view"
+
+	// Доказательство двойной подписи валидатора
+	MsgEvidence MessageType = "evidence"
 )
 
 type GossipMessage struct {
@@ -39,12 +42,3 @@ type SignedConsensusMessage struct {
 	Data      []byte      `json:"data"`
 	Signature []byte      `json:"signature"`
 }
-
-// DecodeSignedMessage — декодирует байты в SignedConsensusMessage
-func DecodeSignedMessage(data []byte) (*SignedConsensusMessage, error) {
-	var msg SignedConsensusMessage
-	if err := json.Unmarshal(data, &msg); err != nil {
-		return nil, err
-	}
-	return &msg, nil
-}
@@ -0,0 +1,84 @@
+package gossip
+
+// кэш уже виденных сообщений
+
+import "time"
+
+// seenCache помнит идентификаторы и тела сообщений SeenTTL, но не больше
+// capacity последних; тела нужны, чтобы отвечать на запросы по анонсам
+type seenCache struct {
+	ttl      time.Duration
+	capacity int
+	entries  map[MessageID]*seenEntry
+	order    []seenKey // в порядке добавления
+}
+
+// seenKey — место сообщения в порядке добавления; после remove и
+// повторного add старое место не вытесняет новую запись
+type seenKey struct {
+	id    MessageID
+	added time.Time
+}
+
+type seenEntry struct {
+	added time.Time
+	msg   *Envelope
+}
+
+func newSeenCache(ttl time.Duration, capacity int) *seenCache {
+	return &seenCache{ttl: ttl, capacity: capacity, entries: make(map[MessageID]*seenEntry)}
+}
+
+// add запоминает сообщение; false — сообщение уже видено
+func (c *seenCache) add(id MessageID, msg *Envelope, now time.Time) bool {
+	c.prune(now)
+	if _, ok := c.entries[id]; ok {
+		return false
+	}
+	c.entries[id] = &seenEntry{added: now, msg: msg}
+	c.order = append(c.order, seenKey{id: id, added: now})
+	for len(c.entries) > c.capacity {
+		c.evict()
+	}
+	return true
+}
+
+// remove забывает сообщение
+func (c *seenCache) remove(id MessageID) {
+	delete(c.entries, id)
+}
+
+func (c *seenCache) has(id MessageID, now time.Time) bool {
+	c.prune(now)
+	_, ok := c.entries[id]
+	return ok
+}
+
+// get возвращает запомненное сообщение (nil, если узел его забыл)
+func (c *seenCache) get(id MessageID, now time.Time) *Envelope {
+	c.prune(now)
+	if entry, ok := c.entries[id]; ok {
+		return entry.msg
+	}
+	return nil
+}
+
+// prune забывает сообщения старше ttl
+func (c *seenCache) prune(now time.Time) {
+	for len(c.order) > 0 && now.Sub(c.order[0].added) >= c.ttl {
+		c.evict()
+	}
+}
+
+// evict убирает самое старое место в порядке добавления
+func (c *seenCache) evict() {
+	key := c.order[0]
+	c.order = c.order[1:]
+	if entry, ok := c.entries[key.id]; ok && entry.added.Equal(key.added) {
+		delete(c.entries, key.id)
+	}
+}
+
+func (c *seenCache) len() int {
+	return len(c.entries)
+}
@@ -0,0 +1,172 @@
+// Package mempool рассылает транзакции пула между узлами: транзакция,
+// принятая пулом, анонсируется соседям через эпидемическую рассылку, а
+// соседи забирают её, проверяют и добавляют в свои пулы.
+package mempool
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"blockchain/network/gossip"
+	"blockchain/storage/txpool"
+)
+
+var (
+	ErrRateLimited        = errors.New("peer exceeded transaction rate")
+	ErrInvalidTransaction = errors.New("invalid transaction")
+)
+
+// Config — параметры рассылки транзакций
+type Config struct {
+	Rate    float64 // транзакций в секунду, принимаемых от одного соседа
+	Burst   int     // сколько транзакций сосед может прислать сразу сверх Rate
+	ChainID string  // идентификатор сети из генезиса; транзакции другой сети отклоняются
+}
+
+// DefaultConfig возвращает параметры по умолчанию
+func DefaultConfig() *Config {
+	return &Config{
+		Rate:    200,
+		Burst:   1000,
+		ChainID: txpool.DefaultChainID,
+	}
+}
+
+// Stats — счётчики реактора
+type Stats struct {
+	Announced   int // транзакций пула анонсировано соседям
+	Accepted    int // транзакций соседей добавлено в пул
+	Known       int // транзакций соседей, уже бывших в пуле
+	RateLimited int // отброшено сверх лимита соседа
+	Invalid     int // отклонено проверкой или пулом
+}
+
+// bucket — запас транзакций соседа (token bucket)
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Reactor связывает пул транзакций с движком рассылки. Транзакции темы
+// gossip.MsgTx рассылаются анонсами: тело забирает только сосед, который
+// его ещё не видел, поэтому известные транзакции повторно не передаются.
+// Транзакция соседа пересылается дальше, только если прошла проверку ID и
+// подписи и принята пулом; соседу, превысившему лимит, отказывают до
+// проверки.
+type Reactor struct {
+	engine *gossip.Engine
+	pool   *txpool.TransactionPool
+	config *Config
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	stats   Stats
+	now     func() time.Time
+}
+
+// NewReactor подключает пул pool к движку рассылки engine.
+// config — лимиты и сеть (по умолчанию DefaultConfig); пустой ChainID —
+// txpool.DefaultChainID.
+func NewReactor(engine *gossip.Engine, pool *txpool.TransactionPool, config *Config) *Reactor {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if config.ChainID == "" {
+		c := *config
+		c.ChainID = txpool.DefaultChainID
+		config = &c
+	}
+	r := &Reactor{
+		engine:  engine,
+		pool:    pool,
+		config:  config,
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+	engine.Lazy(gossip.MsgTx)
+	engine.Validate(gossip.MsgTx, r.receive)
+	pool.OnAdd(r.announce)
+	return r
+}
+
+// Stats возвращает счётчики реактора
+func (r *Reactor) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+// announce рассылает транзакцию, принятую пулом. Транзакция, пришедшая от
+// соседа, движку уже известна и повторно не рассылается: её перешлёт сам движок.
+func (r *Reactor) announce(tx *txpool.Transaction) {
+	data := tx.Encode()
+	if r.engine.Seen(gossip.NewMessageID(gossip.MsgTx, data)) {
+		return
+	}
+	if _, err := r.engine.Publish(gossip.MsgTx, data); err != nil {
+		fmt.Printf("❌ Failed to announce transaction %s: %v\n", tx.ID, err)
+		return
+	}
+	r.mu.Lock()
+	r.stats.Announced++
+	r.mu.Unlock()
+}
+
+// receive проверяет транзакцию соседа from и добавляет её в пул
+func (r *Reactor) receive(from string, data []byte) error {
+	if !r.allow(from) {
+		r.count(&r.stats.RateLimited)
+		return fmt.Errorf("%w: %s", ErrRateLimited, from)
+	}
+	tx, err := txpool.DecodeTransaction(data)
+	if err != nil {
+		r.count(&r.stats.Invalid)
+		return err
+	}
+	if r.pool.Has(tx.ID) {
+		r.count(&r.stats.Known)
+		return nil
+	}
+	if !tx.Verify(r.config.ChainID) {
+		r.count(&r.stats.Invalid)
+		return fmt.Errorf("%w: %s from %s", ErrInvalidTransaction, tx.ID, from)
+	}
+	if err := r.pool.AddTransaction(tx); err != nil {
+		if errors.Is(err, txpool.ErrAlreadyKnown) {
+			r.count(&r.stats.Known)
+			return nil
+		}
+		r.count(&r.stats.Invalid)
+		return err
+	}
+	r.count(&r.stats.Accepted)
+	return nil
+}
+
+// allow расходует одну транзакцию из запаса соседа; запас пополняется со
+// скоростью Rate до Burst
+func (r *Reactor) allow(peer string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+	b, ok := r.buckets[peer]
+	if !ok {
+		b = &bucket{tokens: float64(r.config.Burst), last: now}
+		r.buckets[peer] = b
+	}
+	b.tokens = min(float64(r.config.Burst), b.tokens+now.Sub(b.last).Seconds()*r.config.Rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (r *Reactor) count(counter *int) {
+	r.mu.Lock()
+	*counter++
+	r.mu.Unlock()
+}
@@ -0,0 +1,154 @@
+package mempool
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"blockchain/crypto/signature"
+	"blockchain/network/gossip"
+	"blockchain/network/gossip/gossiptest"
+	"blockchain/storage/txpool"
+)
+
+var testSigner signature.Signer
+
+func init() {
+	signer, err := signature.NewECDSASigner()
+	if err != nil {
+		panic(err)
+	}
+	pubKey, err := signature.ParsePublicKey(signer.PublicKey())
+	if err != nil {
+		panic(err)
+	}
+	signature.RegisterPublicKey("mempool-alice", pubKey)
+	testSigner = signer
+}
+
+// signedTx создаёт подписанную транзакцию отправителя mempool-alice
+func signedTx(t *testing.T, nonce uint64) *txpool.Transaction {
+	t.Helper()
+	tx := txpool.NewTransaction(txpool.DefaultChainID, "mempool-alice", "bob", 1)
+	tx.Nonce = nonce
+	tx.ID = tx.ComputeID()
+	sig, err := testSigner.Sign(tx.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Signature = hex.EncodeToString(sig)
+	return tx
+}
+
+// testNode — узел модели сети со своим пулом
+type testNode struct {
+	engine  *gossip.Engine
+	pool    *txpool.TransactionPool
+	reactor *Reactor
+}
+
+// newTestNodes создаёт n узлов, соединённых кольцом и случайными связями
+func newTestNodes(n int, config *Config) []*testNode {
+	net := gossiptest.NewNetwork()
+	rng := rand.New(rand.NewSource(1))
+	nodes := make([]*testNode, n)
+	for i := range nodes {
+		gossipConfig := gossip.DefaultConfig()
+		gossipConfig.Seed = int64(i + 1)
+		engine := gossip.NewEngine(net.Node(fmt.Sprintf("node-%d", i)), gossipConfig)
+		pool := txpool.NewTransactionPool(&txpool.PoolConfig{MaxSize: 1000, TTL: time.Hour})
+		nodes[i] = &testNode{engine: engine, pool: pool, reactor: NewReactor(engine, pool, config)}
+	}
+	link := func(a, b int) {
+		nodes[a].engine.AddPeer(fmt.Sprintf("node-%d", b))
+		nodes[b].engine.AddPeer(fmt.Sprintf("node-%d", a))
+	}
+	for i := range nodes {
+		if n > 1 {
+			link(i, (i+1)%n)
+		}
+		if n > 3 {
+			link(i, rng.Intn(n))
+		}
+	}
+	return nodes
+}
+
+// TestReactor_PropagatesTransactions - транзакция, принятая пулом одного
+// узла, попадает в пулы всех узлов, и каждый узел забирает её тело один раз
+func TestReactor_PropagatesTransactions(t *testing.T) {
+	const n = 50
+	nodes := newTestNodes(n, nil)
+
+	txs := []*txpool.Transaction{signedTx(t, 0), signedTx(t, 1)}
+	for i, tx := range txs {
+		if err := nodes[i*10].pool.AddTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var bodies int
+	for i, node := range nodes {
+		for _, tx := range txs {
+			if !node.pool.Has(tx.ID) {
+				t.Fatalf("Node %d is missing transaction %s", i, tx.ID)
+			}
+		}
+		bodies += node.engine.Stats().Sent
+	}
+	if bodies != len(txs)*(n-1) {
+		t.Errorf("Expected each node to fetch each transaction once, %d bodies sent", bodies)
+	}
+	if stats := nodes[0].reactor.Stats(); stats.Announced != 1 {
+		t.Errorf("Expected the origin to announce its transaction once, got %d", stats.Announced)
+	}
+}
+
+// TestReactor_RejectsInvalid - транзакция с неверной подписью не попадает
+// в пул соседа и не пересылается дальше
+func TestReactor_RejectsInvalid(t *testing.T) {
+	nodes := newTestNodes(3, nil)
+
+	tx := signedTx(t, 0)
+	tx.Signature = hex.EncodeToString([]byte("forged"))
+	if _, err := nodes[0].engine.Publish(gossip.MsgTx, tx.Encode()); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, node := range nodes[1:] {
+		if node.pool.Has(tx.ID) {
+			t.Errorf("Node %d accepted a forged transaction", i+1)
+		}
+	}
+	var invalid int
+	for _, node := range nodes {
+		invalid += node.reactor.Stats().Invalid
+	}
+	if invalid == 0 {
+		t.Error("Expected the forged transaction to be counted as invalid")
+	}
+}
+
+// TestReactor_RateLimit - сосед не может прислать больше Burst транзакций
+// сразу; запас восполняется со скоростью Rate
+func TestReactor_RateLimit(t *testing.T) {
+	nodes := newTestNodes(2, &Config{Rate: 1, Burst: 3})
+	now := time.Unix(1700000000, 0)
+	nodes[1].reactor.now = func() time.Time { return now }
+
+	for nonce := uint64(0); nonce < 5; nonce++ {
+		nodes[0].pool.AddTransaction(signedTx(t, nonce))
+	}
+	stats := nodes[1].reactor.Stats()
+	if stats.Accepted != 3 || stats.RateLimited != 2 || nodes[1].pool.Size() != 3 {
+		t.Fatalf("Expected 3 accepted and 2 rate-limited transactions, got %+v with pool size %d", stats, nodes[1].pool.Size())
+	}
+
+	now = now.Add(time.Second)
+	nodes[0].pool.AddTransaction(signedTx(t, 5))
+	if stats := nodes[1].reactor.Stats(); stats.Accepted != 4 {
+		t.Errorf("Expected the allowance to refill after a second, got %+v", stats)
+	}
+}
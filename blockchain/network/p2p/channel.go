@@ -0,0 +1,90 @@
+package p2p
+
+// логические каналы соединения
+
+import (
+	"fmt"
+	"time"
+)
+
+// ChannelID — логический канал соединения с пиром
+type ChannelID byte
+
+const (
+	ChannelConsensus ChannelID = 0x01 // предложения, голоса, доказательства
+	ChannelBlocks    ChannelID = 0x02 // блоки и незафиксированные ветки
+	ChannelTxs       ChannelID = 0x03 // транзакции
+	ChannelSync      ChannelID = 0x04 // синхронизация блоков
+	ChannelGossip    ChannelID = 0x05 // эпидемическая рассылка с пересылкой
+)
+
+func (c ChannelID) String() string {
+	switch c {
+	case ChannelConsensus:
+		return "consensus"
+	case ChannelBlocks:
+		return "blocks"
+	case ChannelTxs:
+		return "txs"
+	case ChannelSync:
+		return "sync"
+	case ChannelGossip:
+		return "gossip"
+	}
+	return fmt.Sprintf("channel-%d", byte(c))
+}
+
+// ChannelConfig — приоритет и очередь отправки канала. Доля пропускной
+// способности канала пропорциональна приоритету: следующим отправляется
+// пакет канала с наименьшим отношением недавно отправленных байт к
+// приоритету, поэтому поток транзакций не задерживает голоса консенсуса,
+// но и сам не простаивает.
+type ChannelConfig struct {
+	ID        ChannelID
+	Priority  int
+	SendQueue int // пакетов в очереди к одному пиру; при переполнении Send возвращает ErrQueueFull
+}
+
+// DefaultChannels возвращает каналы по умолчанию
+func DefaultChannels() []ChannelConfig {
+	return []ChannelConfig{
+		{ID: ChannelConsensus, Priority: 10, SendQueue: 1024},
+		{ID: ChannelBlocks, Priority: 5, SendQueue: 256},
+		{ID: ChannelSync, Priority: 3, SendQueue: 256},
+		{ID: ChannelGossip, Priority: 2, SendQueue: 4096},
+		{ID: ChannelTxs, Priority: 1, SendQueue: 4096},
+	}
+}
+
+// recentDecay — за какое время учёт недавно отправленных байт уменьшается вдвое
+const recentDecay = time.Second
+
+// sendQueue — очередь пакетов одного канала к пиру
+type sendQueue struct {
+	config  ChannelConfig
+	packets [][]byte
+	recent  float64 // недавно отправлено байт с учётом затухания
+}
+
+// nextQueue выбирает канал, пакет которого отправляется следующим, с
+// учётом затухания за прошедшее с прошлого выбора время elapsed; nil —
+// очереди пусты
+func nextQueue(queues []*sendQueue, elapsed time.Duration) *sendQueue {
+	decay := 1.0
+	if elapsed > 0 {
+		decay = 1 / (1 + float64(elapsed)/float64(recentDecay))
+	}
+	var best *sendQueue
+	var bestRatio float64
+	for _, q := range queues {
+		q.recent *= decay
+		if len(q.packets) == 0 {
+			continue
+		}
+		ratio := q.recent / float64(q.config.Priority)
+		if best == nil || ratio < bestRatio || (ratio == bestRatio && q.config.Priority > best.config.Priority) {
+			best, bestRatio = q, ratio
+		}
+	}
+	return best
+}
@@ -0,0 +1,422 @@
+package p2p
+
+// соединение с пиром: очереди каналов, сессия и переподключение
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"blockchain/codec"
+	"blockchain/network/peer"
+)
+
+// retireDelay — сколько проигравшая при встречном подключении сессия ещё
+// читает пакеты, уже отправленные пиром, перед закрытием
+const retireDelay = time.Second
+
+// inboxSize — входящих сообщений пира в ожидании обработчика
+const inboxSize = 1024
+
+// session — одно TLS-соединение с пиром после рукопожатия
+type session struct {
+	conn     net.Conn
+	remote   string         // адрес, объявленный пиром
+	identity *peer.Identity // ключ узла, подтверждённый рукопожатием
+	outbound bool
+
+	writeMu sync.Mutex
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newSession(conn net.Conn, remote string, identity *peer.Identity, outbound bool) *session {
+	return &session{conn: conn, remote: remote, identity: identity, outbound: outbound, done: make(chan struct{})}
+}
+
+// write записывает пакет одним кадром
+func (s *session) write(data []byte, timeout time.Duration) error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	s.conn.SetWriteDeadline(time.Now().Add(timeout))
+	return codec.WriteFrame(s.conn, data)
+}
+
+func (s *session) close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.conn.Close()
+	})
+}
+
+func (s *session) closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// peerConn — состояние пира, переживающее разрывы соединения
+type peerConn struct {
+	t    *Transport
+	addr string
+
+	mu       sync.Mutex
+	queues   []*sendQueue
+	channels map[ChannelID]*sendQueue
+	lastPick time.Time
+	session  *session
+	identity *peer.Identity // личность, закреплённая за адресом исходящей сессией
+	pending  map[uint64]chan *packet
+	dialing  bool
+
+	wake  chan struct{}
+	inbox chan *packet
+	quit  chan struct{}
+	once  sync.Once
+}
+
+func newPeerConn(t *Transport, addr string) *peerConn {
+	p := &peerConn{
+		t:        t,
+		addr:     addr,
+		channels: make(map[ChannelID]*sendQueue),
+		pending:  make(map[uint64]chan *packet),
+		wake:     make(chan struct{}, 1),
+		inbox:    make(chan *packet, inboxSize),
+		quit:     make(chan struct{}),
+	}
+	for _, ch := range t.config.Channels {
+		q := &sendQueue{config: ch}
+		p.queues = append(p.queues, q)
+		p.channels[ch.ID] = q
+	}
+	go p.sendRoutine()
+	go p.dispatchRoutine()
+	return p
+}
+
+// startDialing запускает поддержание исходящего соединения; вызывается
+// под блокировкой транспорта
+func (p *peerConn) startDialing() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.dialing {
+		p.dialing = true
+		go p.dialRoutine()
+	}
+}
+
+// stop закрывает соединение и останавливает горутины пира
+func (p *peerConn) stop() {
+	p.once.Do(func() {
+		close(p.quit)
+		p.mu.Lock()
+		s := p.session
+		p.session = nil
+		p.failPending()
+		p.mu.Unlock()
+		if s != nil {
+			s.close()
+		}
+	})
+}
+
+func (p *peerConn) stopped() bool {
+	select {
+	case <-p.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *peerConn) connected() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.session != nil && !p.session.closed()
+}
+
+// enqueue ставит пакет в очередь его канала
+func (p *peerConn) enqueue(pkt *packet) error {
+	p.mu.Lock()
+	q, ok := p.channels[pkt.Channel]
+	if !ok {
+		p.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownChannel, pkt.Channel)
+	}
+	if len(q.packets) >= q.config.SendQueue {
+		p.mu.Unlock()
+		return fmt.Errorf("%w: %s to %s", ErrQueueFull, pkt.Channel, p.addr)
+	}
+	q.packets = append(q.packets, pkt.Encode())
+	p.mu.Unlock()
+	p.signal()
+	return nil
+}
+
+func (p *peerConn) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// await регистрирует ожидание ответа на запрос id
+func (p *peerConn) await(id uint64) chan *packet {
+	ch := make(chan *packet, 1)
+	p.mu.Lock()
+	p.pending[id] = ch
+	p.mu.Unlock()
+	return ch
+}
+
+func (p *peerConn) forget(id uint64) {
+	p.mu.Lock()
+	delete(p.pending, id)
+	p.mu.Unlock()
+}
+
+// resolve передаёт ответ ожидающему запросу; ответ на забытый запрос
+// отбрасывается
+func (p *peerConn) resolve(pkt *packet) {
+	p.mu.Lock()
+	ch, ok := p.pending[pkt.ID]
+	delete(p.pending, pkt.ID)
+	p.mu.Unlock()
+	if ok {
+		ch <- pkt
+	}
+}
+
+// failPending завершает ожидающие запросы; вызывается под блокировкой
+func (p *peerConn) failPending() {
+	for id, ch := range p.pending {
+		close(ch)
+		delete(p.pending, id)
+	}
+}
+
+// attach делает сессию текущей. Личность пира за адресом закрепляет
+// только исходящая сессия: к этому адресу подключились сами, и пир
+// подтвердил его в рукопожатии. Входящая сессия лишь объявляет адрес,
+// поэтому принимается только с уже закреплённым ключом (см.
+// Transport.accept), а сессия с другим ключом узла отклоняется и не
+// заменяет текущую. Если пиры подключились друг к другу одновременно, оба
+// оставляют соединение, открытое узлом с меньшим адресом; другое ещё
+// читается retireDelay, чтобы не потерять отправленное.
+func (p *peerConn) attach(s *session) error {
+	p.mu.Lock()
+	if p.stopped() {
+		p.mu.Unlock()
+		s.close()
+		return ErrTransportClosed
+	}
+	if p.identity == nil && !s.outbound {
+		p.mu.Unlock()
+		s.close()
+		return fmt.Errorf("%w: %s is not confirmed by an outbound connection", ErrUnverifiedAddress, p.addr)
+	}
+	if p.identity != nil && p.identity.ID() != s.identity.ID() {
+		p.mu.Unlock()
+		s.close()
+		return fmt.Errorf("%w: %s is %s, not %s", ErrIdentityMismatch, p.addr, p.identity.ID(), s.identity.ID())
+	}
+	p.identity = s.identity
+	old := p.session
+	if old != nil && !old.closed() && old.outbound != s.outbound && !p.preferred(s) {
+		p.mu.Unlock()
+		go p.t.serve(p, s)
+		time.AfterFunc(retireDelay, s.close)
+		return nil
+	}
+	p.session = s
+	p.mu.Unlock()
+
+	if old != nil {
+		time.AfterFunc(retireDelay, old.close)
+	}
+	fmt.Printf("🤝 Connected to peer %s\n", p.addr)
+	go p.t.serve(p, s)
+	go p.pingRoutine(s)
+	p.signal()
+	return nil
+}
+
+// pinned сообщает, закреплена ли за адресом личность пира
+func (p *peerConn) pinned() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.identity != nil
+}
+
+// preferred сообщает, открыта ли сессия узлом с меньшим адресом
+func (p *peerConn) preferred(s *session) bool {
+	dialer := s.remote
+	if s.outbound {
+		dialer = p.t.address
+	}
+	return dialer == min(p.t.address, s.remote)
+}
+
+// detach убирает закрытую сессию; ожидающие запросы завершаются ошибкой
+func (p *peerConn) detach(s *session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.session == s {
+		p.session = nil
+		p.failPending()
+	}
+}
+
+// sendRoutine отправляет пакеты очередей, пока есть соединение: следующим
+// идёт пакет канала, отправившего меньше всего относительно приоритета
+func (p *peerConn) sendRoutine() {
+	for {
+		select {
+		case <-p.quit:
+			return
+		case <-p.wake:
+		}
+		for {
+			p.mu.Lock()
+			s := p.session
+			if s == nil || s.closed() {
+				p.mu.Unlock()
+				break
+			}
+			now := time.Now()
+			q := nextQueue(p.queues, now.Sub(p.lastPick))
+			p.lastPick = now
+			if q == nil {
+				p.mu.Unlock()
+				break
+			}
+			data := q.packets[0]
+			q.packets = q.packets[1:]
+			q.recent += float64(len(data))
+			p.mu.Unlock()
+
+			if err := s.write(data, p.t.config.WriteTimeout); err != nil {
+				// Пакет вернётся в начало очереди и уйдёт после переподключения
+				p.mu.Lock()
+				q.packets = append([][]byte{data}, q.packets...)
+				p.mu.Unlock()
+				s.close()
+				break
+			}
+		}
+	}
+}
+
+// dispatchRoutine передаёт входящие сообщения обработчикам по порядку
+func (p *peerConn) dispatchRoutine() {
+	for {
+		select {
+		case <-p.quit:
+			return
+		case pkt := <-p.inbox:
+			p.t.dispatch(p, pkt)
+		}
+	}
+}
+
+// pingRoutine отправляет ping, чтобы пир не закрыл простаивающее соединение
+// и разрыв обнаруживался без отправки сообщений
+func (p *peerConn) pingRoutine(s *session) {
+	ticker := time.NewTicker(p.t.config.PingInterval)
+	defer ticker.Stop()
+	ping := (&packet{Type: packetPing}).Encode()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			if err := s.write(ping, p.t.config.WriteTimeout); err != nil {
+				s.close()
+				return
+			}
+		}
+	}
+}
+
+// dialRoutine подключается к пиру, пока соединения нет, удваивая паузу
+// между неудачными попытками от MinBackoff до MaxBackoff
+func (p *peerConn) dialRoutine() {
+	config := p.t.config
+	backoff := config.MinBackoff
+	for {
+		p.mu.Lock()
+		s := p.session
+		p.mu.Unlock()
+		if s != nil && !s.closed() {
+			select {
+			case <-p.quit:
+				return
+			case <-s.done:
+			}
+			backoff = config.MinBackoff
+			continue
+		}
+		if p.stopped() {
+			return
+		}
+
+		s, err := p.t.dial(p.addr)
+		if err == nil {
+			if err = p.attach(s); err == nil {
+				continue
+			}
+		}
+		fmt.Printf("⚠️ Can't connect to peer %s, retrying in %v: %v\n", p.addr, backoff, err)
+		select {
+		case <-p.quit:
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, config.MaxBackoff)
+	}
+}
+
+// serve читает пакеты сессии до её закрытия. Соединение без входящих
+// пакетов дольше PingInterval+PongTimeout считается разорванным.
+func (t *Transport) serve(p *peerConn, s *session) {
+	defer func() {
+		s.close()
+		p.detach(s)
+	}()
+	idle := t.config.PingInterval + t.config.PongTimeout
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(idle))
+		frame, err := codec.ReadFrame(s.conn)
+		if err != nil {
+			if !s.closed() && !p.stopped() {
+				fmt.Printf("🔌 Connection to peer %s closed: %v\n", p.addr, err)
+			}
+			return
+		}
+		pkt, err := decodePacket(frame)
+		if err != nil {
+			fmt.Printf("❌ Bad packet from %s: %v\n", p.addr, err)
+			return
+		}
+		switch pkt.Type {
+		case packetPing:
+			if err := s.write((&packet{Type: packetPong}).Encode(), t.config.WriteTimeout); err != nil {
+				return
+			}
+		case packetPong:
+		case packetResponse:
+			p.resolve(pkt)
+		case packetMsg, packetRequest:
+			select {
+			case p.inbox <- pkt:
+			case <-p.quit:
+				return
+			}
+		}
+	}
+}
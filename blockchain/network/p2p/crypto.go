@@ -1,11 +1,34 @@
 package p2p
 
+// TLS-сертификаты узлов: каждый узел предъявляет самоподписанный
+// сертификат своего ключа узла
+
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"blockchain/network/peer"
 )
 
+// certValidity — срок действия сертификата узла; сертификат, срок
+// которого подходит к концу, выпускается заново при запуске
+const certValidity = 10 * 365 * 24 * time.Hour
+
+var ErrBadCertificate = errors.New("bad peer certificate")
+
 func LoadTLSCert(certFile, keyFile string) (tls.Certificate, error) {
 	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
 	if err != nil {
@@ -14,25 +37,150 @@ func LoadTLSCert(certFile, keyFile string) (tls.Certificate, error) {
 	return cert, nil
 }
 
-func GenerateTLSConfig() *tls.Config {
-	serverCert, err := LoadTLSCert("certs/server.crt", "certs/server.key")
+var (
+	identityMu sync.Mutex
+	nodeKey    *peer.NodeKey
+	nodeCert   tls.Certificate
+)
+
+// SetNodeKey задаёт ключ узла для транспортов без Config.Key. Сертификат
+// ключа читается из certPath, а при первом запуске создаётся и сохраняется.
+func SetNodeKey(key *peer.NodeKey, certPath string) error {
+	cert, err := NodeCertificate(key, certPath)
+	if err != nil {
+		return err
+	}
+	identityMu.Lock()
+	defer identityMu.Unlock()
+	nodeKey, nodeCert = key, cert
+	return nil
+}
+
+// defaultIdentity возвращает ключ узла и его сертификат; если ключ не
+// задан SetNodeKey, процесс получает временный ключ
+func defaultIdentity() (*peer.NodeKey, tls.Certificate) {
+	identityMu.Lock()
+	defer identityMu.Unlock()
+	if nodeKey == nil {
+		key, err := peer.GenerateNodeKey()
+		if err != nil {
+			panic(err)
+		}
+		cert, err := NodeCertificate(key, "")
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("⚠️ No node key configured, using temporary identity %s\n", key.ID())
+		nodeKey, nodeCert = key, cert
+	}
+	return nodeKey, nodeCert
+}
+
+// NodeCertificate возвращает самоподписанный сертификат ключа узла из
+// PEM-файла path. Сертификат создаётся при первом запуске, а также если в
+// файле сертификат другого ключа или его срок подходит к концу; path "" —
+// сертификат только в памяти.
+func NodeCertificate(key *peer.NodeKey, path string) (tls.Certificate, error) {
+	if path != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			if block, _ := pem.Decode(data); block != nil && block.Type == "CERTIFICATE" {
+				leaf, err := x509.ParseCertificate(block.Bytes)
+				if err == nil && certificateKeyMatches(leaf, key) && time.Until(leaf.NotAfter) > certValidity/10 {
+					return tls.Certificate{Certificate: [][]byte{block.Bytes}, PrivateKey: key.PrivateKey(), Leaf: leaf}, nil
+				}
+			}
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return tls.Certificate{}, fmt.Errorf("failed to read node certificate: %w", err)
+		}
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: key.ID().String()},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(certValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PrivateKey().PublicKey, key.PrivateKey())
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to create node certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
 	if err != nil {
-		panic(err)
+		return tls.Certificate{}, err
+	}
+	if path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to save node certificate: %w", err)
+		}
+		data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return tls.Certificate{}, fmt.Errorf("failed to save node certificate: %w", err)
+		}
+		fmt.Printf("📜 Generated node certificate %s\n", path)
 	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key.PrivateKey(), Leaf: leaf}, nil
+}
+
+func certificateKeyMatches(cert *x509.Certificate, key *peer.NodeKey) bool {
+	pub, err := certificateKey(cert)
+	return err == nil && bytes.Equal(pub, key.PublicKey())
+}
 
-	// Загрузка CA для проверки клиентов
-	caCert, err := os.ReadFile("certs/ca.crt")
+// certificateKey возвращает ключ узла из сертификата в несжатом формате
+func certificateKey(cert *x509.Certificate) ([]byte, error) {
+	pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+	if !ok || pub.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("%w: expected an ECDSA P-256 key", ErrBadCertificate)
+	}
+	return elliptic.Marshal(elliptic.P256(), pub.X, pub.Y), nil
+}
+
+// verifyPeerCertificate проверяет, что пир предъявил действующий
+// сертификат, самоподписанный ключом узла. Владение ключом и его связь
+// с идентификатором пира проверяются рукопожатием транспорта.
+func verifyPeerCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("%w: no certificate", ErrBadCertificate)
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("%w: %v", ErrBadCertificate, err)
+	}
+	if _, err := certificateKey(cert); err != nil {
+		return err
+	}
+	if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+		return fmt.Errorf("%w: not self-signed: %v", ErrBadCertificate, err)
+	}
+	if now := time.Now(); now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return fmt.Errorf("%w: expired or not yet valid", ErrBadCertificate)
 	}
-	caPool := x509.NewCertPool()
-	caPool.AppendCertsFromPEM(caCert)
+	return nil
+}
 
+// NewTLSConfig возвращает TLS-конфигурацию узла с сертификатом cert. Пиры
+// предъявляют самоподписанные сертификаты своих ключей, поэтому цепочка
+// не проверяется по CA: ключ из сертификата сверяется рукопожатием.
+func NewTLSConfig(cert tls.Certificate) *tls.Config {
 	return &tls.Config{
-		Certificates: []tls.Certificate{serverCert},
-		ClientCAs:    caPool,
-		ClientAuth:   tls.RequireAndVerifyClientCert,
-		// FIXME: delete insecure if run on prod
-		InsecureSkipVerify: true, // ❌ Только для тестов!
+		Certificates:          []tls.Certificate{cert},
+		ClientAuth:            tls.RequireAnyClientCert,
+		InsecureSkipVerify:    true, // заменено verifyPeerCertificate и рукопожатием
+		VerifyPeerCertificate: verifyPeerCertificate,
+		MinVersion:            tls.VersionTLS13,
 	}
 }
+
+// GenerateTLSConfig возвращает TLS-конфигурацию с сертификатом ключа
+// узла (SetNodeKey)
+func GenerateTLSConfig() *tls.Config {
+	_, cert := defaultIdentity()
+	return NewTLSConfig(cert)
+}
@@ -1,34 +1,112 @@
 package p2p
 
 import (
-	"encoding/json"
+	"fmt"
 	"time"
+
+	"blockchain/codec"
+	"blockchain/network/peer"
 )
 
+// Handshake — первое сообщение соединения: узел объявляет ключ узла,
+// адрес, по которому его узнают пиры, и эфемерный ключ сессии
 type Handshake struct {
-	NodeID    string
+	NodeID    string // хэш PubKey
+	Address   string
+	PubKey    []byte
+	Ephemeral []byte // эфемерный ключ ECDH P-256 этого соединения
 	Timestamp int64
 	UserAgent string
 	Protocols []string
 }
 
-func NewHandshake(nodeID string) *Handshake {
+func NewHandshake(key *peer.NodeKey, address string, ephemeral []byte) *Handshake {
 	return &Handshake{
-		NodeID:    nodeID,
+		NodeID:    key.ID().String(),
+		Address:   address,
+		PubKey:    key.PublicKey(),
+		Ephemeral: ephemeral,
 		Timestamp: time.Now().Unix(),
 		UserAgent: "blockchain-node/1.0",
 		Protocols: []string{"gossip/1.0", "rpc/1.0"},
 	}
 }
 
-func (h *Handshake) Serialize() ([]byte, error) {
-	return json.Marshal(h)
+// Encode кодирует сообщение в каноническом формате
+func (h *Handshake) Encode() []byte {
+	w := codec.NewWriter(codec.KindHandshake)
+	w.String(h.NodeID)
+	w.String(h.Address)
+	w.Bytes(h.PubKey)
+	w.Bytes(h.Ephemeral)
+	w.Int64(h.Timestamp)
+	w.String(h.UserAgent)
+	w.Len(len(h.Protocols))
+	for _, protocol := range h.Protocols {
+		w.String(protocol)
+	}
+	return w.Result()
+}
+
+// DecodeHandshake восстанавливает сообщение, закодированное Encode
+func DecodeHandshake(data []byte) (*Handshake, error) {
+	r, err := codec.NewReader(data, codec.KindHandshake)
+	if err != nil {
+		return nil, err
+	}
+	h := &Handshake{
+		NodeID:    r.String(),
+		Address:   r.String(),
+		PubKey:    r.Bytes(),
+		Ephemeral: r.Bytes(),
+		Timestamp: r.Int64(),
+		UserAgent: r.String(),
+	}
+	count := r.Count(4)
+	for i := 0; i < count && r.Err() == nil; i++ {
+		h.Protocols = append(h.Protocols, r.String())
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode handshake: %w", err)
+	}
+	return h, nil
+}
+
+// HandshakeAuth — второе сообщение соединения: подпись ключом узла над
+// эфемерными ключами обеих сторон и привязкой к TLS-сессии
+type HandshakeAuth struct {
+	Signature []byte
+}
+
+// Encode кодирует сообщение в каноническом формате
+func (a *HandshakeAuth) Encode() []byte {
+	w := codec.NewWriter(codec.KindHandshakeReply)
+	w.Bytes(a.Signature)
+	return w.Result()
 }
 
-func DeserializeHandshake(data []byte) (*Handshake, error) {
-	var h Handshake
-	if err := json.Unmarshal(data, &h); err != nil {
+// DecodeHandshakeAuth восстанавливает сообщение, закодированное Encode
+func DecodeHandshakeAuth(data []byte) (*HandshakeAuth, error) {
+	r, err := codec.NewReader(data, codec.KindHandshakeReply)
+	if err != nil {
 		return nil, err
 	}
-	return &h, nil
+	a := &HandshakeAuth{Signature: r.Bytes()}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode handshake auth: %w", err)
+	}
+	return a, nil
+}
+
+// authTranscript возвращает данные, которые подписывает сторона с
+// эфемерным ключом own: свежие ключи обеих сторон не дают повторить
+// подпись в другом соединении, а привязка binding — переслать её в
+// другую TLS-сессию
+func authTranscript(own, remote, binding []byte, address string) []byte {
+	w := codec.NewWriter(codec.KindHandshakeAuth)
+	w.Bytes(own)
+	w.Bytes(remote)
+	w.Bytes(binding)
+	w.String(address)
+	return w.Result()
 }
@@ -0,0 +1,59 @@
+package p2p
+
+// пакеты соединения: каждый кадр codec.WriteFrame несёт один пакет
+
+import (
+	"fmt"
+
+	"blockchain/codec"
+)
+
+// packetType — назначение пакета
+type packetType byte
+
+const (
+	packetMsg      packetType = 0x01 // сообщение канала без ответа
+	packetRequest  packetType = 0x02 // запрос, ожидающий ответа с тем же ID
+	packetResponse packetType = 0x03 // ответ на запрос
+	packetPing     packetType = 0x04 // проверка живости соединения
+	packetPong     packetType = 0x05 // ответ на ping
+)
+
+// packet — единица передачи в соединении с пиром
+type packet struct {
+	Type    packetType
+	Channel ChannelID
+	ID      uint64 // номер запроса для request/response
+	Payload []byte
+	Error   string // ошибка обработчика запроса
+}
+
+// Encode кодирует пакет в каноническом формате
+func (p *packet) Encode() []byte {
+	w := codec.NewWriter(codec.KindPacket)
+	w.Uint64(uint64(p.Type))
+	w.Uint64(uint64(p.Channel))
+	w.Uint64(p.ID)
+	w.Bytes(p.Payload)
+	w.String(p.Error)
+	return w.Result()
+}
+
+// decodePacket восстанавливает пакет из кадра
+func decodePacket(data []byte) (*packet, error) {
+	r, err := codec.NewReader(data, codec.KindPacket)
+	if err != nil {
+		return nil, err
+	}
+	p := &packet{
+		Type:    packetType(r.Uint64()),
+		Channel: ChannelID(r.Uint64()),
+		ID:      r.Uint64(),
+		Payload: r.Bytes(),
+		Error:   r.String(),
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode packet: %w", err)
+	}
+	return p, nil
+}
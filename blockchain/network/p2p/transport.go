@@ -0,0 +1,584 @@
+package p2p
+
+// транспорт узла: одно долгоживущее TLS-соединение на пира, в котором
+// мультиплексируются логические каналы
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"blockchain/codec"
+	"blockchain/network/peer"
+)
+
+var (
+	ErrQueueFull         = errors.New("send queue is full")
+	ErrUnknownChannel    = errors.New("unknown channel")
+	ErrTransportClosed   = errors.New("transport is closed")
+	ErrPeerDisconnected  = errors.New("peer disconnected")
+	ErrRequestTimeout    = errors.New("request timed out")
+	ErrSelfConnection    = errors.New("connection to self")
+	ErrIdentityMismatch  = errors.New("peer identity mismatch")
+	ErrUnverifiedAddress = errors.New("peer address is not verified")
+)
+
+// maxHandshakeSize — наибольший кадр рукопожатия: пир ещё ничего не
+// доказал, поэтому больше нескольких килобайт под его сообщение не выделяется
+const maxHandshakeSize = 4 << 10
+
+// Встречных подключений для проверки адресов входящих пиров — не больше
+// dialBackBurst за dialBackWindow с одного IP: иначе узел, объявляя разные
+// порты, заставлял бы узел подключаться по ним
+const (
+	dialBackBurst  = 16
+	dialBackWindow = time.Minute
+)
+
+// exporterLabel — метка материала TLS-сессии, к которому привязана
+// подпись рукопожатия
+const exporterLabel = "EXPORTER-blockchain-p2p-auth"
+
+// Config — параметры транспорта
+type Config struct {
+	DialTimeout  time.Duration // установка TCP-соединения и рукопожатие
+	WriteTimeout time.Duration // запись одного пакета
+	PingInterval time.Duration // ping в простаивающем соединении
+	PongTimeout  time.Duration // соединение без входящих пакетов дольше PingInterval+PongTimeout закрывается
+	MinBackoff   time.Duration // первая пауза перед повторным подключением
+	MaxBackoff   time.Duration // пауза удваивается до MaxBackoff
+	Channels     []ChannelConfig
+	Key          *peer.NodeKey // nil — ключ узла процесса (SetNodeKey)
+}
+
+// DefaultConfig возвращает параметры по умолчанию
+func DefaultConfig() *Config {
+	return &Config{
+		DialTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+		PingInterval: 10 * time.Second,
+		PongTimeout:  20 * time.Second,
+		MinBackoff:   100 * time.Millisecond,
+		MaxBackoff:   10 * time.Second,
+		Channels:     DefaultChannels(),
+	}
+}
+
+// Handler обрабатывает сообщение канала от пира from. Сообщения одного
+// пира передаются обработчику по порядку.
+type Handler func(from string, msg []byte)
+
+// RequestHandler отвечает на запрос пира from; ошибка возвращается
+// запросившему вместо ответа
+type RequestHandler func(from string, msg []byte) ([]byte, error)
+
+// Transport держит по одному аутентифицированному соединению с каждым
+// пиром. Пакеты каналов ставятся в очереди пира и отправляются с учётом
+// приоритетов каналов; очереди переживают разрывы, а соединение с пирами,
+// которым узел отправляет сообщения, восстанавливается с нарастающей
+// паузой. Пиры опознаются по адресу, объявленному в рукопожатии, и
+// доказывают подписью владение ключом узла из своего TLS-сертификата.
+// Ключ узла за адресом закрепляет исходящее соединение по этому адресу;
+// адрес, объявленный во входящем соединении, сначала проверяется встречным
+// подключением, и сессии с другим ключом по этому адресу отклоняются.
+type Transport struct {
+	address   string
+	config    *Config
+	key       *peer.NodeKey
+	tlsConfig *tls.Config
+
+	mu       sync.Mutex
+	listener net.Listener
+	peers    map[string]*peerConn
+	handlers map[ChannelID]Handler
+	requests map[ChannelID]RequestHandler
+	closed   bool
+
+	dialBackMu sync.Mutex
+	dialBacks  map[string]*dialBackCount // встречные подключения по IP пира
+
+	nextRequest atomic.Uint64
+}
+
+// dialBackCount — встречные подключения к одному IP в текущем окне
+type dialBackCount struct {
+	start time.Time
+	count int
+}
+
+// NewTransport создаёт транспорт узла, принимающего соединения по адресу
+// address. config — параметры (по умолчанию DefaultConfig).
+func NewTransport(address string, config *Config) *Transport {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	key, cert := defaultIdentity()
+	if config.Key != nil {
+		key = config.Key
+		var err error
+		if cert, err = NodeCertificate(key, ""); err != nil {
+			panic(err)
+		}
+	}
+	return &Transport{
+		address:   address,
+		config:    config,
+		key:       key,
+		tlsConfig: NewTLSConfig(cert),
+		peers:     make(map[string]*peerConn),
+		handlers:  make(map[ChannelID]Handler),
+		requests:  make(map[ChannelID]RequestHandler),
+		dialBacks: make(map[string]*dialBackCount),
+	}
+}
+
+var (
+	sharedMu   sync.Mutex
+	transports = make(map[string]*Transport)
+)
+
+// Shared возвращает транспорт процесса для адреса address, создавая его
+// при первом обращении. Движки консенсуса одного узла разделяют транспорт:
+// работающий движок регистрирует свои обработчики при запуске.
+func Shared(address string, config *Config) *Transport {
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if t, ok := transports[address]; ok && !t.isClosed() {
+		return t
+	}
+	t := NewTransport(address, config)
+	transports[address] = t
+	return t
+}
+
+// Address возвращает адрес узла
+func (t *Transport) Address() string {
+	return t.address
+}
+
+// Config возвращает параметры транспорта
+func (t *Transport) Config() *Config {
+	return t.config
+}
+
+// Identity возвращает личность узла
+func (t *Transport) Identity() *peer.Identity {
+	return t.key.Identity()
+}
+
+// PeerIdentity возвращает подтверждённую рукопожатием личность пира addr
+// или nil, если соединения с ним нет
+func (t *Transport) PeerIdentity(addr string) *peer.Identity {
+	t.mu.Lock()
+	p, ok := t.peers[addr]
+	t.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.session == nil || p.session.closed() {
+		return nil
+	}
+	return p.session.identity
+}
+
+// OnReceive регистрирует обработчик сообщений канала ch, заменяя прежний
+func (t *Transport) OnReceive(ch ChannelID, handler Handler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handlers[ch] = handler
+}
+
+// OnRequest регистрирует обработчик запросов канала ch, заменяя прежний
+func (t *Transport) OnRequest(ch ChannelID, handler RequestHandler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requests[ch] = handler
+}
+
+// Listen начинает принимать соединения пиров; повторный вызов ничего не делает
+func (t *Transport) Listen() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrTransportClosed
+	}
+	if t.listener != nil {
+		return nil
+	}
+	listener, err := tls.Listen("tcp", t.address, t.tlsConfig)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", t.address, err)
+	}
+	t.listener = listener
+	fmt.Printf("📡 P2P transport listening on %s\n", t.address)
+	go t.acceptRoutine(listener)
+	return nil
+}
+
+// Close закрывает приём соединений и соединения со всеми пирами;
+// ожидающие запросы завершаются ошибкой
+func (t *Transport) Close() {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	t.closed = true
+	if t.listener != nil {
+		t.listener.Close()
+	}
+	peers := t.peers
+	t.peers = make(map[string]*peerConn)
+	t.mu.Unlock()
+
+	for _, p := range peers {
+		p.stop()
+	}
+	sharedMu.Lock()
+	if transports[t.address] == t {
+		delete(transports, t.address)
+	}
+	sharedMu.Unlock()
+}
+
+// AddPeer начинает поддерживать соединение с пиром addr
+func (t *Transport) AddPeer(addr string) error {
+	_, err := t.peer(addr, true)
+	return err
+}
+
+// RemovePeer закрывает соединение с пиром и отбрасывает его очереди
+func (t *Transport) RemovePeer(addr string) {
+	t.mu.Lock()
+	p, ok := t.peers[addr]
+	delete(t.peers, addr)
+	t.mu.Unlock()
+	if ok {
+		p.stop()
+	}
+}
+
+// Peers возвращает адреса пиров с открытым соединением
+func (t *Transport) Peers() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var addrs []string
+	for addr, p := range t.peers {
+		if p.connected() {
+			addrs = append(addrs, addr)
+		}
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// Send ставит сообщение msg в очередь канала ch к пиру addr, при
+// необходимости подключаясь к нему. Отправка асинхронна: сообщение
+// доставляется, как только есть соединение.
+func (t *Transport) Send(addr string, ch ChannelID, msg []byte) error {
+	p, err := t.peer(addr, true)
+	if err != nil {
+		return err
+	}
+	return p.enqueue(&packet{Type: packetMsg, Channel: ch, Payload: msg})
+}
+
+// Broadcast отправляет сообщение всем адресам addrs, кроме своего
+func (t *Transport) Broadcast(addrs []string, ch ChannelID, msg []byte) {
+	for _, addr := range addrs {
+		if addr == t.address {
+			continue
+		}
+		if err := t.Send(addr, ch, msg); err != nil {
+			fmt.Printf("❌ Failed to send %s message to %s: %v\n", ch, addr, err)
+		}
+	}
+}
+
+// Request отправляет запрос по каналу ch и ждёт ответа не дольше timeout.
+// Запрос завершается ошибкой, если соединение с пиром разорвано.
+func (t *Transport) Request(addr string, ch ChannelID, msg []byte, timeout time.Duration) ([]byte, error) {
+	p, err := t.peer(addr, true)
+	if err != nil {
+		return nil, err
+	}
+	id := t.nextRequest.Add(1)
+	response := p.await(id)
+	defer p.forget(id)
+	if err := p.enqueue(&packet{Type: packetRequest, Channel: ch, ID: id, Payload: msg}); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res, ok := <-response:
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrPeerDisconnected, addr)
+		}
+		if res.Error != "" {
+			return nil, errors.New(res.Error)
+		}
+		return res.Payload, nil
+	case <-timer.C:
+		return nil, fmt.Errorf("%w: %s on %s after %v", ErrRequestTimeout, addr, ch, timeout)
+	}
+}
+
+// peer возвращает состояние пира addr, создавая его; dial — поддерживать
+// исходящее соединение
+func (t *Transport) peer(addr string, dial bool) (*peerConn, error) {
+	if addr == t.address {
+		return nil, fmt.Errorf("%w: %s", ErrSelfConnection, addr)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, ErrTransportClosed
+	}
+	p, ok := t.peers[addr]
+	if !ok {
+		p = newPeerConn(t, addr)
+		t.peers[addr] = p
+	}
+	if dial {
+		p.startDialing()
+	}
+	return p, nil
+}
+
+func (t *Transport) isClosed() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closed
+}
+
+func (t *Transport) acceptRoutine(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if t.isClosed() {
+				return
+			}
+			fmt.Printf("❌ Failed to accept connection: %v\n", err)
+			continue
+		}
+		go t.accept(conn)
+	}
+}
+
+// accept завершает рукопожатие входящего соединения и привязывает его к
+// пиру, объявившему свой адрес. Объявленный адрес ничем не подтверждён:
+// его хост должен указывать на IP, с которого пришло соединение (то же
+// правило, что в peer.Discovery), и, пока за адресом не закреплён ключ,
+// узел сам подключается по нему. Входящая сессия принимается, только если
+// ключ совпал с ключом узла, который действительно слушает этот адрес;
+// пока адрес не подтверждён, состояние пира для него не создаётся.
+func (t *Transport) accept(conn net.Conn) {
+	s, err := t.handshake(conn, false)
+	if err != nil {
+		fmt.Printf("❌ Handshake with %s failed: %v\n", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	if err := peer.CheckPeerAddr(s.remote, conn.RemoteAddr().String()); err != nil {
+		fmt.Printf("❌ Rejected connection from %s: %v\n", conn.RemoteAddr(), err)
+		s.close()
+		return
+	}
+	p := t.lookup(s.remote)
+	if p == nil || !p.pinned() {
+		out, err := t.dialBack(conn.RemoteAddr(), s.remote)
+		if err != nil {
+			fmt.Printf("❌ Rejected connection from %s: failed to verify %s: %v\n", conn.RemoteAddr(), s.remote, err)
+			s.close()
+			return
+		}
+		if p, err = t.peer(s.remote, false); err != nil {
+			out.close()
+			s.close()
+			return
+		}
+		if err := p.attach(out); err != nil {
+			fmt.Printf("❌ Failed to verify %s: %v\n", s.remote, err)
+		}
+	}
+	if err := p.attach(s); err != nil {
+		fmt.Printf("❌ Rejected connection from %s: %v\n", conn.RemoteAddr(), err)
+	}
+}
+
+// lookup возвращает состояние пира addr или nil, не создавая его
+func (t *Transport) lookup(addr string) *peerConn {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.peers[addr]
+}
+
+// dialBack подключается по адресу addr, объявленному входящим пиром from,
+// не чаще dialBackBurst раз за dialBackWindow для одного IP
+func (t *Transport) dialBack(from net.Addr, addr string) (*session, error) {
+	host, _, err := net.SplitHostPort(from.String())
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	t.dialBackMu.Lock()
+	for ip, c := range t.dialBacks {
+		if now.Sub(c.start) >= dialBackWindow {
+			delete(t.dialBacks, ip)
+		}
+	}
+	c, ok := t.dialBacks[host]
+	if !ok {
+		c = &dialBackCount{start: now}
+		t.dialBacks[host] = c
+	}
+	c.count++
+	limited := c.count > dialBackBurst
+	t.dialBackMu.Unlock()
+	if limited {
+		return nil, fmt.Errorf("%w: too many dial-backs to %s", ErrUnverifiedAddress, host)
+	}
+	return t.dial(addr)
+}
+
+// dial открывает соединение с пиром addr; пир должен объявить тот же
+// адрес, по которому к нему подключились
+func (t *Transport) dial(addr string) (*session, error) {
+	dialer := &net.Dialer{Timeout: t.config.DialTimeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, t.tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	s, err := t.handshake(conn, true)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if s.remote != addr {
+		s.close()
+		return nil, fmt.Errorf("%w: peer at %s announced %s", ErrIdentityMismatch, addr, s.remote)
+	}
+	return s, nil
+}
+
+// handshake завершает TLS-рукопожатие и аутентифицирует пира. Узлы
+// обмениваются Handshake с ключом узла, адресом и эфемерным ключом, затем
+// каждый подписывает ключом узла эфемерные ключи обеих сторон и материал
+// TLS-сессии. Ключ пира должен совпадать с ключом его TLS-сертификата, а
+// идентификатор — быть хэшем ключа.
+func (t *Transport) handshake(conn net.Conn, outbound bool) (*session, error) {
+	conn.SetDeadline(time.Now().Add(t.config.DialTimeout))
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil, fmt.Errorf("%w: connection is not TLS", ErrBadCertificate)
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, err
+	}
+	state := tlsConn.ConnectionState()
+	certKey, err := certificateKey(state.PeerCertificates[0])
+	if err != nil {
+		return nil, err
+	}
+	binding, err := state.ExportKeyingMaterial(exporterLabel, nil, 32)
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	own := ephemeral.PublicKey().Bytes()
+
+	remote := &Handshake{}
+	if err := exchange(conn, NewHandshake(t.key, t.address, own), func(data []byte) (err error) {
+		remote, err = DecodeHandshake(data)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if remote.Address == "" || remote.Address == t.address {
+		return nil, fmt.Errorf("%w: peer announced %q", ErrSelfConnection, remote.Address)
+	}
+	if !bytes.Equal(remote.PubKey, certKey) {
+		return nil, fmt.Errorf("%w: handshake key differs from the certificate key of %s", ErrIdentityMismatch, remote.Address)
+	}
+	if remote.NodeID != peer.NewNodeID(remote.PubKey).String() {
+		return nil, fmt.Errorf("%w: node id of %s is not the hash of its key", ErrIdentityMismatch, remote.Address)
+	}
+	if _, err := ecdh.P256().NewPublicKey(remote.Ephemeral); err != nil {
+		return nil, fmt.Errorf("%w: bad ephemeral key from %s: %v", ErrIdentityMismatch, remote.Address, err)
+	}
+
+	sig, err := t.key.Sign(authTranscript(own, remote.Ephemeral, binding, t.address))
+	if err != nil {
+		return nil, err
+	}
+	auth := &HandshakeAuth{}
+	if err := exchange(conn, &HandshakeAuth{Signature: sig}, func(data []byte) (err error) {
+		auth, err = DecodeHandshakeAuth(data)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	identity, err := peer.VerifyIdentity(remote.PubKey, authTranscript(remote.Ephemeral, own, binding, remote.Address), auth.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate %s: %w", remote.Address, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return newSession(conn, remote.Address, identity, outbound), nil
+}
+
+// exchange отправляет своё сообщение рукопожатия и читает сообщение пира
+func exchange(conn net.Conn, msg interface{ Encode() []byte }, read func([]byte) error) error {
+	if err := codec.WriteFrame(conn, msg.Encode()); err != nil {
+		return err
+	}
+	frame, err := codec.ReadFrameLimit(conn, maxHandshakeSize)
+	if err != nil {
+		return err
+	}
+	return read(frame)
+}
+
+// dispatch передаёт пакет обработчику канала. Запросы обрабатываются
+// параллельно, ответ ставится в очередь того же канала.
+func (t *Transport) dispatch(p *peerConn, pkt *packet) {
+	t.mu.Lock()
+	handler := t.handlers[pkt.Channel]
+	request := t.requests[pkt.Channel]
+	t.mu.Unlock()
+
+	switch pkt.Type {
+	case packetMsg:
+		if handler != nil {
+			handler(p.addr, pkt.Payload)
+		}
+	case packetRequest:
+		go func() {
+			res := &packet{Type: packetResponse, Channel: pkt.Channel, ID: pkt.ID}
+			if request == nil {
+				res.Error = fmt.Sprintf("no request handler for %s", pkt.Channel)
+			} else if payload, err := request(p.addr, pkt.Payload); err != nil {
+				res.Error = err.Error()
+			} else {
+				res.Payload = payload
+			}
+			if err := p.enqueue(res); err != nil {
+				fmt.Printf("❌ Failed to answer %s request from %s: %v\n", pkt.Channel, p.addr, err)
+			}
+		}()
+	}
+}
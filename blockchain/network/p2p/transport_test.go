@@ -0,0 +1,562 @@
+package p2p
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"blockchain/codec"
+	"blockchain/network/peer"
+)
+
+// freeAddr возвращает свободный локальный адрес
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// testConfig возвращает параметры транспорта с собственным ключом узла
+func testConfig(t *testing.T) *Config {
+	t.Helper()
+	key, err := peer.GenerateNodeKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultConfig()
+	config.Key = key
+	config.MinBackoff = 10 * time.Millisecond
+	config.MaxBackoff = 100 * time.Millisecond
+	return config
+}
+
+func newTestTransport(t *testing.T, addr string) *Transport {
+	t.Helper()
+	tr := NewTransport(addr, testConfig(t))
+	if err := tr.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tr.Close)
+	return tr
+}
+
+// collector собирает сообщения, полученные обработчиком
+type collector struct {
+	mu   sync.Mutex
+	msgs [][]byte
+	from []string
+}
+
+func (c *collector) handle(from string, msg []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.msgs = append(c.msgs, msg)
+	c.from = append(c.from, from)
+}
+
+func (c *collector) wait(t *testing.T, n int) [][]byte {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		c.mu.Lock()
+		if len(c.msgs) >= n {
+			msgs := append([][]byte(nil), c.msgs...)
+			c.mu.Unlock()
+			return msgs
+		}
+		c.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t.Fatalf("Expected %d messages, received %d", n, len(c.msgs))
+	return nil
+}
+
+// TestTransport_SendInOrder - сообщения канала, в том числе больше
+// буфера чтения, доставляются целиком и по порядку в одном соединении
+func TestTransport_SendInOrder(t *testing.T) {
+	a := newTestTransport(t, freeAddr(t))
+	b := newTestTransport(t, freeAddr(t))
+	var received collector
+	b.OnReceive(ChannelTxs, received.handle)
+
+	const n = 50
+	large := bytes.Repeat([]byte("x"), 1<<20)
+	for i := 0; i < n; i++ {
+		msg := []byte(fmt.Sprintf("tx-%d", i))
+		if i == n/2 {
+			msg = large
+		}
+		if err := a.Send(b.Address(), ChannelTxs, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msgs := received.wait(t, n)
+	for i, msg := range msgs {
+		if i == n/2 {
+			if !bytes.Equal(msg, large) {
+				t.Fatalf("Large message arrived with %d bytes, expected %d", len(msg), len(large))
+			}
+			continue
+		}
+		if string(msg) != fmt.Sprintf("tx-%d", i) {
+			t.Fatalf("Message %d arrived out of order: %s", i, msg)
+		}
+	}
+	if received.from[0] != a.Address() {
+		t.Errorf("Expected sender %s, got %s", a.Address(), received.from[0])
+	}
+
+	// Ответ идёт по тому же соединению: новых подключений не открывается
+	var replies collector
+	a.OnReceive(ChannelConsensus, replies.handle)
+	if err := b.Send(a.Address(), ChannelConsensus, []byte("vote")); err != nil {
+		t.Fatal(err)
+	}
+	replies.wait(t, 1)
+	if peers := a.Peers(); len(peers) != 1 || peers[0] != b.Address() {
+		t.Errorf("Expected a single connection to %s, got %v", b.Address(), peers)
+	}
+}
+
+// TestTransport_ChannelPriority - канал с высоким приоритетом не ждёт, пока
+// отправится очередь канала транзакций, а низкий не простаивает
+func TestTransport_ChannelPriority(t *testing.T) {
+	consensus := &sendQueue{config: ChannelConfig{ID: ChannelConsensus, Priority: 10, SendQueue: 10}}
+	txs := &sendQueue{config: ChannelConfig{ID: ChannelTxs, Priority: 1, SendQueue: 100}}
+	queues := []*sendQueue{txs, consensus}
+	for i := 0; i < 100; i++ {
+		txs.packets = append(txs.packets, make([]byte, 100))
+	}
+
+	// Транзакции уже отправлялись, голос ставится в очередь позже
+	txs.recent = 1000
+	consensus.packets = append(consensus.packets, make([]byte, 100))
+	if q := nextQueue(queues, 0); q != consensus {
+		t.Fatalf("Expected the consensus packet first, got %s", q.config.ID)
+	}
+
+	// При равной загрузке каналы делят отправку в отношении приоритетов
+	txs.recent, consensus.recent = 0, 0
+	sent := make(map[ChannelID]int)
+	for i := 0; i < 55; i++ {
+		consensus.packets = append(consensus.packets[:0], make([]byte, 100))
+		q := nextQueue(queues, 0)
+		q.packets = q.packets[1:]
+		q.recent += 100
+		sent[q.config.ID]++
+	}
+	if sent[ChannelConsensus] != 50 || sent[ChannelTxs] != 5 {
+		t.Errorf("Expected a 10:1 share, got %d consensus and %d txs packets", sent[ChannelConsensus], sent[ChannelTxs])
+	}
+
+	if nextQueue([]*sendQueue{{config: consensus.config}}, 0) != nil {
+		t.Error("Expected no queue to be picked when all queues are empty")
+	}
+}
+
+// TestTransport_Request - ответ на запрос возвращается запросившему,
+// ошибка обработчика передаётся вместо ответа
+func TestTransport_Request(t *testing.T) {
+	a := newTestTransport(t, freeAddr(t))
+	b := newTestTransport(t, freeAddr(t))
+	b.OnRequest(ChannelSync, func(from string, msg []byte) ([]byte, error) {
+		if len(msg) == 0 {
+			return nil, fmt.Errorf("empty request from %s", from)
+		}
+		return append([]byte("re: "), msg...), nil
+	})
+
+	res, err := a.Request(b.Address(), ChannelSync, []byte("status"), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res) != "re: status" {
+		t.Errorf("Unexpected response %q", res)
+	}
+
+	if _, err := a.Request(b.Address(), ChannelSync, nil, 5*time.Second); err == nil || err.Error() != "empty request from "+a.Address() {
+		t.Errorf("Expected the handler error, got %v", err)
+	}
+	if _, err := a.Request(b.Address(), ChannelBlocks, []byte("x"), 5*time.Second); err == nil {
+		t.Error("Expected an error for a channel without a request handler")
+	}
+	if err := a.Send(b.Address(), ChannelID(0x7f), []byte("x")); err == nil {
+		t.Error("Expected an error for an unknown channel")
+	}
+}
+
+// TestTransport_Reconnect - после перезапуска пира с тем же ключом узла
+// соединение восстанавливается, и сообщение, поставленное в очередь во
+// время разрыва, доставляется
+func TestTransport_Reconnect(t *testing.T) {
+	addr := freeAddr(t)
+	a := newTestTransport(t, freeAddr(t))
+	b := newTestTransport(t, addr)
+	var before collector
+	b.OnReceive(ChannelConsensus, before.handle)
+
+	if err := a.Send(addr, ChannelConsensus, []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	before.wait(t, 1)
+
+	b.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(a.Peers()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := a.Send(addr, ChannelConsensus, []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	config := testConfig(t)
+	config.Key = b.key
+	restarted := NewTransport(addr, config)
+	var after collector
+	restarted.OnReceive(ChannelConsensus, after.handle)
+	if err := restarted.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	defer restarted.Close()
+
+	if msgs := after.wait(t, 1); string(msgs[0]) != "second" {
+		t.Errorf("Expected the queued message after reconnect, got %q", msgs[0])
+	}
+}
+
+// TestTransport_SimultaneousDial - пиры, подключившиеся друг к другу
+// одновременно, остаются с одним соединением и не теряют сообщений
+func TestTransport_SimultaneousDial(t *testing.T) {
+	a := newTestTransport(t, freeAddr(t))
+	b := newTestTransport(t, freeAddr(t))
+	var atA, atB collector
+	a.OnReceive(ChannelConsensus, atA.handle)
+	b.OnReceive(ChannelConsensus, atB.handle)
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		a.Send(b.Address(), ChannelConsensus, []byte("a"))
+		b.Send(a.Address(), ChannelConsensus, []byte("b"))
+	}
+	atA.wait(t, n)
+	atB.wait(t, n)
+
+	time.Sleep(2 * retireDelay)
+	if len(a.Peers()) != 1 || len(b.Peers()) != 1 {
+		t.Errorf("Expected one connection per peer, got %v and %v", a.Peers(), b.Peers())
+	}
+}
+
+// TestHandshake_Encode - сообщения рукопожатия кодируются каноническим
+// бинарным форматом и восстанавливаются без потерь
+func TestHandshake_Encode(t *testing.T) {
+	key, err := peer.GenerateNodeKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandshake(key, "127.0.0.1:26656", []byte{0x04, 0x01, 0x02})
+	data := h.Encode()
+	if data[0] != codec.Version || codec.Kind(data[1]) != codec.KindHandshake {
+		t.Fatalf("Expected a codec record of kind 0x%02x, got header % x", byte(codec.KindHandshake), data[:2])
+	}
+	decoded, err := DecodeHandshake(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, h) {
+		t.Errorf("Expected %+v, got %+v", h, decoded)
+	}
+
+	auth := &HandshakeAuth{Signature: []byte{0x30, 0x45, 0x02}}
+	decodedAuth, err := DecodeHandshakeAuth(auth.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decodedAuth.Signature, auth.Signature) {
+		t.Errorf("Expected signature %x, got %x", auth.Signature, decodedAuth.Signature)
+	}
+
+	// Обрезанная запись и запись другого типа отклоняются
+	if _, err := DecodeHandshake(data[:len(data)-1]); !errors.Is(err, codec.ErrTruncated) {
+		t.Errorf("Expected ErrTruncated, got %v", err)
+	}
+	if _, err := DecodeHandshakeAuth(data); !errors.Is(err, codec.ErrUnexpectedKind) {
+		t.Errorf("Expected ErrUnexpectedKind, got %v", err)
+	}
+}
+
+// TestTransport_HandshakeFrameLimit - кадр рукопожатия длиннее
+// maxHandshakeSize отклоняется по заголовку, до чтения тела
+func TestTransport_HandshakeFrameLimit(t *testing.T) {
+	a := newTestTransport(t, freeAddr(t))
+	key, _ := peer.GenerateNodeKey()
+	cert, err := NodeCertificate(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	errs := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		_, err = a.handshake(tls.Server(conn, a.tlsConfig), false)
+		errs <- err
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := tls.Client(conn, NewTLSConfig(cert))
+	if err := client.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := codec.ReadFrameLimit(client, maxHandshakeSize); err != nil {
+		t.Fatal(err)
+	}
+	// Заголовок обещает 64 МиБ, тело не отправляется
+	if _, err := client.Write([]byte{0x04, 0x00, 0x00, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, codec.ErrFieldTooLarge) {
+			t.Errorf("Expected ErrFieldTooLarge, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Expected the oversized frame to be rejected without waiting for its body")
+	}
+}
+
+// TestTransport_Identity - пиры узнают друг друга по ключам узлов, а
+// пир, чей сертификат выпущен для другого ключа, отвергается
+func TestTransport_Identity(t *testing.T) {
+	a := newTestTransport(t, freeAddr(t))
+	b := newTestTransport(t, freeAddr(t))
+	var received collector
+	b.OnReceive(ChannelConsensus, received.handle)
+	if err := a.Send(b.Address(), ChannelConsensus, []byte("vote")); err != nil {
+		t.Fatal(err)
+	}
+	received.wait(t, 1)
+	if id := a.PeerIdentity(b.Address()); id == nil || id.ID() != b.Identity().ID() {
+		t.Fatalf("Expected %s to be authenticated as %s, got %v", b.Address(), b.Identity().ID(), id)
+	}
+	if id := b.PeerIdentity(a.Address()); id == nil || id.ID() != a.Identity().ID() {
+		t.Errorf("Expected %s to be authenticated as %s, got %v", a.Address(), a.Identity().ID(), id)
+	}
+
+	// Узел объявляет свой ключ, но предъявляет сертификат чужого
+	impostor := NewTransport(freeAddr(t), testConfig(t))
+	defer impostor.Close()
+	other, _ := peer.GenerateNodeKey()
+	cert, err := NodeCertificate(other, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	impostor.tlsConfig = NewTLSConfig(cert)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	errs := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			errs <- err
+			return
+		}
+		defer conn.Close()
+		_, err = a.handshake(tls.Server(conn, a.tlsConfig), false)
+		errs <- err
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := impostor.handshake(tls.Client(conn, impostor.tlsConfig), true); err == nil {
+		t.Error("Expected the impostor handshake to fail")
+	}
+	if err := <-errs; !errors.Is(err, ErrIdentityMismatch) {
+		t.Errorf("Expected ErrIdentityMismatch, got %v", err)
+	}
+}
+
+// TestTransport_AddressBinding - узел с другим ключом не занимает адрес
+// уже подключённого пира, а пир, объявивший не тот адрес, по которому к
+// нему подключились, отвергается
+func TestTransport_AddressBinding(t *testing.T) {
+	a := newTestTransport(t, freeAddr(t))
+	b := newTestTransport(t, freeAddr(t))
+	var received collector
+	a.OnReceive(ChannelConsensus, received.handle)
+	if err := b.Send(a.Address(), ChannelConsensus, []byte("genuine")); err != nil {
+		t.Fatal(err)
+	}
+	received.wait(t, 1)
+
+	// Самозванец объявляет адрес b со своим ключом
+	impostor := NewTransport(b.Address(), testConfig(t))
+	defer impostor.Close()
+	if err := impostor.Send(a.Address(), ChannelConsensus, []byte("forged")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Send(a.Address(), ChannelConsensus, []byte("genuine")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	for _, msg := range received.wait(t, 2) {
+		if string(msg) != "genuine" {
+			t.Errorf("Expected only messages of the pinned peer, got %q", msg)
+		}
+	}
+	if id := a.PeerIdentity(b.Address()); id == nil || id.ID() != b.Identity().ID() {
+		t.Errorf("Expected %s to stay authenticated as %s, got %v", b.Address(), b.Identity().ID(), id)
+	}
+
+	// Пир слушает 127.0.0.1, а к нему подключаются по другому имени
+	c := newTestTransport(t, freeAddr(t))
+	alias := strings.Replace(c.Address(), "127.0.0.1", "localhost", 1)
+	if _, err := a.dial(alias); !errors.Is(err, ErrIdentityMismatch) {
+		t.Errorf("Expected ErrIdentityMismatch for a peer announcing another address, got %v", err)
+	}
+}
+
+// TestTransport_InboundAddressVerified - входящее соединение не закрепляет
+// объявленный адрес: узел подключается по нему сам и принимает сессию,
+// только если ключ совпал, поэтому самозванец, подключившийся первым, не
+// отнимает адрес у настоящего пира
+func TestTransport_InboundAddressVerified(t *testing.T) {
+	a := newTestTransport(t, freeAddr(t))
+	b := newTestTransport(t, freeAddr(t))
+	var received collector
+	a.OnReceive(ChannelConsensus, received.handle)
+
+	// Самозванец объявляет адрес b раньше самого b
+	impostor := NewTransport(b.Address(), testConfig(t))
+	defer impostor.Close()
+	if err := impostor.Send(a.Address(), ChannelConsensus, []byte("forged")); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for a.PeerIdentity(b.Address()) == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if id := a.PeerIdentity(b.Address()); id == nil || id.ID() != b.Identity().ID() {
+		t.Fatalf("Expected %s to be pinned to the listening peer %s, got %v", b.Address(), b.Identity().ID(), id)
+	}
+
+	if err := b.Send(a.Address(), ChannelConsensus, []byte("genuine")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	for _, msg := range received.wait(t, 1) {
+		if string(msg) != "genuine" {
+			t.Errorf("Expected only messages of the genuine peer, got %q", msg)
+		}
+	}
+
+	// Адрес, который никто не слушает, подтвердить нельзя
+	ghost := NewTransport(freeAddr(t), testConfig(t))
+	defer ghost.Close()
+	if err := ghost.Send(a.Address(), ChannelConsensus, []byte("ghost")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if id := a.PeerIdentity(ghost.Address()); id != nil {
+		t.Errorf("Expected an unverified address to stay unbound, got %s", id.ID())
+	}
+	if a.lookup(ghost.Address()) != nil {
+		t.Error("Expected no peer state for an address that failed verification")
+	}
+
+	// Адрес с хостом, на который не указывает IP соединения, не проверяется
+	// встречным подключением вовсе
+	foreign := NewTransport("10.255.255.1:27656", testConfig(t))
+	defer foreign.Close()
+	if err := foreign.Send(a.Address(), ChannelConsensus, []byte("foreign")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if a.lookup(foreign.Address()) != nil {
+		t.Error("Expected no peer state for a foreign host")
+	}
+
+	// Встречные подключения к одному IP ограничены
+	from := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2), Port: 1}
+	var err error
+	for i := 0; i <= dialBackBurst && !errors.Is(err, ErrUnverifiedAddress); i++ {
+		_, err = a.dialBack(from, freeAddr(t))
+	}
+	if !errors.Is(err, ErrUnverifiedAddress) {
+		t.Errorf("Expected dial-backs to be rate limited, got %v", err)
+	}
+}
+
+// TestTransport_NodeCertificate - сертификат ключа узла создаётся при
+// первом запуске и читается при следующих, а для другого ключа выпускается
+// заново
+func TestTransport_NodeCertificate(t *testing.T) {
+	dir := t.TempDir()
+	key, err := peer.LoadNodeKey(filepath.Join(dir, "node.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "node.crt")
+	first, err := NodeCertificate(key, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Leaf.Subject.CommonName != key.ID().String() {
+		t.Errorf("Expected the certificate subject to be the node id, got %s", first.Leaf.Subject.CommonName)
+	}
+	if err := verifyPeerCertificate(first.Certificate, nil); err != nil {
+		t.Errorf("Expected the node certificate to verify: %v", err)
+	}
+
+	reloaded, err := peer.LoadNodeKey(filepath.Join(dir, "node.key"))
+	if err != nil || reloaded.ID() != key.ID() {
+		t.Fatalf("Expected the saved node key to be reloaded, got %v", err)
+	}
+	second, err := NodeCertificate(reloaded, path)
+	if err != nil || !bytes.Equal(second.Certificate[0], first.Certificate[0]) {
+		t.Errorf("Expected the saved certificate to be reused, got %v", err)
+	}
+
+	other, _ := peer.GenerateNodeKey()
+	third, err := NodeCertificate(other, path)
+	if err != nil || bytes.Equal(third.Certificate[0], first.Certificate[0]) || !certificateKeyMatches(third.Leaf, other) {
+		t.Errorf("Expected a new certificate for another key, got %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "node.key")); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("Expected the node key to be readable only by its owner, got %v", info.Mode())
+	}
+}
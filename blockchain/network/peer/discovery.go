@@ -1,34 +1,597 @@
 package peer
 
+// обнаружение пиров: распределённая таблица Kademlia поверх UDP
+
 import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
-const BroadcastAddr = "255.255.255.255:30000"
+var (
+	ErrDiscoveryClosed = errors.New("discovery is closed")
+	ErrNoBootstrap     = errors.New("no bootstrap node responded")
+	ErrRequestTimeout  = errors.New("discovery request timed out")
+	ErrUnexpectedReply = errors.New("unexpected discovery reply")
+	ErrForeignPeerAddr = errors.New("p2p address does not belong to the sender")
+)
+
+// DiscoveryConfig — параметры обнаружения
+type DiscoveryConfig struct {
+	BucketSize      int           // k: узлов в корзине таблицы и в результате поиска
+	Alpha           int           // параллельных запросов при поиске
+	Bootstrap       []string      // UDP-адреса узлов, через которые узел входит в сеть
+	RequestTimeout  time.Duration // ожидание ответа на запрос
+	RefreshInterval time.Duration // период поиска случайных узлов для обновления таблицы
+	PingInterval    time.Duration // период проверки самых давних узлов корзин
+}
+
+// DefaultDiscoveryConfig возвращает параметры по умолчанию
+func DefaultDiscoveryConfig() *DiscoveryConfig {
+	return &DiscoveryConfig{
+		BucketSize:      16,
+		Alpha:           3,
+		RequestTimeout:  500 * time.Millisecond,
+		RefreshInterval: 30 * time.Second,
+		PingInterval:    10 * time.Second,
+	}
+}
+
+// Discovery — служба обнаружения узлов. Узлы хранятся в таблице
+// маршрутов по XOR-расстоянию идентификаторов; поиск FIND_NODE
+// итеративно опрашивает Alpha ближайших к цели узлов, пока ближайшие k
+// не опрошены. Каждое сообщение подписано ключом узла отправителя, а
+// идентификатор отправителя должен быть хэшем этого ключа. В таблицу
+// попадают только узлы, ответившие на запрос, а самые давние узлы корзин
+// периодически проверяются ping. Узлы таблицы передаются PeerManager как
+// подтверждённые личности и удаляются из него, когда перестают отвечать.
+type Discovery struct {
+	key     *NodeKey
+	manager *PeerManager
+	config  *DiscoveryConfig
+
+	mu       sync.Mutex
+	self     Node
+	conn     *net.UDPConn
+	table    *table
+	pending  map[uint64]*pendingRequest
+	checking map[NodeID]bool // узлы, которым отправлен ping проверки
 
-func BroadcastPresence(addr string) {
-	conn, _ := net.Dial("udp", BroadcastAddr)
-	defer conn.Close()
+	quit chan struct{}
+	once sync.Once
+	now  func() time.Time
+}
+
+// pendingRequest — запрос, ожидающий ответа. Номер запроса случаен, а
+// ответ принимается только с адреса, которому запрос отправлен, и от
+// ожидаемого узла: узел, узнавший номер, не подменит ответ другого.
+type pendingRequest struct {
+	to    *net.UDPAddr
+	node  NodeID // ожидаемый отвечающий; нулевой — любой (ping по адресу)
+	reply chan *message
+}
+
+// matches сообщает, отвечает ли msg с адреса src на этот запрос
+func (p *pendingRequest) matches(msg *message, src *net.UDPAddr) bool {
+	if p.to.Port != src.Port || !p.to.IP.Equal(src.IP) {
+		return false
+	}
+	return p.node == NodeID{} || p.node == msg.From.ID
+}
+
+// NewDiscovery создаёт службу обнаружения узла с ключом key и адресами
+// self; идентификатор узла выводится из ключа. Найденные узлы добавляются
+// в manager (если он задан). config — параметры (по умолчанию
+// DefaultDiscoveryConfig).
+func NewDiscovery(key *NodeKey, self Node, manager *PeerManager, config *DiscoveryConfig) *Discovery {
+	if config == nil {
+		config = DefaultDiscoveryConfig()
+	}
+	self.ID = key.ID()
+	d := &Discovery{
+		key:      key,
+		manager:  manager,
+		config:   config,
+		self:     self,
+		table:    newTable(self.ID, config.BucketSize),
+		pending:  make(map[uint64]*pendingRequest),
+		checking: make(map[NodeID]bool),
+		quit:     make(chan struct{}),
+		now:      time.Now,
+	}
+	return d
+}
+
+// Self возвращает запись узла; после Listen адрес — фактический адрес сокета
+func (d *Discovery) Self() Node {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.self
+}
+
+// Listen начинает принимать сообщения на UDP-адресе узла; повторный вызов
+// ничего не делает
+func (d *Discovery) Listen() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.stopped() {
+		return ErrDiscoveryClosed
+	}
+	if d.conn != nil {
+		return nil
+	}
+	addr, err := net.ResolveUDPAddr("udp", d.self.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to resolve discovery address: %w", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for discovery: %w", err)
+	}
+	d.conn = conn
+	d.self.Addr = conn.LocalAddr().String()
+	go d.readLoop(conn)
+	return nil
+}
+
+// Start начинает приём сообщений, входит в сеть через узлы Bootstrap и
+// периодически обновляет и проверяет таблицу
+func (d *Discovery) Start() error {
+	if err := d.Listen(); err != nil {
+		return err
+	}
+	go d.run()
+	return nil
+}
+
+// Stop закрывает сокет; ожидающие запросы завершаются ошибкой
+func (d *Discovery) Stop() {
+	d.once.Do(func() {
+		close(d.quit)
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.conn != nil {
+			d.conn.Close()
+		}
+	})
+}
 
-	msg := fmt.Sprintf("NODE_PRESENT:%s", addr)
+func (d *Discovery) stopped() bool {
+	select {
+	case <-d.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// Nodes возвращает узлы таблицы, ближайшие к узлу первыми
+func (d *Discovery) Nodes() []Node {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.table.closest(d.self.ID, d.table.len())
+}
+
+// Bootstrap опрашивает узлы Bootstrap и ищет узлы, ближайшие к своему
+// идентификатору, чтобы заполнить таблицу и сообщить о себе соседям.
+// Узел без Bootstrap считается первым в сети.
+func (d *Discovery) Bootstrap() error {
+	if len(d.config.Bootstrap) == 0 {
+		return nil
+	}
+	var wg sync.WaitGroup
+	var responded atomic.Int32
+	for _, addr := range d.config.Bootstrap {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			if _, err := d.Ping(addr); err != nil {
+				fmt.Printf("⚠️ Bootstrap node %s unavailable: %v\n", addr, err)
+				return
+			}
+			responded.Add(1)
+		}(addr)
+	}
+	wg.Wait()
+	if responded.Load() == 0 {
+		return ErrNoBootstrap
+	}
+	d.Lookup(d.Self().ID)
+	return nil
+}
+
+// lookupReply — ответ узла на запрос при поиске
+type lookupReply struct {
+	node  Node
+	nodes []Node
+	err   error
+}
+
+// Lookup ищет k узлов, ближайших к target: опрашивает по Alpha ближайших
+// ещё не опрошенных кандидатов и добавляет присланные ими узлы, пока
+// ближайшие k не опрошены. Молчащие узлы удаляются из таблицы.
+func (d *Discovery) Lookup(target NodeID) []Node {
+	k, alpha := d.config.BucketSize, d.config.Alpha
+	self := d.Self()
+	d.mu.Lock()
+	result := d.table.closest(target, k)
+	d.mu.Unlock()
+
+	known := map[NodeID]bool{self.ID: true}
+	for _, n := range result {
+		known[n.ID] = true
+	}
+	asked := make(map[NodeID]bool)
+	replies := make(chan lookupReply, alpha)
+	pending := 0
 	for {
-		conn.Write([]byte(msg))
-		time.Sleep(5 * time.Second)
+		for i := 0; i < len(result) && pending < alpha; i++ {
+			n := result[i]
+			if asked[n.ID] {
+				continue
+			}
+			asked[n.ID] = true
+			pending++
+			go func() {
+				nodes, err := d.findNode(n, target)
+				replies <- lookupReply{node: n, nodes: nodes, err: err}
+			}()
+		}
+		if pending == 0 {
+			return result
+		}
+		r := <-replies
+		pending--
+		if r.err != nil {
+			d.drop(r.node.ID)
+			for i, n := range result {
+				if n.ID == r.node.ID {
+					result = append(result[:i], result[i+1:]...)
+					break
+				}
+			}
+			continue
+		}
+		for _, n := range r.nodes {
+			if !known[n.ID] {
+				known[n.ID] = true
+				result = append(result, n)
+			}
+		}
+		sortByDistance(result, target)
+		if len(result) > k {
+			result = result[:k]
+		}
+	}
+}
+
+// Ping проверяет, что узел по адресу addr жив, и возвращает его запись
+func (d *Discovery) Ping(addr string) (Node, error) {
+	return d.ping(addr, NodeID{})
+}
+
+// ping проверяет узел по адресу addr; ответ принимается только от узла
+// id, если он задан
+func (d *Discovery) ping(addr string, id NodeID) (Node, error) {
+	res, err := d.request(addr, id, &message{Type: msgPing}, msgPong)
+	if err != nil {
+		return Node{}, err
 	}
+	return res.From, nil
 }
 
-func ListenForPeers() {
-	listener, _ := net.ListenUDP("udp", &net.UDPAddr{Port: 30000})
-	buf := make([]byte, 1024)
+// findNode запрашивает у узла n узлы, ближайшие к target
+func (d *Discovery) findNode(n Node, target NodeID) ([]Node, error) {
+	res, err := d.request(n.Addr, n.ID, &message{Type: msgFindNode, Target: target}, msgNeighbors)
+	if err != nil {
+		return nil, err
+	}
+	return res.Nodes, nil
+}
+
+// request отправляет запрос узлу id (нулевой — любому) по адресу addr и
+// ждёт ответа вида expect; ответивший узел отмечается в таблице
+func (d *Discovery) request(addr string, id NodeID, req *message, expect messageType) (*message, error) {
+	to, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", addr, err)
+	}
+	ch := make(chan *message, 1)
+	d.mu.Lock()
+	if d.conn == nil || d.stopped() {
+		d.mu.Unlock()
+		return nil, ErrDiscoveryClosed
+	}
+	conn := d.conn
+	for {
+		req.ID = randomRequestID()
+		if _, exists := d.pending[req.ID]; !exists {
+			break
+		}
+	}
+	d.pending[req.ID] = &pendingRequest{to: to, node: id, reply: ch}
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.pending, req.ID)
+		d.mu.Unlock()
+	}()
 
+	data, err := d.sign(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(data, to); err != nil {
+		return nil, fmt.Errorf("failed to send discovery request to %s: %w", addr, err)
+	}
+	select {
+	case res := <-ch:
+		if res.Type != expect {
+			return nil, fmt.Errorf("%w: %d from %s", ErrUnexpectedReply, res.Type, addr)
+		}
+		d.seen(res.From, res.identity)
+		return res, nil
+	case <-time.After(d.config.RequestTimeout):
+		return nil, fmt.Errorf("%w: %s", ErrRequestTimeout, addr)
+	case <-d.quit:
+		return nil, ErrDiscoveryClosed
+	}
+}
+
+// readLoop принимает датаграммы: отвечает на запросы и передаёт ответы
+// ожидающим запросам
+func (d *Discovery) readLoop(conn *net.UDPConn) {
+	buf := make([]byte, 64<<10)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if d.stopped() {
+				return
+			}
+			fmt.Printf("❌ Discovery read failed: %v\n", err)
+			continue
+		}
+		msg, err := decodeMessage(buf[:n])
+		if err != nil {
+			fmt.Printf("❌ Bad discovery message from %s: %v\n", src, err)
+			continue
+		}
+		if msg.From.ID == d.self.ID {
+			continue
+		}
+		identity, err := VerifyIdentity(msg.PubKey, msg.signingBytes(), msg.Signature)
+		if err == nil && identity.ID() != msg.From.ID {
+			err = fmt.Errorf("%w: node id is not the hash of its key", ErrUnauthenticated)
+		}
+		if err != nil {
+			fmt.Printf("❌ Unauthenticated discovery message from %s: %v\n", src, err)
+			continue
+		}
+		msg.identity = identity
+		// Адрес узла — тот, с которого пришла датаграмма, а не объявленный
+		msg.From.Addr = src.String()
+		msg.From.PeerAddr = resolvePeerAddr(msg.From.PeerAddr, src)
+
+		switch msg.Type {
+		case msgPing:
+			d.reply(conn, src, &message{Type: msgPong, ID: msg.ID})
+			d.verify(msg.From)
+		case msgFindNode:
+			d.mu.Lock()
+			nodes := d.table.closest(msg.Target, min(d.config.BucketSize, maxNeighbors))
+			d.mu.Unlock()
+			d.reply(conn, src, &message{Type: msgNeighbors, ID: msg.ID, Nodes: nodes})
+			d.verify(msg.From)
+		case msgPong, msgNeighbors:
+			// Ответ не с того адреса или не от того узла запрос не завершает
+			d.mu.Lock()
+			p, ok := d.pending[msg.ID]
+			ok = ok && p.matches(msg, src)
+			if ok {
+				delete(d.pending, msg.ID)
+			}
+			d.mu.Unlock()
+			if ok {
+				p.reply <- msg
+			}
+		}
+	}
+}
+
+// randomRequestID возвращает случайный номер запроса
+func randomRequestID() uint64 {
+	var b [8]byte
+	rand.Read(b[:])
+	return binary.BigEndian.Uint64(b[:])
+}
+
+// resolvePeerAddr подставляет IP отправителя в p2p-адрес без хоста
+func resolvePeerAddr(peerAddr string, src *net.UDPAddr) string {
+	host, port, err := net.SplitHostPort(peerAddr)
+	if err != nil {
+		return ""
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		return net.JoinHostPort(src.IP.String(), port)
+	}
+	return peerAddr
+}
+
+// sign подписывает сообщение ключом узла и кодирует его
+func (d *Discovery) sign(msg *message) ([]byte, error) {
+	msg.From = d.Self()
+	msg.PubKey = d.key.PublicKey()
+	sig, err := d.key.Sign(msg.signingBytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign discovery message: %w", err)
+	}
+	msg.Signature = sig
+	return msg.Encode(), nil
+}
+
+func (d *Discovery) reply(conn *net.UDPConn, to *net.UDPAddr, msg *message) {
+	data, err := d.sign(msg)
+	if err == nil {
+		_, err = conn.WriteToUDP(data, to)
+	}
+	if err != nil && !d.stopped() {
+		fmt.Printf("⚠️ Discovery reply to %s failed: %v\n", to, err)
+	}
+}
+
+// verify проверяет ping узел, приславший запрос: в таблицу он попадёт,
+// только если ответит со своего адреса
+func (d *Discovery) verify(n Node) {
+	d.mu.Lock()
+	known := d.table.has(n.ID)
+	d.mu.Unlock()
+	if !known {
+		d.check(n)
+	}
+}
+
+// seen отмечает ответивший узел. Новый узел передаётся PeerManager; если
+// его корзина полна, проверяется самый давний узел корзины.
+func (d *Discovery) seen(n Node, identity *Identity) {
+	d.mu.Lock()
+	added, oldest := d.table.add(n, identity, d.now())
+	d.mu.Unlock()
+	if added {
+		d.connect(n, identity)
+	}
+	if oldest != nil {
+		d.check(*oldest)
+	}
+}
+
+// check проверяет узел в фоне, не больше одной проверки на узел
+func (d *Discovery) check(n Node) {
+	d.mu.Lock()
+	if d.checking[n.ID] {
+		d.mu.Unlock()
+		return
+	}
+	d.checking[n.ID] = true
+	d.mu.Unlock()
+
+	go func() {
+		defer func() {
+			d.mu.Lock()
+			delete(d.checking, n.ID)
+			d.mu.Unlock()
+		}()
+		d.recheck(n)
+	}()
+}
+
+// recheck отправляет узлу ping и удаляет его, если он не ответил
+func (d *Discovery) recheck(n Node) {
+	if _, err := d.ping(n.Addr, n.ID); err != nil {
+		d.drop(n.ID)
+	}
+}
+
+// drop удаляет узел из таблицы и PeerManager; место занимает запасной узел
+func (d *Discovery) drop(id NodeID) {
+	d.mu.Lock()
+	known := d.table.has(id)
+	promoted := d.table.remove(id)
+	d.mu.Unlock()
+	if known && d.manager != nil {
+		d.manager.RemovePeer(id.String())
+	}
+	if promoted != nil {
+		d.connect(promoted.node, promoted.identity)
+	}
+}
+
+// connect передаёт узел таблицы PeerManager. p2p-адрес узел объявляет
+// сам, поэтому он принимается, только если указывает на IP, с которого
+// пришли датаграммы узла: иначе узел связал бы со своим ключом адрес
+// чужого узла
+func (d *Discovery) connect(n Node, identity *Identity) {
+	if d.manager == nil || n.PeerAddr == "" {
+		return
+	}
+	if err := CheckPeerAddr(n.PeerAddr, n.Addr); err != nil {
+		fmt.Printf("⚠️ Ignoring p2p address of %s: %v\n", n, err)
+		return
+	}
+	d.manager.AddPeer(NewAuthenticatedPeer(identity, n.PeerAddr))
+}
+
+// CheckPeerAddr проверяет, что хост p2p-адреса peerAddr, объявленного
+// узлом, — IP адреса addr, с которого узел пришёл, или имя, которое в него
+// разрешается
+func CheckPeerAddr(peerAddr, addr string) error {
+	host, _, err := net.SplitHostPort(peerAddr)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrForeignPeerAddr, err)
+	}
+	srcHost, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrForeignPeerAddr, err)
+	}
+	src := net.ParseIP(srcHost)
+	ips := []net.IP{net.ParseIP(host)}
+	if ips[0] == nil {
+		if ips, err = net.LookupIP(host); err != nil {
+			return fmt.Errorf("%w: %v", ErrForeignPeerAddr, err)
+		}
+	}
+	for _, ip := range ips {
+		if ip.Equal(src) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is announced from %s", ErrForeignPeerAddr, peerAddr, srcHost)
+}
+
+// revalidate проверяет ping самый давний узел каждой корзины
+func (d *Discovery) revalidate() {
+	d.mu.Lock()
+	oldest := d.table.oldest()
+	d.mu.Unlock()
+	var wg sync.WaitGroup
+	for _, n := range oldest {
+		wg.Add(1)
+		go func(n Node) {
+			defer wg.Done()
+			d.recheck(n)
+		}(n)
+	}
+	wg.Wait()
+}
+
+// run входит в сеть и поддерживает таблицу: обновляет её поиском
+// случайных узлов и проверяет самые давние узлы корзин
+func (d *Discovery) run() {
+	if err := d.Bootstrap(); err != nil {
+		fmt.Printf("⚠️ Discovery bootstrap failed: %v\n", err)
+	}
+	fmt.Printf("🔭 Discovery started at %s: %d nodes known\n", d.Self().Addr, len(d.Nodes()))
+	refresh := time.NewTicker(d.config.RefreshInterval)
+	defer refresh.Stop()
+	ping := time.NewTicker(d.config.PingInterval)
+	defer ping.Stop()
 	for {
-		n, _, _ := listener.ReadFromUDP(buf)
-		msg := string(buf[:n])
-		if len(msg) > 11 && msg[:11] == "NODE_PRESENT" {
-			addr := msg[12:]
-			fmt.Printf("Discovered peer: %s\n", addr)
+		select {
+		case <-d.quit:
+			return
+		case <-refresh.C:
+			if len(d.Nodes()) == 0 {
+				d.Bootstrap()
+				continue
+			}
+			d.Lookup(d.Self().ID)
+			d.Lookup(randomNodeID())
+		case <-ping.C:
+			d.revalidate()
 		}
 	}
 }
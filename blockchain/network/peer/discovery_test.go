@@ -0,0 +1,334 @@
+package peer
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testNodeID возвращает идентификатор, отличающийся от base битом bit
+// (0 — младший) и младшим байтом tag
+func testNodeID(base NodeID, bit int, tag byte) NodeID {
+	id := base
+	id[len(id)-1-bit/8] ^= 1 << (bit % 8)
+	if bit >= 8 {
+		id[len(id)-1] ^= tag
+	}
+	return id
+}
+
+// TestTable_Buckets - узлы попадают в корзину своего расстояния, полная
+// корзина не вытесняет давние узлы, а удалённый заменяется запасным
+func TestTable_Buckets(t *testing.T) {
+	self := NewNodeID([]byte("self"))
+	tab := newTable(self, 2)
+	now := time.Unix(1700000000, 0)
+
+	far1, far2, far3 := testNodeID(self, 255, 1), testNodeID(self, 255, 2), testNodeID(self, 255, 3)
+	near := testNodeID(self, 0, 0)
+	if logDistance(self, far1) != 256 || logDistance(self, near) != 1 || logDistance(self, self) != 0 {
+		t.Fatalf("Unexpected log distances %d and %d", logDistance(self, far1), logDistance(self, near))
+	}
+	for _, id := range []NodeID{far1, far2, near} {
+		if added, _ := tab.add(Node{ID: id}, nil, now); !added {
+			t.Fatalf("Expected node %s to be added", id)
+		}
+	}
+	added, oldest := tab.add(Node{ID: far3}, nil, now)
+	if added || oldest == nil || oldest.ID != far1 {
+		t.Fatalf("Expected the full bucket to keep its nodes and report the oldest, got %v %v", added, oldest)
+	}
+	if tab.has(far3) || tab.len() != 3 {
+		t.Error("Expected the new node to wait as a replacement")
+	}
+
+	// Ответивший узел становится самым недавним
+	tab.add(Node{ID: far1}, nil, now)
+	if _, oldest := tab.add(Node{ID: far3}, nil, now); oldest.ID != far2 {
+		t.Errorf("Expected %s to become the oldest, got %s", far2, oldest.ID)
+	}
+	if promoted := tab.remove(far2); promoted == nil || promoted.node.ID != far3 || !tab.has(far3) {
+		t.Errorf("Expected the replacement to take the removed node's place, got %v", promoted)
+	}
+
+	if closest := tab.closest(near, 2); len(closest) != 2 || closest[0].ID != near {
+		t.Errorf("Expected the nearest node first, got %v", closest)
+	}
+	if tab.add(Node{ID: self}, nil, now); tab.has(self) {
+		t.Error("Expected the table not to contain its own node")
+	}
+}
+
+// newTestDiscovery создаёт и запускает узел обнаружения на локальном адресе
+func newTestDiscovery(t *testing.T, bootstrap ...string) *Discovery {
+	t.Helper()
+	key, err := GenerateNodeKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := DefaultDiscoveryConfig()
+	config.Bootstrap = bootstrap
+	config.RequestTimeout = 200 * time.Millisecond
+	d := NewDiscovery(key, Node{Addr: "127.0.0.1:0", PeerAddr: ":27656"}, NewPeerManager(), config)
+	if err := d.Listen(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(d.Stop)
+	return d
+}
+
+// waitFor ждёт выполнения условия
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestDiscovery_Lookup - узлы, знающие только первый узел сети, находят
+// друг друга поиском, а найденные узлы попадают в PeerManager
+func TestDiscovery_Lookup(t *testing.T) {
+	const n = 40
+	seed := newTestDiscovery(t)
+	nodes := []*Discovery{seed}
+	for i := 1; i < n; i++ {
+		d := newTestDiscovery(t, seed.Self().Addr)
+		if err := d.Bootstrap(); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, d)
+	}
+	// Первый узел вносит в таблицу приславших запросы после ping
+	waitFor(t, "the seed to verify joined nodes", func() bool { return len(seed.Nodes()) >= seed.config.BucketSize })
+
+	for i, d := range nodes {
+		target := nodes[(i*7+3)%n].Self()
+		found := d.Lookup(target.ID)
+		if len(found) == 0 || found[0].ID != target.ID {
+			t.Fatalf("Node %d did not find %s: %v", i, target, found)
+		}
+		if found[0].Addr != target.Addr {
+			t.Errorf("Expected address %s, got %s", target.Addr, found[0].Addr)
+		}
+	}
+
+	d := nodes[n-1]
+	peers := d.manager.GetPeers()
+	if len(peers) != len(d.Nodes()) {
+		t.Fatalf("Expected every table node in the peer manager, got %d peers for %d nodes", len(peers), len(d.Nodes()))
+	}
+	// Адрес p2p без хоста дополняется адресом отправителя
+	if peers[0].Addr != "127.0.0.1:27656" {
+		t.Errorf("Expected the peer address resolved from the sender, got %s", peers[0].Addr)
+	}
+}
+
+// TestDiscovery_DropsSilentNodes - остановленный узел удаляется из
+// таблицы и PeerManager при проверке
+func TestDiscovery_DropsSilentNodes(t *testing.T) {
+	a := newTestDiscovery(t)
+	b := newTestDiscovery(t, a.Self().Addr)
+	c := newTestDiscovery(t, a.Self().Addr)
+	for _, d := range []*Discovery{b, c} {
+		if err := d.Bootstrap(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, "both nodes in the table", func() bool { return len(a.Nodes()) == 2 })
+
+	c.Stop()
+	// За проверку узел пингует самого давнего в корзине, а ответивший
+	// становится недавним, поэтому двух проверок хватает на оба узла
+	a.revalidate()
+	a.revalidate()
+	nodes := a.Nodes()
+	if len(nodes) != 1 || nodes[0].ID != b.Self().ID {
+		t.Fatalf("Expected only %s to remain, got %v", b.Self(), nodes)
+	}
+	if peers := a.manager.GetPeers(); len(peers) != 1 || peers[0].ID != b.Self().ID.String() {
+		t.Errorf("Expected the silent node to leave the peer manager, got %d peers", len(peers))
+	}
+
+	d := newTestDiscovery(t, c.Self().Addr)
+	if _, err := d.Ping(c.Self().Addr); !errors.Is(err, ErrRequestTimeout) {
+		t.Errorf("Expected a ping to a stopped node to time out, got %v", err)
+	}
+	if err := d.Bootstrap(); err != ErrNoBootstrap {
+		t.Errorf("Expected ErrNoBootstrap, got %v", err)
+	}
+}
+
+// TestDiscovery_MessageRoundTrip - сообщение обнаружения кодируется без потерь
+func TestDiscovery_MessageRoundTrip(t *testing.T) {
+	from := Node{ID: NewNodeID([]byte("a")), Addr: "10.0.0.1:30000", PeerAddr: "10.0.0.1:27656"}
+	msg := &message{Type: msgNeighbors, ID: 42, From: from, Target: NewNodeID([]byte("t"))}
+	for i := 0; i < 3; i++ {
+		msg.Nodes = append(msg.Nodes, Node{ID: NewNodeID([]byte{byte(i)}), Addr: fmt.Sprintf("10.0.0.%d:30000", i+2)})
+	}
+	decoded, err := decodeMessage(msg.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Type != msg.Type || decoded.ID != 42 || decoded.From != from || decoded.Target != msg.Target || len(decoded.Nodes) != 3 || decoded.Nodes[2] != msg.Nodes[2] {
+		t.Errorf("Message round trip mismatch: %+v", decoded)
+	}
+	if id, err := ParseNodeID(from.ID.String()); err != nil || id != from.ID {
+		t.Errorf("Node id round trip mismatch: %v", err)
+	}
+}
+
+// TestDiscovery_PeerAddrOfSender - узел не передаётся PeerManager с
+// p2p-адресом, который указывает не на IP его датаграмм
+func TestDiscovery_PeerAddrOfSender(t *testing.T) {
+	d := newTestDiscovery(t)
+	key, _ := GenerateNodeKey()
+	identity := key.Identity()
+
+	d.connect(Node{ID: identity.ID(), Addr: "10.0.0.1:30000", PeerAddr: "10.0.0.2:27656"}, identity)
+	if peers := d.manager.GetPeers(); len(peers) != 0 {
+		t.Fatalf("Expected a foreign p2p address to be ignored, got %d peers", len(peers))
+	}
+	d.connect(Node{ID: identity.ID(), Addr: "127.0.0.1:30000", PeerAddr: "localhost:27656"}, identity)
+	if peers := d.manager.GetPeers(); len(peers) != 1 || peers[0].Addr != "localhost:27656" {
+		t.Fatalf("Expected the peer at its own host to be added, got %+v", peers)
+	}
+}
+
+// TestDiscovery_RejectsForgedMessages - узел не отвечает на сообщение,
+// подписанное не ключом идентификатора отправителя, и не вносит его в таблицу
+func TestDiscovery_RejectsForgedMessages(t *testing.T) {
+	d := newTestDiscovery(t)
+	victim, _ := GenerateNodeKey()
+	attacker, _ := GenerateNodeKey()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	send := func(key *NodeKey, id NodeID) bool {
+		msg := &message{Type: msgPing, ID: 1, From: Node{ID: id, Addr: conn.LocalAddr().String()}, PubKey: key.PublicKey()}
+		msg.Signature, _ = key.Sign(msg.signingBytes())
+		to, _ := net.ResolveUDPAddr("udp", d.Self().Addr)
+		conn.WriteToUDP(msg.Encode(), to)
+		conn.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		buf := make([]byte, 2048)
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return false
+		}
+		res, err := decodeMessage(buf[:n])
+		return err == nil && res.Type == msgPong && res.From.ID == d.Self().ID
+	}
+
+	if send(attacker, victim.ID()) {
+		t.Error("Expected no answer to a message signed by another key")
+	}
+	if !send(victim, victim.ID()) {
+		t.Error("Expected an answer to a correctly signed message")
+	}
+	if len(d.Nodes()) != 0 {
+		t.Errorf("Expected unverified senders to stay out of the table, got %v", d.Nodes())
+	}
+}
+
+// TestDiscovery_RejectsForeignReplies - ответ с номером запроса
+// принимается только с адреса, которому отправлен запрос, и от ожидаемого узла
+func TestDiscovery_RejectsForeignReplies(t *testing.T) {
+	d := newTestDiscovery(t)
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	remote, other := listen(), listen()
+	remoteKey, _ := GenerateNodeKey()
+	otherKey, _ := GenerateNodeKey()
+
+	type result struct {
+		nodes []Node
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		nodes, err := d.findNode(Node{ID: remoteKey.ID(), Addr: remote.LocalAddr().String()}, NewNodeID([]byte("target")))
+		done <- result{nodes, err}
+	}()
+
+	buf := make([]byte, 2048)
+	remote.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := remote.ReadFromUDP(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := decodeMessage(buf[:n])
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, _ := net.ResolveUDPAddr("udp", d.Self().Addr)
+	reply := func(conn *net.UDPConn, key *NodeKey, tag string) {
+		msg := &message{Type: msgNeighbors, ID: req.ID, From: Node{ID: key.ID()}, PubKey: key.PublicKey(),
+			Nodes: []Node{{ID: NewNodeID([]byte(tag)), Addr: "10.0.0.1:30000"}}}
+		msg.Signature, _ = key.Sign(msg.signingBytes())
+		conn.WriteToUDP(msg.Encode(), to)
+		time.Sleep(20 * time.Millisecond)
+	}
+	reply(other, remoteKey, "wrong address")
+	reply(remote, otherKey, "wrong node")
+	reply(remote, remoteKey, "genuine")
+
+	r := <-done
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if len(r.nodes) != 1 || r.nodes[0].ID != NewNodeID([]byte("genuine")) {
+		t.Errorf("Expected only the genuine reply to be accepted, got %v", r.nodes)
+	}
+}
+
+// TestPeerManager_AuthenticatedOnly - PeerManager принимает только пиров,
+// доказавших владение ключом своего идентификатора
+func TestPeerManager_AuthenticatedOnly(t *testing.T) {
+	pm := NewPeerManager()
+	key, err := LoadNodeKey(filepath.Join(t.TempDir(), "node.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pm.AddPeer(NewPeer(key.ID().String(), "127.0.0.1:27656")); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Expected ErrUnauthenticated for a self-declared id, got %v", err)
+	}
+
+	data := []byte("challenge")
+	sig, err := key.Sign(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyIdentity(key.PublicKey(), []byte("other"), sig); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected ErrBadSignature for another message, got %v", err)
+	}
+	identity, err := VerifyIdentity(key.PublicKey(), data, sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := NewAuthenticatedPeer(identity, "127.0.0.1:27656")
+	forged.ID = NewNodeID([]byte("other")).String()
+	if err := pm.AddPeer(forged); !errors.Is(err, ErrUnauthenticated) {
+		t.Errorf("Expected ErrUnauthenticated for an id of another key, got %v", err)
+	}
+	if err := pm.AddPeer(NewAuthenticatedPeer(identity, "127.0.0.1:27656")); err != nil {
+		t.Fatal(err)
+	}
+	if peers := pm.GetPeers(); len(peers) != 1 || peers[0].ID != key.ID().String() {
+		t.Errorf("Expected the authenticated peer, got %v", peers)
+	}
+}
@@ -0,0 +1,146 @@
+package peer
+
+// долговременный ключ узла и подтверждённая личность пира
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"blockchain/crypto/signature"
+)
+
+var (
+	ErrUnauthenticated = errors.New("peer identity is not authenticated")
+	ErrBadSignature    = errors.New("invalid identity signature")
+)
+
+// NodeKey — долговременный ключ подписи узла (ECDSA P-256). Идентификатор
+// узла выводится из его публичного ключа, а подписи ключом доказывают
+// пирам, что узел владеет идентификатором.
+type NodeKey struct {
+	priv   *ecdsa.PrivateKey
+	pubKey []byte
+}
+
+func newNodeKey(priv *ecdsa.PrivateKey) *NodeKey {
+	return &NodeKey{priv: priv, pubKey: elliptic.Marshal(elliptic.P256(), priv.X, priv.Y)}
+}
+
+// GenerateNodeKey создаёт новый ключ узла
+func GenerateNodeKey() (*NodeKey, error) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newNodeKey(priv), nil
+}
+
+// LoadNodeKey читает ключ узла из PEM-файла path, а при первом запуске
+// создаёт ключ и сохраняет его с правами только для владельца
+func LoadNodeKey(path string) (*NodeKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := GenerateNodeKey()
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key.priv)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+			return nil, fmt.Errorf("failed to save node key: %w", err)
+		}
+		data := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			return nil, fmt.Errorf("failed to save node key: %w", err)
+		}
+		fmt.Printf("🔑 Generated node key %s\n", path)
+		return key, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read node key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, fmt.Errorf("failed to read node key: %s is not a PEM EC private key", path)
+	}
+	priv, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read node key: %w", err)
+	}
+	if priv.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("failed to read node key: curve %s, expected P-256", priv.Curve.Params().Name)
+	}
+	return newNodeKey(priv), nil
+}
+
+// PublicKey возвращает публичный ключ в несжатом формате (65 байт)
+func (k *NodeKey) PublicKey() []byte {
+	return k.pubKey
+}
+
+// PrivateKey возвращает закрытый ключ для сертификата узла
+func (k *NodeKey) PrivateKey() *ecdsa.PrivateKey {
+	return k.priv
+}
+
+// ID возвращает идентификатор узла
+func (k *NodeKey) ID() NodeID {
+	return NewNodeID(k.pubKey)
+}
+
+// Identity возвращает личность самого узла
+func (k *NodeKey) Identity() *Identity {
+	return &Identity{id: k.ID(), pubKey: k.pubKey}
+}
+
+// Sign подписывает данные ключом узла (DER)
+func (k *NodeKey) Sign(data []byte) ([]byte, error) {
+	hash := sha256.Sum256(data)
+	return ecdsa.SignASN1(rand.Reader, k.priv, hash[:])
+}
+
+// Identity — личность пира, доказавшего подписью владение ключом.
+// Создаётся только VerifyIdentity, поэтому PeerManager отличает
+// подтверждённых пиров от объявивших себя.
+type Identity struct {
+	id     NodeID
+	pubKey []byte
+}
+
+// VerifyIdentity проверяет подпись sig над data ключом pubKey и
+// возвращает личность владельца ключа
+func VerifyIdentity(pubKey, data, sig []byte) (*Identity, error) {
+	pub, err := signature.ParsePublicKey(pubKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+		return nil, fmt.Errorf("%w: public key is not on the curve", ErrBadSignature)
+	}
+	hash := sha256.Sum256(data)
+	if !ecdsa.VerifyASN1(pub, hash[:], sig) {
+		return nil, ErrBadSignature
+	}
+	return &Identity{id: NewNodeID(pubKey), pubKey: bytes.Clone(pubKey)}, nil
+}
+
+// ID возвращает идентификатор узла
+func (i *Identity) ID() NodeID {
+	return i.id
+}
+
+// PublicKey возвращает публичный ключ узла
+func (i *Identity) PublicKey() []byte {
+	return i.pubKey
+}
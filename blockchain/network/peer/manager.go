@@ -1,7 +1,9 @@
 package peer
 
 import (
+	"errors"
 	"fmt"
+	"sync"
 
 	"blockchain/security/sybil"
 )
@@ -9,6 +11,7 @@ import (
 // управление пирингом
 
 type PeerManager struct {
+	mu    sync.Mutex // пиры добавляет и служба обнаружения
 	peers map[string]*Peer
 }
 
@@ -24,21 +27,40 @@ func SetSybilGuard(guard *sybil.SybilGuard) {
     sybilGuard = guard
 }
 
-func (pm *PeerManager) AddPeer(p *Peer) {
-	if !sybilGuard.RegisterNode(p.ID) {
+var ErrSybilRejected = errors.New("peer rejected by sybil check")
+
+// AddPeer добавляет пира, доказавшего владение ключом своего
+// идентификатора (рукопожатием транспорта или подписью обнаружения)
+func (pm *PeerManager) AddPeer(p *Peer) error {
+	if p.Identity == nil || p.ID != p.Identity.ID().String() {
+		fmt.Printf("Failed to register peer %s: identity not authenticated\n", p.ID)
+		return fmt.Errorf("%w: %s", ErrUnauthenticated, p.ID)
+	}
+	if sybilGuard != nil && !sybilGuard.RegisterNode(p.ID, p.Addr) {
 		fmt.Printf("Failed to register peer %s: Sybil check failed\n", p.ID)
-		return
+		return fmt.Errorf("%w: %s", ErrSybilRejected, p.ID)
 	}
+	pm.mu.Lock()
 	pm.peers[p.ID] = p
+	pm.mu.Unlock()
 	fmt.Printf("Peer added: %s\n", p.ID)
+	return nil
 }
 
+// RemovePeer удаляет пира и освобождает его место в защите от Sybil
 func (pm *PeerManager) RemovePeer(id string) {
+	pm.mu.Lock()
 	delete(pm.peers, id)
+	pm.mu.Unlock()
+	if sybilGuard != nil {
+		sybilGuard.RemoveNode(id)
+	}
 	fmt.Printf("Peer removed: %s\n", id)
 }
 
 func (pm *PeerManager) GetPeers() []*Peer {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 	var list []*Peer
 	for _, p := range pm.peers {
 		list = append(list, p)
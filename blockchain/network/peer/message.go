@@ -0,0 +1,116 @@
+package peer
+
+// сообщения обнаружения узлов
+
+import (
+	"fmt"
+
+	"blockchain/codec"
+)
+
+// messageType — вид сообщения обнаружения
+type messageType byte
+
+const (
+	msgPing      messageType = 0x01 // проверка, что узел жив
+	msgPong      messageType = 0x02 // ответ на ping
+	msgFindNode  messageType = 0x03 // запрос узлов, ближайших к Target
+	msgNeighbors messageType = 0x04 // ответ на запрос узлов
+)
+
+// maxNeighbors ограничивает число узлов в ответе, чтобы он помещался в
+// одну UDP-датаграмму
+const maxNeighbors = 32
+
+// message — датаграмма обнаружения. Ответ несёт номер запроса, а каждое
+// сообщение — запись отправителя, подписанную его ключом узла.
+type message struct {
+	Type      messageType
+	ID        uint64 // номер запроса
+	From      Node
+	Target    NodeID // для msgFindNode
+	Nodes     []Node // для msgNeighbors
+	PubKey    []byte // ключ узла отправителя; From.ID — его хэш
+	Signature []byte
+
+	identity *Identity // личность отправителя после проверки подписи
+}
+
+func writeNode(w *codec.Writer, n Node) {
+	w.Bytes(n.ID[:])
+	w.String(n.Addr)
+	w.String(n.PeerAddr)
+}
+
+func readNode(r *codec.Reader) (Node, error) {
+	var n Node
+	raw := r.Bytes()
+	if r.Err() == nil && len(raw) != len(n.ID) {
+		return n, fmt.Errorf("node id of %d bytes", len(raw))
+	}
+	copy(n.ID[:], raw)
+	n.Addr = r.String()
+	n.PeerAddr = r.String()
+	return n, nil
+}
+
+func (m *message) writeBody(w *codec.Writer) {
+	w.Uint64(uint64(m.Type))
+	w.Uint64(m.ID)
+	writeNode(w, m.From)
+	w.Bytes(m.Target[:])
+	w.Len(len(m.Nodes))
+	for _, n := range m.Nodes {
+		writeNode(w, n)
+	}
+}
+
+// signingBytes возвращает подписываемые поля сообщения
+func (m *message) signingBytes() []byte {
+	w := codec.NewWriter(codec.KindDiscovery)
+	m.writeBody(w)
+	return w.Result()
+}
+
+// Encode кодирует сообщение в каноническом формате
+func (m *message) Encode() []byte {
+	w := codec.NewWriter(codec.KindDiscovery)
+	m.writeBody(w)
+	w.Bytes(m.PubKey)
+	w.Bytes(m.Signature)
+	return w.Result()
+}
+
+// decodeMessage восстанавливает сообщение
+func decodeMessage(data []byte) (*message, error) {
+	r, err := codec.NewReader(data, codec.KindDiscovery)
+	if err != nil {
+		return nil, err
+	}
+	m := &message{Type: messageType(r.Uint64()), ID: r.Uint64()}
+	if m.From, err = readNode(r); err != nil {
+		return nil, fmt.Errorf("failed to decode discovery message: %w", err)
+	}
+	target := r.Bytes()
+	if r.Err() == nil && len(target) != len(m.Target) {
+		return nil, fmt.Errorf("failed to decode discovery message: target of %d bytes", len(target))
+	}
+	copy(m.Target[:], target)
+	n := r.Len()
+	if n > maxNeighbors {
+		return nil, fmt.Errorf("failed to decode discovery message: %d nodes", n)
+	}
+	for i := 0; i < n && r.Err() == nil; i++ {
+		node, err := readNode(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode discovery message: %w", err)
+		}
+		m.Nodes = append(m.Nodes, node)
+	}
+	m.PubKey = r.Bytes()
+	m.Signature = r.Bytes()
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode discovery message: %w", err)
+	}
+	return m, nil
+}
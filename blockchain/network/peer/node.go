@@ -0,0 +1,87 @@
+package peer
+
+// идентификаторы узлов и расстояние между ними
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/bits"
+)
+
+// NodeID — идентификатор узла в сети обнаружения: хэш его публичного
+// ключа, поэтому узел не может выбрать себе место в таблице маршрутов
+type NodeID [sha256.Size]byte
+
+// NewNodeID вычисляет идентификатор узла по публичному ключу
+func NewNodeID(pubKey []byte) NodeID {
+	return sha256.Sum256(pubKey)
+}
+
+// ParseNodeID восстанавливает идентификатор из шестнадцатеричной строки
+func ParseNodeID(s string) (NodeID, error) {
+	var id NodeID
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		return id, fmt.Errorf("failed to parse node id: %w", err)
+	}
+	if len(raw) != len(id) {
+		return id, fmt.Errorf("failed to parse node id: %d bytes", len(raw))
+	}
+	copy(id[:], raw)
+	return id, nil
+}
+
+// randomNodeID возвращает случайный идентификатор для поиска
+func randomNodeID() NodeID {
+	var id NodeID
+	rand.Read(id[:])
+	return id
+}
+
+func (id NodeID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// distance возвращает метрику XOR между a и b
+func distance(a, b NodeID) NodeID {
+	var d NodeID
+	for i := range d {
+		d[i] = a[i] ^ b[i]
+	}
+	return d
+}
+
+// logDistance — номер старшего различающегося бита a и b, от 1 до 256;
+// 0 — идентификаторы совпадают
+func logDistance(a, b NodeID) int {
+	for i := range a {
+		if x := a[i] ^ b[i]; x != 0 {
+			return (len(a)-i-1)*8 + bits.Len8(x)
+		}
+	}
+	return 0
+}
+
+// closer сообщает, ближе ли a к target, чем b
+func closer(target, a, b NodeID) bool {
+	da, db := distance(target, a), distance(target, b)
+	for i := range da {
+		if da[i] != db[i] {
+			return da[i] < db[i]
+		}
+	}
+	return false
+}
+
+// Node — запись узла сети обнаружения
+type Node struct {
+	ID       NodeID
+	Addr     string // UDP-адрес обнаружения
+	PeerAddr string // адрес p2p-транспорта узла
+}
+
+func (n Node) String() string {
+	return fmt.Sprintf("%s@%s", n.ID.String()[:16], n.Addr)
+}
@@ -8,6 +8,7 @@ type Peer struct {
 	ID         string
 	Addr       string
 	Connection *tls.Conn // Добавляем поле
+	Identity   *Identity // подтверждённый ключ узла; ID — его идентификатор
 
 }
 
@@ -22,3 +23,9 @@ func NewPeer(id, addr string, conn ...*tls.Conn) *Peer {
 		Connection: connection,
 	}
 }
+
+// NewAuthenticatedPeer создаёт пира с подтверждённой личностью: его
+// идентификатор выводится из ключа
+func NewAuthenticatedPeer(identity *Identity, addr string) *Peer {
+	return &Peer{ID: identity.ID().String(), Addr: addr, Identity: identity}
+}
@@ -0,0 +1,160 @@
+package peer
+
+// таблица маршрутов Kademlia
+
+import (
+	"sort"
+	"time"
+)
+
+// bucket — узлы на одном логарифмическом расстоянии: от давно
+// отвечавших к недавним, и запасные, ждущие освобождения места
+type bucket struct {
+	entries      []*tableEntry
+	replacements []*tableEntry
+}
+
+type tableEntry struct {
+	node     Node
+	identity *Identity // ключ, подписавший ответ узла
+	lastSeen time.Time
+}
+
+// table — таблица маршрутов: узел на логарифмическом расстоянии d
+// попадает в корзину d-1, в каждой корзине не больше k узлов. Давно
+// отвечавшие узлы не вытесняются новыми, пока отвечают на ping, поэтому
+// таблицу нельзя заполнить только что созданными узлами.
+type table struct {
+	self    NodeID
+	k       int
+	buckets [len(NodeID{}) * 8]bucket
+}
+
+func newTable(self NodeID, k int) *table {
+	return &table{self: self, k: k}
+}
+
+func (t *table) bucket(id NodeID) *bucket {
+	return &t.buckets[logDistance(t.self, id)-1]
+}
+
+// add отмечает, что узел n с личностью identity ответил. Известный узел
+// переносится в конец корзины, новый добавляется, если есть место. В
+// полную корзину узел попадает запасным; тогда возвращается самый давний
+// узел корзины, которого нужно проверить ping и при молчании удалить.
+func (t *table) add(n Node, identity *Identity, now time.Time) (added bool, oldest *Node) {
+	if n.ID == t.self {
+		return false, nil
+	}
+	b := t.bucket(n.ID)
+	for i, e := range b.entries {
+		if e.node.ID == n.ID {
+			e.node, e.identity, e.lastSeen = n, identity, now
+			b.entries = append(append(b.entries[:i], b.entries[i+1:]...), e)
+			return false, nil
+		}
+	}
+	if len(b.entries) < t.k {
+		b.entries = append(b.entries, &tableEntry{node: n, identity: identity, lastSeen: now})
+		return true, nil
+	}
+	b.replacements = pushEntry(b.replacements, &tableEntry{node: n, identity: identity, lastSeen: now}, t.k)
+	head := b.entries[0].node
+	return false, &head
+}
+
+// pushEntry добавляет запасной узел в конец списка из не больше max узлов
+func pushEntry(list []*tableEntry, e *tableEntry, max int) []*tableEntry {
+	for i, old := range list {
+		if old.node.ID == e.node.ID {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	list = append(list, e)
+	if len(list) > max {
+		list = list[len(list)-max:]
+	}
+	return list
+}
+
+// remove удаляет узел; его место занимает последний ответивший запасной.
+// Возвращает запись занявшего место узла.
+func (t *table) remove(id NodeID) (promoted *tableEntry) {
+	if id == t.self {
+		return nil
+	}
+	b := t.bucket(id)
+	for i, e := range b.replacements {
+		if e.node.ID == id {
+			b.replacements = append(b.replacements[:i], b.replacements[i+1:]...)
+			return nil
+		}
+	}
+	for i, e := range b.entries {
+		if e.node.ID != id {
+			continue
+		}
+		b.entries = append(b.entries[:i], b.entries[i+1:]...)
+		if n := len(b.replacements); n > 0 {
+			r := b.replacements[n-1]
+			b.replacements = b.replacements[:n-1]
+			b.entries = append(b.entries, r)
+			return r
+		}
+		return nil
+	}
+	return nil
+}
+
+// has сообщает, есть ли узел в таблице
+func (t *table) has(id NodeID) bool {
+	if id == t.self {
+		return false
+	}
+	for _, e := range t.bucket(id).entries {
+		if e.node.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// closest возвращает до n узлов таблицы, ближайших к target
+func (t *table) closest(target NodeID, n int) []Node {
+	var nodes []Node
+	for i := range t.buckets {
+		for _, e := range t.buckets[i].entries {
+			nodes = append(nodes, e.node)
+		}
+	}
+	sortByDistance(nodes, target)
+	if len(nodes) > n {
+		nodes = nodes[:n]
+	}
+	return nodes
+}
+
+// oldest возвращает самый давний узел каждой непустой корзины
+func (t *table) oldest() []Node {
+	var nodes []Node
+	for i := range t.buckets {
+		if b := &t.buckets[i]; len(b.entries) > 0 {
+			nodes = append(nodes, b.entries[0].node)
+		}
+	}
+	return nodes
+}
+
+// len возвращает число узлов таблицы
+func (t *table) len() int {
+	n := 0
+	for i := range t.buckets {
+		n += len(t.buckets[i].entries)
+	}
+	return n
+}
+
+func sortByDistance(nodes []Node, target NodeID) {
+	sort.Slice(nodes, func(i, j int) bool { return closer(target, nodes[i].ID, nodes[j].ID) })
+}
@@ -3,7 +3,11 @@ package offchain
 
 import (
 	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sync"
 	"time"
 
 	"blockchain/crypto/signature"
@@ -28,9 +32,13 @@ type Settlement struct {
 	Nonce   int
 }
 
+var ErrChannelNotFound = errors.New("channel not found")
+
 // ChannelManager — управление каналами
 type ChannelManager struct {
 	channels map[string]*PaymentChannel
+	journal  func(key string, value any)
+	mu       sync.RWMutex
 }
 
 // NewChannelManager — создает новый ChannelManager
@@ -42,13 +50,18 @@ func NewChannelManager() *ChannelManager {
 
 // GetChannel returns a channel by its ID
 func (cm *ChannelManager) GetChannel(id string) (*PaymentChannel, bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
 	channel, exists := cm.channels[id]
 	return channel, exists
 }
 
 // AddChannel adds a channel to the manager
 func (cm *ChannelManager) AddChannel(channel *PaymentChannel) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
 	cm.channels[channel.ID] = channel
+	cm.record(channel)
 }
 
 // CreateChannel — создает новый канал
@@ -65,10 +78,43 @@ func (cm *ChannelManager) CreateChannel(id string, a, b string, depositA, deposi
 		Timeout:      timeout,
 		PublicKeys:   [2]*ecdsa.PublicKey{pubKeyA, pubKeyB},
 	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
 	cm.channels[id] = channel
+	cm.record(channel)
 	return channel, nil
 }
 
+// UpdateChannel обновляет состояние канала id (см. PaymentChannel.UpdateState)
+func (cm *ChannelManager) UpdateChannel(id string, amountA, amountB float64, nonce int, sigA, sigB []byte) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	channel, exists := cm.channels[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrChannelNotFound, id)
+	}
+	if err := channel.UpdateState(amountA, amountB, nonce, sigA, sigB); err != nil {
+		return err
+	}
+	cm.record(channel)
+	return nil
+}
+
+// CloseChannel закрывает канал id итоговым распределением (см. PaymentChannel.Close)
+func (cm *ChannelManager) CloseChannel(id string, settlement *Settlement) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	channel, exists := cm.channels[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrChannelNotFound, id)
+	}
+	if err := channel.Close(settlement); err != nil {
+		return err
+	}
+	cm.record(channel)
+	return nil
+}
+
 // UpdateState — обновляет состояние канала
 func (pc *PaymentChannel) UpdateState(amountA, amountB float64, nonce int, sigA, sigB []byte) error {
 	if nonce != pc.Nonce+1 {
@@ -110,3 +156,148 @@ func (pc *PaymentChannel) Close(settlement *Settlement) error {
 	pc.Settlement = settlement
 	return nil
 }
+
+// SetJournal подключает запись изменений каналов в WAL узла
+func (cm *ChannelManager) SetJournal(journal func(key string, value any)) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.journal = journal
+}
+
+// record сохраняет канал в журнал; вызывается под блокировкой
+func (cm *ChannelManager) record(channel *PaymentChannel) {
+	if cm.journal == nil {
+		return
+	}
+	snapshot, err := newChannelSnapshot(channel)
+	if err != nil {
+		fmt.Printf("❌ Failed to journal channel %s: %v\n", channel.ID, err)
+		return
+	}
+	cm.journal(channel.ID, snapshot)
+}
+
+// channelSnapshot — канал в снимке: публичные ключи в DER (PKIX)
+type channelSnapshot struct {
+	ID           string      `json:"id"`
+	Participants [2]string   `json:"participants"`
+	Deposits     [2]float64  `json:"deposits"`
+	Nonce        int         `json:"nonce"`
+	StateHash    string      `json:"state_hash"`
+	Timeout      time.Time   `json:"timeout"`
+	Settlement   *Settlement `json:"settlement,omitempty"`
+	Signatures   [2][]byte   `json:"signatures"`
+	PublicKeys   [2][]byte   `json:"public_keys"`
+}
+
+func newChannelSnapshot(pc *PaymentChannel) (*channelSnapshot, error) {
+	s := &channelSnapshot{
+		ID:           pc.ID,
+		Participants: pc.Participants,
+		Deposits:     pc.Deposits,
+		Nonce:        pc.Nonce,
+		StateHash:    pc.StateHash,
+		Timeout:      pc.Timeout,
+		Settlement:   pc.Settlement,
+		Signatures:   pc.Signatures,
+	}
+	for i, key := range pc.PublicKeys {
+		if key == nil {
+			continue
+		}
+		der, err := x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return nil, err
+		}
+		s.PublicKeys[i] = der
+	}
+	return s, nil
+}
+
+func (s *channelSnapshot) channel() (*PaymentChannel, error) {
+	pc := &PaymentChannel{
+		ID:           s.ID,
+		Participants: s.Participants,
+		Deposits:     s.Deposits,
+		Nonce:        s.Nonce,
+		StateHash:    s.StateHash,
+		Timeout:      s.Timeout,
+		Settlement:   s.Settlement,
+		Signatures:   s.Signatures,
+	}
+	for i, der := range s.PublicKeys {
+		if len(der) == 0 {
+			continue
+		}
+		key, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", s.ID, err)
+		}
+		ecdsaKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("channel %s: not an ECDSA public key", s.ID)
+		}
+		pc.PublicKeys[i] = ecdsaKey
+	}
+	return pc, nil
+}
+
+// Name — имя платёжных каналов в снимках узла
+func (cm *ChannelManager) Name() string {
+	return "channels"
+}
+
+// Export возвращает каналы в JSON
+func (cm *ChannelManager) Export() ([]byte, error) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+	snapshots := make(map[string]*channelSnapshot, len(cm.channels))
+	for id, channel := range cm.channels {
+		s, err := newChannelSnapshot(channel)
+		if err != nil {
+			return nil, err
+		}
+		snapshots[id] = s
+	}
+	return json.Marshal(snapshots)
+}
+
+// Import заменяет каналы данными снимка
+func (cm *ChannelManager) Import(data []byte) error {
+	var snapshots map[string]*channelSnapshot
+	if err := json.Unmarshal(data, &snapshots); err != nil {
+		return err
+	}
+	channels := make(map[string]*PaymentChannel, len(snapshots))
+	for id, s := range snapshots {
+		channel, err := s.channel()
+		if err != nil {
+			return err
+		}
+		channels[id] = channel
+	}
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.channels = channels
+	return nil
+}
+
+// ApplyRecord применяет изменение канала из WAL
+func (cm *ChannelManager) ApplyRecord(id string, value []byte) error {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	if value == nil {
+		delete(cm.channels, id)
+		return nil
+	}
+	var s channelSnapshot
+	if err := json.Unmarshal(value, &s); err != nil {
+		return err
+	}
+	channel, err := s.channel()
+	if err != nil {
+		return err
+	}
+	cm.channels[id] = channel
+	return nil
+}
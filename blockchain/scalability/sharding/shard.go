@@ -2,6 +2,7 @@ package sharding
 
 import (
 	"blockchain/storage/blockchain"
+	"blockchain/storage/state"
 	"blockchain/storage/txpool"
 	"fmt"
 	"sync"
@@ -13,6 +14,7 @@ type Shard struct {
 	ID         int
 	Validators []string
 	Chain      *blockchain.Blockchain
+	State      *state.StateMachine // состояние счетов поверх Chain
 	TxPool     *txpool.TransactionPool
 	Active     bool // флаг активности шарда (для динамического добавления/удаления)
 }
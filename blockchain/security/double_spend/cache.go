@@ -10,9 +10,14 @@ func (g *DoubleSpendGuard) StartCleanup(interval time.Duration) {
 	go func() {
 		for {
 			<-ticker.C
-			g.mu.Lock()
-			g.seenTransactions = make(map[string]bool)
-			g.mu.Unlock()
+			g.Reset()
 		}
 	}()
 }
+
+// Reset забывает все отмеченные транзакции
+func (g *DoubleSpendGuard) Reset() {
+	g.mu.Lock()
+	g.seenTransactions = make(map[string]bool)
+	g.mu.Unlock()
+}
@@ -26,7 +26,34 @@ func SetAuditor(a *audit.SecurityAuditor) {
 func (g *DoubleSpendGuard) CheckAndMark(txID string) bool {
 	g.mu.Lock()
 	defer g.mu.Unlock()
-	if g.seenTransactions[txID] {
+	if g.seen(txID) {
+		return false // двойная трата
+	}
+	g.seenTransactions[txID] = true
+	return true // уникальная транзакция
+}
+
+// Seen сообщает, встречалась ли транзакция, не отмечая её. Вместе с Mark
+// позволяет отметить транзакцию только после того, как её приняли.
+func (g *DoubleSpendGuard) Seen(txID string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.seen(txID)
+}
+
+// Mark отмечает транзакцию как встреченную
+func (g *DoubleSpendGuard) Mark(txID string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.seenTransactions[txID] = true
+}
+
+// seen вызывается под блокировкой; повтор записывается в журнал аудита
+func (g *DoubleSpendGuard) seen(txID string) bool {
+	if !g.seenTransactions[txID] {
+		return false
+	}
+	if auditor != nil {
 		auditor.RecordEvent(audit.SecurityEvent{
 			Timestamp: time.Now(),
 			Type:      "DoubleSpendAttempt",
@@ -34,10 +61,8 @@ func (g *DoubleSpendGuard) CheckAndMark(txID string) bool {
 			NodeID:    "validator1",
 			Severity:  "WARNING",
 		})
-		return false // двойная трата
 	}
-	g.seenTransactions[txID] = true
-	return true // уникальная транзакция
+	return true
 }
 
 // InitSecurity — инициализирует защиту от двойных трат
@@ -24,6 +24,18 @@ func NewFiftyOnePercentGuard(validators map[string]int64) *FiftyOnePercentGuard
 	}
 }
 
+// SetValidators заменяет набор валидаторов (адрес -> стейк), например при смене эпохи
+func (g *FiftyOnePercentGuard) SetValidators(validators map[string]int64) {
+	var total int64
+	for _, power := range validators {
+		total += power
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ValidatorPower = validators
+	g.TotalPower = total
+}
+
 var auditor *audit.SecurityAuditor
 
 func SetAuditor(a *audit.SecurityAuditor) {
@@ -2,32 +2,86 @@ package sybil
 
 import (
 	"blockchain/security/audit"
-	"crypto/sha256"
+	"net"
 	"sync"
 	"time"
 )
 
+// DefaultMaxNodes — предел числа узлов, не являющихся валидаторами
+const DefaultMaxNodes = 1000
+
+// DefaultMaxPerSubnet — предел числа таких узлов из одной подсети
+// (/24 для IPv4, /64 для IPv6)
+const DefaultMaxPerSubnet = 32
+
+// DefaultNodeTTL — через сколько без повторной регистрации место узла
+// освобождается
+const DefaultNodeTTL = time.Hour
+
+// SybilGuard ограничивает число узлов, не являющихся валидаторами. Узлы
+// опознаются по идентификатору ключа узла (peer.NodeID), поэтому и список
+// валидаторов задаётся идентификаторами их узлов, а не адресами счетов.
 type SybilGuard struct {
-	knownNodes     map[string]bool
+	knownNodes     map[string]knownNode
 	validatorNodes map[string]bool
+	maxNodes       int
+	maxPerSubnet   int
+	ttl            time.Duration
+	now            func() time.Time
 	mu             sync.Mutex
 }
 
+// knownNode — зарегистрированный узел: подсеть его адреса и время
+// последней регистрации
+type knownNode struct {
+	subnet string
+	seen   time.Time
+}
+
+// NewSybilGuard создаёт защиту; validators — идентификаторы узлов валидаторов
 func NewSybilGuard(validators []string) *SybilGuard {
 	vMap := make(map[string]bool)
 	for _, v := range validators {
 		vMap[v] = true
 	}
 	return &SybilGuard{
-		knownNodes:     make(map[string]bool),
+		knownNodes:     make(map[string]knownNode),
 		validatorNodes: vMap,
+		maxNodes:       DefaultMaxNodes,
+		maxPerSubnet:   DefaultMaxPerSubnet,
+		ttl:            DefaultNodeTTL,
+		now:            time.Now,
 	}
 }
 
+// SetMaxNodes задаёт предел числа узлов, не являющихся валидаторами
+func (g *SybilGuard) SetMaxNodes(n int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.maxNodes = n
+}
+
+// SetMaxPerSubnet задаёт предел числа таких узлов из одной подсети
+func (g *SybilGuard) SetMaxPerSubnet(n int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.maxPerSubnet = n
+}
+
+// SetNodeTTL задаёт, через сколько без повторной регистрации место узла
+// освобождается
+func (g *SybilGuard) SetNodeTTL(ttl time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ttl = ttl
+}
+
 func (g *SybilGuard) IsKnownNode(id string) bool {
 	g.mu.Lock()
 	defer g.mu.Unlock()
-	return g.knownNodes[id]
+	g.expire()
+	_, ok := g.knownNodes[id]
+	return ok
 }
 
 var auditor *audit.SecurityAuditor
@@ -36,31 +90,110 @@ func SetAuditor(a *audit.SecurityAuditor) {
 	auditor = a
 }
 
-func (g *SybilGuard) RegisterNode(id string) bool {
+// RegisterNode регистрирует узел id с p2p-адресом addr. Идентификатор —
+// хэш ключа, владение которым узел доказал подписью (peer.PeerManager), но
+// ключи ничего не стоят, поэтому число узлов, не являющихся валидаторами,
+// ограничено и в целом, и для одной подсети. Место узла освобождает
+// RemoveNode или отсутствие повторной регистрации дольше TTL.
+func (g *SybilGuard) RegisterNode(id, addr string) bool {
 	if g.IsValidator(id) {
 		return true
 	}
-	if g.IsKnownNode(id) {
-		return true
+	subnet := subnetOf(addr)
+	g.mu.Lock()
+	g.expire()
+	if node, ok := g.knownNodes[id]; ok && node.subnet != subnet {
+		delete(g.knownNodes, id)
+	}
+	_, known := g.knownNodes[id]
+	reason := ""
+	switch {
+	case known:
+	case len(g.knownNodes) >= g.maxNodes:
+		reason = "node limit reached"
+	case g.inSubnet(subnet) >= g.maxPerSubnet:
+		reason = "subnet limit reached for " + subnet
+	}
+	if reason == "" {
+		g.knownNodes[id] = knownNode{subnet: subnet, seen: g.now()}
 	}
-	hash := sha256.Sum256([]byte(id))
-	if hash[0] < 10 {
-		g.mu.Lock()
-		defer g.mu.Unlock()
-		g.knownNodes[id] = true
+	g.mu.Unlock()
+	if reason == "" {
 		return true
-	} else {
+	}
+	if auditor != nil {
 		auditor.RecordEvent(audit.SecurityEvent{
 			Timestamp: time.Now(),
 			Type:      "SybilNodeRejected",
-			Message:   "Sybil node registration rejected: " + id,
+			Message:   "Sybil node registration rejected, " + reason + ": " + id,
 			NodeID:    "validator1",
 			Severity:  "WARNING",
 		})
-		return false
+	}
+	return false
+}
+
+// RemoveNode освобождает место отключившегося узла
+func (g *SybilGuard) RemoveNode(id string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.knownNodes, id)
+}
+
+// expire удаляет узлы, не регистрировавшиеся дольше TTL; вызывается под
+// блокировкой
+func (g *SybilGuard) expire() {
+	deadline := g.now().Add(-g.ttl)
+	for id, node := range g.knownNodes {
+		if node.seen.Before(deadline) {
+			delete(g.knownNodes, id)
+		}
 	}
 }
 
+// inSubnet возвращает число узлов подсети; вызывается под блокировкой
+func (g *SybilGuard) inSubnet(subnet string) int {
+	count := 0
+	for _, node := range g.knownNodes {
+		if node.subnet == subnet {
+			count++
+		}
+	}
+	return count
+}
+
+// subnetOf возвращает подсеть хоста адреса: /24 для IPv4, /64 для IPv6.
+// Имя хоста, не являющееся IP, считается отдельной подсетью.
+func subnetOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return host
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return (&net.IPNet{IP: ip4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+	return (&net.IPNet{IP: ip.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
+
+// IsValidator сообщает, принадлежит ли узел id валидатору
 func (g *SybilGuard) IsValidator(id string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
 	return g.validatorNodes[id]
 }
+
+// SetValidators заменяет идентификаторы узлов валидаторов, например при
+// смене эпохи
+func (g *SybilGuard) SetValidators(validators []string) {
+	vMap := make(map[string]bool, len(validators))
+	for _, v := range validators {
+		vMap[v] = true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.validatorNodes = vMap
+}
@@ -0,0 +1,64 @@
+package sybil
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// TestSybilGuard_Limits - узлы валидаторов узнаются по идентификатору узла и
+// проходят без ограничений, остальные ограничены в целом и по подсети
+func TestSybilGuard_Limits(t *testing.T) {
+	g := NewSybilGuard([]string{"validator-node"})
+	g.SetMaxNodes(3)
+	g.SetMaxPerSubnet(2)
+
+	if !g.RegisterNode("a", "10.0.0.1:27656") || !g.RegisterNode("b", "10.0.0.2:27656") {
+		t.Fatal("Expected the first two nodes of a subnet to be admitted")
+	}
+	if g.RegisterNode("c", "10.0.0.3:27656") {
+		t.Error("Expected a third node of the same /24 to be rejected")
+	}
+	if !g.RegisterNode("c", "10.0.1.3:27656") {
+		t.Error("Expected a node of another subnet to be admitted")
+	}
+	if g.RegisterNode("d", "10.0.2.4:27656") {
+		t.Error("Expected the total limit to reject a new node")
+	}
+	if !g.RegisterNode("a", "10.0.0.1:27656") {
+		t.Error("Expected a known node to be admitted again")
+	}
+	if !g.RegisterNode("validator-node", "10.0.0.5:27656") || g.IsKnownNode("validator-node") {
+		t.Error("Expected the validator node to bypass the limits without taking a slot")
+	}
+}
+
+// TestSybilGuard_FreesSlots - место освобождают отключение и отсутствие
+// повторной регистрации дольше TTL
+func TestSybilGuard_FreesSlots(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	g := NewSybilGuard(nil)
+	g.now = func() time.Time { return now }
+	g.SetMaxNodes(2)
+	for i := 0; i < 2; i++ {
+		g.RegisterNode(fmt.Sprintf("n%d", i), fmt.Sprintf("10.0.%d.1:27656", i))
+	}
+	if g.RegisterNode("late", "10.0.9.1:27656") {
+		t.Fatal("Expected the guard to be full")
+	}
+
+	g.RemoveNode("n0")
+	if !g.RegisterNode("late", "10.0.9.1:27656") {
+		t.Fatal("Expected a disconnected node to free its slot")
+	}
+
+	now = now.Add(DefaultNodeTTL / 2)
+	g.RegisterNode("late", "10.0.9.1:27656")
+	now = now.Add(DefaultNodeTTL/2 + time.Second)
+	if g.IsKnownNode("n1") || !g.IsKnownNode("late") {
+		t.Error("Expected only the stale node to expire")
+	}
+	if !g.RegisterNode("fresh", "10.0.8.1:27656") {
+		t.Error("Expected the expired slot to be reused")
+	}
+}
@@ -1,12 +1,12 @@
 package blockchain
 
 import (
-	"bytes"
 	"crypto/sha256"
-	"encoding/gob"
 	"fmt"
 	"time"
 
+	"blockchain/codec"
+	"blockchain/crypto/merkle"
 	"blockchain/storage/txpool"
 )
 
@@ -18,7 +18,19 @@ type Block struct {
 	Transactions []*txpool.Transaction `json:"transactions"`
 	Validator    string                `json:"validator"`
 	Nonce        string                `json:"nonce"`
-	Signature    []byte                `json:"signature"`
+	StateRoot    string                `json:"state_root"` // корень состояния счетов после применения блока
+	BaseFee      float64               `json:"base_fee"`   // базовая комиссия блока, см. NextBaseFee
+	// Хэш набора валидаторов следующей высоты (pos.ValidatorPool.Hash);
+	// меняется только в блоке, завершающем эпоху
+	NextValidatorsHash string `json:"next_validators_hash,omitempty"`
+	// Сертификат финальности предыдущего блока; входит в заголовок
+	LastCommit *Commit `json:"last_commit,omitempty"`
+	// Доказательства нарушений валидаторов; входят в заголовок
+	Evidence  []*Evidence `json:"evidence,omitempty"`
+	Signature []byte      `json:"signature"`
+	// Сертификат финальности самого блока: известен только после решения
+	// консенсуса, поэтому хранится с блоком, но не входит в его хэш
+	Commit *Commit `json:"commit,omitempty"`
 }
 
 func NewBlock(index int64, prevHash string, transactions []*txpool.Transaction, validator string) *Block {
@@ -33,69 +45,109 @@ func NewBlock(index int64, prevHash string, transactions []*txpool.Transaction,
 	return block
 }
 
+// CalculateHash возвращает хэш канонического заголовка блока
 func (b *Block) CalculateHash() string {
-	hashData := fmt.Sprintf("%d:%d:%s:%s:%s:%x",
-		b.Index,
-		b.Timestamp,
-		b.PrevHash,
-		b.TransactionsHash(),
-		b.Validator,
-		b.Nonce,
-	)
-	hash := sha256.Sum256([]byte(hashData))
+	hash := sha256.Sum256(b.SerializeWithoutSignature())
 	return fmt.Sprintf("%x", hash)
 }
 
+// TransactionsHash возвращает корень дерева Меркла по каноническим хэшам транзакций
 func (b *Block) TransactionsHash() string {
-	// Упрощённый способ хэширования транзакций
-	// В реальной системе используйте Merkle Tree
-	var txHashes string
-	for _, tx := range b.Transactions {
-		txHashes += tx.ID
+	return fmt.Sprintf("%x", merkle.Root(b.txLeaves()))
+}
+
+func (b *Block) txLeaves() [][]byte {
+	leaves := make([][]byte, len(b.Transactions))
+	for i, tx := range b.Transactions {
+		leaves[i] = tx.Hash()
 	}
-	hash := sha256.Sum256([]byte(txHashes))
-	return fmt.Sprintf("%x", hash)
+	return leaves
 }
 
+// Serialize кодирует блок целиком (для хранения и передачи по сети)
 func (b *Block) Serialize() []byte {
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	if err := enc.Encode(b); err != nil {
-		panic(err)
+	w := codec.NewWriter(codec.KindBlock)
+	w.Int64(b.Index)
+	w.Int64(b.Timestamp)
+	w.String(b.PrevHash)
+	w.String(b.Hash)
+	w.Len(len(b.Transactions))
+	for _, tx := range b.Transactions {
+		w.Bytes(tx.Encode())
 	}
-	return buf.Bytes()
+	w.String(b.Validator)
+	w.String(b.Nonce)
+	w.String(b.StateRoot)
+	w.Float64(b.BaseFee)
+	w.String(b.NextValidatorsHash)
+	w.Bytes(encodeCommit(b.LastCommit))
+	writeEvidence(w, b.Evidence)
+	w.Bytes(b.Signature)
+	w.Bytes(encodeCommit(b.Commit))
+	return w.Result()
 }
 
+// Deserialize восстанавливает блок, закодированный Serialize
 func (b *Block) Deserialize(data []byte) error {
-	buf := bytes.NewBuffer(data)
-	dec := gob.NewDecoder(buf)
-	return dec.Decode(b)
-}
-
-type BlockWithoutSignature struct {
-	Index        int64
-	Timestamp    int64
-	PrevHash     string
-	Hash         string
-	Transactions []*txpool.Transaction
-	Validator    string
-	Nonce        string
+	r, err := codec.NewReader(data, codec.KindBlock)
+	if err != nil {
+		return err
+	}
+	decoded := Block{
+		Index:     r.Int64(),
+		Timestamp: r.Int64(),
+		PrevHash:  r.String(),
+		Hash:      r.String(),
+	}
+	count := r.Count(4) // транзакция — поле байтов с длиной u32
+	decoded.Transactions = make([]*txpool.Transaction, 0, count)
+	for i := 0; i < count && r.Err() == nil; i++ {
+		tx, err := txpool.DecodeTransaction(r.Bytes())
+		if err != nil {
+			return fmt.Errorf("failed to decode block transaction %d: %w", i, err)
+		}
+		decoded.Transactions = append(decoded.Transactions, tx)
+	}
+	decoded.Validator = r.String()
+	decoded.Nonce = r.String()
+	decoded.StateRoot = r.String()
+	decoded.BaseFee = r.Float64()
+	decoded.NextValidatorsHash = r.String()
+	lastCommit := r.Bytes()
+	evidence := readEvidence(r)
+	decoded.Signature = r.Bytes()
+	commit := r.Bytes()
+	if err := r.Finish(); err != nil {
+		return fmt.Errorf("failed to decode block: %w", err)
+	}
+	if decoded.Evidence, err = decodeEvidenceList(evidence); err != nil {
+		return fmt.Errorf("failed to decode block evidence: %w", err)
+	}
+	if decoded.LastCommit, err = decodeCommit(lastCommit); err != nil {
+		return fmt.Errorf("failed to decode block last commit: %w", err)
+	}
+	if decoded.Commit, err = decodeCommit(commit); err != nil {
+		return fmt.Errorf("failed to decode block commit: %w", err)
+	}
+	*b = decoded
+	return nil
 }
 
+// SerializeWithoutSignature кодирует заголовок блока: все поля, кроме хэша,
+// подписи и собственного сертификата, а транзакции — корнем дерева Меркла.
+// По нему вычисляется хэш блока, и его же подписывает валидатор.
 func (b *Block) SerializeWithoutSignature() []byte {
-	temp := BlockWithoutSignature{
-		Index:        b.Index,
-		Timestamp:    b.Timestamp,
-		PrevHash:     b.PrevHash,
-		Hash:         b.Hash,
-		Transactions: b.Transactions,
-		Validator:    b.Validator,
-		Nonce:        b.Nonce,
-	}
-	var buf bytes.Buffer
-	enc := gob.NewEncoder(&buf)
-	if err := enc.Encode(temp); err != nil {
-		panic(err)
-	}
-	return buf.Bytes()
+	w := codec.NewWriter(codec.KindBlockHeader)
+	w.Int64(b.Index)
+	w.Int64(b.Timestamp)
+	w.String(b.PrevHash)
+	w.Bytes(merkle.Root(b.txLeaves()))
+	w.String(b.Validator)
+	w.String(b.Nonce)
+	w.String(b.StateRoot)
+	w.Float64(b.BaseFee)
+	w.String(b.NextValidatorsHash)
+	w.Bytes(encodeCommit(b.LastCommit))
+	writeEvidence(w, b.Evidence)
+	return w.Result()
 }
@@ -0,0 +1,57 @@
+package blockchain
+
+import (
+	"errors"
+	"testing"
+
+	"blockchain/codec"
+)
+
+// oversizedList возвращает запись kind с полями head и списком, число
+// элементов которого заявлено максимальным
+func oversizedList(kind codec.Kind, head func(w *codec.Writer)) []byte {
+	w := codec.NewWriter(kind)
+	head(w)
+	w.Len(codec.MaxFieldSize)
+	return w.Result()
+}
+
+// TestDecode_OversizedCount - заявленное число элементов, которое не
+// помещается в запись, отклоняется без выделения памяти под список
+func TestDecode_OversizedCount(t *testing.T) {
+	block := oversizedList(codec.KindBlock, func(w *codec.Writer) {
+		w.Int64(1)
+		w.Int64(0)
+		w.String("prev")
+		w.String("hash")
+	})
+	if err := (&Block{}).Deserialize(block); !errors.Is(err, codec.ErrTruncated) {
+		t.Errorf("Expected ErrTruncated for block transactions, got %v", err)
+	}
+
+	commit := oversizedList(codec.KindCommit, func(w *codec.Writer) {
+		w.Int64(1)
+		w.Int64(0)
+		w.String("hash")
+	})
+	if _, err := DecodeCommit(commit); !errors.Is(err, codec.ErrTruncated) {
+		t.Errorf("Expected ErrTruncated for commit signatures, got %v", err)
+	}
+
+	evidence := oversizedList(codec.KindBlock, func(w *codec.Writer) {
+		w.Int64(1)
+		w.Int64(0)
+		w.String("prev")
+		w.String("hash")
+		w.Len(0) // транзакции
+		w.String("validator")
+		w.String("")
+		w.String("root")
+		w.Float64(0)
+		w.String("")
+		w.Bytes(nil) // LastCommit
+	})
+	if err := (&Block{}).Deserialize(evidence); !errors.Is(err, codec.ErrTruncated) {
+		t.Errorf("Expected ErrTruncated for block evidence, got %v", err)
+	}
+}
@@ -8,29 +8,88 @@ import (
 )
 
 type Blockchain struct {
-	Blocks []*Block
-	mu     sync.Mutex
+	store BlockStore
+	index *chainIndex
+	fees  *FeeConfig
+	mu    sync.RWMutex
 }
 
+// NewBlockchain создаёт цепочку в памяти, начиная с генезиса с параметрами
+// комиссий по умолчанию
 func NewBlockchain() *Blockchain {
-	return &Blockchain{
-		Blocks: []*Block{NewGenesisBlock()},
+	bc, err := NewBlockchainWithStore(NewMemoryBlockStore(), nil)
+	if err != nil {
+		// Хранилище в памяти не отказывает при записи генезиса
+		panic("failed to create in-memory chain: " + err.Error())
+	}
+	return bc
+}
+
+// NewBlockchainWithStore создаёт цепочку поверх хранилища блоков с
+// параметрами комиссий fees из генезиса сети (nil — DefaultFeeConfig).
+// Если в хранилище уже есть блоки, цепочка продолжается с сохранённой
+// вершины, а индексы транзакций перестраиваются по сохранённым блокам.
+func NewBlockchainWithStore(store BlockStore, fees *FeeConfig) (*Blockchain, error) {
+	if store == nil {
+		return nil, fmt.Errorf("nil block store")
+	}
+	if fees == nil {
+		fees = DefaultFeeConfig()
+	}
+	if store.Height() < 0 {
+		if err := store.Append(NewGenesisBlock(fees)); err != nil {
+			return nil, fmt.Errorf("failed to store genesis block: %w", err)
+		}
+	} else {
+		fmt.Printf("📦 Restored chain from block store, height %d\n", store.Height())
 	}
+
+	bc := &Blockchain{
+		store: store,
+		index: newChainIndex(),
+		fees:  fees,
+	}
+	err := store.Iterate(0, store.Height(), func(block *Block) bool {
+		bc.index.addBlock(block)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to index stored blocks: %w", err)
+	}
+	return bc, nil
+}
+
+// NewGenesisBlock создаёт генезис-блок с начальной базовой комиссией fees
+func NewGenesisBlock(fees *FeeConfig) *Block {
+	block := NewBlock(0, "0", []*txpool.Transaction{}, "genesis")
+	block.BaseFee = fees.InitialBaseFee
+	block.Hash = block.CalculateHash()
+	return block
+}
+
+// Fees возвращает параметры комиссий цепочки
+func (bc *Blockchain) Fees() *FeeConfig {
+	return bc.fees
 }
 
-func NewGenesisBlock() *Block {
-	return NewBlock(0, "0", []*txpool.Transaction{}, "genesis")
+// Store возвращает хранилище, в котором лежат блоки цепочки
+func (bc *Blockchain) Store() BlockStore {
+	return bc.store
 }
 
-func (bc *Blockchain) AddBlock(block *Block) {
+func (bc *Blockchain) AddBlock(block *Block) error {
 	bc.mu.Lock()
 	defer bc.mu.Unlock()
 
 	if bc.HasBlock(block.Hash) {
-		return
+		return nil
 	}
 
-	bc.Blocks = append(bc.Blocks, block)
+	if err := bc.store.Append(block); err != nil {
+		return err
+	}
+	bc.index.addBlock(block)
+	return nil
 }
 
 func (bc *Blockchain) GetBlockByNumber(blockNumber interface{}) *Block {
@@ -47,24 +106,101 @@ func (bc *Blockchain) GetBlockByNumber(blockNumber interface{}) *Block {
 		return nil
 	}
 
-	for _, block := range bc.Blocks {
-		if block.Index == num {
-			return block
-		}
+	return bc.GetBlockByHeight(num)
+}
+
+// GetBlockByHeight возвращает блок по высоте или nil
+func (bc *Blockchain) GetBlockByHeight(height int64) *Block {
+	block, err := bc.store.GetByHeight(height)
+	if err != nil {
+		return nil
 	}
-	return nil
+	return block
 }
+
 func (bc *Blockchain) GetLatestBlock() *Block {
-	if len(bc.Blocks) == 0 {
+	block, err := bc.store.Latest()
+	if err != nil {
 		return nil
 	}
-	return bc.Blocks[len(bc.Blocks)-1]
+	return block
+}
+
+// Height возвращает высоту вершины цепочки
+func (bc *Blockchain) Height() int64 {
+	return bc.store.Height()
 }
+
+// GetBlocks возвращает блоки в диапазоне высот [from, to]
+func (bc *Blockchain) GetBlocks(from, to int64) []*Block {
+	var blocks []*Block
+	bc.store.Iterate(from, to, func(b *Block) bool {
+		blocks = append(blocks, b)
+		return true
+	})
+	return blocks
+}
+
 func (chain *Blockchain) HasBlock(hash string) bool {
-	for _, b := range chain.Blocks {
-		if b.Hash == hash {
-			return true
+	_, err := chain.store.GetByHash(hash)
+	return err == nil
+}
+
+// GetBlockByHash возвращает блок канонической цепочки по хэшу или nil
+func (bc *Blockchain) GetBlockByHash(hash string) *Block {
+	block, err := bc.store.GetByHash(hash)
+	if err != nil {
+		return nil
+	}
+	return block
+}
+
+// GetTransaction возвращает транзакцию канонической цепочки по ID или nil
+func (bc *Blockchain) GetTransaction(txID string) *TxRecord {
+	loc, ok := bc.index.location(txID)
+	if !ok {
+		return nil
+	}
+	block := bc.GetBlockByHeight(loc.BlockIndex)
+	if block == nil || block.Hash != loc.BlockHash || loc.Position >= len(block.Transactions) {
+		return nil
+	}
+	return &TxRecord{Transaction: block.Transactions[loc.Position], TxLocation: loc}
+}
+
+// GetAddressHistory возвращает до limit транзакций адреса (отправленных и
+// полученных) в порядке включения в цепочку, начиная с позиции cursor,
+// и курсор следующей страницы. Страница короче limit означает конец истории.
+func (bc *Blockchain) GetAddressHistory(address string, cursor, limit int) ([]*TxRecord, int) {
+	if cursor < 0 {
+		cursor = 0
+	}
+	ids := bc.index.addressPage(address, cursor, limit)
+	records := make([]*TxRecord, 0, len(ids))
+	for _, id := range ids {
+		if record := bc.GetTransaction(id); record != nil {
+			records = append(records, record)
 		}
 	}
-	return false
+	return records, cursor + len(ids)
+}
+
+// Rewind откатывает каноническую цепочку до высоты height
+func (bc *Blockchain) Rewind(height int64) error {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	removed := bc.GetBlocks(height+1, bc.store.Height())
+	if err := bc.store.Rewind(height); err != nil {
+		return err
+	}
+	for i := len(removed) - 1; i >= 0; i-- {
+		bc.index.removeBlock(removed[i])
+	}
+	return nil
+}
+
+// Close закрывает хранилище блоков
+func (bc *Blockchain) Close() error {
+	return bc.store.Close()
 }
@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	"fmt"
+
+	"blockchain/codec"
+)
+
+// CommitSig — подпись precommit одного валидатора за блок
+type CommitSig struct {
+	ValidatorIndex int    `json:"validator_index"`
+	Validator      string `json:"validator"`
+	Timestamp      int64  `json:"timestamp"`
+	Signature      []byte `json:"signature"`
+}
+
+// Commit — сертификат финальности блока: precommit валидаторов, набравших
+// больше 2/3 мощности за BlockHash в раунде Round. Каждая подпись покрывает
+// те же данные, что и голос консенсуса (см. gossip.VoteSignBytes), поэтому
+// сертификат проверяется без доверия к узлу, который его отдал.
+type Commit struct {
+	Height     int64       `json:"height"`
+	Round      int64       `json:"round"`
+	BlockHash  string      `json:"block_hash"`
+	Signatures []CommitSig `json:"signatures"`
+}
+
+// Encode кодирует сертификат в каноническом формате
+func (c *Commit) Encode() []byte {
+	w := codec.NewWriter(codec.KindCommit)
+	w.Int64(c.Height)
+	w.Int64(c.Round)
+	w.String(c.BlockHash)
+	w.Len(len(c.Signatures))
+	for _, sig := range c.Signatures {
+		w.Int64(int64(sig.ValidatorIndex))
+		w.String(sig.Validator)
+		w.Int64(sig.Timestamp)
+		w.Bytes(sig.Signature)
+	}
+	return w.Result()
+}
+
+// commitSigMinSize — наименьший размер закодированной подписи сертификата:
+// индекс, метка времени и длины адреса и подписи
+const commitSigMinSize = 8 + 4 + 8 + 4
+
+// DecodeCommit восстанавливает сертификат, закодированный Encode
+func DecodeCommit(data []byte) (*Commit, error) {
+	r, err := codec.NewReader(data, codec.KindCommit)
+	if err != nil {
+		return nil, err
+	}
+	c := &Commit{
+		Height:    r.Int64(),
+		Round:     r.Int64(),
+		BlockHash: r.String(),
+	}
+	count := r.Count(commitSigMinSize)
+	c.Signatures = make([]CommitSig, 0, count)
+	for i := 0; i < count && r.Err() == nil; i++ {
+		c.Signatures = append(c.Signatures, CommitSig{
+			ValidatorIndex: int(r.Int64()),
+			Validator:      r.String(),
+			Timestamp:      r.Int64(),
+			Signature:      r.Bytes(),
+		})
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode commit: %w", err)
+	}
+	return c, nil
+}
+
+// encodeCommit кодирует необязательный сертификат: отсутствие — пустое поле
+func encodeCommit(c *Commit) []byte {
+	if c == nil {
+		return nil
+	}
+	return c.Encode()
+}
+
+// decodeCommit восстанавливает необязательный сертификат
+func decodeCommit(data []byte) (*Commit, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return DecodeCommit(data)
+}
@@ -0,0 +1,120 @@
+package blockchain
+
+import (
+	"bytes"
+	"fmt"
+
+	"blockchain/codec"
+)
+
+// EvidenceType — вид нарушения валидатора
+type EvidenceType string
+
+const (
+	// DuplicateVote — два разных голоса одного типа в одном раунде
+	DuplicateVote EvidenceType = "duplicate_vote"
+	// ConflictingProposal — два разных предложения блока в одном раунде
+	ConflictingProposal EvidenceType = "conflicting_proposal"
+)
+
+// SignedData — подписанные данные сообщения консенсуса
+type SignedData struct {
+	Data      []byte `json:"data"`
+	Signature []byte `json:"signature"`
+}
+
+// Evidence — доказательство того, что Validator подписал два противоречащих
+// сообщения на высоте Height в раунде Round. A и B — канонические данные
+// голосов (gossip.VoteSignBytes) или предложений (gossip.ProposalSignBytes)
+// с подписями, поэтому доказательство проверяется без доверия к узлу,
+// который его прислал.
+type Evidence struct {
+	Type      EvidenceType `json:"type"`
+	Height    int64        `json:"height"`
+	Round     int64        `json:"round"`
+	Validator string       `json:"validator"`
+	A         SignedData   `json:"a"`
+	B         SignedData   `json:"b"`
+}
+
+// NewEvidence создаёт доказательство; сообщения упорядочиваются, чтобы
+// узлы, заметившие нарушение независимо, получили одинаковое доказательство
+func NewEvidence(evType EvidenceType, height, round int64, validator string, a, b SignedData) *Evidence {
+	if bytes.Compare(a.Data, b.Data) > 0 {
+		a, b = b, a
+	}
+	return &Evidence{Type: evType, Height: height, Round: round, Validator: validator, A: a, B: b}
+}
+
+// Key идентифицирует нарушение: одно нарушение наказывается один раз
+func (e *Evidence) Key() string {
+	return fmt.Sprintf("%s/%d/%d/%s", e.Type, e.Height, e.Round, e.Validator)
+}
+
+// Encode кодирует доказательство в каноническом формате
+func (e *Evidence) Encode() []byte {
+	w := codec.NewWriter(codec.KindEvidence)
+	w.String(string(e.Type))
+	w.Int64(e.Height)
+	w.Int64(e.Round)
+	w.String(e.Validator)
+	w.Bytes(e.A.Data)
+	w.Bytes(e.A.Signature)
+	w.Bytes(e.B.Data)
+	w.Bytes(e.B.Signature)
+	return w.Result()
+}
+
+// DecodeEvidence восстанавливает доказательство, закодированное Encode
+func DecodeEvidence(data []byte) (*Evidence, error) {
+	r, err := codec.NewReader(data, codec.KindEvidence)
+	if err != nil {
+		return nil, err
+	}
+	e := &Evidence{
+		Type:      EvidenceType(r.String()),
+		Height:    r.Int64(),
+		Round:     r.Int64(),
+		Validator: r.String(),
+		A:         SignedData{Data: r.Bytes(), Signature: r.Bytes()},
+		B:         SignedData{Data: r.Bytes(), Signature: r.Bytes()},
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode evidence: %w", err)
+	}
+	return e, nil
+}
+
+// writeEvidence записывает список доказательств блока
+func writeEvidence(w *codec.Writer, evidence []*Evidence) {
+	w.Len(len(evidence))
+	for _, e := range evidence {
+		w.Bytes(e.Encode())
+	}
+}
+
+// readEvidence читает закодированные доказательства блока
+func readEvidence(r *codec.Reader) [][]byte {
+	count := r.Count(4) // доказательство — поле байтов с длиной u32
+	encoded := make([][]byte, 0, count)
+	for i := 0; i < count && r.Err() == nil; i++ {
+		encoded = append(encoded, r.Bytes())
+	}
+	return encoded
+}
+
+// decodeEvidenceList восстанавливает доказательства, прочитанные readEvidence
+func decodeEvidenceList(encoded [][]byte) ([]*Evidence, error) {
+	if len(encoded) == 0 {
+		return nil, nil
+	}
+	evidence := make([]*Evidence, len(encoded))
+	for i, data := range encoded {
+		e, err := DecodeEvidence(data)
+		if err != nil {
+			return nil, fmt.Errorf("evidence %d: %w", i, err)
+		}
+		evidence[i] = e
+	}
+	return evidence, nil
+}
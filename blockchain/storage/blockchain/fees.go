@@ -0,0 +1,142 @@
+package blockchain
+
+// рынок комиссий: базовая комиссия блока по модели EIP-1559
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+var (
+	ErrInvalidBaseFee = errors.New("invalid block base fee")
+	ErrBlockTooLarge  = errors.New("block has too many transactions")
+)
+
+// FeeConfig — параметры рынка комиссий. Задаются генезисом сети и должны
+// совпадать у всех валидаторов: базовая комиссия входит в заголовок блока,
+// а казначейство — в корень состояния, и оба проверяются при импорте.
+type FeeConfig struct {
+	InitialBaseFee    float64 `json:"initial_base_fee"`     // базовая комиссия генезиса
+	MinBaseFee        float64 `json:"min_base_fee"`         // нижняя граница базовой комиссии
+	TargetTxsPerBlock int     `json:"target_txs_per_block"` // целевая заполненность блока
+	MaxTxsPerBlock    int     `json:"max_txs_per_block"`    // максимальное число транзакций в блоке
+	ChangeDenominator float64 `json:"change_denominator"`   // базовая комиссия меняется не более чем на 1/ChangeDenominator за блок
+	Treasury          string  `json:"treasury,omitempty"`   // адрес казначейства для базовой комиссии; пусто — комиссия сжигается
+}
+
+func DefaultFeeConfig() *FeeConfig {
+	return &FeeConfig{
+		InitialBaseFee:    0.001,
+		MinBaseFee:        0.0001,
+		TargetTxsPerBlock: 100,
+		MaxTxsPerBlock:    200,
+		ChangeDenominator: 8,
+	}
+}
+
+// NextBaseFee возвращает базовую комиссию блока, следующего за parent:
+// растёт, если parent заполнен больше целевого, и снижается, если меньше
+func (cfg *FeeConfig) NextBaseFee(parent *Block) float64 {
+	return adjustBaseFee(parent.BaseFee, len(parent.Transactions), cfg)
+}
+
+func adjustBaseFee(baseFee float64, used int, cfg *FeeConfig) float64 {
+	if cfg.TargetTxsPerBlock <= 0 || cfg.ChangeDenominator <= 0 {
+		return math.Max(baseFee, cfg.MinBaseFee)
+	}
+	target := float64(cfg.TargetTxsPerBlock)
+	delta := (float64(used) - target) / target / cfg.ChangeDenominator
+	return math.Max(baseFee*(1+delta), cfg.MinBaseFee)
+}
+
+// TotalTips возвращает сумму надбавок валидатору в блоке
+func (b *Block) TotalTips() float64 {
+	var total float64
+	for _, tx := range b.Transactions {
+		total += tx.EffectiveTip(b.BaseFee)
+	}
+	return total
+}
+
+// FeeEstimate — рекомендуемые комиссии для включения в течение TargetBlocks блоков
+type FeeEstimate struct {
+	TargetBlocks int     `json:"target_blocks"`
+	BaseFee      float64 `json:"base_fee"` // наибольшая ожидаемая базовая комиссия за TargetBlocks блоков
+	Tip          float64 `json:"tip"`
+	MaxFee       float64 `json:"max_fee"` // значение для поля Fee транзакции
+}
+
+// feeHistoryBlocks — по скольким последним блокам оцениваются надбавки
+const feeHistoryBlocks = 20
+
+// feeTargets — цели подтверждения и перцентиль надбавок недавних блоков для каждой
+var feeTargets = []struct {
+	blocks     int
+	percentile float64
+}{
+	{1, 0.9},
+	{3, 0.5},
+	{10, 0.1},
+}
+
+// EstimateFees рекомендует комиссии по недавним блокам и загрузке мемпула.
+// Базовая комиссия прогнозируется так, как если бы pending транзакций пула
+// включались в блоки максимального размера, а надбавка берётся как перцентиль
+// фактических надбавок в последних блоках.
+func EstimateFees(chain *Blockchain, pending int) []FeeEstimate {
+	cfg := chain.Fees()
+	latest := chain.GetLatestBlock()
+	if latest == nil {
+		return nil
+	}
+
+	var tips []float64
+	from := latest.Index - feeHistoryBlocks + 1
+	if from < 1 {
+		from = 1
+	}
+	for _, block := range chain.GetBlocks(from, latest.Index) {
+		for _, tx := range block.Transactions {
+			tips = append(tips, tx.EffectiveTip(block.BaseFee))
+		}
+	}
+	sort.Float64s(tips)
+
+	estimates := make([]FeeEstimate, 0, len(feeTargets))
+	baseFee := cfg.NextBaseFee(latest)
+	highest := baseFee
+	queue := pending
+	projected := 1
+	for _, target := range feeTargets {
+		for ; projected < target.blocks; projected++ {
+			used := queue
+			if cfg.MaxTxsPerBlock > 0 && used > cfg.MaxTxsPerBlock {
+				used = cfg.MaxTxsPerBlock
+			}
+			queue -= used
+			baseFee = adjustBaseFee(baseFee, used, cfg)
+			highest = math.Max(highest, baseFee)
+		}
+		tip := percentile(tips, target.percentile)
+		estimates = append(estimates, FeeEstimate{
+			TargetBlocks: target.blocks,
+			BaseFee:      highest,
+			Tip:          tip,
+			MaxFee:       highest + tip,
+		})
+	}
+	return estimates
+}
+
+// percentile возвращает перцентиль p отсортированного списка; для пустого — 0
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
@@ -0,0 +1,621 @@
+package blockchain
+
+// файловое append-only хранилище блоков
+//
+// Формат на диске:
+//   segment-NNNNNN.log — записи вида [длина uint32][crc32 uint32][блок]
+//   index.log          — записи фиксированного размера, по одной на высоту:
+//                        [сегмент uint32][смещение uint64][длина uint32][sha256(хэш блока)]
+//
+// Сегменты — источник истины: индекс при открытии сверяется с ними и
+// достраивается, а оборванная последняя запись последнего сегмента (как и
+// нули, которыми файл мог продлиться при падении) отрезается. Повреждение в середине данных не исправляется: хранилище
+// не открывается, чтобы не потерять записанные после него блоки.
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	recordHeaderSize = 8
+	indexEntrySize   = 4 + 8 + 4 + sha256.Size
+	segmentPrefix    = "segment-"
+	segmentSuffix    = ".log"
+	indexFileName    = "index.log"
+)
+
+var (
+	// ErrCorruptRecord — запись сегмента повреждена не в хвосте
+	ErrCorruptRecord = errors.New("corrupt block record")
+
+	errTornRecord  = errors.New("torn record")
+	errBadChecksum = errors.New("record checksum mismatch")
+	errBadPayload  = errors.New("undecodable record")
+)
+
+// FileStoreConfig — настройки файлового хранилища
+type FileStoreConfig struct {
+	MaxSegmentSize int64 // размер сегмента, после которого начинается новый
+	SyncWrites     bool  // fsync после каждой записи блока
+}
+
+// DefaultFileStoreConfig возвращает конфигурацию по умолчанию
+func DefaultFileStoreConfig() *FileStoreConfig {
+	return &FileStoreConfig{
+		MaxSegmentSize: 64 * 1024 * 1024,
+		SyncWrites:     true,
+	}
+}
+
+type indexEntry struct {
+	Segment uint32
+	Offset  int64
+	Length  uint32
+	HashKey [sha256.Size]byte
+}
+
+// FileBlockStore — хранилище блоков в сегментных файлах с индексом по высоте
+type FileBlockStore struct {
+	dir      string
+	config   *FileStoreConfig
+	segments map[uint32]*os.File
+	active   uint32
+	size     int64 // размер активного сегмента
+	index    *os.File
+	entries  []indexEntry
+	byHash   map[[sha256.Size]byte]int64
+	latest   *Block
+	closed   bool
+	mu       sync.RWMutex
+}
+
+// OpenFileBlockStore открывает (или создаёт) хранилище в каталоге dir
+// и восстанавливает его после аварийного завершения
+func OpenFileBlockStore(dir string, config *FileStoreConfig) (*FileBlockStore, error) {
+	if config == nil {
+		config = DefaultFileStoreConfig()
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create store dir: %w", err)
+	}
+
+	s := &FileBlockStore{
+		dir:      dir,
+		config:   config,
+		segments: make(map[uint32]*os.File),
+		byHash:   make(map[[sha256.Size]byte]int64),
+	}
+	if err := s.recover(); err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+	return s, nil
+}
+
+func hashKey(hash string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(hash))
+}
+
+func (s *FileBlockStore) segmentPath(id uint32) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%06d%s", segmentPrefix, id, segmentSuffix))
+}
+
+// listSegments возвращает номера существующих сегментов по возрастанию
+func (s *FileBlockStore) listSegments() ([]uint32, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint32
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 32)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, uint32(id))
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (s *FileBlockStore) openSegment(id uint32) (*os.File, error) {
+	if f, ok := s.segments[id]; ok {
+		return f, nil
+	}
+	f, err := os.OpenFile(s.segmentPath(id), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open segment %d: %w", id, err)
+	}
+	s.segments[id] = f
+	return f, nil
+}
+
+// readRecord читает и проверяет запись сегмента по смещению. Запись,
+// выходящая за конец файла, — errTornRecord; при несовпадении контрольной
+// суммы возвращается и прочитанное тело, чтобы узнать, где запись кончается.
+func readRecord(f *os.File, offset int64) ([]byte, error) {
+	var header [recordHeaderSize]byte
+	if _, err := f.ReadAt(header[:], offset); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errTornRecord
+		}
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+
+	// Защита от мусорной длины в оборванном заголовке
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if offset+recordHeaderSize+int64(length) > info.Size() {
+		return nil, errTornRecord
+	}
+
+	payload := make([]byte, length)
+	if _, err := f.ReadAt(payload, offset+recordHeaderSize); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, errTornRecord
+		}
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return payload, errBadChecksum
+	}
+	return payload, nil
+}
+
+// decodeRecord декодирует блок из тела записи; пустое или нечитаемое тело —
+// errBadPayload
+func decodeRecord(payload []byte, block *Block) error {
+	if len(payload) == 0 {
+		return fmt.Errorf("%w: empty", errBadPayload)
+	}
+	if err := block.Deserialize(payload); err != nil {
+		return fmt.Errorf("%w: %v", errBadPayload, err)
+	}
+	return nil
+}
+
+// zeroFilled сообщает, состоит ли файл от offset до size только из нулей
+func zeroFilled(f *os.File, offset, size int64) (bool, error) {
+	buf := make([]byte, 32*1024)
+	for offset < size {
+		n := int64(len(buf))
+		if size-offset < n {
+			n = size - offset
+		}
+		if _, err := f.ReadAt(buf[:n], offset); err != nil {
+			return false, err
+		}
+		for _, b := range buf[:n] {
+			if b != 0 {
+				return false, nil
+			}
+		}
+		offset += n
+	}
+	return true, nil
+}
+
+func decodeEntry(buf []byte) indexEntry {
+	var e indexEntry
+	e.Segment = binary.BigEndian.Uint32(buf[0:4])
+	e.Offset = int64(binary.BigEndian.Uint64(buf[4:12]))
+	e.Length = binary.BigEndian.Uint32(buf[12:16])
+	copy(e.HashKey[:], buf[16:16+sha256.Size])
+	return e
+}
+
+func encodeEntry(e indexEntry) []byte {
+	buf := make([]byte, indexEntrySize)
+	binary.BigEndian.PutUint32(buf[0:4], e.Segment)
+	binary.BigEndian.PutUint64(buf[4:12], uint64(e.Offset))
+	binary.BigEndian.PutUint32(buf[12:16], e.Length)
+	copy(buf[16:], e.HashKey[:])
+	return buf
+}
+
+// recover загружает индекс, сверяет его с сегментами, достраивает
+// недостающие записи и отрезает оборванный хвост
+func (s *FileBlockStore) recover() error {
+	ids, err := s.listSegments()
+	if err != nil {
+		return fmt.Errorf("failed to list segments: %w", err)
+	}
+	if len(ids) == 0 {
+		ids = []uint32{1}
+	}
+	for _, id := range ids {
+		if _, err := s.openSegment(id); err != nil {
+			return err
+		}
+	}
+
+	s.index, err = os.OpenFile(filepath.Join(s.dir, indexFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open index: %w", err)
+	}
+	data, err := io.ReadAll(s.index)
+	if err != nil {
+		return fmt.Errorf("failed to read index: %w", err)
+	}
+	for off := 0; off+indexEntrySize <= len(data); off += indexEntrySize {
+		s.entries = append(s.entries, decodeEntry(data[off:off+indexEntrySize]))
+	}
+
+	// Отбрасываем записи индекса, которые указывают на отсутствующие или битые данные
+	for len(s.entries) > 0 {
+		last := s.entries[len(s.entries)-1]
+		f, ok := s.segments[last.Segment]
+		if ok {
+			payload, err := readRecord(f, last.Offset)
+			if err == nil && uint32(len(payload)) == last.Length {
+				break
+			}
+			// Битую запись проверит проход по сегменту ниже
+			if err != nil && err != errTornRecord && err != errBadChecksum {
+				return err
+			}
+		}
+		s.entries = s.entries[:len(s.entries)-1]
+	}
+
+	// Точка, с которой сегменты ещё не покрыты индексом
+	scanSegment, scanOffset := ids[0], int64(0)
+	if len(s.entries) > 0 {
+		last := s.entries[len(s.entries)-1]
+		scanSegment, scanOffset = last.Segment, last.Offset+recordHeaderSize+int64(last.Length)
+	}
+
+	for _, id := range ids {
+		if id < scanSegment {
+			continue
+		}
+		if id > scanSegment {
+			scanOffset = 0
+		}
+		f := s.segments[id]
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		// Оборваться при падении может только последняя запись последнего
+		// сегмента: предыдущий сегмент синхронизируется перед началом нового
+		tail := id == ids[len(ids)-1]
+		for scanOffset < info.Size() {
+			payload, err := readRecord(f, scanOffset)
+			block := &Block{}
+			if err == nil {
+				err = decodeRecord(payload, block)
+			}
+			// Битая запись, кончающаяся в конце сегмента или за которой
+			// только нули (файловая система при падении могла продлить файл
+			// без данных, а у пустой записи контрольная сумма сходится),
+			// считается оборванной
+			if err == errBadChecksum || errors.Is(err, errBadPayload) {
+				zeros, zerr := zeroFilled(f, scanOffset, info.Size())
+				if zerr != nil {
+					return zerr
+				}
+				if zeros || scanOffset+recordHeaderSize+int64(len(payload)) == info.Size() {
+					err = errTornRecord
+				}
+			}
+			if err == errTornRecord && tail {
+				break
+			}
+			if err == errTornRecord || err == errBadChecksum || errors.Is(err, errBadPayload) {
+				return fmt.Errorf("%w: segment %d offset %d: %v", ErrCorruptRecord, id, scanOffset, err)
+			}
+			if err != nil {
+				return err
+			}
+			if block.Index != int64(len(s.entries)) {
+				return fmt.Errorf("%w: segment %d offset %d: block %d at height %d", ErrCorruptRecord, id, scanOffset, block.Index, len(s.entries))
+			}
+			s.entries = append(s.entries, indexEntry{
+				Segment: id,
+				Offset:  scanOffset,
+				Length:  uint32(len(payload)),
+				HashKey: hashKey(block.Hash),
+			})
+			scanOffset += recordHeaderSize + int64(len(payload))
+		}
+		if err := f.Truncate(scanOffset); err != nil {
+			return fmt.Errorf("failed to truncate segment %d: %w", id, err)
+		}
+		s.active, s.size = id, scanOffset
+	}
+
+	// Переписываем индекс целиком: он маленький, а так он гарантированно согласован с сегментами
+	buf := make([]byte, 0, len(s.entries)*indexEntrySize)
+	for _, e := range s.entries {
+		buf = append(buf, encodeEntry(e)...)
+	}
+	if err := s.index.Truncate(0); err != nil {
+		return fmt.Errorf("failed to reset index: %w", err)
+	}
+	if _, err := s.index.WriteAt(buf, 0); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	if _, err := s.index.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	if err := s.index.Sync(); err != nil {
+		return err
+	}
+
+	for height, e := range s.entries {
+		s.byHash[e.HashKey] = int64(height)
+	}
+	if len(s.entries) > 0 {
+		latest, err := s.readBlock(int64(len(s.entries)) - 1)
+		if err != nil {
+			return err
+		}
+		s.latest = latest
+	}
+	return nil
+}
+
+func (s *FileBlockStore) dropSegmentsAfter(id uint32, ids []uint32) error {
+	for _, other := range ids {
+		if other <= id {
+			continue
+		}
+		if f, ok := s.segments[other]; ok {
+			f.Close()
+			delete(s.segments, other)
+		}
+		if err := os.Remove(s.segmentPath(other)); err != nil {
+			return fmt.Errorf("failed to remove segment %d: %w", other, err)
+		}
+	}
+	return nil
+}
+
+func (s *FileBlockStore) readBlock(height int64) (*Block, error) {
+	if height < 0 || height >= int64(len(s.entries)) {
+		return nil, ErrBlockNotFound
+	}
+	e := s.entries[height]
+	payload, err := readRecord(s.segments[e.Segment], e.Offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block %d: %w", height, err)
+	}
+	block := &Block{}
+	if err := block.Deserialize(payload); err != nil {
+		return nil, fmt.Errorf("failed to decode block %d: %w", height, err)
+	}
+	return block, nil
+}
+
+func (s *FileBlockStore) Append(block *Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrStoreClosed
+	}
+	if err := checkAppendHeight(block, int64(len(s.entries))-1); err != nil {
+		return err
+	}
+
+	payload := block.Serialize()
+	record := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[recordHeaderSize:], payload)
+
+	if s.size > 0 && s.size+int64(len(record)) > s.config.MaxSegmentSize {
+		if err := s.rollover(); err != nil {
+			return err
+		}
+	}
+
+	f := s.segments[s.active]
+	if _, err := f.WriteAt(record, s.size); err != nil {
+		return fmt.Errorf("failed to write block %d: %w", block.Index, err)
+	}
+	if s.config.SyncWrites {
+		if err := f.Sync(); err != nil {
+			return fmt.Errorf("failed to sync segment: %w", err)
+		}
+	}
+
+	entry := indexEntry{
+		Segment: s.active,
+		Offset:  s.size,
+		Length:  uint32(len(payload)),
+		HashKey: hashKey(block.Hash),
+	}
+	// Индекс не синхронизируется отдельно: при восстановлении он достраивается по сегментам
+	if _, err := s.index.Write(encodeEntry(entry)); err != nil {
+		return fmt.Errorf("failed to write index entry: %w", err)
+	}
+
+	s.size += int64(len(record))
+	s.entries = append(s.entries, entry)
+	s.byHash[entry.HashKey] = block.Index
+	s.latest = block
+	return nil
+}
+
+// rollover закрывает активный сегмент для записи и начинает новый
+func (s *FileBlockStore) rollover() error {
+	if err := s.segments[s.active].Sync(); err != nil {
+		return fmt.Errorf("failed to sync segment: %w", err)
+	}
+	next := s.active + 1
+	if _, err := s.openSegment(next); err != nil {
+		return err
+	}
+	s.active, s.size = next, 0
+	return nil
+}
+
+func (s *FileBlockStore) GetByHeight(height int64) (*Block, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, ErrStoreClosed
+	}
+	return s.readBlock(height)
+}
+
+func (s *FileBlockStore) GetByHash(hash string) (*Block, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return nil, ErrStoreClosed
+	}
+	height, exists := s.byHash[hashKey(hash)]
+	if !exists {
+		return nil, ErrBlockNotFound
+	}
+	return s.readBlock(height)
+}
+
+func (s *FileBlockStore) Iterate(from, to int64, fn func(*Block) bool) error {
+	if from < 0 {
+		from = 0
+	}
+	for height := from; height <= to; height++ {
+		s.mu.RLock()
+		if s.closed {
+			s.mu.RUnlock()
+			return ErrStoreClosed
+		}
+		if height >= int64(len(s.entries)) {
+			s.mu.RUnlock()
+			return nil
+		}
+		block, err := s.readBlock(height)
+		s.mu.RUnlock()
+		if err != nil {
+			return err
+		}
+		if !fn(block) {
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *FileBlockStore) Latest() (*Block, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.latest == nil {
+		return nil, ErrBlockNotFound
+	}
+	return s.latest, nil
+}
+
+func (s *FileBlockStore) Height() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int64(len(s.entries)) - 1
+}
+
+func (s *FileBlockStore) Rewind(height int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return ErrStoreClosed
+	}
+	if height < -1 {
+		height = -1
+	}
+	if height+1 >= int64(len(s.entries)) {
+		return nil
+	}
+
+	// Обрезаем сегмент, в котором лежит первый удаляемый блок, и удаляем следующие
+	first := s.entries[height+1]
+	if err := s.segments[first.Segment].Truncate(first.Offset); err != nil {
+		return fmt.Errorf("failed to truncate segment %d: %w", first.Segment, err)
+	}
+	ids, err := s.listSegments()
+	if err != nil {
+		return fmt.Errorf("failed to list segments: %w", err)
+	}
+	if err := s.dropSegmentsAfter(first.Segment, ids); err != nil {
+		return err
+	}
+	s.active, s.size = first.Segment, first.Offset
+
+	if err := s.index.Truncate((height + 1) * indexEntrySize); err != nil {
+		return fmt.Errorf("failed to truncate index: %w", err)
+	}
+	if _, err := s.index.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+
+	for _, e := range s.entries[height+1:] {
+		delete(s.byHash, e.HashKey)
+	}
+	s.entries = s.entries[:height+1]
+	s.latest = nil
+	if height >= 0 {
+		latest, err := s.readBlock(height)
+		if err != nil {
+			return err
+		}
+		s.latest = latest
+	}
+	return nil
+}
+
+func (s *FileBlockStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.closeFiles()
+}
+
+func (s *FileBlockStore) closeFiles() error {
+	var firstErr error
+	for id, f := range s.segments {
+		if err := f.Sync(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.segments, id)
+	}
+	if s.index != nil {
+		if err := s.index.Sync(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		if err := s.index.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,263 @@
+package blockchain
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"blockchain/storage/txpool"
+)
+
+func newTestChain(t *testing.T, store BlockStore) *Blockchain {
+	chain, err := NewBlockchainWithStore(store, nil)
+	if err != nil {
+		t.Fatalf("Failed to create chain: %v", err)
+	}
+	return chain
+}
+
+func appendTestBlocks(t *testing.T, chain *Blockchain, count int) {
+	for i := 0; i < count; i++ {
+		prev := chain.GetLatestBlock()
+		tx := &txpool.Transaction{ID: "tx-" + string(rune('a'+i)), From: "alice", To: "bob", Amount: float64(i + 1)}
+		block := NewBlock(prev.Index+1, prev.Hash, []*txpool.Transaction{tx}, "validator1")
+		if err := chain.AddBlock(block); err != nil {
+			t.Fatalf("Failed to add block %d: %v", block.Index, err)
+		}
+	}
+}
+
+// TestFileBlockStore_Reopen - цепочка восстанавливается после перезапуска
+func TestFileBlockStore_Reopen(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := OpenFileBlockStore(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	chain := newTestChain(t, store)
+	genesis := chain.GetLatestBlock()
+	appendTestBlocks(t, chain, 5)
+	latest := chain.GetLatestBlock()
+	chain.Close()
+
+	store, err = OpenFileBlockStore(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+	reopened := newTestChain(t, store)
+
+	if reopened.Height() != 5 {
+		t.Fatalf("Expected height 5, got %d", reopened.Height())
+	}
+	if reopened.GetLatestBlock().Hash != latest.Hash {
+		t.Errorf("Expected latest hash %s, got %s", latest.Hash, reopened.GetLatestBlock().Hash)
+	}
+	if reopened.GetBlockByHeight(0).Hash != genesis.Hash {
+		t.Errorf("Genesis block was not preserved")
+	}
+	if !reopened.HasBlock(latest.Hash) {
+		t.Errorf("Expected lookup by hash to find block %s", latest.Hash)
+	}
+	if got := len(reopened.GetBlocks(1, 3)); got != 3 {
+		t.Errorf("Expected 3 blocks in range, got %d", got)
+	}
+}
+
+// TestFileBlockStore_TornRecord - оборванная последняя запись отрезается при восстановлении
+func TestFileBlockStore_TornRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := OpenFileBlockStore(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	chain := newTestChain(t, store)
+	appendTestBlocks(t, chain, 3)
+	chain.Close()
+
+	// Имитируем падение посреди записи: дописываем половину записи
+	segment := filepath.Join(dir, "segment-000001.log")
+	f, err := os.OpenFile(segment, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("Failed to open segment: %v", err)
+	}
+	f.Write([]byte{0, 0, 1, 0, 0xde, 0xad, 0xbe, 0xef, 1, 2, 3})
+	f.Close()
+	sizeBefore, _ := os.Stat(segment)
+
+	store, err = OpenFileBlockStore(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	if store.Height() != 3 {
+		t.Fatalf("Expected height 3 after recovery, got %d", store.Height())
+	}
+	sizeAfter, _ := os.Stat(segment)
+	if sizeAfter.Size() != sizeBefore.Size()-11 {
+		t.Errorf("Expected torn record to be truncated, size %d -> %d", sizeBefore.Size(), sizeAfter.Size())
+	}
+
+	// После восстановления запись продолжается с вершины
+	chain = newTestChain(t, store)
+	appendTestBlocks(t, chain, 1)
+	chain.Close()
+
+	store, err = OpenFileBlockStore(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+	if store.Height() != 4 {
+		t.Errorf("Expected height 4, got %d", store.Height())
+	}
+}
+
+// TestFileBlockStore_ZeroFilledTail - нули, которыми файловая система при
+// падении продлила последний сегмент, отрезаются: пустая запись из нулей
+// проходит контрольную сумму, но блоком не является
+func TestFileBlockStore_ZeroFilledTail(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := OpenFileBlockStore(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	chain := newTestChain(t, store)
+	appendTestBlocks(t, chain, 3)
+	chain.Close()
+
+	segment := filepath.Join(dir, "segment-000001.log")
+	sizeBefore, _ := os.Stat(segment)
+	f, err := os.OpenFile(segment, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("Failed to open segment: %v", err)
+	}
+	f.Write(make([]byte, 4096))
+	f.Close()
+
+	store, err = OpenFileBlockStore(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+	if store.Height() != 3 {
+		t.Fatalf("Expected height 3 after recovery, got %d", store.Height())
+	}
+	sizeAfter, _ := os.Stat(segment)
+	if sizeAfter.Size() != sizeBefore.Size() {
+		t.Errorf("Expected zero-filled tail to be truncated, size %d -> %d", sizeBefore.Size(), sizeAfter.Size())
+	}
+}
+
+// TestFileBlockStore_MissingIndex - индекс достраивается по сегментам
+func TestFileBlockStore_MissingIndex(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := OpenFileBlockStore(dir, &FileStoreConfig{MaxSegmentSize: 512})
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	chain := newTestChain(t, store)
+	appendTestBlocks(t, chain, 6)
+	latest := chain.GetLatestBlock()
+	chain.Close()
+
+	if err := os.Remove(filepath.Join(dir, indexFileName)); err != nil {
+		t.Fatalf("Failed to remove index: %v", err)
+	}
+
+	store, err = OpenFileBlockStore(dir, &FileStoreConfig{MaxSegmentSize: 512})
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+
+	if store.Height() != 6 {
+		t.Fatalf("Expected height 6, got %d", store.Height())
+	}
+	block, err := store.GetByHash(latest.Hash)
+	if err != nil || block.Index != 6 {
+		t.Errorf("Expected to find block 6 by hash, got %v (%v)", block, err)
+	}
+	if len(store.segments) < 2 {
+		t.Errorf("Expected blocks to span several segments, got %d", len(store.segments))
+	}
+}
+
+// TestFileBlockStore_CorruptRecord - повреждённая запись в середине сегмента
+// не отрезается вместе с последующими блоками, а не даёт открыть хранилище
+func TestFileBlockStore_CorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := OpenFileBlockStore(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	chain := newTestChain(t, store)
+	appendTestBlocks(t, chain, 3)
+	second := store.entries[1]
+	chain.Close()
+
+	if err := os.Remove(filepath.Join(dir, indexFileName)); err != nil {
+		t.Fatalf("Failed to remove index: %v", err)
+	}
+	segment := filepath.Join(dir, "segment-000001.log")
+	data, err := os.ReadFile(segment)
+	if err != nil {
+		t.Fatalf("Failed to read segment: %v", err)
+	}
+	data[second.Offset+recordHeaderSize] ^= 0xff
+	if err := os.WriteFile(segment, data, 0o644); err != nil {
+		t.Fatalf("Failed to write segment: %v", err)
+	}
+
+	if _, err := OpenFileBlockStore(dir, nil); !errors.Is(err, ErrCorruptRecord) {
+		t.Fatalf("Expected ErrCorruptRecord, got %v", err)
+	}
+	after, err := os.ReadFile(segment)
+	if err != nil || len(after) != len(data) {
+		t.Errorf("Expected segment to be left intact, size %d -> %d", len(data), len(after))
+	}
+}
+
+// TestFileBlockStore_Rewind - откат удаляет блоки выше высоты и переживает перезапуск
+func TestFileBlockStore_Rewind(t *testing.T) {
+	dir := t.TempDir()
+	config := &FileStoreConfig{MaxSegmentSize: 512}
+
+	store, err := OpenFileBlockStore(dir, config)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	chain := newTestChain(t, store)
+	appendTestBlocks(t, chain, 6)
+	removed := chain.GetLatestBlock()
+
+	if err := chain.Rewind(2); err != nil {
+		t.Fatalf("Failed to rewind: %v", err)
+	}
+	if chain.Height() != 2 || chain.HasBlock(removed.Hash) {
+		t.Fatalf("Expected height 2 without block %s, got height %d", removed.Hash, chain.Height())
+	}
+	appendTestBlocks(t, chain, 1)
+	latest := chain.GetLatestBlock()
+	chain.Close()
+
+	store, err = OpenFileBlockStore(dir, config)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	defer store.Close()
+	if store.Height() != 3 {
+		t.Fatalf("Expected height 3 after reopen, got %d", store.Height())
+	}
+	if block, err := store.Latest(); err != nil || block.Hash != latest.Hash {
+		t.Errorf("Expected latest %s, got %v (%v)", latest.Hash, block, err)
+	}
+	if _, err := store.GetByHash(removed.Hash); err != ErrBlockNotFound {
+		t.Errorf("Expected rewound block to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package blockchain
+
+// дерево блоков и правило выбора канонической ветки
+
+import (
+	"sync"
+
+	"blockchain/storage/txpool"
+)
+
+// BlockTree хранит блоки боковых веток, не попавшие в каноническую цепочку
+type BlockTree struct {
+	blocks map[string]*Block
+	mu     sync.RWMutex
+}
+
+func NewBlockTree() *BlockTree {
+	return &BlockTree{
+		blocks: make(map[string]*Block),
+	}
+}
+
+func (t *BlockTree) Add(block *Block) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.blocks[block.Hash] = block
+}
+
+func (t *BlockTree) Get(hash string) *Block {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.blocks[hash]
+}
+
+func (t *BlockTree) Remove(hash string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.blocks, hash)
+}
+
+// Prune удаляет блоки ниже height и возвращает их хэши
+func (t *BlockTree) Prune(height int64) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var removed []string
+	for hash, block := range t.blocks {
+		if block.Index < height {
+			delete(t.blocks, hash)
+			removed = append(removed, hash)
+		}
+	}
+	return removed
+}
+
+func (t *BlockTree) Size() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return len(t.blocks)
+}
+
+// ForkChoice — правило выбора канонической ветки. Ветки сравниваются
+// от общего предка до вершины:
+//  0. ветка с блоком, решённым консенсусом (с сертификатом Commit), не
+//     уступает никакой другой, а ветка без него уступает такой ветке;
+//  1. выигрывает ветка с большей высотой вершины;
+//  2. при равной высоте — ветка с большим суммарным стейком валидаторов,
+//     создавших её блоки (каждый валидатор учитывается один раз);
+//  3. при равенстве стейка — ветка с лексикографически меньшим хэшем вершины,
+//     чтобы все узлы приходили к одному выбору.
+type ForkChoice struct {
+	StakeOf func(validator string) int64 // nil — стейк всех валидаторов считается нулевым
+}
+
+// Prefer сообщает, нужно ли переключиться с ветки current на candidate.
+// Ветки передаются без общего предка, в порядке возрастания высоты.
+func (f *ForkChoice) Prefer(candidate, current []*Block) bool {
+	if len(candidate) == 0 {
+		return false
+	}
+	if len(current) == 0 {
+		return true
+	}
+	if HasCommit(current) {
+		return false
+	}
+	if HasCommit(candidate) {
+		return true
+	}
+	candHead, curHead := candidate[len(candidate)-1], current[len(current)-1]
+	if candHead.Index != curHead.Index {
+		return candHead.Index > curHead.Index
+	}
+	candStake, curStake := f.branchStake(candidate), f.branchStake(current)
+	if candStake != curStake {
+		return candStake > curStake
+	}
+	return candHead.Hash < curHead.Hash
+}
+
+// HasCommit сообщает, есть ли в ветке блок с сертификатом финальности.
+// Непроверенные сертификаты снимает state.StateMachine при импорте блока
+func HasCommit(branch []*Block) bool {
+	for _, block := range branch {
+		if block.Commit != nil && block.Commit.BlockHash == block.Hash {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *ForkChoice) branchStake(branch []*Block) int64 {
+	if f == nil || f.StakeOf == nil {
+		return 0
+	}
+	seen := make(map[string]bool)
+	var total int64
+	for _, block := range branch {
+		if seen[block.Validator] {
+			continue
+		}
+		seen[block.Validator] = true
+		total += f.StakeOf(block.Validator)
+	}
+	return total
+}
+
+// ReorgEvent описывает переключение канонической цепочки на другую ветку
+type ReorgEvent struct {
+	CommonAncestor *Block
+	OldHead        *Block
+	NewHead        *Block
+	Orphaned       []*Block // блоки, покинувшие каноническую цепочку
+	Adopted        []*Block // блоки, ставшие каноническими
+}
+
+// OrphanedTransactions возвращает транзакции из покинувших цепочку блоков,
+// которые не вошли в новую ветку — их нужно вернуть в пул
+func (e ReorgEvent) OrphanedTransactions() []*txpool.Transaction {
+	adopted := make(map[string]bool)
+	for _, tx := range e.AdoptedTransactions() {
+		adopted[tx.ID] = true
+	}
+	var txs []*txpool.Transaction
+	for _, block := range e.Orphaned {
+		for _, tx := range block.Transactions {
+			if !adopted[tx.ID] {
+				txs = append(txs, tx)
+			}
+		}
+	}
+	return txs
+}
+
+// AdoptedTransactions возвращает транзакции из блоков новой ветки
+func (e ReorgEvent) AdoptedTransactions() []*txpool.Transaction {
+	var txs []*txpool.Transaction
+	for _, block := range e.Adopted {
+		txs = append(txs, block.Transactions...)
+	}
+	return txs
+}
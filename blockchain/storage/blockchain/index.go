@@ -0,0 +1,108 @@
+package blockchain
+
+// вторичные индексы канонической цепочки
+
+import (
+	"sync"
+
+	"blockchain/storage/txpool"
+)
+
+// TxLocation — положение транзакции в канонической цепочке
+type TxLocation struct {
+	BlockIndex int64  `json:"block_index"`
+	BlockHash  string `json:"block_hash"`
+	Position   int    `json:"position"`
+}
+
+// TxRecord — транзакция вместе с её положением в цепочке
+type TxRecord struct {
+	Transaction *txpool.Transaction `json:"transaction"`
+	TxLocation
+}
+
+// chainIndex хранит индексы txID → положение и адрес → транзакции.
+// Индексы по высоте и хэшу блока ведёт само хранилище блоков.
+// Сами транзакции не дублируются: по положению блок читается из хранилища.
+type chainIndex struct {
+	txs       map[string]TxLocation
+	byAddress map[string][]string // адрес → ID транзакций в порядке включения в цепочку
+	mu        sync.RWMutex
+}
+
+func newChainIndex() *chainIndex {
+	return &chainIndex{
+		txs:       make(map[string]TxLocation),
+		byAddress: make(map[string][]string),
+	}
+}
+
+// addBlock индексирует транзакции блока, ставшего каноническим
+func (idx *chainIndex) addBlock(block *Block) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for i, tx := range block.Transactions {
+		idx.txs[tx.ID] = TxLocation{BlockIndex: block.Index, BlockHash: block.Hash, Position: i}
+		idx.byAddress[tx.From] = append(idx.byAddress[tx.From], tx.ID)
+		if tx.To != tx.From {
+			idx.byAddress[tx.To] = append(idx.byAddress[tx.To], tx.ID)
+		}
+	}
+}
+
+// removeBlock удаляет транзакции блока, покинувшего цепочку.
+// Блоки снимаются с вершины, поэтому их транзакции — последние в списках адресов.
+func (idx *chainIndex) removeBlock(block *Block) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		tx := block.Transactions[i]
+		if loc, ok := idx.txs[tx.ID]; ok && loc.BlockHash == block.Hash {
+			delete(idx.txs, tx.ID)
+		}
+		idx.popAddress(tx.From, tx.ID)
+		if tx.To != tx.From {
+			idx.popAddress(tx.To, tx.ID)
+		}
+	}
+}
+
+func (idx *chainIndex) popAddress(address, txID string) {
+	ids := idx.byAddress[address]
+	if n := len(ids); n > 0 && ids[n-1] == txID {
+		ids = ids[:n-1]
+	}
+	if len(ids) == 0 {
+		delete(idx.byAddress, address)
+		return
+	}
+	idx.byAddress[address] = ids
+}
+
+func (idx *chainIndex) location(txID string) (TxLocation, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	loc, ok := idx.txs[txID]
+	return loc, ok
+}
+
+// addressPage возвращает до limit ID транзакций адреса, начиная с позиции cursor
+func (idx *chainIndex) addressPage(address string, cursor, limit int) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	ids := idx.byAddress[address]
+	if cursor < 0 {
+		cursor = 0
+	}
+	if cursor >= len(ids) || limit <= 0 {
+		return nil
+	}
+	end := cursor + limit
+	if end > len(ids) {
+		end = len(ids)
+	}
+	return append([]string(nil), ids[cursor:end]...)
+}
@@ -0,0 +1,83 @@
+package blockchain
+
+import (
+	"testing"
+
+	"blockchain/storage/txpool"
+)
+
+// TestChainIndex_Lookups - поиск транзакции и постраничная история адреса
+func TestChainIndex_Lookups(t *testing.T) {
+	chain := NewBlockchain()
+	appendTestBlocks(t, chain, 5)
+
+	block := chain.GetBlockByHeight(3)
+	if got := chain.GetBlockByHash(block.Hash); got == nil || got.Index != 3 {
+		t.Fatalf("Expected block 3 by hash, got %v", got)
+	}
+
+	record := chain.GetTransaction("tx-c")
+	if record == nil {
+		t.Fatal("Expected to find tx-c")
+	}
+	if record.BlockIndex != 3 || record.BlockHash != block.Hash || record.Position != 0 || record.Transaction.Amount != 3 {
+		t.Errorf("Unexpected record: %+v", record)
+	}
+	if chain.GetTransaction("missing") != nil {
+		t.Errorf("Expected nil for unknown transaction")
+	}
+
+	page, next := chain.GetAddressHistory("bob", 0, 2)
+	if len(page) != 2 || page[0].Transaction.ID != "tx-a" || page[1].Transaction.ID != "tx-b" || next != 2 {
+		t.Fatalf("Unexpected first page: %d records, next %d", len(page), next)
+	}
+	page, next = chain.GetAddressHistory("bob", next, 10)
+	if len(page) != 3 || page[2].Transaction.ID != "tx-e" || next != 5 {
+		t.Errorf("Unexpected last page: %d records, next %d", len(page), next)
+	}
+	if page, _ := chain.GetAddressHistory("carol", 0, 10); len(page) != 0 {
+		t.Errorf("Expected empty history for carol, got %d", len(page))
+	}
+}
+
+// TestChainIndex_RebuildAndRewind - индексы перестраиваются из хранилища и следуют за откатом
+func TestChainIndex_RebuildAndRewind(t *testing.T) {
+	dir := t.TempDir()
+	store, err := OpenFileBlockStore(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	chain := newTestChain(t, store)
+	appendTestBlocks(t, chain, 4)
+	chain.Close()
+
+	store, err = OpenFileBlockStore(dir, nil)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	chain = newTestChain(t, store)
+	defer chain.Close()
+
+	if record := chain.GetTransaction("tx-d"); record == nil || record.BlockIndex != 4 {
+		t.Fatalf("Expected tx-d at block 4 after restart, got %+v", record)
+	}
+
+	if err := chain.Rewind(2); err != nil {
+		t.Fatalf("Failed to rewind: %v", err)
+	}
+	if chain.GetTransaction("tx-c") != nil {
+		t.Errorf("Expected tx-c to leave the index after rewind")
+	}
+	if page, _ := chain.GetAddressHistory("alice", 0, 10); len(page) != 2 {
+		t.Errorf("Expected 2 transactions for alice after rewind, got %d", len(page))
+	}
+
+	prev := chain.GetLatestBlock()
+	tx := &txpool.Transaction{ID: "tx-new", From: "alice", To: "alice", Amount: 1}
+	if err := chain.AddBlock(NewBlock(prev.Index+1, prev.Hash, []*txpool.Transaction{tx}, "validator1")); err != nil {
+		t.Fatalf("Failed to add block: %v", err)
+	}
+	if page, _ := chain.GetAddressHistory("alice", 0, 10); len(page) != 3 || page[2].Transaction.ID != "tx-new" {
+		t.Errorf("Expected self-transfer to be indexed once, got %d records", len(page))
+	}
+}
@@ -0,0 +1,71 @@
+package blockchain
+
+// доказательства включения транзакций для лёгких клиентов
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"blockchain/crypto/merkle"
+	"blockchain/storage/txpool"
+)
+
+// TxProof — доказательство того, что транзакция входит в блок
+type TxProof struct {
+	TxID       string        `json:"tx_id"`
+	TxHash     string        `json:"tx_hash"` // канонический хэш транзакции (лист дерева)
+	BlockIndex int64         `json:"block_index"`
+	BlockHash  string        `json:"block_hash"`
+	MerkleRoot string        `json:"merkle_root"`
+	Proof      *merkle.Proof `json:"proof"`
+}
+
+// ProofForTx строит доказательство включения транзакции txID в блок
+func ProofForTx(block *Block, txID string) (*TxProof, error) {
+	index := -1
+	for i, tx := range block.Transactions {
+		if tx.ID == txID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("transaction %s not found in block %d", txID, block.Index)
+	}
+
+	leaves := block.txLeaves()
+	proof, err := merkle.BuildProof(leaves, index)
+	if err != nil {
+		return nil, err
+	}
+	return &TxProof{
+		TxID:       txID,
+		TxHash:     hex.EncodeToString(leaves[index]),
+		BlockIndex: block.Index,
+		BlockHash:  block.Hash,
+		MerkleRoot: hex.EncodeToString(merkle.Root(leaves)),
+		Proof:      proof,
+	}, nil
+}
+
+// VerifyTxProof проверяет, что транзакция tx входит в блок с корнем
+// дерева Меркла root (hex). Лист дерева вычисляется по самой транзакции,
+// поэтому доказательство нельзя переписать на другую транзакцию.
+func VerifyTxProof(root string, tx *txpool.Transaction, proof *TxProof) bool {
+	if tx == nil || proof == nil || tx.ID != proof.TxID {
+		return false
+	}
+	rootBytes, err := hex.DecodeString(root)
+	if err != nil {
+		return false
+	}
+	if claimed, err := hex.DecodeString(proof.MerkleRoot); err != nil || !bytes.Equal(claimed, rootBytes) {
+		return false
+	}
+	leaf := tx.Hash()
+	if claimed, err := hex.DecodeString(proof.TxHash); err != nil || !bytes.Equal(claimed, leaf) {
+		return false
+	}
+	return merkle.Verify(rootBytes, leaf, proof.Proof)
+}
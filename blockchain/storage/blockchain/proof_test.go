@@ -0,0 +1,45 @@
+package blockchain
+
+import (
+	"fmt"
+	"testing"
+
+	"blockchain/storage/txpool"
+)
+
+// TestProofForTx - доказательство сверяется с корнем, входящим в хэш блока
+func TestProofForTx(t *testing.T) {
+	txs := make([]*txpool.Transaction, 5)
+	for i := range txs {
+		txs[i] = &txpool.Transaction{ID: fmt.Sprintf("tx-%d", i), From: "alice", To: "bob", Amount: float64(i)}
+	}
+	block := NewBlock(1, "prev", txs, "validator1")
+
+	proof, err := ProofForTx(block, "tx-3")
+	if err != nil {
+		t.Fatalf("Failed to build proof: %v", err)
+	}
+	if !VerifyTxProof(block.TransactionsHash(), txs[3], proof) {
+		t.Error("Valid proof rejected")
+	}
+
+	// Доказательство, переписанное на другую транзакцию, не проходит
+	relabelled := *proof
+	relabelled.TxID = txs[1].ID
+	if VerifyTxProof(block.TransactionsHash(), txs[1], &relabelled) {
+		t.Error("Proof accepted for another transaction")
+	}
+
+	// Изменение транзакции меняет корень и хэш блока
+	txs[3].Amount = 1000
+	if VerifyTxProof(block.TransactionsHash(), txs[3], proof) {
+		t.Error("Proof accepted against a root of modified transactions")
+	}
+	if block.CalculateHash() == block.Hash {
+		t.Error("Block hash must change when a transaction changes")
+	}
+
+	if _, err := ProofForTx(block, "tx-missing"); err == nil {
+		t.Error("Expected error for a transaction outside the block")
+	}
+}
@@ -0,0 +1,151 @@
+package blockchain
+
+// хранилище блоков
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	ErrBlockNotFound = errors.New("block not found")
+	ErrStoreClosed   = errors.New("block store closed")
+)
+
+// BlockStore — подключаемое хранилище блоков канонической цепочки.
+// Блоки добавляются строго по порядку высот, начиная с генезиса (высота 0).
+type BlockStore interface {
+	// Append добавляет блок на вершину; block.Index должен быть равен Height()+1
+	Append(block *Block) error
+	// GetByHeight возвращает блок по высоте или ErrBlockNotFound
+	GetByHeight(height int64) (*Block, error)
+	// GetByHash возвращает блок по хэшу или ErrBlockNotFound
+	GetByHash(hash string) (*Block, error)
+	// Iterate обходит блоки в диапазоне [from, to] включительно, пока fn возвращает true
+	Iterate(from, to int64, fn func(*Block) bool) error
+	// Latest возвращает последний блок или ErrBlockNotFound для пустого хранилища
+	Latest() (*Block, error)
+	// Height возвращает высоту последнего блока (-1, если хранилище пустое)
+	Height() int64
+	// Rewind удаляет все блоки выше height (используется при реорганизации цепочки)
+	Rewind(height int64) error
+	Close() error
+}
+
+// checkAppendHeight проверяет, что блок продолжает цепочку по высоте
+func checkAppendHeight(block *Block, height int64) error {
+	if block == nil {
+		return fmt.Errorf("nil block")
+	}
+	if block.Index != height+1 {
+		return fmt.Errorf("non-sequential block height: expected %d, got %d", height+1, block.Index)
+	}
+	return nil
+}
+
+// MemoryBlockStore — хранилище блоков в памяти (данные теряются при перезапуске)
+type MemoryBlockStore struct {
+	blocks []*Block
+	byHash map[string]*Block
+	mu     sync.RWMutex
+}
+
+func NewMemoryBlockStore() *MemoryBlockStore {
+	return &MemoryBlockStore{
+		blocks: make([]*Block, 0),
+		byHash: make(map[string]*Block),
+	}
+}
+
+func (s *MemoryBlockStore) Append(block *Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := checkAppendHeight(block, int64(len(s.blocks))-1); err != nil {
+		return err
+	}
+	s.blocks = append(s.blocks, block)
+	s.byHash[block.Hash] = block
+	return nil
+}
+
+func (s *MemoryBlockStore) GetByHeight(height int64) (*Block, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if height < 0 || height >= int64(len(s.blocks)) {
+		return nil, ErrBlockNotFound
+	}
+	return s.blocks[height], nil
+}
+
+func (s *MemoryBlockStore) GetByHash(hash string) (*Block, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	block, exists := s.byHash[hash]
+	if !exists {
+		return nil, ErrBlockNotFound
+	}
+	return block, nil
+}
+
+func (s *MemoryBlockStore) Iterate(from, to int64, fn func(*Block) bool) error {
+	s.mu.RLock()
+	if from < 0 {
+		from = 0
+	}
+	if to >= int64(len(s.blocks)) {
+		to = int64(len(s.blocks)) - 1
+	}
+	var blocks []*Block
+	if from <= to {
+		blocks = append(blocks, s.blocks[from:to+1]...)
+	}
+	s.mu.RUnlock()
+
+	// Колбэк вызывается без блокировки, чтобы он мог обращаться к хранилищу
+	for _, block := range blocks {
+		if !fn(block) {
+			break
+		}
+	}
+	return nil
+}
+
+func (s *MemoryBlockStore) Latest() (*Block, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.blocks) == 0 {
+		return nil, ErrBlockNotFound
+	}
+	return s.blocks[len(s.blocks)-1], nil
+}
+
+func (s *MemoryBlockStore) Height() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int64(len(s.blocks)) - 1
+}
+
+func (s *MemoryBlockStore) Rewind(height int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if height < -1 {
+		height = -1
+	}
+	for i := int64(len(s.blocks)) - 1; i > height; i-- {
+		delete(s.byHash, s.blocks[i].Hash)
+	}
+	if height+1 < int64(len(s.blocks)) {
+		s.blocks = s.blocks[:height+1]
+	}
+	return nil
+}
+
+func (s *MemoryBlockStore) Close() error {
+	return nil
+}
@@ -0,0 +1,85 @@
+package blockchain
+
+// проверка блоков при импорте
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"blockchain/consensus/pos"
+	"blockchain/crypto/signature"
+)
+
+// MaxClockDrift — насколько метка времени блока может опережать локальные часы
+const MaxClockDrift = 15 * time.Second
+
+var (
+	ErrUnknownParent    = errors.New("unknown parent block")
+	ErrInvalidLinkage   = errors.New("invalid block linkage")
+	ErrInvalidHash      = errors.New("invalid block hash")
+	ErrInvalidTimestamp = errors.New("invalid block timestamp")
+	ErrInvalidSignature = errors.New("invalid block signature")
+	ErrNotValidator     = errors.New("block signer is not a validator")
+	ErrInvalidTx        = errors.New("invalid transaction in block")
+)
+
+// ValidateBlock проверяет блок относительно родителя: связность (PrevHash и
+// последовательный Index), пересчёт хэша, монотонность времени, базовую
+// комиссию и размер блока, подпись валидатора, ID и подписи транзакций.
+// Параметры комиссий fees берутся из генезиса цепочки (Blockchain.Fees).
+// validators — набор валидаторов высоты блока (состояние после parent):
+// блок должен подписать его участник; пустой набор (цепочка без стейкинга)
+// не ограничивает создателя блока. Транзакции должны быть для сети chainID
+// из генезиса.
+// Состояние счетов здесь не проверяется — это делает state.
+func ValidateBlock(block, parent *Block, fees *FeeConfig, validators pos.ValidatorPool, chainID string) error {
+	if block == nil || parent == nil {
+		return fmt.Errorf("%w: nil block", ErrInvalidLinkage)
+	}
+	if block.PrevHash != parent.Hash {
+		return fmt.Errorf("%w: prev hash %s does not match parent %s", ErrInvalidLinkage, block.PrevHash, parent.Hash)
+	}
+	if block.Index != parent.Index+1 {
+		return fmt.Errorf("%w: index %d does not follow parent %d", ErrInvalidLinkage, block.Index, parent.Index)
+	}
+	if computed := block.CalculateHash(); block.Hash != computed {
+		return fmt.Errorf("%w: header says %s, computed %s", ErrInvalidHash, block.Hash, computed)
+	}
+	if block.Timestamp < parent.Timestamp {
+		return fmt.Errorf("%w: %d is before parent %d", ErrInvalidTimestamp, block.Timestamp, parent.Timestamp)
+	}
+	if block.Timestamp > time.Now().Add(MaxClockDrift).Unix() {
+		return fmt.Errorf("%w: %d is too far in the future", ErrInvalidTimestamp, block.Timestamp)
+	}
+	if expected := fees.NextBaseFee(parent); block.BaseFee != expected {
+		return fmt.Errorf("%w: header says %.9f, expected %.9f", ErrInvalidBaseFee, block.BaseFee, expected)
+	}
+	if max := fees.MaxTxsPerBlock; max > 0 && len(block.Transactions) > max {
+		return fmt.Errorf("%w: %d, limit %d", ErrBlockTooLarge, len(block.Transactions), max)
+	}
+	if len(validators) > 0 && !validators.Contains(block.Validator) {
+		return fmt.Errorf("%w: %s at height %d", ErrNotValidator, block.Validator, block.Index)
+	}
+	if err := VerifyBlockSignature(block); err != nil {
+		return err
+	}
+	for _, tx := range block.Transactions {
+		if err := tx.VerifySignature(chainID); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidTx, tx.ID, err)
+		}
+	}
+	return nil
+}
+
+// VerifyBlockSignature проверяет подпись блока ключом его валидатора
+func VerifyBlockSignature(block *Block) error {
+	pubKey, err := signature.GetPublicKey(block.Validator)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if len(block.Signature) == 0 || !signature.Verify(pubKey, block.SerializeWithoutSignature(), block.Signature) {
+		return fmt.Errorf("%w: block %d by %s", ErrInvalidSignature, block.Index, block.Validator)
+	}
+	return nil
+}
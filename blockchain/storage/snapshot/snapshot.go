@@ -0,0 +1,461 @@
+// Package snapshot — периодические снимки состояния узла и журнал
+// упреждающей записи (WAL) изменений между снимками.
+//
+// Подсистемы (реестр KYC, говернанс, платёжные каналы, валидаторы,
+// состояние счетов) регистрируются как компоненты. При запуске каждый
+// компонент восстанавливается из последнего снимка, после чего к нему
+// применяются записи WAL, сделанные после снимка. Записи WAL — замена
+// сущности целиком по ключу, поэтому повторное применение безопасно.
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileVersion — версия формата файла снимка
+const FileVersion = 1
+
+const (
+	snapshotPrefix = "snapshot-"
+	snapshotSuffix = ".json"
+	walFileName    = "wal.log"
+)
+
+var (
+	ErrUnsupportedVersion = errors.New("unsupported snapshot version")
+	ErrNoSnapshot         = errors.New("no snapshot found")
+)
+
+// Component — подсистема, состояние которой входит в снимок.
+// Export возвращает согласованную копию состояния в JSON.
+type Component interface {
+	Name() string
+	Export() ([]byte, error)
+}
+
+// Restorer — компонент, восстанавливаемый из снимка и WAL
+type Restorer interface {
+	Component
+	// Import заменяет состояние компонента данными снимка
+	Import(data []byte) error
+	// ApplyRecord применяет запись WAL: value — JSON сущности, nil — удаление
+	ApplyRecord(key string, value []byte) error
+}
+
+// Journaled — компонент, записывающий свои изменения в WAL
+type Journaled interface {
+	SetJournal(journal func(key string, value any))
+}
+
+// Config — параметры снимков
+type Config struct {
+	Interval   time.Duration // период автоматических снимков (0 — только по запросу)
+	SyncWrites bool          // fsync после каждой записи WAL
+	Keep       int           // сколько последних снимков хранить на диске
+}
+
+func DefaultConfig() *Config {
+	return &Config{
+		Interval:   5 * time.Minute,
+		SyncWrites: true,
+		Keep:       2,
+	}
+}
+
+// File — содержимое файла снимка
+type File struct {
+	Version    int                        `json:"version"`
+	Seq        uint64                     `json:"seq"` // последняя запись WAL, вошедшая в снимок
+	CreatedAt  int64                      `json:"created_at"`
+	Components map[string]json.RawMessage `json:"components"`
+	Blocks     [][]byte                   `json:"blocks,omitempty"` // блоки цепочки; только в экспортированных снимках
+}
+
+// Manager ведёт WAL и снимки каталога dir
+type Manager struct {
+	dir        string
+	config     *Config
+	wal        *wal
+	seq        uint64
+	base       *File     // последний снимок
+	records    []*Record // записи WAL после снимка
+	components []Component
+	stop       chan struct{}
+	mu         sync.Mutex
+	snapMu     sync.Mutex // один снимок за раз
+}
+
+// Open открывает каталог снимков: читает последний снимок и WAL.
+// Компоненты восстанавливаются при регистрации (Register).
+func Open(dir string, config *Config) (*Manager, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create snapshot dir: %w", err)
+	}
+
+	base, err := latestSnapshot(dir)
+	if err != nil && !errors.Is(err, ErrNoSnapshot) {
+		return nil, err
+	}
+	if base == nil {
+		base = &File{Version: FileVersion, Components: map[string]json.RawMessage{}}
+	}
+
+	w, records, err := openWAL(filepath.Join(dir, walFileName), config.SyncWrites)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		dir:    dir,
+		config: config,
+		wal:    w,
+		seq:    base.Seq,
+		base:   base,
+	}
+	for _, rec := range records {
+		if rec.Seq <= base.Seq {
+			continue // запись уже вошла в снимок (сбой между снимком и очисткой WAL)
+		}
+		m.records = append(m.records, rec)
+		m.seq = rec.Seq
+	}
+	if base.Seq > 0 || len(m.records) > 0 {
+		fmt.Printf("💾 Loaded snapshot at seq %d and %d WAL records\n", base.Seq, len(m.records))
+	}
+	return m, nil
+}
+
+// Section возвращает данные компонента из загруженного снимка (nil, если их нет)
+func (m *Manager) Section(name string) []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.base.Components[name]
+}
+
+// Register добавляет компонент в снимки. Компонент, реализующий Restorer,
+// восстанавливается из загруженного снимка и записей WAL; компоненту,
+// реализующему Journaled, после восстановления подключается запись в WAL.
+func (m *Manager) Register(c Component) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := c.(Restorer); ok {
+		if data, exists := m.base.Components[c.Name()]; exists {
+			if err := r.Import(data); err != nil {
+				return fmt.Errorf("failed to restore %s from snapshot: %w", c.Name(), err)
+			}
+		}
+		applied := 0
+		for _, rec := range m.records {
+			if rec.Component != c.Name() {
+				continue
+			}
+			if err := r.ApplyRecord(rec.Key, rec.Value); err != nil {
+				return fmt.Errorf("failed to apply WAL record %d to %s: %w", rec.Seq, c.Name(), err)
+			}
+			applied++
+		}
+		if applied > 0 {
+			fmt.Printf("💾 Replayed %d WAL records for %s\n", applied, c.Name())
+		}
+	}
+	if j, ok := c.(Journaled); ok {
+		j.SetJournal(m.Journal(c.Name()))
+	}
+	m.components = append(m.components, c)
+	return nil
+}
+
+// Record записывает в WAL новое значение сущности key компонента.
+// value кодируется в JSON; nil означает удаление.
+func (m *Manager) Record(component, key string, value any) error {
+	var data []byte
+	if value != nil {
+		var err error
+		if data, err = json.Marshal(value); err != nil {
+			return fmt.Errorf("failed to encode %s/%s: %w", component, key, err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rec := &Record{Seq: m.seq + 1, Component: component, Key: key, Value: data}
+	if err := m.wal.append(rec); err != nil {
+		return err
+	}
+	m.seq = rec.Seq
+	m.records = append(m.records, rec)
+	return nil
+}
+
+// Journal возвращает функцию записи изменений компонента для подключения к подсистеме
+func (m *Manager) Journal(component string) func(key string, value any) {
+	return func(key string, value any) {
+		if err := m.Record(component, key, value); err != nil {
+			fmt.Printf("❌ WAL write failed for %s/%s: %v\n", component, key, err)
+		}
+	}
+}
+
+// Snapshot сохраняет снимок всех компонентов и удаляет из WAL вошедшие в него
+// записи. Подсистемы пишут в WAL после изменения своего состояния, поэтому
+// все записи с номером не больше номера снимка уже отражены в экспорте;
+// более поздние записи остаются в WAL и применяются поверх снимка.
+func (m *Manager) Snapshot() error {
+	m.snapMu.Lock()
+	defer m.snapMu.Unlock()
+
+	file, err := m.export()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(m.dir, fmt.Sprintf("%s%020d%s", snapshotPrefix, file.Seq, snapshotSuffix))
+	if err := writeFile(path, file); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var rest []*Record
+	for _, rec := range m.records {
+		if rec.Seq > file.Seq {
+			rest = append(rest, rec)
+		}
+	}
+	if err := m.wal.rewrite(rest); err != nil {
+		return err
+	}
+	m.base = file
+	m.records = rest
+	m.prune()
+	fmt.Printf("💾 Snapshot saved at seq %d\n", file.Seq)
+	return nil
+}
+
+// Export сохраняет текущее состояние компонентов и переданные блоки в файл
+// path для переноса на другой узел (см. Seed)
+func (m *Manager) Export(path string, blocks [][]byte) error {
+	file, err := m.export()
+	if err != nil {
+		return err
+	}
+	file.Blocks = blocks
+	return writeFile(path, file)
+}
+
+// export собирает снимок. Компоненты экспортируются без блокировки
+// менеджера, чтобы подсистемы могли писать в WAL под своими блокировками.
+func (m *Manager) export() (*File, error) {
+	m.mu.Lock()
+	file := &File{
+		Version:    FileVersion,
+		Seq:        m.seq,
+		CreatedAt:  time.Now().Unix(),
+		Components: make(map[string]json.RawMessage, len(m.base.Components)),
+	}
+	// Данные незарегистрированных компонентов переносятся из прежнего снимка
+	for name, data := range m.base.Components {
+		file.Components[name] = data
+	}
+	components := append([]Component(nil), m.components...)
+	m.mu.Unlock()
+
+	for _, c := range components {
+		data, err := c.Export()
+		if err != nil {
+			return nil, fmt.Errorf("failed to export %s: %w", c.Name(), err)
+		}
+		file.Components[c.Name()] = data
+	}
+	return file, nil
+}
+
+// Start запускает автоматические снимки раз в Interval
+func (m *Manager) Start() {
+	if m.config.Interval <= 0 {
+		return
+	}
+	m.mu.Lock()
+	if m.stop != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.stop = make(chan struct{})
+	stop := m.stop
+	m.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(m.config.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := m.Snapshot(); err != nil {
+					fmt.Printf("❌ Snapshot failed: %v\n", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// Close останавливает автоматические снимки и закрывает WAL
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stop != nil {
+		close(m.stop)
+		m.stop = nil
+	}
+	return m.wal.close()
+}
+
+// prune удаляет снимки старше Keep последних; вызывается под блокировкой
+func (m *Manager) prune() {
+	if m.config.Keep <= 0 {
+		return
+	}
+	seqs, err := snapshotSeqs(m.dir)
+	if err != nil || len(seqs) <= m.config.Keep {
+		return
+	}
+	for _, seq := range seqs[:len(seqs)-m.config.Keep] {
+		os.Remove(filepath.Join(m.dir, fmt.Sprintf("%s%020d%s", snapshotPrefix, seq, snapshotSuffix)))
+	}
+}
+
+// ReadFile читает файл снимка
+func ReadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", path, err)
+	}
+	if file.Version != FileVersion {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, file.Version)
+	}
+	if file.Components == nil {
+		file.Components = map[string]json.RawMessage{}
+	}
+	return &file, nil
+}
+
+// Seed делает file последним снимком каталога dir и очищает WAL.
+// Используется для запуска нового узла из экспортированного снимка;
+// блоки из file не сохраняются — их записывает вызывающий в хранилище блоков.
+func Seed(dir string, file *File) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create snapshot dir: %w", err)
+	}
+	seeded := *file
+	seeded.Blocks = nil
+	path := filepath.Join(dir, fmt.Sprintf("%s%020d%s", snapshotPrefix, seeded.Seq, snapshotSuffix))
+	if err := writeFile(path, &seeded); err != nil {
+		return err
+	}
+	// Записи WAL и более новые снимки относятся к прежнему состоянию каталога
+	if err := os.Remove(filepath.Join(dir, walFileName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove WAL: %w", err)
+	}
+	seqs, err := snapshotSeqs(dir)
+	if err != nil {
+		return err
+	}
+	for _, seq := range seqs {
+		if seq > seeded.Seq {
+			os.Remove(filepath.Join(dir, fmt.Sprintf("%s%020d%s", snapshotPrefix, seq, snapshotSuffix)))
+		}
+	}
+	return nil
+}
+
+// latestSnapshot возвращает самый новый читаемый снимок каталога
+func latestSnapshot(dir string) (*File, error) {
+	seqs, err := snapshotSeqs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(seqs) - 1; i >= 0; i-- {
+		path := filepath.Join(dir, fmt.Sprintf("%s%020d%s", snapshotPrefix, seqs[i], snapshotSuffix))
+		file, err := ReadFile(path)
+		if err != nil {
+			fmt.Printf("⚠️ Skipping unreadable snapshot %s: %v\n", path, err)
+			continue
+		}
+		return file, nil
+	}
+	return nil, ErrNoSnapshot
+}
+
+// snapshotSeqs возвращает номера снимков каталога по возрастанию
+func snapshotSeqs(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	var seqs []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, snapshotPrefix) || !strings.HasSuffix(name, snapshotSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, snapshotPrefix), snapshotSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return seqs[i] < seqs[j] })
+	return seqs, nil
+}
+
+// writeFile атомарно записывает снимок: во временный файл, fsync, переименование
+func writeFile(path string, file *File) error {
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
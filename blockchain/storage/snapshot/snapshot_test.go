@@ -0,0 +1,208 @@
+package snapshot
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// kvComponent — простой компонент «ключ → значение» для тестов
+type kvComponent struct {
+	name    string
+	data    map[string]string
+	journal func(key string, value any)
+}
+
+func newKV(name string) *kvComponent {
+	return &kvComponent{name: name, data: make(map[string]string)}
+}
+
+func (c *kvComponent) Name() string                                   { return c.name }
+func (c *kvComponent) Export() ([]byte, error)                        { return json.Marshal(c.data) }
+func (c *kvComponent) Import(data []byte) error                       { return json.Unmarshal(data, &c.data) }
+func (c *kvComponent) SetJournal(journal func(key string, value any)) { c.journal = journal }
+
+func (c *kvComponent) ApplyRecord(key string, value []byte) error {
+	if value == nil {
+		delete(c.data, key)
+		return nil
+	}
+	var v string
+	if err := json.Unmarshal(value, &v); err != nil {
+		return err
+	}
+	c.data[key] = v
+	return nil
+}
+
+func (c *kvComponent) set(key, value string) {
+	c.data[key] = value
+	c.journal(key, value)
+}
+
+func (c *kvComponent) delete(key string) {
+	delete(c.data, key)
+	c.journal(key, nil)
+}
+
+func openManager(t *testing.T, dir string) *Manager {
+	m, err := Open(dir, &Config{SyncWrites: true, Keep: 2})
+	if err != nil {
+		t.Fatalf("Failed to open snapshots: %v", err)
+	}
+	return m
+}
+
+// TestManager_RestoreFromSnapshotAndWAL - состояние после перезапуска совпадает с состоянием до него
+func TestManager_RestoreFromSnapshotAndWAL(t *testing.T) {
+	dir := t.TempDir()
+
+	m := openManager(t, dir)
+	kyc := newKV("kyc")
+	if err := m.Register(kyc); err != nil {
+		t.Fatal(err)
+	}
+	kyc.set("alice", "pending")
+	kyc.set("bob", "pending")
+	if err := m.Snapshot(); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	// Изменения после снимка попадают только в WAL
+	kyc.set("alice", "verified")
+	kyc.delete("bob")
+	kyc.set("carol", "pending")
+	m.Close()
+
+	m = openManager(t, dir)
+	defer m.Close()
+	restored := newKV("kyc")
+	if err := m.Register(restored); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	if !reflect.DeepEqual(restored.data, kyc.data) {
+		t.Fatalf("Expected %v, got %v", kyc.data, restored.data)
+	}
+
+	// Нумерация записей продолжается после перезапуска
+	restored.set("dave", "pending")
+	if err := m.Snapshot(); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if len(m.records) != 0 {
+		t.Errorf("Expected WAL to be compacted, %d records left", len(m.records))
+	}
+	file, err := latestSnapshot(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Seq != 6 {
+		t.Errorf("Expected snapshot seq 6, got %d", file.Seq)
+	}
+}
+
+// TestWAL_TornTail - оборванная последняя запись отрезается, целые сохраняются
+func TestWAL_TornTail(t *testing.T) {
+	dir := t.TempDir()
+
+	m := openManager(t, dir)
+	kv := newKV("channels")
+	m.Register(kv)
+	kv.set("ch-1", "open")
+	kv.set("ch-2", "open")
+	m.Close()
+
+	walPath := filepath.Join(dir, walFileName)
+	f, err := os.OpenFile(walPath, os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 40, 1, 2, 3})
+	f.Close()
+
+	m = openManager(t, dir)
+	defer m.Close()
+	restored := newKV("channels")
+	if err := m.Register(restored); err != nil {
+		t.Fatal(err)
+	}
+	if len(restored.data) != 2 {
+		t.Fatalf("Expected 2 channels, got %v", restored.data)
+	}
+	restored.set("ch-3", "open")
+	if m.seq != 3 {
+		t.Errorf("Expected seq 3 after torn tail, got %d", m.seq)
+	}
+}
+
+// TestWAL_CorruptMiddle - повреждённая запись в середине журнала не отрезается
+// вместе с последующими: журнал не открывается
+func TestWAL_CorruptMiddle(t *testing.T) {
+	dir := t.TempDir()
+
+	m := openManager(t, dir)
+	kv := newKV("channels")
+	m.Register(kv)
+	kv.set("ch-1", "open")
+	kv.set("ch-2", "open")
+	kv.set("ch-3", "open")
+	m.Close()
+
+	// Портим тело первой записи: её контрольная сумма не сходится
+	walPath := filepath.Join(dir, walFileName)
+	data, err := os.ReadFile(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[walHeaderSize+2] ^= 0xff
+	if err := os.WriteFile(walPath, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(dir, &Config{SyncWrites: true, Keep: 2}); !errors.Is(err, ErrCorruptWAL) {
+		t.Fatalf("Expected ErrCorruptWAL, got %v", err)
+	}
+	after, err := os.ReadFile(walPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(after) != len(data) {
+		t.Errorf("Expected WAL to be left intact, size %d -> %d", len(data), len(after))
+	}
+}
+
+// TestExportAndSeed - экспортированный снимок становится последним снимком нового каталога
+func TestExportAndSeed(t *testing.T) {
+	src := openManager(t, t.TempDir())
+	kv := newKV("governance")
+	src.Register(kv)
+	kv.set("gov-001", "approved")
+
+	path := filepath.Join(t.TempDir(), "export.json")
+	if err := src.Export(path, [][]byte{{1, 2, 3}}); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	src.Close()
+
+	file, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(file.Blocks) != 1 || file.Seq != 1 {
+		t.Fatalf("Unexpected export: seq %d, %d blocks", file.Seq, len(file.Blocks))
+	}
+
+	dir := t.TempDir()
+	if err := Seed(dir, file); err != nil {
+		t.Fatalf("Seed failed: %v", err)
+	}
+	m := openManager(t, dir)
+	defer m.Close()
+	restored := newKV("governance")
+	m.Register(restored)
+	if restored.data["gov-001"] != "approved" {
+		t.Errorf("Expected seeded state, got %v", restored.data)
+	}
+}
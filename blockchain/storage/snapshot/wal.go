@@ -0,0 +1,199 @@
+package snapshot
+
+// журнал упреждающей записи (WAL)
+//
+// Формат на диске: записи вида [длина uint32][crc32 uint32][запись codec.KindWALRecord].
+// Оборванная или повреждённая последняя запись отрезается при открытии.
+// Повреждение в середине журнала не исправляется: журнал не открывается,
+// чтобы не потерять записанные после него изменения.
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"blockchain/codec"
+)
+
+const walHeaderSize = 8
+
+var (
+	// ErrCorruptWAL — запись журнала повреждена не в хвосте
+	ErrCorruptWAL = errors.New("corrupt WAL record")
+
+	errTornRecord  = errors.New("torn WAL record")
+	errBadChecksum = errors.New("WAL record checksum mismatch")
+)
+
+// Record — изменение одной сущности подсистемы. Пустое Value означает удаление.
+type Record struct {
+	Seq       uint64
+	Component string
+	Key       string
+	Value     []byte
+}
+
+// Encode кодирует запись в каноническом формате
+func (r *Record) Encode() []byte {
+	w := codec.NewWriter(codec.KindWALRecord)
+	w.Uint64(r.Seq)
+	w.String(r.Component)
+	w.String(r.Key)
+	w.Bytes(r.Value)
+	return w.Result()
+}
+
+// DecodeRecord восстанавливает запись, закодированную Encode
+func DecodeRecord(data []byte) (*Record, error) {
+	r, err := codec.NewReader(data, codec.KindWALRecord)
+	if err != nil {
+		return nil, err
+	}
+	rec := &Record{
+		Seq:       r.Uint64(),
+		Component: r.String(),
+		Key:       r.String(),
+		Value:     r.Bytes(),
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode WAL record: %w", err)
+	}
+	return rec, nil
+}
+
+// wal — файл журнала; не потокобезопасен, синхронизацию выполняет Manager
+type wal struct {
+	path string
+	file *os.File
+	sync bool
+}
+
+// openWAL открывает журнал, читает все целые записи и отрезает оборванный хвост
+func openWAL(path string, syncWrites bool) (*wal, []*Record, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open WAL: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to stat WAL: %w", err)
+	}
+
+	var records []*Record
+	var offset int64
+	for offset < info.Size() {
+		rec, size, err := readWALRecord(file, offset, info.Size())
+		// Несовпадение контрольной суммы последней записи — оборванная запись
+		if err == errBadChecksum && offset+size == info.Size() {
+			err = errTornRecord
+		}
+		if err == errTornRecord {
+			fmt.Printf("⚠️ Truncating torn WAL record at offset %d\n", offset)
+			if err := file.Truncate(offset); err != nil {
+				file.Close()
+				return nil, nil, fmt.Errorf("failed to truncate WAL: %w", err)
+			}
+			break
+		}
+		if err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("%w: offset %d: %v", ErrCorruptWAL, offset, err)
+		}
+		records = append(records, rec)
+		offset += size
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return &wal{path: path, file: file, sync: syncWrites}, records, nil
+}
+
+// readWALRecord читает запись по смещению. Запись, выходящая за конец файла
+// размера fileSize, — errTornRecord; при несовпадении контрольной суммы
+// возвращается и размер записи, чтобы узнать, где она кончается.
+func readWALRecord(file *os.File, offset, fileSize int64) (*Record, int64, error) {
+	var header [walHeaderSize]byte
+	if offset+walHeaderSize > fileSize {
+		return nil, 0, errTornRecord
+	}
+	if _, err := file.ReadAt(header[:], offset); err != nil {
+		return nil, 0, err
+	}
+	length := binary.BigEndian.Uint32(header[0:4])
+	size := walHeaderSize + int64(length)
+	// Защита от мусорной длины в оборванном заголовке
+	if offset+size > fileSize {
+		return nil, 0, errTornRecord
+	}
+	if length > codec.MaxFieldSize {
+		return nil, 0, fmt.Errorf("record length %d exceeds limit", length)
+	}
+	data := make([]byte, length)
+	if _, err := file.ReadAt(data, offset+walHeaderSize); err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, size, errBadChecksum
+	}
+	rec, err := DecodeRecord(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rec, size, nil
+}
+
+func encodeWALRecord(rec *Record) []byte {
+	data := rec.Encode()
+	buf := make([]byte, walHeaderSize, walHeaderSize+len(data))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(data))
+	return append(buf, data...)
+}
+
+func (w *wal) append(rec *Record) error {
+	if _, err := w.file.Write(encodeWALRecord(rec)); err != nil {
+		return fmt.Errorf("failed to write WAL record: %w", err)
+	}
+	if w.sync {
+		return w.file.Sync()
+	}
+	return nil
+}
+
+// rewrite атомарно заменяет журнал записями records (после записи снимка
+// в журнале остаются только записи, не вошедшие в снимок)
+func (w *wal) rewrite(records []*Record) error {
+	tmp := w.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to rewrite WAL: %w", err)
+	}
+	for _, rec := range records {
+		if _, err := f.Write(encodeWALRecord(rec)); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return fmt.Errorf("failed to rewrite WAL: %w", err)
+		}
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to sync WAL: %w", err)
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to replace WAL: %w", err)
+	}
+	w.file.Close()
+	w.file = f
+	return nil
+}
+
+func (w *wal) close() error {
+	return w.file.Close()
+}
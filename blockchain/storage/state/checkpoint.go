@@ -0,0 +1,84 @@
+package state
+
+// контрольная точка состояния счетов для снимков узла
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"blockchain/consensus/pos"
+	"blockchain/storage/blockchain"
+)
+
+// Checkpoint — состояние счетов, стейкинга и доказательств после
+// канонического блока Height.
+// Позволяет восстановить состояние без переигрывания цепочки с генезиса.
+type Checkpoint struct {
+	Height   int64              `json:"height"`
+	Hash     string             `json:"hash"`
+	Root     string             `json:"root"`
+	Accounts map[string]Account `json:"accounts"`
+	Staking  *pos.StakingState  `json:"staking,omitempty"`
+	Evidence *EvidenceState     `json:"evidence,omitempty"`
+}
+
+// DecodeCheckpoint разбирает контрольную точку из снимка
+func DecodeCheckpoint(data []byte) (*Checkpoint, error) {
+	var cp Checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return nil, fmt.Errorf("failed to parse state checkpoint: %w", err)
+	}
+	return &cp, nil
+}
+
+// state строит состояние с параметрами стейкинга config по контрольной
+// точке и сверяет его корень с корнем состояния из заголовка канонического
+// блока контрольной точки: сама контрольная точка берётся из снимка и
+// доверия не заслуживает
+func (cp *Checkpoint) state(block *blockchain.Block, config *pos.StakingConfig) (*WorldState, error) {
+	if cp.Root != block.StateRoot {
+		return nil, fmt.Errorf("%w: checkpoint %d has %s, block has %s", ErrStateRootMismatch, cp.Height, cp.Root, block.StateRoot)
+	}
+	s := NewWorldState()
+	for addr, acc := range cp.Accounts {
+		restored := acc
+		s.accounts[addr] = restored.copy()
+	}
+	if cp.Staking != nil {
+		s.staking = cp.Staking.Copy()
+	}
+	s.staking.SetConfig(config)
+	if cp.Evidence != nil {
+		s.evidence = cp.Evidence.Copy()
+	}
+	s.height = cp.Height
+	if root := s.Root(); root != block.StateRoot {
+		return nil, fmt.Errorf("%w: checkpoint %d has %s, computed %s", ErrStateRootMismatch, cp.Height, block.StateRoot, root)
+	}
+	return s, nil
+}
+
+// Checkpoint возвращает контрольную точку на вершине канонической цепочки
+func (m *StateMachine) Checkpoint() *Checkpoint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tip := m.Chain.GetLatestBlock()
+	return &Checkpoint{
+		Height:   tip.Index,
+		Hash:     tip.Hash,
+		Root:     m.state.Root(),
+		Accounts: m.state.Accounts(),
+		Staking:  m.state.Staking(),
+		Evidence: m.state.Evidence(),
+	}
+}
+
+// Name — имя состояния счетов в снимках узла
+func (m *StateMachine) Name() string {
+	return "state"
+}
+
+// Export возвращает контрольную точку в JSON
+func (m *StateMachine) Export() ([]byte, error) {
+	return json.Marshal(m.Checkpoint())
+}
@@ -0,0 +1,143 @@
+package state
+
+// доказательства нарушений в состоянии: наборы валидаторов недавних эпох
+// для проверки доказательств и уже наказанные нарушения
+
+import (
+	"fmt"
+	"sort"
+
+	"blockchain/codec"
+	"blockchain/consensus/evidence"
+	"blockchain/consensus/pos"
+	"blockchain/storage/blockchain"
+)
+
+// EpochSet — набор валидаторов, действующий с высоты From
+type EpochSet struct {
+	From       int64                 `json:"from"`
+	Validators []pos.ActiveValidator `json:"validators"`
+}
+
+// EvidenceState — наборы валидаторов эпох, доказательства которых ещё не
+// устарели, и ключи включённых в блоки доказательств с высотами нарушений.
+// Входит в корень состояния: доказательства блока проверяет каждый узел,
+// какой бы консенсус его ни собрал.
+type EvidenceState struct {
+	Sets      []EpochSet       `json:"sets,omitempty"`
+	Committed map[string]int64 `json:"committed,omitempty"` // ключ -> высота нарушения
+}
+
+// Copy возвращает независимую копию
+func (e *EvidenceState) Copy() *EvidenceState {
+	c := &EvidenceState{Committed: make(map[string]int64, len(e.Committed))}
+	for _, set := range e.Sets {
+		c.Sets = append(c.Sets, EpochSet{From: set.From, Validators: append([]pos.ActiveValidator(nil), set.Validators...)})
+	}
+	for key, height := range e.Committed {
+		c.Committed[key] = height
+	}
+	return c
+}
+
+// Empty сообщает, что наборов и включённых доказательств нет
+func (e *EvidenceState) Empty() bool {
+	return len(e.Sets) == 0 && len(e.Committed) == 0
+}
+
+// Encode возвращает каноническое кодирование для корня состояния
+func (e *EvidenceState) Encode() []byte {
+	w := codec.NewWriter(codec.KindEvidenceState)
+	w.Len(len(e.Sets))
+	for _, set := range e.Sets {
+		w.Int64(set.From)
+		w.Len(len(set.Validators))
+		for _, v := range set.Validators {
+			w.String(v.Address)
+			w.Int64(v.Power)
+		}
+	}
+
+	keys := make([]string, 0, len(e.Committed))
+	for key := range e.Committed {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	w.Len(len(keys))
+	for _, key := range keys {
+		w.String(key)
+		w.Int64(e.Committed[key])
+	}
+	return w.Result()
+}
+
+// setAt возвращает набор валидаторов высоты height; nil — набор неизвестен
+func (e *EvidenceState) setAt(height int64) pos.ValidatorPool {
+	for i := len(e.Sets) - 1; i >= 0; i-- {
+		if e.Sets[i].From <= height {
+			set := make(pos.ValidatorPool, 0, len(e.Sets[i].Validators))
+			for _, v := range e.Sets[i].Validators {
+				set = append(set, pos.NewValidatorWithAddress(v.Address, v.Address, v.Power))
+			}
+			return set
+		}
+	}
+	return nil
+}
+
+// prune забывает наборы и включённые доказательства, которые блоку height
+// и последующим уже не понадобятся: доказательства старше maxAge устарели
+func (e *EvidenceState) prune(height, maxAge int64) {
+	oldest := height - maxAge
+	for len(e.Sets) > 1 && e.Sets[1].From <= oldest {
+		e.Sets = e.Sets[1:]
+	}
+	for key, h := range e.Committed {
+		if h < oldest {
+			delete(e.Committed, key)
+		}
+	}
+}
+
+// applyEvidence проверяет доказательство блока height и наказывает
+// нарушителя. Доказательство должно относиться к прошлой высоте не старше
+// EvidenceMaxAge, ещё не быть включённым и быть подписано валидатором
+// набора своей высоты; при ошибке состояние не меняется.
+func (s *WorldState) applyEvidence(e *blockchain.Evidence, height int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e == nil {
+		return fmt.Errorf("%w: empty", evidence.ErrInvalidEvidence)
+	}
+	if e.Height >= height {
+		return fmt.Errorf("%w: height %d, block %d", evidence.ErrInvalidEvidence, e.Height, height)
+	}
+	config := s.staking.Config()
+	if e.Height+config.EvidenceMaxAge < height {
+		return fmt.Errorf("%w: height %d, block %d", evidence.ErrExpiredEvidence, e.Height, height)
+	}
+	if _, ok := s.evidence.Committed[e.Key()]; ok {
+		return fmt.Errorf("%w: %s", evidence.ErrCommittedEvidence, e.Key())
+	}
+	set := s.evidence.setAt(e.Height)
+	if set == nil {
+		return fmt.Errorf("%w: no validator set at height %d", evidence.ErrInvalidEvidence, e.Height)
+	}
+	if err := evidence.Verify(set, e); err != nil {
+		return err
+	}
+	if s.evidence.Committed == nil {
+		s.evidence.Committed = make(map[string]int64)
+	}
+	s.evidence.Committed[e.Key()] = e.Height
+	s.staking.Slash(e.Validator, config.SlashFraction)
+	return nil
+}
+
+// Evidence возвращает копию состояния доказательств
+func (s *WorldState) Evidence() *EvidenceState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.evidence.Copy()
+}
@@ -0,0 +1,116 @@
+package state
+
+// начальное распределение средств
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"blockchain/consensus/pos"
+	"blockchain/storage/blockchain"
+	"blockchain/storage/txpool"
+)
+
+// Genesis — начальное состояние счетов и валидаторов и параметры комиссий
+// и стейкинга сети
+type Genesis struct {
+	ChainID    string                `json:"chain_id,omitempty"`   // идентификатор сети; пустой — txpool.DefaultChainID
+	Alloc      map[string]float64    `json:"alloc"`                // адрес -> начальный баланс
+	Validators []GenesisValidator    `json:"validators,omitempty"` // начальный набор валидаторов
+	Fees       *blockchain.FeeConfig `json:"fees,omitempty"`       // параметры рынка комиссий; nil — blockchain.DefaultFeeConfig
+	Staking    *pos.StakingConfig    `json:"staking,omitempty"`    // параметры стейкинга; nil — pos.DefaultStakingConfig
+}
+
+// GenesisValidator — валидатор генезиса; собственный стейк не списывается с Alloc.
+// NodeID — идентификатор ключа узла валидатора (peer.NodeID), по которому
+// его узнают пиры; в состояние не входит.
+type GenesisValidator struct {
+	Address        string  `json:"address"`
+	SelfBond       float64 `json:"self_bond"`
+	CommissionRate float64 `json:"commission_rate"`
+	NodeID         string  `json:"node_id,omitempty"`
+}
+
+// LoadGenesis читает генезис из JSON-файла вида
+// {"chain_id": "cbdc-local", "alloc": {"addr": 1000}, "validators": [{"address": "addr", "self_bond": 100, "commission_rate": 0.1, "node_id": "…"}],
+// "fees": {"treasury": "addr"}, "staking": {"authority": "addr"}}. Не заданные
+// параметры комиссий и стейкинга берутся из blockchain.DefaultFeeConfig и
+// pos.DefaultStakingConfig.
+func LoadGenesis(path string) (*Genesis, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read genesis: %w", err)
+	}
+	g := Genesis{Fees: blockchain.DefaultFeeConfig(), Staking: pos.DefaultStakingConfig()}
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("failed to parse genesis: %w", err)
+	}
+	return &g, nil
+}
+
+// NetworkID возвращает идентификатор сети генезиса; транзакции другой сети
+// отклоняются
+func (g *Genesis) NetworkID() string {
+	if g == nil || g.ChainID == "" {
+		return txpool.DefaultChainID
+	}
+	return g.ChainID
+}
+
+// FeeConfig возвращает параметры комиссий генезиса; nil — параметры по умолчанию
+func (g *Genesis) FeeConfig() *blockchain.FeeConfig {
+	if g == nil {
+		return nil
+	}
+	return g.Fees
+}
+
+// StakingConfig возвращает параметры стейкинга генезиса; nil — параметры по умолчанию
+func (g *Genesis) StakingConfig() *pos.StakingConfig {
+	if g == nil || g.Staking == nil {
+		return pos.DefaultStakingConfig()
+	}
+	return g.Staking
+}
+
+// NodeIDs возвращает идентификаторы узлов валидаторов addresses, заданные
+// в генезисе; валидаторы без NodeID пропускаются
+func (g *Genesis) NodeIDs(addresses []string) []string {
+	if g == nil {
+		return nil
+	}
+	nodes := make(map[string]string, len(g.Validators))
+	for _, v := range g.Validators {
+		if v.NodeID != "" {
+			nodes[v.Address] = v.NodeID
+		}
+	}
+	var ids []string
+	for _, addr := range addresses {
+		if id, ok := nodes[addr]; ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// State строит начальное состояние по генезису
+func (g *Genesis) State() *WorldState {
+	s := NewWorldState()
+	if g == nil {
+		return s
+	}
+	s.staking.SetConfig(g.Staking)
+	for addr, balance := range g.Alloc {
+		s.SetBalance(addr, balance)
+	}
+	for _, v := range g.Validators {
+		if err := s.AddValidator(v.Address, v.SelfBond, v.CommissionRate); err != nil {
+			fmt.Printf("⚠️ Genesis validator %s skipped: %v\n", v.Address, err)
+		}
+	}
+	// Генезис завершает нулевую эпоху: его валидаторы действуют с высоты 1
+	s.EndBlock(0)
+	return s
+}
@@ -0,0 +1,700 @@
+package state
+
+// машина состояний: применение блоков к состоянию счетов
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"blockchain/consensus/pos"
+	"blockchain/storage/blockchain"
+	"blockchain/storage/txpool"
+)
+
+// MaxReorgDepth — максимальная глубина реорганизации; более старые
+// боковые ветки удаляются, а блоки, ответвляющиеся глубже, отклоняются
+const MaxReorgDepth = 64
+
+// stateCacheInterval — через сколько канонических блоков хранится копия
+// состояния: состояние после старого блока, от которого ответвляется
+// боковая ветка, вычисляется от ближайшей копии не больше чем за
+// stateCacheInterval-1 блоков, а не переигрыванием с генезиса
+const stateCacheInterval = 8
+
+var (
+	ErrForkTooDeep            = errors.New("fork point is too deep")
+	ErrForkBelowCommit        = errors.New("fork point is below a committed block")
+	ErrValidatorsHashMismatch = errors.New("next validators hash mismatch")
+	ErrGenesisMismatch        = errors.New("genesis fees do not match chain")
+)
+
+// ImportStatus — результат импорта блока
+type ImportStatus int
+
+const (
+	ImportKnown      ImportStatus = iota // блок уже известен
+	ImportCanonical                      // блок продлил каноническую цепочку
+	ImportSideBranch                     // блок сохранён в боковой ветке
+	ImportReorg                          // блок переключил каноническую цепочку на свою ветку
+)
+
+func (s ImportStatus) String() string {
+	switch s {
+	case ImportKnown:
+		return "known"
+	case ImportCanonical:
+		return "canonical"
+	case ImportSideBranch:
+		return "side-branch"
+	case ImportReorg:
+		return "reorg"
+	default:
+		return "unknown"
+	}
+}
+
+// StateMachine связывает цепочку блоков с состоянием счетов.
+// Все блоки канонической цепочки должны добавляться через ImportBlock/CommitBlock.
+type StateMachine struct {
+	Chain      *blockchain.Blockchain
+	ForkChoice *blockchain.ForkChoice
+
+	genesis       *Genesis
+	state         *WorldState            // состояние на вершине канонической цепочки
+	tree          *blockchain.BlockTree  // блоки боковых веток
+	treeStates    map[string]*WorldState // состояние после блока боковой ветки
+	cached        map[string]cachedState // состояние после канонических блоков, см. stateCacheInterval
+	reorgHandlers []func(blockchain.ReorgEvent)
+	setHandlers   []func(height int64, validators pos.ValidatorPool)
+	verifyCommit  func(validators pos.ValidatorPool, commit *blockchain.Commit) error
+	mu            sync.Mutex
+}
+
+// cachedState — копия состояния после блока высоты height
+type cachedState struct {
+	height int64
+	state  *WorldState
+}
+
+// NewStateMachine строит состояние из генезиса и переигрывает уже
+// сохранённые в цепочке блоки (например, после перезапуска узла).
+// Если передана контрольная точка канонического блока, переигрываются
+// только блоки после неё. Параметры комиссий генезиса, если заданы,
+// должны совпадать с параметрами цепочки (см. blockchain.NewBlockchainWithStore).
+func NewStateMachine(chain *blockchain.Blockchain, genesis *Genesis, checkpoint ...*Checkpoint) (*StateMachine, error) {
+	if genesis != nil && genesis.Fees != nil && *genesis.Fees != *chain.Fees() {
+		return nil, fmt.Errorf("%w: genesis %+v, chain %+v", ErrGenesisMismatch, *genesis.Fees, *chain.Fees())
+	}
+	m := &StateMachine{
+		Chain:      chain,
+		genesis:    genesis,
+		tree:       blockchain.NewBlockTree(),
+		treeStates: make(map[string]*WorldState),
+		cached:     make(map[string]cachedState),
+	}
+	// Правило выбора ветки учитывает стейк валидаторов на вершине цепочки;
+	// Prefer вызывается из importBlock под блокировкой
+	m.ForkChoice = &blockchain.ForkChoice{
+		StakeOf: func(address string) int64 {
+			return m.state.VotingPower(address)
+		},
+	}
+
+	if len(checkpoint) > 0 && checkpoint[0] != nil {
+		s, err := m.replayFrom(checkpoint[0])
+		if err == nil {
+			m.state = s
+			return m, nil
+		}
+		fmt.Printf("⚠️ State checkpoint not usable, replaying from genesis: %v\n", err)
+	}
+
+	s, err := m.replay(chain.Height())
+	if err != nil {
+		return nil, err
+	}
+	m.state = s
+	return m, nil
+}
+
+// replayFrom строит состояние на вершине цепочки от контрольной точки
+func (m *StateMachine) replayFrom(cp *Checkpoint) (*WorldState, error) {
+	block, err := m.Chain.Store().GetByHeight(cp.Height)
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint block %d is missing: %w", cp.Height, err)
+	}
+	if block.Hash != cp.Hash {
+		return nil, fmt.Errorf("checkpoint block %d (%s) is not canonical", cp.Height, cp.Hash)
+	}
+	s, err := cp.state(block, m.genesis.StakingConfig())
+	if err != nil {
+		return nil, err
+	}
+	m.cached[block.Hash] = cachedState{height: block.Index, state: s.Copy()}
+	var replayErr error
+	m.Chain.Store().Iterate(cp.Height+1, m.Chain.Height(), func(block *blockchain.Block) bool {
+		if err := ApplyBlock(s, block, m.Chain.Fees()); err != nil {
+			replayErr = fmt.Errorf("failed to replay block %d: %w", block.Index, err)
+			return false
+		}
+		m.cacheState(block, s)
+		return true
+	})
+	if replayErr != nil {
+		return nil, replayErr
+	}
+	return s, nil
+}
+
+// replay строит состояние после канонического блока height, начиная с генезиса
+func (m *StateMachine) replay(height int64) (*WorldState, error) {
+	s := m.genesis.State()
+	if genesis := m.Chain.GetBlockByHeight(0); genesis != nil {
+		m.cacheState(genesis, s)
+	}
+	var replayErr error
+	m.Chain.Store().Iterate(1, height, func(block *blockchain.Block) bool {
+		if err := ApplyBlock(s, block, m.Chain.Fees()); err != nil {
+			replayErr = fmt.Errorf("failed to replay block %d: %w", block.Index, err)
+			return false
+		}
+		m.cacheState(block, s)
+		return true
+	})
+	if replayErr != nil {
+		return nil, replayErr
+	}
+	return s, nil
+}
+
+// cacheState сохраняет копию состояния s после канонического блока, если
+// его высота кратна stateCacheInterval и от него ещё можно ответвиться
+func (m *StateMachine) cacheState(block *blockchain.Block, s *WorldState) {
+	if block.Index%stateCacheInterval != 0 || block.Index < m.Chain.Height()-MaxReorgDepth-stateCacheInterval {
+		return
+	}
+	m.cached[block.Hash] = cachedState{height: block.Index, state: s.Copy()}
+}
+
+// ApplyBlock применяет блок к состоянию и сверяет корень и хэш следующего
+// набора валидаторов: возвращает стейк, период разблокировки которого
+// истёк, проверяет доказательства блока и наказывает нарушителей (см.
+// applyEvidence), применяет транзакции и на границе эпохи пересчитывает
+// набор валидаторов. Блок с недействительным, устаревшим или уже
+// включённым доказательством отклоняется, каким бы консенсусом он ни был собран.
+// Базовые комиссии зачисляются казначейству из параметров комиссий fees.
+// При ошибке состояние может быть изменено частично — вызывайте на копии.
+func ApplyBlock(s *WorldState, block *blockchain.Block, fees *blockchain.FeeConfig) error {
+	s.BeginBlock(block.Index)
+	for _, e := range block.Evidence {
+		if err := s.applyEvidence(e, block.Index); err != nil {
+			return fmt.Errorf("evidence rejected: %w", err)
+		}
+	}
+	for _, tx := range block.Transactions {
+		if err := s.ApplyTransaction(tx, block.Validator, block.BaseFee); err != nil {
+			return fmt.Errorf("transaction %s rejected: %w", tx.ID, err)
+		}
+	}
+	s.payTreasury(fees.Treasury, block.BaseFee, len(block.Transactions))
+	s.EndBlock(block.Index)
+	if root := s.Root(); root != block.StateRoot {
+		return fmt.Errorf("%w: block %d has %s, computed %s", ErrStateRootMismatch, block.Index, block.StateRoot, root)
+	}
+	if hash := s.ValidatorsHash(); hash != block.NextValidatorsHash {
+		return fmt.Errorf("%w: block %d has %q, computed %q", ErrValidatorsHashMismatch, block.Index, block.NextValidatorsHash, hash)
+	}
+	return nil
+}
+
+// OnReorg регистрирует обработчик реорганизаций цепочки.
+// Обработчики вызываются после того, как новая ветка стала канонической.
+func (m *StateMachine) OnReorg(handler func(blockchain.ReorgEvent)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reorgHandlers = append(m.reorgHandlers, handler)
+}
+
+// OnValidatorSetChange регистрирует обработчик смены набора валидаторов.
+// Обработчик получает первую высоту, на которой действует новый набор;
+// вызывается после того, как блок, завершивший эпоху, стал каноническим.
+func (m *StateMachine) OnValidatorSetChange(handler func(height int64, validators pos.ValidatorPool)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setHandlers = append(m.setHandlers, handler)
+}
+
+// SetCommitVerifier задаёт проверку сертификатов финальности (например,
+// bft.VerifyCommit). Сертификат не входит в хэш блока, поэтому ImportBlock
+// сохраняет его, только если он прошёл проверку набором валидаторов высоты
+// блока; без проверки сертификаты снимаются.
+func (m *StateMachine) SetCommitVerifier(verify func(validators pos.ValidatorPool, commit *blockchain.Commit) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.verifyCommit = verify
+}
+
+// ChainID возвращает идентификатор сети из генезиса
+func (m *StateMachine) ChainID() string {
+	return m.genesis.NetworkID()
+}
+
+// StakingConfig возвращает параметры стейкинга сети из генезиса
+func (m *StateMachine) StakingConfig() *pos.StakingConfig {
+	return m.genesis.StakingConfig()
+}
+
+// NextBaseFee возвращает базовую комиссию следующего блока
+func (m *StateMachine) NextBaseFee() float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.Chain.Fees().NextBaseFee(m.Chain.GetLatestBlock())
+}
+
+// GetAccount возвращает текущее состояние счёта
+func (m *StateMachine) GetAccount(address string) Account {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state.GetAccount(address)
+}
+
+// Root возвращает корень текущего состояния
+func (m *StateMachine) Root() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state.Root()
+}
+
+// Validators возвращает набор валидаторов следующей высоты: набор текущей
+// эпохи из состояния стейкинга на вершине цепочки
+func (m *StateMachine) Validators() pos.ValidatorPool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state.Validators()
+}
+
+// Snapshot возвращает копию текущего состояния
+func (m *StateMachine) Snapshot() *WorldState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state.Copy()
+}
+
+// BuildBlock собирает блок поверх вершины цепочки из транзакций, которые
+// проходят проверку баланса, nonce и базовой комиссии, и записывает в
+// заголовок базовую комиссию и корень состояния. Транзакций берётся не
+// больше MaxTxsPerBlock. Доказательства нарушений, которые проходят проверку
+// состояния, включаются в блок, и нарушители наказываются до применения транзакций.
+// Возвращает блок (nil, если валидных транзакций нет) и отклонённые транзакции.
+func (m *StateMachine) BuildBlock(transactions []*txpool.Transaction, validator string, evidence ...*blockchain.Evidence) (*blockchain.Block, []*txpool.Transaction) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prevBlock := m.Chain.GetLatestBlock()
+	if prevBlock == nil {
+		return nil, nil
+	}
+	block, rejected := buildBlock(m.state.Copy(), m.Chain.Fees(), prevBlock, prevBlock.Commit, transactions, validator, evidence)
+	if len(block.Transactions) == 0 {
+		return nil, rejected
+	}
+	return block, rejected
+}
+
+// BuildBlockAfter собирает блок поверх ещё не зафиксированных блоков
+// pending, продлевающих вершину цепочки (конвейер консенсуса, в котором
+// следующий блок предлагается до фиксации предыдущих). lastCommit —
+// сертификат последнего блока pending (вершины цепочки, если pending пуст).
+// В отличие от BuildBlock блок собирается и без транзакций: пустые блоки
+// продвигают конвейер к фиксации уже предложенных.
+func (m *StateMachine) BuildBlockAfter(pending []*blockchain.Block, lastCommit *blockchain.Commit, transactions []*txpool.Transaction, validator string, evidence ...*blockchain.Evidence) (*blockchain.Block, []*txpool.Transaction, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, prevBlock, err := m.pendingState(pending)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, rejected := buildBlock(s, m.Chain.Fees(), prevBlock, lastCommit, transactions, validator, evidence)
+	return block, rejected, nil
+}
+
+// buildBlock собирает блок поверх prevBlock по состоянию после него
+func buildBlock(pending *WorldState, fees *blockchain.FeeConfig, prevBlock *blockchain.Block, lastCommit *blockchain.Commit, transactions []*txpool.Transaction, validator string, evidence []*blockchain.Evidence) (*blockchain.Block, []*txpool.Transaction) {
+	baseFee := fees.NextBaseFee(prevBlock)
+	limit := fees.MaxTxsPerBlock
+	pending.BeginBlock(prevBlock.Index + 1)
+	var included []*blockchain.Evidence
+	for _, e := range evidence {
+		if err := pending.applyEvidence(e, prevBlock.Index+1); err != nil {
+			fmt.Printf("❌ Evidence rejected: %v\n", err)
+			continue
+		}
+		included = append(included, e)
+	}
+	var accepted, rejected []*txpool.Transaction
+	for _, tx := range transactions {
+		if limit > 0 && len(accepted) >= limit {
+			break
+		}
+		if err := pending.ApplyTransaction(tx, validator, baseFee); err != nil {
+			fmt.Printf("❌ Transaction %s rejected: %v\n", tx.ID, err)
+			rejected = append(rejected, tx)
+			continue
+		}
+		accepted = append(accepted, tx)
+	}
+	pending.payTreasury(fees.Treasury, baseFee, len(accepted))
+	pending.EndBlock(prevBlock.Index + 1)
+
+	timestamp := time.Now().Unix()
+	if timestamp < prevBlock.Timestamp {
+		timestamp = prevBlock.Timestamp
+	}
+	block := &blockchain.Block{
+		Index:        prevBlock.Index + 1,
+		Timestamp:    timestamp,
+		PrevHash:     prevBlock.Hash,
+		Transactions: accepted,
+		Validator:    validator,
+		StateRoot:    pending.Root(),
+		BaseFee:      baseFee,
+		LastCommit:   lastCommit,
+		Evidence:     included,
+	}
+	block.NextValidatorsHash = pending.ValidatorsHash()
+	block.Hash = block.CalculateHash()
+	return block, rejected
+}
+
+// VerifyBlock проверяет, что блок продлевает вершину цепочки и его транзакции
+// применимы к текущему состоянию; ни цепочка, ни состояние не меняются
+func (m *StateMachine) VerifyBlock(block *blockchain.Block) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := blockchain.ValidateBlock(block, m.Chain.GetLatestBlock(), m.Chain.Fees(), m.state.Validators(), m.ChainID()); err != nil {
+		return err
+	}
+	return ApplyBlock(m.state.Copy(), block, m.Chain.Fees())
+}
+
+// VerifyBlockAfter проверяет, что блок продлевает последний из ещё не
+// зафиксированных блоков pending и применим к состоянию после них
+func (m *StateMachine) VerifyBlockAfter(pending []*blockchain.Block, block *blockchain.Block) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, prevBlock, err := m.pendingState(pending)
+	if err != nil {
+		return err
+	}
+	if err := blockchain.ValidateBlock(block, prevBlock, m.Chain.Fees(), s.Validators(), m.ChainID()); err != nil {
+		return err
+	}
+	return ApplyBlock(s, block, m.Chain.Fees())
+}
+
+// ValidatorsAfter возвращает набор валидаторов высоты, следующей за
+// ещё не зафиксированными блоками pending
+func (m *StateMachine) ValidatorsAfter(pending []*blockchain.Block) (pos.ValidatorPool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, _, err := m.pendingState(pending)
+	if err != nil {
+		return nil, err
+	}
+	return s.Validators(), nil
+}
+
+// pendingState применяет к копии состояния вершины блоки pending, которые
+// должны продлевать вершину цепочки по порядку, и возвращает состояние и
+// последний блок. Начало pending может быть уже зафиксировано (например,
+// другим узлом того же процесса) — такие блоки пропускаются. Вызывается
+// под блокировкой.
+func (m *StateMachine) pendingState(pending []*blockchain.Block) (*WorldState, *blockchain.Block, error) {
+	prevBlock := m.Chain.GetLatestBlock()
+	if prevBlock == nil {
+		return nil, nil, fmt.Errorf("empty chain")
+	}
+	s := m.state.Copy()
+	for _, block := range pending {
+		if block.Index <= prevBlock.Index && m.Chain.HasBlock(block.Hash) {
+			continue
+		}
+		if block.PrevHash != prevBlock.Hash {
+			return nil, nil, fmt.Errorf("%w: pending block %d does not extend %s", blockchain.ErrUnknownParent, block.Index, prevBlock.Hash)
+		}
+		if err := ApplyBlock(s, block, m.Chain.Fees()); err != nil {
+			return nil, nil, fmt.Errorf("pending block %d: %w", block.Index, err)
+		}
+		prevBlock = block
+	}
+	return s, prevBlock, nil
+}
+
+// CommitBlock импортирует блок, подтверждённый консенсусом
+func (m *StateMachine) CommitBlock(block *blockchain.Block) error {
+	_, err := m.ImportBlock(block)
+	return err
+}
+
+// ImportBlock проверяет блок (связность, хэш, время, подпись и переход
+// состояния), сохраняет его в каноническую цепочку или боковую ветку и
+// при необходимости переключает цепочку по правилу ForkChoice
+func (m *StateMachine) ImportBlock(block *blockchain.Block) (ImportStatus, error) {
+	m.mu.Lock()
+	before := m.state.ValidatorsHash()
+	status, event, err := m.importBlock(block)
+	handlers := append([]func(blockchain.ReorgEvent){}, m.reorgHandlers...)
+	var validators pos.ValidatorPool
+	if m.state.ValidatorsHash() != before {
+		validators = m.state.Validators()
+	}
+	setHandlers := append([]func(int64, pos.ValidatorPool){}, m.setHandlers...)
+	next := m.Chain.Height() + 1
+	m.mu.Unlock()
+
+	if event != nil {
+		fmt.Printf("🔀 Chain reorganized at height %d: %d blocks orphaned, %d adopted\n",
+			event.CommonAncestor.Index, len(event.Orphaned), len(event.Adopted))
+		for _, handler := range handlers {
+			handler(*event)
+		}
+	}
+	if validators != nil {
+		fmt.Printf("🔄 Validator set changed from height %d: %d validators (%s)\n", next, len(validators), validators.Hash())
+		for _, handler := range setHandlers {
+			handler(next, validators)
+		}
+	}
+	return status, err
+}
+
+func (m *StateMachine) importBlock(block *blockchain.Block) (ImportStatus, *blockchain.ReorgEvent, error) {
+	if block == nil {
+		return ImportKnown, nil, fmt.Errorf("nil block")
+	}
+	if m.Chain.HasBlock(block.Hash) || m.tree.Get(block.Hash) != nil {
+		return ImportKnown, nil, nil
+	}
+
+	parent := m.findBlock(block.PrevHash)
+	if parent == nil {
+		return ImportKnown, nil, fmt.Errorf("%w: %s", blockchain.ErrUnknownParent, block.PrevHash)
+	}
+	tip := m.Chain.GetLatestBlock()
+	if parent.Index < tip.Index-MaxReorgDepth {
+		return ImportKnown, nil, fmt.Errorf("%w: parent %d, head %d", ErrForkTooDeep, parent.Index, tip.Index)
+	}
+	// Решённые консенсусом блоки не откатываются
+	if parent.Index < tip.Index {
+		if committed := m.committedHeight(); parent.Index < committed {
+			return ImportKnown, nil, fmt.Errorf("%w: parent %d, committed %d", ErrForkBelowCommit, parent.Index, committed)
+		}
+	}
+	next, err := m.stateAt(parent)
+	if err != nil {
+		return ImportKnown, nil, err
+	}
+	if err := blockchain.ValidateBlock(block, parent, m.Chain.Fees(), next.Validators(), m.ChainID()); err != nil {
+		return ImportKnown, nil, err
+	}
+	// Сертификат может подменить любой узел, передавший блок: поддельный
+	// закрепил бы ветку, поэтому непроверенный сертификат снимается
+	if block.Commit != nil {
+		if err := m.checkCommit(block, next.Validators()); err != nil {
+			fmt.Printf("⚠️ Dropping commit of block %d: %v\n", block.Index, err)
+			stripped := *block
+			stripped.Commit = nil
+			block = &stripped
+		}
+	}
+	if err := ApplyBlock(next, block, m.Chain.Fees()); err != nil {
+		return ImportKnown, nil, err
+	}
+
+	// Блок продлевает каноническую цепочку
+	if parent.Hash == tip.Hash {
+		if err := m.Chain.AddBlock(block); err != nil {
+			return ImportKnown, nil, fmt.Errorf("failed to store block %d: %w", block.Index, err)
+		}
+		m.state = next
+		m.cacheState(block, next)
+		m.prune()
+		return ImportCanonical, nil, nil
+	}
+
+	// Блок боковой ветки: сохраняем и сравниваем ветки
+	m.tree.Add(block)
+	m.treeStates[block.Hash] = next.Copy()
+
+	candidate, ancestor := m.branch(block)
+	if ancestor == nil {
+		return ImportSideBranch, nil, nil
+	}
+	current := m.Chain.GetBlocks(ancestor.Index+1, tip.Index)
+	if !m.ForkChoice.Prefer(candidate, current) {
+		return ImportSideBranch, nil, nil
+	}
+
+	event, err := m.reorg(ancestor, current, candidate, next)
+	if err != nil {
+		return ImportKnown, nil, err
+	}
+	return ImportReorg, event, nil
+}
+
+// committedHeight возвращает высоту последнего канонического блока с
+// сертификатом финальности не глубже MaxReorgDepth или -1; вызывается под
+// блокировкой
+func (m *StateMachine) committedHeight() int64 {
+	tip := m.Chain.Height()
+	blocks := m.Chain.GetBlocks(max(tip-MaxReorgDepth, 0), tip)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if blockchain.HasCommit(blocks[i : i+1]) {
+			return blocks[i].Index
+		}
+	}
+	return -1
+}
+
+// checkCommit проверяет сертификат блока набором валидаторов его высоты;
+// вызывается под блокировкой
+func (m *StateMachine) checkCommit(block *blockchain.Block, validators pos.ValidatorPool) error {
+	commit := block.Commit
+	if commit.Height != block.Index || commit.BlockHash != block.Hash {
+		return fmt.Errorf("commit for %s at %d does not match the block", commit.BlockHash, commit.Height)
+	}
+	if m.verifyCommit == nil {
+		return fmt.Errorf("no commit verifier")
+	}
+	return m.verifyCommit(validators, commit)
+}
+
+// findBlock ищет блок в канонической цепочке и в боковых ветках
+func (m *StateMachine) findBlock(hash string) *blockchain.Block {
+	if block, err := m.Chain.Store().GetByHash(hash); err == nil {
+		return block
+	}
+	return m.tree.Get(hash)
+}
+
+// stateAt возвращает копию состояния после блока
+func (m *StateMachine) stateAt(block *blockchain.Block) (*WorldState, error) {
+	if tip := m.Chain.GetLatestBlock(); tip != nil && tip.Hash == block.Hash {
+		return m.state.Copy(), nil
+	}
+	if s, ok := m.treeStates[block.Hash]; ok {
+		return s.Copy(), nil
+	}
+	if m.Chain.HasBlock(block.Hash) {
+		return m.canonicalState(block)
+	}
+
+	// Блок боковой ветки без сохранённого состояния (например, покинувший
+	// цепочку при реорганизации) — вычисляем от родителя
+	parent := m.findBlock(block.PrevHash)
+	if parent == nil {
+		return nil, fmt.Errorf("%w: %s", blockchain.ErrUnknownParent, block.PrevHash)
+	}
+	s, err := m.stateAt(parent)
+	if err != nil {
+		return nil, err
+	}
+	if err := ApplyBlock(s, block, m.Chain.Fees()); err != nil {
+		return nil, err
+	}
+	m.treeStates[block.Hash] = s.Copy()
+	return s, nil
+}
+
+// canonicalState вычисляет состояние после старого канонического блока
+// от ближайшей сохранённой копии; вызывается под блокировкой
+func (m *StateMachine) canonicalState(block *blockchain.Block) (*WorldState, error) {
+	for height := block.Index; height >= 0 && height > block.Index-stateCacheInterval; height-- {
+		base := m.Chain.GetBlockByHeight(height)
+		if base == nil {
+			break
+		}
+		cached, ok := m.cached[base.Hash]
+		if !ok {
+			continue
+		}
+		s := cached.state.Copy()
+		for _, b := range m.Chain.GetBlocks(height+1, block.Index) {
+			if err := ApplyBlock(s, b, m.Chain.Fees()); err != nil {
+				return nil, fmt.Errorf("failed to replay block %d: %w", b.Index, err)
+			}
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("%w: no state near block %d", ErrForkTooDeep, block.Index)
+}
+
+// branch возвращает блоки ветки от общего с канонической цепочкой предка
+// (не включая его) до head и самого предка
+func (m *StateMachine) branch(head *blockchain.Block) ([]*blockchain.Block, *blockchain.Block) {
+	var reversed []*blockchain.Block
+	current := head
+	for {
+		reversed = append(reversed, current)
+		if ancestor, err := m.Chain.Store().GetByHash(current.PrevHash); err == nil {
+			branch := make([]*blockchain.Block, len(reversed))
+			for i, b := range reversed {
+				branch[len(reversed)-1-i] = b
+			}
+			return branch, ancestor
+		}
+		current = m.tree.Get(current.PrevHash)
+		if current == nil {
+			return nil, nil
+		}
+	}
+}
+
+// reorg переключает каноническую цепочку на ветку adopted; вызывается под блокировкой
+func (m *StateMachine) reorg(ancestor *blockchain.Block, orphaned, adopted []*blockchain.Block, headState *WorldState) (*blockchain.ReorgEvent, error) {
+	oldHead := m.Chain.GetLatestBlock()
+
+	if err := m.Chain.Rewind(ancestor.Index); err != nil {
+		return nil, fmt.Errorf("failed to rewind chain to %d: %w", ancestor.Index, err)
+	}
+	for _, block := range adopted {
+		if err := m.Chain.AddBlock(block); err != nil {
+			return nil, fmt.Errorf("failed to store block %d during reorg: %w", block.Index, err)
+		}
+		if s, ok := m.treeStates[block.Hash]; ok {
+			m.cacheState(block, s)
+		}
+		m.tree.Remove(block.Hash)
+		delete(m.treeStates, block.Hash)
+	}
+	// Старая ветка остаётся в дереве и может снова стать канонической
+	for _, block := range orphaned {
+		m.tree.Add(block)
+	}
+	m.state = headState
+	m.prune()
+
+	return &blockchain.ReorgEvent{
+		CommonAncestor: ancestor,
+		OldHead:        oldHead,
+		NewHead:        adopted[len(adopted)-1],
+		Orphaned:       orphaned,
+		Adopted:        adopted,
+	}, nil
+}
+
+// prune удаляет боковые ветки глубже MaxReorgDepth и копии состояния,
+// от которых больше нельзя ответвиться
+func (m *StateMachine) prune() {
+	for _, hash := range m.tree.Prune(m.Chain.Height() - MaxReorgDepth) {
+		delete(m.treeStates, hash)
+	}
+	for hash, c := range m.cached {
+		if c.height < m.Chain.Height()-MaxReorgDepth-stateCacheInterval {
+			delete(m.cached, hash)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package state
+
+// стейкинг в состоянии счетов: транзакции валидаторов и делегаторов,
+// возврат отозванного стейка, награды и наказания
+
+import (
+	"errors"
+	"fmt"
+
+	"blockchain/consensus/pos"
+	"blockchain/storage/txpool"
+)
+
+var ErrUnknownTxType = errors.New("unknown transaction type")
+
+// applyStaking применяет стейкинговую транзакцию к состоянию стейкинга;
+// при ошибке состояние не меняется. Вызывается под блокировкой.
+func (s *WorldState) applyStaking(tx *txpool.Transaction) error {
+	data, err := txpool.DecodeStakingData(tx.Data)
+	if err != nil {
+		return fmt.Errorf("invalid staking data: %w", err)
+	}
+	switch tx.Type {
+	case txpool.TxCreateValidator:
+		return s.staking.CreateValidator(tx.From, tx.Amount, data.CommissionRate)
+	case txpool.TxEditValidator:
+		if tx.Amount != 0 {
+			return fmt.Errorf("%w: edit_validator carries amount %f", ErrInvalidAmount, tx.Amount)
+		}
+		return s.staking.EditValidator(tx.From, data.CommissionRate)
+	case txpool.TxDelegate:
+		return s.staking.Delegate(tx.From, tx.To, tx.Amount)
+	case txpool.TxUndelegate:
+		return s.staking.Undelegate(tx.From, tx.To, tx.Amount, s.height)
+	case txpool.TxRedelegate:
+		return s.staking.Redelegate(tx.From, tx.To, data.DstValidator, tx.Amount)
+	case txpool.TxJailValidator, txpool.TxUnjailValidator:
+		if authority := s.staking.Config().Authority; authority == "" || tx.From != authority {
+			return fmt.Errorf("%w: %s", pos.ErrUnauthorized, tx.From)
+		}
+		if tx.Amount != 0 {
+			return fmt.Errorf("%w: %s carries amount %f", ErrInvalidAmount, tx.Type, tx.Amount)
+		}
+		return s.staking.SetJailed(tx.To, tx.Type == txpool.TxJailValidator)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownTxType, tx.Type)
+	}
+}
+
+// payReward зачисляет награду валидатору блока: если он в стейкинге,
+// награда делится между оператором и делегаторами. Вызывается под блокировкой.
+func (s *WorldState) payReward(recipient string, amount float64) {
+	rewards := s.staking.DistributeReward(recipient, amount)
+	if rewards == nil {
+		s.account(recipient).Balance += amount
+		return
+	}
+	for addr, reward := range rewards {
+		s.account(addr).Balance += reward
+	}
+}
+
+// BeginBlock готовит состояние к применению блока height: возвращает
+// на счета стейк, период разблокировки которого истёк
+func (s *WorldState) BeginBlock(height int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.height = height
+	for _, u := range s.staking.Matured(height) {
+		s.account(u.Address).Balance += u.Amount
+	}
+}
+
+// EndBlock завершает блок height; на границе эпохи пересчитывает набор
+// валидаторов и запоминает новый набор для проверки доказательств.
+// Возвращает true, если набор изменился.
+func (s *WorldState) EndBlock(height int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := s.staking.EndBlock(height)
+	if changed {
+		s.evidence.Sets = append(s.evidence.Sets, EpochSet{
+			From:       height + 1,
+			Validators: append([]pos.ActiveValidator(nil), s.staking.Active...),
+		})
+	}
+	s.evidence.prune(height+1, s.staking.Config().EvidenceMaxAge)
+	return changed
+}
+
+// AddValidator регистрирует валидатора с собственным стейком, не списывая
+// его со счёта (используется для генезиса)
+func (s *WorldState) AddValidator(address string, selfBond, commissionRate float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.staking.CreateValidator(address, selfBond, commissionRate)
+}
+
+// Slash наказывает валидатора за доказанное нарушение: списывает долю
+// fraction его стейка и исключает из набора. Возвращает списанную сумму.
+func (s *WorldState) Slash(address string, fraction float64) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.staking.Slash(address, fraction)
+}
+
+// Validators возвращает набор валидаторов текущей эпохи
+func (s *WorldState) Validators() pos.ValidatorPool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.staking.ActiveSet()
+}
+
+// ValidatorsHash возвращает хэш набора валидаторов текущей эпохи
+func (s *WorldState) ValidatorsHash() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.staking.ActiveSet().Hash()
+}
+
+// VotingPower возвращает мощность валидатора по текущему стейку
+func (s *WorldState) VotingPower(address string) int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.staking.VotingPower(address)
+}
+
+// Delegation возвращает стейк делегатора у валидатора в токенах
+func (s *WorldState) Delegation(delegator, validator string) float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.staking.Delegation(delegator, validator)
+}
+
+// Staking возвращает копию состояния стейкинга
+func (s *WorldState) Staking() *pos.StakingState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.staking.Copy()
+}
@@ -0,0 +1,254 @@
+package state
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"blockchain/consensus/evidence"
+	"blockchain/consensus/pos"
+	"blockchain/network/gossip"
+	"blockchain/storage/blockchain"
+	"blockchain/storage/txpool"
+)
+
+func stakingTx(txType txpool.TxType, from, validator string, amount float64, nonce uint64, data *txpool.StakingData) *txpool.Transaction {
+	tx := &txpool.Transaction{ID: string(txType) + "-" + from, From: from, To: validator, Amount: amount, Nonce: nonce, Type: txType}
+	if data != nil {
+		tx.Data = data.Encode()
+	}
+	return tx
+}
+
+func expectBalance(t *testing.T, s *WorldState, address string, want float64) {
+	t.Helper()
+	if got := s.GetAccount(address).Balance; math.Abs(got-want) > 1e-9 {
+		t.Errorf("Expected %s balance %f, got %f", address, want, got)
+	}
+}
+
+// TestStaking_Lifecycle - делегирование, распределение наград, отзыв
+// с периодом разблокировки, перенос стейка и смена комиссии
+func TestStaking_Lifecycle(t *testing.T) {
+	cfg := pos.DefaultStakingConfig()
+	cfg.UnbondingPeriod = 10
+
+	s := (&Genesis{
+		Alloc:      map[string]float64{"alice": 100, "bank2": 60},
+		Validators: []GenesisValidator{{Address: "bank1", SelfBond: 100, CommissionRate: 0.1}},
+		Staking:    cfg,
+	}).State()
+	s.BeginBlock(1)
+
+	apply := func(tx *txpool.Transaction) {
+		t.Helper()
+		if err := s.ApplyTransaction(tx, "bank1", 0); err != nil {
+			t.Fatalf("%s rejected: %v", tx.Type, err)
+		}
+	}
+	apply(stakingTx(txpool.TxDelegate, "alice", "bank1", 50, 0, nil))
+	apply(stakingTx(txpool.TxCreateValidator, "bank2", "bank2", 40, 0, &txpool.StakingData{CommissionRate: 0.2}))
+	expectBalance(t, s, "alice", 50)
+	expectBalance(t, s, "bank2", 20)
+	s.EndBlock(cfg.EpochLength)
+	if set := s.Validators(); len(set) != 2 || set[0].Address != "bank1" || set[0].VotingPower() != 150 || set[1].VotingPower() != 40 {
+		t.Fatalf("Unexpected validator set %+v", set)
+	}
+
+	// Надбавка валидатору: 10% комиссии оператору, остальное по долям 100:50
+	tip := &txpool.Transaction{ID: "tip", From: "alice", To: "carol", Amount: 1, Fee: 3, Tip: 3, Nonce: 1}
+	apply(tip)
+	expectBalance(t, s, "bank1", 0.3+1.8)
+	expectBalance(t, s, "alice", 50-1-3+0.9)
+
+	// Отзыв возвращается на счёт только после периода разблокировки
+	s.BeginBlock(5)
+	apply(stakingTx(txpool.TxUndelegate, "alice", "bank1", 20, 2, nil))
+	if got := s.Delegation("alice", "bank1"); math.Abs(got-30) > 1e-9 {
+		t.Errorf("Expected alice delegation 30, got %f", got)
+	}
+	before := s.GetAccount("alice").Balance
+	s.BeginBlock(14)
+	expectBalance(t, s, "alice", before)
+	s.BeginBlock(15)
+	expectBalance(t, s, "alice", before+20)
+
+	// Перенос стейка сразу меняет мощность обоих валидаторов
+	apply(stakingTx(txpool.TxRedelegate, "alice", "bank1", 10, 3, &txpool.StakingData{DstValidator: "bank2"}))
+	if p1, p2 := s.VotingPower("bank1"), s.VotingPower("bank2"); p1 != 120 || p2 != 50 {
+		t.Errorf("Expected powers 120 and 50 after redelegation, got %d and %d", p1, p2)
+	}
+
+	// Ошибочные транзакции не меняют состояние
+	root := s.Root()
+	rejected := map[string]*txpool.Transaction{
+		"commission above maximum": stakingTx(txpool.TxEditValidator, "bank1", "bank1", 0, 0, &txpool.StakingData{CommissionRate: 0.9}),
+		"undelegate too much":      stakingTx(txpool.TxUndelegate, "alice", "bank2", 11, 4, nil),
+		"unknown validator":        stakingTx(txpool.TxDelegate, "alice", "nobody", 1, 4, nil),
+		"validator exists":         stakingTx(txpool.TxCreateValidator, "bank2", "bank2", 10, 1, nil),
+	}
+	for name, tx := range rejected {
+		if err := s.ApplyTransaction(tx, "bank1", 0); err == nil {
+			t.Errorf("%s: expected rejection", name)
+		}
+	}
+	if s.Root() != root {
+		t.Errorf("Rejected staking transactions changed the state")
+	}
+
+	apply(stakingTx(txpool.TxEditValidator, "bank1", "bank1", 0, 0, &txpool.StakingData{CommissionRate: 0.05}))
+	if got := s.Staking().Validators["bank1"].CommissionRate; got != 0.05 {
+		t.Errorf("Expected commission 0.05, got %f", got)
+	}
+}
+
+// TestStateMachine_EpochValidators - изменения стейкинга и исключение
+// нарушителя вступают в силу только после блока, завершающего эпоху; хэш
+// нового набора записывается в его заголовок, а подписчики узнают о смене.
+// Доказательства проверяет само состояние: поддельные и повторные
+// отклоняются. Контрольная точка сохраняет состояние стейкинга.
+func TestStateMachine_EpochValidators(t *testing.T) {
+	cfg := pos.DefaultStakingConfig()
+	cfg.EpochLength = 3
+
+	genesis := &Genesis{
+		Alloc: map[string]float64{"alice": 100},
+		Validators: []GenesisValidator{
+			{Address: "bank1", SelfBond: 100},
+			{Address: "bank2", SelfBond: 200},
+		},
+		Staking: cfg,
+	}
+	machine, err := NewStateMachine(newFeeChain(t, zeroFees()), genesis)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initial := machine.Validators()
+	if len(initial) != 2 || initial[1].VotingPower() != 200 {
+		t.Fatalf("Unexpected genesis validator set %+v", initial)
+	}
+	var changes []int64
+	machine.OnValidatorSetChange(func(height int64, validators pos.ValidatorPool) {
+		changes = append(changes, height)
+	})
+
+	// Блок 1: делегирование; доказательство без подписей в блок не попадает
+	fabricated := &blockchain.Evidence{Type: blockchain.DuplicateVote, Height: 1, Validator: "bank2"}
+	block, _ := machine.BuildBlock([]*txpool.Transaction{signTx(t, stakingTx(txpool.TxDelegate, "alice", "bank1", 50, 0, nil))}, "bank1", fabricated)
+	if block == nil || len(block.Evidence) != 0 {
+		t.Fatal("Expected block without fabricated evidence to be built")
+	}
+	if err := machine.CommitBlock(signBlock(t, block)); err != nil {
+		t.Fatalf("Failed to commit block: %v", err)
+	}
+
+	// Блок 2: два голоса bank2 (индекс 1 в наборе) за разные блоки высоты 1
+	vote := func(blockHash string) blockchain.SignedData {
+		data := gossip.VoteSignBytes(gossip.StatePrecommit, 1, 0, blockHash, 1, 1700000000)
+		sig, err := testSigner(t, "bank2").Sign(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return blockchain.SignedData{Data: data, Signature: sig}
+	}
+	offence, err := evidence.NewDuplicateVote("bank2", vote("a"), vote("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ = machine.BuildBlock([]*txpool.Transaction{signTx(t, &txpool.Transaction{ID: "tx", From: "alice", To: "bob", Amount: 1, Nonce: 1})}, "bank1", offence)
+	if block == nil || len(block.Evidence) != 1 {
+		t.Fatal("Expected block with evidence to be built")
+	}
+	// Блок другого консенсуса с поддельным доказательством отклоняется состоянием
+	forged := *block
+	forged.Evidence = []*blockchain.Evidence{fabricated}
+	forged.Hash = forged.CalculateHash()
+	if err := machine.CommitBlock(signBlock(t, &forged)); !errors.Is(err, evidence.ErrInvalidEvidence) {
+		t.Fatalf("Expected ErrInvalidEvidence, got %v", err)
+	}
+	if err := machine.CommitBlock(signBlock(t, block)); err != nil {
+		t.Fatalf("Failed to commit block: %v", err)
+	}
+	if block.NextValidatorsHash != initial.Hash() || machine.Validators().Hash() != initial.Hash() || len(changes) != 0 {
+		t.Fatalf("Validator set changed inside the epoch")
+	}
+	slashed := machine.Snapshot().Staking().Validators["bank2"]
+	if !slashed.Jailed || slashed.Tokens != 200*(1-cfg.SlashFraction) {
+		t.Errorf("Expected bank2 slashed and jailed, got %+v", slashed)
+	}
+
+	// Блок 3 завершает эпоху: с высоты 4 действует новый набор. Повторно
+	// включённое доказательство отклоняется
+	block, _ = machine.BuildBlock([]*txpool.Transaction{signTx(t, &txpool.Transaction{ID: "tx-2", From: "alice", To: "bob", Amount: 1, Nonce: 2})}, "bank1")
+	repeated := *block
+	repeated.Evidence = []*blockchain.Evidence{offence}
+	repeated.Hash = repeated.CalculateHash()
+	if err := machine.CommitBlock(signBlock(t, &repeated)); !errors.Is(err, evidence.ErrCommittedEvidence) {
+		t.Fatalf("Expected ErrCommittedEvidence, got %v", err)
+	}
+	if err := machine.CommitBlock(signBlock(t, block)); err != nil {
+		t.Fatalf("Failed to commit block: %v", err)
+	}
+	set := machine.Validators()
+	if len(set) != 1 || set[0].Address != "bank1" || set[0].VotingPower() != 150 {
+		t.Fatalf("Expected only bank1 with power 150, got %+v", set)
+	}
+	if block.NextValidatorsHash != set.Hash() || len(changes) != 1 || changes[0] != 4 {
+		t.Errorf("Expected new set hash in header and one change from height 4, got %v", changes)
+	}
+
+	// bank2 выбыл из набора: его блок отклоняется, хотя ключ зарегистрирован
+	outsider, _ := machine.BuildBlock([]*txpool.Transaction{signTx(t, &txpool.Transaction{ID: "tx-3", From: "alice", To: "bob", Amount: 1, Nonce: 3})}, "bank2")
+	if err := machine.CommitBlock(signBlock(t, outsider)); !errors.Is(err, blockchain.ErrNotValidator) {
+		t.Errorf("Expected ErrNotValidator, got %v", err)
+	}
+
+	// Заголовок с чужим хэшем набора отклоняется
+	wrongSet, _ := machine.BuildBlock([]*txpool.Transaction{signTx(t, &txpool.Transaction{ID: "tx-3", From: "alice", To: "bob", Amount: 1, Nonce: 3})}, "bank1")
+	wrongSet.NextValidatorsHash = initial.Hash()
+	wrongSet.Hash = wrongSet.CalculateHash()
+	if err := machine.CommitBlock(signBlock(t, wrongSet)); !errors.Is(err, ErrValidatorsHashMismatch) {
+		t.Errorf("Expected ErrValidatorsHashMismatch, got %v", err)
+	}
+
+	restored, err := NewStateMachine(machine.Chain, genesis, machine.Checkpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Root() != machine.Root() || restored.Validators().Hash() != set.Hash() {
+		t.Errorf("Checkpoint lost staking state")
+	}
+}
+
+// TestStaking_GovernanceJail - исключать и возвращать валидаторов может только адрес говернанса
+func TestStaking_GovernanceJail(t *testing.T) {
+	cfg := pos.DefaultStakingConfig()
+	cfg.Authority = "governance"
+
+	s := (&Genesis{
+		Validators: []GenesisValidator{{Address: "bank1", SelfBond: 100}, {Address: "bank2", SelfBond: 100}},
+		Staking:    cfg,
+	}).State()
+	if err := s.ApplyTransaction(stakingTx(txpool.TxJailValidator, "bank1", "bank2", 0, 0, nil), "bank1", 0); !errors.Is(err, pos.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized, got %v", err)
+	}
+	if err := s.ApplyTransaction(stakingTx(txpool.TxJailValidator, "governance", "bank2", 0, 0, nil), "bank1", 0); err != nil {
+		t.Fatal(err)
+	}
+	s.EndBlock(cfg.EpochLength)
+	if set := s.Validators(); len(set) != 1 || set[0].Address != "bank1" {
+		t.Fatalf("Expected bank2 removed from the set, got %d validators", len(set))
+	}
+	if err := s.ApplyTransaction(stakingTx(txpool.TxUnjailValidator, "governance", "bank2", 0, 1, nil), "bank1", 0); err != nil {
+		t.Fatal(err)
+	}
+	s.EndBlock(2 * cfg.EpochLength)
+	if len(s.Validators()) != 2 {
+		t.Errorf("Expected bank2 back in the set")
+	}
+	// Адрес говернанса задаёт генезис: у сети без него исключение отклоняется
+	other := (&Genesis{Validators: []GenesisValidator{{Address: "bank1", SelfBond: 100}, {Address: "bank2", SelfBond: 100}}}).State()
+	if err := other.ApplyTransaction(stakingTx(txpool.TxJailValidator, "governance", "bank2", 0, 0, nil), "bank1", 0); !errors.Is(err, pos.ErrUnauthorized) {
+		t.Errorf("Expected ErrUnauthorized without a genesis authority, got %v", err)
+	}
+}
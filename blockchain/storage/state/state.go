@@ -0,0 +1,253 @@
+package state
+
+// состояние счетов (world state)
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"blockchain/consensus/pos"
+	"blockchain/storage/txpool"
+)
+
+var (
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	ErrInvalidNonce        = errors.New("invalid nonce")
+	ErrInvalidAmount       = errors.New("invalid amount")
+	ErrStateRootMismatch   = errors.New("state root mismatch")
+	ErrFeeTooLow           = errors.New("fee below block base fee")
+)
+
+// Account — состояние одного счёта
+type Account struct {
+	Balance  float64           `json:"balance"`
+	Nonce    uint64            `json:"nonce"` // номер следующей ожидаемой транзакции
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+func (a *Account) copy() *Account {
+	c := &Account{
+		Balance: a.Balance,
+		Nonce:   a.Nonce,
+	}
+	if len(a.Metadata) > 0 {
+		c.Metadata = make(map[string]string, len(a.Metadata))
+		for k, v := range a.Metadata {
+			c.Metadata[k] = v
+		}
+	}
+	return c
+}
+
+// WorldState — балансы, nonce и метаданные всех счетов, состояние
+// стейкинга и доказательств нарушений
+type WorldState struct {
+	accounts map[string]*Account
+	staking  *pos.StakingState
+	evidence *EvidenceState
+	height   int64 // высота применяемого блока (см. BeginBlock)
+	mu       sync.RWMutex
+}
+
+func NewWorldState() *WorldState {
+	return &WorldState{
+		accounts: make(map[string]*Account),
+		staking:  pos.NewStakingState(nil),
+		evidence: &EvidenceState{},
+	}
+}
+
+// Copy возвращает независимую копию состояния
+func (s *WorldState) Copy() *WorldState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c := NewWorldState()
+	for addr, acc := range s.accounts {
+		c.accounts[addr] = acc.copy()
+	}
+	c.staking = s.staking.Copy()
+	c.evidence = s.evidence.Copy()
+	c.height = s.height
+	return c
+}
+
+// GetAccount возвращает копию счёта (пустой счёт, если адрес не встречался)
+func (s *WorldState) GetAccount(address string) Account {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	acc, exists := s.accounts[address]
+	if !exists {
+		return Account{}
+	}
+	return *acc.copy()
+}
+
+// SetBalance устанавливает баланс счёта (используется для генезиса)
+func (s *WorldState) SetBalance(address string, balance float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.account(address).Balance = balance
+}
+
+// SetMetadata сохраняет произвольное значение в метаданных счёта
+func (s *WorldState) SetMetadata(address, key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acc := s.account(address)
+	if acc.Metadata == nil {
+		acc.Metadata = make(map[string]string)
+	}
+	acc.Metadata[key] = value
+}
+
+// account возвращает счёт, создавая его при необходимости; вызывается под блокировкой
+func (s *WorldState) account(address string) *Account {
+	acc, exists := s.accounts[address]
+	if !exists {
+		acc = &Account{}
+		s.accounts[address] = acc
+	}
+	return acc
+}
+
+// ApplyTransaction списывает с отправителя Amount и фактическую комиссию
+// (baseFee плюс надбавка, не более Fee), зачисляет Amount получателю,
+// надбавку — feeRecipient (валидатору блока; если он в стейкинге — делится
+// с его делегаторами), а базовую комиссию сжигает (казначейству её
+// зачисляет ApplyBlock, см. payTreasury). Стейкинговые транзакции вместо
+// перевода меняют состояние стейкинга (см. applyStaking).
+func (s *WorldState) ApplyTransaction(tx *txpool.Transaction, feeRecipient string, baseFee float64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tx.Amount < 0 || tx.Fee < 0 || tx.Tip < 0 || math.IsNaN(tx.Amount) || math.IsNaN(tx.Fee) || math.IsNaN(tx.Tip) {
+		return fmt.Errorf("%w: amount %f, fee %f, tip %f", ErrInvalidAmount, tx.Amount, tx.Fee, tx.Tip)
+	}
+	tip := tx.EffectiveTip(baseFee)
+	if tip < 0 {
+		return fmt.Errorf("%w: fee %f, base fee %f", ErrFeeTooLow, tx.Fee, baseFee)
+	}
+
+	// Счёт отправителя создаётся только при успешном применении: иначе
+	// отклонённая транзакция с нового адреса меняла бы корень состояния
+	sender, exists := s.accounts[tx.From]
+	if !exists {
+		sender = &Account{}
+	}
+	if tx.Nonce != sender.Nonce {
+		return fmt.Errorf("%w: %s expected %d, got %d", ErrInvalidNonce, tx.From, sender.Nonce, tx.Nonce)
+	}
+
+	total := baseFee + tip
+	if tx.Type.Bonds() {
+		total += tx.Amount
+	}
+	if sender.Balance < total {
+		return fmt.Errorf("%w: %s has %f, needs %f", ErrInsufficientBalance, tx.From, sender.Balance, total)
+	}
+	if tx.Type != txpool.TxTransfer {
+		if err := s.applyStaking(tx); err != nil {
+			return err
+		}
+	}
+
+	if !exists {
+		s.accounts[tx.From] = sender
+	}
+	sender.Balance -= total
+	sender.Nonce++
+	if tx.Type == txpool.TxTransfer {
+		s.account(tx.To).Balance += tx.Amount
+	}
+	if tip > 0 {
+		s.payReward(feeRecipient, tip)
+	}
+	return nil
+}
+
+// payTreasury зачисляет казначейству базовую комиссию каждой из count
+// транзакций блока; без казначейства базовая комиссия остаётся сожжённой
+func (s *WorldState) payTreasury(treasury string, baseFee float64, count int) {
+	if treasury == "" || baseFee <= 0 || count == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acc := s.account(treasury)
+	for i := 0; i < count; i++ {
+		acc.Balance += baseFee
+	}
+}
+
+// Root вычисляет детерминированный корень состояния: SHA-256 от
+// отсортированных по адресу канонических записей счетов, состояния стейкинга
+// и доказательств
+func (s *WorldState) Root() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	addresses := make([]string, 0, len(s.accounts))
+	for addr := range s.accounts {
+		addresses = append(addresses, addr)
+	}
+	sort.Strings(addresses)
+
+	h := sha256.New()
+	var num [8]byte
+	writeString := func(v string) {
+		binary.BigEndian.PutUint64(num[:], uint64(len(v)))
+		h.Write(num[:])
+		h.Write([]byte(v))
+	}
+
+	for _, addr := range addresses {
+		acc := s.accounts[addr]
+		writeString(addr)
+		binary.BigEndian.PutUint64(num[:], math.Float64bits(acc.Balance))
+		h.Write(num[:])
+		binary.BigEndian.PutUint64(num[:], acc.Nonce)
+		h.Write(num[:])
+
+		keys := make([]string, 0, len(acc.Metadata))
+		for k := range acc.Metadata {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		binary.BigEndian.PutUint64(num[:], uint64(len(keys)))
+		h.Write(num[:])
+		for _, k := range keys {
+			writeString(k)
+			writeString(acc.Metadata[k])
+		}
+	}
+	// Пустой стейкинг не меняет корень: состояния без валидаторов
+	// совпадают с состояниями, записанными до появления стейкинга
+	if !s.staking.Empty() {
+		h.Write(s.staking.Encode())
+	}
+	if !s.evidence.Empty() {
+		h.Write(s.evidence.Encode())
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Accounts возвращает копию всех счетов
+func (s *WorldState) Accounts() map[string]Account {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := make(map[string]Account, len(s.accounts))
+	for addr, acc := range s.accounts {
+		result[addr] = *acc.copy()
+	}
+	return result
+}
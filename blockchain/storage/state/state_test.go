@@ -0,0 +1,680 @@
+package state
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"blockchain/consensus/pos"
+	"blockchain/crypto/signature"
+	"blockchain/storage/blockchain"
+	"blockchain/storage/txpool"
+)
+
+var (
+	testSigners   = make(map[string]*signature.ECDSASigner)
+	testSignersMu sync.Mutex
+)
+
+// testSigner возвращает ключ адреса, регистрируя его при первом использовании
+func testSigner(t *testing.T, address string) *signature.ECDSASigner {
+	testSignersMu.Lock()
+	defer testSignersMu.Unlock()
+
+	signer, ok := testSigners[address]
+	if !ok {
+		var err error
+		signer, err = signature.NewECDSASigner()
+		if err != nil {
+			t.Fatalf("Failed to create signer: %v", err)
+		}
+		pubKey, err := signature.ParsePublicKey(signer.PublicKey())
+		if err != nil {
+			t.Fatalf("Failed to parse public key: %v", err)
+		}
+		signature.RegisterPublicKey(address, pubKey)
+		testSigners[address] = signer
+	}
+	return signer
+}
+
+// signBlock подписывает блок ключом его валидатора
+func signBlock(t *testing.T, block *blockchain.Block) *blockchain.Block {
+	sig, err := testSigner(t, block.Validator).Sign(block.SerializeWithoutSignature())
+	if err != nil {
+		t.Fatalf("Failed to sign block: %v", err)
+	}
+	block.Signature = sig
+	return block
+}
+
+// signTx подписывает транзакцию ключом отправителя и пересчитывает её ID
+func signTx(t *testing.T, tx *txpool.Transaction) *txpool.Transaction {
+	tx.ChainID = txpool.DefaultChainID
+	tx.ID = tx.ComputeID()
+	sig, err := testSigner(t, tx.From).Sign(tx.Serialize())
+	if err != nil {
+		t.Fatalf("Failed to sign transaction: %v", err)
+	}
+	tx.Signature = hex.EncodeToString(sig)
+	return tx
+}
+
+// zeroFees отключает базовую комиссию: тесты цепочки и реорганизаций используют
+// транзакции без комиссии. Рынок комиссий проверяется в TestFeeMarket.
+func zeroFees() *blockchain.FeeConfig {
+	cfg := blockchain.DefaultFeeConfig()
+	cfg.InitialBaseFee, cfg.MinBaseFee = 0, 0
+	return cfg
+}
+
+// newFeeChain создаёт цепочку в памяти с параметрами комиссий fees
+func newFeeChain(t *testing.T, fees *blockchain.FeeConfig) *blockchain.Blockchain {
+	t.Helper()
+	chain, err := blockchain.NewBlockchainWithStore(blockchain.NewMemoryBlockStore(), fees)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chain
+}
+
+func newTestMachine(t *testing.T) *StateMachine {
+	return newFeeMachine(t, zeroFees())
+}
+
+func newFeeMachine(t *testing.T, fees *blockchain.FeeConfig) *StateMachine {
+	t.Helper()
+	genesis := &Genesis{Alloc: map[string]float64{"alice": 100}}
+	machine, err := NewStateMachine(newFeeChain(t, fees), genesis)
+	if err != nil {
+		t.Fatalf("Failed to create state machine: %v", err)
+	}
+	return machine
+}
+
+// TestApplyTransaction_Rules - списание, nonce и перерасход
+func TestApplyTransaction_Rules(t *testing.T) {
+	s := (&Genesis{Alloc: map[string]float64{"alice": 100}}).State()
+
+	// Fee покрывает базовую комиссию 0.5 и надбавку 0.5
+	if err := s.ApplyTransaction(&txpool.Transaction{ID: "tx-1", From: "alice", To: "bob", Amount: 40, Fee: 1, Tip: 0.7}, "validator1", 0.5); err != nil {
+		t.Fatalf("Expected transaction to apply, got %v", err)
+	}
+	if got := s.GetAccount("alice"); got.Balance != 59 || got.Nonce != 1 {
+		t.Errorf("Unexpected sender state: %+v", got)
+	}
+	if got := s.GetAccount("bob").Balance; got != 40 {
+		t.Errorf("Expected receiver balance 40, got %f", got)
+	}
+	if got := s.GetAccount("validator1").Balance; got != 0.5 {
+		t.Errorf("Expected tip 0.5 for validator, got %f", got)
+	}
+
+	// Комиссия ниже базовой
+	err := s.ApplyTransaction(&txpool.Transaction{ID: "tx-2", From: "alice", To: "bob", Amount: 1, Fee: 0.4, Nonce: 1}, "validator1", 0.5)
+	if !errors.Is(err, ErrFeeTooLow) {
+		t.Errorf("Expected ErrFeeTooLow, got %v", err)
+	}
+
+	// Повторное использование nonce
+	err = s.ApplyTransaction(&txpool.Transaction{ID: "tx-2", From: "alice", To: "bob", Amount: 1, Nonce: 0}, "validator1", 0)
+	if !errors.Is(err, ErrInvalidNonce) {
+		t.Errorf("Expected ErrInvalidNonce, got %v", err)
+	}
+
+	// Перерасход
+	err = s.ApplyTransaction(&txpool.Transaction{ID: "tx-3", From: "alice", To: "bob", Amount: 100, Nonce: 1}, "validator1", 0)
+	if !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("Expected ErrInsufficientBalance, got %v", err)
+	}
+	if got := s.GetAccount("alice"); got.Balance != 59 || got.Nonce != 1 {
+		t.Errorf("Rejected transactions must not change state: %+v", got)
+	}
+
+	// Отклонённая транзакция с нового адреса не создаёт счёт
+	root := s.Root()
+	err = s.ApplyTransaction(&txpool.Transaction{ID: "tx-4", From: "mallory", To: "bob", Amount: 1}, "validator1", 0)
+	if !errors.Is(err, ErrInsufficientBalance) {
+		t.Errorf("Expected ErrInsufficientBalance, got %v", err)
+	}
+	if s.Root() != root {
+		t.Errorf("Rejected transaction from a new address must not change the state root")
+	}
+}
+
+// TestRoot_Deterministic - корень не зависит от порядка создания счетов
+func TestRoot_Deterministic(t *testing.T) {
+	a := NewWorldState()
+	a.SetBalance("alice", 10)
+	a.SetBalance("bob", 20)
+	a.SetMetadata("bob", "bank", "A")
+
+	b := NewWorldState()
+	b.SetMetadata("bob", "bank", "A")
+	b.SetBalance("bob", 20)
+	b.SetBalance("alice", 10)
+
+	if a.Root() != b.Root() {
+		t.Errorf("Expected equal roots, got %s and %s", a.Root(), b.Root())
+	}
+	b.SetBalance("alice", 11)
+	if a.Root() == b.Root() {
+		t.Errorf("Expected roots to differ after balance change")
+	}
+}
+
+// TestStateMachine_BuildAndCommit - блок собирается только из валидных транзакций
+func TestStateMachine_BuildAndCommit(t *testing.T) {
+	machine := newTestMachine(t)
+
+	txs := []*txpool.Transaction{
+		signTx(t, &txpool.Transaction{ID: "tx-1", From: "alice", To: "bob", Amount: 30, Nonce: 0}),
+		signTx(t, &txpool.Transaction{ID: "tx-2", From: "alice", To: "bob", Amount: 30, Nonce: 0}),  // повтор nonce
+		signTx(t, &txpool.Transaction{ID: "tx-3", From: "bob", To: "carol", Amount: 500, Nonce: 0}), // перерасход
+		signTx(t, &txpool.Transaction{ID: "tx-4", From: "alice", To: "carol", Amount: 30, Nonce: 1}),
+		signTx(t, &txpool.Transaction{ID: "tx-5", From: "mallory", To: "bob", Amount: 5, Nonce: 0}), // новый счёт без средств
+	}
+	block, rejected := machine.BuildBlock(txs, "validator1")
+	if block == nil {
+		t.Fatal("Expected block to be built")
+	}
+	if len(block.Transactions) != 2 || len(rejected) != 3 {
+		t.Fatalf("Expected 2 accepted and 3 rejected, got %d and %d", len(block.Transactions), len(rejected))
+	}
+
+	if err := machine.CommitBlock(signBlock(t, block)); err != nil {
+		t.Fatalf("Failed to commit block: %v", err)
+	}
+	if machine.Root() != block.StateRoot {
+		t.Errorf("Expected state root %s, got %s", block.StateRoot, machine.Root())
+	}
+	if got := machine.GetAccount("alice").Balance; got != 40 {
+		t.Errorf("Expected alice balance 40, got %f", got)
+	}
+
+	// Блок с подменённым корнем отклоняется целиком
+	forged, _ := machine.BuildBlock([]*txpool.Transaction{signTx(t, &txpool.Transaction{ID: "tx-5", From: "alice", To: "bob", Amount: 1, Nonce: 2})}, "validator1")
+	forged.StateRoot = "forged"
+	forged.Hash = forged.CalculateHash()
+	if err := machine.CommitBlock(signBlock(t, forged)); !errors.Is(err, ErrStateRootMismatch) {
+		t.Errorf("Expected ErrStateRootMismatch, got %v", err)
+	}
+	if machine.Chain.Height() != 1 {
+		t.Errorf("Rejected block must not be stored, height %d", machine.Chain.Height())
+	}
+}
+
+// TestStateMachine_BuildAfterPending - блоки собираются и проверяются поверх
+// незафиксированных, в том числе после фиксации части из них
+func TestStateMachine_BuildAfterPending(t *testing.T) {
+	machine := newTestMachine(t)
+
+	b1, _, err := machine.BuildBlockAfter(nil, nil, []*txpool.Transaction{signTx(t, &txpool.Transaction{ID: "tx-1", From: "alice", To: "bob", Amount: 30})}, "validator1")
+	if err != nil || len(b1.Transactions) != 1 {
+		t.Fatalf("Expected block with 1 transaction, got %v", err)
+	}
+	signBlock(t, b1)
+
+	// Nonce 1 исполним только после незафиксированного b1; повтор nonce 0 — нет
+	txs := []*txpool.Transaction{
+		signTx(t, &txpool.Transaction{ID: "tx-2", From: "alice", To: "carol", Amount: 30, Nonce: 1}),
+		signTx(t, &txpool.Transaction{ID: "tx-3", From: "alice", To: "carol", Amount: 30, Nonce: 0}),
+	}
+	b2, rejected, err := machine.BuildBlockAfter([]*blockchain.Block{b1}, nil, txs, "validator1")
+	if err != nil || len(b2.Transactions) != 1 || len(rejected) != 1 || b2.PrevHash != b1.Hash {
+		t.Fatalf("Expected b2 on top of b1 with 1 accepted and 1 rejected, got %v", err)
+	}
+	signBlock(t, b2)
+	if err := machine.VerifyBlockAfter([]*blockchain.Block{b1}, b2); err != nil {
+		t.Errorf("Expected b2 to be valid after b1, got %v", err)
+	}
+	if err := machine.VerifyBlock(b2); err == nil {
+		t.Error("Expected b2 to be invalid on top of the chain tip")
+	}
+
+	// Пустой блок допустим и продвигает конвейер
+	b3, _, err := machine.BuildBlockAfter([]*blockchain.Block{b1, b2}, nil, nil, "validator1")
+	if err != nil || len(b3.Transactions) != 0 {
+		t.Fatalf("Expected empty block, got %v", err)
+	}
+	signBlock(t, b3)
+
+	// Уже зафиксированное начало ветки пропускается
+	if err := machine.CommitBlock(b1); err != nil {
+		t.Fatalf("Failed to commit b1: %v", err)
+	}
+	if err := machine.VerifyBlockAfter([]*blockchain.Block{b1, b2}, b3); err != nil {
+		t.Errorf("Expected b3 to be valid after committed b1 and pending b2, got %v", err)
+	}
+	if _, err := machine.ValidatorsAfter([]*blockchain.Block{b3}); !errors.Is(err, blockchain.ErrUnknownParent) {
+		t.Errorf("Expected ErrUnknownParent for a branch not extending the tip, got %v", err)
+	}
+}
+
+// TestStateMachine_Replay - состояние восстанавливается по сохранённым блокам
+func TestStateMachine_Replay(t *testing.T) {
+	machine := newTestMachine(t)
+	block, _ := machine.BuildBlock([]*txpool.Transaction{signTx(t, &txpool.Transaction{ID: "tx-1", From: "alice", To: "bob", Amount: 25})}, "validator1")
+	if err := machine.CommitBlock(signBlock(t, block)); err != nil {
+		t.Fatalf("Failed to commit block: %v", err)
+	}
+
+	replayed, err := NewStateMachine(machine.Chain, &Genesis{Alloc: map[string]float64{"alice": 100}})
+	if err != nil {
+		t.Fatalf("Failed to replay chain: %v", err)
+	}
+	if replayed.Root() != machine.Root() {
+		t.Errorf("Expected replayed root %s, got %s", machine.Root(), replayed.Root())
+	}
+}
+
+// buildOn собирает подписанный блок поверх parent с состоянием parentState
+func buildOn(t *testing.T, parent *blockchain.Block, parentState *WorldState, validator string, txs ...*txpool.Transaction) (*blockchain.Block, *WorldState) {
+	s := parentState.Copy()
+	baseFee := zeroFees().NextBaseFee(parent)
+	for _, tx := range txs {
+		signTx(t, tx)
+		if err := s.ApplyTransaction(tx, validator, baseFee); err != nil {
+			t.Fatalf("Failed to apply %s: %v", tx.ID, err)
+		}
+	}
+	block := &blockchain.Block{
+		Index:        parent.Index + 1,
+		Timestamp:    parent.Timestamp,
+		PrevHash:     parent.Hash,
+		Transactions: txs,
+		Validator:    validator,
+		StateRoot:    s.Root(),
+		BaseFee:      baseFee,
+	}
+	block.Hash = block.CalculateHash()
+	return signBlock(t, block), s
+}
+
+// TestImportBlock_Validation - блоки с неизвестным родителем, чужой подписью или подменённым хэшем отклоняются
+func TestImportBlock_Validation(t *testing.T) {
+	machine := newTestMachine(t)
+	genesis := machine.Chain.GetLatestBlock()
+	block, _ := buildOn(t, genesis, machine.Snapshot(), "validator1",
+		&txpool.Transaction{ID: "tx-1", From: "alice", To: "bob", Amount: 10})
+
+	orphan := *block
+	orphan.PrevHash = "unknown"
+	orphan.Hash = orphan.CalculateHash()
+	if _, err := machine.ImportBlock(&orphan); !errors.Is(err, blockchain.ErrUnknownParent) {
+		t.Errorf("Expected ErrUnknownParent, got %v", err)
+	}
+
+	tampered := *block
+	tampered.Hash = "tampered"
+	if _, err := machine.ImportBlock(&tampered); !errors.Is(err, blockchain.ErrInvalidHash) {
+		t.Errorf("Expected ErrInvalidHash, got %v", err)
+	}
+
+	unsigned := *block
+	unsigned.Signature = nil
+	if _, err := machine.ImportBlock(&unsigned); !errors.Is(err, blockchain.ErrInvalidSignature) {
+		t.Errorf("Expected ErrInvalidSignature, got %v", err)
+	}
+
+	// Перевод, подписанный не отправителем, отклоняется, даже если пропосер
+	// подписал блок и записал верный корень состояния
+	forgedTx := *block.Transactions[0]
+	forgedTx.Amount = 90
+	forgedTx.ID = forgedTx.ComputeID()
+	forged, _ := buildOn(t, genesis, machine.Snapshot(), "validator1")
+	forged.Transactions = []*txpool.Transaction{&forgedTx}
+	next := machine.Snapshot()
+	if err := next.ApplyTransaction(&forgedTx, "validator1", forged.BaseFee); err != nil {
+		t.Fatal(err)
+	}
+	forged.StateRoot = next.Root()
+	forged.Hash = forged.CalculateHash()
+	if _, err := machine.ImportBlock(signBlock(t, forged)); !errors.Is(err, blockchain.ErrInvalidTx) {
+		t.Errorf("Expected ErrInvalidTx, got %v", err)
+	}
+
+	if status, err := machine.ImportBlock(block); err != nil || status != ImportCanonical {
+		t.Fatalf("Expected canonical import, got %v, %v", status, err)
+	}
+	if status, err := machine.ImportBlock(block); err != nil || status != ImportKnown {
+		t.Errorf("Expected known block, got %v, %v", status, err)
+	}
+}
+
+// TestImportBlock_ChainID - идентификатор сети берётся из генезиса: транзакции
+// другой сети в блоке отклоняются
+func TestImportBlock_ChainID(t *testing.T) {
+	genesis := &Genesis{ChainID: "cbdc-test", Alloc: map[string]float64{"alice": 100}}
+	machine, err := NewStateMachine(newFeeChain(t, zeroFees()), genesis)
+	if err != nil {
+		t.Fatalf("Failed to create state machine: %v", err)
+	}
+	if got := machine.ChainID(); got != "cbdc-test" {
+		t.Fatalf("Expected chain ID from genesis, got %q", got)
+	}
+	if got := newTestMachine(t).ChainID(); got != txpool.DefaultChainID {
+		t.Errorf("Expected default chain ID without chain_id in genesis, got %q", got)
+	}
+
+	// buildOn подписывает транзакции для txpool.DefaultChainID
+	parent := machine.Chain.GetLatestBlock()
+	foreign, _ := buildOn(t, parent, machine.Snapshot(), "validator1",
+		&txpool.Transaction{From: "alice", To: "bob", Amount: 10})
+	if _, err := machine.ImportBlock(foreign); !errors.Is(err, blockchain.ErrInvalidTx) {
+		t.Errorf("Expected ErrInvalidTx for transaction of another chain, got %v", err)
+	}
+
+	tx := *foreign.Transactions[0]
+	tx.ChainID = machine.ChainID()
+	tx.ID = tx.ComputeID()
+	sig, err := testSigner(t, tx.From).Sign(tx.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.Signature = hex.EncodeToString(sig)
+	block, _ := buildOn(t, parent, machine.Snapshot(), "validator1")
+	block.Transactions = []*txpool.Transaction{&tx}
+	next := machine.Snapshot()
+	if err := next.ApplyTransaction(&tx, "validator1", block.BaseFee); err != nil {
+		t.Fatal(err)
+	}
+	block.StateRoot = next.Root()
+	block.Hash = block.CalculateHash()
+	if status, err := machine.ImportBlock(signBlock(t, block)); err != nil || status != ImportCanonical {
+		t.Fatalf("Expected canonical import, got %v, %v", status, err)
+	}
+}
+
+// TestImportBlock_ForkBelowTip - состояние для ответвления от старого
+// канонического блока берётся из копий состояния, а не с генезиса
+func TestImportBlock_ForkBelowTip(t *testing.T) {
+	machine := newTestMachine(t)
+	states := []*WorldState{machine.Snapshot()}
+	for i := 0; i < 20; i++ {
+		block, next := buildOn(t, machine.Chain.GetLatestBlock(), machine.Snapshot(), "validator1")
+		if err := machine.CommitBlock(block); err != nil {
+			t.Fatalf("Failed to commit block %d: %v", block.Index, err)
+		}
+		states = append(states, next)
+	}
+
+	// Переигрывание с генезиса дало бы другое состояние
+	machine.genesis = &Genesis{Alloc: map[string]float64{"mallory": 1}}
+
+	parent := machine.Chain.GetBlockByHeight(13)
+	fork, _ := buildOn(t, parent, states[13], "validator2",
+		&txpool.Transaction{ID: "tx-fork", From: "alice", To: "carol", Amount: 1})
+	if status, err := machine.ImportBlock(fork); err != nil || status != ImportSideBranch {
+		t.Fatalf("Expected side branch, got %v (%v)", status, err)
+	}
+}
+
+// TestImportBlock_Reorg - более длинная ветка, затем ветка с большим стейком становятся каноническими
+func TestImportBlock_Reorg(t *testing.T) {
+	machine := newTestMachine(t)
+	machine.ForkChoice.StakeOf = func(validator string) int64 {
+		return map[string]int64{"validator1": 100, "validator2": 10}[validator]
+	}
+	var events []blockchain.ReorgEvent
+	machine.OnReorg(func(e blockchain.ReorgEvent) { events = append(events, e) })
+
+	genesis := machine.Chain.GetLatestBlock()
+	genesisState := machine.Snapshot()
+
+	a1, a1State := buildOn(t, genesis, genesisState, "validator1",
+		&txpool.Transaction{ID: "tx-a1", From: "alice", To: "bob", Amount: 10})
+	b1, b1State := buildOn(t, genesis, genesisState, "validator2",
+		&txpool.Transaction{ID: "tx-b1", From: "alice", To: "carol", Amount: 5})
+	b2, _ := buildOn(t, b1, b1State, "validator2",
+		&txpool.Transaction{ID: "tx-b2", From: "alice", To: "carol", Amount: 1, Nonce: 1})
+	a2, _ := buildOn(t, a1, a1State, "validator1")
+
+	steps := []struct {
+		block *blockchain.Block
+		want  ImportStatus
+	}{
+		{a1, ImportCanonical},
+		{b1, ImportSideBranch}, // та же высота, меньший стейк
+		{b2, ImportReorg},      // ветка B длиннее
+		{a2, ImportReorg},      // та же высота, больший стейк
+	}
+	for _, step := range steps {
+		status, err := machine.ImportBlock(step.block)
+		if err != nil || status != step.want {
+			t.Fatalf("Block %s: expected %v, got %v (%v)", step.block.Hash, step.want, status, err)
+		}
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 reorg events, got %d", len(events))
+	}
+	first := events[0]
+	if len(first.Orphaned) != 1 || first.Orphaned[0].Hash != a1.Hash || len(first.Adopted) != 2 {
+		t.Errorf("Unexpected first reorg: %+v", first)
+	}
+	if orphaned := first.OrphanedTransactions(); len(orphaned) != 1 || orphaned[0].ID != a1.Transactions[0].ID {
+		t.Errorf("Expected tx-a1 to be orphaned, got %v", orphaned)
+	}
+
+	if head := machine.Chain.GetLatestBlock(); head.Hash != a2.Hash {
+		t.Errorf("Expected head %s, got %s", a2.Hash, head.Hash)
+	}
+	if got := machine.GetAccount("bob").Balance; got != 10 {
+		t.Errorf("Expected bob balance 10, got %f", got)
+	}
+	if got := machine.GetAccount("carol").Balance; got != 0 {
+		t.Errorf("Expected carol balance 0 after switching back, got %f", got)
+	}
+	if machine.Root() != a2.StateRoot {
+		t.Errorf("Expected state root %s, got %s", a2.StateRoot, machine.Root())
+	}
+}
+
+// trustCommits возвращает проверку, принимающую сертификаты только блоков hashes
+func trustCommits(hashes ...string) func(pos.ValidatorPool, *blockchain.Commit) error {
+	return func(validators pos.ValidatorPool, commit *blockchain.Commit) error {
+		for _, hash := range hashes {
+			if commit.BlockHash == hash {
+				return nil
+			}
+		}
+		return fmt.Errorf("untrusted commit for %s", commit.BlockHash)
+	}
+}
+
+// TestImportBlock_CommittedBranch - ветка с решённым консенсусом блоком
+// выигрывает у более длинной, а ответвления ниже такого блока отклоняются
+func TestImportBlock_CommittedBranch(t *testing.T) {
+	machine := newTestMachine(t)
+	genesis := machine.Chain.GetLatestBlock()
+	genesisState := machine.Snapshot()
+
+	a1, a1State := buildOn(t, genesis, genesisState, "validator1")
+	a2, _ := buildOn(t, a1, a1State, "validator1")
+	b1, b1State := buildOn(t, genesis, genesisState, "validator2")
+	b1.Commit = &blockchain.Commit{Height: b1.Index, BlockHash: b1.Hash}
+	machine.SetCommitVerifier(trustCommits(b1.Hash))
+	b2, _ := buildOn(t, b1, b1State, "validator2")
+	c1, c1State := buildOn(t, genesis, genesisState, "validator3")
+	c2, c2State := buildOn(t, c1, c1State, "validator3")
+	c3, _ := buildOn(t, c2, c2State, "validator3")
+
+	for _, block := range []*blockchain.Block{a1, a2} {
+		if status, err := machine.ImportBlock(block); err != nil || status != ImportCanonical {
+			t.Fatalf("Block %d: expected canonical import, got %v (%v)", block.Index, status, err)
+		}
+	}
+	if status, err := machine.ImportBlock(b1); err != nil || status != ImportReorg {
+		t.Fatalf("Expected the committed block to win over a longer branch, got %v (%v)", status, err)
+	}
+	if status, err := machine.ImportBlock(b2); err != nil || status != ImportCanonical {
+		t.Fatalf("Expected canonical import above the committed block, got %v (%v)", status, err)
+	}
+
+	// Более длинная ветка от генезиса откатила бы решённый блок b1
+	if _, err := machine.ImportBlock(c1); !errors.Is(err, ErrForkBelowCommit) {
+		t.Errorf("Expected ErrForkBelowCommit, got %v", err)
+	}
+	for _, block := range []*blockchain.Block{c2, c3} {
+		if _, err := machine.ImportBlock(block); err == nil {
+			t.Errorf("Expected block %d of the rejected branch to stay unknown", block.Index)
+		}
+	}
+	if head := machine.Chain.GetLatestBlock(); head.Hash != b2.Hash {
+		t.Errorf("Expected head %s, got %s", b2.Hash, head.Hash)
+	}
+}
+
+// TestImportBlock_ForgedCommit - сертификат не входит в хэш блока, поэтому
+// непроверенный сертификат снимается и не закрепляет ветку
+func TestImportBlock_ForgedCommit(t *testing.T) {
+	machine := newTestMachine(t)
+	machine.SetCommitVerifier(trustCommits())
+	genesis := machine.Chain.GetLatestBlock()
+	genesisState := machine.Snapshot()
+
+	a1, a1State := buildOn(t, genesis, genesisState, "validator1")
+	a2, _ := buildOn(t, a1, a1State, "validator1")
+	b1, _ := buildOn(t, genesis, genesisState, "validator2")
+	b1.Commit = &blockchain.Commit{Height: b1.Index, BlockHash: b1.Hash}
+
+	for _, block := range []*blockchain.Block{a1, a2} {
+		if status, err := machine.ImportBlock(block); err != nil || status != ImportCanonical {
+			t.Fatalf("Block %d: expected canonical import, got %v (%v)", block.Index, status, err)
+		}
+	}
+	if status, err := machine.ImportBlock(b1); err != nil || status != ImportSideBranch {
+		t.Fatalf("Expected a block with a forged commit to stay on a side branch, got %v (%v)", status, err)
+	}
+	if head := machine.Chain.GetLatestBlock(); head.Hash != a2.Hash {
+		t.Errorf("Expected head %s, got %s", a2.Hash, head.Hash)
+	}
+
+	// Сертификат другого блока не принимается и с верной проверкой
+	a3, _ := buildOn(t, a2, machine.Snapshot(), "validator1")
+	machine.SetCommitVerifier(trustCommits(a2.Hash))
+	a3.Commit = &blockchain.Commit{Height: a3.Index, BlockHash: a2.Hash}
+	if status, err := machine.ImportBlock(a3); err != nil || status != ImportCanonical {
+		t.Fatalf("Expected canonical import, got %v (%v)", status, err)
+	}
+	if stored := machine.Chain.GetLatestBlock(); stored.Commit != nil {
+		t.Errorf("Expected the mismatched commit to be dropped, got %+v", stored.Commit)
+	}
+}
+
+// TestFeeMarket - базовая комиссия следует за заполненностью блоков, уходит в казначейство и проверяется при импорте
+func TestFeeMarket(t *testing.T) {
+	cfg := &blockchain.FeeConfig{
+		InitialBaseFee:    1,
+		MinBaseFee:        0.5,
+		TargetTxsPerBlock: 2,
+		MaxTxsPerBlock:    4,
+		ChangeDenominator: 8,
+		Treasury:          "treasury",
+	}
+	machine := newFeeMachine(t, cfg)
+	if got := machine.NextBaseFee(); got != 0.875 {
+		t.Fatalf("Empty genesis must lower base fee by 1/8, got %f", got)
+	}
+
+	var txs []*txpool.Transaction
+	for i := uint64(0); i < 5; i++ {
+		txs = append(txs, signTx(t, &txpool.Transaction{ID: "fee-" + string(rune('a'+i)), From: "alice", To: "bob", Amount: 1, Fee: 2, Tip: 0.25, Nonce: i}))
+	}
+	block, _ := machine.BuildBlock(txs, "validator1")
+	if len(block.Transactions) != cfg.MaxTxsPerBlock || block.BaseFee != 0.875 {
+		t.Fatalf("Expected full block with base fee 0.875, got %d txs, %f", len(block.Transactions), block.BaseFee)
+	}
+	if got := block.TotalTips(); got != 1 {
+		t.Errorf("Expected total tips 1, got %f", got)
+	}
+	if err := machine.CommitBlock(signBlock(t, block)); err != nil {
+		t.Fatalf("Failed to commit block: %v", err)
+	}
+	if got := machine.GetAccount("treasury").Balance; got != 4*0.875 {
+		t.Errorf("Expected treasury to receive base fees, got %f", got)
+	}
+	if got := machine.GetAccount("validator1").Balance; got != 1 {
+		t.Errorf("Expected validator to receive tips, got %f", got)
+	}
+	// Блок заполнен вдвое больше цели — комиссия растёт на 1/8
+	if got := machine.NextBaseFee(); got != 0.875*1.125 {
+		t.Errorf("Expected base fee to rise by 1/8, got %f", got)
+	}
+
+	// Блок с неверной базовой комиссией отклоняется
+	forged, _ := buildOn(t, block, machine.Snapshot(), "validator1")
+	forged.BaseFee = 0.5
+	forged.Hash = forged.CalculateHash()
+	if _, err := machine.ImportBlock(signBlock(t, forged)); !errors.Is(err, blockchain.ErrInvalidBaseFee) {
+		t.Errorf("Expected ErrInvalidBaseFee, got %v", err)
+	}
+
+	estimates := blockchain.EstimateFees(machine.Chain, 100)
+	if len(estimates) != 3 {
+		t.Fatalf("Expected 3 estimates, got %d", len(estimates))
+	}
+	for i, e := range estimates {
+		if e.Tip != 0.25 || e.MaxFee != e.BaseFee+e.Tip {
+			t.Errorf("Unexpected estimate %+v", e)
+		}
+		if i > 0 && e.BaseFee <= estimates[i-1].BaseFee {
+			t.Errorf("Full mempool must raise projected base fee: %+v", estimates)
+		}
+	}
+
+	// Параметры комиссий генезиса должны совпадать с параметрами цепочки
+	if _, err := NewStateMachine(machine.Chain, &Genesis{Fees: zeroFees()}); !errors.Is(err, ErrGenesisMismatch) {
+		t.Errorf("Expected ErrGenesisMismatch, got %v", err)
+	}
+}
+
+// TestStateMachine_Checkpoint - восстановление от контрольной точки совпадает с полным переигрыванием
+func TestStateMachine_Checkpoint(t *testing.T) {
+	machine := newTestMachine(t)
+	first, _ := machine.BuildBlock([]*txpool.Transaction{signTx(t, &txpool.Transaction{ID: "cp-1", From: "alice", To: "bob", Amount: 10})}, "validator1")
+	if err := machine.CommitBlock(signBlock(t, first)); err != nil {
+		t.Fatalf("Failed to commit block: %v", err)
+	}
+	checkpoint := machine.Checkpoint()
+	second, _ := machine.BuildBlock([]*txpool.Transaction{signTx(t, &txpool.Transaction{ID: "cp-2", From: "bob", To: "carol", Amount: 4})}, "validator1")
+	if err := machine.CommitBlock(signBlock(t, second)); err != nil {
+		t.Fatalf("Failed to commit block: %v", err)
+	}
+
+	// Генезис не передаётся: состояние берётся из контрольной точки
+	restored, err := NewStateMachine(machine.Chain, nil, checkpoint)
+	if err != nil {
+		t.Fatalf("Failed to restore from checkpoint: %v", err)
+	}
+	if restored.Root() != machine.Root() {
+		t.Errorf("Expected root %s, got %s", machine.Root(), restored.Root())
+	}
+
+	// Повреждённая контрольная точка игнорируется
+	checkpoint.Root = "forged"
+	fallback, err := NewStateMachine(machine.Chain, &Genesis{Alloc: map[string]float64{"alice": 100}}, checkpoint)
+	if err != nil {
+		t.Fatalf("Failed to replay: %v", err)
+	}
+	if fallback.Root() != machine.Root() {
+		t.Errorf("Expected root %s after fallback, got %s", machine.Root(), fallback.Root())
+	}
+
+	// Подделанная контрольная точка с согласованным корнем тоже игнорируется:
+	// корень сверяется с заголовком канонического блока
+	forged := machine.Snapshot()
+	forged.SetBalance("mallory", 1000)
+	tip := machine.Checkpoint()
+	tip.Root, tip.Accounts = forged.Root(), forged.Accounts()
+	fallback, err = NewStateMachine(machine.Chain, &Genesis{Alloc: map[string]float64{"alice": 100}}, tip)
+	if err != nil {
+		t.Fatalf("Failed to replay: %v", err)
+	}
+	if fallback.Root() != machine.Root() || fallback.GetAccount("mallory").Balance != 0 {
+		t.Errorf("Expected a forged checkpoint to be rejected, got root %s", fallback.Root())
+	}
+}
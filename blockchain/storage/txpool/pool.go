@@ -1,50 +1,372 @@
 package txpool
 
 import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	"blockchain/security/double_spend"
 )
 
+var (
+	ErrAlreadyKnown           = errors.New("transaction already in pool")
+	ErrDoubleSpend            = errors.New("transaction was already seen")
+	ErrNonceTooLow            = errors.New("nonce too low")
+	ErrReplacementUnderpriced = errors.New("replacement transaction underpriced")
+	ErrPoolFull               = errors.New("transaction pool is full")
+)
+
+// PoolConfig — параметры пула транзакций
+type PoolConfig struct {
+	MaxSize   int           // максимальное число транзакций; при переполнении вытесняются самые дешёвые
+	TTL       time.Duration // время жизни транзакции в пуле
+	PriceBump float64       // минимальное повышение комиссии для замены транзакции с тем же nonce (0.1 = 10%)
+
+	// DoubleSpend — защита от повторной отправки транзакции; nil — своя
+	// защита пула. Общую защиту задают, чтобы разделить её между пулами.
+	DoubleSpend *double_spend.DoubleSpendGuard
+}
+
+func DefaultPoolConfig() *PoolConfig {
+	return &PoolConfig{
+		MaxSize:   10000,
+		TTL:       30 * time.Minute,
+		PriceBump: 0.1,
+	}
+}
+
+// poolEntry — транзакция в пуле вместе с данными для упорядочивания
+type poolEntry struct {
+	tx        *Transaction
+	feeRate   float64 // максимальная комиссия на байт канонической кодировки
+	tip       float64 // надбавка валидатору при текущей базовой комиссии (для выбора в блок)
+	addedAt   time.Time
+	heapIndex int
+}
+
+// TransactionPool — пул транзакций (мемпул). Транзакции хранятся в очередях
+// отправителей по nonce; непрерывная цепочка nonce начиная с текущего nonce
+// счёта считается готовой к включению в блок (pending), остальные ждут
+// недостающих nonce (queued). Глобальный индекс по комиссии на байт
+// используется для вытеснения самых дешёвых транзакций при переполнении.
 type TransactionPool struct {
-	Transactions map[string]*Transaction
-	mu           sync.Mutex
+	config  *PoolConfig
+	all     map[string]*poolEntry
+	senders map[string]map[uint64]*poolEntry
+	byPrice priceHeap
+	nonceOf func(address string) uint64
+	baseFee func() float64
+	now     func() time.Time
+	expired time.Time // время последней очистки по TTL
+	onAdd   []func(tx *Transaction)
+	guard   *double_spend.DoubleSpendGuard
+	reset   time.Time // время последней очистки защиты от двойной траты
+	mu      sync.Mutex
 }
 
-func NewTransactionPool() *TransactionPool {
+// NewTransactionPool создаёт пул; без аргументов используется DefaultPoolConfig
+func NewTransactionPool(config ...*PoolConfig) *TransactionPool {
+	cfg := DefaultPoolConfig()
+	if len(config) > 0 && config[0] != nil {
+		cfg = config[0]
+	}
+	guard := cfg.DoubleSpend
+	if guard == nil {
+		guard = double_spend.NewDoubleSpendGuard()
+	}
 	return &TransactionPool{
-		Transactions: make(map[string]*Transaction),
+		config:  cfg,
+		all:     make(map[string]*poolEntry),
+		senders: make(map[string]map[uint64]*poolEntry),
+		now:     time.Now,
+		guard:   guard,
+		reset:   time.Now(),
 	}
 }
 
-var doubleSpendGuard *double_spend.DoubleSpendGuard
+// guardResetInterval — период очистки собственной защиты пула от двойной траты
+const guardResetInterval = 5 * time.Minute
+
+// SetNonceSource задаёт источник текущего nonce счёта (обычно — состояние
+// цепочки). Без него готовой считается цепочка от наименьшего nonce отправителя.
+func (p *TransactionPool) SetNonceSource(nonceOf func(address string) uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nonceOf = nonceOf
+}
 
-func init() {
-	doubleSpendGuard = double_spend.NewDoubleSpendGuard()
-	doubleSpendGuard.StartCleanup(5 * time.Minute)
+// SetBaseFeeSource задаёт источник базовой комиссии следующего блока.
+// Транзакции с Fee ниже базовой комиссии остаются в пуле, но не выбираются в блок.
+func (p *TransactionPool) SetBaseFeeSource(baseFee func() float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.baseFee = baseFee
 }
 
-func (p *TransactionPool) AddTransaction(tx *Transaction) {
+// OnAdd регистрирует обработчик транзакций, принятых AddTransaction
+// (например, для рассылки пирам). Обработчик вызывается вне блокировки пула.
+func (p *TransactionPool) OnAdd(handler func(tx *Transaction)) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.onAdd = append(p.onAdd, handler)
+}
 
-	if !doubleSpendGuard.CheckAndMark(tx.ID) {
+// AddTransaction добавляет транзакцию в пул. Транзакция с уже занятым nonce
+// заменяет прежнюю, только если фактическая комиссия выше на PriceBump.
+// Защита от двойной траты отмечает транзакцию только после того, как пул её
+// принял: отклонённую транзакцию можно отправить снова.
+func (p *TransactionPool) AddTransaction(tx *Transaction) error {
+	p.mu.Lock()
+	if _, exists := p.all[tx.ID]; exists {
+		p.mu.Unlock()
+		return ErrAlreadyKnown
+	}
+	p.resetGuard()
+	if p.guard.Seen(tx.ID) {
 		// Транзакция является двойной тратой — не добавляем
+		p.mu.Unlock()
+		return ErrDoubleSpend
+	}
+	err := p.insert(tx)
+	if err == nil {
+		p.guard.Mark(tx.ID)
+	}
+	handlers := p.onAdd
+	p.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+	for _, handler := range handlers {
+		handler(tx)
+	}
+	return nil
+}
+
+// resetGuard периодически очищает собственную защиту пула, чтобы она не росла
+// без ограничений; общую защиту очищает её владелец. Вызывается под блокировкой.
+func (p *TransactionPool) resetGuard() {
+	if p.config.DoubleSpend != nil {
 		return
 	}
-	if _, exists := p.Transactions[tx.ID]; !exists {
-		p.Transactions[tx.ID] = tx
+	now := p.now()
+	if now.Sub(p.reset) < guardResetInterval {
+		return
 	}
+	p.reset = now
+	p.guard.Reset()
+}
+
+// Has сообщает, есть ли транзакция в пуле
+func (p *TransactionPool) Has(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.all[id]
+	return ok
 }
+
+// Reinject возвращает в пул транзакции из блоков, покинувших каноническую
+// цепочку при реорганизации. Защита от двойной траты уже отметила эти
+// транзакции, поэтому они добавляются в обход неё.
+func (p *TransactionPool) Reinject(txs []*Transaction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, tx := range txs {
+		if _, exists := p.all[tx.ID]; !exists {
+			p.insert(tx)
+		}
+	}
+}
+
+// insert вызывается под блокировкой
+func (p *TransactionPool) insert(tx *Transaction) error {
+	p.expire()
+
+	if p.nonceOf != nil && tx.Nonce < p.nonceOf(tx.From) {
+		return fmt.Errorf("%w: %d, account nonce %d", ErrNonceTooLow, tx.Nonce, p.nonceOf(tx.From))
+	}
+
+	entry := &poolEntry{tx: tx, feeRate: feeRate(tx), addedAt: p.now()}
+
+	// Замена по комиссии: фактическая комиссия на байт при текущей базовой
+	// комиссии (с учётом надбавки) должна вырасти не меньше чем на PriceBump
+	if old, exists := p.senders[tx.From][tx.Nonce]; exists {
+		var baseFee float64
+		if p.baseFee != nil {
+			baseFee = p.baseFee()
+		}
+		rate, minRate := effectiveRate(tx, baseFee), effectiveRate(old.tx, baseFee)*(1+p.config.PriceBump)
+		if rate < minRate {
+			return fmt.Errorf("%w: fee rate %.9f, need at least %.9f", ErrReplacementUnderpriced, rate, minRate)
+		}
+		p.remove(old)
+		p.add(entry)
+		return nil
+	}
+
+	// Переполнение: вытесняем отправителя самой дешёвой транзакции, если новая
+	// дороже. Транзакции отправителя исполняются по порядку nonce, поэтому
+	// вытесняется его последняя транзакция: иначе остальные застрянут в пуле
+	if p.config.MaxSize > 0 && len(p.all) >= p.config.MaxSize {
+		cheapest := p.byPrice[0]
+		if entry.feeRate <= cheapest.feeRate {
+			return fmt.Errorf("%w: fee rate %.9f below minimum %.9f", ErrPoolFull, entry.feeRate, cheapest.feeRate)
+		}
+		victim := p.lastOf(cheapest.tx.From)
+		if tx.From == victim.tx.From && tx.Nonce > victim.tx.Nonce {
+			return fmt.Errorf("%w: nonce %d waits for underpriced nonce %d", ErrPoolFull, tx.Nonce, cheapest.tx.Nonce)
+		}
+		p.remove(victim)
+	}
+
+	p.add(entry)
+	return nil
+}
+
+func (p *TransactionPool) add(entry *poolEntry) {
+	tx := entry.tx
+	p.all[tx.ID] = entry
+	if p.senders[tx.From] == nil {
+		p.senders[tx.From] = make(map[uint64]*poolEntry)
+	}
+	p.senders[tx.From][tx.Nonce] = entry
+	heap.Push(&p.byPrice, entry)
+}
+
+func (p *TransactionPool) remove(entry *poolEntry) {
+	tx := entry.tx
+	delete(p.all, tx.ID)
+	if queue := p.senders[tx.From]; queue != nil && queue[tx.Nonce] == entry {
+		delete(queue, tx.Nonce)
+		if len(queue) == 0 {
+			delete(p.senders, tx.From)
+		}
+	}
+	heap.Remove(&p.byPrice, entry.heapIndex)
+}
+
+// lastOf возвращает транзакцию отправителя с наибольшим nonce
+func (p *TransactionPool) lastOf(sender string) *poolEntry {
+	var last *poolEntry
+	for _, entry := range p.senders[sender] {
+		if last == nil || entry.tx.Nonce > last.tx.Nonce {
+			last = entry
+		}
+	}
+	return last
+}
+
+// expireInterval — как часто пул проверяет TTL транзакций
+const expireInterval = time.Second
+
+// expire удаляет транзакции старше TTL (не чаще раза в expireInterval)
+func (p *TransactionPool) expire() {
+	now := p.now()
+	if p.config.TTL <= 0 || now.Sub(p.expired) < expireInterval {
+		return
+	}
+	p.expired = now
+	deadline := now.Add(-p.config.TTL)
+	for _, entry := range p.all {
+		if entry.addedAt.Before(deadline) {
+			p.remove(entry)
+		}
+	}
+}
+
+// baseNonce возвращает nonce, с которого начинается готовая к включению цепочка отправителя
+func (p *TransactionPool) baseNonce(sender string, queue map[uint64]*poolEntry) uint64 {
+	if p.nonceOf != nil {
+		return p.nonceOf(sender)
+	}
+	first := true
+	var lowest uint64
+	for nonce := range queue {
+		if first || nonce < lowest {
+			lowest, first = nonce, false
+		}
+	}
+	return lowest
+}
+
+// pendingOf возвращает готовые к включению транзакции отправителя по возрастанию
+// nonce и удаляет транзакции с уже использованным nonce
+func (p *TransactionPool) pendingOf(sender string) []*poolEntry {
+	queue := p.senders[sender]
+	base := p.baseNonce(sender, queue)
+	for nonce, entry := range queue {
+		if nonce < base {
+			p.remove(entry)
+		}
+	}
+	var pending []*poolEntry
+	for nonce := base; ; nonce++ {
+		entry, ok := p.senders[sender][nonce]
+		if !ok {
+			return pending
+		}
+		pending = append(pending, entry)
+	}
+}
+
+// NextNonce возвращает nonce следующей транзакции отправителя: nonce счёта,
+// увеличенный на число готовых к включению транзакций отправителя в пуле
+func (p *TransactionPool) NextNonce(sender string) uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	base := p.baseNonce(sender, p.senders[sender])
+	return base + uint64(len(p.pendingOf(sender)))
+}
+
+// GetTransactions возвращает до limit готовых транзакций, максимизируя
+// надбавку валидатору: на каждом шаге берётся самая выгодная из следующих по
+// nonce транзакций отправителей, поэтому порядок nonce внутри отправителя
+// сохраняется. Цепочка отправителя обрывается на первой транзакции, не
+// покрывающей базовую комиссию. Транзакции из пула не удаляются.
 func (p *TransactionPool) GetTransactions(limit int) []*Transaction {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	p.expire()
+
+	var baseFee float64
+	if p.baseFee != nil {
+		baseFee = p.baseFee()
+	}
+
+	senders := make([]string, 0, len(p.senders))
+	for sender := range p.senders {
+		senders = append(senders, sender)
+	}
+	sort.Strings(senders)
+
+	var heads senderHeap
+	for _, sender := range senders {
+		pending := p.pendingOf(sender)
+		for i, entry := range pending {
+			entry.tip = entry.tx.EffectiveTip(baseFee)
+			if entry.tip < 0 {
+				pending = pending[:i]
+				break
+			}
+		}
+		if len(pending) > 0 {
+			heads = append(heads, pending)
+		}
+	}
+	heap.Init(&heads)
+
 	var list []*Transaction
-	for _, tx := range p.Transactions {
-		list = append(list, tx)
-		if len(list) >= limit {
-			break
+	for heads.Len() > 0 && len(list) < limit {
+		pending := heads[0]
+		list = append(list, pending[0].tx)
+		if len(pending) > 1 {
+			heads[0] = pending[1:]
+			heap.Fix(&heads, 0)
+		} else {
+			heap.Pop(&heads)
 		}
 	}
 	return list
@@ -54,35 +376,145 @@ func (p *TransactionPool) GetTransactions(limit int) []*Transaction {
 func (p *TransactionPool) GetAllTransactions() []*Transaction {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	var list []*Transaction
-	for _, tx := range p.Transactions {
-		list = append(list, tx)
+	p.expire()
+
+	list := make([]*Transaction, 0, len(p.all))
+	for _, entry := range p.all {
+		list = append(list, entry.tx)
 	}
+	sortTransactions(list)
 	return list
 }
 
+// Pending возвращает транзакции, готовые к включению в блок
+func (p *TransactionPool) Pending() []*Transaction {
+	pending, _ := p.split()
+	return pending
+}
+
+// Queued возвращает транзакции, ожидающие пропущенных nonce
+func (p *TransactionPool) Queued() []*Transaction {
+	_, queued := p.split()
+	return queued
+}
+
+func (p *TransactionPool) split() (pending, queued []*Transaction) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.expire()
+
+	ready := make(map[string]bool)
+	for sender := range p.senders {
+		for _, entry := range p.pendingOf(sender) {
+			ready[entry.tx.ID] = true
+		}
+	}
+	for id, entry := range p.all {
+		if ready[id] {
+			pending = append(pending, entry.tx)
+		} else {
+			queued = append(queued, entry.tx)
+		}
+	}
+	sortTransactions(pending)
+	sortTransactions(queued)
+	return pending, queued
+}
+
 func (p *TransactionPool) RemoveTransactions(ids []string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	for _, id := range ids {
-		delete(p.Transactions, id)
+		if entry, exists := p.all[id]; exists {
+			p.remove(entry)
+		}
 	}
 }
 
 func (p *TransactionPool) RemoveTransaction(id string) {
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	delete(p.Transactions, id)
+	p.RemoveTransactions([]string{id})
 }
 
 func (p *TransactionPool) Flush() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.Transactions = make(map[string]*Transaction)
+	p.all = make(map[string]*poolEntry)
+	p.senders = make(map[string]map[uint64]*poolEntry)
+	p.byPrice = nil
 }
 
 func (p *TransactionPool) Size() int {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	return len(p.Transactions)
+	return len(p.all)
+}
+
+// feeRate возвращает комиссию на байт канонической кодировки транзакции
+func feeRate(tx *Transaction) float64 {
+	return tx.Fee / float64(len(tx.Encode()))
+}
+
+// effectiveRate возвращает фактически списываемую комиссию на байт
+// канонической кодировки транзакции при базовой комиссии baseFee
+func effectiveRate(tx *Transaction, baseFee float64) float64 {
+	return tx.EffectiveFee(baseFee) / float64(len(tx.Encode()))
+}
+
+// sortTransactions упорядочивает по отправителю и nonce
+func sortTransactions(list []*Transaction) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].From != list[j].From {
+			return list[i].From < list[j].From
+		}
+		return list[i].Nonce < list[j].Nonce
+	})
+}
+
+// priceHeap — минимальная куча по комиссии на байт (для вытеснения)
+type priceHeap []*poolEntry
+
+func (h priceHeap) Len() int { return len(h) }
+func (h priceHeap) Less(i, j int) bool {
+	if h[i].feeRate != h[j].feeRate {
+		return h[i].feeRate < h[j].feeRate
+	}
+	// При равной комиссии первой вытесняется более новая транзакция
+	return h[i].addedAt.After(h[j].addedAt)
+}
+func (h priceHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+func (h *priceHeap) Push(x any) {
+	entry := x.(*poolEntry)
+	entry.heapIndex = len(*h)
+	*h = append(*h, entry)
+}
+func (h *priceHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// senderHeap — максимальная куча очередей отправителей по надбавке первой транзакции
+type senderHeap [][]*poolEntry
+
+func (h senderHeap) Len() int { return len(h) }
+func (h senderHeap) Less(i, j int) bool {
+	a, b := h[i][0], h[j][0]
+	if a.tip != b.tip {
+		return a.tip > b.tip
+	}
+	// При равной надбавке — в порядке поступления
+	return a.addedAt.Before(b.addedAt)
+}
+func (h senderHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *senderHeap) Push(x any)   { *h = append(*h, x.([]*poolEntry)) }
+func (h *senderHeap) Pop() any {
+	old := *h
+	queue := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return queue
 }
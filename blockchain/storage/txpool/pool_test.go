@@ -0,0 +1,223 @@
+package txpool
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testTxCounter int64
+
+// makeTx создаёт транзакцию с уникальным ID
+func makeTx(from string, nonce uint64, fee float64) *Transaction {
+	id := atomic.AddInt64(&testTxCounter, 1)
+	return &Transaction{
+		ID:     fmt.Sprintf("pool-test-%d", id),
+		From:   from,
+		To:     "merchant",
+		Amount: 1,
+		Fee:    fee,
+		Tip:    fee,
+		Nonce:  nonce,
+	}
+}
+
+func ids(txs []*Transaction) []string {
+	out := make([]string, len(txs))
+	for i, tx := range txs {
+		out[i] = fmt.Sprintf("%s/%d", tx.From, tx.Nonce)
+	}
+	return out
+}
+
+// TestPool_FeeOrderingKeepsNonceOrder - дорогие транзакции идут первыми, но не раньше меньших nonce отправителя
+func TestPool_FeeOrderingKeepsNonceOrder(t *testing.T) {
+	pool := NewTransactionPool()
+	pool.AddTransaction(makeTx("alice", 1, 10))
+	pool.AddTransaction(makeTx("alice", 0, 1))
+	pool.AddTransaction(makeTx("bob", 0, 5))
+	pool.AddTransaction(makeTx("carol", 0, 3))
+	pool.AddTransaction(makeTx("carol", 2, 100)) // пропущен nonce 1
+
+	got := fmt.Sprint(ids(pool.GetTransactions(10)))
+	want := "[bob/0 carol/0 alice/0 alice/1]"
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+	if got := fmt.Sprint(ids(pool.GetTransactions(2))); got != "[bob/0 carol/0]" {
+		t.Errorf("Expected limit to keep the most profitable prefix, got %s", got)
+	}
+	if queued := pool.Queued(); len(queued) != 1 || queued[0].Nonce != 2 {
+		t.Errorf("Expected carol/2 to be queued, got %v", ids(queued))
+	}
+	if pending := pool.Pending(); len(pending) != 4 {
+		t.Errorf("Expected 4 pending transactions, got %d", len(pending))
+	}
+}
+
+// TestPool_ReplaceByFee - замена с тем же nonce требует повышения комиссии
+func TestPool_ReplaceByFee(t *testing.T) {
+	pool := NewTransactionPool()
+	original := makeTx("alice", 0, 1)
+	pool.AddTransaction(original)
+
+	if err := pool.AddTransaction(makeTx("alice", 0, 1.05)); !errors.Is(err, ErrReplacementUnderpriced) {
+		t.Errorf("Expected ErrReplacementUnderpriced, got %v", err)
+	}
+	// Повышение только Fee не меняет фактическую комиссию: надбавка та же
+	feeOnly := makeTx("alice", 0, 2)
+	feeOnly.Tip = 1
+	if err := pool.AddTransaction(feeOnly); !errors.Is(err, ErrReplacementUnderpriced) {
+		t.Errorf("Expected replacement without a tip bump to be underpriced, got %v", err)
+	}
+	replacement := makeTx("alice", 0, 2)
+	if err := pool.AddTransaction(replacement); err != nil {
+		t.Fatalf("Expected replacement to be accepted, got %v", err)
+	}
+	txs := pool.GetTransactions(10)
+	if pool.Size() != 1 || len(txs) != 1 || txs[0].ID != replacement.ID {
+		t.Errorf("Expected only the replacement in pool, got %v", ids(txs))
+	}
+	if err := pool.AddTransaction(replacement); !errors.Is(err, ErrAlreadyKnown) {
+		t.Errorf("Expected ErrAlreadyKnown, got %v", err)
+	}
+}
+
+// TestPool_EvictionAndTTL - при переполнении вытесняются дешёвые, устаревшие удаляются
+func TestPool_EvictionAndTTL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	pool := NewTransactionPool(&PoolConfig{MaxSize: 2, TTL: time.Minute, PriceBump: 0.1})
+	pool.now = func() time.Time { return now }
+
+	pool.AddTransaction(makeTx("alice", 0, 1))
+	pool.AddTransaction(makeTx("bob", 0, 5))
+	if err := pool.AddTransaction(makeTx("carol", 0, 0.5)); !errors.Is(err, ErrPoolFull) {
+		t.Errorf("Expected ErrPoolFull for cheap transaction, got %v", err)
+	}
+	if err := pool.AddTransaction(makeTx("dave", 0, 3)); err != nil {
+		t.Fatalf("Expected expensive transaction to evict the cheapest, got %v", err)
+	}
+	if got := fmt.Sprint(ids(pool.GetAllTransactions())); got != "[bob/0 dave/0]" {
+		t.Errorf("Expected alice to be evicted, got %s", got)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if size := len(pool.GetTransactions(10)); size != 0 || pool.Size() != 0 {
+		t.Errorf("Expected expired transactions to be dropped, got %d", pool.Size())
+	}
+}
+
+// TestPool_EvictionKeepsNonceChain - вытесняется последняя транзакция
+// отправителя, а не его ближайший nonce
+func TestPool_EvictionKeepsNonceChain(t *testing.T) {
+	pool := NewTransactionPool(&PoolConfig{MaxSize: 3, TTL: time.Minute, PriceBump: 0.1})
+	pool.AddTransaction(makeTx("alice", 0, 1))
+	pool.AddTransaction(makeTx("alice", 1, 5))
+	pool.AddTransaction(makeTx("bob", 0, 3))
+
+	if err := pool.AddTransaction(makeTx("alice", 2, 10)); !errors.Is(err, ErrPoolFull) {
+		t.Errorf("Expected ErrPoolFull for a nonce behind the cheapest one, got %v", err)
+	}
+	if err := pool.AddTransaction(makeTx("carol", 0, 2)); err != nil {
+		t.Fatalf("Expected carol to evict alice's last transaction, got %v", err)
+	}
+	if got := fmt.Sprint(ids(pool.Pending())); got != "[alice/0 bob/0 carol/0]" {
+		t.Errorf("Expected alice/1 to be evicted, got %s", got)
+	}
+	if queued := pool.Queued(); len(queued) != 0 {
+		t.Errorf("Expected no stuck transactions, got %v", ids(queued))
+	}
+}
+
+// TestPool_RejectedCanBeResent - отклонённая пулом транзакция не считается
+// двойной тратой, принятая — считается даже после удаления из пула
+func TestPool_RejectedCanBeResent(t *testing.T) {
+	pool := NewTransactionPool(&PoolConfig{MaxSize: 1, TTL: time.Hour, PriceBump: 0.1})
+	expensive := makeTx("alice", 0, 5)
+	cheap := makeTx("bob", 0, 1)
+	if err := pool.AddTransaction(expensive); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.AddTransaction(cheap); !errors.Is(err, ErrPoolFull) {
+		t.Fatalf("Expected ErrPoolFull, got %v", err)
+	}
+
+	pool.RemoveTransaction(expensive.ID)
+	if err := pool.AddTransaction(cheap); err != nil {
+		t.Errorf("Expected the rejected transaction to be accepted on resend, got %v", err)
+	}
+	if err := pool.AddTransaction(expensive); !errors.Is(err, ErrDoubleSpend) {
+		t.Errorf("Expected ErrDoubleSpend for an already accepted transaction, got %v", err)
+	}
+	if other := NewTransactionPool(); other.AddTransaction(expensive) != nil {
+		t.Error("Expected another pool to have its own double spend guard")
+	}
+}
+
+// TestPool_NonceSource - транзакции с использованным nonce отклоняются и удаляются
+func TestPool_NonceSource(t *testing.T) {
+	pool := NewTransactionPool()
+	accountNonce := uint64(0)
+	pool.SetNonceSource(func(string) uint64 { return accountNonce })
+
+	pool.AddTransaction(makeTx("alice", 0, 1))
+	pool.AddTransaction(makeTx("alice", 1, 1))
+	pool.AddTransaction(makeTx("alice", 3, 1))
+
+	// Транзакция с nonce 0 вошла в блок
+	accountNonce = 1
+	if err := pool.AddTransaction(makeTx("alice", 0, 10)); !errors.Is(err, ErrNonceTooLow) {
+		t.Errorf("Expected ErrNonceTooLow, got %v", err)
+	}
+	if got := fmt.Sprint(ids(pool.GetTransactions(10))); got != "[alice/1]" {
+		t.Errorf("Expected only alice/1 to be pending, got %s", got)
+	}
+	if pool.Size() != 2 {
+		t.Errorf("Expected stale transaction to be removed, size %d", pool.Size())
+	}
+	// Следующий nonce идёт за готовой цепочкой; alice/3 ждёт nonce 2
+	if next := pool.NextNonce("alice"); next != 2 {
+		t.Errorf("Expected next nonce 2, got %d", next)
+	}
+	if next := pool.NextNonce("bob"); next != accountNonce {
+		t.Errorf("Expected next nonce of an idle sender to be the account nonce, got %d", next)
+	}
+}
+
+// TestPool_BaseFee - выбор по фактической надбавке, транзакции ниже базовой комиссии не выбираются
+func TestPool_BaseFee(t *testing.T) {
+	pool := NewTransactionPool()
+	pool.SetBaseFeeSource(func() float64 { return 0.5 })
+
+	add := func(from string, nonce uint64, fee, tip float64) {
+		tx := makeTx(from, nonce, fee)
+		tx.Tip = tip
+		if err := pool.AddTransaction(tx); err != nil {
+			t.Fatalf("add %s/%d: %v", from, nonce, err)
+		}
+	}
+	add("alice", 0, 1, 0.1)
+	add("alice", 1, 0.4, 0.4) // не покрывает базовую комиссию
+	add("alice", 2, 2, 1)     // ждёт alice/1
+	add("bob", 0, 2, 0.3)
+	add("carol", 0, 0.7, 1) // надбавка ограничена Fee-baseFee = 0.2
+
+	got := fmt.Sprint(ids(pool.GetTransactions(10)))
+	if want := "[bob/0 carol/0 alice/0]"; got != want {
+		t.Fatalf("selection: got %s, want %s", got, want)
+	}
+	if pool.Size() != 5 {
+		t.Fatalf("underpriced transactions must stay in the pool, size %d", pool.Size())
+	}
+
+	tx := makeTx("dave", 0, 1)
+	tx.Tip = 0.2
+	if tip := tx.EffectiveTip(0.5); tip != 0.2 {
+		t.Fatalf("effective tip: got %f", tip)
+	}
+	if fee := tx.EffectiveFee(0.9); fee != 1 {
+		t.Fatalf("effective fee must be capped by Fee: got %f", fee)
+	}
+}
@@ -0,0 +1,84 @@
+package txpool
+
+// стейкинговые транзакции
+
+import (
+	"fmt"
+	"time"
+
+	"blockchain/codec"
+)
+
+// TxType — вид транзакции
+type TxType string
+
+const (
+	TxTransfer        TxType = ""                 // перевод Amount со счёта From на счёт To
+	TxCreateValidator TxType = "create_validator" // From становится валидатором с собственным стейком Amount
+	TxEditValidator   TxType = "edit_validator"   // валидатор From меняет ставку комиссии
+	TxDelegate        TxType = "delegate"         // From делегирует Amount валидатору To
+	TxUndelegate      TxType = "undelegate"       // From отзывает Amount у валидатора To после периода разблокировки
+	TxRedelegate      TxType = "redelegate"       // From переносит Amount от валидатора To к StakingData.DstValidator
+	TxJailValidator   TxType = "jail_validator"   // решение говернанса: исключить валидатора To (From — pos.StakingConfig.Authority)
+	TxUnjailValidator TxType = "unjail_validator" // решение говернанса: вернуть валидатора To в набор
+)
+
+// Bonds сообщает, списывается ли Amount со счёта отправителя в стейк или
+// получателю. У отзыва, переноса и смены комиссии Amount — сумма стейка,
+// счёт отправителя оплачивает только комиссию.
+func (t TxType) Bonds() bool {
+	return t == TxTransfer || t == TxCreateValidator || t == TxDelegate
+}
+
+// StakingData — параметры стейкинговой транзакции в поле Data
+type StakingData struct {
+	CommissionRate float64 // доля награды, которую валидатор оставляет себе (create_validator, edit_validator)
+	DstValidator   string  // валидатор, к которому переносится стейк (redelegate)
+}
+
+// Encode кодирует параметры для поля Data
+func (d *StakingData) Encode() []byte {
+	w := codec.NewWriter(codec.KindStakingData)
+	w.Float64(d.CommissionRate)
+	w.String(d.DstValidator)
+	return w.Result()
+}
+
+// DecodeStakingData разбирает параметры стейкинговой транзакции; пустое поле Data — нулевые параметры
+func DecodeStakingData(data []byte) (*StakingData, error) {
+	if len(data) == 0 {
+		return &StakingData{}, nil
+	}
+	r, err := codec.NewReader(data, codec.KindStakingData)
+	if err != nil {
+		return nil, err
+	}
+	d := &StakingData{
+		CommissionRate: r.Float64(),
+		DstValidator:   r.String(),
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode staking data: %w", err)
+	}
+	return d, nil
+}
+
+// NewStakingTransaction создаёт стейкинговую транзакцию делегатора (или
+// оператора валидатора) from в адрес валидатора validator для сети chainID
+func NewStakingTransaction(chainID string, txType TxType, from, validator string, amount float64, data *StakingData) *Transaction {
+	tx := &Transaction{
+		From:      from,
+		To:        validator,
+		Amount:    amount,
+		Fee:       DefaultMaxFee,
+		Tip:       DefaultTip,
+		ChainID:   chainID,
+		Timestamp: time.Now().Unix(),
+		Type:      txType,
+	}
+	if data != nil {
+		tx.Data = data.Encode()
+	}
+	tx.ID = tx.ComputeID()
+	return tx
+}
@@ -1,11 +1,14 @@
 package txpool
 
 import (
+	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"time"
 
+	"blockchain/codec"
 	"blockchain/crypto/signature"
 	"blockchain/governance/kyc"
 )
@@ -18,90 +21,192 @@ func SetKYCManager(manager *kyc.KYCManager) {
 	kycManager = manager
 }
 
+// DefaultChainID — идентификатор сети по умолчанию (генезис без chain_id)
+const DefaultChainID = "cbdc-local"
+
+var (
+	ErrIDMismatch   = errors.New("transaction ID does not match its content")
+	ErrWrongChain   = errors.New("transaction belongs to another chain")
+	ErrBadSignature = errors.New("invalid transaction signature")
+)
+
 type Transaction struct {
 	ID        string
 	From      string
 	To        string
 	Amount    float64
-	Fee       float64 // Добавлено: комиссия за транзакцию
+	Fee       float64 // максимальная комиссия, которую готов заплатить отправитель
+	Tip       float64 // максимальная надбавка валидатору сверх базовой комиссии блока
+	Nonce     uint64  // порядковый номер транзакции отправителя
+	ChainID   string  // идентификатор сети, защищает от повтора в другой сети
 	Timestamp int64
 	Signature string
 	IsPrivate bool
 	Encrypted []byte
 	PublicKey []byte
+	Type      TxType // вид транзакции; пустой — перевод
+	Data      []byte // параметры транзакции, зависящие от Type
 }
 
-// Глобальная переменная для отслеживания размера пула транзакций
-var transactionPoolSize int64
-
-func NewTransaction(from, to string, amount float64) *Transaction {
-	// Динамическое вычисление комиссии на основе размера пула транзакций
-	baseFee := 0.001
-	dynamicFee := baseFee
-
-	// Увеличиваем комиссию при высокой нагрузке
-	if transactionPoolSize > 1000 {
-		dynamicFee = baseFee * 2
-	} else if transactionPoolSize > 5000 {
-		dynamicFee = baseFee * 5
-	} else if transactionPoolSize > 10000 {
-		dynamicFee = baseFee * 10
-	}
-
-	transactionPoolSize++
+// Комиссии по умолчанию для NewTransaction. Актуальные значения
+// для текущей загрузки сети возвращает /fees/estimate.
+const (
+	DefaultMaxFee = 0.01
+	DefaultTip    = 0.001
+)
 
-	return &Transaction{
-		ID:        GenerateID(),
+// NewTransaction создаёт перевод from -> to для сети chainID
+func NewTransaction(chainID, from, to string, amount float64) *Transaction {
+	tx := &Transaction{
 		From:      from,
 		To:        to,
 		Amount:    amount,
-		Fee:       dynamicFee, // Добавляем динамическую комиссию
+		Fee:       DefaultMaxFee,
+		Tip:       DefaultTip,
+		ChainID:   chainID,
 		Timestamp: time.Now().Unix(),
 	}
+	tx.ID = tx.ComputeID()
+	return tx
+}
+
+// EffectiveTip возвращает надбавку валидатору при заданной базовой комиссии:
+// min(Tip, Fee-baseFee). Отрицательное значение означает, что транзакция
+// не может быть включена в блок с такой базовой комиссией.
+func (t *Transaction) EffectiveTip(baseFee float64) float64 {
+	return math.Min(t.Tip, t.Fee-baseFee)
 }
 
+// EffectiveFee возвращает комиссию, фактически списываемую с отправителя
+func (t *Transaction) EffectiveFee(baseFee float64) float64 {
+	return baseFee + t.EffectiveTip(baseFee)
+}
+
+// Serialize возвращает подписываемые поля транзакции в каноническом
+// кодировании: все поля, кроме ID и подписи
 func (t *Transaction) Serialize() []byte {
-	temp := struct {
-		From      string
-		To        string
-		Amount    float64
-		Timestamp int64
-	}{
-		From:      t.From,
-		To:        t.To,
-		Amount:    t.Amount,
-		Timestamp: t.Timestamp,
+	w := codec.NewWriter(codec.KindTxSigning)
+	w.String(t.ChainID)
+	w.String(t.From)
+	w.String(t.To)
+	w.Float64(t.Amount)
+	w.Float64(t.Fee)
+	w.Float64(t.Tip)
+	w.Uint64(t.Nonce)
+	w.Int64(t.Timestamp)
+	w.Bool(t.IsPrivate)
+	w.Bytes(t.Encrypted)
+	w.Bytes(t.PublicKey)
+	w.String(string(t.Type))
+	w.Bytes(t.Data)
+	return w.Result()
+}
+
+// ComputeID возвращает ID транзакции — хэш подписываемых полей
+func (t *Transaction) ComputeID() string {
+	hash := sha256.Sum256(t.Serialize())
+	return hex.EncodeToString(hash[:])
+}
+
+// CheckID проверяет, что ID вычислен по содержимому транзакции
+// и транзакция предназначена для сети chainID
+func (t *Transaction) CheckID(chainID string) error {
+	if t.ChainID != chainID {
+		return fmt.Errorf("%w: %q, expected %q", ErrWrongChain, t.ChainID, chainID)
+	}
+	if computed := t.ComputeID(); t.ID != computed {
+		return fmt.Errorf("%w: got %s, computed %s", ErrIDMismatch, t.ID, computed)
 	}
-	data, _ := json.Marshal(temp)
-	return data
+	return nil
 }
 
-// Verify verifies the transaction signature and KYC status
-func (t *Transaction) Verify() bool {
-	// 1. Проверка наличия публичного ключа
-	pubKey, err := signature.GetPublicKey(t.From)
+// Encode кодирует транзакцию целиком (для хранения и передачи по сети)
+func (t *Transaction) Encode() []byte {
+	w := codec.NewWriter(codec.KindTransaction)
+	w.String(t.ID)
+	w.String(t.From)
+	w.String(t.To)
+	w.Float64(t.Amount)
+	w.Float64(t.Fee)
+	w.Float64(t.Tip)
+	w.Uint64(t.Nonce)
+	w.String(t.ChainID)
+	w.Int64(t.Timestamp)
+	w.String(t.Signature)
+	w.Bool(t.IsPrivate)
+	w.Bytes(t.Encrypted)
+	w.Bytes(t.PublicKey)
+	w.String(string(t.Type))
+	w.Bytes(t.Data)
+	return w.Result()
+}
+
+// DecodeTransaction восстанавливает транзакцию, закодированную Encode
+func DecodeTransaction(data []byte) (*Transaction, error) {
+	r, err := codec.NewReader(data, codec.KindTransaction)
 	if err != nil {
-		fmt.Printf("❌ Public key not found for %s: %v\n", t.From, err)
-		return false
+		return nil, err
+	}
+	t := &Transaction{
+		ID:        r.String(),
+		From:      r.String(),
+		To:        r.String(),
+		Amount:    r.Float64(),
+		Fee:       r.Float64(),
+		Tip:       r.Float64(),
+		Nonce:     r.Uint64(),
+		ChainID:   r.String(),
+		Timestamp: r.Int64(),
+		Signature: r.String(),
+		IsPrivate: r.Bool(),
+		Encrypted: r.Bytes(),
+		PublicKey: r.Bytes(),
+		Type:      TxType(r.String()),
+		Data:      r.Bytes(),
+	}
+	if err := r.Finish(); err != nil {
+		return nil, fmt.Errorf("failed to decode transaction: %w", err)
 	}
+	return t, nil
+}
+
+// Hash возвращает канонический хэш транзакции по всем полям, включая подпись.
+// Используется как лист дерева Меркла блока.
+func (t *Transaction) Hash() []byte {
+	hash := sha256.Sum256(t.Encode())
+	return hash[:]
+}
 
-	// 2. Проверка подписи транзакции
+// VerifySignature проверяет, что ID вычислен по содержимому, а подпись
+// сделана ключом отправителя. Это правило консенсуса: в отличие от Verify
+// проверка KYC — политика узла — здесь не выполняется.
+func (t *Transaction) VerifySignature(chainID string) error {
+	if err := t.CheckID(chainID); err != nil {
+		return err
+	}
+	pubKey, err := signature.GetPublicKey(t.From)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
 	sigBytes, err := hex.DecodeString(t.Signature)
 	if err != nil {
-		fmt.Printf("❌ Failed to decode signature hex: %v\n", err)
-		return false
+		return fmt.Errorf("%w: %v", ErrBadSignature, err)
 	}
-	
-	// Debug: print serialized data
-	serialized := t.Serialize()
-	fmt.Printf("🔍 Verifying tx %s: data=%s, sigLen=%d\n", t.ID, string(serialized), len(sigBytes))
-	
-	if !signature.Verify(pubKey, serialized, sigBytes) {
-		fmt.Printf("❌ Signature verification failed for transaction %s\n", t.ID)
+	if !signature.Verify(pubKey, t.Serialize(), sigBytes) {
+		return fmt.Errorf("%w: %s", ErrBadSignature, t.ID)
+	}
+	return nil
+}
+
+// Verify verifies the transaction signature and KYC status
+func (t *Transaction) Verify(chainID string) bool {
+	// 1. ID и подпись транзакции для сети chainID
+	if err := t.VerifySignature(chainID); err != nil {
+		fmt.Printf("❌ Transaction %s rejected: %v\n", t.ID, err)
 		return false
 	}
 
-	// 3. Проверка KYC (если доступен менеджер KYC)
+	// 2. Проверка KYC (если доступен менеджер KYC)
 	if kycManager != nil {
 		kycStatus, _ := kycManager.CheckKYC(t.From)
 		if kycStatus != kyc.Verified {
@@ -109,7 +214,7 @@ func (t *Transaction) Verify() bool {
 			return false
 		}
 
-		// 4. Проверка AML
+		// 3. Проверка AML
 		if kycManager.CheckSanctions(t.From) {
 			fmt.Printf("❌ Transaction rejected: sender in sanctions list\n")
 			return false
@@ -0,0 +1,35 @@
+package txpool
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestCheckID - ID зависит от всех подписываемых полей и проверяется по содержимому
+func TestCheckID(t *testing.T) {
+	tx := NewTransaction(DefaultChainID, "alice", "bob", 10)
+	if err := tx.CheckID(DefaultChainID); err != nil {
+		t.Fatalf("Expected fresh transaction to pass, got %v", err)
+	}
+
+	twin := NewTransaction(DefaultChainID, "alice", "bob", 10)
+	twin.Timestamp = tx.Timestamp
+	twin.Fee = tx.Fee
+	twin.Nonce = 1
+	if twin.ComputeID() == tx.ID {
+		t.Errorf("Expected nonce to change the transaction ID")
+	}
+
+	tampered := *tx
+	tampered.Fee = 100
+	if err := tampered.CheckID(DefaultChainID); !errors.Is(err, ErrIDMismatch) {
+		t.Errorf("Expected ErrIDMismatch for changed fee, got %v", err)
+	}
+
+	foreign := *tx
+	foreign.ChainID = "other-chain"
+	foreign.ID = foreign.ComputeID()
+	if err := foreign.CheckID(DefaultChainID); !errors.Is(err, ErrWrongChain) {
+		t.Errorf("Expected ErrWrongChain, got %v", err)
+	}
+}
@@ -7,13 +7,16 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/asn1"
-	"encoding/base64"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"math/big"
 	"net/http"
+	"net/url"
+	"os"
 	"strconv"
 	"time"
 )
@@ -26,25 +29,65 @@ type Transaction struct {
 	To        string  `json:"To"`
 	Amount    float64 `json:"Amount"`
 	Fee       float64 `json:"Fee"`
+	Tip       float64 `json:"Tip"`
+	Nonce     uint64  `json:"Nonce"`
+	ChainID   string  `json:"ChainID"`
 	Timestamp int64   `json:"Timestamp"`
 	Signature string  `json:"Signature"`
 	IsPrivate bool    `json:"IsPrivate"`
+	Encrypted []byte  `json:"Encrypted"`
+	PublicKey []byte  `json:"PublicKey"`
+	Type      string  `json:"Type,omitempty"` // вид транзакции узла (txpool.TxType); пустой — перевод
+	Data      []byte  `json:"Data,omitempty"` // параметры стейкинговой транзакции (txpool.StakingData)
 }
 
+// Версия и типы записей канонического кодирования узла (blockchain/codec)
+const (
+	codecVersion       byte = 2
+	codecKindTxSigning byte = 0x02
+)
+
+// Идентификатор сети по умолчанию (txpool.DefaultChainID); сеть с другим
+// chain_id в генезисе задаётся переменной BLOCKCHAIN_CHAIN_ID
+const defaultChainID = "cbdc-local"
+
+// Адрес REST API узла
+var nodeURL = "http://localhost:8081"
+
+// Serialize возвращает подписываемые поля транзакции (все, кроме ID и
+// подписи) в каноническом кодировании узла: [версия][тип], строки и
+// байты — длина u32 big-endian и содержимое, числа — 8 байт big-endian
 func (t *Transaction) Serialize() []byte {
-	temp := struct {
-		From      string
-		To        string
-		Amount    float64
-		Timestamp int64
-	}{
-		From:      t.From,
-		To:        t.To,
-		Amount:    t.Amount,
-		Timestamp: t.Timestamp,
-	}
-	data, _ := json.Marshal(temp)
-	return data
+	buf := []byte{codecVersion, codecKindTxSigning}
+	buf = appendBytes(buf, []byte(t.ChainID))
+	buf = appendBytes(buf, []byte(t.From))
+	buf = appendBytes(buf, []byte(t.To))
+	buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(t.Amount))
+	buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(t.Fee))
+	buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(t.Tip))
+	buf = binary.BigEndian.AppendUint64(buf, t.Nonce)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(t.Timestamp))
+	if t.IsPrivate {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	buf = appendBytes(buf, t.Encrypted)
+	buf = appendBytes(buf, t.PublicKey)
+	buf = appendBytes(buf, []byte(t.Type))
+	buf = appendBytes(buf, t.Data)
+	return buf
+}
+
+func appendBytes(buf, data []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(data)))
+	return append(buf, data...)
+}
+
+// ComputeID возвращает ID транзакции так же, как узел: хэш подписываемых полей
+func (t *Transaction) ComputeID() string {
+	hash := sha256.Sum256(t.Serialize())
+	return hex.EncodeToString(hash[:])
 }
 
 // =================== Генерация ключей ===================
@@ -98,8 +141,63 @@ func SignTransaction(tx *Transaction, privKeyHex string) (string, error) {
 
 // =================== Отправка на API ===================
 
+// FeeEstimate — рекомендация узла для включения в течение TargetBlocks блоков
+type FeeEstimate struct {
+	TargetBlocks int     `json:"target_blocks"`
+	Tip          float64 `json:"tip"`
+	MaxFee       float64 `json:"max_fee"`
+}
+
+// FetchFeeEstimate запрашивает у узла комиссии для подтверждения в течение targetBlocks блоков
+func FetchFeeEstimate(targetBlocks int) (*FeeEstimate, error) {
+	resp, err := http.Get(nodeURL + "/fees/estimate")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch fee estimate: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("fee estimate failed: %s", string(bodyBytes))
+	}
+	var result struct {
+		Estimates []FeeEstimate `json:"estimates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to parse fee estimate: %w", err)
+	}
+	for i := range result.Estimates {
+		if result.Estimates[i].TargetBlocks >= targetBlocks {
+			return &result.Estimates[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no fee estimate for %d blocks", targetBlocks)
+}
+
+// FetchNextNonce запрашивает у узла nonce следующей транзакции счёта
+// с учётом его транзакций, ещё ожидающих в пуле
+func FetchNextNonce(address string) (uint64, error) {
+	resp, err := http.Get(nodeURL + "/accounts?address=" + url.QueryEscape(address))
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch account: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return 0, fmt.Errorf("account lookup failed: %s", string(bodyBytes))
+	}
+	var result struct {
+		NextNonce uint64 `json:"next_nonce"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to parse account: %w", err)
+	}
+	return result.NextNonce, nil
+}
+
 func SendTransaction(tx *Transaction) error {
-	url := "http://localhost:8081/transactions"
+	url := nodeURL + "/transactions"
 
 	body, _ := json.Marshal(tx)
 	resp, err := http.Post(url, "application/json", bytes.NewBuffer(body))
@@ -123,7 +221,7 @@ func RegisterPublicKey(address, pubKey string) error {
 		PubKey  string `json:"pubKey"`
 	}
 
-	url := "http://localhost:8081/register"
+	url := nodeURL + "/register"
 
 	requestBody := RegisterRequest{
 		Address: address,
@@ -157,7 +255,7 @@ func KYCRegister(address, fullName, idNumber, country string) error {
 		Country  string `json:"country"`
 	}
 
-	url := "http://localhost:8081/kyc/register"
+	url := nodeURL + "/kyc/register"
 
 	requestBody := RegisterRequest{
 		Address:  address,
@@ -188,7 +286,7 @@ func KYCVerify(address string) error {
 		Address string `json:"address"`
 	}
 
-	url := "http://localhost:8081/kyc/verify"
+	url := nodeURL + "/kyc/verify"
 
 	requestBody := VerifyRequest{
 		Address: address,
@@ -217,7 +315,7 @@ func KYCStatus(address string) (string, float64, error) {
 		RiskScore float64 `json:"riskScore"`
 	}
 
-	url := "http://localhost:8081/kyc/status/" + address
+	url := nodeURL + "/kyc/status/" + address
 
 	resp, err := http.Get(url)
 	if err != nil {
@@ -245,14 +343,62 @@ func KYCStatus(address string) (string, float64, error) {
 	return statusLabels[status.Status], status.RiskScore, nil
 }
 
-// =================== Генерация ID ===================
+// SubmitTransfer подписывает новым ключом и отправляет узлу перевод со
+// следующим nonce счёта и комиссией под подтверждение в течение ~3 блоков
+func SubmitTransfer(from, to string, amount float64, isPrivate bool) (*Transaction, error) {
+	// Генерируем ключи
+	privKey, pubKey, err := GenerateKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	// Регистрируем публичный ключ
+	if err := RegisterPublicKey(from, pubKey); err != nil {
+		return nil, err
+	}
+
+	// Комиссия под подтверждение в течение ~3 блоков
+	fee, err := FetchFeeEstimate(3)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nonce входит в подписываемые поля: узел принимает только следующий по счёту
+	nonce, err := FetchNextNonce(from)
+	if err != nil {
+		return nil, err
+	}
+
+	// Создаем транзакцию
+	chainID := os.Getenv("BLOCKCHAIN_CHAIN_ID")
+	if chainID == "" {
+		chainID = defaultChainID
+	}
+	tx := &Transaction{
+		From:      from,
+		To:        to,
+		Amount:    amount,
+		Fee:       fee.MaxFee,
+		Tip:       fee.Tip,
+		Nonce:     nonce,
+		ChainID:   chainID,
+		Timestamp: time.Now().Unix(),
+		IsPrivate: isPrivate,
+	}
+	tx.ID = tx.ComputeID()
+
+	// Подписываем
+	sig, err := SignTransaction(tx, privKey)
+	if err != nil {
+		return nil, err
+	}
+	tx.Signature = sig
 
-func GenerateSecureToken(n int) string {
-	b := make([]byte, n)
-	if _, err := rand.Read(b); err != nil {
-		return ""
+	// Отправляем
+	if err := SendTransaction(tx); err != nil {
+		return nil, err
 	}
-	return base64.URLEncoding.EncodeToString(b)
+	return tx, nil
 }
 
 // =================== Main ===================
@@ -305,42 +451,11 @@ func main() {
 
 		isPrivate := txData.IsPrivate == "true"
 
-		// Генерируем ключи
-		privKey, pubKey, err := GenerateKeys()
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		// Регистрируем публичный ключ
-		if err := RegisterPublicKey(txData.From, pubKey); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		// Создаем транзакцию
-		tx := &Transaction{
-			ID:        GenerateSecureToken(32),
-			From:      txData.From,
-			To:        txData.To,
-			Amount:    amount,
-			Timestamp: time.Now().Unix(),
-			IsPrivate: isPrivate,
-		}
-
-		// Подписываем
-		sig, err := SignTransaction(tx, privKey)
+		tx, err := SubmitTransfer(txData.From, txData.To, amount, isPrivate)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		tx.Signature = sig
-
-		// Отправляем
-		if err := SendTransaction(tx); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
 
 		// Ответ
 		fmt.Fprintf(w, "✅ Транзакция отправлена: %s\n", tx.ID)
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+// TestSerialize_MatchesNodeGolden - подписываемые байты и ID совпадают с эталоном узла
+func TestSerialize_MatchesNodeGolden(t *testing.T) {
+	data, err := os.ReadFile("../blockchain/codec/testdata/golden.json")
+	if err != nil {
+		t.Fatalf("Failed to read node golden vectors: %v", err)
+	}
+	var golden map[string]string
+	if err := json.Unmarshal(data, &golden); err != nil {
+		t.Fatalf("Failed to parse golden vectors: %v", err)
+	}
+
+	// Те же значения, что и в blockchain/codec/golden_test.go
+	stakingData, err := hex.DecodeString(golden["staking_data"])
+	if err != nil || len(stakingData) == 0 {
+		t.Fatalf("Missing staking_data golden vector: %v", err)
+	}
+	tx := &Transaction{
+		From:      "alice",
+		To:        "bob",
+		Amount:    12.5,
+		Fee:       0.001,
+		Tip:       0.0005,
+		Nonce:     3,
+		ChainID:   "cbdc-test",
+		Timestamp: 1700000000,
+		Signature: "3045022100ab",
+		IsPrivate: true,
+		Encrypted: []byte{0xde, 0xad},
+		PublicKey: []byte{0x04, 0x01},
+		Type:      "redelegate",
+		Data:      stakingData,
+	}
+	if got := hex.EncodeToString(tx.Serialize()); got != golden["tx_signing"] {
+		t.Errorf("Client signing bytes drifted from node\n got  %s\n want %s", got, golden["tx_signing"])
+	}
+	if got := tx.ComputeID(); got != golden["tx_id"] {
+		t.Errorf("Client transaction ID drifted from node: got %s, want %s", got, golden["tx_id"])
+	}
+}
+
+// fakeNode — REST API узла, принимающий только транзакции со следующим nonce счёта
+func fakeNode(t *testing.T) map[string]uint64 {
+	var mu sync.Mutex
+	nonces := make(map[string]uint64)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/register", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/fees/estimate", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"estimates": []FeeEstimate{{TargetBlocks: 3, Tip: 0.001, MaxFee: 0.01}},
+		})
+	})
+	mux.HandleFunc("/accounts", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]uint64{"next_nonce": nonces[r.URL.Query().Get("address")]})
+	})
+	mux.HandleFunc("/transactions", func(w http.ResponseWriter, r *http.Request) {
+		var tx Transaction
+		if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if tx.ID != tx.ComputeID() {
+			http.Error(w, "transaction ID mismatch", http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if tx.Nonce != nonces[tx.From] {
+			http.Error(w, fmt.Sprintf("invalid nonce %d, expected %d", tx.Nonce, nonces[tx.From]), http.StatusBadRequest)
+			return
+		}
+		nonces[tx.From]++
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	previous := nodeURL
+	nodeURL = server.URL
+	t.Cleanup(func() { nodeURL = previous })
+	return nonces
+}
+
+// TestSubmitTransfer_SecondSendUsesNextNonce - повторный перевод со счёта берёт следующий nonce
+func TestSubmitTransfer_SecondSendUsesNextNonce(t *testing.T) {
+	nonces := fakeNode(t)
+
+	for want := uint64(0); want < 2; want++ {
+		tx, err := SubmitTransfer("alice", "bob", 10, false)
+		if err != nil {
+			t.Fatalf("Send %d failed: %v", want+1, err)
+		}
+		if tx.Nonce != want {
+			t.Errorf("Send %d: expected nonce %d, got %d", want+1, want, tx.Nonce)
+		}
+	}
+	if nonces["alice"] != 2 {
+		t.Errorf("Expected node to accept 2 transactions, got %d", nonces["alice"])
+	}
+}